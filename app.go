@@ -0,0 +1,254 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/cors"
+	"os"
+	"os/signal"
+	"strings"
+	"syscall"
+	"task-app/cache"
+	"task-app/config"
+	"task-app/db"
+	"task-app/encryption"
+	"task-app/exports"
+	"task-app/github"
+	"task-app/jobs"
+	"task-app/logging"
+	"task-app/mailer"
+	"task-app/metrics"
+	"task-app/notifications"
+	"task-app/oauth"
+	"task-app/push"
+	"task-app/queue"
+	"task-app/quota"
+	"task-app/ratelimit"
+	"task-app/realtime"
+	"task-app/repository"
+	"task-app/router"
+	"task-app/rpc"
+	"task-app/slack"
+	"task-app/storage"
+	"task-app/telegram"
+	"task-app/tracing"
+	"task-app/util"
+	"task-app/webhooks"
+	"time"
+)
+
+// App is the server with its background workers, started and stopped together
+type App struct {
+	server          *fiber.App
+	bot             *telegram.Bot
+	rpc             *rpc.Server
+	cache           *cache.Cache
+	addr            string
+	grpcAddr        string
+	shutdownTimeout time.Duration
+}
+
+// NewApp connects the backends and sets up the routes
+func NewApp(cfg *config.Config) (*App, error) {
+	logging.Setup()
+	if err := db.ConnectToDB(cfg); err != nil {
+		return nil, err
+	}
+	store := db.NewStore(db.DB)
+	tokens, err := util.NewTokenService(store, cfg.Auth)
+	if err != nil {
+		return nil, err
+	}
+	// for the package-level functions of util
+	if err := util.SetupAuth(cfg.Auth); err != nil {
+		return nil, err
+	}
+	if cfg.Database.MigrateOnStart {
+		logging.Log.Info().Msg("Running the migrations...")
+		if err := db.MigrateUp(); err != nil {
+			logging.Log.Error().Err(err).Msg("Migrations failed")
+		}
+	}
+	if err := db.UseReplicas(cfg.Database); err != nil {
+		return nil, err
+	}
+	if err := db.PromoteAdmins(cfg.Accounts.AdminEmails); err != nil {
+		logging.Log.Error().Err(err).Msg("Cannot promote the admins")
+	}
+	if err := tracing.Setup(); err != nil {
+		logging.Log.Error().Err(err).Msg("Cannot set up tracing")
+	}
+	storage.SetupStorage(cfg.Auth.Secret)
+	oauth.SetupProviders()
+	ratelimit.SetupStore()
+	readCache, err := cache.New(cfg.Cache)
+	if err != nil {
+		return nil, err
+	}
+	if err := readCache.Watch(store.DB()); err != nil {
+		return nil, err
+	}
+	if err := repository.EnforceTenants(store.DB()); err != nil {
+		return nil, err
+	}
+	if err := quota.New(cfg.Plans).Enforce(store.DB()); err != nil {
+		return nil, err
+	}
+	keyring, err := encryption.New(store.DB(), cfg.Encryption)
+	if err != nil {
+		return nil, err
+	}
+	if err := keyring.Register(store.DB()); err != nil {
+		return nil, err
+	}
+	readCache.UseEncryption(keyring)
+	webhooks.Setup()
+	github.Setup()
+	jobs.Schedule(jobs.TrashPurge(time.Hour))
+	jobs.Schedule(jobs.IdempotencyPurge(time.Hour))
+	jobs.Schedule(jobs.TokenCleanup(time.Hour))
+	jobs.Schedule(jobs.OverdueMarking(15 * time.Minute))
+	jobs.Schedule(jobs.ExportPurge(time.Hour))
+	jobs.Schedule(jobs.DeviceCleanup(24 * time.Hour))
+	if cfg.Accounts.Demo {
+		jobs.Schedule(jobs.DemoCleanup(15 * time.Minute))
+	}
+	mailer.Setup(cfg.Mail)
+	notifier := notifications.New(store)
+	notifier.UseEmail(notifications.NewEmailSender(cfg.Auth.Secret, cfg.Mail.BaseURL))
+	pusher, err := push.New(cfg.Push)
+	if err != nil {
+		return nil, err
+	}
+	if pusher.Enabled() {
+		notifier.UsePush(pusher)
+	}
+	var bot *telegram.Bot
+	if cfg.Telegram.Token != "" {
+		bot = telegram.New(store, cfg.Telegram)
+		if err := bot.Start(); err != nil {
+			logging.Log.Error().Err(err).Msg("Cannot start the Telegram bot")
+		}
+		notifier.UseChat(bot)
+	}
+	exports.Setup(notifier)
+	// the workers start once every kind of job has its handler
+	if err := queue.Setup(cfg.Queue, keyring); err != nil {
+		return nil, err
+	}
+	jobs.Schedule(jobs.DueReminders(notifier, 15*time.Minute))
+	if cfg.Mail.DigestHour >= 0 {
+		jobs.Schedule(jobs.DailyDigest(notifier, cfg.Mail.DigestHour, 15*time.Minute))
+	}
+
+	server := CreateServer()
+	server.Use(tracing.Middleware())
+	server.Use(logging.Middleware(logging.Log))
+	server.Use(metrics.Middleware())
+	server.Use(cors.New(corsConfig(cfg.CORS)))
+	router.New(store, tokens, notifier, cfg).UseCache(readCache).UseEncryption(keyring).Setup(server)
+	// the jobs publish events, they start once the router subscribed to them
+	jobs.Start(cfg.Jobs)
+	if bot != nil && cfg.Telegram.Mode == "webhook" {
+		server.Post(telegram.WebhookPath, bot.HandleWebhook)
+	}
+
+	server.Use(func(c *fiber.Ctx) error {
+		return fiber.ErrNotFound // => 404 "Not Found"
+	})
+
+	return &App{
+		server:          server,
+		bot:             bot,
+		rpc:             rpc.New(store, tokens),
+		cache:           readCache,
+		addr:            cfg.Server.Addr,
+		grpcAddr:        cfg.Server.GRPCAddr,
+		shutdownTimeout: cfg.Server.ShutdownTimeout,
+	}, nil
+}
+
+// corsConfig returns the CORS middleware config of the app config
+func corsConfig(c config.CORS) cors.Config {
+	return cors.Config{
+		AllowOrigins:     strings.Join(c.AllowOrigins, ","),
+		AllowMethods:     strings.Join(c.AllowMethods, ","),
+		AllowHeaders:     strings.Join(c.AllowHeaders, ","),
+		AllowCredentials: c.AllowCredentials,
+		// the pages can read the version answering, the deprecation of the legacy paths,
+		// the ETags to send back in If-Match and the replays of the idempotent requests
+		ExposeHeaders: strings.Join([]string{router.VersionHeader, "Deprecation", "Sunset", fiber.HeaderLink, fiber.HeaderETag, router.ReplayedHeader}, ","),
+		MaxAge:        int(c.MaxAge.Seconds()),
+		// the clients of CalDAV are not pages, their OPTIONS asks the capabilities of the server
+		Next: func(c *fiber.Ctx) bool {
+			return strings.HasPrefix(c.Path(), router.DAVPath)
+		},
+	}
+}
+
+// Run serves until SIGINT or SIGTERM, then shuts down gracefully
+func (a *App) Run() error {
+	errc := make(chan error, 2)
+	go func() {
+		errc <- a.server.Listen(a.addr)
+	}()
+	if a.grpcAddr != "" {
+		go func() {
+			errc <- a.rpc.Serve(a.grpcAddr)
+		}()
+	}
+
+	quit := make(chan os.Signal, 1)
+	signal.Notify(quit, os.Interrupt, syscall.SIGTERM)
+
+	select {
+	case err := <-errc:
+		return err
+	case sig := <-quit:
+		logging.Log.Info().Str("signal", sig.String()).Msg("Shutting down")
+	}
+
+	return a.Shutdown()
+}
+
+// Shutdown stops accepting connections, drains the requests in flight, waits for the
+// background workers and closes the database, giving up after the shutdown timeout
+func (a *App) Shutdown() error {
+	done := make(chan error, 1)
+	go func() {
+		// the event streams never end by themselves
+		realtime.DefaultHub.Close()
+
+		err := a.server.Shutdown()
+		a.rpc.Stop()
+		jobs.Stop()
+		webhooks.Stop()
+		github.Stop()
+		queue.Stop()
+		slack.Stop()
+		mailer.Stop()
+		if a.bot != nil {
+			a.bot.Stop()
+		}
+		if ratelimit.Store != nil {
+			ratelimit.Store.Close()
+		}
+		a.cache.Close()
+
+		if traceErr := tracing.Shutdown(context.Background()); err == nil {
+			err = traceErr
+		}
+		if dbErr := db.Close(); err == nil {
+			err = dbErr
+		}
+		done <- err
+	}()
+
+	select {
+	case err := <-done:
+		return err
+	case <-time.After(a.shutdownTimeout):
+		return errors.New("shutdown timed out after " + a.shutdownTimeout.String())
+	}
+}
@@ -0,0 +1,130 @@
+// Package avatars keeps the avatars uploaded by the users, resized to the standard sizes
+package avatars
+
+import (
+	"bytes"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"image"
+	"image/color"
+	_ "image/gif"
+	_ "image/jpeg"
+	"image/png"
+	"io"
+	"task-app/models"
+	"task-app/storage"
+)
+
+// MaxPixels is the largest avatar accepted, its width times its height, so a small file
+// of a huge image does not exhaust the memory when it is decoded
+const MaxPixels = 4096 * 4096
+
+var (
+	// ErrFormat is returned for an avatar which is not a PNG, JPEG or GIF image
+	ErrFormat = errors.New("The avatar must be a PNG, JPEG or GIF image")
+	// ErrTooLarge is returned for an avatar of more than MaxPixels
+	ErrTooLarge = errors.New("The avatar must be at most 4096x4096 pixels")
+)
+
+// Store resizes the image to every size of models.AvatarSizes and stores them,
+// it returns the key of the avatar of the user
+func Store(userID uint, r io.Reader) (string, error) {
+	data, err := io.ReadAll(r)
+	if err != nil {
+		return "", err
+	}
+
+	cfg, _, err := image.DecodeConfig(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrFormat
+	}
+	if cfg.Width*cfg.Height > MaxPixels {
+		return "", ErrTooLarge
+	}
+	img, _, err := image.Decode(bytes.NewReader(data))
+	if err != nil {
+		return "", ErrFormat
+	}
+
+	key := fmt.Sprintf("avatars/%d/%s", userID, uuid.New())
+	square := crop(img)
+	for _, size := range models.AvatarSizes {
+		var buf bytes.Buffer
+		if err := png.Encode(&buf, resize(square, size)); err != nil {
+			return "", err
+		}
+		if err := storage.Store.Put(models.AvatarFile(key, size), &buf, int64(buf.Len()), "image/png"); err != nil {
+			Remove(key)
+			return "", err
+		}
+	}
+
+	return key, nil
+}
+
+// Remove deletes the files of the avatar of the key, a file left behind costs only space
+func Remove(key string) {
+	if key == "" {
+		return
+	}
+	for _, size := range models.AvatarSizes {
+		storage.Store.Delete(models.AvatarFile(key, size))
+	}
+}
+
+// crop returns the square in the center of the image
+func crop(img image.Image) image.Image {
+	b := img.Bounds()
+	side := b.Dx()
+	if b.Dy() < side {
+		side = b.Dy()
+	}
+	x, y := b.Min.X+(b.Dx()-side)/2, b.Min.Y+(b.Dy()-side)/2
+
+	return subImage(img, image.Rect(x, y, x+side, y+side))
+}
+
+func subImage(img image.Image, r image.Rectangle) image.Image {
+	if s, ok := img.(interface {
+		SubImage(image.Rectangle) image.Image
+	}); ok {
+		return s.SubImage(r)
+	}
+
+	return img
+}
+
+// resize scales the square image to the size, every pixel is the average of the pixels it covers.
+// A smaller image is scaled up by repeating its pixels.
+func resize(img image.Image, size int) *image.NRGBA {
+	b := img.Bounds()
+	side := b.Dx()
+	out := image.NewNRGBA(image.Rect(0, 0, size, size))
+
+	for y := 0; y < size; y++ {
+		y0, y1 := b.Min.Y+y*side/size, b.Min.Y+(y+1)*side/size
+		if y1 <= y0 {
+			y1 = y0 + 1
+		}
+		for x := 0; x < size; x++ {
+			x0, x1 := b.Min.X+x*side/size, b.Min.X+(x+1)*side/size
+			if x1 <= x0 {
+				x1 = x0 + 1
+			}
+
+			// the colors are premultiplied by their alpha, so the transparent pixels do not darken the others
+			var r, g, bl, a, n uint64
+			for sy := y0; sy < y1; sy++ {
+				for sx := x0; sx < x1; sx++ {
+					cr, cg, cb, ca := img.At(sx, sy).RGBA()
+					r, g, bl, a = r+uint64(cr), g+uint64(cg), bl+uint64(cb), a+uint64(ca)
+					n++
+				}
+			}
+			out.Set(x, y, color.RGBA64{R: uint16(r / n), G: uint16(g / n), B: uint16(bl / n), A: uint16(a / n)})
+		}
+	}
+
+	return out
+}
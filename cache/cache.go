@@ -0,0 +1,178 @@
+// Package cache keeps the results of the hot reads in Redis, shared by the instances of the app.
+// The entries are grouped by scope, the generation of a scope is part of the keys of its entries,
+// so a write drops them all at once by moving the scope to a new generation. The entries are
+// encrypted by the keyring of UseEncryption, the task lists embed the descriptions.
+package cache
+
+import (
+	"bytes"
+	"encoding/gob"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/config"
+	"task-app/encryption"
+	"task-app/logging"
+	"task-app/metrics"
+	"task-app/ratelimit"
+	"time"
+)
+
+const keyPrefix = "cache:"
+
+// The scopes of the entries
+const (
+	// Users are the user accounts by id
+	Users = "users"
+	// Tasks are the task lists and the statistics, which read the tasks with their details
+	Tasks = "tasks"
+)
+
+// Cache stores the entries with a TTL. A nil Cache is off: it finds nothing and stores nothing.
+type Cache struct {
+	store   fiber.Storage
+	ttl     time.Duration
+	keyring *encryption.Keyring
+}
+
+// New connects to the Redis server of the config, the cache is nil without one
+func New(cfg config.Cache) (*Cache, error) {
+	if cfg.RedisURL == "" {
+		return nil, nil
+	}
+
+	store, err := ratelimit.NewRedisStorage(cfg.RedisURL)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Cache{store: store, ttl: cfg.TTL}, nil
+}
+
+// NewWithStorage returns a cache of the entries in the storage, e.g. a map in the tests
+func NewWithStorage(store fiber.Storage, ttl time.Duration) *Cache {
+	return &Cache{store: store, ttl: ttl}
+}
+
+// UseEncryption encrypts the entries by the keyring, a nil keyring leaves them in plaintext. The
+// entries stored before are still read. They expire within the TTL, the rotation keeps the data
+// keys which encrypted them.
+func (c *Cache) UseEncryption(k *encryption.Keyring) *Cache {
+	if c != nil {
+		c.keyring = k
+	}
+
+	return c
+}
+
+// Get decodes the entry of the key into v and tells whether it was found.
+// The errors of Redis are logged and counted, the caller then reads the database as on a miss.
+func (c *Cache) Get(scope, key string, v interface{}) bool {
+	if c == nil {
+		return false
+	}
+
+	gen, err := c.generation(scope)
+	if err != nil {
+		c.fail(scope, "get", err)
+		return false
+	}
+
+	b, err := c.store.Get(entryKey(scope, gen, key))
+	if err != nil {
+		c.fail(scope, "get", err)
+		return false
+	}
+	if b == nil {
+		metrics.CacheRequests.Inc(scope, "miss")
+		return false
+	}
+	plaintext, err := c.keyring.Decrypt(keyPrefix+scope, string(b))
+	if err != nil {
+		c.fail(scope, "decrypt", err)
+		return false
+	}
+	b = []byte(plaintext)
+
+	if err := gob.NewDecoder(bytes.NewReader(b)).Decode(v); err != nil {
+		// an entry of an older version of a type
+		c.fail(scope, "decode", err)
+		return false
+	}
+
+	metrics.CacheRequests.Inc(scope, "hit")
+	return true
+}
+
+// Set stores v as the entry of the key in the current generation of the scope
+func (c *Cache) Set(scope, key string, v interface{}) {
+	if c == nil {
+		return
+	}
+
+	gen, err := c.generation(scope)
+	if err != nil {
+		c.fail(scope, "set", err)
+		return
+	}
+
+	var b bytes.Buffer
+	if err := gob.NewEncoder(&b).Encode(v); err != nil {
+		c.fail(scope, "encode", err)
+		return
+	}
+	sealed, err := c.keyring.Encrypt(keyPrefix+scope, b.String())
+	if err != nil {
+		c.fail(scope, "encrypt", err)
+		return
+	}
+	if err := c.store.Set(entryKey(scope, gen, key), []byte(sealed), c.ttl); err != nil {
+		c.fail(scope, "set", err)
+	}
+}
+
+// Forget drops every entry of the scopes, they expire by their TTL in the
+// generation left behind
+func (c *Cache) Forget(scopes ...string) {
+	if c == nil {
+		return
+	}
+
+	gen := strconv.FormatInt(time.Now().UnixNano(), 36)
+	for _, scope := range scopes {
+		if err := c.store.Set(generationKey(scope), []byte(gen), 0); err != nil {
+			c.fail(scope, "forget", err)
+		}
+	}
+}
+
+// Close closes the connections to Redis
+func (c *Cache) Close() error {
+	if c == nil {
+		return nil
+	}
+
+	return c.store.Close()
+}
+
+// generation returns the current generation of the scope, 0 until its first write
+func (c *Cache) generation(scope string) (string, error) {
+	b, err := c.store.Get(generationKey(scope))
+	if err != nil || b == nil {
+		return "0", err
+	}
+
+	return string(b), nil
+}
+
+func (c *Cache) fail(scope, op string, err error) {
+	metrics.CacheRequests.Inc(scope, "error")
+	logging.Log.Warn().Err(err).Str("scope", scope).Str("op", op).Msg("Cache failed")
+}
+
+func generationKey(scope string) string {
+	return keyPrefix + scope + ":gen"
+}
+
+func entryKey(scope, gen, key string) string {
+	return keyPrefix + scope + ":" + gen + ":" + key
+}
@@ -0,0 +1,58 @@
+package cache
+
+import "gorm.io/gorm"
+
+// scopeTables are the tables read by the entries of each scope
+var scopeTables = map[string][]string{
+	Users: {"users"},
+	Tasks: {
+		"tasks", "labels", "task_labels", "task_watchers", "checklist_items", "task_dependencies",
+		"projects", "workspaces", "memberships", "comments", "users",
+	},
+}
+
+// Watch drops the scopes reading a table on every write to it through GORM, so the writes
+// made outside the cached repositories drop the entries too. A raw statement, whose table
+// is not known, drops every scope.
+func (c *Cache) Watch(db *gorm.DB) error {
+	if c == nil {
+		return nil
+	}
+
+	byTable := map[string][]string{}
+	for scope, tables := range scopeTables {
+		for _, table := range tables {
+			byTable[table] = append(byTable[table], scope)
+		}
+	}
+	all := make([]string, 0, len(scopeTables))
+	for scope := range scopeTables {
+		all = append(all, scope)
+	}
+
+	forget := func(tx *gorm.DB) {
+		if tx.Error != nil || tx.Statement == nil {
+			return
+		}
+		if tx.Statement.Table == "" {
+			c.Forget(all...)
+			return
+		}
+		if scopes := byTable[tx.Statement.Table]; len(scopes) > 0 {
+			c.Forget(scopes...)
+		}
+	}
+
+	cb := db.Callback()
+	if err := cb.Create().After("gorm:create").Register("cache:forget_create", forget); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Register("cache:forget_update", forget); err != nil {
+		return err
+	}
+	if err := cb.Delete().After("gorm:delete").Register("cache:forget_delete", forget); err != nil {
+		return err
+	}
+
+	return cb.Raw().After("gorm:raw").Register("cache:forget_raw", forget)
+}
@@ -0,0 +1,241 @@
+package caldav
+
+import (
+	"bytes"
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"strings"
+)
+
+// The namespaces of the properties
+const (
+	NamespaceDAV            = "DAV:"
+	NamespaceCalDAV         = "urn:ietf:params:xml:ns:caldav"
+	NamespaceCalendarServer = "http://calendarserver.org/ns/"
+)
+
+// The requests of the REPORT method
+const (
+	ReportCalendarQuery    = "calendar-query"
+	ReportCalendarMultiget = "calendar-multiget"
+)
+
+// prefixes are the prefixes of the namespaces in the responses
+var prefixes = map[string]string{
+	NamespaceDAV:            "d",
+	NamespaceCalDAV:         "c",
+	NamespaceCalendarServer: "cs",
+}
+
+// Name returns the name of a property of the namespace
+func Name(space, local string) xml.Name {
+	return xml.Name{Space: space, Local: local}
+}
+
+// Request is the body of a PROPFIND or of a REPORT
+type Request struct {
+	// Kind is the root element: propfind, calendar-query or calendar-multiget
+	Kind xml.Name
+	// AllProp asks every property, as does a PROPFIND without a body
+	AllProp bool
+	// Props are the properties asked
+	Props []xml.Name
+	// Hrefs are the resources of a calendar-multiget
+	Hrefs []string
+	// Components are the names of the comp-filter of a calendar-query, VCALENDAR first
+	Components []string
+}
+
+// ErrBadRequest is the error of a body which is not XML
+var ErrBadRequest = errors.New("The body must be a WebDAV XML document")
+
+// ParseRequest reads the body of a PROPFIND or of a REPORT, an empty PROPFIND asks every property
+func ParseRequest(body []byte) (*Request, error) {
+	r := &Request{}
+	if len(bytes.TrimSpace(body)) == 0 {
+		r.Kind, r.AllProp = Name(NamespaceDAV, "propfind"), true
+		return r, nil
+	}
+
+	d := xml.NewDecoder(bytes.NewReader(body))
+	var path []xml.Name
+	for {
+		token, err := d.Token()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			return nil, ErrBadRequest
+		}
+
+		switch t := token.(type) {
+		case xml.StartElement:
+			switch {
+			case len(path) == 0:
+				r.Kind = t.Name
+			case t.Name == Name(NamespaceDAV, "allprop"):
+				r.AllProp = true
+			case path[len(path)-1] == Name(NamespaceDAV, "prop") && len(path) == 2:
+				r.Props = append(r.Props, t.Name)
+			case t.Name == Name(NamespaceCalDAV, "comp-filter"):
+				for _, a := range t.Attr {
+					if a.Name.Local == "name" {
+						r.Components = append(r.Components, strings.ToUpper(a.Value))
+					}
+				}
+			case t.Name == Name(NamespaceDAV, "href") && len(path) == 1:
+				var href string
+				if err := d.DecodeElement(&href, &t); err != nil {
+					return nil, ErrBadRequest
+				}
+				r.Hrefs = append(r.Hrefs, strings.TrimSpace(href))
+				continue
+			}
+			path = append(path, t.Name)
+		case xml.EndElement:
+			if len(path) > 0 {
+				path = path[:len(path)-1]
+			}
+		}
+	}
+	if r.Kind.Local == "" {
+		return nil, ErrBadRequest
+	}
+
+	return r, nil
+}
+
+// Wants tells whether the request asks the property
+func (r *Request) Wants(name xml.Name) bool {
+	if r.AllProp {
+		return true
+	}
+	for _, p := range r.Props {
+		if p == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+// Todos tells whether a calendar-query matches the VTODO, it does without a comp-filter
+func (r *Request) Todos() bool {
+	return len(r.Components) < 2 || r.Components[1] == "VTODO"
+}
+
+// Prop is a property of a resource with its value, XML which is already escaped
+type Prop struct {
+	Name  xml.Name
+	Value string
+}
+
+// Props are the properties of a resource
+type Props []Prop
+
+// Add adds a property with a value which is XML
+func (p *Props) Add(name xml.Name, value string) {
+	*p = append(*p, Prop{Name: name, Value: value})
+}
+
+// Text adds a property with a text value, which is escaped
+func (p *Props) Text(name xml.Name, value string) {
+	p.Add(name, Escape(value))
+}
+
+// Response is the answer for a resource of a multistatus
+type Response struct {
+	Href string
+	// Status is the status of the resource itself rather than of its properties, e.g. a 404
+	// for a missing resource of a calendar-multiget
+	Status int
+	Props  Props
+}
+
+// Multistatus builds the 207 of a PROPFIND or of a REPORT
+type Multistatus struct {
+	responses []Response
+}
+
+// Add adds the response of a resource
+func (m *Multistatus) Add(r Response) {
+	m.responses = append(m.responses, r)
+}
+
+// Encode returns the document, with the properties of a resource which the request asks: the
+// ones of the resource are found, the others are answered with a 404. An allprop is answered
+// with the properties of the resource only.
+func (m *Multistatus) Encode(req *Request) string {
+	var b strings.Builder
+	b.WriteString(xml.Header)
+	b.WriteString(`<d:multistatus xmlns:d="DAV:" xmlns:c="urn:ietf:params:xml:ns:caldav" xmlns:cs="http://calendarserver.org/ns/">`)
+
+	for _, r := range m.responses {
+		b.WriteString("<d:response><d:href>" + Escape(r.Href) + "</d:href>")
+		if r.Status != 0 {
+			b.WriteString(status(r.Status) + "</d:response>")
+			continue
+		}
+
+		var found, missing strings.Builder
+		has := map[xml.Name]bool{}
+		for _, p := range r.Props {
+			has[p.Name] = true
+			if req.Wants(p.Name) {
+				found.WriteString(element(p.Name, p.Value))
+			}
+		}
+		if !req.AllProp {
+			for _, name := range req.Props {
+				if !has[name] {
+					missing.WriteString(element(name, ""))
+				}
+			}
+		}
+
+		if found.Len() > 0 {
+			b.WriteString("<d:propstat><d:prop>" + found.String() + "</d:prop>" + status(http.StatusOK) + "</d:propstat>")
+		}
+		if missing.Len() > 0 {
+			b.WriteString("<d:propstat><d:prop>" + missing.String() + "</d:prop>" + status(http.StatusNotFound) + "</d:propstat>")
+		}
+		b.WriteString("</d:response>")
+	}
+
+	b.WriteString("</d:multistatus>")
+	return b.String()
+}
+
+// element returns an element of the name, with the namespace declared when it has no prefix
+func element(name xml.Name, value string) string {
+	tag, attr := name.Local, ""
+	if prefix, ok := prefixes[name.Space]; ok {
+		tag = prefix + ":" + name.Local
+	} else if name.Space != "" {
+		attr = ` xmlns="` + Escape(name.Space) + `"`
+	}
+	if value == "" {
+		return "<" + tag + attr + "/>"
+	}
+
+	return "<" + tag + attr + ">" + value + "</" + tag + ">"
+}
+
+func status(code int) string {
+	return fmt.Sprintf("<d:status>HTTP/1.1 %d %s</d:status>", code, http.StatusText(code))
+}
+
+// Href returns the value of an href property
+func Href(href string) string {
+	return "<d:href>" + Escape(href) + "</d:href>"
+}
+
+// Escape escapes a text for XML
+func Escape(s string) string {
+	var b strings.Builder
+	xml.EscapeText(&b, []byte(s))
+	return b.String()
+}
@@ -0,0 +1,363 @@
+// Package caldav is the protocol of the CalDAV server of the tasks: the VTODO of iCalendar
+// (RFC 5545) and the WebDAV bodies (RFC 4918, RFC 4791) the clients send and are answered.
+package caldav
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// The statuses of a VTODO
+const (
+	StatusNeedsAction = "NEEDS-ACTION"
+	StatusInProcess   = "IN-PROCESS"
+	StatusCompleted   = "COMPLETED"
+	StatusCancelled   = "CANCELLED"
+)
+
+const (
+	utcFormat   = "20060102T150405Z"
+	localFormat = "20060102T150405"
+	dateFormat  = "20060102"
+)
+
+// Todo is a VTODO, the to-do of a calendar
+type Todo struct {
+	UID         string
+	Summary     string
+	Description string
+	// Status is one of the statuses of a VTODO, empty when the client sent none
+	Status string
+	// Priority is 1, the most urgent, to 9; 0 is no priority
+	Priority int
+	Due      *time.Time
+	// Completed is when the to-do was done
+	Completed  *time.Time
+	RRule      string
+	Categories []string
+	Created    time.Time
+	Modified   time.Time
+}
+
+// ErrNoTodo is the error of a calendar which has no VTODO, e.g. one with a VEVENT
+var ErrNoTodo = errors.New("The calendar has no VTODO")
+
+// Calendar returns the VCALENDAR of the to-do. The due dates at the last second of a day of
+// the zone are days, as the tasks of a day are due at the end of it.
+func (t *Todo) Calendar(loc *time.Location) string {
+	var b strings.Builder
+	line := func(format string, a ...interface{}) {
+		b.WriteString(FoldLine(fmt.Sprintf(format, a...)))
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Tasker//Tasks//EN")
+	line("CALSCALE:GREGORIAN")
+	line("BEGIN:VTODO")
+	line("UID:%s", t.UID)
+	line("DTSTAMP:%s", t.Modified.UTC().Format(utcFormat))
+	line("CREATED:%s", t.Created.UTC().Format(utcFormat))
+	line("LAST-MODIFIED:%s", t.Modified.UTC().Format(utcFormat))
+	line("SUMMARY:%s", EscapeText(t.Summary))
+	if t.Description != "" {
+		line("DESCRIPTION:%s", EscapeText(t.Description))
+	}
+	if t.Status != "" {
+		line("STATUS:%s", t.Status)
+	}
+	if t.Priority > 0 {
+		line("PRIORITY:%d", t.Priority)
+	}
+	if t.Due != nil {
+		due := formatDate("DUE", *t.Due, loc)
+		// a recurrence starts at its first occurrence
+		if t.RRule != "" {
+			line("DTSTART%s", strings.TrimPrefix(due, "DUE"))
+		}
+		line(due)
+	}
+	if t.RRule != "" {
+		line("RRULE:%s", t.RRule)
+	}
+	if t.Completed != nil {
+		line("COMPLETED:%s", t.Completed.UTC().Format(utcFormat))
+		line("PERCENT-COMPLETE:100")
+	}
+	if len(t.Categories) > 0 {
+		categories := make([]string, 0, len(t.Categories))
+		for _, c := range t.Categories {
+			categories = append(categories, EscapeText(c))
+		}
+		line("CATEGORIES:%s", strings.Join(categories, ","))
+	}
+	line("END:VTODO")
+	line("END:VCALENDAR")
+
+	return b.String()
+}
+
+// formatDate returns the property of a date, a day when it is the last second of a day
+func formatDate(name string, at time.Time, loc *time.Location) string {
+	local := at.In(loc)
+	if local.Hour() == 23 && local.Minute() == 59 && local.Second() == 59 {
+		return name + ";VALUE=DATE:" + local.Format(dateFormat)
+	}
+
+	return name + ":" + at.UTC().Format(utcFormat)
+}
+
+// ParseTodo reads the VTODO of a calendar, the one without a RECURRENCE-ID when the occurrences
+// of a recurrence are given too. The times without a zone are in the zone given, as are the days,
+// which are due at their last second.
+func ParseTodo(data string, loc *time.Location) (*Todo, error) {
+	var todo *Todo
+	var stack []string
+	var current *Todo
+	override := false
+
+	for _, raw := range unfold(data) {
+		if strings.TrimSpace(raw) == "" {
+			continue
+		}
+		p, err := parseProperty(raw)
+		if err != nil {
+			return nil, err
+		}
+
+		switch p.name {
+		case "BEGIN":
+			stack = append(stack, strings.ToUpper(p.value))
+			// only the properties of a VTODO of the VCALENDAR are read, not the ones of its alarms
+			if len(stack) == 2 && stack[0] == "VCALENDAR" && stack[1] == "VTODO" {
+				current, override = &Todo{}, false
+			}
+			continue
+		case "END":
+			if len(stack) == 0 || stack[len(stack)-1] != strings.ToUpper(p.value) {
+				return nil, fmt.Errorf("The calendar has an END:%s without its BEGIN", p.value)
+			}
+			if len(stack) == 2 && current != nil {
+				if todo == nil || !override {
+					todo = current
+				}
+				current = nil
+			}
+			stack = stack[:len(stack)-1]
+			continue
+		}
+		if current == nil || len(stack) != 2 {
+			continue
+		}
+
+		switch p.name {
+		case "UID":
+			current.UID = p.value
+		case "SUMMARY":
+			current.Summary = unescapeText(p.value)
+		case "DESCRIPTION":
+			current.Description = unescapeText(p.value)
+		case "STATUS":
+			current.Status = strings.ToUpper(p.value)
+		case "PRIORITY":
+			priority, err := strconv.Atoi(p.value)
+			if err != nil || priority < 0 || priority > 9 {
+				return nil, errors.New("The PRIORITY must be 0 to 9")
+			}
+			current.Priority = priority
+		case "DUE":
+			due, err := p.time(loc, true)
+			if err != nil {
+				return nil, err
+			}
+			current.Due = &due
+		case "COMPLETED":
+			completed, err := p.time(loc, false)
+			if err != nil {
+				return nil, err
+			}
+			current.Completed = &completed
+		case "RRULE":
+			current.RRule = p.value
+		case "CATEGORIES":
+			for _, c := range splitList(p.value) {
+				if c = strings.TrimSpace(unescapeText(c)); c != "" {
+					current.Categories = append(current.Categories, c)
+				}
+			}
+		case "RECURRENCE-ID":
+			override = true
+		}
+	}
+
+	if todo == nil {
+		return nil, ErrNoTodo
+	}
+	if todo.UID == "" {
+		return nil, errors.New("The VTODO has no UID")
+	}
+
+	return todo, nil
+}
+
+// property is a content line: NAME;PARAM=VALUE:value
+type property struct {
+	name   string
+	params map[string]string
+	value  string
+}
+
+func parseProperty(line string) (property, error) {
+	p := property{params: map[string]string{}}
+
+	// the value starts at the first colon which is not in a quoted parameter
+	quoted := false
+	colon := -1
+	for i, r := range line {
+		if r == '"' {
+			quoted = !quoted
+		}
+		if r == ':' && !quoted {
+			colon = i
+			break
+		}
+	}
+	if colon < 0 {
+		return p, fmt.Errorf("The line %q of the calendar has no value", truncate(line, 40))
+	}
+
+	p.value = line[colon+1:]
+	parts := splitParams(line[:colon])
+	p.name = strings.ToUpper(parts[0])
+	for _, param := range parts[1:] {
+		if i := strings.IndexByte(param, '='); i > 0 {
+			p.params[strings.ToUpper(param[:i])] = strings.Trim(param[i+1:], `"`)
+		}
+	}
+
+	return p, nil
+}
+
+// time reads a date or a date-time, a day is due at its last second when due is true and
+// starts at its first one otherwise
+func (p property) time(loc *time.Location, due bool) (time.Time, error) {
+	if tzid := p.params["TZID"]; tzid != "" {
+		if zone, err := time.LoadLocation(tzid); err == nil {
+			loc = zone
+		}
+	}
+
+	value := strings.TrimSpace(p.value)
+	switch {
+	case p.params["VALUE"] == "DATE" || len(value) == len(dateFormat):
+		day, err := time.ParseInLocation(dateFormat, value, loc)
+		if err != nil {
+			break
+		}
+		if due {
+			return day.AddDate(0, 0, 1).Add(-time.Second), nil
+		}
+		return day, nil
+	case strings.HasSuffix(value, "Z"):
+		if at, err := time.Parse(utcFormat, value); err == nil {
+			return at, nil
+		}
+	default:
+		if at, err := time.ParseInLocation(localFormat, value, loc); err == nil {
+			return at, nil
+		}
+	}
+
+	return time.Time{}, fmt.Errorf("The %s must be a date or a date-time", p.name)
+}
+
+// unfold joins the folded lines of the calendar, CRLF or LF followed by a space or a tab
+func unfold(data string) []string {
+	data = strings.ReplaceAll(data, "\r\n", "\n")
+	data = strings.ReplaceAll(data, "\n ", "")
+	data = strings.ReplaceAll(data, "\n\t", "")
+
+	return strings.Split(data, "\n")
+}
+
+// splitParams splits the name and the parameters of a property at the semicolons out of quotes
+func splitParams(s string) []string {
+	var parts []string
+	quoted := false
+	start := 0
+	for i, r := range s {
+		switch {
+		case r == '"':
+			quoted = !quoted
+		case r == ';' && !quoted:
+			parts = append(parts, s[start:i])
+			start = i + 1
+		}
+	}
+
+	return append(parts, s[start:])
+}
+
+// splitList splits a list of texts at the commas which are not escaped
+func splitList(s string) []string {
+	var items []string
+	var b strings.Builder
+	for i := 0; i < len(s); i++ {
+		switch {
+		case s[i] == '\\' && i+1 < len(s):
+			b.WriteByte(s[i])
+			b.WriteByte(s[i+1])
+			i++
+		case s[i] == ',':
+			items = append(items, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(s[i])
+		}
+	}
+
+	return append(items, b.String())
+}
+
+var (
+	textEscaper   = strings.NewReplacer(`\`, `\\`, ";", `\;`, ",", `\,`, "\r\n", `\n`, "\n", `\n`)
+	textUnescaper = strings.NewReplacer(`\\`, `\`, `\;`, ";", `\,`, ",", `\n`, "\n", `\N`, "\n")
+)
+
+// EscapeText escapes a text value of iCalendar
+func EscapeText(s string) string {
+	return textEscaper.Replace(s)
+}
+
+func unescapeText(s string) string {
+	return textUnescaper.Replace(s)
+}
+
+// FoldLine ends a content line with CRLF, folding it to lines of at most 75 octets
+// without splitting UTF-8 characters
+func FoldLine(s string) string {
+	var b strings.Builder
+	width := 0
+	for _, r := range s {
+		size := len(string(r))
+		if width+size > 75 {
+			b.WriteString("\r\n ")
+			width = 1
+		}
+		b.WriteRune(r)
+		width += size
+	}
+	b.WriteString("\r\n")
+
+	return b.String()
+}
+
+func truncate(s string, n int) string {
+	if len(s) <= n {
+		return s
+	}
+	return s[:n] + "..."
+}
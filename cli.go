@@ -0,0 +1,216 @@
+package main
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"net/url"
+	"os"
+	"sort"
+	"strconv"
+	"strings"
+	"task-app/client"
+	"task-app/models"
+	"task-app/util"
+	"text/tabwriter"
+	"time"
+)
+
+// loginCommand saves the URL of the server and an API key for the other client commands.
+// The key is checked against the server before it is saved.
+func loginCommand() *cobra.Command {
+	cfg := &client.Config{}
+	cmd := &cobra.Command{
+		Use:   "login",
+		Short: "Save the server and the API key the client commands use",
+		Long: "Save the server and the API key the client commands use. The key is created in the settings of the account, " +
+			"with the write scope to add tasks. It is read from the standard input when --key is not given.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if cfg.APIKey == "" {
+				fmt.Fprint(cmd.ErrOrStderr(), "API key: ")
+				line, err := bufio.NewReader(cmd.InOrStdin()).ReadString('\n')
+				if err != nil && line == "" {
+					return err
+				}
+				cfg.APIKey = strings.TrimSpace(line)
+			}
+
+			c, err := client.New(cfg)
+			if err != nil {
+				return err
+			}
+			u, err := c.Me()
+			if err != nil {
+				return err
+			}
+			if err := cfg.Save(); err != nil {
+				return err
+			}
+
+			path, _ := client.ConfigPath()
+			fmt.Fprintf(cmd.OutOrStdout(), "Logged in to %s as %s, the key is saved in %s\n", cfg.URL, u.Username, path)
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&cfg.URL, "url", "http://localhost:3000", "URL of the server")
+	cmd.Flags().StringVar(&cfg.APIKey, "key", os.Getenv("TASKER_API_KEY"), "API key, starting with "+util.APIKeyPrefix)
+
+	return cmd
+}
+
+// addCommand creates a task, its due date is read like the quick add in the zone of the computer
+func addCommand() *cobra.Command {
+	var due string
+	var projectID uint
+	input := models.TaskInput{}
+	cmd := &cobra.Command{
+		Use:   "add <title>",
+		Short: "Add a task",
+		Example: `  tasker add "Buy milk" --due tomorrow
+  tasker add Pay the rent --due "friday 9am" --priority 1`,
+		Args: cobra.MinimumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			input.Title = strings.Join(args, " ")
+			if due != "" {
+				parsed := util.ParseQuickAdd(due, time.Now())
+				if parsed.DueAt == nil || parsed.Title != "" {
+					return fmt.Errorf("cannot read the due date %q, e.g. tomorrow, friday 5pm, in 3 days or 2026-10-20", due)
+				}
+				input.DueAt, input.Recurrence = parsed.DueAt, parsed.Recurrence
+			}
+			if cmd.Flags().Changed("project") {
+				input.ProjectID = &projectID
+			}
+
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			task, err := c.CreateTask(input)
+			if err != nil {
+				return err
+			}
+
+			fmt.Fprintf(cmd.OutOrStdout(), "Added task %d: %s%s\n", task.ID, task.Title, dueSuffix(task))
+			return nil
+		},
+	}
+	cmd.Flags().StringVar(&due, "due", "", "due date, e.g. tomorrow, friday 5pm, in 3 days, 2026-10-20 or every monday")
+	cmd.Flags().IntVar(&input.Priority, "priority", 0, "priority from 1 (the highest) to 4")
+	cmd.Flags().UintVar(&projectID, "project", 0, "id of the project of the task")
+
+	return cmd
+}
+
+// listCommand prints the tasks as a table, or as the JSON of the API with --json
+func listCommand() *cobra.Command {
+	var status, due, labels, order string
+	var projectID uint
+	var asJSON bool
+	cmd := &cobra.Command{
+		Use:   "list",
+		Short: "List the tasks",
+		Example: `  tasker list --status todo
+  tasker list --due today --sort priority`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			query := url.Values{}
+			for k, v := range map[string]string{"status": status, "due": due, "labels": labels, "sort": order} {
+				if v != "" {
+					query.Set(k, v)
+				}
+			}
+			if cmd.Flags().Changed("project") {
+				query.Set("project", strconv.Itoa(int(projectID)))
+			}
+
+			c, err := newClient()
+			if err != nil {
+				return err
+			}
+			tasks, err := c.Tasks(query)
+			if err != nil {
+				return err
+			}
+
+			if asJSON {
+				enc := json.NewEncoder(cmd.OutOrStdout())
+				enc.SetIndent("", "  ")
+				if tasks == nil {
+					tasks = []models.TaskApi{}
+				}
+				return enc.Encode(tasks)
+			}
+			if len(tasks) == 0 {
+				fmt.Fprintln(cmd.OutOrStdout(), "No tasks")
+				return nil
+			}
+
+			w := tabwriter.NewWriter(cmd.OutOrStdout(), 0, 4, 2, ' ', 0)
+			fmt.Fprintln(w, "ID\tSTATUS\tPRIORITY\tDUE\tTITLE")
+			for _, t := range tasks {
+				dueAt := ""
+				if t.DueAt != nil {
+					dueAt = t.DueAt.Local().Format("Mon Jan 2 15:04")
+				}
+				fmt.Fprintf(w, "%d\t%s\tP%d\t%s\t%s\n", t.ID, taskStatus(t), t.Priority, dueAt, t.Title)
+			}
+			return w.Flush()
+		},
+	}
+	cmd.Flags().StringVar(&status, "status", "", "status of the tasks, e.g. todo or done")
+	cmd.Flags().StringVar(&due, "due", "", "overdue, today or week for the open tasks due by then, in the zone of the account")
+	cmd.Flags().StringVar(&labels, "labels", "", "comma separated labels, the tasks carrying any of them")
+	cmd.Flags().StringVar(&order, "sort", "", "position (the default), priority or due")
+	cmd.Flags().UintVar(&projectID, "project", 0, "id of the project of the tasks")
+	cmd.Flags().BoolVar(&asJSON, "json", false, "print the tasks as JSON")
+
+	return cmd
+}
+
+// printError prints the error of a command, with the errors of the fields of a response of the API
+func printError(cmd *cobra.Command, err error) {
+	cmd.PrintErrln("Error:", err)
+
+	var appErr *models.AppError
+	if errors.As(err, &appErr) {
+		fields := make([]string, 0, len(appErr.Fields))
+		for f := range appErr.Fields {
+			fields = append(fields, f)
+		}
+		sort.Strings(fields)
+		for _, f := range fields {
+			cmd.PrintErrf("  %s: %s\n", f, appErr.Fields[f])
+		}
+	}
+}
+
+// newClient returns the client of the saved config
+func newClient() (*client.Client, error) {
+	cfg, err := client.LoadConfig()
+	if err != nil {
+		return nil, err
+	}
+
+	return client.New(cfg)
+}
+
+// taskStatus is the status of the task, the tasks without a status are to do
+func taskStatus(t models.TaskApi) string {
+	if t.Status == "" {
+		return models.StatusTodo
+	}
+
+	return t.Status
+}
+
+func dueSuffix(t *models.TaskApi) string {
+	if t.DueAt == nil {
+		return ""
+	}
+
+	return ", due " + t.DueAt.Local().Format("Mon Jan 2 15:04")
+}
@@ -0,0 +1,173 @@
+// Package client talks to the REST API of a server with an API key, it is what the commands
+// of the CLI like tasker add and tasker list call. The URL of the server and the key are saved
+// by tasker login in the config directory of the user.
+package client
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+// ErrNoKey is returned when no API key was saved nor set by TASKER_API_KEY
+var ErrNoKey = errors.New("no API key, run tasker login first")
+
+var httpClient = &http.Client{Timeout: 30 * time.Second}
+
+// Config is what the client calls the server with
+type Config struct {
+	// URL is the address of the server, e.g. https://tasks.example.com
+	URL    string `json:"url"`
+	APIKey string `json:"apiKey"`
+}
+
+// ConfigPath is the file of the saved config, tasker/config.json in the config directory of the user
+func ConfigPath() (string, error) {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		return "", err
+	}
+
+	return filepath.Join(dir, "tasker", "config.json"), nil
+}
+
+// LoadConfig returns the saved config, TASKER_URL and TASKER_API_KEY override it
+func LoadConfig() (*Config, error) {
+	cfg := &Config{URL: "http://localhost:3000"}
+
+	path, err := ConfigPath()
+	if err != nil {
+		return nil, err
+	}
+	b, err := ioutil.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	if err == nil {
+		if err := json.Unmarshal(b, cfg); err != nil {
+			return nil, fmt.Errorf("client: %s: %w", path, err)
+		}
+	}
+
+	if v := os.Getenv("TASKER_URL"); v != "" {
+		cfg.URL = v
+	}
+	if v := os.Getenv("TASKER_API_KEY"); v != "" {
+		cfg.APIKey = v
+	}
+	if cfg.APIKey == "" {
+		return nil, ErrNoKey
+	}
+
+	return cfg, nil
+}
+
+// Save writes the config to ConfigPath, readable by the user only as it holds the key
+func (c *Config) Save() error {
+	path, err := ConfigPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+	b, err := json.MarshalIndent(c, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	return ioutil.WriteFile(path, append(b, '\n'), 0600)
+}
+
+// Client calls the API of the server of its config
+type Client struct {
+	base string
+	key  string
+}
+
+// New returns the client of the config, the key must be an API key
+func New(cfg *Config) (*Client, error) {
+	if !strings.HasPrefix(cfg.APIKey, util.APIKeyPrefix) {
+		return nil, fmt.Errorf("client: the API key must start with %s", util.APIKeyPrefix)
+	}
+	u, err := url.Parse(cfg.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return nil, fmt.Errorf("client: %q is not the http(s) URL of a server", cfg.URL)
+	}
+
+	return &Client{base: strings.TrimRight(cfg.URL, "/") + "/api/v1", key: cfg.APIKey}, nil
+}
+
+// Me returns the user of the key
+func (c *Client) Me() (*models.UserApi, error) {
+	u := new(models.UserApi)
+	return u, c.call(http.MethodGet, "/user/private/user", nil, u)
+}
+
+// CreateTask creates a task
+func (c *Client) CreateTask(input models.TaskInput) (*models.TaskApi, error) {
+	t := new(models.TaskApi)
+	return t, c.call(http.MethodPost, "/tasks", input, t)
+}
+
+// QuickAdd creates a task from a line of text, the server reads its due date, labels and priority
+func (c *Client) QuickAdd(input models.QuickAddInput) (*models.TaskApi, error) {
+	t := new(models.TaskApi)
+	return t, c.call(http.MethodPost, "/tasks/quickadd", input, t)
+}
+
+// Tasks lists the tasks, the query is the one of GET /tasks, e.g. status=todo
+func (c *Client) Tasks(query url.Values) ([]models.TaskApi, error) {
+	var tasks []models.TaskApi
+	return tasks, c.call(http.MethodGet, "/tasks?"+query.Encode(), nil, &tasks)
+}
+
+// call sends the request with the key, an error response is returned as its *models.AppError
+func (c *Client) call(method, path string, body, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequest(method, c.base+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/json")
+	req.Header.Set("User-Agent", "Tasker-CLI/1.0")
+	req.Header.Set("Authorization", "Bearer "+c.key)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := httpClient.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		appErr := &models.AppError{Status: res.StatusCode}
+		if err := json.NewDecoder(res.Body).Decode(appErr); err != nil || appErr.Message == "" {
+			appErr.Message = res.Status
+		}
+		return appErr
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
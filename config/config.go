@@ -0,0 +1,570 @@
+package config
+
+import (
+	"errors"
+	"flag"
+	"github.com/joho/godotenv"
+	"gopkg.in/yaml.v3"
+	"io/ioutil"
+	"os"
+	"strings"
+	"time"
+)
+
+// Config is the configuration of the app.
+// Every value has a default, overridden in order by the YAML file, the env and the flags.
+type Config struct {
+	Server     Server     `yaml:"server"`
+	Database   Database   `yaml:"database"`
+	Auth       Auth       `yaml:"auth"`
+	Accounts   Accounts   `yaml:"accounts"`
+	CORS       CORS       `yaml:"cors"`
+	Headers    Headers    `yaml:"headers"`
+	Mail       Mail       `yaml:"mail"`
+	Telegram   Telegram   `yaml:"telegram"`
+	Slack      Slack      `yaml:"slack"`
+	Push       Push       `yaml:"push"`
+	Encryption Encryption `yaml:"encryption"`
+	Inbox      Inbox      `yaml:"inbox"`
+	API        API        `yaml:"api"`
+	Cache      Cache      `yaml:"cache"`
+	Queue      Queue      `yaml:"queue"`
+	Jobs       Jobs       `yaml:"jobs"`
+	Web        Web        `yaml:"web"`
+	Plans      Plans      `yaml:"plans"`
+}
+
+type Server struct {
+	Addr string `yaml:"addr" env:"SERVER_ADDR"`
+	// GRPCAddr is the address of the gRPC services, they are off without one
+	GRPCAddr string `yaml:"grpcAddr" env:"GRPC_ADDR"`
+	// ShutdownTimeout is how long the shutdown waits for requests and background work
+	ShutdownTimeout time.Duration `yaml:"shutdownTimeout" env:"SHUTDOWN_TIMEOUT"`
+	// RequestTimeout bounds the queries of a request, it is answered 504 once over. The imports and
+	// the exports have more time.
+	RequestTimeout time.Duration `yaml:"requestTimeout" env:"REQUEST_TIMEOUT"`
+	// BodyLimit is the largest body in bytes of the requests but the uploads, which are limited by STORAGE_MAX_SIZE
+	BodyLimit int `yaml:"bodyLimit" env:"SERVER_BODY_LIMIT"`
+	// Compress compresses the JSON responses with brotli or gzip for the clients accepting them
+	Compress bool `yaml:"compress" env:"SERVER_COMPRESS"`
+}
+
+type Database struct {
+	// Driver is postgres, mysql or sqlite, the name of sqlite is the path of the database file
+	Driver string `yaml:"driver" env:"DB_DRIVER"`
+	Host   string `yaml:"host" env:"PSQL_HOST"`
+	// Port is the default port of the driver when 0
+	Port     int    `yaml:"port" env:"PSQL_PORT"`
+	User     string `yaml:"user" env:"PSQL_USER"`
+	Password string `yaml:"password" env:"PSQL_PASS"`
+	Name     string `yaml:"name" env:"PSQL_DBNAME"`
+	SSLMode  string `yaml:"sslMode" env:"PSQL_SSLMODE"`
+	TimeZone string `yaml:"timeZone" env:"PSQL_TIMEZONE"`
+	// MaxOpenConns limits the connections of the pool, 0 is unlimited
+	MaxOpenConns    int           `yaml:"maxOpenConns" env:"DB_MAX_OPEN_CONNS"`
+	MaxIdleConns    int           `yaml:"maxIdleConns" env:"DB_MAX_IDLE_CONNS"`
+	ConnMaxLifetime time.Duration `yaml:"connMaxLifetime" env:"DB_CONN_MAX_LIFETIME"`
+	// ConnectTimeout is how long the start waits for the database to be up
+	ConnectTimeout time.Duration `yaml:"connectTimeout" env:"DB_CONNECT_TIMEOUT"`
+	// MigrateOnStart applies the pending migrations when the server starts,
+	// otherwise they are applied with the migrate command
+	MigrateOnStart bool `yaml:"migrateOnStart" env:"MIGRATE_ON_START"`
+	// Replicas are the DSNs of the read replicas, in the format of the driver, e.g.
+	// host=replica1 user=tasker dbname=golangtask for postgres. The reads go to them and the
+	// writes to the primary.
+	Replicas []string `yaml:"replicas" env:"DB_REPLICAS"`
+	// ReplicaLag is how long the reads of a client stay on the primary after it wrote, so it
+	// reads its own writes while the replicas catch up
+	ReplicaLag time.Duration `yaml:"replicaLag" env:"DB_REPLICA_LAG"`
+}
+
+type Auth struct {
+	// Secret signs the tokens with HS256 and the local download URLs
+	Secret string `yaml:"secret" env:"PRIV_KEY"`
+	// PreviousSecrets still verify the tokens signed before the secret was rotated
+	PreviousSecrets []string `yaml:"previousSecrets" env:"PRIV_KEYS_PREVIOUS"`
+	// Algorithm signs the tokens, HS256 with the secret or RS256 with the RSA key.
+	// The public keys of RS256 are served at /.well-known/jwks.json.
+	Algorithm string `yaml:"algorithm" env:"JWT_ALGORITHM"`
+	// RSAKeyFile is the PEM file of the RSA private key of RS256
+	RSAKeyFile string `yaml:"rsaKeyFile" env:"JWT_RSA_KEY_FILE"`
+	// PreviousRSAKeyFiles are the PEM files of the RSA keys which still verify tokens, private or public
+	PreviousRSAKeyFiles []string `yaml:"previousRsaKeyFiles" env:"JWT_RSA_PREVIOUS_KEY_FILES"`
+
+	AccessTokenTTL  time.Duration `yaml:"accessTokenTTL" env:"ACCESS_TOKEN_TTL"`
+	RefreshTokenTTL time.Duration `yaml:"refreshTokenTTL" env:"REFRESH_TOKEN_TTL"`
+	ChallengeTTL    time.Duration `yaml:"challengeTTL" env:"CHALLENGE_TOKEN_TTL"`
+	// MagicLinkTTL is how long an emailed login link can be used, once
+	MagicLinkTTL     time.Duration `yaml:"magicLinkTTL" env:"MAGIC_LINK_TTL"`
+	AccessCookieTTL  time.Duration `yaml:"accessCookieTTL" env:"ACCESS_COOKIE_TTL"`
+	RefreshCookieTTL time.Duration `yaml:"refreshCookieTTL" env:"REFRESH_COOKIE_TTL"`
+	// ImpersonationTTL is the lifetime of the access token of an admin impersonating a user, it cannot be refreshed
+	ImpersonationTTL time.Duration `yaml:"impersonationTTL" env:"IMPERSONATION_TTL"`
+	// SecureCookies sets the Secure flag, turn it off only for plain HTTP development
+	SecureCookies bool `yaml:"secureCookies" env:"SECURE_COOKIES"`
+	// CookieSameSite is the SameSite of the session cookies: Lax, Strict, or None for the pages of
+	// another site, which needs SecureCookies. The state cookies of the logins by a provider stay
+	// Lax, the provider redirects back from its own site.
+	CookieSameSite string `yaml:"cookieSameSite" env:"COOKIE_SAMESITE"`
+	// CookieDomain shares the cookies with the subdomains, e.g. example.com for app.example.com and
+	// api.example.com. Without one they are sent to the host of the API only.
+	CookieDomain string `yaml:"cookieDomain" env:"COOKIE_DOMAIN"`
+}
+
+type Accounts struct {
+	// DeleteMode is anonymize (keep the tasks) or cascade (delete the personal tasks)
+	DeleteMode string `yaml:"deleteMode" env:"ACCOUNT_DELETE_MODE"`
+	// AdminEmails are the accounts promoted to admins on start
+	AdminEmails []string `yaml:"adminEmails" env:"ADMIN_EMAILS"`
+	// MaxFailedLogins in a row lock the account for the LockoutDuration, 0 disables the lockout
+	MaxFailedLogins int           `yaml:"maxFailedLogins" env:"MAX_FAILED_LOGINS"`
+	LockoutDuration time.Duration `yaml:"lockoutDuration" env:"LOCKOUT_DURATION"`
+	// Demo lets anyone create a demo account with sample data, removed with its data after the DemoTTL
+	Demo    bool          `yaml:"demo" env:"DEMO_ACCOUNTS"`
+	DemoTTL time.Duration `yaml:"demoTTL" env:"DEMO_TTL"`
+}
+
+// CORS lets the API be called from the pages of other origins, e.g. a SPA on its own domain
+type CORS struct {
+	// AllowOrigins are origins like https://app.example.com, or with a subdomain wildcard https://*.example.com.
+	// Each environment sets its own list, usually with CORS_ALLOW_ORIGINS; * allows any origin without credentials.
+	AllowOrigins []string `yaml:"allowOrigins" env:"CORS_ALLOW_ORIGINS"`
+	AllowMethods []string `yaml:"allowMethods" env:"CORS_ALLOW_METHODS"`
+	AllowHeaders []string `yaml:"allowHeaders" env:"CORS_ALLOW_HEADERS"`
+	// AllowCredentials lets the pages send the auth cookies
+	AllowCredentials bool `yaml:"allowCredentials" env:"CORS_ALLOW_CREDENTIALS"`
+	// MaxAge is how long the browsers cache a preflight response, 0 is not at all
+	MaxAge time.Duration `yaml:"maxAge" env:"CORS_MAX_AGE"`
+}
+
+// Headers are the security headers sent with every response
+type Headers struct {
+	// HSTSMaxAge is how long the browsers only reach the server by HTTPS after a response, 0 does
+	// not send Strict-Transport-Security. The browsers ignore it over plain HTTP.
+	HSTSMaxAge            time.Duration `yaml:"hstsMaxAge" env:"HSTS_MAX_AGE"`
+	HSTSIncludeSubdomains bool          `yaml:"hstsIncludeSubdomains" env:"HSTS_INCLUDE_SUBDOMAINS"`
+	// ContentSecurityPolicy is the policy of the app and the API, empty sends none. The page of the
+	// API docs has its own, allowing the assets of Swagger UI.
+	ContentSecurityPolicy string `yaml:"contentSecurityPolicy" env:"CONTENT_SECURITY_POLICY"`
+}
+
+// Mail sends the emails by SMTP, without a host only their recipients and subjects are written to the log
+type Mail struct {
+	Host     string `yaml:"host" env:"SMTP_HOST"`
+	Port     int    `yaml:"port" env:"SMTP_PORT"`
+	Username string `yaml:"username" env:"SMTP_USER"`
+	Password string `yaml:"password" env:"SMTP_PASS"`
+	// From is the sender of the emails, e.g. Tasker <tasker@example.com>
+	From string `yaml:"from" env:"MAIL_FROM"`
+	// BaseURL is the URL of the app the emails link to, the links to log in, verify an email
+	// or join a workspace included
+	BaseURL string `yaml:"baseURL" env:"MAIL_BASE_URL"`
+	// DigestHour is the hour of the day, in the zone of each user, the daily digest is sent at, -1 disables the digest
+	DigestHour int `yaml:"digestHour" env:"MAIL_DIGEST_HOUR"`
+}
+
+// Telegram runs the bot of the app, it is off without a token
+type Telegram struct {
+	// Token is the token of the bot given by @BotFather
+	Token string `yaml:"token" env:"TELEGRAM_BOT_TOKEN"`
+	// Mode is polling, the bot asks for the updates, or webhook, Telegram posts them to WebhookURL
+	Mode string `yaml:"mode" env:"TELEGRAM_MODE"`
+	// WebhookURL is the public URL of /telegram/webhook
+	WebhookURL string `yaml:"webhookURL" env:"TELEGRAM_WEBHOOK_URL"`
+	// WebhookSecret is sent by Telegram with every update posted to the webhook
+	WebhookSecret string `yaml:"webhookSecret" env:"TELEGRAM_WEBHOOK_SECRET"`
+}
+
+// Slack is the app of the Slack integration, it is off without a client id
+type Slack struct {
+	ClientID     string `yaml:"clientID" env:"SLACK_CLIENT_ID"`
+	ClientSecret string `yaml:"clientSecret" env:"SLACK_CLIENT_SECRET"`
+	// SigningSecret verifies the slash commands are sent by Slack
+	SigningSecret string `yaml:"signingSecret" env:"SLACK_SIGNING_SECRET"`
+}
+
+// Push sends the notifications to the devices of the mobile apps, by FCM to the Android ones and
+// by APNs to the iOS ones. Each service is off without its credentials.
+type Push struct {
+	// FCMCredentialsFile is the JSON key of a service account of the Firebase project of the app
+	FCMCredentialsFile string `yaml:"fcmCredentialsFile" env:"PUSH_FCM_CREDENTIALS_FILE"`
+	// APNsKeyFile is the .p8 key of the APNs auth key of the Apple developer team, with its id
+	APNsKeyFile string `yaml:"apnsKeyFile" env:"PUSH_APNS_KEY_FILE"`
+	APNsKeyID   string `yaml:"apnsKeyID" env:"PUSH_APNS_KEY_ID"`
+	APNsTeamID  string `yaml:"apnsTeamID" env:"PUSH_APNS_TEAM_ID"`
+	// APNsTopic is the bundle id of the iOS app
+	APNsTopic string `yaml:"apnsTopic" env:"PUSH_APNS_TOPIC"`
+}
+
+// Encryption encrypts the descriptions and the comments of the tasks in the database with AES-GCM.
+// They are encrypted by data keys kept in the database, themselves wrapped by the master key: a
+// local key or a key of AWS KMS. It is off without either. The rows and the cache entries
+// copying them are encrypted too, and the search matches the titles only.
+type Encryption struct {
+	// Key is a local master key of 32 bytes in base64, e.g. from openssl rand -base64 32
+	Key string `yaml:"key" env:"ENCRYPTION_KEY"`
+	// PreviousKeys still unwrap the data keys wrapped before the key was rotated, until
+	// tasker encryption rotate wraps them by the new key
+	PreviousKeys []string `yaml:"previousKeys" env:"ENCRYPTION_PREVIOUS_KEYS"`
+	// KMSKeyID is the id, ARN or alias of a key of AWS KMS, used instead of the local key
+	KMSKeyID  string `yaml:"kmsKeyID" env:"ENCRYPTION_KMS_KEY_ID"`
+	KMSRegion string `yaml:"kmsRegion" env:"AWS_REGION"`
+	// KMSEndpoint overrides the endpoint of the region, e.g. for a VPC endpoint or LocalStack
+	KMSEndpoint     string `yaml:"kmsEndpoint" env:"ENCRYPTION_KMS_ENDPOINT"`
+	AccessKeyID     string `yaml:"accessKeyID" env:"AWS_ACCESS_KEY_ID"`
+	SecretAccessKey string `yaml:"secretAccessKey" env:"AWS_SECRET_ACCESS_KEY"`
+	SessionToken    string `yaml:"sessionToken" env:"AWS_SESSION_TOKEN"`
+}
+
+// Inbox turns the emails sent to the inbound address of a user into tasks.
+// The emails are received by Mailgun, which posts them to /api/v1/inbox/mailgun.
+type Inbox struct {
+	// Domain is the domain of the inbound addresses, the inbox is off without one
+	Domain string `yaml:"domain" env:"INBOX_DOMAIN"`
+	// SigningKey verifies the emails are posted by Mailgun
+	SigningKey string `yaml:"signingKey" env:"MAILGUN_SIGNING_KEY"`
+}
+
+// API is the versioning of the REST API, served at /api/v1. The unversioned paths of /api
+// are still served as v1 until their sunset, answering with the Deprecation and Sunset headers.
+type API struct {
+	// LegacyDeprecatedAt is the day the unversioned paths were deprecated, as 2006-01-02
+	LegacyDeprecatedAt string `yaml:"legacyDeprecatedAt" env:"API_LEGACY_DEPRECATED_AT"`
+	// LegacySunset is the day the unversioned paths stop being served, as 2006-01-02.
+	// They answer 410 from then, they are served without end when it is empty.
+	LegacySunset string `yaml:"legacySunset" env:"API_LEGACY_SUNSET"`
+}
+
+// Cache keeps the results of the hot reads in Redis: the profile, the task lists and the
+// statistics. It is off without a URL.
+type Cache struct {
+	// RedisURL is a redis://[:password@]host[:port][/db] URL, it may be the server of the rate limits
+	RedisURL string `yaml:"redisURL" env:"CACHE_REDIS_URL"`
+	// TTL bounds how long an entry is served, the writes drop the entries they change before
+	TTL time.Duration `yaml:"ttl" env:"CACHE_TTL"`
+}
+
+// Queue runs the background jobs. The jobs are kept in the process without a URL, and lost
+// when it stops; with one they are kept in Redis and shared by the instances.
+type Queue struct {
+	// Workers is how many jobs run at once in the instance
+	Workers int `yaml:"workers" env:"QUEUE_WORKERS"`
+	// RedisURL is a redis://[:password@]host[:port][/db] URL, it may be the server of the cache
+	RedisURL string `yaml:"redisURL" env:"QUEUE_REDIS_URL"`
+}
+
+// Jobs are the periodic jobs of the instance: trash_purge, idempotency_purge, token_cleanup,
+// overdue_marking, due_reminders, daily_digest, export_purge and device_cleanup.
+type Jobs struct {
+	// Disabled are the names of the jobs the instance does not run, an admin may still run them
+	Disabled []string `yaml:"disabled" env:"JOBS_DISABLED"`
+	// Jitter is the most a run is delayed by, so the instances do not run a job at once
+	Jitter time.Duration `yaml:"jitter" env:"JOBS_JITTER"`
+}
+
+// Web serves a built single page app from /, next to the API. The app is embedded in the binary
+// from web/dist when it is built, or read from a directory.
+type Web struct {
+	Enabled bool `yaml:"enabled" env:"WEB_ENABLED"`
+	// Dir serves the app from the directory instead of the embedded one, e.g. while developing it
+	Dir string `yaml:"dir" env:"WEB_DIR"`
+}
+
+// Plans limit the tasks, the attachments and the members of the workspaces by the plan of each one
+type Plans struct {
+	// Default is the plan of the workspaces without one, none leaves them without limits
+	Default string `yaml:"default" env:"PLANS_DEFAULT"`
+	// Plans are ordered from the smallest, the quota errors hint the next plan with a higher limit
+	Plans []Plan `yaml:"plans"`
+	// UpgradeURL is the page the quota errors send the workspace owners to, to upgrade their plan
+	UpgradeURL string `yaml:"upgradeUrl" env:"PLANS_UPGRADE_URL"`
+}
+
+// Plan are the limits of a plan, a limit of 0 is no limit
+type Plan struct {
+	Name     string `yaml:"name"`
+	MaxTasks int64  `yaml:"maxTasks"`
+	// MaxStorage is the size in bytes of the attachments of the tasks of a workspace
+	MaxStorage int64 `yaml:"maxStorage"`
+	MaxMembers int64 `yaml:"maxMembers"`
+}
+
+// DateFormat is the format of the days of the config
+const DateFormat = "2006-01-02"
+
+// defaultPorts are the ports of the drivers when none is set
+var defaultPorts = map[string]int{
+	"postgres": 5432,
+	"mysql":    3306,
+}
+
+// Default returns the configuration used when nothing is set
+func Default() *Config {
+	return &Config{
+		Server: Server{
+			Addr:            ":3000",
+			ShutdownTimeout: 10 * time.Second,
+			RequestTimeout:  30 * time.Second,
+			BodyLimit:       1 << 20,
+			Compress:        true,
+		},
+		Database: Database{
+			Driver:          "postgres",
+			Host:            "localhost",
+			SSLMode:         "disable",
+			TimeZone:        "UTC",
+			MaxOpenConns:    25,
+			MaxIdleConns:    5,
+			ConnMaxLifetime: 30 * time.Minute,
+			ConnectTimeout:  30 * time.Second,
+			MigrateOnStart:  true,
+			ReplicaLag:      5 * time.Second,
+		},
+		Auth: Auth{
+			Algorithm:        "HS256",
+			AccessTokenTTL:   15 * time.Hour,
+			RefreshTokenTTL:  30 * 24 * time.Hour,
+			ChallengeTTL:     5 * time.Minute,
+			MagicLinkTTL:     15 * time.Minute,
+			AccessCookieTTL:  24 * time.Hour,
+			RefreshCookieTTL: 10 * 24 * time.Hour,
+			ImpersonationTTL: 30 * time.Minute,
+			SecureCookies:    true,
+			CookieSameSite:   "Lax",
+		},
+		Accounts: Accounts{
+			DeleteMode:      "anonymize",
+			MaxFailedLogins: 5,
+			LockoutDuration: 15 * time.Minute,
+			DemoTTL:         24 * time.Hour,
+		},
+		CORS: CORS{
+			AllowOrigins: []string{"*"},
+			AllowMethods: []string{"GET", "POST", "HEAD", "PUT", "DELETE", "PATCH"},
+			AllowHeaders: []string{"Origin", "Content-Type", "Accept", "Authorization", "X-CSRF-Token", "If-Match", "If-None-Match", "Idempotency-Key"},
+			MaxAge:       10 * time.Minute,
+		},
+		Headers: Headers{
+			HSTSMaxAge:            180 * 24 * time.Hour,
+			ContentSecurityPolicy: "default-src 'self'; img-src 'self' data: https:; object-src 'none'; base-uri 'self'; frame-ancestors 'none'",
+		},
+		Mail: Mail{
+			Port:       587,
+			From:       "Tasker <tasker@localhost>",
+			BaseURL:    "http://localhost:3000",
+			DigestHour: 8,
+		},
+		Telegram: Telegram{
+			Mode: "polling",
+		},
+		API: API{
+			LegacyDeprecatedAt: "2026-10-14",
+			LegacySunset:       "2027-04-14",
+		},
+		Cache: Cache{
+			TTL: 5 * time.Minute,
+		},
+		Queue: Queue{
+			Workers: 4,
+		},
+		Jobs: Jobs{
+			Jitter: time.Minute,
+		},
+		Plans: Plans{
+			Plans: []Plan{
+				{Name: "free", MaxTasks: 1000, MaxStorage: 100 << 20, MaxMembers: 5},
+				{Name: "team", MaxTasks: 50000, MaxStorage: 10 << 30, MaxMembers: 50},
+				{Name: "enterprise"},
+			},
+		},
+	}
+}
+
+// Load reads the configuration from the args (usually os.Args[1:]).
+// The YAML file is given by -config or CONFIG_FILE, a .env file in the working directory is loaded into the env first.
+func Load(args []string) (*Config, error) {
+	// the .env file is optional, the env may be set by the environment itself
+	if err := godotenv.Load(); err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+
+	cfg := Default()
+
+	fs := flag.NewFlagSet("task-app", flag.ContinueOnError)
+	file := fs.String("config", os.Getenv("CONFIG_FILE"), "path of the YAML configuration file")
+	addr := fs.String("addr", "", "address the server listens on")
+	if err := fs.Parse(args); err != nil {
+		return nil, err
+	}
+
+	if *file != "" {
+		b, err := ioutil.ReadFile(*file)
+		if err != nil {
+			return nil, err
+		}
+		if err := yaml.Unmarshal(b, cfg); err != nil {
+			return nil, errors.New("config: " + *file + ": " + err.Error())
+		}
+	}
+
+	if err := loadEnv(cfg); err != nil {
+		return nil, err
+	}
+
+	if *addr != "" {
+		cfg.Server.Addr = *addr
+	}
+
+	if cfg.Database.Port == 0 {
+		cfg.Database.Port = defaultPorts[cfg.Database.Driver]
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, err
+	}
+
+	return cfg, nil
+}
+
+// Validate checks the values are usable, reporting every invalid one
+func (c *Config) Validate() error {
+	var problems []string
+	check := func(ok bool, problem string) {
+		if !ok {
+			problems = append(problems, problem)
+		}
+	}
+
+	check(c.Server.Addr != "", "server.addr is required")
+	check(c.Server.ShutdownTimeout > 0, "server.shutdownTimeout must be positive")
+	check(c.Server.RequestTimeout > 0, "server.requestTimeout (REQUEST_TIMEOUT) must be positive")
+	check(c.Server.BodyLimit > 0, "server.bodyLimit (SERVER_BODY_LIMIT) must be positive")
+
+	check(oneOf(c.Database.Driver, "postgres", "mysql", "sqlite"), "database.driver must be postgres, mysql or sqlite")
+	check(c.Database.Name != "", "database.name (PSQL_DBNAME) is required")
+	if c.Database.Driver != "sqlite" {
+		check(c.Database.Host != "", "database.host is required")
+		check(c.Database.Port > 0 && c.Database.Port < 1<<16, "database.port must be a valid port")
+		check(c.Database.User != "", "database.user (PSQL_USER) is required")
+	}
+	if c.Database.Driver == "postgres" {
+		check(oneOf(c.Database.SSLMode, "disable", "allow", "prefer", "require", "verify-ca", "verify-full"), "database.sslMode is not a libpq sslmode")
+	}
+	_, err := time.LoadLocation(c.Database.TimeZone)
+	check(err == nil, "database.timeZone is not a known time zone")
+	check(c.Database.MaxOpenConns >= 0, "database.maxOpenConns cannot be negative")
+	check(c.Database.MaxIdleConns >= 0, "database.maxIdleConns cannot be negative")
+	check(c.Database.MaxOpenConns == 0 || c.Database.MaxIdleConns <= c.Database.MaxOpenConns, "database.maxIdleConns cannot be above maxOpenConns")
+	check(c.Database.ConnMaxLifetime >= 0, "database.connMaxLifetime cannot be negative")
+	check(c.Database.ConnectTimeout >= 0, "database.connectTimeout cannot be negative")
+	check(len(c.Database.Replicas) == 0 || c.Database.ReplicaLag > 0, "database.replicaLag (DB_REPLICA_LAG) must be positive with replicas")
+
+	check(c.Auth.Secret != "", "auth.secret (PRIV_KEY) is required")
+	check(oneOf(c.Auth.Algorithm, "HS256", "RS256"), "auth.algorithm must be HS256 or RS256")
+	check(c.Auth.Algorithm != "RS256" || c.Auth.RSAKeyFile != "", "auth.rsaKeyFile (JWT_RSA_KEY_FILE) is required with RS256")
+	check(c.Auth.AccessTokenTTL > 0, "auth.accessTokenTTL must be positive")
+	check(c.Auth.RefreshTokenTTL > 0, "auth.refreshTokenTTL must be positive")
+	check(c.Auth.ChallengeTTL > 0, "auth.challengeTTL must be positive")
+	check(c.Auth.MagicLinkTTL > 0, "auth.magicLinkTTL must be positive")
+	check(c.Auth.AccessCookieTTL > 0, "auth.accessCookieTTL must be positive")
+	check(c.Auth.RefreshCookieTTL > 0, "auth.refreshCookieTTL must be positive")
+	check(c.Auth.ImpersonationTTL > 0, "auth.impersonationTTL must be positive")
+	check(oneOf(c.Auth.CookieSameSite, "Lax", "Strict", "None"), "auth.cookieSameSite (COOKIE_SAMESITE) must be Lax, Strict or None")
+	check(c.Auth.CookieSameSite != "None" || c.Auth.SecureCookies, "auth.cookieSameSite (COOKIE_SAMESITE) cannot be None without secureCookies (SECURE_COOKIES), the browsers drop the cookies")
+	check(!strings.ContainsAny(c.Auth.CookieDomain, ":/ "), "auth.cookieDomain (COOKIE_DOMAIN) must be a domain like example.com, without a scheme or a port")
+
+	check(oneOf(c.Accounts.DeleteMode, "anonymize", "cascade"), "accounts.deleteMode must be anonymize or cascade")
+	check(c.Accounts.MaxFailedLogins >= 0, "accounts.maxFailedLogins cannot be negative")
+	check(c.Accounts.MaxFailedLogins == 0 || c.Accounts.LockoutDuration > 0, "accounts.lockoutDuration must be positive")
+	check(!c.Accounts.Demo || c.Accounts.DemoTTL > 0, "accounts.demoTTL must be positive")
+
+	check(len(c.CORS.AllowOrigins) > 0, "cors.allowOrigins is required, * allows any origin")
+	for _, origin := range c.CORS.AllowOrigins {
+		check(origin == "*" || strings.HasPrefix(origin, "http://") || strings.HasPrefix(origin, "https://"), "cors.allowOrigins: "+origin+" is not an origin like https://example.com")
+		check(origin != "*" || !c.CORS.AllowCredentials, "cors.allowOrigins cannot be * with allowCredentials")
+	}
+	check(len(c.CORS.AllowMethods) > 0, "cors.allowMethods is required")
+	check(c.CORS.MaxAge >= 0, "cors.maxAge cannot be negative")
+
+	check(c.Headers.HSTSMaxAge >= 0, "headers.hstsMaxAge (HSTS_MAX_AGE) cannot be negative")
+
+	check(c.Mail.Host == "" || c.Mail.Port > 0 && c.Mail.Port < 1<<16, "mail.port must be a valid port")
+	check(c.Mail.From != "", "mail.from is required")
+	check(strings.HasPrefix(c.Mail.BaseURL, "http://") || strings.HasPrefix(c.Mail.BaseURL, "https://"), "mail.baseURL must be a URL like https://tasker.example.com")
+	check(c.Mail.DigestHour >= -1 && c.Mail.DigestHour < 24, "mail.digestHour must be an hour from 0 to 23, or -1")
+
+	check(oneOf(c.Telegram.Mode, "polling", "webhook"), "telegram.mode must be polling or webhook")
+	check(c.Inbox.Domain == "" || c.Inbox.SigningKey != "", "inbox.signingKey (MAILGUN_SIGNING_KEY) is required with a domain")
+
+	if c.Slack.ClientID != "" {
+		check(c.Slack.ClientSecret != "", "slack.clientSecret (SLACK_CLIENT_SECRET) is required with a client id")
+		check(c.Slack.SigningSecret != "", "slack.signingSecret (SLACK_SIGNING_SECRET) is required with a client id")
+	}
+
+	if c.Push.APNsKeyFile != "" {
+		check(c.Push.APNsKeyID != "", "push.apnsKeyID (PUSH_APNS_KEY_ID) is required with a key file")
+		check(c.Push.APNsTeamID != "", "push.apnsTeamID (PUSH_APNS_TEAM_ID) is required with a key file")
+		check(c.Push.APNsTopic != "", "push.apnsTopic (PUSH_APNS_TOPIC) is required with a key file")
+	}
+
+	check(c.Encryption.Key == "" || c.Encryption.KMSKeyID == "", "encryption.key (ENCRYPTION_KEY) and encryption.kmsKeyID (ENCRYPTION_KMS_KEY_ID) cannot be both set")
+	if c.Encryption.KMSKeyID != "" {
+		check(c.Encryption.KMSRegion != "", "encryption.kmsRegion (AWS_REGION) is required with a KMS key")
+		check(c.Encryption.AccessKeyID != "" && c.Encryption.SecretAccessKey != "",
+			"encryption.accessKeyID (AWS_ACCESS_KEY_ID) and encryption.secretAccessKey (AWS_SECRET_ACCESS_KEY) are required with a KMS key")
+	}
+
+	if c.Telegram.Token != "" && c.Telegram.Mode == "webhook" {
+		check(strings.HasPrefix(c.Telegram.WebhookURL, "https://"), "telegram.webhookURL (TELEGRAM_WEBHOOK_URL) must be an https URL in webhook mode")
+		check(c.Telegram.WebhookSecret != "", "telegram.webhookSecret (TELEGRAM_WEBHOOK_SECRET) is required in webhook mode")
+	}
+
+	deprecatedAt, err := time.Parse(DateFormat, c.API.LegacyDeprecatedAt)
+	check(err == nil, "api.legacyDeprecatedAt must be a day like 2006-01-02")
+	if c.API.LegacySunset != "" {
+		sunset, err := time.Parse(DateFormat, c.API.LegacySunset)
+		check(err == nil, "api.legacySunset must be a day like 2006-01-02, or empty")
+		check(err != nil || sunset.After(deprecatedAt), "api.legacySunset must be after api.legacyDeprecatedAt")
+	}
+
+	if c.Cache.RedisURL != "" {
+		check(strings.HasPrefix(c.Cache.RedisURL, "redis://"), "cache.redisURL (CACHE_REDIS_URL) must be a URL like redis://localhost:6379/0")
+		check(c.Cache.TTL > 0, "cache.ttl must be positive")
+	}
+
+	plans := map[string]bool{}
+	for _, p := range c.Plans.Plans {
+		check(p.Name != "" && !plans[p.Name], "plans.plans: the names must be unique and not empty")
+		check(p.MaxTasks >= 0 && p.MaxStorage >= 0 && p.MaxMembers >= 0, "plans.plans: "+p.Name+" cannot have a negative limit")
+		plans[p.Name] = true
+	}
+	check(c.Plans.Default == "" || plans[c.Plans.Default], "plans.default (PLANS_DEFAULT) must be one of plans.plans")
+
+	check(c.Queue.Workers > 0, "queue.workers (QUEUE_WORKERS) must be positive")
+	if c.Queue.RedisURL != "" {
+		check(strings.HasPrefix(c.Queue.RedisURL, "redis://"), "queue.redisURL (QUEUE_REDIS_URL) must be a URL like redis://localhost:6379/0")
+	}
+
+	check(c.Jobs.Jitter >= 0, "jobs.jitter (JOBS_JITTER) must not be negative")
+
+	if c.Web.Dir != "" {
+		info, err := os.Stat(c.Web.Dir)
+		check(err == nil && info.IsDir(), "web.dir (WEB_DIR) must be a directory")
+	}
+
+	if len(problems) > 0 {
+		return errors.New("config: " + strings.Join(problems, "; "))
+	}
+
+	return nil
+}
+
+func oneOf(value string, allowed ...string) bool {
+	for _, a := range allowed {
+		if value == a {
+			return true
+		}
+	}
+
+	return false
+}
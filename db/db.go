@@ -0,0 +1,102 @@
+package db
+
+import (
+	"github.com/uptrace/opentelemetry-go-extra/otelgorm"
+	"gorm.io/gorm"
+	"gorm.io/gorm/logger"
+	"task-app/config"
+	"task-app/logging"
+	"task-app/metrics"
+	"task-app/models"
+	"time"
+)
+
+var DB *gorm.DB
+
+// slowQueryThreshold is the duration above which a query is logged as a warning
+const slowQueryThreshold = 200 * time.Millisecond
+
+// the waits between the attempts to connect on start
+const (
+	firstRetryWait = 500 * time.Millisecond
+	maxRetryWait   = 5 * time.Second
+)
+
+// ConnectToDB opens the connection pool of the database configured.
+// A database which is not up yet is retried with backoff for the connect timeout.
+func ConnectToDB(cfg *config.Config) error {
+	d := cfg.Database
+	dialect, err := dialector(d)
+	if err != nil {
+		return err
+	}
+
+	logging.Log.Info().Str("driver", d.Driver).Msg("Connecting to DB...")
+	DB, err = openWithRetry(dialect, d.ConnectTimeout)
+	if err != nil {
+		return err
+	}
+	logging.Log.Info().Msg("connected")
+
+	sqlDB, err := DB.DB()
+	if err != nil {
+		return err
+	}
+	sqlDB.SetMaxOpenConns(d.MaxOpenConns)
+	sqlDB.SetMaxIdleConns(d.MaxIdleConns)
+	sqlDB.SetConnMaxLifetime(d.ConnMaxLifetime)
+
+	if err := metrics.InstrumentDB(DB); err != nil {
+		logging.Log.Error().Err(err).Msg("Cannot instrument the database")
+	}
+	if err := DB.Use(otelgorm.NewPlugin()); err != nil {
+		logging.Log.Error().Err(err).Msg("Cannot trace the database")
+	}
+
+	return nil
+}
+
+// openWithRetry opens the database, which GORM pings, until it answers or the timeout is over.
+// The wait doubles between the attempts, up to maxRetryWait.
+func openWithRetry(dialect gorm.Dialector, timeout time.Duration) (*gorm.DB, error) {
+	deadline := time.Now().Add(timeout)
+	wait := firstRetryWait
+
+	for {
+		// the failed attempts are logged below, not by GORM
+		conn, err := gorm.Open(dialect, &gorm.Config{Logger: logger.Discard})
+		if err == nil {
+			conn.Logger = logging.NewGormLogger(slowQueryThreshold)
+			return conn, nil
+		}
+
+		if time.Now().Add(wait).After(deadline) {
+			return nil, err
+		}
+		logging.Log.Warn().Err(err).Dur("retry_in", wait).Msg("Database is not available")
+		time.Sleep(wait)
+
+		if wait *= 2; wait > maxRetryWait {
+			wait = maxRetryWait
+		}
+	}
+}
+
+// PromoteAdmins gives the admin role to the accounts of the emails
+func PromoteAdmins(emails []string) error {
+	if len(emails) == 0 {
+		return nil
+	}
+
+	return DB.Model(&models.User{}).Where("email IN ?", emails).Update("role", models.RoleAdmin).Error
+}
+
+// Ping checks the database answers
+func Ping() error {
+	return Default.Ping()
+}
+
+// Close closes the connection pool
+func Close() error {
+	return Default.Close()
+}
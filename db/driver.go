@@ -0,0 +1,117 @@
+package db
+
+import (
+	"errors"
+	"fmt"
+	mysqlerr "github.com/go-sql-driver/mysql"
+	"github.com/jackc/pgconn"
+	"github.com/mattn/go-sqlite3"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"net/url"
+	"strings"
+	"task-app/config"
+)
+
+// The database drivers, selected by DB_DRIVER
+const (
+	Postgres = "postgres"
+	MySQL    = "mysql"
+	SQLite   = "sqlite"
+)
+
+// dialector returns the GORM dialector of the driver configured
+func dialector(d config.Database) (gorm.Dialector, error) {
+	switch d.Driver {
+	case Postgres:
+		return postgres.Open(fmt.Sprintf("host=%s user=%s password=%s dbname=%s port=%d sslmode=%s TimeZone=%s",
+			dsnValue(d.Host), dsnValue(d.User), dsnValue(d.Password), dsnValue(d.Name), d.Port, d.SSLMode, d.TimeZone)), nil
+	case MySQL:
+		return mysql.Open(fmt.Sprintf("%s:%s@tcp(%s:%d)/%s?charset=utf8mb4&parseTime=True&loc=%s",
+			d.User, d.Password, d.Host, d.Port, d.Name, url.QueryEscape(d.TimeZone))), nil
+	case SQLite:
+		// the name is the path of the database file, foreign keys are off by default in SQLite
+		return sqlite.Open(d.Name + "?_foreign_keys=on"), nil
+	}
+
+	return nil, errors.New("unknown database driver " + d.Driver)
+}
+
+// dsnValue quotes a value of a libpq connection string, so an empty or spaced one is kept as it is
+func dsnValue(s string) string {
+	return "'" + strings.NewReplacer(`\`, `\\`, `'`, `\'`).Replace(s) + "'"
+}
+
+// Dialect returns the name of the driver in use
+func Dialect() string {
+	return DB.Dialector.Name()
+}
+
+// IsUniqueViolation checks if the error is a unique constraint violation of any driver
+func IsUniqueViolation(err error) bool {
+	var pgErr *pgconn.PgError
+	if errors.As(err, &pgErr) {
+		return pgErr.Code == "23505"
+	}
+
+	var mysqlErr *mysqlerr.MySQLError
+	if errors.As(err, &mysqlErr) {
+		return mysqlErr.Number == 1062
+	}
+
+	var sqliteErr sqlite3.Error
+	if errors.As(err, &sqliteErr) {
+		return sqliteErr.ExtendedCode == sqlite3.ErrConstraintUnique
+	}
+
+	return false
+}
+
+// StringAgg returns an SQL expression joining the values of a column by commas, in order
+func StringAgg(column string) string {
+	switch Dialect() {
+	case MySQL:
+		return "GROUP_CONCAT(" + column + " ORDER BY " + column + " SEPARATOR ',')"
+	case SQLite:
+		// SQLite has no ordered aggregate, the rows are aggregated in the order they are read
+		return "group_concat(" + column + ", ',')"
+	}
+
+	return "string_agg(" + column + ", ',' ORDER BY " + column + ")"
+}
+
+// DateOf returns an SQL expression of the date of a timestamp column at an offset from UTC
+// in seconds, formatted as YYYY-MM-DD
+func DateOf(column string, offset int) string {
+	switch Dialect() {
+	case MySQL:
+		if offset != 0 {
+			column = fmt.Sprintf("DATE_ADD(%s, INTERVAL %d SECOND)", column, offset)
+		}
+		return "DATE_FORMAT(" + column + ", '%Y-%m-%d')"
+	case SQLite:
+		if offset != 0 {
+			return fmt.Sprintf("date(%s, '%+d seconds')", column, offset)
+		}
+		return "date(" + column + ")"
+	}
+
+	if offset != 0 {
+		return fmt.Sprintf("to_char((%s AT TIME ZONE 'UTC') + interval '%d seconds', 'YYYY-MM-DD')", column, offset)
+	}
+	return "to_char(" + column + " AT TIME ZONE 'UTC', 'YYYY-MM-DD')"
+}
+
+// SecondsBetween returns an SQL expression of the seconds from a timestamp column to another
+func SecondsBetween(from, to string) string {
+	switch Dialect() {
+	case MySQL:
+		return "TIMESTAMPDIFF(SECOND, " + from + ", " + to + ")"
+	case SQLite:
+		return "((julianday(" + to + ") - julianday(" + from + ")) * 86400)"
+	}
+
+	return "EXTRACT(EPOCH FROM (" + to + " - " + from + "))"
+}
@@ -0,0 +1,574 @@
+package db
+
+import (
+	"github.com/go-gormigrate/gormigrate/v2"
+	"gorm.io/gorm"
+	"task-app/models"
+)
+
+const migrationsTable = "migrations"
+
+// migrations are applied in order and recorded by id in the migrations table.
+// A migration must never change once released, add a new one instead.
+// Migrations which create tables or columns use AutoMigrate on the models they touch,
+// as it is a no-op for a database which has them already.
+var migrations = []*gormigrate.Migration{
+	{
+		ID: "202610140001_initial",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(initialModels()...); err != nil {
+				return err
+			}
+			return setupSearch(tx)
+		},
+		Rollback: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			// join tables first, they reference the others
+			for _, table := range []string{"task_labels", "task_watchers", "comment_mentions"} {
+				if err := m.DropTable(table); err != nil {
+					return err
+				}
+			}
+
+			models := initialModels()
+			for i := len(models) - 1; i >= 0; i-- {
+				if err := m.DropTable(models[i]); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "202610140002_session_devices",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Claims{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range []string{"UserAgent", "IP", "CreatedAt", "LastUsedAt"} {
+				if err := m.DropColumn(&models.Claims{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "202610140003_login_lockout",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.User{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range []string{"LockedUntil", "FailedLogins"} {
+				if err := m.DropColumn(&models.User{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "202610140004_task_priority_position",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.Task{}); err != nil {
+				return err
+			}
+			// the existing tasks keep the order of their creation
+			return tx.Exec("UPDATE tasks SET position = id WHERE position = 0").Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range []string{"Priority", "Position"} {
+				if err := m.DropColumn(&models.Task{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "202610140005_task_templates",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.ChecklistItem{}, &models.Template{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.Template{}, &models.ChecklistItem{})
+		},
+	},
+	{
+		ID: "202610140006_task_dependencies",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.TaskDependency{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.TaskDependency{})
+		},
+	},
+	{
+		ID: "202610140007_time_entries",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.TimeEntry{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.TimeEntry{})
+		},
+	},
+	{
+		ID: "202610140008_task_completed_at",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.Task{}); err != nil {
+				return err
+			}
+			// the last update of the done tasks is the best guess of their completion
+			return tx.Exec("UPDATE tasks SET completed_at = updated_at WHERE status = ? AND completed_at IS NULL", models.StatusDone).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Task{}, "CompletedAt")
+		},
+	},
+	{
+		ID: "202610140009_notifications",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Notification{}, &models.NotificationPreference{}, &models.Task{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&models.Task{}, "RemindedFor"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&models.NotificationPreference{}, &models.Notification{})
+		},
+	},
+	{
+		ID: "202610140010_email_digest",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.User{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "DigestSentAt")
+		},
+	},
+	{
+		ID: "202610140011_telegram_accounts",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.TelegramAccount{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.TelegramAccount{})
+		},
+	},
+	{
+		ID: "202610140012_slack_installations",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.SlackInstallation{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.SlackInstallation{})
+		},
+	},
+	{
+		ID: "202610140013_user_inbox",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.User{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "InboxToken")
+		},
+	},
+	{
+		// the keyset indexes of the cursor pages
+		ID: "202610140014_cursor_indexes",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.Exec("CREATE INDEX idx_tasks_created_at_id ON tasks (created_at, id)").Error; err != nil {
+				return err
+			}
+			return tx.Exec("CREATE INDEX idx_notifications_user_created_at_id ON notifications (user_id, created_at, id)").Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropIndex(&models.Notification{}, "idx_notifications_user_created_at_id"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropIndex(&models.Task{}, "idx_tasks_created_at_id")
+		},
+	},
+	{
+		// the existing tasks start at version 1
+		ID: "202610140015_task_versions",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Task{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Task{}, "Version")
+		},
+	},
+	{
+		ID: "202610140016_idempotency_keys",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.IdempotencyKey{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.IdempotencyKey{})
+		},
+	},
+	{
+		ID: "202610140017_failed_jobs",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.FailedJob{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.FailedJob{})
+		},
+	},
+	{
+		ID: "202610140018_task_overdue",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Task{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Task{}, "OverdueFor")
+		},
+	},
+	{
+		// the sessions are found by the hash of their token, the existing ones by their registered claims,
+		// so the column is filled before its unique index is created
+		ID: "202610140019_session_token_hash",
+		Migrate: func(tx *gorm.DB) error {
+			if !tx.Migrator().HasColumn(&models.Claims{}, "TokenHash") {
+				if err := tx.Migrator().AddColumn(&models.Claims{}, "TokenHash"); err != nil {
+					return err
+				}
+			}
+
+			var sessions []models.Claims
+			if err := tx.Select("id", "issuer", "issued_at", "expires_at").FindInBatches(&sessions, 500, func(*gorm.DB, int) error {
+				for _, s := range sessions {
+					if err := tx.Model(&s).UpdateColumn("token_hash", s.Fingerprint()).Error; err != nil {
+						return err
+					}
+				}
+				return nil
+			}).Error; err != nil {
+				return err
+			}
+
+			return tx.AutoMigrate(&models.Claims{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			// without the columns a revoked session would be valid again
+			if err := tx.Where("revoked_at IS NOT NULL").Delete(&models.Claims{}).Error; err != nil {
+				return err
+			}
+
+			m := tx.Migrator()
+			for _, index := range []string{"TokenHash", "Issuer", "ExpiresAt"} {
+				if err := m.DropIndex(&models.Claims{}, index); err != nil {
+					return err
+				}
+			}
+			for _, column := range []string{"TokenHash", "RevokedAt", "RevokedReason"} {
+				if err := m.DropColumn(&models.Claims{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "202610140020_data_exports",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.DataExport{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.DataExport{})
+		},
+	},
+	{
+		ID: "202610140021_user_time_zones",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.User{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			for _, column := range []string{"TimeZone", "Locale"} {
+				if err := m.DropColumn(&models.User{}, column); err != nil {
+					return err
+				}
+			}
+			return nil
+		},
+	},
+	{
+		ID: "202610140022_user_avatars",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.User{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "AvatarKey")
+		},
+	},
+	{
+		ID: "202610140023_shares",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Share{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.Share{})
+		},
+	},
+	{
+		ID: "202610140024_demo_accounts",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.User{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "DemoExpiresAt")
+		},
+	},
+	{
+		ID: "202610140025_impersonations",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Impersonation{}, &models.Activity{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&models.Activity{}, "ImpersonatorID"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&models.Impersonation{})
+		},
+	},
+	{
+		ID: "202610140026_archived",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Task{}, &models.Project{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			m := tx.Migrator()
+			if err := m.DropColumn(&models.Task{}, "ArchivedAt"); err != nil {
+				return err
+			}
+			return m.DropColumn(&models.Project{}, "ArchivedAt")
+		},
+	},
+	{
+		ID: "202610140027_task_revisions",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.TaskRevision{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.TaskRevision{})
+		},
+	},
+	{
+		ID: "202610140028_filters",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Filter{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.Filter{})
+		},
+	},
+	{
+		ID: "202610140029_workspace_plans",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.Workspace{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.Workspace{}, "Plan")
+		},
+	},
+	{
+		ID: "202610140030_calendar_objects",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.CalendarObject{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.CalendarObject{})
+		},
+	},
+	{
+		ID: "202610140031_github_integrations",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.GitHubIntegration{}, &models.GitHubIssue{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.GitHubIssue{}, &models.GitHubIntegration{})
+		},
+	},
+	{
+		ID: "202610140032_push_devices",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.PushDevice{}, &models.NotificationPreference{}); err != nil {
+				return err
+			}
+			// the preferences saved before push have its default
+			return tx.Model(&models.NotificationPreference{}).
+				Where("kind IN ?", []string{models.NotifyMentioned, models.NotifyDue}).
+				Update("push", true).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			if err := tx.Migrator().DropColumn(&models.NotificationPreference{}, "Push"); err != nil {
+				return err
+			}
+			return tx.Migrator().DropTable(&models.PushDevice{})
+		},
+	},
+	{
+		ID: "202610140033_magic_links",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.MagicLink{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.MagicLink{})
+		},
+	},
+	{
+		ID: "202610140034_workspace_sso",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.WorkspaceSSO{}, &models.SSOIdentity{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.WorkspaceSSO{}, &models.SSOIdentity{})
+		},
+	},
+	{
+		ID: "202610140035_encryption_keys",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.EncryptionKey{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.EncryptionKey{})
+		},
+	},
+	{
+		// the emails of the accounts before it are not verified, the account of a provider with the
+		// same verified email is not linked to them until they are
+		ID: "202610140036_email_verified_at",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.User{}, "EmailVerifiedAt") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.User{}, "EmailVerifiedAt")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "EmailVerifiedAt")
+		},
+	},
+	{
+		ID: "202610140037_totp_last_step",
+		Migrate: func(tx *gorm.DB) error {
+			if tx.Migrator().HasColumn(&models.User{}, "TOTPLastStep") {
+				return nil
+			}
+			return tx.Migrator().AddColumn(&models.User{}, "TOTPLastStep")
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.User{}, "TOTPLastStep")
+		},
+	},
+	{
+		ID: "202610140038_stream_tickets",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.AutoMigrate(&models.StreamTicket{})
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropTable(&models.StreamTicket{})
+		},
+	},
+	{
+		// the signups stored their tokens and cookies, they are forgotten rather than replayed
+		ID: "202610140039_idempotency_sessions",
+		Migrate: func(tx *gorm.DB) error {
+			if err := tx.AutoMigrate(&models.IdempotencyKey{}); err != nil {
+				return err
+			}
+			return tx.Where("header LIKE ?", "%Set-Cookie%").Delete(&models.IdempotencyKey{}).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			return tx.Migrator().DropColumn(&models.IdempotencyKey{}, "SessionUserID")
+		},
+	},
+	{
+		// the keys of the signups stored a plain hash of their body with the password, the
+		// requests are now hashed with the secret
+		ID: "202610140040_idempotency_request_hmac",
+		Migrate: func(tx *gorm.DB) error {
+			return tx.Where("scope = ?", "").Delete(&models.IdempotencyKey{}).Error
+		},
+		Rollback: func(tx *gorm.DB) error {
+			// the deleted keys only lose their replays
+			return nil
+		},
+	},
+}
+
+func initialModels() []interface{} {
+	return []interface{}{
+		&models.User{}, &models.Claims{}, &models.Category{}, &models.Workspace{}, &models.Membership{},
+		&models.Invite{}, &models.Project{}, &models.Task{}, &models.Label{}, &models.Comment{},
+		&models.Attachment{}, &models.OAuthAccount{}, &models.BackupCode{}, &models.APIKey{},
+		&models.Activity{}, &models.Webhook{}, &models.WebhookDelivery{},
+	}
+}
+
+func migrator() *gormigrate.Gormigrate {
+	options := *gormigrate.DefaultOptions
+	options.TableName = migrationsTable
+	options.UseTransaction = true
+
+	return gormigrate.New(DB, &options, migrations)
+}
+
+// MigrateUp applies the pending migrations
+func MigrateUp() error {
+	return migrator().Migrate()
+}
+
+// MigrateDown rolls back the last applied migration
+func MigrateDown() error {
+	return migrator().RollbackLast()
+}
+
+// MigrationStatus is a migration and whether it is applied
+type MigrationStatus struct {
+	ID      string
+	Applied bool
+}
+
+// Migrations returns every migration with its status, in order
+func Migrations() ([]MigrationStatus, error) {
+	applied := map[string]bool{}
+	if DB.Migrator().HasTable(migrationsTable) {
+		var ids []string
+		if err := DB.Table(migrationsTable).Pluck("id", &ids).Error; err != nil {
+			return nil, err
+		}
+		for _, id := range ids {
+			applied[id] = true
+		}
+	}
+
+	status := make([]MigrationStatus, 0, len(migrations))
+	for _, m := range migrations {
+		status = append(status, MigrationStatus{ID: m.ID, Applied: applied[m.ID]})
+	}
+
+	return status, nil
+}
+
+// PendingMigrations returns the ids of the migrations which are not applied yet
+func PendingMigrations() ([]string, error) {
+	status, err := Migrations()
+	if err != nil {
+		return nil, err
+	}
+
+	var pending []string
+	for _, m := range status {
+		if !m.Applied {
+			pending = append(pending, m.ID)
+		}
+	}
+
+	return pending, nil
+}
@@ -1,45 +0,0 @@
-package db
-
-import (
-	"fmt"
-	"github.com/joho/godotenv"
-	"gorm.io/driver/postgres"
-	"gorm.io/gorm"
-	"gorm.io/gorm/logger"
-	"log"
-	"os"
-	"task-app/models"
-)
-
-var DB *gorm.DB
-
-var PRIVKEY string
-
-func ConnectToDB() {
-	err := godotenv.Load()
-	if err != nil {
-		log.Fatal("Error loading env file \n", err)
-	}
-
-	PRIVKEY = os.Getenv("PRIV_KEY")
-
-	dsn := fmt.Sprintf("host=localhost user=%s password=%s dbname=%s port=%s sslmode=disable TimeZone=Asia/Kolkata",
-		os.Getenv("PSQL_USER"), os.Getenv("PSQL_PASS"), os.Getenv("PSQL_DBNAME"), os.Getenv("PSQL_PORT"))
-
-	log.Print("Connecting to PostgreSQL DB...")
-	DB, err = gorm.Open(postgres.Open(dsn), &gorm.Config{
-		Logger: logger.Default.LogMode(logger.Info),
-	})
-
-	if err != nil {
-		log.Fatal("Failed to connect to database. \n", err)
-		os.Exit(2)
-	}
-	log.Println("connected")
-
-	// turned on the loger on info mode
-	DB.Logger = logger.Default.LogMode(logger.Info)
-
-	log.Print("Running the migrations...")
-	DB.AutoMigrate(&models.User{}, &models.Claims{}, &models.Task{}, &models.Category{})
-}
@@ -0,0 +1,120 @@
+package db
+
+import (
+	"context"
+	"database/sql"
+	"errors"
+	"gorm.io/driver/mysql"
+	"gorm.io/driver/postgres"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	"gorm.io/plugin/dbresolver"
+	"task-app/config"
+	"task-app/models"
+)
+
+// primaryTables are always read on the primary: the sessions, keys and tokens, whose revocation
+// must be seen at once, and the rows a job reads right after they are queued
+var primaryTables = []interface{}{
+	migrationsTable,
+	&models.Claims{}, &models.Impersonation{}, &models.APIKey{}, &models.MagicLink{}, &models.StreamTicket{},
+	&models.IdempotencyKey{}, &models.EncryptionKey{}, &models.DataExport{},
+}
+
+type primaryKey struct{}
+
+// UseReplicas sends the reads of DB to the replicas of the config, picked at random, and keeps the
+// writes, the transactions and the reads of primaryTables on the primary. It does nothing without
+// replicas. It is called once the migrations are applied, which only run on the primary.
+func UseReplicas(d config.Database) error {
+	if len(d.Replicas) == 0 {
+		return nil
+	}
+
+	replicas := make([]gorm.Dialector, 0, len(d.Replicas))
+	for _, dsn := range d.Replicas {
+		dialect, err := replicaDialector(d.Driver, dsn)
+		if err != nil {
+			return err
+		}
+		replicas = append(replicas, replica{Dialector: dialect, config: d, primary: DB.ConnPool})
+	}
+
+	return DB.Use(dbresolver.Register(dbresolver.Config{Replicas: replicas}).
+		Register(dbresolver.Config{}, primaryTables...))
+}
+
+// replica opens the pool of a replica with the limits of the primary. Its queries run with a
+// context of ReadPrimary are sent to the primary, as the resolver picks the pool before.
+type replica struct {
+	gorm.Dialector
+	config  config.Database
+	primary gorm.ConnPool
+}
+
+func (r replica) Initialize(db *gorm.DB) error {
+	if err := r.Dialector.Initialize(db); err != nil {
+		return err
+	}
+	if sqlDB, ok := db.ConnPool.(*sql.DB); ok {
+		sqlDB.SetMaxOpenConns(r.config.MaxOpenConns)
+		sqlDB.SetMaxIdleConns(r.config.MaxIdleConns)
+		sqlDB.SetConnMaxLifetime(r.config.ConnMaxLifetime)
+	}
+	db.ConnPool = replicaPool{replica: db.ConnPool, primary: r.primary}
+
+	return nil
+}
+
+type replicaPool struct {
+	replica, primary gorm.ConnPool
+}
+
+func (p replicaPool) pool(ctx context.Context) gorm.ConnPool {
+	if ctx != nil && ctx.Value(primaryKey{}) != nil {
+		return p.primary
+	}
+
+	return p.replica
+}
+
+func (p replicaPool) PrepareContext(ctx context.Context, query string) (*sql.Stmt, error) {
+	return p.pool(ctx).PrepareContext(ctx, query)
+}
+
+func (p replicaPool) ExecContext(ctx context.Context, query string, args ...interface{}) (sql.Result, error) {
+	return p.pool(ctx).ExecContext(ctx, query, args...)
+}
+
+func (p replicaPool) QueryContext(ctx context.Context, query string, args ...interface{}) (*sql.Rows, error) {
+	return p.pool(ctx).QueryContext(ctx, query, args...)
+}
+
+func (p replicaPool) QueryRowContext(ctx context.Context, query string, args ...interface{}) *sql.Row {
+	return p.pool(ctx).QueryRowContext(ctx, query, args...)
+}
+
+// replicaDialector returns the dialector of a replica, its DSN is in the format of the driver
+func replicaDialector(driver, dsn string) (gorm.Dialector, error) {
+	switch driver {
+	case Postgres:
+		return postgres.Open(dsn), nil
+	case MySQL:
+		return mysql.Open(dsn), nil
+	case SQLite:
+		return sqlite.Open(dsn), nil
+	}
+
+	return nil, errors.New("unknown database driver " + driver)
+}
+
+// Primary reads the query on the primary, for a read which must see the writes made just before
+func Primary(tx *gorm.DB) *gorm.DB {
+	return tx.Clauses(dbresolver.Write)
+}
+
+// ReadPrimary returns the context reading every query run with it on the primary, e.g. the
+// requests of a client which just wrote
+func ReadPrimary(ctx context.Context) context.Context {
+	return context.WithValue(ctx, primaryKey{}, true)
+}
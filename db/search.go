@@ -0,0 +1,36 @@
+package db
+
+import "gorm.io/gorm"
+
+// SearchConfig is the text search configuration of the search vectors.
+// "simple" does no stemming, so it works the same for every language.
+const SearchConfig = "simple"
+
+// setupSearch adds the generated tsvector columns searched by /search and their GIN indexes.
+// The columns are kept up to date by PostgreSQL itself (it needs PostgreSQL 12+),
+// the other drivers have no such columns and are searched with LIKE.
+func setupSearch(tx *gorm.DB) error {
+	if tx.Dialector.Name() != Postgres {
+		return nil
+	}
+
+	statements := []string{
+		`ALTER TABLE tasks ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			setweight(to_tsvector('` + SearchConfig + `', coalesce(title, '')), 'A') ||
+			setweight(to_tsvector('` + SearchConfig + `', coalesce(description, '')), 'B')
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_tasks_search_vector ON tasks USING GIN (search_vector)`,
+		`ALTER TABLE comments ADD COLUMN IF NOT EXISTS search_vector tsvector GENERATED ALWAYS AS (
+			to_tsvector('` + SearchConfig + `', coalesce(body, ''))
+		) STORED`,
+		`CREATE INDEX IF NOT EXISTS idx_comments_search_vector ON comments USING GIN (search_vector)`,
+	}
+
+	for _, stmt := range statements {
+		if err := tx.Exec(stmt).Error; err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,95 @@
+package db
+
+import (
+	"context"
+	"gorm.io/gorm"
+)
+
+// Store is the database the handlers work with.
+// Tests can give the handlers a store of their own, e.g. a SQLite file.
+type Store interface {
+	DB() *gorm.DB
+	// WithTx runs fn in a transaction, committed when fn returns nil and rolled back otherwise
+	WithTx(ctx context.Context, fn func(tx *gorm.DB) error) error
+	Ping() error
+	Close() error
+}
+
+// gormStore is a store on a GORM connection
+type gormStore struct {
+	conn *gorm.DB
+}
+
+func NewStore(conn *gorm.DB) Store {
+	return gormStore{conn: conn}
+}
+
+func (s gormStore) DB() *gorm.DB {
+	return s.conn
+}
+
+func (s gormStore) WithTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return s.conn.WithContext(ctx).Transaction(fn)
+}
+
+// Ping checks the database answers
+func (s gormStore) Ping() error {
+	sqlDB, err := s.conn.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Ping()
+}
+
+// Close closes the connection pool
+func (s gormStore) Close() error {
+	sqlDB, err := s.conn.DB()
+	if err != nil {
+		return err
+	}
+
+	return sqlDB.Close()
+}
+
+// contextStore is a store whose queries run with a context, e.g. the one of a request
+type contextStore struct {
+	Store
+	ctx context.Context
+}
+
+// WithContext returns the store running its queries with the context, they stop when it is done
+func WithContext(store Store, ctx context.Context) Store {
+	return contextStore{Store: store, ctx: ctx}
+}
+
+func (s contextStore) DB() *gorm.DB {
+	return s.Store.DB().WithContext(s.ctx)
+}
+
+// globalStore is the store on DB, read on every call as DB is set by ConnectToDB
+type globalStore struct{}
+
+func (globalStore) DB() *gorm.DB {
+	return DB
+}
+
+func (globalStore) WithTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return NewStore(DB).WithTx(ctx, fn)
+}
+
+func (globalStore) Ping() error {
+	return NewStore(DB).Ping()
+}
+
+func (globalStore) Close() error {
+	return NewStore(DB).Close()
+}
+
+// Default is the store of the global DB, for the code not given a store
+var Default Store = globalStore{}
+
+// WithTx runs fn in a transaction of the global DB, committed when fn returns nil and rolled back otherwise
+func WithTx(ctx context.Context, fn func(tx *gorm.DB) error) error {
+	return Default.WithTx(ctx, fn)
+}
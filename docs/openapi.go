@@ -0,0 +1,264 @@
+// Package docs builds the OpenAPI 3 document of the REST API. The operations are
+// described next to the routes, the schemas of their bodies are read from the Go types.
+package docs
+
+import (
+	"encoding/json"
+	"net/http"
+	"reflect"
+	"regexp"
+	"strings"
+	"task-app/models"
+	"task-app/util"
+)
+
+// Operation describes a route of the API
+type Operation struct {
+	Summary     string
+	Description string
+	Query       []Param
+	// Header are the request headers read by the operation, e.g. If-Match
+	Header []Param
+	// Body is a value of the type of the JSON body
+	Body interface{}
+	// Form are the fields of a multipart form body
+	Form []Param
+	// Response is a value of the type of the JSON response, the operations
+	// without response nor ContentType answer 204
+	Response interface{}
+	// ContentType is the type of a response which is not JSON, e.g. text/calendar
+	ContentType string
+	// Redirect is set for the operations answering a 302 to another site
+	Redirect bool
+	// Public operations need no access token
+	Public bool
+}
+
+// Param is a query parameter or a form field
+type Param struct {
+	Name        string
+	Description string
+	Required    bool
+	// Type is string when it is empty, e.g. integer, or file for an uploaded file
+	Type string
+}
+
+// Query returns an optional string query parameter
+func Query(name, description string) Param {
+	return Param{Name: name, Description: description}
+}
+
+// Header returns an optional header parameter
+func Header(name, description string) Param {
+	return Param{Name: name, Description: description}
+}
+
+// File returns a required file field of a form
+func File(name, description string) Param {
+	return Param{Name: name, Description: description, Required: true, Type: "file"}
+}
+
+// Spec is the OpenAPI document of the operations added to it
+type Spec struct {
+	title   string
+	version string
+	server  string
+	paths   map[string]map[string]*operation
+	schemas map[string]*Schema
+}
+
+// New returns an empty document of the API served at the base path, e.g. /api/v1
+func New(title, version, basePath string) *Spec {
+	s := &Spec{
+		title:   title,
+		version: version,
+		server:  basePath,
+		paths:   map[string]map[string]*operation{},
+		schemas: map[string]*Schema{},
+	}
+	s.schemaOf(reflect.TypeOf(models.AppError{}))
+
+	return s
+}
+
+type operation struct {
+	Tags        []string              `json:"tags"`
+	Summary     string                `json:"summary"`
+	Description string                `json:"description,omitempty"`
+	Parameters  []parameter           `json:"parameters,omitempty"`
+	RequestBody *requestBody          `json:"requestBody,omitempty"`
+	Responses   map[string]response   `json:"responses"`
+	Security    []map[string][]string `json:"security"`
+}
+
+type parameter struct {
+	Name        string  `json:"name"`
+	In          string  `json:"in"`
+	Description string  `json:"description,omitempty"`
+	Required    bool    `json:"required"`
+	Schema      *Schema `json:"schema"`
+}
+
+type requestBody struct {
+	Required bool                 `json:"required"`
+	Content  map[string]mediaType `json:"content"`
+}
+
+type response struct {
+	Description string               `json:"description"`
+	Content     map[string]mediaType `json:"content,omitempty"`
+}
+
+type mediaType struct {
+	Schema *Schema `json:"schema"`
+}
+
+// pathParam matches the parameters of the fiber paths, e.g. :id
+var pathParam = regexp.MustCompile(`:(\w+)`)
+
+// authenticated accepts an access token or an API key in the Authorization header,
+// or the session cookie
+var authenticated = []map[string][]string{{"bearerAuth": {}}, {"cookieAuth": {}}}
+
+// Add adds the operation of a route, the path is relative to the base path and
+// has the parameters of fiber
+func (s *Spec) Add(method, path string, op Operation) {
+	path = strings.TrimRight(path, "/")
+	if path == "" {
+		path = "/"
+	}
+	tag := strings.SplitN(strings.TrimPrefix(path, "/"), "/", 2)[0]
+
+	o := &operation{
+		Tags:        []string{tag},
+		Summary:     op.Summary,
+		Description: op.Description,
+		Responses:   map[string]response{},
+		Security:    authenticated,
+	}
+	if op.Public {
+		o.Security = []map[string][]string{}
+	}
+
+	for _, m := range pathParam.FindAllStringSubmatch(path, -1) {
+		o.Parameters = append(o.Parameters, parameter{Name: m[1], In: "path", Required: true, Schema: paramSchema(m[1])})
+	}
+	for _, p := range op.Query {
+		o.Parameters = append(o.Parameters, parameter{
+			Name:        p.Name,
+			In:          "query",
+			Description: p.Description,
+			Required:    p.Required,
+			Schema:      &Schema{Type: paramType(p)},
+		})
+	}
+	for _, p := range op.Header {
+		o.Parameters = append(o.Parameters, parameter{
+			Name:        p.Name,
+			In:          "header",
+			Description: p.Description,
+			Required:    p.Required,
+			Schema:      &Schema{Type: paramType(p)},
+		})
+		if p.Name == "If-None-Match" {
+			o.Responses["304"] = response{Description: "The version of the If-None-Match did not change"}
+		}
+	}
+
+	switch {
+	case op.Body != nil:
+		o.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{
+			"application/json": {Schema: s.schemaOf(reflect.TypeOf(op.Body))},
+		}}
+	case len(op.Form) > 0:
+		o.RequestBody = &requestBody{Required: true, Content: map[string]mediaType{
+			"multipart/form-data": {Schema: formSchema(op.Form)},
+		}}
+	}
+
+	switch {
+	case op.Redirect:
+		o.Responses["302"] = response{Description: "Redirects to the Location"}
+	case op.ContentType != "":
+		o.Responses["200"] = response{Description: http.StatusText(http.StatusOK), Content: map[string]mediaType{
+			op.ContentType: {Schema: &Schema{Type: "string", Format: "binary"}},
+		}}
+	case op.Response != nil:
+		o.Responses["200"] = response{Description: http.StatusText(http.StatusOK), Content: map[string]mediaType{
+			"application/json": {Schema: s.schemaOf(reflect.TypeOf(op.Response))},
+		}}
+	default:
+		o.Responses["204"] = response{Description: http.StatusText(http.StatusNoContent)}
+	}
+	o.Responses["default"] = response{
+		Description: "An error, as {code, message, fields}",
+		Content: map[string]mediaType{
+			"application/json": {Schema: &Schema{Ref: "#/components/schemas/AppError"}},
+		},
+	}
+
+	spec := pathParam.ReplaceAllString(path, "{$1}")
+	if s.paths[spec] == nil {
+		s.paths[spec] = map[string]*operation{}
+	}
+	s.paths[spec][strings.ToLower(method)] = o
+}
+
+// MarshalJSON encodes the OpenAPI document
+func (s *Spec) MarshalJSON() ([]byte, error) {
+	return json.Marshal(map[string]interface{}{
+		"openapi": "3.0.3",
+		"info":    map[string]string{"title": s.title, "version": s.version},
+		"servers": []map[string]string{{"url": s.server}},
+		"paths":   s.paths,
+		"components": map[string]interface{}{
+			"schemas": s.schemas,
+			"securitySchemes": map[string]interface{}{
+				"bearerAuth": map[string]string{
+					"type":        "http",
+					"scheme":      "bearer",
+					"description": "An access token, or an API key starting with " + util.APIKeyPrefix,
+				},
+				"cookieAuth": map[string]string{
+					"type":        "apiKey",
+					"in":          "cookie",
+					"name":        "access_token",
+					"description": "The session cookie, the changes also need the " + util.CSRFHeader + " header",
+				},
+			},
+		},
+	})
+}
+
+// paramSchema returns the schema of a path parameter, the ids are integers
+func paramSchema(name string) *Schema {
+	if name == "id" || strings.HasSuffix(name, "Id") {
+		return &Schema{Type: "integer", Format: "int64"}
+	}
+
+	return &Schema{Type: "string"}
+}
+
+func paramType(p Param) string {
+	if p.Type == "" {
+		return "string"
+	}
+
+	return p.Type
+}
+
+func formSchema(fields []Param) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for _, f := range fields {
+		property := &Schema{Type: "string", Description: f.Description}
+		if f.Type == "file" {
+			property.Format = "binary"
+		}
+		schema.Properties[f.Name] = property
+		if f.Required {
+			schema.Required = append(schema.Required, f.Name)
+		}
+	}
+
+	return schema
+}
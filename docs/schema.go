@@ -0,0 +1,191 @@
+package docs
+
+import (
+	"encoding/json"
+	"gorm.io/gorm"
+	"reflect"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Schema is a JSON schema of the OpenAPI document
+type Schema struct {
+	Ref                  string             `json:"$ref,omitempty"`
+	Type                 string             `json:"type,omitempty"`
+	Format               string             `json:"format,omitempty"`
+	Description          string             `json:"description,omitempty"`
+	Nullable             bool               `json:"nullable,omitempty"`
+	Enum                 []string           `json:"enum,omitempty"`
+	MaxLength            *int               `json:"maxLength,omitempty"`
+	Minimum              *float64           `json:"minimum,omitempty"`
+	Maximum              *float64           `json:"maximum,omitempty"`
+	Items                *Schema            `json:"items,omitempty"`
+	Properties           map[string]*Schema `json:"properties,omitempty"`
+	AdditionalProperties *Schema            `json:"additionalProperties,omitempty"`
+	Required             []string           `json:"required,omitempty"`
+}
+
+var (
+	timeType    = reflect.TypeOf(time.Time{})
+	deletedType = reflect.TypeOf(gorm.DeletedAt{})
+	rawType     = reflect.TypeOf(json.RawMessage{})
+)
+
+// schemaOf returns the schema of a type. The named structs are added once to the
+// components, the schema refers to them.
+func (s *Spec) schemaOf(t reflect.Type) *Schema {
+	switch {
+	case t == timeType:
+		return &Schema{Type: "string", Format: "date-time"}
+	case t == deletedType:
+		return &Schema{Type: "string", Format: "date-time", Nullable: true}
+	case t == rawType:
+		return &Schema{}
+	}
+
+	switch t.Kind() {
+	case reflect.Ptr:
+		schema := s.schemaOf(t.Elem())
+		if schema.Ref != "" {
+			// a $ref cannot have siblings in OpenAPI 3.0
+			return schema
+		}
+		schema.Nullable = true
+		return schema
+	case reflect.Bool:
+		return &Schema{Type: "boolean"}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return &Schema{Type: "integer", Format: integerFormat(t)}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		zero := 0.0
+		return &Schema{Type: "integer", Format: integerFormat(t), Minimum: &zero}
+	case reflect.Float32, reflect.Float64:
+		return &Schema{Type: "number"}
+	case reflect.String:
+		return &Schema{Type: "string"}
+	case reflect.Slice, reflect.Array:
+		return &Schema{Type: "array", Items: s.schemaOf(t.Elem())}
+	case reflect.Map:
+		return &Schema{Type: "object", AdditionalProperties: s.schemaOf(t.Elem())}
+	case reflect.Struct:
+		if t.Name() == "" {
+			return s.structSchema(t)
+		}
+		if _, ok := s.schemas[t.Name()]; !ok {
+			// the entry is set before the fields for the recursive types
+			s.schemas[t.Name()] = &Schema{}
+			*s.schemas[t.Name()] = *s.structSchema(t)
+		}
+		return &Schema{Ref: "#/components/schemas/" + t.Name()}
+	}
+
+	// interfaces can be any value
+	return &Schema{}
+}
+
+// structSchema returns the object of the fields of a struct, by their json names.
+// The embedded structs are flattened as encoding/json does.
+func (s *Spec) structSchema(t reflect.Type) *Schema {
+	schema := &Schema{Type: "object", Properties: map[string]*Schema{}}
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		name, ok := jsonName(f)
+		if !ok {
+			continue
+		}
+
+		if f.Anonymous && name == "" {
+			embedded := f.Type
+			if embedded.Kind() == reflect.Ptr {
+				embedded = embedded.Elem()
+			}
+			if embedded.Kind() == reflect.Struct {
+				inner := s.structSchema(embedded)
+				for n, p := range inner.Properties {
+					schema.Properties[n] = p
+				}
+				schema.Required = append(schema.Required, inner.Required...)
+				continue
+			}
+		}
+		if name == "" {
+			name = f.Name
+		}
+
+		property := s.schemaOf(f.Type)
+		if constrain(property, f.Tag.Get("validate")) {
+			schema.Required = append(schema.Required, name)
+		}
+		schema.Properties[name] = property
+	}
+
+	return schema
+}
+
+// jsonName returns the name of a field in the json tag, ok is false for the unexported
+// and skipped fields
+func jsonName(f reflect.StructField) (name string, ok bool) {
+	if f.PkgPath != "" && !f.Anonymous {
+		return "", false
+	}
+
+	tag := f.Tag.Get("json")
+	if tag == "-" {
+		return "", false
+	}
+
+	return strings.Split(tag, ",")[0], true
+}
+
+// constrain adds the rules of a validate tag the schema can express and tells
+// whether the field is required
+func constrain(schema *Schema, tag string) (required bool) {
+	if schema.Ref != "" || tag == "" {
+		return false
+	}
+
+	for _, rule := range strings.Split(tag, ",") {
+		name, param := rule, ""
+		if i := strings.Index(rule, "="); i >= 0 {
+			name, param = rule[:i], rule[i+1:]
+		}
+
+		switch name {
+		case "required", "notblank":
+			required = true
+		case "email":
+			schema.Format = "email"
+		case "url":
+			schema.Format = "uri"
+		case "oneof":
+			schema.Enum = strings.Fields(param)
+		case "min", "max":
+			n, err := strconv.ParseFloat(param, 64)
+			if err != nil {
+				continue
+			}
+			switch {
+			case schema.Type == "string" && name == "max":
+				length := int(n)
+				schema.MaxLength = &length
+			case schema.Type == "integer" || schema.Type == "number":
+				if name == "min" {
+					schema.Minimum = &n
+				} else {
+					schema.Maximum = &n
+				}
+			}
+		}
+	}
+
+	return required
+}
+
+func integerFormat(t reflect.Type) string {
+	if t.Bits() == 64 || t.Kind() == reflect.Int || t.Kind() == reflect.Uint {
+		return "int64"
+	}
+
+	return "int32"
+}
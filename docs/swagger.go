@@ -0,0 +1,50 @@
+package docs
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"html/template"
+)
+
+// swaggerUI is the page of Swagger UI, its assets are loaded from unpkg
+var swaggerUI = template.Must(template.New("swagger").Parse(`<!DOCTYPE html>
+<html lang="en">
+<head>
+  <meta charset="utf-8">
+  <title>{{.Title}}</title>
+  <link rel="stylesheet" href="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui.css">
+</head>
+<body>
+  <div id="swagger-ui"></div>
+  <script src="https://unpkg.com/swagger-ui-dist@5.17.14/swagger-ui-bundle.js" crossorigin></script>
+  <script>
+    window.ui = SwaggerUIBundle({url: {{.URL}}, dom_id: "#swagger-ui", withCredentials: true});
+  </script>
+</body>
+</html>
+`))
+
+// SwaggerUI returns the page of Swagger UI browsing the document at the URL, with its
+// Content-Security-Policy: the assets of unpkg and the inline script, allowed by its hash
+func (s *Spec) SwaggerUI(url string) ([]byte, string, error) {
+	var b bytes.Buffer
+	if err := swaggerUI.Execute(&b, struct{ Title, URL string }{s.title, url}); err != nil {
+		return nil, "", err
+	}
+
+	page := b.Bytes()
+	start := bytes.LastIndex(page, []byte("<script>"))
+	end := bytes.LastIndex(page, []byte("</script>"))
+	if start < 0 || end < start {
+		return nil, "", errors.New("docs: the page of Swagger UI has no inline script")
+	}
+	sum := sha256.Sum256(page[start+len("<script>") : end])
+	policy := "default-src 'self'; " +
+		"script-src https://unpkg.com 'sha256-" + base64.StdEncoding.EncodeToString(sum[:]) + "'; " +
+		"style-src https://unpkg.com 'unsafe-inline'; img-src 'self' data:; object-src 'none'; " +
+		"base-uri 'self'; frame-ancestors 'none'"
+
+	return page, policy, nil
+}
@@ -0,0 +1,64 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"github.com/spf13/cobra"
+	"task-app/config"
+	"task-app/db"
+	"task-app/encryption"
+)
+
+// encryptionCommand is the encryption command: rotate wraps the data keys by the current master
+// key, adds a new data key and re-encrypts the content by it
+func encryptionCommand() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "encryption",
+		Short: "Manage the encryption of the tasks at rest",
+	}
+	cmd.PersistentFlags().StringVar(&file, "config", "", "path of the YAML configuration file")
+
+	var batch int
+	rotate := &cobra.Command{
+		Use:   "rotate",
+		Short: "Rotate the keys and re-encrypt the descriptions and comments",
+		Long: "Rotate wraps the data keys by the current master key, so the previous keys can be removed " +
+			"from the configuration once it is done, then adds a new data key and re-encrypts the descriptions " +
+			"and the comments by it in batches, with the revisions, activities, webhook deliveries, failed jobs " +
+			"and idempotency responses copying them. It also encrypts the content written before the encryption " +
+			"was on. The servers may keep running, it can be run again after a failure.",
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if batch < 1 {
+				return fmt.Errorf("--batch must be positive")
+			}
+
+			return withDB(file, func(cfg *config.Config) error {
+				keyring, err := encryption.New(db.DB, cfg.Encryption)
+				if err != nil {
+					return err
+				}
+				if keyring == nil {
+					return errors.New("the encryption is off, set ENCRYPTION_KEY or ENCRYPTION_KMS_KEY_ID")
+				}
+
+				ctx := context.Background()
+				id, err := keyring.Rotate(ctx)
+				if err != nil {
+					return err
+				}
+				fmt.Printf("Created the data key %d\n", id)
+
+				return keyring.Reencrypt(ctx, batch, func(table string, done int64) {
+					fmt.Printf("Re-encrypted %d rows of %s\n", done, table)
+				})
+			})
+		},
+	}
+	rotate.Flags().IntVar(&batch, "batch", 500, "how many rows to re-encrypt in each transaction")
+	cmd.AddCommand(rotate)
+
+	return cmd
+}
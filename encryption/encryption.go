@@ -0,0 +1,436 @@
+// Package encryption encrypts the descriptions and the comments of the tasks at rest, with
+// AES-GCM, and the rows keeping copies of them: the revisions, the activities, the webhook
+// deliveries, the failed jobs and the stored responses of the idempotency keys. The content is encrypted by data keys kept in the encryption_keys table, wrapped by a
+// master key which never leaves the config or AWS KMS. The columns are encrypted and decrypted by
+// callbacks of GORM, so the repositories and the handlers only see the plaintext.
+//
+// An encrypted value is enc:v1:<id of the data key>:<base64 of the nonce and the ciphertext>,
+// bound to its table and column. The values without the prefix are read as they are, so the
+// rows written before the encryption was on are still read until they are re-encrypted.
+package encryption
+
+import (
+	"context"
+	"crypto/cipher"
+	"crypto/rand"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"io"
+	"net/http"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"task-app/config"
+	"task-app/models"
+	"time"
+)
+
+const prefix = "enc:v1:"
+
+// tables are the tables with encrypted columns, in the order they are re-encrypted
+var tables = []string{"tasks", "comments", "task_revisions", "activities", "webhook_deliveries", "failed_jobs", "idempotency_keys"}
+
+// columns are the encrypted columns of each table. The revisions are encrypted too, as they
+// keep the descriptions of the tasks before their updates, and so are the changes of the
+// activities, the events posted to the webhooks, the payloads of the failed jobs and the
+// responses replayed to the retries, which embed descriptions and comments.
+var columns = map[string][]string{
+	"tasks":              {"description"},
+	"comments":           {"body"},
+	"task_revisions":     {"changes", "previous"},
+	"activities":         {"data"},
+	"webhook_deliveries": {"payload"},
+	"failed_jobs":        {"payload"},
+	"idempotency_keys":   {"body"},
+}
+
+// fields returns the encrypted fields of a row, in the order of the columns of its table
+func fields(row interface{}) []*string {
+	switch r := row.(type) {
+	case *models.Task:
+		return []*string{&r.Description}
+	case *models.Comment:
+		return []*string{&r.Body}
+	case *models.TaskRevision:
+		return []*string{&r.Changes, &r.Previous}
+	case *models.Activity:
+		return []*string{&r.Data}
+	case *models.WebhookDelivery:
+		return []*string{&r.Payload}
+	case *models.FailedJob:
+		return []*string{&r.Payload}
+	case *models.IdempotencyKey:
+		return []*string{&r.Body}
+	}
+
+	return nil
+}
+
+// Keyring encrypts and decrypts the content with the data keys, a nil Keyring leaves it in
+// plaintext
+type Keyring struct {
+	db *gorm.DB
+	// current wraps the new data keys, masters are every configured master key by id
+	current masterKey
+	masters map[string]masterKey
+	// kms is the client of the KMS key of the config, it unwraps the data keys of the other
+	// keys of the account
+	kms *kmsKey
+
+	mu   sync.RWMutex
+	keys map[uint]cipher.AEAD
+	// active is the data key encrypting the new content, the newest one
+	active uint
+}
+
+// New returns the keyring of the config, with the data keys of the database unwrapped; the
+// first data key is created when there is none. It is nil without a master key, which fails
+// when the database has data keys, as the content would not be readable.
+func New(conn *gorm.DB, cfg config.Encryption) (*Keyring, error) {
+	k := &Keyring{
+		db:      conn.Session(&gorm.Session{NewDB: true}),
+		masters: map[string]masterKey{},
+		keys:    map[uint]cipher.AEAD{},
+	}
+
+	switch {
+	case cfg.KMSKeyID != "":
+		k.kms = &kmsKey{
+			keyID:        cfg.KMSKeyID,
+			region:       cfg.KMSRegion,
+			endpoint:     kmsEndpoint(cfg.KMSEndpoint, cfg.KMSRegion),
+			accessKey:    cfg.AccessKeyID,
+			secretKey:    cfg.SecretAccessKey,
+			sessionToken: cfg.SessionToken,
+			client:       &http.Client{Timeout: 10 * time.Second},
+		}
+		k.current = k.kms
+	case cfg.Key != "":
+		key, err := newLocalKey(cfg.Key)
+		if err != nil {
+			return nil, err
+		}
+		k.current = key
+	}
+	for _, encoded := range cfg.PreviousKeys {
+		key, err := newLocalKey(encoded)
+		if err != nil {
+			return nil, fmt.Errorf("%w (in the previous keys)", err)
+		}
+		k.masters[key.ID()] = key
+	}
+
+	if k.current == nil {
+		var count int64
+		// a missing table, before the migrations, has no keys
+		if err := k.db.Model(&models.EncryptionKey{}).Count(&count).Error; err == nil && count > 0 {
+			return nil, errors.New("encryption: the database is encrypted, ENCRYPTION_KEY or ENCRYPTION_KMS_KEY_ID is required")
+		}
+		return nil, nil
+	}
+	k.masters[k.current.ID()] = k.current
+
+	ctx := context.Background()
+	if err := k.load(ctx); err != nil {
+		return nil, err
+	}
+	if k.active == 0 {
+		if _, err := k.create(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	return k, nil
+}
+
+// isEncrypted tells whether a value of an encrypted column is encrypted
+func isEncrypted(value string) bool {
+	return strings.HasPrefix(value, prefix)
+}
+
+// Encrypt encrypts the value of a column, as table.column, by the active data key. The empty
+// values are kept empty.
+func (k *Keyring) Encrypt(column, value string) (string, error) {
+	if k == nil || value == "" {
+		return value, nil
+	}
+
+	k.mu.RLock()
+	id, aead := k.active, k.keys[k.active]
+	k.mu.RUnlock()
+
+	sealed, err := seal(aead, []byte(value), []byte(column))
+	if err != nil {
+		return "", err
+	}
+
+	return prefix + strconv.FormatUint(uint64(id), 10) + ":" + base64.RawStdEncoding.EncodeToString(sealed), nil
+}
+
+// Decrypt decrypts the value of a column, the values which are not encrypted are returned as
+// they are
+func (k *Keyring) Decrypt(column, value string) (string, error) {
+	if k == nil || !isEncrypted(value) {
+		return value, nil
+	}
+
+	id, sealed, err := parse(value)
+	if err != nil {
+		return "", err
+	}
+	aead, err := k.key(id)
+	if err != nil {
+		return "", err
+	}
+	plaintext, err := open(aead, sealed, []byte(column))
+	if err != nil {
+		return "", fmt.Errorf("encryption: cannot decrypt %s: %w", column, err)
+	}
+
+	return string(plaintext), nil
+}
+
+// parse returns the data key and the sealed content of an encrypted value
+func parse(value string) (uint, []byte, error) {
+	rest := strings.TrimPrefix(value, prefix)
+	i := strings.IndexByte(rest, ':')
+	if i < 0 {
+		return 0, nil, errors.New("encryption: malformed encrypted value")
+	}
+	id, err := strconv.ParseUint(rest[:i], 10, 64)
+	if err != nil {
+		return 0, nil, errors.New("encryption: malformed encrypted value")
+	}
+	sealed, err := base64.RawStdEncoding.DecodeString(rest[i+1:])
+	if err != nil {
+		return 0, nil, errors.New("encryption: malformed encrypted value")
+	}
+
+	return uint(id), sealed, nil
+}
+
+// key returns the data key of the id. An unknown key is looked for in the database, it may
+// have been created by the rotation on another instance.
+func (k *Keyring) key(id uint) (cipher.AEAD, error) {
+	k.mu.RLock()
+	aead, ok := k.keys[id]
+	k.mu.RUnlock()
+	if ok {
+		return aead, nil
+	}
+
+	if err := k.load(context.Background()); err != nil {
+		return nil, err
+	}
+	k.mu.RLock()
+	aead, ok = k.keys[id]
+	k.mu.RUnlock()
+	if !ok {
+		return nil, fmt.Errorf("encryption: unknown data key %d", id)
+	}
+
+	return aead, nil
+}
+
+// load unwraps the data keys of the database which are not loaded yet, the newest one is active
+func (k *Keyring) load(ctx context.Context) error {
+	var rows []models.EncryptionKey
+	if err := k.db.WithContext(ctx).Order("id").Find(&rows).Error; err != nil {
+		return err
+	}
+
+	k.mu.Lock()
+	defer k.mu.Unlock()
+	for _, row := range rows {
+		if _, ok := k.keys[row.ID]; !ok {
+			dataKey, err := k.unwrap(ctx, row)
+			if err != nil {
+				return err
+			}
+			aead, err := newAEAD(dataKey)
+			if err != nil {
+				return err
+			}
+			k.keys[row.ID] = aead
+		}
+		k.active = row.ID
+	}
+
+	return nil
+}
+
+// unwrap returns the data key of a row, unwrapped by its master key
+func (k *Keyring) unwrap(ctx context.Context, row models.EncryptionKey) ([]byte, error) {
+	master := k.master(row.MasterKeyID)
+	if master == nil {
+		return nil, fmt.Errorf("encryption: the master key %s of the data key %d is not configured", row.MasterKeyID, row.ID)
+	}
+	wrapped, err := base64.StdEncoding.DecodeString(row.WrappedKey)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: malformed data key %d", row.ID)
+	}
+	dataKey, err := master.Unwrap(ctx, wrapped)
+	if err != nil {
+		return nil, fmt.Errorf("encryption: cannot unwrap the data key %d by %s: %w", row.ID, row.MasterKeyID, err)
+	}
+
+	return dataKey, nil
+}
+
+// master returns the master key of the id, nil when it is not configured. The data keys of
+// another KMS key are unwrapped with the credentials of the configured one.
+func (k *Keyring) master(id string) masterKey {
+	if key, ok := k.masters[id]; ok {
+		return key
+	}
+	if k.kms != nil && strings.HasPrefix(id, "kms:") {
+		return k.kms.withKeyID(strings.TrimPrefix(id, "kms:"))
+	}
+
+	return nil
+}
+
+// create adds a data key wrapped by the current master key, it becomes the active one
+func (k *Keyring) create(ctx context.Context) (uint, error) {
+	dataKey := make([]byte, 32)
+	if _, err := io.ReadFull(rand.Reader, dataKey); err != nil {
+		return 0, err
+	}
+	aead, err := newAEAD(dataKey)
+	if err != nil {
+		return 0, err
+	}
+	wrapped, err := k.current.Wrap(ctx, dataKey)
+	if err != nil {
+		return 0, fmt.Errorf("encryption: cannot wrap a data key by %s: %w", k.current.ID(), err)
+	}
+
+	row := models.EncryptionKey{MasterKeyID: k.current.ID(), WrappedKey: base64.StdEncoding.EncodeToString(wrapped)}
+	if err := k.db.WithContext(ctx).Create(&row).Error; err != nil {
+		return 0, err
+	}
+
+	k.mu.Lock()
+	k.keys[row.ID] = aead
+	if row.ID > k.active {
+		k.active = row.ID
+	}
+	k.mu.Unlock()
+
+	return row.ID, nil
+}
+
+// Register encrypts the columns of the rows created and updated through GORM, and decrypts
+// them once written and when they are read. The hooks of the models see the plaintext.
+func (k *Keyring) Register(db *gorm.DB) error {
+	if k == nil {
+		return nil
+	}
+
+	cb := db.Callback()
+	if err := cb.Create().Before("gorm:create").Register("encryption:encrypt_create", k.encrypt); err != nil {
+		return err
+	}
+	if err := cb.Create().After("gorm:create").Before("gorm:after_create").Register("encryption:decrypt_create", k.decrypt); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("encryption:encrypt_update", k.encrypt); err != nil {
+		return err
+	}
+	if err := cb.Update().After("gorm:update").Before("gorm:after_update").Register("encryption:decrypt_update", k.decrypt); err != nil {
+		return err
+	}
+
+	return cb.Query().After("gorm:query").Before("gorm:after_query").Register("encryption:decrypt_query", k.decrypt)
+}
+
+func (k *Keyring) encrypt(tx *gorm.DB) {
+	if tx.Error != nil {
+		return
+	}
+	apply(tx, k.Encrypt)
+}
+
+// decrypt also runs after a failed statement, so the rows are given back in plaintext
+func (k *Keyring) decrypt(tx *gorm.DB) {
+	apply(tx, k.Decrypt)
+}
+
+// apply transforms the encrypted columns of the statement: the fields of its rows, of the model
+// and of the struct of the update, and the values of a map of the update
+func apply(tx *gorm.DB, transform func(column, value string) (string, error)) {
+	if tx.Statement.Schema == nil {
+		return
+	}
+	table := tx.Statement.Schema.Table
+	names := columns[table]
+	if len(names) == 0 {
+		return
+	}
+
+	// the destination is often the model itself, its rows are transformed once
+	targets := append(rows(tx.Statement.ReflectValue), rows(reflect.ValueOf(tx.Statement.Dest))...)
+	seen := map[interface{}]bool{}
+	for _, row := range targets {
+		if seen[row] {
+			continue
+		}
+		seen[row] = true
+		for i, field := range fields(row) {
+			value, err := transform(table+"."+names[i], *field)
+			if err != nil {
+				tx.AddError(err)
+				return
+			}
+			*field = value
+		}
+	}
+
+	if values, ok := tx.Statement.Dest.(map[string]interface{}); ok {
+		for key, v := range values {
+			s, ok := v.(string)
+			if !ok {
+				continue
+			}
+			for _, name := range names {
+				// the keys are the columns or the names of the fields
+				if strings.EqualFold(strings.ReplaceAll(key, "_", ""), name) {
+					value, err := transform(table+"."+name, s)
+					if err != nil {
+						tx.AddError(err)
+						return
+					}
+					values[key] = value
+				}
+			}
+		}
+	}
+}
+
+// rows returns the pointers to the rows of a statement, one struct or a slice of them
+func rows(v reflect.Value) []interface{} {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		rows := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item := reflect.Indirect(v.Index(i))
+			if item.CanAddr() {
+				rows = append(rows, item.Addr().Interface())
+			}
+		}
+		return rows
+	case reflect.Struct:
+		if v.CanAddr() {
+			return []interface{}{v.Addr().Interface()}
+		}
+	}
+
+	return nil
+}
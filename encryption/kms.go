@@ -0,0 +1,159 @@
+package encryption
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const (
+	kmsAlgorithm  = "AWS4-HMAC-SHA256"
+	kmsTimeFormat = "20060102T150405Z"
+	kmsDateFormat = "20060102"
+)
+
+// kmsKey is a key of AWS KMS, the data keys are wrapped by its Encrypt and Decrypt calls.
+// The requests are signed with AWS Signature V4.
+type kmsKey struct {
+	keyID        string
+	region       string
+	endpoint     string
+	accessKey    string
+	secretKey    string
+	sessionToken string
+	client       *http.Client
+}
+
+func (k *kmsKey) ID() string {
+	return "kms:" + k.keyID
+}
+
+func (k *kmsKey) Wrap(ctx context.Context, dataKey []byte) ([]byte, error) {
+	var out struct {
+		CiphertextBlob []byte
+	}
+	err := k.call(ctx, "Encrypt", map[string]interface{}{"KeyId": k.keyID, "Plaintext": dataKey}, &out)
+
+	return out.CiphertextBlob, err
+}
+
+func (k *kmsKey) Unwrap(ctx context.Context, wrapped []byte) ([]byte, error) {
+	var out struct {
+		Plaintext []byte
+	}
+	err := k.call(ctx, "Decrypt", map[string]interface{}{"KeyId": k.keyID, "CiphertextBlob": wrapped}, &out)
+
+	return out.Plaintext, err
+}
+
+// withKeyID returns the client of another key of the account, the one which wrapped older data keys
+func (k *kmsKey) withKeyID(keyID string) *kmsKey {
+	other := *k
+	other.keyID = keyID
+
+	return &other
+}
+
+// call calls an action of the KMS API, the []byte fields are sent and read in base64 as it expects
+func (k *kmsKey) call(ctx context.Context, action string, in, out interface{}) error {
+	body, err := json.Marshal(in)
+	if err != nil {
+		return err
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, k.endpoint+"/", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-amz-json-1.1")
+	req.Header.Set("X-Amz-Target", "TrentService."+action)
+	k.sign(req, body)
+
+	res, err := k.client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		msg, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return fmt.Errorf("encryption: kms %s: %s: %s", action, res.Status, msg)
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// sign adds the Authorization header to a request with the body
+func (k *kmsKey) sign(req *http.Request, body []byte) {
+	t := time.Now().UTC()
+	payload := sha256.Sum256(body)
+	req.Header.Set("X-Amz-Date", t.Format(kmsTimeFormat))
+	if k.sessionToken != "" {
+		req.Header.Set("X-Amz-Security-Token", k.sessionToken)
+	}
+
+	headers := []string{"content-type", "host", "x-amz-date", "x-amz-target"}
+	values := map[string]string{
+		"content-type": req.Header.Get("Content-Type"),
+		"host":         req.URL.Host,
+		"x-amz-date":   t.Format(kmsTimeFormat),
+		"x-amz-target": req.Header.Get("X-Amz-Target"),
+	}
+	if k.sessionToken != "" {
+		headers = append(headers, "x-amz-security-token")
+		values["x-amz-security-token"] = k.sessionToken
+	}
+	canonicalHeaders := ""
+	for _, h := range headers {
+		canonicalHeaders += h + ":" + values[h] + "\n"
+	}
+	signedHeaders := strings.Join(headers, ";")
+
+	canonicalRequest := strings.Join([]string{
+		req.Method,
+		"/",
+		"",
+		canonicalHeaders,
+		signedHeaders,
+		hex.EncodeToString(payload[:]),
+	}, "\n")
+	hash := sha256.Sum256([]byte(canonicalRequest))
+	scope := t.Format(kmsDateFormat) + "/" + k.region + "/kms/aws4_request"
+	stringToSign := strings.Join([]string{kmsAlgorithm, t.Format(kmsTimeFormat), scope, hex.EncodeToString(hash[:])}, "\n")
+
+	key := kmsHMAC([]byte("AWS4"+k.secretKey), t.Format(kmsDateFormat))
+	key = kmsHMAC(key, k.region)
+	key = kmsHMAC(key, "kms")
+	key = kmsHMAC(key, "aws4_request")
+
+	req.Header.Set("Authorization", fmt.Sprintf(
+		"%s Credential=%s/%s, SignedHeaders=%s, Signature=%s",
+		kmsAlgorithm, k.accessKey, scope, signedHeaders, hex.EncodeToString(kmsHMAC(key, stringToSign)),
+	))
+}
+
+func kmsHMAC(key []byte, data string) []byte {
+	mac := hmac.New(sha256.New, key)
+	mac.Write([]byte(data))
+	return mac.Sum(nil)
+}
+
+// kmsEndpoint is the endpoint of the config, the one of AWS in the region by default
+func kmsEndpoint(endpoint, region string) string {
+	if endpoint == "" {
+		return "https://kms." + region + ".amazonaws.com"
+	}
+	if !strings.Contains(endpoint, "://") {
+		endpoint = "https://" + endpoint
+	}
+
+	return strings.TrimRight(endpoint, "/")
+}
@@ -0,0 +1,82 @@
+package encryption
+
+import (
+	"context"
+	"crypto/aes"
+	"crypto/cipher"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"io"
+)
+
+// masterKey wraps the data keys, it never encrypts the content itself
+type masterKey interface {
+	// ID names the key, it is stored with the data keys it wrapped
+	ID() string
+	Wrap(ctx context.Context, dataKey []byte) ([]byte, error)
+	Unwrap(ctx context.Context, wrapped []byte) ([]byte, error)
+}
+
+// localKey is a master key of the config, it wraps the data keys with AES-GCM
+type localKey struct {
+	id   string
+	aead cipher.AEAD
+}
+
+// newLocalKey reads a base64 key of 32 bytes. Its id is a digest of the key, so the data keys
+// find it again among the previous keys after a rotation.
+func newLocalKey(encoded string) (*localKey, error) {
+	key, err := base64.StdEncoding.DecodeString(encoded)
+	if err != nil || len(key) != 32 {
+		return nil, errors.New("encryption: a key must be 32 bytes in base64, e.g. from openssl rand -base64 32")
+	}
+	aead, err := newAEAD(key)
+	if err != nil {
+		return nil, err
+	}
+	sum := sha256.Sum256(key)
+
+	return &localKey{id: "local:" + hex.EncodeToString(sum[:4]), aead: aead}, nil
+}
+
+func (k *localKey) ID() string {
+	return k.id
+}
+
+func (k *localKey) Wrap(_ context.Context, dataKey []byte) ([]byte, error) {
+	return seal(k.aead, dataKey, []byte(k.id))
+}
+
+func (k *localKey) Unwrap(_ context.Context, wrapped []byte) ([]byte, error) {
+	return open(k.aead, wrapped, []byte(k.id))
+}
+
+func newAEAD(key []byte) (cipher.AEAD, error) {
+	block, err := aes.NewCipher(key)
+	if err != nil {
+		return nil, err
+	}
+
+	return cipher.NewGCM(block)
+}
+
+// seal encrypts the plaintext with a random nonce, the nonce is the start of the result
+func seal(aead cipher.AEAD, plaintext, additional []byte) ([]byte, error) {
+	nonce := make([]byte, aead.NonceSize(), aead.NonceSize()+len(plaintext)+aead.Overhead())
+	if _, err := io.ReadFull(rand.Reader, nonce); err != nil {
+		return nil, err
+	}
+
+	return aead.Seal(nonce, nonce, plaintext, additional), nil
+}
+
+func open(aead cipher.AEAD, sealed, additional []byte) ([]byte, error) {
+	if len(sealed) < aead.NonceSize() {
+		return nil, errors.New("encryption: the ciphertext is too short")
+	}
+
+	return aead.Open(nil, sealed[:aead.NonceSize()], sealed[aead.NonceSize():], additional)
+}
@@ -0,0 +1,163 @@
+package encryption
+
+import (
+	"context"
+	"database/sql"
+	"encoding/base64"
+	"fmt"
+	"gorm.io/gorm"
+	"task-app/models"
+)
+
+// Rotate wraps every data key by the current master key, so the previous master keys can be
+// removed from the config, and adds a data key which encrypts the new content from then. The
+// older data keys are kept for the content they encrypted, until Reencrypt is run.
+func (k *Keyring) Rotate(ctx context.Context) (uint, error) {
+	if err := k.load(ctx); err != nil {
+		return 0, err
+	}
+
+	var keys []models.EncryptionKey
+	if err := k.db.WithContext(ctx).Order("id").Find(&keys).Error; err != nil {
+		return 0, err
+	}
+	for _, row := range keys {
+		if row.MasterKeyID == k.current.ID() {
+			continue
+		}
+		dataKey, err := k.unwrap(ctx, row)
+		if err != nil {
+			return 0, err
+		}
+		wrapped, err := k.current.Wrap(ctx, dataKey)
+		if err != nil {
+			return 0, fmt.Errorf("encryption: cannot wrap the data key %d by %s: %w", row.ID, k.current.ID(), err)
+		}
+		if err := k.db.WithContext(ctx).Model(&row).Updates(map[string]interface{}{
+			"master_key_id": k.current.ID(),
+			"wrapped_key":   base64.StdEncoding.EncodeToString(wrapped),
+		}).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return k.create(ctx)
+}
+
+// Reencrypt encrypts the columns by the active data key: the values written before the
+// encryption was on, and the ones of the older data keys. The rows are read by id in batches of
+// the size, each batch is written in a transaction; a value changed since it was read is left
+// as it is, it was written by the active key. progress is called after each batch with the
+// count of the rewritten rows of the table.
+func (k *Keyring) Reencrypt(ctx context.Context, size int, progress func(table string, done int64)) error {
+	for _, table := range tables {
+		var done int64
+		var after uint
+		for {
+			last, changed, err := k.reencryptBatch(ctx, table, after, size)
+			if err != nil {
+				return fmt.Errorf("encryption: cannot re-encrypt %s: %w", table, err)
+			}
+			if last == after {
+				break
+			}
+			after = last
+			done += changed
+			progress(table, done)
+		}
+	}
+
+	return nil
+}
+
+// reencryptBatch rewrites the rows of the batch after the id, it returns the last id read and
+// the count of the rewritten rows. The statements name the table without a model, so the
+// callbacks of Register leave their values as they are.
+func (k *Keyring) reencryptBatch(ctx context.Context, table string, after uint, size int) (uint, int64, error) {
+	names := columns[table]
+	k.mu.RLock()
+	active := k.active
+	k.mu.RUnlock()
+
+	rows, err := k.db.WithContext(ctx).Table(table).
+		Select(append([]string{"id"}, names...)).
+		Where("id > ?", after).
+		Order("id").
+		Limit(size).
+		Rows()
+	if err != nil {
+		return after, 0, err
+	}
+
+	type update struct {
+		id       uint
+		previous map[string]interface{}
+		values   map[string]interface{}
+	}
+	var updates []update
+	last := after
+	for rows.Next() {
+		var id uint
+		values := make([]sql.NullString, len(names))
+		dest := []interface{}{&id}
+		for i := range values {
+			dest = append(dest, &values[i])
+		}
+		if err := rows.Scan(dest...); err != nil {
+			rows.Close()
+			return after, 0, err
+		}
+		last = id
+
+		u := update{id: id, previous: map[string]interface{}{}, values: map[string]interface{}{}}
+		for i, name := range names {
+			value := values[i].String
+			if value == "" || !stale(value, active) {
+				continue
+			}
+			plaintext, err := k.Decrypt(table+"."+name, value)
+			if err != nil {
+				rows.Close()
+				return after, 0, fmt.Errorf("row %d: %w", id, err)
+			}
+			encrypted, err := k.Encrypt(table+"."+name, plaintext)
+			if err != nil {
+				rows.Close()
+				return after, 0, err
+			}
+			u.previous[name] = value
+			u.values[name] = encrypted
+		}
+		if len(u.values) > 0 {
+			updates = append(updates, u)
+		}
+	}
+	rows.Close()
+	if err := rows.Err(); err != nil {
+		return after, 0, err
+	}
+
+	var changed int64
+	err = k.db.WithContext(ctx).Transaction(func(tx *gorm.DB) error {
+		for _, u := range updates {
+			res := tx.Table(table).Where("id = ?", u.id).Where(u.previous).UpdateColumns(u.values)
+			if res.Error != nil {
+				return res.Error
+			}
+			changed += res.RowsAffected
+		}
+		return nil
+	})
+
+	return last, changed, err
+}
+
+// stale tells whether a value is not encrypted by the active data key
+func stale(value string, active uint) bool {
+	if !isEncrypted(value) {
+		return true
+	}
+	id, _, err := parse(value)
+
+	return err != nil || id != active
+}
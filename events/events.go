@@ -0,0 +1,85 @@
+package events
+
+import (
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	TaskCreated    = "task.created"
+	TaskUpdated    = "task.updated"
+	TaskCompleted  = "task.completed"
+	TaskDeleted    = "task.deleted"
+	TaskRestored   = "task.restored"
+	TaskArchived   = "task.archived"
+	TaskUnarchived = "task.unarchived"
+	TaskAssigned   = "task.assigned"
+	TaskUnassigned = "task.unassigned"
+	// TaskUnblocked is published for a task when its last blocker is completed
+	TaskUnblocked = "task.unblocked"
+	// TaskOverdue is published by the scheduler once the due date of an open task passes
+	TaskOverdue    = "task.overdue"
+	CommentAdded   = "comment.added"
+	CommentDeleted = "comment.deleted"
+	UserLocked     = "user.locked"
+	UserUnlocked   = "user.unlocked"
+	// UserImpersonated is published when an admin starts acting as the user, ImpersonationEnded when it stops
+	UserImpersonated   = "user.impersonated"
+	ImpersonationEnded = "user.impersonation_ended"
+)
+
+// Change is the old and new value of a changed field
+type Change struct {
+	From interface{} `json:"from"`
+	To   interface{} `json:"to"`
+}
+
+// Event is a change of the data other parts of the app can react to
+type Event struct {
+	Type    string `json:"type"`
+	ActorID uint   `json:"actorId"`
+	// ImpersonatorID is the admin who made the change acting as the actor, 0 when it is the actor
+	ImpersonatorID uint              `json:"impersonatorId,omitempty"`
+	TaskID         uint              `json:"taskId,omitempty"`
+	TargetID       uint              `json:"targetId"`
+	OwnerID        uint              `json:"-"`
+	WorkspaceID    *uint             `json:"workspaceId,omitempty"`
+	Payload        interface{}       `json:"payload,omitempty"`
+	Changes        map[string]Change `json:"changes,omitempty"`
+	CreatedAt      time.Time         `json:"createdAt"`
+}
+
+// Target returns the kind of the changed object, like "task" or "comment"
+func (e Event) Target() string {
+	return strings.SplitN(e.Type, ".", 2)[0]
+}
+
+// Handler reacts to an event. Handlers are called synchronously by Publish,
+// so slow work like network calls must be moved to a goroutine.
+type Handler func(e Event)
+
+var (
+	mu       sync.RWMutex
+	handlers []Handler
+)
+
+// Subscribe registers a handler called for every published event
+func Subscribe(h Handler) {
+	mu.Lock()
+	defer mu.Unlock()
+	handlers = append(handlers, h)
+}
+
+// Publish sends the event to every handler
+func Publish(e Event) {
+	if e.CreatedAt.IsZero() {
+		e.CreatedAt = time.Now().UTC()
+	}
+
+	mu.RLock()
+	defer mu.RUnlock()
+	for _, h := range handlers {
+		h(e)
+	}
+}
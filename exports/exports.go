@@ -0,0 +1,246 @@
+package exports
+
+import (
+	"archive/zip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"task-app/db"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/notifications"
+	"task-app/queue"
+	"task-app/storage"
+	"time"
+)
+
+const (
+	// buildJob is the kind of the jobs building the archive of an export
+	buildJob    = "user.export"
+	maxAttempts = 3
+)
+
+// ErrPending is returned when the user asks for an export while one is built
+var ErrPending = errors.New("an export is in progress")
+
+var notifier *notifications.Notifier
+
+// Setup registers the jobs building the archives, the user is told by the notifier once one is ready
+func Setup(n *notifications.Notifier) {
+	notifier = n
+	queue.Register(buildJob, build, queue.Policy{
+		MaxAttempts: maxAttempts,
+		Backoff:     time.Minute,
+		MaxBackoff:  10 * time.Minute,
+	})
+}
+
+// Request queues the export of the data of the user, the pending export is returned with
+// ErrPending when there is one already
+func Request(u *models.User) (*models.DataExport, error) {
+	export := new(models.DataExport)
+	if res := db.DB.Where("user_id = ? AND status = ?", u.ID, models.ExportPending).Limit(1).Find(export); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected > 0 {
+		return export, ErrPending
+	}
+
+	export = &models.DataExport{UserID: u.ID, Status: models.ExportPending}
+	if err := db.DB.Create(export).Error; err != nil {
+		return nil, err
+	}
+	if _, err := queue.Enqueue(buildJob, export.ID); err != nil {
+		db.DB.Delete(export)
+		return nil, err
+	}
+
+	return export, nil
+}
+
+func build(ctx context.Context, job *queue.Job) error {
+	var id uint
+	if err := json.Unmarshal(job.Payload, &id); err != nil {
+		return queue.Permanent(err)
+	}
+
+	export := new(models.DataExport)
+	if res := db.DB.Where("id = ? AND status = ?", id, models.ExportPending).Limit(1).Find(export); res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return nil
+	}
+
+	u := new(models.User)
+	if err := db.DB.First(u, export.UserID).Error; err != nil {
+		fail(export, err)
+		return queue.Permanent(err)
+	}
+
+	if err := store(export, u); err != nil {
+		if job.Attempt >= maxAttempts {
+			fail(export, err)
+		}
+		return err
+	}
+
+	return notify(export, u)
+}
+
+func fail(export *models.DataExport, err error) {
+	db.DB.Model(export).Updates(map[string]interface{}{"status": models.ExportFailed, "error": err.Error()})
+}
+
+// store writes the archive of the export to the storage and marks the export ready
+func store(export *models.DataExport, u *models.User) error {
+	// the archive is written to a file first, the storage needs its size
+	f, err := os.CreateTemp("", "export-*.zip")
+	if err != nil {
+		return err
+	}
+	defer os.Remove(f.Name())
+	defer f.Close()
+
+	if err := write(f, u); err != nil {
+		return err
+	}
+	size, err := f.Seek(0, io.SeekCurrent)
+	if err != nil {
+		return err
+	}
+	if _, err := f.Seek(0, io.SeekStart); err != nil {
+		return err
+	}
+
+	key := fmt.Sprintf("exports/%d/%d-%s.zip", u.ID, export.ID, time.Now().Format("20060102150405"))
+	if err := storage.Store.Put(key, f, size, "application/zip"); err != nil {
+		return err
+	}
+
+	now := time.Now()
+	expires := now.Add(models.ExportRetention)
+	if err := db.DB.Model(export).Updates(map[string]interface{}{
+		"status":       models.ExportReady,
+		"storage_key":  key,
+		"size":         size,
+		"completed_at": now,
+		"expires_at":   expires,
+	}).Error; err != nil {
+		storage.Store.Delete(key)
+		return err
+	}
+	export.Status, export.StorageKey, export.Size, export.CompletedAt, export.ExpiresAt = models.ExportReady, key, size, &now, &expires
+
+	return nil
+}
+
+// write writes the data of the user to the archive, a JSON file per kind
+func write(w io.Writer, u *models.User) error {
+	zw := zip.NewWriter(w)
+
+	var tasks []models.Task
+	// the tasks in the trash are the user's data too
+	if err := db.DB.Unscoped().Preload("Labels").Where("user_id = ?", u.ID).Order("id").Find(&tasks).Error; err != nil {
+		return err
+	}
+	taskApis := make([]models.TaskApi, 0, len(tasks))
+	for _, t := range tasks {
+		taskApis = append(taskApis, t.Api())
+	}
+
+	var projects []models.Project
+	if err := db.DB.Where("user_id = ?", u.ID).Order("id").Find(&projects).Error; err != nil {
+		return err
+	}
+	projectApis := make([]models.ProjectApi, 0, len(projects))
+	for _, p := range projects {
+		projectApis = append(projectApis, p.Api())
+	}
+
+	var labels []models.Label
+	if err := db.DB.Where("user_id = ?", u.ID).Order("id").Find(&labels).Error; err != nil {
+		return err
+	}
+	labelApis := make([]models.LabelApi, 0, len(labels))
+	for _, l := range labels {
+		labelApis = append(labelApis, l.Api())
+	}
+
+	var comments []models.Comment
+	if err := db.DB.Preload("User").Where("user_id = ?", u.ID).Order("id").Find(&comments).Error; err != nil {
+		return err
+	}
+	commentApis := make([]models.CommentApi, 0, len(comments))
+	for _, cm := range comments {
+		commentApis = append(commentApis, cm.Api())
+	}
+
+	var attachments []models.Attachment
+	if err := db.DB.Where("user_id = ?", u.ID).Order("id").Find(&attachments).Error; err != nil {
+		return err
+	}
+	attachmentApis := make([]models.AttachmentApi, 0, len(attachments))
+	for _, a := range attachments {
+		// the metadata only, the links would expire long before the archive
+		attachmentApis = append(attachmentApis, a.Api(""))
+	}
+
+	var activities []models.Activity
+	if err := db.DB.Where("actor_id = ?", u.ID).Order("id").Find(&activities).Error; err != nil {
+		return err
+	}
+	activityApis := make([]models.ActivityApi, 0, len(activities))
+	for _, a := range activities {
+		activityApis = append(activityApis, a.Api())
+	}
+
+	files := []struct {
+		name string
+		data interface{}
+	}{
+		{"profile.json", u.Api()},
+		{"tasks.json", taskApis},
+		{"projects.json", projectApis},
+		{"labels.json", labelApis},
+		{"comments.json", commentApis},
+		{"attachments.json", attachmentApis},
+		{"activity.json", activityApis},
+	}
+	now := time.Now()
+	for _, file := range files {
+		fw, err := zw.CreateHeader(&zip.FileHeader{Name: file.name, Method: zip.Deflate, Modified: now})
+		if err != nil {
+			return err
+		}
+		enc := json.NewEncoder(fw)
+		enc.SetIndent("", "  ")
+		if err := enc.Encode(file.data); err != nil {
+			return err
+		}
+	}
+
+	return zw.Close()
+}
+
+// notify tells the user the export is ready, in the language and the zone of the user
+func notify(export *models.DataExport, u *models.User) error {
+	if notifier == nil {
+		return nil
+	}
+
+	p := i18n.For(u.Locale)
+	if err := notifier.Notify(models.Notification{
+		UserID: export.UserID,
+		Kind:   models.NotifyExport,
+		Title:  p.Text("Your data export is ready"),
+		Body:   p.Sprintf("The archive of your data can be downloaded until %s.", export.ExpiresAt.In(u.Location()).Format("2006-01-02 15:04 MST")),
+	}); err != nil {
+		// the archive is ready, it is listed with the exports anyway
+		logging.Log.Error().Err(err).Uint("export", export.ID).Msg("Cannot notify of the export")
+	}
+
+	return nil
+}
@@ -0,0 +1,146 @@
+package fixtures
+
+import (
+	"math/rand"
+	"strings"
+	"time"
+)
+
+var (
+	firstNames = []string{
+		"Ada", "Alan", "Grace", "Linus", "Margaret", "Dennis", "Barbara", "Ken", "Frances", "Donald",
+		"Radia", "Edsger", "Hedy", "John", "Katherine", "Tim", "Sophie", "Bjarne", "Adele", "Niklaus",
+		"Lynn", "Guido", "Karen", "James", "Anita", "Robert", "Joan", "Brian", "Mary", "Leslie",
+	}
+	lastNames = []string{
+		"Lovelace", "Turing", "Hopper", "Torvalds", "Hamilton", "Ritchie", "Liskov", "Thompson", "Allen", "Knuth",
+		"Perlman", "Dijkstra", "Lamarr", "McCarthy", "Johnson", "Berners-Lee", "Wilson", "Stroustrup", "Goldberg", "Wirth",
+		"Conway", "van Rossum", "Jones", "Gosling", "Borg", "Pike", "Clarke", "Kernighan", "Shaw", "Lamport",
+	}
+	companies = []string{
+		"Acme", "Globex", "Initech", "Umbrella", "Hooli", "Vandelay", "Stark", "Wayne", "Wonka", "Cyberdyne",
+		"Soylent", "Tyrell", "Aperture", "Massive Dynamic", "Pied Piper", "Oscorp",
+	}
+	projectNames = []string{
+		"Website relaunch", "Mobile app", "Q4 roadmap", "Customer onboarding", "Billing migration", "Hiring",
+		"Marketing campaign", "Security audit", "Data warehouse", "Support backlog", "Office move", "API v2",
+		"Design system", "Conference talk", "Partner integrations", "Quarterly report",
+	}
+	verbs = []string{
+		"Write", "Review", "Fix", "Update", "Design", "Plan", "Test", "Deploy", "Refactor", "Document",
+		"Migrate", "Prepare", "Call", "Schedule", "Research", "Draft", "Clean up", "Monitor", "Benchmark", "Ship",
+	}
+	objects = []string{
+		"the landing page", "the login flow", "the invoice template", "the onboarding emails", "the release notes",
+		"the database indexes", "the a11y issues", "the pricing page", "the backup script", "the sprint demo",
+		"the customer feedback", "the API docs", "the CI pipeline", "the search results", "the newsletter",
+		"the budget", "the dashboard", "the error pages", "the style guide", "the load tests",
+	}
+	labelNames = []string{
+		"bug", "feature", "design", "backend", "frontend", "urgent", "docs", "research", "ops", "marketing",
+	}
+	labelColors = []string{
+		"#ef4444", "#f59e0b", "#10b981", "#3b82f6", "#8b5cf6", "#ec4899", "#14b8a6", "#64748b",
+	}
+	sentences = []string{
+		"This blocks the release, please have a look first.",
+		"The customer asked for it twice already.",
+		"See the notes of the last meeting for the details.",
+		"It only happens on **Safari** with a slow connection.",
+		"Keep it small, we iterate on it next sprint.",
+		"The numbers are in the shared spreadsheet.",
+		"Check with the legal team before it goes out.",
+		"A first draft is enough for the review.",
+		"Pair on it with someone of the other team.",
+		"The old version is still used by a few accounts.",
+	}
+	checklistItems = []string{
+		"Draft", "Review", "Get the approval", "Write the tests", "Update the docs", "Announce it",
+		"Measure the impact", "Clean up", "Ask for feedback", "Deploy to staging",
+	}
+	comments = []string{
+		"On it!", "Done on my side, can you check?", "I think we should split this one.",
+		"Moved the deadline, the vendor is late.", "Looks good to me :+1:", "Any update on this?",
+		"I added the screenshots to the attachments.", "Let's discuss it in the standup.",
+	}
+)
+
+// Faker makes fake data from a seeded generator, the same seed makes the same data
+type Faker struct {
+	rand *rand.Rand
+}
+
+// NewFaker returns a faker of the seed
+func NewFaker(seed int64) *Faker {
+	return &Faker{rand: rand.New(rand.NewSource(seed))}
+}
+
+// Intn returns a number in [0, n)
+func (f *Faker) Intn(n int) int {
+	return f.rand.Intn(n)
+}
+
+// Between returns a number in [min, max]
+func (f *Faker) Between(min, max int) int {
+	return min + f.rand.Intn(max-min+1)
+}
+
+// Chance is true with the probability p
+func (f *Faker) Chance(p float64) bool {
+	return f.rand.Float64() < p
+}
+
+// Pick returns one of the items
+func (f *Faker) Pick(items []string) string {
+	return items[f.rand.Intn(len(items))]
+}
+
+// Name returns a first and a last name
+func (f *Faker) Name() (string, string) {
+	return f.Pick(firstNames), f.Pick(lastNames)
+}
+
+// Company returns the name of a company
+func (f *Faker) Company() string {
+	return f.Pick(companies)
+}
+
+// ProjectTitle returns the title of a project
+func (f *Faker) ProjectTitle() string {
+	return f.Pick(projectNames)
+}
+
+// TaskTitle returns the title of a task, like Review the release notes
+func (f *Faker) TaskTitle() string {
+	return f.Pick(verbs) + " " + f.Pick(objects)
+}
+
+// Paragraph returns up to n sentences, some of them Markdown
+func (f *Faker) Paragraph(n int) string {
+	parts := make([]string, f.Between(1, n))
+	for i := range parts {
+		parts[i] = f.Pick(sentences)
+	}
+
+	return strings.Join(parts, " ")
+}
+
+// Comment returns the body of a comment
+func (f *Faker) Comment() string {
+	return f.Pick(comments)
+}
+
+// ChecklistItem returns the text of an item of a checklist
+func (f *Faker) ChecklistItem() string {
+	return f.Pick(checklistItems)
+}
+
+// Time returns a time up to the duration before or after t, by the minute
+func (f *Faker) Time(t time.Time, before, after time.Duration) time.Time {
+	span := int64((before + after) / time.Minute)
+	if span <= 0 {
+		return t
+	}
+
+	return t.Add(-before).Add(time.Duration(f.rand.Int63n(span)) * time.Minute)
+}
@@ -0,0 +1,186 @@
+// Package fixtures fills a database with realistic fake data: the users, workspaces, projects,
+// labels and tasks of the factory are made by a seeded faker, so a seed always makes the same data.
+// The seed command uses it for local development and performance tests, the tests for their fixtures.
+package fixtures
+
+import (
+	"fmt"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"strings"
+	"task-app/models"
+	"time"
+)
+
+// DefaultPassword is the password of the users made by the factory
+const DefaultPassword = "Passw0rd!"
+
+// batchSize is how many tasks are inserted at once
+const batchSize = 500
+
+// Factory creates fake records in a database
+type Factory struct {
+	db    *gorm.DB
+	fake  *Faker
+	now   time.Time
+	users int
+	// password is the hash of the password of the users, hashing it once for all of them
+	password string
+	// positions are the last positions of the lists of tasks, by list
+	positions map[string]int
+}
+
+// New returns a factory of the seed. The dates are relative to now, truncated to the day, so
+// the data made on a day are the same.
+func New(db *gorm.DB, seed int64, password string) (*Factory, error) {
+	if password == "" {
+		password = DefaultPassword
+	}
+	hash, err := bcrypt.GenerateFromPassword([]byte(password), bcrypt.MinCost)
+	if err != nil {
+		return nil, err
+	}
+
+	return &Factory{
+		db:        db,
+		fake:      NewFaker(seed),
+		now:       time.Now().UTC().Truncate(24 * time.Hour),
+		password:  string(hash),
+		positions: map[string]int{},
+	}, nil
+}
+
+// Faker returns the faker of the factory
+func (f *Factory) Faker() *Faker {
+	return f.fake
+}
+
+// User creates a user with a unique username like ada.lovelace.3 and the email of it at example.com
+func (f *Factory) User() (*models.User, error) {
+	f.users++
+	first, last := f.fake.Name()
+	username := fmt.Sprintf("%s.%s.%d", strings.ToLower(first), strings.ToLower(strings.ReplaceAll(last, " ", "")), f.users)
+
+	u := &models.User{
+		Username:    username,
+		Email:       username + "@example.com",
+		DisplayName: first + " " + last,
+		Password:    f.password,
+		TimeZone:    f.fake.Pick([]string{"", "Europe/Berlin", "America/New_York", "Asia/Tokyo"}),
+	}
+	u.CreatedAt = f.fake.Time(f.now, 365*24*time.Hour, 0)
+
+	return u, f.db.Create(u).Error
+}
+
+// Workspace creates a workspace of the owner with the members
+func (f *Factory) Workspace(owner *models.User, members ...*models.User) (*models.Workspace, error) {
+	w := &models.Workspace{Name: f.fake.Company(), OwnerID: owner.ID}
+	if err := f.db.Create(w).Error; err != nil {
+		return nil, err
+	}
+
+	memberships := []models.Membership{{WorkspaceID: w.ID, UserID: owner.ID, Role: models.WorkspaceOwner}}
+	for _, m := range members {
+		role := models.WorkspaceMember
+		if f.fake.Chance(0.2) {
+			role = models.WorkspaceViewer
+		}
+		memberships = append(memberships, models.Membership{WorkspaceID: w.ID, UserID: m.ID, Role: role})
+	}
+
+	return w, f.db.Create(&memberships).Error
+}
+
+// Project creates a project of the user, in the workspace or personal without one
+func (f *Factory) Project(u *models.User, w *models.Workspace) (*models.Project, error) {
+	p := &models.Project{UserID: u.ID, Title: f.fake.ProjectTitle(), Description: f.fake.Paragraph(3)}
+	if w != nil {
+		p.WorkspaceID = &w.ID
+	}
+
+	return p, f.db.Create(p).Error
+}
+
+// Labels creates the labels of the user
+func (f *Factory) Labels(u *models.User) ([]models.Label, error) {
+	labels := make([]models.Label, 0, len(labelNames))
+	for i, name := range labelNames {
+		labels = append(labels, models.Label{UserID: u.ID, Name: name, Color: labelColors[i%len(labelColors)]})
+	}
+
+	return labels, f.db.Create(&labels).Error
+}
+
+// Task returns a task of the user in the project, not created yet so the tasks can be inserted in batches.
+// A third is done, a few are in progress, half of the open ones are due and some of these overdue.
+func (f *Factory) Task(u *models.User, p *models.Project, labels []models.Label) models.Task {
+	t := models.Task{
+		UserID:      u.ID,
+		WorkspaceID: p.WorkspaceID,
+		ProjectID:   &p.ID,
+		Title:       f.fake.TaskTitle(),
+		Priority:    f.fake.Between(1, 4),
+		Status:      models.StatusTodo,
+	}
+	t.CreatedAt = f.fake.Time(f.now, 90*24*time.Hour, 0)
+	if f.fake.Chance(0.5) {
+		t.Description = f.fake.Paragraph(4)
+	}
+
+	switch {
+	case f.fake.Chance(0.3):
+		t.Status = models.StatusDone
+		completed := f.fake.Time(f.now, f.now.Sub(t.CreatedAt), 0)
+		t.CompletedAt = &completed
+	case f.fake.Chance(0.15):
+		t.Status = "in_progress"
+	}
+	if f.fake.Chance(0.5) {
+		due := f.fake.Time(f.now, 14*24*time.Hour, 30*24*time.Hour)
+		t.DueAt = &due
+	}
+	if f.fake.Chance(0.05) {
+		t.Recurrence = f.fake.Pick([]string{"FREQ=DAILY", "FREQ=WEEKLY;BYDAY=MO", "FREQ=MONTHLY"})
+	}
+
+	for _, i := range f.fake.rand.Perm(len(labels))[:f.fake.Between(0, 2)] {
+		t.Labels = append(t.Labels, labels[i])
+	}
+	if f.fake.Chance(0.2) {
+		items := f.fake.Between(2, 6)
+		done := f.fake.Between(0, items)
+		for i := 0; i < items; i++ {
+			t.Checklist = append(t.Checklist, models.ChecklistItem{Text: f.fake.ChecklistItem(), Done: i < done, Position: i + 1})
+		}
+	}
+
+	// the positions are set here, the hook finding the last one would query for every task
+	list := fmt.Sprintf("project:%d", p.ID)
+	f.positions[list]++
+	t.Position = f.positions[list]
+
+	return t
+}
+
+// CreateTasks inserts the tasks in batches
+func (f *Factory) CreateTasks(tasks []models.Task) error {
+	if len(tasks) == 0 {
+		return nil
+	}
+
+	return f.db.CreateInBatches(&tasks, batchSize).Error
+}
+
+// Comment creates a comment of the user on the task
+func (f *Factory) Comment(u *models.User, t *models.Task) (*models.Comment, error) {
+	c := f.comment(u, t)
+	return &c, f.db.Create(&c).Error
+}
+
+func (f *Factory) comment(u *models.User, t *models.Task) models.Comment {
+	c := models.Comment{TaskID: t.ID, UserID: u.ID, Body: f.fake.Comment()}
+	c.CreatedAt = f.fake.Time(f.now, f.now.Sub(t.CreatedAt), 0)
+
+	return c
+}
@@ -0,0 +1,156 @@
+package fixtures
+
+import (
+	"gorm.io/gorm"
+	"task-app/models"
+)
+
+// Options are the amounts of the data of Seed
+type Options struct {
+	Users int
+	// Tasks are the tasks of all the users together
+	Tasks int
+	// Seed makes the same data for the same options
+	Seed     int64
+	Password string
+}
+
+// Summary counts the records created by Seed
+type Summary struct {
+	Users      []string
+	Workspaces int
+	Projects   int
+	Tasks      int
+	Comments   int
+}
+
+type projectOf struct {
+	project *models.Project
+	// members are the users allowed to create the tasks of the project
+	members []*models.User
+}
+
+// Seed creates the users with their labels and a personal project each, then workspaces of 3 to 6
+// of the users with a few projects each, and spreads the tasks over the projects with comments on some.
+func Seed(db *gorm.DB, opts Options) (Summary, error) {
+	summary := Summary{}
+	f, err := New(db, opts.Seed, opts.Password)
+	if err != nil {
+		return summary, err
+	}
+
+	users := make([]*models.User, 0, opts.Users)
+	labels := map[uint][]models.Label{}
+	var projects []projectOf
+	for i := 0; i < opts.Users; i++ {
+		u, err := f.User()
+		if err != nil {
+			return summary, err
+		}
+		users = append(users, u)
+		summary.Users = append(summary.Users, u.Username)
+
+		if labels[u.ID], err = f.Labels(u); err != nil {
+			return summary, err
+		}
+		p, err := f.Project(u, nil)
+		if err != nil {
+			return summary, err
+		}
+		projects = append(projects, projectOf{p, []*models.User{u}})
+	}
+
+	for start := 0; start < len(users); {
+		size := f.fake.Between(3, 6)
+		if start+size > len(users) {
+			size = len(users) - start
+		}
+		members := users[start : start+size]
+		start += size
+
+		w, err := f.Workspace(members[0], members[1:]...)
+		if err != nil {
+			return summary, err
+		}
+		summary.Workspaces++
+		for n := f.fake.Between(1, 4); n > 0; n-- {
+			p, err := f.Project(members[f.fake.Intn(len(members))], w)
+			if err != nil {
+				return summary, err
+			}
+			projects = append(projects, projectOf{p, members})
+		}
+	}
+	summary.Projects = len(projects)
+	if len(projects) == 0 {
+		return summary, nil
+	}
+
+	tasks := make([]models.Task, 0, batchSize)
+	flush := func() error {
+		if err := f.CreateTasks(tasks); err != nil {
+			return err
+		}
+		var comments []models.Comment
+		for i := range tasks {
+			// comments on one task out of five, by the members of its project
+			if !f.fake.Chance(0.2) {
+				continue
+			}
+			for _, author := range pickUsers(f, projectMembers(projects, tasks[i].ProjectID), f.fake.Between(1, 3)) {
+				comments = append(comments, f.comment(author, &tasks[i]))
+			}
+		}
+		if len(comments) > 0 {
+			if err := f.db.CreateInBatches(&comments, batchSize).Error; err != nil {
+				return err
+			}
+		}
+		summary.Tasks += len(tasks)
+		summary.Comments += len(comments)
+		tasks = tasks[:0]
+		return nil
+	}
+
+	for i := 0; i < opts.Tasks; i++ {
+		p := projects[f.fake.Intn(len(projects))]
+		creator := p.members[f.fake.Intn(len(p.members))]
+		task := f.Task(creator, p.project, labels[creator.ID])
+		if p.project.WorkspaceID != nil && f.fake.Chance(0.4) {
+			assignee := p.members[f.fake.Intn(len(p.members))].ID
+			task.AssigneeID = &assignee
+		}
+		tasks = append(tasks, task)
+
+		if len(tasks) == batchSize {
+			if err := flush(); err != nil {
+				return summary, err
+			}
+		}
+	}
+
+	return summary, flush()
+}
+
+func projectMembers(projects []projectOf, projectID *uint) []*models.User {
+	for _, p := range projects {
+		if projectID != nil && p.project.ID == *projectID {
+			return p.members
+		}
+	}
+
+	return nil
+}
+
+// pickUsers returns up to n different users
+func pickUsers(f *Factory, users []*models.User, n int) []*models.User {
+	if n > len(users) {
+		n = len(users)
+	}
+	picked := make([]*models.User, 0, n)
+	for _, i := range f.fake.rand.Perm(len(users))[:n] {
+		picked = append(picked, users[i])
+	}
+
+	return picked
+}
@@ -0,0 +1,231 @@
+// Package github is the GitHub integration of the projects: the issues of a repository imported
+// as tasks, the webhooks of GitHub keeping their status in sync, and the completion of the
+// tasks commented on their issues.
+package github
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"task-app/db"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/queue"
+	"time"
+)
+
+const (
+	EventHeader     = "X-GitHub-Event"
+	SignatureHeader = "X-Hub-Signature-256"
+	DeliveryHeader  = "X-GitHub-Delivery"
+
+	// commentJob is the kind of the jobs commenting the completion of a task on its issue
+	commentJob = "github.comment"
+	// maxPages bounds an import, to 1000 issues
+	maxPages = 10
+	perPage  = 100
+)
+
+// apiURL is the REST API, the path is appended
+var apiURL = "https://api.github.com"
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+var inflight sync.WaitGroup
+
+// ErrUnauthorized is the error of a token which cannot read the repository
+var ErrUnauthorized = errors.New("github: the token cannot read the repository")
+
+// ErrNotFound is the error of a repository or an issue which does not exist, or which the token cannot see
+var ErrNotFound = errors.New("github: not found")
+
+// Issue is an issue of a repository
+type Issue struct {
+	Number  int    `json:"number"`
+	Title   string `json:"title"`
+	Body    string `json:"body"`
+	State   string `json:"state"`
+	HTMLURL string `json:"html_url"`
+	// PullRequest is set for the pull requests, which the API lists with the issues
+	PullRequest *struct{} `json:"pull_request,omitempty"`
+}
+
+// IssuesEvent is the body of the issues webhook event
+type IssuesEvent struct {
+	Action     string `json:"action"`
+	Issue      Issue  `json:"issue"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// comment is the payload of a comment job
+type comment struct {
+	IntegrationID uint   `json:"integrationId"`
+	Number        int    `json:"number"`
+	Body          string `json:"body"`
+}
+
+// Setup registers the job commenting the completions, retried as the deliveries of the webhooks
+func Setup() {
+	queue.Register(commentJob, commentOnIssue, queue.Policy{
+		MaxAttempts: 5,
+		Backoff:     2 * time.Second,
+		MaxBackoff:  time.Minute,
+	})
+}
+
+// Repository checks the token can read the repository, owner/name
+func Repository(ctx context.Context, token, repo string) error {
+	return call(ctx, http.MethodGet, token, "/repos/"+repo, nil, nil)
+}
+
+// OpenIssues returns the open issues of the repository, the pull requests left out
+func OpenIssues(ctx context.Context, token, repo string) ([]Issue, error) {
+	var issues []Issue
+	for page := 1; page <= maxPages; page++ {
+		var batch []Issue
+		path := fmt.Sprintf("/repos/%s/issues?state=open&per_page=%d&page=%d", repo, perPage, page)
+		if err := call(ctx, http.MethodGet, token, path, nil, &batch); err != nil {
+			return nil, err
+		}
+		for _, issue := range batch {
+			if issue.PullRequest == nil {
+				issues = append(issues, issue)
+			}
+		}
+		if len(batch) < perPage {
+			break
+		}
+	}
+
+	return issues, nil
+}
+
+// Comment posts a comment on an issue of the repository
+func Comment(ctx context.Context, token, repo string, number int, body string) error {
+	return call(ctx, http.MethodPost, token, fmt.Sprintf("/repos/%s/issues/%d/comments", repo, number), map[string]string{"body": body}, nil)
+}
+
+// call sends a request to the REST API with the token, the body encoded as JSON when not nil
+func call(ctx context.Context, method, token, path string, body, out interface{}) error {
+	var payload bytes.Buffer
+	if body != nil {
+		if err := json.NewEncoder(&payload).Encode(body); err != nil {
+			return err
+		}
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, apiURL+path, &payload)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Accept", "application/vnd.github+json")
+	req.Header.Set("User-Agent", "Tasker-GitHub/1.0")
+	req.Header.Set("Authorization", "Bearer "+token)
+	if body != nil {
+		req.Header.Set("Content-Type", "application/json")
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	switch {
+	case res.StatusCode == http.StatusUnauthorized || res.StatusCode == http.StatusForbidden:
+		return ErrUnauthorized
+	case res.StatusCode == http.StatusNotFound || res.StatusCode == http.StatusGone:
+		return ErrNotFound
+	case res.StatusCode >= 300:
+		return errors.New("github: " + method + " " + strings.SplitN(path, "?", 2)[0] + ": " + res.Status)
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
+
+// Verify checks a webhook delivery was signed with the secret of the integration
+func Verify(secret, signature string, body []byte) error {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	if !hmac.Equal([]byte(signature), []byte("sha256="+hex.EncodeToString(mac.Sum(nil)))) {
+		return errors.New("github: invalid signature")
+	}
+
+	return nil
+}
+
+// Dispatch comments the completion of a task on its issue when its integration asks for it. The
+// issues closed on GitHub, which completed their task, are not commented.
+func Dispatch(e events.Event) {
+	if e.Type != events.TaskCompleted {
+		return
+	}
+
+	inflight.Add(1)
+	go func() {
+		defer inflight.Done()
+
+		link := new(models.GitHubIssue)
+		if res := db.DB.Where("task_id = ? AND state = ?", e.TaskID, models.IssueOpen).Limit(1).Find(link); res.Error != nil || res.RowsAffected == 0 {
+			return
+		}
+		integration := new(models.GitHubIntegration)
+		if res := db.DB.Where("id = ? AND comment_on_completion = ?", link.IntegrationID, true).Limit(1).Find(integration); res.Error != nil || res.RowsAffected == 0 {
+			return
+		}
+
+		actor := "Someone"
+		u := new(models.User)
+		if err := db.DB.First(u, e.ActorID).Error; err == nil {
+			actor = u.Username
+		}
+
+		c := comment{IntegrationID: integration.ID, Number: link.Number, Body: "Completed in Tasker by " + actor + "."}
+		if _, err := queue.Enqueue(commentJob, c); err != nil {
+			logging.Log.Error().Err(err).Uint("task", e.TaskID).Msg("Cannot queue the GitHub comment")
+		}
+	}()
+}
+
+// Stop waits for the dispatches in progress, the queue posts the comments
+func Stop() {
+	inflight.Wait()
+}
+
+// commentOnIssue posts the comment of a job, a token or an issue which is gone fails it for good
+func commentOnIssue(ctx context.Context, job *queue.Job) error {
+	var c comment
+	if err := json.Unmarshal(job.Payload, &c); err != nil {
+		return queue.Permanent(err)
+	}
+
+	// the integration may have been removed since the completion
+	integration := new(models.GitHubIntegration)
+	if res := db.DB.Where("id = ?", c.IntegrationID).Limit(1).Find(integration); res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return nil
+	}
+
+	err := Comment(ctx, integration.Token, integration.Repository, c.Number, c.Body)
+	if errors.Is(err, ErrUnauthorized) || errors.Is(err, ErrNotFound) {
+		logging.Log.Warn().Err(err).Uint("integration", integration.ID).Int("issue", c.Number).Msg("Cannot comment on the GitHub issue")
+		return queue.Permanent(err)
+	}
+
+	return err
+}
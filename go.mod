@@ -3,16 +3,42 @@ module task-app
 go 1.16
 
 require (
-	github.com/asaskevich/govalidator v0.0.0-20210307081110-f21760c49a8d // indirect
-	github.com/dgrijalva/jwt-go v3.2.0+incompatible // indirect
-	github.com/gofiber/fiber/v2 v2.8.0 // indirect
-	github.com/google/uuid v1.2.0 // indirect
+	github.com/99designs/gqlgen v0.17.20
+	github.com/asaskevich/govalidator v0.0.0-20210307081110-f21760c49a8d
+	github.com/beevik/etree v1.1.0
+	github.com/go-gormigrate/gormigrate/v2 v2.0.0
+	github.com/go-playground/validator/v10 v10.9.0
+	github.com/go-sql-driver/mysql v1.6.0
+	github.com/gofiber/fiber/v2 v2.8.0
+	github.com/gofiber/websocket/v2 v2.0.3
+	github.com/golang-jwt/jwt/v5 v5.2.1
+	github.com/google/uuid v1.2.0
+	github.com/graph-gophers/dataloader/v6 v6.0.0
+	github.com/jackc/pgconn v1.8.1
 	github.com/jackc/pgproto3/v2 v2.0.7 // indirect
 	github.com/jackc/pgx/v4 v4.11.0 // indirect
-	github.com/joho/godotenv v1.3.0 // indirect
-	golang.org/x/crypto v0.0.0-20210421170649-83a5a9bb288b // indirect
-	golang.org/x/text v0.3.6 // indirect
-	golang.org/x/xerrors v0.0.0-20200804184101-5ec99f83aff1 // indirect
-	gorm.io/driver/postgres v1.0.8 // indirect
-	gorm.io/gorm v1.21.9 // indirect
+	github.com/joho/godotenv v1.3.0
+	github.com/mattn/go-sqlite3 v1.14.8
+	github.com/rs/zerolog v1.15.0
+	github.com/russellhaering/goxmldsig v1.2.0
+	github.com/russross/blackfriday/v2 v2.1.0
+	github.com/spf13/cobra v1.10.2
+	github.com/uptrace/opentelemetry-go-extra/otelgorm v0.1.2
+	github.com/valyala/fasthttp v1.23.0
+	github.com/vektah/gqlparser/v2 v2.5.1
+	go.opentelemetry.io/otel v1.0.1
+	go.opentelemetry.io/otel/exporters/otlp/otlptrace/otlptracehttp v1.0.1
+	go.opentelemetry.io/otel/sdk v1.0.1
+	go.opentelemetry.io/otel/trace v1.0.1
+	golang.org/x/crypto v0.0.0-20210921155107-089bfa567519
+	golang.org/x/net v0.0.0-20220722155237-a158d28d115b
+	golang.org/x/text v0.3.7
+	google.golang.org/grpc v1.41.0
+	google.golang.org/protobuf v1.28.0
+	gopkg.in/yaml.v3 v3.0.1
+	gorm.io/driver/mysql v1.1.3
+	gorm.io/driver/postgres v1.0.8
+	gorm.io/driver/sqlite v1.1.6
+	gorm.io/gorm v1.21.16
+	gorm.io/plugin/dbresolver v1.1.0
 )
@@ -0,0 +1,242 @@
+package graph
+
+import (
+	"context"
+	"fmt"
+	"github.com/graph-gophers/dataloader/v6"
+	"gorm.io/gorm"
+	"task-app/db"
+	"task-app/graph/model"
+	"task-app/models"
+	"time"
+)
+
+// batchWait is how long a loader waits for the other loads of a batch. The fields of
+// the nodes of a list are resolved concurrently, so their loads come together.
+const batchWait = 10 * time.Millisecond
+
+// loaders batch the loads of the relations of a request, one query by relation and level
+// of the query instead of one by node. They cache what they load for the request.
+type loaders struct {
+	users    *dataloader.Loader
+	projects *dataloader.Loader
+	// projectTasks loads the pages of the tasks of the projects
+	projectTasks *dataloader.Loader
+	// the relations of the tasks and comments, by task or comment id
+	labels   *dataloader.Loader
+	watchers *dataloader.Loader
+	comments *dataloader.Loader
+	mentions *dataloader.Loader
+}
+
+type loadersKey struct{}
+
+func newLoaders(store db.Store, u *models.User) *loaders {
+	l := &loaders{}
+	l.users = batch(func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+		var users []models.User
+		err := tx.Where("id IN ?", ids).Find(&users).Error
+
+		found := make(map[uint]interface{}, len(users))
+		for i := range users {
+			found[users[i].ID] = model.NewUser(&users[i], users[i].ID == u.ID)
+		}
+		return found, err
+	}, store)
+
+	l.projects = batch(func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+		var projects []models.Project
+		err := tx.Scopes(models.AccessibleBy(u)).Where("id IN ?", ids).Find(&projects).Error
+
+		found := make(map[uint]interface{}, len(projects))
+		for i := range projects {
+			found[projects[i].ID] = model.NewProject(&projects[i])
+		}
+		return found, err
+	}, store)
+
+	l.labels = batch(func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+		var rows []struct {
+			models.Label
+			TaskID uint
+		}
+		err := tx.Model(&models.Label{}).
+			Select("labels.*, task_labels.task_id").
+			Joins("JOIN task_labels ON task_labels.label_id = labels.id").
+			Where("task_labels.task_id IN ?", ids).
+			Order("labels.name").
+			Scan(&rows).Error
+
+		found := make(map[uint]interface{}, len(ids))
+		for _, id := range ids {
+			found[id] = []*model.Label{}
+		}
+		for i := range rows {
+			found[rows[i].TaskID] = append(found[rows[i].TaskID].([]*model.Label), model.NewLabel(&rows[i].Label))
+		}
+		return found, err
+	}, store)
+
+	l.watchers = batch(belongingUsers("task_watchers", "task_id", u), store)
+	l.mentions = batch(belongingUsers("comment_mentions", "comment_id", u), store)
+
+	l.comments = batch(func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+		var comments []models.Comment
+		err := tx.Where("task_id IN ?", ids).Order("created_at, id").Find(&comments).Error
+
+		found := make(map[uint]interface{}, len(ids))
+		for _, id := range ids {
+			found[id] = []*model.Comment{}
+		}
+		for i := range comments {
+			cm := &comments[i]
+			found[cm.TaskID] = append(found[cm.TaskID].([]*model.Comment), model.NewComment(cm))
+		}
+		return found, err
+	}, store)
+
+	l.projectTasks = dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		return loadProjectTasks(store.DB().WithContext(ctx), u, keys)
+	}, dataloader.WithWait(batchWait))
+
+	return l
+}
+
+func withLoaders(ctx context.Context, l *loaders) context.Context {
+	return context.WithValue(ctx, loadersKey{}, l)
+}
+
+func loadersOf(ctx context.Context) *loaders {
+	return ctx.Value(loadersKey{}).(*loaders)
+}
+
+// idKey is the key of a loader by id
+type idKey uint
+
+func (k idKey) String() string {
+	return model.ID(uint(k))
+}
+
+func (k idKey) Raw() interface{} {
+	return uint(k)
+}
+
+// load returns the value of the id, nil when it is not found
+func load(ctx context.Context, l *dataloader.Loader, id uint) (interface{}, error) {
+	return l.Load(ctx, idKey(id))()
+}
+
+// batch returns a loader by id from a query of the values of the ids, the values
+// of the missing ids are loaded as nil
+func batch(query func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error), store db.Store) *dataloader.Loader {
+	return dataloader.NewBatchedLoader(func(ctx context.Context, keys dataloader.Keys) []*dataloader.Result {
+		ids := make([]uint, 0, len(keys))
+		for _, k := range keys {
+			ids = append(ids, k.Raw().(uint))
+		}
+
+		found, err := query(store.DB().WithContext(ctx), ids)
+		results := make([]*dataloader.Result, 0, len(keys))
+		for _, id := range ids {
+			results = append(results, &dataloader.Result{Data: found[id], Error: err})
+		}
+		return results
+	}, dataloader.WithWait(batchWait))
+}
+
+// belongingUsers queries the users of a join table by the ids of its other column
+func belongingUsers(table, column string, u *models.User) func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+	return func(tx *gorm.DB, ids []uint) (map[uint]interface{}, error) {
+		var rows []struct {
+			models.User
+			OwnerID uint
+		}
+		err := tx.Model(&models.User{}).
+			Select(fmt.Sprintf("users.*, %s.%s AS owner_id", table, column)).
+			Joins(fmt.Sprintf("JOIN %s ON %s.user_id = users.id", table, table)).
+			Where(fmt.Sprintf("%s.%s IN ?", table, column), ids).
+			Order("users.username").
+			Scan(&rows).Error
+
+		found := make(map[uint]interface{}, len(ids))
+		for _, id := range ids {
+			found[id] = []*model.User{}
+		}
+		for i := range rows {
+			user := model.NewUser(&rows[i].User, rows[i].ID == u.ID)
+			found[rows[i].OwnerID] = append(found[rows[i].OwnerID].([]*model.User), user)
+		}
+		return found, err
+	}
+}
+
+// pageKey is the key of a page of the tasks of a project
+type pageKey struct {
+	ProjectID uint
+	First     int
+	After     string
+}
+
+func (k pageKey) String() string {
+	return fmt.Sprintf("%d/%d/%s", k.ProjectID, k.First, k.After)
+}
+
+func (k pageKey) Raw() interface{} {
+	return k
+}
+
+// loadProjectTasks loads the pages of the keys with one query by page size and cursor, the
+// pages are the first rows of the projects in a window. Each page has a row more than its
+// size when there is a next page.
+func loadProjectTasks(tx *gorm.DB, u *models.User, keys dataloader.Keys) []*dataloader.Result {
+	type page struct {
+		first int
+		after string
+	}
+	projects := map[page][]uint{}
+	for _, k := range keys {
+		key := k.Raw().(pageKey)
+		p := page{key.First, key.After}
+		projects[p] = append(projects[p], key.ProjectID)
+	}
+
+	found := map[pageKey][]*model.Task{}
+	errs := map[page]error{}
+	for p, ids := range projects {
+		after := p.after
+		c, err := parseCursor(&after)
+		if err != nil {
+			errs[p] = err
+			continue
+		}
+
+		ranked := tx.Model(&models.Task{}).
+			Select("tasks.*, ROW_NUMBER() OVER (PARTITION BY tasks.project_id ORDER BY tasks.position, tasks.id) AS page_row").
+			Scopes(models.AccessibleBy(u), afterTask(c)).
+			Where("tasks.project_id IN ?", ids)
+
+		var tasks []models.Task
+		if err := tx.Table("(?) AS tasks", ranked).
+			Where("page_row <= ?", p.first+1).
+			Order("project_id, position, id").
+			Find(&tasks).Error; err != nil {
+			errs[p] = err
+			continue
+		}
+
+		for i := range tasks {
+			key := pageKey{ProjectID: *tasks[i].ProjectID, First: p.first, After: p.after}
+			found[key] = append(found[key], model.NewTask(&tasks[i]))
+		}
+	}
+
+	results := make([]*dataloader.Result, 0, len(keys))
+	for _, k := range keys {
+		key := k.Raw().(pageKey)
+		results = append(results, &dataloader.Result{
+			Data:  found[key],
+			Error: errs[page{key.First, key.After}],
+		})
+	}
+	return results
+}
@@ -0,0 +1,152 @@
+// Package model has the types of the GraphQL schema. The types the resolvers build from
+// the models are written here, gqlgen generates the others in models_gen.go.
+package model
+
+import (
+	"strconv"
+	"task-app/models"
+	"time"
+)
+
+type User struct {
+	ID          string  `json:"id"`
+	Username    string  `json:"username"`
+	DisplayName string  `json:"displayName"`
+	Email       *string `json:"email"`
+}
+
+// NewUser is the view of u, the email is left out unless u is the user signed in
+func NewUser(u *models.User, self bool) *User {
+	user := &User{
+		ID:          ID(u.ID),
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+	}
+	if self {
+		email := u.Email
+		user.Email = &email
+	}
+
+	return user
+}
+
+type Project struct {
+	ID          string    `json:"id"`
+	WorkspaceID *string   `json:"workspaceId"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+	// Key is the id of the project in the store
+	Key uint `json:"-"`
+}
+
+func NewProject(p *models.Project) *Project {
+	return &Project{
+		ID:          ID(p.ID),
+		WorkspaceID: OptionalID(p.WorkspaceID),
+		Title:       p.Title,
+		Description: p.Description,
+		CreatedAt:   p.CreatedAt,
+		UpdatedAt:   p.UpdatedAt,
+		Key:         p.ID,
+	}
+}
+
+// Task is the view of a task, the ids of its relations are kept for the loaders
+type Task struct {
+	ID          string     `json:"id"`
+	WorkspaceID *string    `json:"workspaceId"`
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	Priority    int        `json:"priority"`
+	DueAt       *time.Time `json:"dueAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	Recurrence  string     `json:"recurrence"`
+	Position    int        `json:"position"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	UpdatedAt   time.Time  `json:"updatedAt"`
+
+	Key        uint  `json:"-"`
+	CreatorID  uint  `json:"-"`
+	ProjectID  *uint `json:"-"`
+	AssigneeID *uint `json:"-"`
+}
+
+func NewTask(t *models.Task) *Task {
+	return &Task{
+		ID:          ID(t.ID),
+		WorkspaceID: OptionalID(t.WorkspaceID),
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status,
+		Priority:    t.Priority,
+		DueAt:       t.DueAt,
+		CompletedAt: t.CompletedAt,
+		Recurrence:  t.Recurrence,
+		Position:    t.Position,
+		CreatedAt:   t.CreatedAt,
+		UpdatedAt:   t.UpdatedAt,
+		Key:         t.ID,
+		CreatorID:   t.UserID,
+		ProjectID:   t.ProjectID,
+		AssigneeID:  t.AssigneeID,
+	}
+}
+
+type Label struct {
+	ID    string `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+
+	Key uint `json:"-"`
+}
+
+func NewLabel(l *models.Label) *Label {
+	return &Label{
+		ID:    ID(l.ID),
+		Name:  l.Name,
+		Color: l.Color,
+		Key:   l.ID,
+	}
+}
+
+type Comment struct {
+	ID        string    `json:"id"`
+	Body      string    `json:"body"`
+	CreatedAt time.Time `json:"createdAt"`
+
+	Key      uint `json:"-"`
+	AuthorID uint `json:"-"`
+}
+
+func NewComment(cm *models.Comment) *Comment {
+	return &Comment{
+		ID:        ID(cm.ID),
+		Body:      cm.Body,
+		CreatedAt: cm.CreatedAt,
+		Key:       cm.ID,
+		AuthorID:  cm.UserID,
+	}
+}
+
+// ID is the GraphQL id of a record, its id in the store as a string
+func ID(id uint) string {
+	return strconv.FormatUint(uint64(id), 10)
+}
+
+func OptionalID(id *uint) *string {
+	if id == nil {
+		return nil
+	}
+
+	s := ID(*id)
+	return &s
+}
+
+// ParseID is the id in the store of a GraphQL id
+func ParseID(id string) (uint, error) {
+	n, err := strconv.ParseUint(id, 10, 64)
+	return uint(n), err
+}
@@ -0,0 +1,46 @@
+// Code generated by github.com/99designs/gqlgen, DO NOT EDIT.
+
+package model
+
+type LabelConnection struct {
+	Edges    []*LabelEdge `json:"edges"`
+	PageInfo *PageInfo    `json:"pageInfo"`
+}
+
+type LabelEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Label `json:"node"`
+}
+
+type PageInfo struct {
+	HasNextPage bool    `json:"hasNextPage"`
+	EndCursor   *string `json:"endCursor"`
+}
+
+type ProjectConnection struct {
+	Edges    []*ProjectEdge `json:"edges"`
+	PageInfo *PageInfo      `json:"pageInfo"`
+}
+
+type ProjectEdge struct {
+	Cursor string   `json:"cursor"`
+	Node   *Project `json:"node"`
+}
+
+type TaskConnection struct {
+	Edges    []*TaskEdge `json:"edges"`
+	PageInfo *PageInfo   `json:"pageInfo"`
+}
+
+type TaskEdge struct {
+	Cursor string `json:"cursor"`
+	Node   *Task  `json:"node"`
+}
+
+type TaskFilter struct {
+	WorkspaceID *string  `json:"workspaceId"`
+	ProjectID   *string  `json:"projectId"`
+	AssigneeID  *string  `json:"assigneeId"`
+	Status      *string  `json:"status"`
+	Labels      []string `json:"labels"`
+}
@@ -0,0 +1,132 @@
+package graph
+
+import (
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"task-app/graph/model"
+)
+
+const (
+	defaultPageSize = 50
+	maxPageSize     = 100
+)
+
+var errInvalidCursor = errors.New("Invalid cursor")
+
+// pageSize is the number of nodes asked by first, bounded as the REST pages are
+func pageSize(first *int) int {
+	if first == nil || *first < 1 {
+		return defaultPageSize
+	}
+	if *first > maxPageSize {
+		return maxPageSize
+	}
+
+	return *first
+}
+
+// cursor is the place of a node in its connection. The tasks are in the order of
+// their positions, the other nodes in the order of their ids.
+type cursor struct {
+	Position int
+	ID       uint
+}
+
+func (c cursor) String() string {
+	return base64.RawURLEncoding.EncodeToString([]byte(fmt.Sprintf("%d:%d", c.Position, c.ID)))
+}
+
+// parseCursor reads the after argument, a missing cursor is the start of the connection
+func parseCursor(after *string) (*cursor, error) {
+	if after == nil || *after == "" {
+		return nil, nil
+	}
+
+	raw, err := base64.RawURLEncoding.DecodeString(*after)
+	if err != nil {
+		return nil, errInvalidCursor
+	}
+
+	c := new(cursor)
+	if _, err := fmt.Sscanf(string(raw), "%d:%d", &c.Position, &c.ID); err != nil {
+		return nil, errInvalidCursor
+	}
+
+	return c, nil
+}
+
+// afterID scopes a query to the rows after the cursor, in the order of the ids
+func afterID(table string, c *cursor) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Order(table + ".id")
+		if c == nil {
+			return tx
+		}
+
+		return tx.Where(table+".id > ?", c.ID)
+	}
+}
+
+// afterTask scopes a query of the tasks to the ones after the cursor, the order is not set
+// since the tasks of the projects are paged together
+func afterTask(c *cursor) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if c == nil {
+			return tx
+		}
+
+		return tx.Where("tasks.position > ? OR (tasks.position = ? AND tasks.id > ?)", c.Position, c.Position, c.ID)
+	}
+}
+
+// The connections are built from one row more than the page, which tells if there is a next page
+
+func taskConnection(tasks []*model.Task, size int) *model.TaskConnection {
+	conn := &model.TaskConnection{Edges: []*model.TaskEdge{}, PageInfo: &model.PageInfo{}}
+	for i, t := range tasks {
+		if i == size {
+			conn.PageInfo.HasNextPage = true
+			break
+		}
+
+		cur := cursor{Position: t.Position, ID: t.Key}.String()
+		conn.Edges = append(conn.Edges, &model.TaskEdge{Cursor: cur, Node: t})
+		conn.PageInfo.EndCursor = &cur
+	}
+
+	return conn
+}
+
+func projectConnection(projects []*model.Project, size int) *model.ProjectConnection {
+	conn := &model.ProjectConnection{Edges: []*model.ProjectEdge{}, PageInfo: &model.PageInfo{}}
+	for i, p := range projects {
+		if i == size {
+			conn.PageInfo.HasNextPage = true
+			break
+		}
+
+		cur := cursor{ID: p.Key}.String()
+		conn.Edges = append(conn.Edges, &model.ProjectEdge{Cursor: cur, Node: p})
+		conn.PageInfo.EndCursor = &cur
+	}
+
+	return conn
+}
+
+func labelConnection(labels []*model.Label, size int) *model.LabelConnection {
+	conn := &model.LabelConnection{Edges: []*model.LabelEdge{}, PageInfo: &model.PageInfo{}}
+	for i, l := range labels {
+		if i == size {
+			conn.PageInfo.HasNextPage = true
+			break
+		}
+
+		cur := cursor{ID: l.Key}.String()
+		conn.Edges = append(conn.Edges, &model.LabelEdge{Cursor: cur, Node: l})
+		conn.PageInfo.EndCursor = &cur
+	}
+
+	return conn
+}
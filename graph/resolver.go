@@ -0,0 +1,72 @@
+// Package graph serves the GraphQL API, the resolvers are generated by gqlgen from schema.graphqls
+package graph
+
+//go:generate go run github.com/99designs/gqlgen@v0.17.20 generate
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"task-app/db"
+	"task-app/graph/model"
+	"task-app/models"
+)
+
+// UserKey is the key of the user signed in among the values of the request context.
+// The router sets it as a local of the fiber context, which is the context of the adapted request.
+const UserKey = "graphql.user"
+
+// ContextKey is the key of the context the queries of the request run with, done at its timeout.
+// The adapted request has no deadline of its own.
+const ContextKey = "graphql.context"
+
+// Resolver resolves the queries from the store, the relations through the loaders of the request
+type Resolver struct {
+	store db.Store
+}
+
+func currentUser(ctx context.Context) *models.User {
+	return ctx.Value(UserKey).(*models.User)
+}
+
+// whereID narrows a query to the rows where the column is the GraphQL id
+func whereID(query *gorm.DB, column, id string) (*gorm.DB, error) {
+	n, err := model.ParseID(id)
+	if err != nil {
+		return nil, err
+	}
+
+	return query.Where(column+" = ?", n), nil
+}
+
+// filterTasks narrows a query of the tasks as TaskFilter narrows the REST list
+func filterTasks(query *gorm.DB, f *model.TaskFilter) (*gorm.DB, error) {
+	var err error
+	columns := map[string]*string{
+		"tasks.workspace_id": f.WorkspaceID,
+		"tasks.project_id":   f.ProjectID,
+		"tasks.assignee_id":  f.AssigneeID,
+	}
+	for column, id := range columns {
+		if id == nil {
+			continue
+		}
+		if query, err = whereID(query, column, *id); err != nil {
+			return nil, err
+		}
+	}
+
+	if f.Status != nil {
+		query = query.Where("tasks.status = ?", *f.Status)
+	}
+	if len(f.Labels) > 0 {
+		query = query.Where(
+			"tasks.id IN (?)",
+			query.Session(&gorm.Session{NewDB: true}).Table("task_labels").
+				Select("task_labels.task_id").
+				Joins("JOIN labels ON labels.id = task_labels.label_id").
+				Where("labels.name IN ?", f.Labels),
+		)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,226 @@
+package graph
+
+// This file will be automatically regenerated based on the schema, any resolver implementations
+// will be copied through when generating and any unknown code will be moved to the end.
+
+import (
+	"context"
+	"task-app/graph/model"
+	"task-app/models"
+)
+
+// Author is the resolver for the author field.
+func (r *commentResolver) Author(ctx context.Context, obj *model.Comment) (*model.User, error) {
+	v, err := load(ctx, loadersOf(ctx).users, obj.AuthorID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(*model.User), nil
+}
+
+// Mentions is the resolver for the mentions field.
+func (r *commentResolver) Mentions(ctx context.Context, obj *model.Comment) ([]*model.User, error) {
+	v, err := load(ctx, loadersOf(ctx).mentions, obj.Key)
+	users, _ := v.([]*model.User)
+	return users, err
+}
+
+// Tasks is the resolver for the tasks field.
+func (r *projectResolver) Tasks(ctx context.Context, obj *model.Project, first *int, after *string) (*model.TaskConnection, error) {
+	size := pageSize(first)
+	key := pageKey{ProjectID: obj.Key, First: size}
+	if after != nil {
+		key.After = *after
+	}
+
+	v, err := loadersOf(ctx).projectTasks.Load(ctx, key)()
+	if err != nil {
+		return nil, err
+	}
+	tasks, _ := v.([]*model.Task)
+	return taskConnection(tasks, size), nil
+}
+
+// Me is the resolver for the me field.
+func (r *queryResolver) Me(ctx context.Context) (*model.User, error) {
+	return model.NewUser(currentUser(ctx), true), nil
+}
+
+// Task is the resolver for the task field.
+func (r *queryResolver) Task(ctx context.Context, id string) (*model.Task, error) {
+	taskID, err := model.ParseID(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	task := new(models.Task)
+	res := r.store.DB().WithContext(ctx).Scopes(models.AccessibleBy(currentUser(ctx))).Where("id = ?", taskID).Limit(1).Find(task)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil, res.Error
+	}
+	return model.NewTask(task), nil
+}
+
+// Tasks is the resolver for the tasks field.
+func (r *queryResolver) Tasks(ctx context.Context, filter *model.TaskFilter, first *int, after *string) (*model.TaskConnection, error) {
+	c, err := parseCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.store.DB().WithContext(ctx).Scopes(models.AccessibleBy(currentUser(ctx)), afterTask(c))
+	if filter != nil {
+		if query, err = filterTasks(query, filter); err != nil {
+			return nil, err
+		}
+	}
+
+	size := pageSize(first)
+	var tasks []models.Task
+	if err := query.Order("tasks.position, tasks.id").Limit(size + 1).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*model.Task, 0, len(tasks))
+	for i := range tasks {
+		nodes = append(nodes, model.NewTask(&tasks[i]))
+	}
+	return taskConnection(nodes, size), nil
+}
+
+// Project is the resolver for the project field.
+func (r *queryResolver) Project(ctx context.Context, id string) (*model.Project, error) {
+	projectID, err := model.ParseID(id)
+	if err != nil {
+		return nil, nil
+	}
+
+	v, err := load(ctx, loadersOf(ctx).projects, projectID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(*model.Project), nil
+}
+
+// Projects is the resolver for the projects field.
+func (r *queryResolver) Projects(ctx context.Context, workspaceID *string, first *int, after *string) (*model.ProjectConnection, error) {
+	c, err := parseCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	query := r.store.DB().WithContext(ctx).Scopes(models.AccessibleBy(currentUser(ctx)), afterID("projects", c))
+	if workspaceID != nil {
+		if query, err = whereID(query, "projects.workspace_id", *workspaceID); err != nil {
+			return nil, err
+		}
+	}
+
+	size := pageSize(first)
+	var projects []models.Project
+	if err := query.Limit(size + 1).Find(&projects).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*model.Project, 0, len(projects))
+	for i := range projects {
+		nodes = append(nodes, model.NewProject(&projects[i]))
+	}
+	return projectConnection(nodes, size), nil
+}
+
+// Labels is the resolver for the labels field.
+func (r *queryResolver) Labels(ctx context.Context, first *int, after *string) (*model.LabelConnection, error) {
+	c, err := parseCursor(after)
+	if err != nil {
+		return nil, err
+	}
+
+	size := pageSize(first)
+	var labels []models.Label
+	if err := r.store.DB().WithContext(ctx).
+		Scopes(models.OwnedBy(currentUser(ctx)), afterID("labels", c)).
+		Limit(size + 1).
+		Find(&labels).Error; err != nil {
+		return nil, err
+	}
+
+	nodes := make([]*model.Label, 0, len(labels))
+	for i := range labels {
+		nodes = append(nodes, model.NewLabel(&labels[i]))
+	}
+	return labelConnection(nodes, size), nil
+}
+
+// Project is the resolver for the project field.
+func (r *taskResolver) Project(ctx context.Context, obj *model.Task) (*model.Project, error) {
+	if obj.ProjectID == nil {
+		return nil, nil
+	}
+
+	v, err := load(ctx, loadersOf(ctx).projects, *obj.ProjectID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(*model.Project), nil
+}
+
+// Creator is the resolver for the creator field.
+func (r *taskResolver) Creator(ctx context.Context, obj *model.Task) (*model.User, error) {
+	v, err := load(ctx, loadersOf(ctx).users, obj.CreatorID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(*model.User), nil
+}
+
+// Assignee is the resolver for the assignee field.
+func (r *taskResolver) Assignee(ctx context.Context, obj *model.Task) (*model.User, error) {
+	if obj.AssigneeID == nil {
+		return nil, nil
+	}
+
+	v, err := load(ctx, loadersOf(ctx).users, *obj.AssigneeID)
+	if err != nil || v == nil {
+		return nil, err
+	}
+	return v.(*model.User), nil
+}
+
+// Watchers is the resolver for the watchers field.
+func (r *taskResolver) Watchers(ctx context.Context, obj *model.Task) ([]*model.User, error) {
+	v, err := load(ctx, loadersOf(ctx).watchers, obj.Key)
+	users, _ := v.([]*model.User)
+	return users, err
+}
+
+// Labels is the resolver for the labels field.
+func (r *taskResolver) Labels(ctx context.Context, obj *model.Task) ([]*model.Label, error) {
+	v, err := load(ctx, loadersOf(ctx).labels, obj.Key)
+	labels, _ := v.([]*model.Label)
+	return labels, err
+}
+
+// Comments is the resolver for the comments field.
+func (r *taskResolver) Comments(ctx context.Context, obj *model.Task) ([]*model.Comment, error) {
+	v, err := load(ctx, loadersOf(ctx).comments, obj.Key)
+	comments, _ := v.([]*model.Comment)
+	return comments, err
+}
+
+// Comment returns CommentResolver implementation.
+func (r *Resolver) Comment() CommentResolver { return &commentResolver{r} }
+
+// Project returns ProjectResolver implementation.
+func (r *Resolver) Project() ProjectResolver { return &projectResolver{r} }
+
+// Query returns QueryResolver implementation.
+func (r *Resolver) Query() QueryResolver { return &queryResolver{r} }
+
+// Task returns TaskResolver implementation.
+func (r *Resolver) Task() TaskResolver { return &taskResolver{r} }
+
+type commentResolver struct{ *Resolver }
+type projectResolver struct{ *Resolver }
+type queryResolver struct{ *Resolver }
+type taskResolver struct{ *Resolver }
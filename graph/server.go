@@ -0,0 +1,49 @@
+package graph
+
+import (
+	"context"
+	"github.com/99designs/gqlgen/graphql/handler"
+	"github.com/99designs/gqlgen/graphql/handler/extension"
+	"github.com/99designs/gqlgen/graphql/handler/lru"
+	"github.com/99designs/gqlgen/graphql/handler/transport"
+	"net/http"
+	"task-app/db"
+	"task-app/graph/model"
+	"task-app/models"
+)
+
+// complexityLimit bounds the cost of a query, a connection costs its page size times its nodes
+const complexityLimit = 50000
+
+// NewHandler returns the handler of the GraphQL requests, the user signed in must be set at UserKey
+func NewHandler(store db.Store) http.Handler {
+	cfg := Config{Resolvers: &Resolver{store: store}}
+	cfg.Complexity.Query.Tasks = func(child int, _ *model.TaskFilter, first *int, _ *string) int {
+		return pageSize(first) * child
+	}
+	cfg.Complexity.Query.Projects = func(child int, _ *string, first *int, _ *string) int {
+		return pageSize(first) * child
+	}
+	cfg.Complexity.Query.Labels = func(child int, first *int, _ *string) int {
+		return pageSize(first) * child
+	}
+	cfg.Complexity.Project.Tasks = func(child int, first *int, _ *string) int {
+		return pageSize(first) * child
+	}
+
+	srv := handler.New(NewExecutableSchema(cfg))
+	srv.AddTransport(transport.GET{})
+	srv.AddTransport(transport.POST{})
+	srv.SetQueryCache(lru.New(1000))
+	srv.Use(extension.Introspection{})
+	srv.Use(extension.FixedComplexityLimit(complexityLimit))
+
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		u := r.Context().Value(UserKey).(*models.User)
+		ctx := r.Context()
+		if parent, ok := ctx.Value(ContextKey).(context.Context); ok {
+			ctx = context.WithValue(parent, UserKey, u)
+		}
+		srv.ServeHTTP(w, r.WithContext(withLoaders(ctx, newLoaders(store, u))))
+	})
+}
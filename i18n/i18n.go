@@ -0,0 +1,107 @@
+package i18n
+
+import (
+	"embed"
+	"encoding/json"
+	"fmt"
+	"golang.org/x/text/language"
+	"path"
+	"strings"
+)
+
+// The catalogs are the JSON files of locales, one per language named by its tag, e.g. de.json.
+// A catalog maps the English messages to their translation, the messages with arguments are
+// fmt formats and the layouts of the dates are messages too, e.g. "Mon Jan 2".
+// A language is added with its file, the messages missing from it are rendered in English.
+//
+//go:embed locales/*.json
+var files embed.FS
+
+// Printer renders the messages in a language
+type Printer struct {
+	tag      language.Tag
+	messages map[string]string
+}
+
+// English renders the messages as they are written
+var English = &Printer{tag: language.English}
+
+var (
+	printers = []*Printer{English}
+	matcher  language.Matcher
+)
+
+func init() {
+	entries, err := files.ReadDir("locales")
+	if err != nil {
+		panic(err)
+	}
+
+	for _, entry := range entries {
+		data, err := files.ReadFile(path.Join("locales", entry.Name()))
+		if err != nil {
+			panic(err)
+		}
+		p := &Printer{tag: language.MustParse(strings.TrimSuffix(entry.Name(), ".json"))}
+		if err := json.Unmarshal(data, &p.messages); err != nil {
+			panic(fmt.Sprintf("i18n: invalid catalog %s: %v", entry.Name(), err))
+		}
+		printers = append(printers, p)
+	}
+
+	tags := make([]language.Tag, 0, len(printers))
+	for _, p := range printers {
+		tags = append(tags, p.tag)
+	}
+	// the first tag is the one matched when none is supported
+	matcher = language.NewMatcher(tags)
+}
+
+// For returns the printer of the closest language to the locale, a BCP 47 tag like de-AT.
+// It is English for an empty or unsupported locale.
+func For(locale string) *Printer {
+	tag, err := language.Parse(locale)
+	if err != nil {
+		return English
+	}
+
+	return match(tag)
+}
+
+// FromHeader returns the printer of the language preferred by an Accept-Language header
+func FromHeader(header string) *Printer {
+	tags, _, err := language.ParseAcceptLanguage(header)
+	if err != nil || len(tags) == 0 {
+		return English
+	}
+
+	return match(tags...)
+}
+
+func match(tags ...language.Tag) *Printer {
+	_, i, confidence := matcher.Match(tags...)
+	if confidence == language.No {
+		return English
+	}
+
+	return printers[i]
+}
+
+// Lang returns the tag of the language, e.g. de
+func (p *Printer) Lang() string {
+	return p.tag.String()
+}
+
+// Text returns the translation of the message, the message itself when it has none
+func (p *Printer) Text(msg string) string {
+	if t, ok := p.messages[msg]; ok {
+		return t
+	}
+
+	return msg
+}
+
+// Sprintf formats the arguments with the translation of the format
+func (p *Printer) Sprintf(format string, args ...interface{}) string {
+	return fmt.Sprintf(p.Text(format), args...)
+}
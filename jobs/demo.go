@@ -0,0 +1,125 @@
+package jobs
+
+import (
+	"gorm.io/gorm"
+	"strconv"
+	"task-app/avatars"
+	"task-app/db"
+	"task-app/models"
+	"task-app/storage"
+	"time"
+)
+
+// DemoCleanup removes the demo accounts once they expire with all their data, checking once per interval
+func DemoCleanup(every time.Duration) Job {
+	return Job{Name: "demo_cleanup", Every: every, Unit: "accounts", Run: PurgeDemoAccounts}
+}
+
+// PurgeDemoAccounts permanently deletes the demo accounts expired at the time
+func PurgeDemoAccounts(now time.Time) (int, error) {
+	var users []models.User
+	if err := db.DB.Unscoped().Where("demo_expires_at < ?", now).Limit(100).Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	for _, u := range users {
+		if err := PurgeUser(&u); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(users), nil
+}
+
+// PurgeUser permanently deletes an account with everything it created: its tasks, projects and labels,
+// the workspaces it owns with their content, its sessions, keys, links and notifications
+func PurgeUser(u *models.User) error {
+	var workspaceIDs []uint
+	if err := db.DB.Unscoped().Model(&models.Workspace{}).Where("owner_id = ?", u.ID).Pluck("id", &workspaceIDs).Error; err != nil {
+		return err
+	}
+
+	var tasks []models.Task
+	query := db.DB.Unscoped().Where("user_id = ?", u.ID)
+	if len(workspaceIDs) > 0 {
+		query = query.Or("workspace_id IN ?", workspaceIDs)
+	}
+	if err := query.Find(&tasks).Error; err != nil {
+		return err
+	}
+	for _, t := range tasks {
+		if err := PurgeTask(&t); err != nil {
+			return err
+		}
+	}
+
+	var exports []models.DataExport
+	db.DB.Where("user_id = ? AND storage_key <> ''", u.ID).Find(&exports)
+	for _, e := range exports {
+		if err := storage.Store.Delete(e.StorageKey); err != nil {
+			return err
+		}
+	}
+
+	if err := db.DB.Transaction(func(tx *gorm.DB) error {
+		// the GitHub integrations linked by the user, and the ones of the projects deleted with the account
+		projects := tx.Session(&gorm.Session{NewDB: true}).Unscoped().Model(&models.Project{}).Select("id").Where("user_id = ?", u.ID)
+		if len(workspaceIDs) > 0 {
+			projects = projects.Or("workspace_id IN ?", workspaceIDs)
+		}
+		if err := tx.Where("created_by = ? OR project_id IN (?)", u.ID, projects).Delete(&models.GitHubIntegration{}).Error; err != nil {
+			return err
+		}
+
+		if len(workspaceIDs) > 0 {
+			for _, model := range []interface{}{&models.Project{}, &models.Invite{}, &models.Membership{}, &models.SlackInstallation{}} {
+				if err := tx.Unscoped().Where("workspace_id IN ?", workspaceIDs).Delete(model).Error; err != nil {
+					return err
+				}
+			}
+			if err := tx.Unscoped().Where("id IN ?", workspaceIDs).Delete(&models.Workspace{}).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, q := range []string{
+			"DELETE FROM task_labels WHERE label_id IN (SELECT id FROM labels WHERE user_id = ?)",
+			"DELETE FROM task_watchers WHERE user_id = ?",
+			"DELETE FROM comment_mentions WHERE user_id = ?",
+			"DELETE FROM comment_mentions WHERE comment_id IN (SELECT id FROM comments WHERE user_id = ?)",
+			"DELETE FROM webhook_deliveries WHERE webhook_id IN (SELECT id FROM webhooks WHERE user_id = ?)",
+		} {
+			if err := tx.Exec(q, u.ID).Error; err != nil {
+				return err
+			}
+		}
+
+		for _, model := range []interface{}{
+			&models.Project{}, &models.Label{}, &models.Comment{}, &models.Membership{}, &models.Template{},
+			&models.TimeEntry{}, &models.Notification{}, &models.NotificationPreference{}, &models.APIKey{},
+			&models.Share{}, &models.Webhook{}, &models.OAuthAccount{}, &models.BackupCode{},
+			&models.TelegramAccount{}, &models.DataExport{}, &models.Filter{}, &models.PushDevice{}, &models.MagicLink{},
+			&models.SSOIdentity{}, &models.StreamTicket{},
+		} {
+			if err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("actor_id = ?", u.ID).Delete(&models.Activity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("author_id = ?", u.ID).Delete(&models.TaskRevision{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("issuer = ?", strconv.Itoa(int(u.ID))).Delete(&models.Claims{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Unscoped().Delete(u).Error
+	}); err != nil {
+		return err
+	}
+
+	avatars.Remove(u.AvatarKey)
+	return nil
+}
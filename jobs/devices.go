@@ -0,0 +1,22 @@
+package jobs
+
+import (
+	"task-app/db"
+	"task-app/models"
+	"time"
+)
+
+// StaleDeviceAge is how long a device can go without registering before it is removed, FCM
+// treats the tokens of the devices not seen for 270 days as stale
+var StaleDeviceAge = 270 * 24 * time.Hour
+
+// DeviceCleanup removes the push devices the apps stopped registering, checking once per interval
+func DeviceCleanup(every time.Duration) Job {
+	return Job{Name: "device_cleanup", Every: every, Unit: "devices", Run: PurgeStaleDevices}
+}
+
+// PurgeStaleDevices deletes the devices last seen StaleDeviceAge before the time
+func PurgeStaleDevices(now time.Time) (int, error) {
+	res := db.DB.Where("last_seen_at < ?", now.Add(-StaleDeviceAge)).Delete(&models.PushDevice{})
+	return int(res.RowsAffected), res.Error
+}
@@ -0,0 +1,32 @@
+package jobs
+
+import (
+	"task-app/db"
+	"task-app/models"
+	"task-app/storage"
+	"time"
+)
+
+// ExportPurge removes the archives of the data exports once they expire, checking once per interval
+func ExportPurge(every time.Duration) Job {
+	return Job{Name: "export_purge", Every: every, Unit: "exports", Run: PurgeExports}
+}
+
+// PurgeExports deletes the exports expired at the time with their archive
+func PurgeExports(now time.Time) (int, error) {
+	var exports []models.DataExport
+	if err := db.DB.Where("expires_at < ?", now).Limit(500).Find(&exports).Error; err != nil {
+		return 0, err
+	}
+
+	for _, e := range exports {
+		if err := storage.Store.Delete(e.StorageKey); err != nil {
+			return 0, err
+		}
+		if err := db.DB.Delete(&e).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return len(exports), nil
+}
@@ -0,0 +1,20 @@
+package jobs
+
+import (
+	"task-app/db"
+	"task-app/models"
+	"time"
+)
+
+// IdempotencyPurge removes the idempotency keys older than their retention, checking once per interval
+func IdempotencyPurge(every time.Duration) Job {
+	return Job{Name: "idempotency_purge", Every: every, Unit: "keys", Run: func(now time.Time) (int, error) {
+		return PurgeIdempotencyKeys(now.Add(-models.IdempotencyRetention))
+	}}
+}
+
+// PurgeIdempotencyKeys deletes the keys stored before the time
+func PurgeIdempotencyKeys(before time.Time) (int, error) {
+	res := db.DB.Where("created_at < ?", before).Delete(&models.IdempotencyKey{})
+	return int(res.RowsAffected), res.Error
+}
@@ -0,0 +1,44 @@
+package jobs
+
+import (
+	"task-app/db"
+	"task-app/events"
+	"task-app/models"
+	"time"
+)
+
+// OverdueMarking publishes TaskOverdue for the open tasks past their due date, checking once per interval
+func OverdueMarking(every time.Duration) Job {
+	return Job{Name: "overdue_marking", Every: every, Unit: "tasks", Run: MarkOverdue}
+}
+
+// MarkOverdue marks the open tasks due before the time as overdue, once per due date:
+// a task is marked again when it is due again and the date passes
+func MarkOverdue(now time.Time) (int, error) {
+	var tasks []models.Task
+	if err := db.DB.
+		Where("due_at <= ? AND status <> ?", now, models.StatusDone).
+		Where("overdue_for IS NULL OR overdue_for <> due_at").
+		Limit(500).
+		Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	for _, t := range tasks {
+		if err := db.DB.Model(&t).UpdateColumn("overdue_for", t.DueAt).Error; err != nil {
+			return 0, err
+		}
+
+		// nobody made the task overdue, the event has no actor
+		events.Publish(events.Event{
+			Type:        events.TaskOverdue,
+			TaskID:      t.ID,
+			TargetID:    t.ID,
+			OwnerID:     t.UserID,
+			WorkspaceID: t.WorkspaceID,
+			Payload:     t.Api(),
+		})
+	}
+
+	return len(tasks), nil
+}
@@ -0,0 +1,99 @@
+package jobs
+
+import (
+	"gorm.io/gorm"
+	"os"
+	"strconv"
+	"sync"
+	"task-app/db"
+	"task-app/metrics"
+	"task-app/models"
+	"task-app/storage"
+	"time"
+)
+
+var (
+	running  sync.WaitGroup
+	stopping = make(chan struct{})
+	stopOnce sync.Once
+)
+
+// Stop tells the background jobs to stop and waits for the runs in progress
+func Stop() {
+	stopOnce.Do(func() { close(stopping) })
+	running.Wait()
+}
+
+// TrashRetention is how long deleted tasks are kept in the trash
+var TrashRetention = 30 * 24 * time.Hour
+
+// TrashPurge removes the tasks which stayed in the trash longer than
+// TRASH_RETENTION_DAYS (30 by default), checking once per interval
+func TrashPurge(every time.Duration) Job {
+	if days, err := strconv.Atoi(os.Getenv("TRASH_RETENTION_DAYS")); err == nil && days > 0 {
+		TrashRetention = time.Duration(days) * 24 * time.Hour
+	}
+
+	return Job{Name: "trash_purge", Every: every, Unit: "tasks", Run: func(now time.Time) (int, error) {
+		return PurgeTrash(now.Add(-TrashRetention))
+	}}
+}
+
+func observeRun(job string, start time.Time, err error) {
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.JobRuns.Inc(job, result)
+	metrics.JobDuration.Observe(time.Since(start).Seconds(), job)
+}
+
+// PurgeTrash permanently deletes the tasks deleted before the time, with everything attached to them
+func PurgeTrash(before time.Time) (int, error) {
+	var tasks []models.Task
+	if err := db.DB.Unscoped().Where("deleted_at < ?", before).Limit(500).Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	for _, t := range tasks {
+		if err := PurgeTask(&t); err != nil {
+			return 0, err
+		}
+	}
+
+	return len(tasks), nil
+}
+
+// PurgeTask permanently deletes a task with its comments, attachments and relations
+func PurgeTask(t *models.Task) error {
+	var attachments []models.Attachment
+	db.DB.Unscoped().Where("task_id = ?", t.ID).Find(&attachments)
+	for _, a := range attachments {
+		if err := storage.Store.Delete(a.StorageKey); err != nil {
+			return err
+		}
+	}
+
+	return db.DB.Transaction(func(tx *gorm.DB) error {
+		for _, q := range []string{
+			"DELETE FROM comment_mentions WHERE comment_id IN (SELECT id FROM comments WHERE task_id = ?)",
+			"DELETE FROM task_labels WHERE task_id = ?",
+			"DELETE FROM task_watchers WHERE task_id = ?",
+		} {
+			if err := tx.Exec(q, t.ID).Error; err != nil {
+				return err
+			}
+		}
+		if err := tx.Where("blocker_id = ? OR blocked_id = ?", t.ID, t.ID).Delete(&models.TaskDependency{}).Error; err != nil {
+			return err
+		}
+
+		for _, model := range []interface{}{&models.Comment{}, &models.Attachment{}, &models.ChecklistItem{}, &models.TimeEntry{}, &models.Notification{}, &models.TaskRevision{}, &models.CalendarObject{}, &models.GitHubIssue{}} {
+			if err := tx.Unscoped().Where("task_id = ?", t.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Unscoped().Delete(t).Error
+	})
+}
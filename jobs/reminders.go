@@ -0,0 +1,57 @@
+package jobs
+
+import (
+	"os"
+	"strconv"
+	"task-app/db"
+	"task-app/models"
+	"task-app/notifications"
+	"time"
+)
+
+// ReminderLead is how long before their due date the assignees are reminded of the tasks
+var ReminderLead = 24 * time.Hour
+
+// DueReminders reminds the assignees of the tasks due within DUE_REMINDER_HOURS
+// (24 by default), checking once per interval
+func DueReminders(n *notifications.Notifier, every time.Duration) Job {
+	if hours, err := strconv.Atoi(os.Getenv("DUE_REMINDER_HOURS")); err == nil && hours > 0 {
+		ReminderLead = time.Duration(hours) * time.Hour
+	}
+
+	return Job{Name: "due_reminders", Every: every, Unit: "tasks", Run: func(now time.Time) (int, error) {
+		return RemindDue(n, now)
+	}}
+}
+
+// RemindDue reminds of the open tasks due within the lead, once per due date:
+// a task is reminded again when its due date changes
+func RemindDue(n *notifications.Notifier, now time.Time) (int, error) {
+	var tasks []models.Task
+	if err := db.DB.
+		Where("due_at > ? AND due_at <= ? AND status <> ?", now, now.Add(ReminderLead), models.StatusDone).
+		Where("reminded_for IS NULL OR reminded_for <> due_at").
+		Limit(500).
+		Find(&tasks).Error; err != nil {
+		return 0, err
+	}
+
+	for _, t := range tasks {
+		if err := n.RemindDue(&t); err != nil {
+			return 0, err
+		}
+		if err := db.DB.Model(&t).UpdateColumn("reminded_for", t.DueAt).Error; err != nil {
+			return 0, err
+		}
+	}
+
+	return len(tasks), nil
+}
+
+// DailyDigest emails the daily digest once the hour of the day has passed in the zone of each user,
+// checking once per interval
+func DailyDigest(n *notifications.Notifier, hour int, every time.Duration) Job {
+	return Job{Name: "daily_digest", Every: every, Unit: "users", Run: func(now time.Time) (int, error) {
+		return n.SendDigests(now, hour)
+	}}
+}
@@ -0,0 +1,217 @@
+package jobs
+
+import (
+	"errors"
+	"math/rand"
+	"sort"
+	"sync"
+	"task-app/config"
+	"task-app/logging"
+	"task-app/models"
+	"time"
+)
+
+// ErrUnknownJob is returned for a name no job was scheduled with
+var ErrUnknownJob = errors.New("unknown job")
+
+// ErrJobRunning is returned when a job is asked to run while it runs
+var ErrJobRunning = errors.New("the job is running")
+
+// Job is a periodic job of the scheduler
+type Job struct {
+	// Name names the job in the config, the logs and the metrics, e.g. trash_purge
+	Name  string
+	Every time.Duration
+	// Run does the work due at the time and returns how many items it handled
+	Run func(now time.Time) (int, error)
+	// Unit names the items of Run in the log, e.g. tasks
+	Unit string
+}
+
+// scheduled is a job with the status of its runs
+type scheduled struct {
+	Job
+	enabled bool
+
+	mu      sync.Mutex
+	busy    bool
+	runs    int
+	fails   int
+	lastAt  time.Time
+	lastDur time.Duration
+	lastN   int
+	lastErr error
+	nextAt  time.Time
+	// trigger runs the job now, out of its schedule
+	trigger chan struct{}
+}
+
+var (
+	scheduleMu sync.RWMutex
+	schedule   = map[string]*scheduled{}
+)
+
+// Schedule registers a job, it runs once Start is called
+func Schedule(j Job) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+	schedule[j.Name] = &scheduled{Job: j, enabled: true, trigger: make(chan struct{}, 1)}
+}
+
+// Start runs the scheduled jobs but the disabled ones. Every run is delayed by up to the
+// jitter, the first one too, so the instances started together do not run the jobs together.
+func Start(cfg config.Jobs) {
+	scheduleMu.Lock()
+	defer scheduleMu.Unlock()
+
+	for _, name := range cfg.Disabled {
+		if s, ok := schedule[name]; ok {
+			s.enabled = false
+		} else {
+			logging.Log.Warn().Str("job", name).Msg("Cannot disable an unknown job")
+		}
+	}
+
+	for _, s := range schedule {
+		if s.enabled {
+			running.Add(1)
+			go s.loop(cfg.Jitter)
+		}
+	}
+}
+
+func (s *scheduled) loop(jitter time.Duration) {
+	defer running.Done()
+
+	wait := delay(0, jitter)
+	for {
+		s.mu.Lock()
+		s.nextAt = time.Now().Add(wait)
+		s.mu.Unlock()
+
+		select {
+		case <-time.After(wait):
+		case <-s.trigger:
+		case <-stopping:
+			return
+		}
+
+		s.run()
+		wait = delay(s.Every, jitter)
+	}
+}
+
+// run runs the job once, recording its status
+func (s *scheduled) run() {
+	s.mu.Lock()
+	if s.busy {
+		s.mu.Unlock()
+		return
+	}
+	s.busy = true
+	s.mu.Unlock()
+
+	start := time.Now()
+	n, err := s.Run(start)
+	observeRun(s.Name, start, err)
+	if err != nil {
+		logging.Log.Error().Err(err).Str("job", s.Name).Msg("Job failed")
+	} else if n > 0 {
+		logging.Log.Info().Str("job", s.Name).Int(s.Unit, n).Msg("Job done")
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.busy = false
+	s.runs++
+	if err != nil {
+		s.fails++
+	}
+	s.lastAt, s.lastDur, s.lastN, s.lastErr = start, time.Since(start), n, err
+}
+
+// delay returns the interval with a random delay of up to the jitter
+func delay(every, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return every
+	}
+
+	return every + time.Duration(rand.Int63n(int64(jitter)))
+}
+
+// RunNow runs a job out of its schedule, in the background
+func RunNow(name string) error {
+	scheduleMu.RLock()
+	s, ok := schedule[name]
+	scheduleMu.RUnlock()
+	if !ok {
+		return ErrUnknownJob
+	}
+
+	s.mu.Lock()
+	busy := s.busy
+	s.mu.Unlock()
+	if busy {
+		return ErrJobRunning
+	}
+
+	// a disabled job has no loop to trigger
+	if !s.enabled {
+		running.Add(1)
+		go func() {
+			defer running.Done()
+			s.run()
+		}()
+		return nil
+	}
+
+	select {
+	case s.trigger <- struct{}{}:
+	default:
+	}
+	return nil
+}
+
+// Statuses returns the status of every scheduled job, by name
+func Statuses() []models.ScheduledJobApi {
+	scheduleMu.RLock()
+	defer scheduleMu.RUnlock()
+
+	statuses := make([]models.ScheduledJobApi, 0, len(schedule))
+	for _, s := range schedule {
+		statuses = append(statuses, s.status())
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Name < statuses[j].Name })
+
+	return statuses
+}
+
+func (s *scheduled) status() models.ScheduledJobApi {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	status := models.ScheduledJobApi{
+		Name:     s.Name,
+		Enabled:  s.enabled,
+		Every:    s.Every.String(),
+		Running:  s.busy,
+		Runs:     s.runs,
+		Failures: s.fails,
+	}
+	if !s.lastAt.IsZero() {
+		status.LastRun = &models.JobRunApi{
+			StartedAt:  models.Timestamp(s.lastAt),
+			DurationMs: s.lastDur.Milliseconds(),
+			Items:      s.lastN,
+			Success:    s.lastErr == nil,
+		}
+		if s.lastErr != nil {
+			status.LastRun.Error = s.lastErr.Error()
+		}
+	}
+	if s.enabled && !s.nextAt.IsZero() {
+		status.NextRunAt = models.Timestamp(s.nextAt)
+	}
+
+	return status
+}
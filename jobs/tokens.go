@@ -0,0 +1,29 @@
+package jobs
+
+import (
+	"task-app/db"
+	"task-app/models"
+	"time"
+)
+
+// TokenCleanup removes the sessions whose refresh token expired, the revoked ones included,
+// and the login links and stream tickets not used in time, checking once per interval
+func TokenCleanup(every time.Duration) Job {
+	return Job{Name: "token_cleanup", Every: every, Unit: "tokens", Run: PurgeExpiredTokens}
+}
+
+// PurgeExpiredTokens deletes the sessions, the login links and the stream tickets expired at the time
+func PurgeExpiredTokens(now time.Time) (int, error) {
+	res := db.DB.Where("expires_at < ?", now.Unix()).Delete(&models.Claims{})
+	if res.Error != nil {
+		return 0, res.Error
+	}
+
+	links := db.DB.Where("expires_at < ?", now).Delete(&models.MagicLink{})
+	if links.Error != nil {
+		return int(res.RowsAffected), links.Error
+	}
+
+	tickets := db.DB.Where("expires_at < ?", now).Delete(&models.StreamTicket{})
+	return int(res.RowsAffected + links.RowsAffected + tickets.RowsAffected), tickets.Error
+}
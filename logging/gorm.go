@@ -0,0 +1,89 @@
+package logging
+
+import (
+	"context"
+	"errors"
+	"github.com/rs/zerolog"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"sync/atomic"
+	"time"
+)
+
+// GormLogger writes the logs of GORM with the logger of the request when the query runs
+// with its context (db.WithContext(util.Context(c))), with Log otherwise.
+// Queries are logged at debug level, the ones slower than SlowThreshold as warnings. They are
+// counted for the access log of the request, whatever the level.
+type GormLogger struct {
+	SlowThreshold time.Duration
+	level         gormlogger.LogLevel
+}
+
+func NewGormLogger(slowThreshold time.Duration) *GormLogger {
+	return &GormLogger{SlowThreshold: slowThreshold, level: gormlogger.Warn}
+}
+
+func (l *GormLogger) LogMode(level gormlogger.LogLevel) gormlogger.Interface {
+	copy := *l
+	copy.level = level
+	return &copy
+}
+
+func (l *GormLogger) Info(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Info {
+		ctxLogger(ctx).Info().Msgf(msg, data...)
+	}
+}
+
+func (l *GormLogger) Warn(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Warn {
+		ctxLogger(ctx).Warn().Msgf(msg, data...)
+	}
+}
+
+func (l *GormLogger) Error(ctx context.Context, msg string, data ...interface{}) {
+	if l.level >= gormlogger.Error {
+		ctxLogger(ctx).Error().Msgf(msg, data...)
+	}
+}
+
+func (l *GormLogger) Trace(ctx context.Context, begin time.Time, fc func() (string, int64), err error) {
+	if ctx != nil {
+		if n, ok := ctx.Value(QueriesKey).(*int64); ok {
+			atomic.AddInt64(n, 1)
+		}
+	}
+	if l.level <= gormlogger.Silent {
+		return
+	}
+
+	elapsed := time.Since(begin)
+	logger := ctxLogger(ctx)
+
+	var event *zerolog.Event
+	switch {
+	case err != nil && !errors.Is(err, gorm.ErrRecordNotFound) && l.level >= gormlogger.Error:
+		event = logger.Error().Err(err)
+	case l.SlowThreshold > 0 && elapsed > l.SlowThreshold && l.level >= gormlogger.Warn:
+		event = logger.Warn().Bool("slow", true)
+	default:
+		event = logger.Debug()
+	}
+
+	if !event.Enabled() {
+		return
+	}
+
+	sql, rows := fc()
+	event.Str("sql", sql).Int64("rows", rows).Dur("elapsed", elapsed).Msg("query")
+}
+
+func ctxLogger(ctx context.Context) *zerolog.Logger {
+	if ctx != nil {
+		if l, ok := ctx.Value(LoggerKey).(*zerolog.Logger); ok {
+			return l
+		}
+	}
+
+	return &Log
+}
@@ -0,0 +1,82 @@
+package logging
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/utils"
+	"github.com/rs/zerolog"
+	"sync/atomic"
+	"time"
+)
+
+// The locals of the request, the logger and the count of the queries are also found by GORM
+// through the request context
+const (
+	RequestIDKey = "request_id"
+	LoggerKey    = "logger"
+	QueriesKey   = "queries"
+)
+
+// maxRequestIDLength limits the ids sent by clients, longer ones are replaced
+const maxRequestIDLength = 128
+
+// Middleware gives every request an X-Request-ID, kept when the client sends one,
+// and a logger carrying it, then writes an access log line when the request is done, with the
+// count of the queries it ran
+func Middleware(base zerolog.Logger) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+
+		id := c.Get(fiber.HeaderXRequestID)
+		if id == "" || len(id) > maxRequestIDLength {
+			id = utils.UUID()
+		}
+		c.Set(fiber.HeaderXRequestID, id)
+		c.Locals(RequestIDKey, id)
+
+		l := base.With().Str(RequestIDKey, id).Logger()
+		c.Locals(LoggerKey, &l)
+		queries := new(int64)
+		c.Locals(QueriesKey, queries)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		event := FromCtx(c).Info()
+		if status >= fiber.StatusInternalServerError {
+			event = FromCtx(c).Error().Err(err)
+		}
+		event.
+			Str("method", c.Method()).
+			Str("route", c.Route().Path).
+			Str("path", c.Path()).
+			Int("status", status).
+			Dur("latency", time.Since(start)).
+			Int64("queries", atomic.LoadInt64(queries)).
+			Str("ip", c.IP()).
+			Msg("request")
+
+		return err
+	}
+}
+
+// FromCtx returns the logger of the request, with the id of the user once signed in
+func FromCtx(c *fiber.Ctx) *zerolog.Logger {
+	l, ok := c.Locals(LoggerKey).(*zerolog.Logger)
+	if !ok {
+		l = &Log
+	}
+
+	if id, ok := c.Locals("id").(string); ok {
+		withUser := l.With().Str("user_id", id).Logger()
+		return &withUser
+	}
+
+	return l
+}
@@ -0,0 +1,26 @@
+package logging
+
+import (
+	"github.com/rs/zerolog"
+	"os"
+	"strings"
+	"time"
+)
+
+// Log is the logger of the app, used directly by the code running outside of a request
+var Log = zerolog.New(os.Stderr).With().Timestamp().Logger()
+
+// Setup configures Log from LOG_LEVEL (debug, info, warn, error; info by default)
+// and LOG_FORMAT (json by default, or console for development)
+func Setup() {
+	level, err := zerolog.ParseLevel(strings.ToLower(os.Getenv("LOG_LEVEL")))
+	if err != nil || level == zerolog.NoLevel {
+		level = zerolog.InfoLevel
+	}
+	zerolog.SetGlobalLevel(level)
+	zerolog.TimeFieldFormat = time.RFC3339Nano
+
+	if os.Getenv("LOG_FORMAT") == "console" {
+		Log = Log.Output(zerolog.ConsoleWriter{Out: os.Stderr, TimeFormat: time.RFC3339})
+	}
+}
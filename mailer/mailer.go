@@ -0,0 +1,203 @@
+// Package mailer sends the emails of the app in the background, by SMTP or to the log
+package mailer
+
+import (
+	"bytes"
+	"fmt"
+	"mime/multipart"
+	"mime/quotedprintable"
+	"net/mail"
+	"net/smtp"
+	"net/textproto"
+	"strconv"
+	"sync"
+	"task-app/config"
+	"task-app/logging"
+	"time"
+)
+
+const (
+	// queueSize is how many emails wait for the worker, more are dropped
+	queueSize = 1000
+	// MaxAttempts is how many times an email is tried before giving up
+	MaxAttempts = 3
+	// first retry delay, doubled on every next attempt
+	initialBackoff = 5 * time.Second
+)
+
+// Message is an email with its HTML body and the plain text alternative
+type Message struct {
+	To      string
+	Subject string
+	HTML    string
+	Text    string
+	// Headers are the extra headers, e.g. List-Unsubscribe
+	Headers map[string]string
+}
+
+// Transport delivers the emails
+type Transport interface {
+	Deliver(from string, m Message) error
+}
+
+var (
+	from      = "Tasker <tasker@localhost>"
+	transport = Transport(logTransport{})
+	queue     = make(chan Message, queueSize)
+	running   sync.WaitGroup
+	stopping  = make(chan struct{})
+	startOnce sync.Once
+	stopOnce  sync.Once
+)
+
+// Setup starts the worker with the SMTP server of the config, or with the log without a host
+func Setup(cfg config.Mail) {
+	from = cfg.From
+	if cfg.Host != "" {
+		transport = &smtpTransport{cfg: cfg}
+	}
+
+	startOnce.Do(func() {
+		running.Add(1)
+		go work()
+	})
+}
+
+// Send queues the email, it is dropped when the queue is full
+func Send(m Message) {
+	select {
+	case queue <- m:
+	default:
+		logging.Log.Warn().Str("to", m.To).Str("subject", m.Subject).Msg("Mail queue is full, email dropped")
+	}
+}
+
+// Stop sends the queued emails and stops the worker. Emails waiting for a retry are abandoned.
+func Stop() {
+	stopOnce.Do(func() { close(stopping) })
+	running.Wait()
+}
+
+func work() {
+	defer running.Done()
+	for {
+		select {
+		case m := <-queue:
+			deliver(m)
+		case <-stopping:
+			for {
+				select {
+				case m := <-queue:
+					deliver(m)
+				default:
+					return
+				}
+			}
+		}
+	}
+}
+
+// deliver sends the email, retrying with exponential backoff
+func deliver(m Message) {
+	backoff := initialBackoff
+	for attempt := 1; attempt <= MaxAttempts; attempt++ {
+		err := transport.Deliver(from, m)
+		if err == nil {
+			return
+		}
+		logging.Log.Error().Err(err).Str("to", m.To).Int("attempt", attempt).Msg("Cannot send email")
+
+		if attempt < MaxAttempts {
+			select {
+			case <-time.After(backoff):
+			case <-stopping:
+				logging.Log.Warn().Str("to", m.To).Int("attempts", attempt).Msg("Email abandoned on shutdown")
+				return
+			}
+			backoff *= 2
+		}
+	}
+}
+
+// logTransport writes the emails to the log, for the development without an SMTP server.
+// Their bodies are left out, the links of the logins and invites must not end up in the logs.
+type logTransport struct{}
+
+func (logTransport) Deliver(from string, m Message) error {
+	logging.Log.Info().Str("from", from).Str("to", m.To).Str("subject", m.Subject).Msg("email")
+	return nil
+}
+
+type smtpTransport struct {
+	cfg config.Mail
+}
+
+func (t *smtpTransport) Deliver(from string, m Message) error {
+	sender, err := mail.ParseAddress(from)
+	if err != nil {
+		return err
+	}
+	to, err := mail.ParseAddress(m.To)
+	if err != nil {
+		return err
+	}
+
+	body, err := encode(from, m)
+	if err != nil {
+		return err
+	}
+
+	var auth smtp.Auth
+	if t.cfg.Username != "" {
+		auth = smtp.PlainAuth("", t.cfg.Username, t.cfg.Password, t.cfg.Host)
+	}
+	addr := t.cfg.Host + ":" + strconv.Itoa(t.cfg.Port)
+
+	return smtp.SendMail(addr, auth, sender.Address, []string{to.Address}, body)
+}
+
+// encode returns the MIME message of the email, a multipart/alternative of the text and the HTML
+func encode(from string, m Message) ([]byte, error) {
+	var buf bytes.Buffer
+	parts := multipart.NewWriter(&buf)
+
+	header := func(name, value string) {
+		fmt.Fprintf(&buf, "%s: %s\r\n", name, value)
+	}
+	header("From", from)
+	header("To", m.To)
+	header("Subject", mimeWord(m.Subject))
+	header("Date", time.Now().Format(time.RFC1123Z))
+	header("MIME-Version", "1.0")
+	for name, value := range m.Headers {
+		header(name, value)
+	}
+	header("Content-Type", "multipart/alternative; boundary="+parts.Boundary())
+	buf.WriteString("\r\n")
+
+	for _, part := range []struct{ contentType, body string }{
+		{"text/plain; charset=utf-8", m.Text},
+		{"text/html; charset=utf-8", m.HTML},
+	} {
+		w, err := parts.CreatePart(textproto.MIMEHeader{
+			"Content-Type":              {part.contentType},
+			"Content-Transfer-Encoding": {"quoted-printable"},
+		})
+		if err != nil {
+			return nil, err
+		}
+		qp := quotedprintable.NewWriter(w)
+		if _, err := qp.Write([]byte(part.body)); err != nil {
+			return nil, err
+		}
+		if err := qp.Close(); err != nil {
+			return nil, err
+		}
+	}
+
+	if err := parts.Close(); err != nil {
+		return nil, err
+	}
+
+	return buf.Bytes(), nil
+}
@@ -0,0 +1,29 @@
+package mailer
+
+import (
+	"bytes"
+	"embed"
+	"html/template"
+	"mime"
+)
+
+//go:embed templates/*.html
+var files embed.FS
+
+// templates are the HTML bodies of the emails, each is rendered in the layout
+var templates = template.Must(template.ParseFS(files, "templates/*.html"))
+
+// Render returns the HTML of the template with the data
+func Render(name string, data interface{}) (string, error) {
+	var buf bytes.Buffer
+	if err := templates.ExecuteTemplate(&buf, name, data); err != nil {
+		return "", err
+	}
+
+	return buf.String(), nil
+}
+
+// mimeWord encodes a header value which may not be ASCII, RFC 2047
+func mimeWord(s string) string {
+	return mime.QEncoding.Encode("utf-8", s)
+}
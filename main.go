@@ -2,28 +2,83 @@ package main
 
 import (
 	"github.com/gofiber/fiber/v2"
-	"github.com/gofiber/fiber/v2/middleware/cors"
-	"log"
-	"task-app/db"
+	"github.com/spf13/cobra"
+	"os"
+	"task-app/config"
+	"task-app/logging"
 	"task-app/router"
 )
 
 func CreateServer() *fiber.App {
-	app := fiber.New()
+	app := fiber.New(fiber.Config{
+		// the largest body is an upload, the routes limit the others
+		BodyLimit:    router.UploadLimit(),
+		ErrorHandler: router.ErrorHandler,
+	})
 
 	return app
 }
 
 func main() {
-	db.ConnectToDB()
+	root := &cobra.Command{
+		Use:   "tasker",
+		Short: "Tasker runs the server of the tasks, and manages the tasks from the command line",
+		// the errors are printed by main, the usage only for the invalid commands
+		SilenceErrors: true,
+		SilenceUsage:  true,
+	}
+	root.AddCommand(serveCommand(), migrateCommand(), seedCommand(), encryptionCommand())
+	root.AddCommand(loginCommand(), addCommand(), listCommand())
 
-	app := CreateServer()
-	app.Use(cors.New())
-	router.SetupRoutes(app)
+	if err := root.Execute(); err != nil {
+		printError(root, err)
+		os.Exit(1)
+	}
+}
 
-	app.Use(func(c *fiber.Ctx) error {
-		return c.SendStatus(404) // => 404 "Not Found"
-	})
+func serveCommand() *cobra.Command {
+	var file, addr string
+	cmd := &cobra.Command{
+		Use:   "serve",
+		Short: "Run the server",
+		Args:  cobra.NoArgs,
+		Run: func(cmd *cobra.Command, args []string) {
+			cfg, err := config.Load(configArgs(file, addr))
+			if err != nil {
+				logging.Log.Fatal().Err(err).Msg("Invalid configuration")
+			}
+
+			app, err := NewApp(cfg)
+			if err != nil {
+				logging.Log.Fatal().Err(err).Msg("Failed to set up the app")
+			}
+
+			if err := app.Run(); err != nil {
+				logging.Log.Fatal().Err(err).Msg("Server failed")
+			}
+			logging.Log.Info().Msg("Server stopped")
+		},
+	}
+	configFlag(cmd, &file)
+	cmd.Flags().StringVar(&addr, "addr", "", "address the server listens on")
+
+	return cmd
+}
+
+// configFlag adds the --config flag of the commands reading the configuration, CONFIG_FILE by default
+func configFlag(cmd *cobra.Command, file *string) {
+	cmd.Flags().StringVar(file, "config", "", "path of the YAML configuration file")
+}
+
+// configArgs are the args of config.Load for the flags of a command
+func configArgs(file, addr string) []string {
+	var args []string
+	if file != "" {
+		args = append(args, "-config", file)
+	}
+	if addr != "" {
+		args = append(args, "-addr", addr)
+	}
 
-	log.Fatal(app.Listen(":3000"))
+	return args
 }
@@ -0,0 +1,154 @@
+// Package markdown renders the Markdown of the descriptions and the comments to HTML which is
+// safe to insert into a page: the HTML is sanitized with a safelist of elements and attributes.
+package markdown
+
+import (
+	"github.com/russross/blackfriday/v2"
+	"golang.org/x/net/html"
+	"net/url"
+	"regexp"
+	"strings"
+)
+
+const extensions = blackfriday.CommonExtensions
+
+var renderer = blackfriday.NewHTMLRenderer(blackfriday.HTMLRendererParameters{
+	// the raw HTML of the source is dropped, the sanitizer is the second line of defense
+	Flags: blackfriday.SkipHTML | blackfriday.Safelink,
+})
+
+// Render returns the sanitized HTML of the Markdown, empty for an empty source
+func Render(src string) string {
+	if strings.TrimSpace(src) == "" {
+		return ""
+	}
+
+	out := blackfriday.Run([]byte(src), blackfriday.WithRenderer(renderer), blackfriday.WithExtensions(extensions))
+	return strings.TrimSpace(Sanitize(string(out)))
+}
+
+// allowed are the elements kept by the sanitizer with their attributes
+var allowed = map[string][]string{
+	"p": nil, "br": nil, "hr": nil, "blockquote": nil, "pre": nil, "code": {"class"},
+	"h1": nil, "h2": nil, "h3": nil, "h4": nil, "h5": nil, "h6": nil,
+	"em": nil, "strong": nil, "del": nil, "sup": nil, "sub": nil,
+	"ul": nil, "ol": {"start"}, "li": nil, "dl": nil, "dt": nil, "dd": nil,
+	"a": {"href", "title"}, "img": {"src", "alt", "title"},
+	"table": nil, "thead": nil, "tbody": nil, "tr": nil, "th": {"align"}, "td": {"align"},
+}
+
+// dropped are the elements removed with their content
+var dropped = map[string]bool{
+	"script": true, "style": true, "iframe": true, "object": true, "embed": true, "noscript": true,
+	"textarea": true, "title": true, "template": true, "svg": true, "math": true,
+}
+
+var (
+	codeClassRe = regexp.MustCompile(`^language-[\w+-]+$`)
+	numberRe    = regexp.MustCompile(`^\d{1,9}$`)
+	alignRe     = regexp.MustCompile(`^(left|right|center)$`)
+)
+
+// Sanitize keeps the elements and the attributes of the safelist of the HTML, the others are
+// removed and their text is kept, but the text of the dropped elements like script. The links
+// may only be http, https, mailto or relative ones and the images http or https ones.
+func Sanitize(s string) string {
+	z := html.NewTokenizer(strings.NewReader(s))
+	var b strings.Builder
+	// skip is the depth in dropped elements
+	skip := 0
+
+	for {
+		tt := z.Next()
+		switch tt {
+		case html.ErrorToken:
+			return b.String()
+
+		case html.TextToken:
+			if skip == 0 {
+				b.WriteString(html.EscapeString(string(z.Text())))
+			}
+
+		case html.StartTagToken, html.SelfClosingTagToken:
+			t := z.Token()
+			if dropped[t.Data] {
+				if tt == html.StartTagToken {
+					skip++
+				}
+				continue
+			}
+			attrs, ok := allowed[t.Data]
+			if skip > 0 || !ok {
+				continue
+			}
+
+			b.WriteString("<" + t.Data)
+			for _, a := range t.Attr {
+				if a.Namespace == "" && contains(attrs, a.Key) && validAttr(t.Data, a.Key, a.Val) {
+					b.WriteString(" " + a.Key + `="` + html.EscapeString(a.Val) + `"`)
+				}
+			}
+			if t.Data == "a" {
+				b.WriteString(` rel="nofollow noopener noreferrer"`)
+			}
+			b.WriteString(">")
+
+		case html.EndTagToken:
+			t := z.Token()
+			if dropped[t.Data] {
+				if skip > 0 {
+					skip--
+				}
+				continue
+			}
+			if _, ok := allowed[t.Data]; skip == 0 && ok && !void(t.Data) {
+				b.WriteString("</" + t.Data + ">")
+			}
+		}
+	}
+}
+
+// validAttr checks the value of an attribute of the safelist
+func validAttr(tag, key, val string) bool {
+	switch key {
+	case "href":
+		return safeURL(val, "http", "https", "mailto")
+	case "src":
+		return safeURL(val, "http", "https")
+	case "class":
+		return tag == "code" && codeClassRe.MatchString(val)
+	case "start":
+		return numberRe.MatchString(val)
+	case "align":
+		return alignRe.MatchString(val)
+	}
+
+	return true
+}
+
+// safeURL checks the URL is relative or has one of the schemes
+func safeURL(val string, schemes ...string) bool {
+	u, err := url.Parse(val)
+	if err != nil {
+		return false
+	}
+	if u.Scheme == "" {
+		// a relative URL, but not a protocol relative one
+		return u.Host == "" && !strings.HasPrefix(val, "//")
+	}
+
+	return contains(schemes, strings.ToLower(u.Scheme))
+}
+
+func void(tag string) bool {
+	return tag == "br" || tag == "hr" || tag == "img"
+}
+
+func contains(list []string, s string) bool {
+	for _, item := range list {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,18 @@
+package metrics
+
+// The metrics of the app, written by the packages doing the work
+var (
+	HTTPRequests = NewCounterVec("http_requests_total", "Number of HTTP requests.", "method", "route", "status")
+	HTTPDuration = NewHistogramVec("http_request_duration_seconds", "Duration of HTTP requests.", nil, "method", "route")
+
+	DBQueryDuration = NewHistogramVec("db_query_duration_seconds", "Duration of database queries.", nil, "operation", "table")
+
+	TokensIssued = NewCounterVec("auth_tokens_issued_total", "Number of issued tokens.", "type")
+
+	JobRuns     = NewCounterVec("job_runs_total", "Number of background job runs.", "job", "result")
+	JobDuration = NewHistogramVec("job_duration_seconds", "Duration of background job runs.", nil, "job")
+
+	WebhookDeliveries = NewCounterVec("webhook_deliveries_total", "Number of webhook delivery attempts.", "result")
+
+	CacheRequests = NewCounterVec("cache_requests_total", "Number of cache lookups by result: hit, miss or error.", "scope", "result")
+)
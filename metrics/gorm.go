@@ -0,0 +1,56 @@
+package metrics
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const startKey = "metrics:start"
+
+// InstrumentDB times every query of the database through GORM callbacks
+func InstrumentDB(db *gorm.DB) error {
+	cb := db.Callback()
+	processors := []struct {
+		name   string
+		before func(string, func(*gorm.DB)) error
+		after  func(string, func(*gorm.DB)) error
+	}{
+		{"create", cb.Create().Before("gorm:create").Register, cb.Create().After("gorm:create").Register},
+		{"query", cb.Query().Before("gorm:query").Register, cb.Query().After("gorm:query").Register},
+		{"update", cb.Update().Before("gorm:update").Register, cb.Update().After("gorm:update").Register},
+		{"delete", cb.Delete().Before("gorm:delete").Register, cb.Delete().After("gorm:delete").Register},
+		{"row", cb.Row().Before("gorm:row").Register, cb.Row().After("gorm:row").Register},
+		{"raw", cb.Raw().Before("gorm:raw").Register, cb.Raw().After("gorm:raw").Register},
+	}
+
+	for _, p := range processors {
+		operation := p.name
+		if err := p.before("metrics:before_"+operation, startTimer); err != nil {
+			return err
+		}
+		if err := p.after("metrics:after_"+operation, func(tx *gorm.DB) {
+			observeQuery(tx, operation)
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+func startTimer(tx *gorm.DB) {
+	tx.InstanceSet(startKey, time.Now())
+}
+
+func observeQuery(tx *gorm.DB, operation string) {
+	v, ok := tx.InstanceGet(startKey)
+	if !ok {
+		return
+	}
+
+	table := ""
+	if tx.Statement != nil {
+		table = tx.Statement.Table
+	}
+	DBQueryDuration.Observe(time.Since(v.(time.Time)).Seconds(), operation, table)
+}
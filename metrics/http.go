@@ -0,0 +1,40 @@
+package metrics
+
+import (
+	"bytes"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"time"
+)
+
+// Middleware counts and times the requests by route.
+// The route is the registered path, e.g. /api/v1/tasks/:id, so ids do not explode the series.
+func Middleware() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		start := time.Now()
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+		}
+
+		route := c.Route().Path
+		HTTPRequests.Inc(c.Method(), route, strconv.Itoa(status))
+		HTTPDuration.Observe(time.Since(start).Seconds(), c.Method(), route)
+
+		return err
+	}
+}
+
+// Handler serves the metrics in the Prometheus text format
+func Handler(c *fiber.Ctx) error {
+	var b bytes.Buffer
+	Write(&b)
+
+	c.Set(fiber.HeaderContentType, "text/plain; version=0.0.4; charset=utf-8")
+	return c.Send(b.Bytes())
+}
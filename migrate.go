@@ -0,0 +1,83 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"task-app/config"
+	"task-app/db"
+)
+
+// migrateCommand is the migrate command: up applies the pending migrations,
+// down rolls back the last one and status lists them all
+func migrateCommand() *cobra.Command {
+	var file string
+	cmd := &cobra.Command{
+		Use:   "migrate",
+		Short: "Apply, roll back or list the migrations of the database",
+	}
+	cmd.PersistentFlags().StringVar(&file, "config", "", "path of the YAML configuration file")
+
+	cmd.AddCommand(&cobra.Command{
+		Use:   "up",
+		Short: "Apply the pending migrations",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(file, func(*config.Config) error {
+				if err := db.MigrateUp(); err != nil {
+					return err
+				}
+				fmt.Println("Migrations are up to date")
+				return nil
+			})
+		},
+	}, &cobra.Command{
+		Use:   "down",
+		Short: "Roll back the last migration",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(file, func(*config.Config) error {
+				if err := db.MigrateDown(); err != nil {
+					return err
+				}
+				fmt.Println("Rolled back the last migration")
+				return nil
+			})
+		},
+	}, &cobra.Command{
+		Use:   "status",
+		Short: "List the migrations, applied or pending",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return withDB(file, func(*config.Config) error {
+				status, err := db.Migrations()
+				if err != nil {
+					return err
+				}
+				for _, m := range status {
+					state := "pending"
+					if m.Applied {
+						state = "applied"
+					}
+					fmt.Printf("%-8s %s\n", state, m.ID)
+				}
+				return nil
+			})
+		},
+	})
+
+	return cmd
+}
+
+// withDB runs fn with the configuration, connected to its database
+func withDB(file string, fn func(cfg *config.Config) error) error {
+	cfg, err := config.Load(configArgs(file, ""))
+	if err != nil {
+		return err
+	}
+	if err := db.ConnectToDB(cfg); err != nil {
+		return err
+	}
+	defer db.Close()
+
+	return fn(cfg)
+}
@@ -0,0 +1,52 @@
+package models
+
+import (
+	"encoding/json"
+	"time"
+)
+
+// Activity is an entry of the audit log, written for every change of the data
+type Activity struct {
+	ID        uint      `gorm:"primaryKey"`
+	CreatedAt time.Time `gorm:"index"`
+	ActorID   uint      `gorm:"index"`
+	// ImpersonatorID is the admin who acted as the actor, nil when it was the actor
+	ImpersonatorID *uint `gorm:"index"`
+	Verb           string
+	TargetType     string
+	TargetID       uint
+	TaskID         *uint `gorm:"index"`
+	WorkspaceID    *uint
+	Data           string `gorm:"type:text"`
+}
+
+type ActivityApi struct {
+	ID      uint `json:"id"`
+	ActorID uint `json:"actorId"`
+	// ImpersonatorID is the admin who acted as the actor
+	ImpersonatorID *uint           `json:"impersonatorId,omitempty"`
+	Verb           string          `json:"verb"`
+	TargetType     string          `json:"targetType"`
+	TargetID       uint            `json:"targetId"`
+	TaskID         *uint           `json:"taskId"`
+	Data           json.RawMessage `json:"data,omitempty"`
+	CreatedAt      string          `json:"createdAt"`
+}
+
+func (a Activity) Api() ActivityApi {
+	activity := ActivityApi{
+		ID:             a.ID,
+		ActorID:        a.ActorID,
+		ImpersonatorID: a.ImpersonatorID,
+		Verb:           a.Verb,
+		TargetType:     a.TargetType,
+		TargetID:       a.TargetID,
+		TaskID:         a.TaskID,
+		CreatedAt:      Timestamp(a.CreatedAt),
+	}
+	if a.Data != "" {
+		activity.Data = json.RawMessage(a.Data)
+	}
+
+	return activity
+}
@@ -0,0 +1,23 @@
+package models
+
+import "time"
+
+// UserAdminApi is the view of a user in the admin api
+type UserAdminApi struct {
+	ID       uint   `json:"id"`
+	Email    string `json:"email"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+	Locked   bool   `json:"locked"`
+	// LockedUntil is set while the user is locked out after failed logins
+	LockedUntil *time.Time `json:"lockedUntil,omitempty"`
+	TaskCount   int64      `json:"taskCount"`
+	CreatedAt   string     `json:"createdAt"`
+}
+
+// TaskStats is the aggregate of tasks across all users
+type TaskStats struct {
+	Users    int64            `json:"users"`
+	Tasks    int64            `json:"tasks"`
+	ByStatus map[string]int64 `json:"byStatus"`
+}
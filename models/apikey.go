@@ -0,0 +1,62 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// APIKey is a personal access token, only its hash is stored
+type APIKey struct {
+	gorm.Model
+	UserID     uint
+	Name       string
+	Prefix     string
+	KeyHash    string `gorm:"uniqueIndex"`
+	Scopes     string
+	LastUsedAt *time.Time
+}
+
+type APIKeyApi struct {
+	ID         uint     `json:"id"`
+	Name       string   `json:"name"`
+	Prefix     string   `json:"prefix"`
+	Scopes     []string `json:"scopes"`
+	Key        string   `json:"key,omitempty"`
+	LastUsedAt string   `json:"lastUsedAt,omitempty"`
+	CreatedAt  string   `json:"createdAt"`
+}
+
+func (k APIKey) Api() APIKeyApi {
+	key := APIKeyApi{
+		ID:        k.ID,
+		Name:      k.Name,
+		Prefix:    k.Prefix,
+		Scopes:    k.ScopeList(),
+		CreatedAt: Timestamp(k.CreatedAt),
+	}
+	if k.LastUsedAt != nil {
+		key.LastUsedAt = Timestamp(*k.LastUsedAt)
+	}
+
+	return key
+}
+
+func (k APIKey) ScopeList() []string {
+	if k.Scopes == "" {
+		return []string{}
+	}
+
+	return strings.Split(k.Scopes, ",")
+}
+
+// HasScope checks if the key was granted the scope
+func (k APIKey) HasScope(scope string) bool {
+	for _, s := range k.ScopeList() {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
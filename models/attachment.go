@@ -0,0 +1,35 @@
+package models
+
+import "gorm.io/gorm"
+
+type Attachment struct {
+	gorm.Model
+	TaskID      uint
+	UserID      uint
+	FileName    string
+	ContentType string
+	Size        int64
+	StorageKey  string `gorm:"unique"`
+}
+
+type AttachmentApi struct {
+	ID          uint   `json:"id"`
+	TaskID      uint   `json:"taskId"`
+	FileName    string `json:"fileName"`
+	ContentType string `json:"contentType"`
+	Size        int64  `json:"size"`
+	URL         string `json:"url"`
+	CreatedAt   string `json:"createdAt"`
+}
+
+func (a Attachment) Api(url string) AttachmentApi {
+	return AttachmentApi{
+		ID:          a.ID,
+		TaskID:      a.TaskID,
+		FileName:    a.FileName,
+		ContentType: a.ContentType,
+		Size:        a.Size,
+		URL:         url,
+		CreatedAt:   Timestamp(a.CreatedAt),
+	}
+}
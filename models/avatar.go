@@ -0,0 +1,48 @@
+package models
+
+import (
+	"crypto/md5"
+	"encoding/hex"
+	"fmt"
+	"path"
+	"strconv"
+	"strings"
+)
+
+// AvatarSizes are the sizes in pixels the avatars are resized to, they are squares
+var AvatarSizes = []int{64, 128, 256}
+
+// AvatarPath is the route serving the uploaded avatars, as /api/v1/avatars/:id/:size
+const AvatarPath = "/api/v1/avatars"
+
+// AvatarFile returns the storage key of the size of the avatar of the key
+func AvatarFile(key string, size int) string {
+	return key + "-" + strconv.Itoa(size) + ".png"
+}
+
+// AvatarURLs returns the URLs of the avatar of the user by size. The URLs of an uploaded avatar
+// are stable, the version changes with the avatar so it can be cached. A user without one has
+// the avatar of Gravatar of its email.
+func (u User) AvatarURLs() map[string]string {
+	urls := make(map[string]string, len(AvatarSizes))
+	for _, size := range AvatarSizes {
+		s := strconv.Itoa(size)
+		if u.AvatarKey != "" {
+			version := path.Base(u.AvatarKey)
+			if len(version) > 8 {
+				version = version[:8]
+			}
+			urls[s] = fmt.Sprintf("%s/%d/%d?v=%s", AvatarPath, u.ID, size, version)
+		} else {
+			urls[s] = gravatarURL(u.Email, size)
+		}
+	}
+
+	return urls
+}
+
+// gravatarURL is the avatar of the email on Gravatar, an identicon when it has none
+func gravatarURL(email string, size int) string {
+	sum := md5.Sum([]byte(strings.ToLower(strings.TrimSpace(email))))
+	return "https://www.gravatar.com/avatar/" + hex.EncodeToString(sum[:]) + "?s=" + strconv.Itoa(size) + "&d=identicon"
+}
@@ -0,0 +1,34 @@
+package models
+
+// The operations of a bulk request
+const (
+	BulkComplete = "complete"
+	BulkDelete   = "delete"
+	BulkMove     = "move"
+	BulkLabel    = "label"
+)
+
+// BulkInput is the body of a bulk request, its operations are applied in their order
+type BulkInput struct {
+	Operations []BulkOperation `json:"operations" validate:"required,min=1,max=100,dive"`
+}
+
+// BulkOperation is a change of a task: complete, delete, move to the project or add the label
+type BulkOperation struct {
+	Op     string `json:"op" validate:"oneof=complete delete move label"`
+	TaskID uint   `json:"taskId" validate:"required"`
+	// ProjectID is the project of a move
+	ProjectID *uint `json:"projectId" validate:"required_if=Op move"`
+	// LabelID is the label of a label operation
+	LabelID uint `json:"labelId" validate:"required_if=Op label"`
+}
+
+// BulkResult is the outcome of an operation, by its index in the request
+type BulkResult struct {
+	Index int `json:"index"`
+	// Status is the HTTP status the operation would have been answered with on its own
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Task is the changed task, none for a delete or a failed operation
+	Task *TaskApi `json:"task,omitempty"`
+}
@@ -0,0 +1,14 @@
+package models
+
+import "time"
+
+// CalendarObject is the name and the UID a CalDAV client gave to a task it created, so the
+// client finds the task where it put it. The other tasks are task-<id>.ics with the UID of
+// the calendar feed.
+type CalendarObject struct {
+	TaskID uint `gorm:"primaryKey;autoIncrement:false"`
+	// Name is the last segment of the URL of the task in its calendar
+	Name      string `gorm:"index"`
+	UID       string
+	CreatedAt time.Time
+}
@@ -0,0 +1,61 @@
+package models
+
+import "gorm.io/gorm"
+
+// ChecklistItem is a step of a task, the items are in the order of their positions
+type ChecklistItem struct {
+	gorm.Model
+	TaskID   uint `gorm:"index"`
+	Text     string
+	Done     bool
+	Position int
+}
+
+type ChecklistItemApi struct {
+	ID       uint   `json:"id"`
+	Text     string `json:"text"`
+	Done     bool   `json:"done"`
+	Position int    `json:"position"`
+}
+
+func (i ChecklistItem) Api() ChecklistItemApi {
+	return ChecklistItemApi{
+		ID:       i.ID,
+		Text:     i.Text,
+		Done:     i.Done,
+		Position: i.Position,
+	}
+}
+
+// ChecklistItemInput is the body of the item create and update, a missing done is unchanged by an update
+type ChecklistItemInput struct {
+	Text string `json:"text" validate:"notblank,max=255"`
+	Done *bool  `json:"done"`
+}
+
+// ChecklistProgress tells how much of a checklist is done
+type ChecklistProgress struct {
+	Done    int `json:"done"`
+	Total   int `json:"total"`
+	Percent int `json:"percent"`
+}
+
+// Progress counts the done items, a task without checklist is 0% done
+func Progress(items []ChecklistItem) ChecklistProgress {
+	p := ChecklistProgress{Total: len(items)}
+	for _, i := range items {
+		if i.Done {
+			p.Done++
+		}
+	}
+	if p.Total > 0 {
+		p.Percent = p.Done * 100 / p.Total
+	}
+
+	return p
+}
+
+// OrderedChecklist orders the preloaded checklist of the tasks
+func OrderedChecklist(tx *gorm.DB) *gorm.DB {
+	return tx.Order("position, id")
+}
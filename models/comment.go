@@ -0,0 +1,87 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"task-app/markdown"
+)
+
+type Comment struct {
+	gorm.Model
+	TaskID   uint
+	UserID   uint
+	Body     string `json:"body"`
+	User     User
+	Mentions []User `gorm:"many2many:comment_mentions;"`
+}
+
+// countBatch bounds the ids of the tasks of a query of CountComments, below the limits of the
+// bound parameters of the drivers
+const countBatch = 500
+
+// CountComments sets the CommentCount of the tasks, with one aggregate query by batch of tasks
+// rather than one by task
+func CountComments(tx *gorm.DB, tasks []Task) error {
+	tx = tx.Session(&gorm.Session{NewDB: true})
+	for start := 0; start < len(tasks); start += countBatch {
+		batch := tasks[start:]
+		if len(batch) > countBatch {
+			batch = batch[:countBatch]
+		}
+		ids := make([]uint, 0, len(batch))
+		for i := range batch {
+			ids = append(ids, batch[i].ID)
+		}
+
+		var counts []struct {
+			TaskID uint
+			Count  int64
+		}
+		if err := tx.Model(&Comment{}).
+			Select("task_id, COUNT(*) AS count").
+			Where("task_id IN ?", ids).
+			Group("task_id").
+			Scan(&counts).Error; err != nil {
+			return err
+		}
+		byTask := make(map[uint]int64, len(counts))
+		for _, c := range counts {
+			byTask[c.TaskID] = c.Count
+		}
+		for i := range batch {
+			batch[i].CommentCount = byTask[batch[i].ID]
+		}
+	}
+
+	return nil
+}
+
+type CommentApi struct {
+	ID     uint   `json:"id"`
+	TaskID uint   `json:"taskId"`
+	Author string `json:"author"`
+	// AuthorAvatarURLs are the URLs of the avatar of the author by its size in pixels
+	AuthorAvatarURLs map[string]string `json:"authorAvatarUrls"`
+	Body             string            `json:"body"`
+	// BodyHTML is the body rendered from Markdown and sanitized
+	BodyHTML  string   `json:"bodyHtml"`
+	Mentions  []string `json:"mentions"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+func (cm Comment) Api() CommentApi {
+	mentions := make([]string, 0, len(cm.Mentions))
+	for _, u := range cm.Mentions {
+		mentions = append(mentions, u.Username)
+	}
+
+	return CommentApi{
+		ID:               cm.ID,
+		TaskID:           cm.TaskID,
+		Author:           cm.User.Username,
+		AuthorAvatarURLs: cm.User.AvatarURLs(),
+		Body:             cm.Body,
+		BodyHTML:         markdown.Render(cm.Body),
+		Mentions:         mentions,
+		CreatedAt:        Timestamp(cm.CreatedAt),
+	}
+}
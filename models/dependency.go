@@ -0,0 +1,30 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// TaskDependency is an edge of the dependency graph: the blocker task blocks the blocked task
+// until it is done. The graph has no cycle.
+type TaskDependency struct {
+	BlockerID uint `gorm:"primaryKey;autoIncrement:false"`
+	BlockedID uint `gorm:"primaryKey;autoIncrement:false;index"`
+	CreatedAt time.Time
+}
+
+// DependencyInput is the body adding a blocker to a task
+type DependencyInput struct {
+	BlockerID uint `json:"blockerId" validate:"required"`
+}
+
+// TaskDetails preloads what the serialization of tasks needs, with one query by association
+// whatever the count of tasks. The comments are counted after by CountComments.
+func TaskDetails(tx *gorm.DB) *gorm.DB {
+	return tx.Preload("Assignee").
+		Preload("Labels").
+		Preload("Watchers").
+		Preload("Checklist", OrderedChecklist).
+		Preload("BlockedBy").
+		Preload("Blocks")
+}
@@ -0,0 +1,13 @@
+package models
+
+import "time"
+
+// EncryptionKey is a data key encrypting the content at rest, wrapped by the master key of
+// MasterKeyID. The newest one encrypts the new content, the others still decrypt theirs.
+type EncryptionKey struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	MasterKeyID string `gorm:"size:255"`
+	// WrappedKey is the data key encrypted by the master key, in base64
+	WrappedKey string `gorm:"type:text"`
+}
@@ -1,19 +1,75 @@
 package models
 
-import "github.com/gofiber/fiber/v2"
+import (
+	"net/http"
+	"strings"
+)
 
-type ApiError struct {
-	Error   bool   `json:"error" default:"true"`
+// AppError is an error answered to the client.
+// The handlers return it and the error handler sends it as {code, message, fields}.
+type AppError struct {
+	Status  int    `json:"-"`
+	Code    string `json:"code"`
 	Message string `json:"message"`
+	// Fields are the errors of the fields of the request body, by field
+	Fields map[string]string `json:"fields,omitempty"`
+	// Current is the current state of the resource a change conflicted with
+	Current interface{} `json:"current,omitempty"`
+	// Quota is the limit of the plan a change went over, with the plan to upgrade to
+	Quota interface{} `json:"quota,omitempty"`
 }
 
-func DefaultError(msg string) ApiError {
-	return ApiError{
-		Error:   true,
-		Message: msg,
-	}
+func (e *AppError) Error() string {
+	return e.Message
+}
+
+// errorCodes are the codes of the statuses answered most
+var errorCodes = map[int]string{
+	http.StatusBadRequest:          "bad_request",
+	http.StatusUnauthorized:        "unauthorized",
+	http.StatusPaymentRequired:     "quota_exceeded",
+	http.StatusForbidden:           "forbidden",
+	http.StatusNotFound:            "not_found",
+	http.StatusConflict:            "conflict",
+	http.StatusUnprocessableEntity: "validation_failed",
+	http.StatusTooManyRequests:     "rate_limited",
+	http.StatusInternalServerError: "internal",
+}
+
+// NewError returns an error of the status, its code is derived from the status
+func NewError(status int, message string) *AppError {
+	return &AppError{Status: status, Code: ErrorCode(status), Message: message}
+}
+
+// ValidationError returns a 422 error with the errors of the fields
+func ValidationError(fields map[string]string) *AppError {
+	return NewError(http.StatusUnprocessableEntity, "Validation failed").WithFields(fields)
 }
 
-func (e ApiError) SendStatus(c *fiber.Ctx, s int) error {
-	return c.Status(s).JSON(e)
+// WithFields sets the errors of the fields of the request body
+func (e *AppError) WithFields(fields map[string]string) *AppError {
+	e.Fields = fields
+	return e
+}
+
+// WithCurrent sets the current state of the resource of a conflict, so the client can
+// merge its change into it without reading it again
+func (e *AppError) WithCurrent(current interface{}) *AppError {
+	e.Current = current
+	return e
+}
+
+// WithQuota sets the limit a change went over, so the client can show the upgrade
+func (e *AppError) WithQuota(quota interface{}) *AppError {
+	e.Quota = quota
+	return e
+}
+
+// ErrorCode returns the code of a status, e.g. not_found for 404
+func ErrorCode(status int) string {
+	if code, ok := errorCodes[status]; ok {
+		return code
+	}
+
+	return strings.ReplaceAll(strings.ToLower(http.StatusText(status)), " ", "_")
 }
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// ExportRetention is how long the archive of a data export can be downloaded
+const ExportRetention = 7 * 24 * time.Hour
+
+// The statuses of a data export
+const (
+	ExportPending = "pending"
+	ExportReady   = "ready"
+	ExportFailed  = "failed"
+)
+
+// DataExport is an archive of all the data of a user, built in the background
+type DataExport struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"index"`
+	Status string `gorm:"size:16"`
+	// StorageKey is the archive in the storage, empty until it is ready
+	StorageKey string
+	Size       int64
+	Error      string
+	CreatedAt  time.Time
+	// ExpiresAt is when the archive is removed, set once it is ready
+	ExpiresAt   *time.Time `gorm:"index"`
+	CompletedAt *time.Time
+}
+
+type DataExportApi struct {
+	ID     uint   `json:"id"`
+	Status string `json:"status"`
+	Size   int64  `json:"size"`
+	Error  string `json:"error,omitempty"`
+	// URL is a download link of a ready archive
+	URL         string     `json:"url,omitempty"`
+	CreatedAt   time.Time  `json:"createdAt"`
+	CompletedAt *time.Time `json:"completedAt"`
+	ExpiresAt   *time.Time `json:"expiresAt"`
+}
+
+func (e DataExport) Api(url string) DataExportApi {
+	return DataExportApi{
+		ID:          e.ID,
+		Status:      e.Status,
+		Size:        e.Size,
+		Error:       e.Error,
+		URL:         url,
+		CreatedAt:   e.CreatedAt.UTC(),
+		CompletedAt: UTC(e.CompletedAt),
+		ExpiresAt:   UTC(e.ExpiresAt),
+	}
+}
@@ -0,0 +1,41 @@
+package models
+
+import "gorm.io/gorm"
+
+// Filter is a saved query of tasks of a user, a smart list like Urgent this week for
+// label:urgent AND due<7d. The query is read by ParseFilterQuery when the filter is run.
+type Filter struct {
+	gorm.Model
+	UserID uint `gorm:"index"`
+	Name   string
+	Query  string
+	// Sort is the order of the tasks, one of the sorts of the task list
+	Sort string
+}
+
+type FilterApi struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Query     string `json:"query"`
+	Sort      string `json:"sort"`
+	CreatedAt string `json:"createdAt"`
+	UpdatedAt string `json:"updatedAt"`
+}
+
+// FilterInput is the body of the filter create and update
+type FilterInput struct {
+	Name  string `json:"name" validate:"notblank,max=100"`
+	Query string `json:"query" validate:"notblank,max=500,filterquery"`
+	Sort  string `json:"sort" validate:"omitempty,oneof=position priority due"`
+}
+
+func (f Filter) Api() FilterApi {
+	return FilterApi{
+		ID:        f.ID,
+		Name:      f.Name,
+		Query:     f.Query,
+		Sort:      f.Sort,
+		CreatedAt: Timestamp(f.CreatedAt),
+		UpdatedAt: Timestamp(f.UpdatedAt),
+	}
+}
@@ -0,0 +1,372 @@
+package models
+
+import (
+	"errors"
+	"fmt"
+	"gorm.io/gorm"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// maxFilterTerms bounds the terms of a query, each one is a condition of the SQL
+const maxFilterTerms = 30
+
+var (
+	filterTermRe     = regexp.MustCompile(`^([a-z]+)(:|<=|>=|<|>)(.+)$`)
+	filterRelativeRe = regexp.MustCompile(`^(-?\d{1,4})([dw])$`)
+)
+
+// FilterQuery is a parsed query of a saved filter, see ParseFilterQuery
+type FilterQuery struct {
+	root filterNode
+}
+
+// filterEnv is what the terms are relative to: the user for assignee:me, now for the dates
+type filterEnv struct {
+	userID uint
+	now    time.Time
+}
+
+// filterNode is a node of a query, it returns its condition with its variables
+type filterNode interface {
+	sql(env filterEnv) (string, []interface{})
+}
+
+type filterAnd struct{ left, right filterNode }
+
+type filterOr struct{ left, right filterNode }
+
+type filterNot struct{ node filterNode }
+
+type filterTerm struct {
+	field, op, value string
+}
+
+// ParseFilterQuery reads a query of tasks. Its terms are joined by AND, which is implied between
+// two terms, and OR, which binds less; NOT or - negates a term and parentheses group them:
+//   - label:urgent, status:done, status:todo or status:open, priority:1 or priority<=2
+//   - due<7d, due>=2w, due<2026-10-20, due:today, due:tomorrow, due:overdue or due:none
+//   - assignee:me, assignee:none or assignee:ada, project:12 and workspace:3 by id
+//   - another word or a "quoted text" is searched in the title and the description
+//
+// e.g. label:urgent AND due<7d, or (priority:1 OR label:bug) -status:done
+func ParseFilterQuery(query string) (*FilterQuery, error) {
+	tokens, err := filterTokens(query)
+	if err != nil {
+		return nil, err
+	}
+	if len(tokens) == 0 {
+		return nil, errors.New("the query is empty")
+	}
+
+	p := &filterParser{tokens: tokens}
+	root, err := p.or()
+	if err != nil {
+		return nil, err
+	}
+	if p.pos < len(p.tokens) {
+		return nil, fmt.Errorf("unexpected %s", p.tokens[p.pos])
+	}
+	if p.terms > maxFilterTerms {
+		return nil, fmt.Errorf("the query has more than %d terms", maxFilterTerms)
+	}
+
+	return &FilterQuery{root: root}, nil
+}
+
+// Scope narrows a query of tasks to the ones matching, the relative dates are from now and its zone
+func (q *FilterQuery) Scope(userID uint, now time.Time) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		sql, vars := q.root.sql(filterEnv{userID: userID, now: now})
+		return tx.Where(sql, vars...)
+	}
+}
+
+func (n filterAnd) sql(env filterEnv) (string, []interface{}) {
+	left, leftVars := n.left.sql(env)
+	right, rightVars := n.right.sql(env)
+	return "(" + left + " AND " + right + ")", append(leftVars, rightVars...)
+}
+
+func (n filterOr) sql(env filterEnv) (string, []interface{}) {
+	left, leftVars := n.left.sql(env)
+	right, rightVars := n.right.sql(env)
+	return "(" + left + " OR " + right + ")", append(leftVars, rightVars...)
+}
+
+// sql of a NOT matches the rows where the condition is NULL too, so -assignee:me matches the
+// unassigned tasks
+func (n filterNot) sql(env filterEnv) (string, []interface{}) {
+	sql, vars := n.node.sql(env)
+	return "CASE WHEN " + sql + " THEN 1 ELSE 0 END = 0", vars
+}
+
+func (t filterTerm) sql(env filterEnv) (string, []interface{}) {
+	switch t.field {
+	case "label":
+		return "tasks.id IN (SELECT task_labels.task_id FROM task_labels JOIN labels ON labels.id = task_labels.label_id WHERE labels.name = ?)", []interface{}{t.value}
+	case "status":
+		switch t.value {
+		case "open":
+			return "tasks.status <> ?", []interface{}{StatusDone}
+		case StatusTodo:
+			// the tasks without a status are to do, like in the first column of a board
+			return "tasks.status IN ?", []interface{}{[]string{StatusTodo, ""}}
+		}
+		return "tasks.status = ?", []interface{}{t.value}
+	case "priority":
+		priority, _ := strconv.Atoi(t.value)
+		return "tasks.priority " + sqlOp(t.op) + " ?", []interface{}{priority}
+	case "assignee":
+		switch t.value {
+		case "me":
+			return "tasks.assignee_id = ?", []interface{}{env.userID}
+		case "none":
+			return "tasks.assignee_id IS NULL", nil
+		}
+		return "tasks.assignee_id IN (SELECT id FROM users WHERE username = ?)", []interface{}{t.value}
+	case "project", "workspace":
+		id, _ := strconv.ParseUint(t.value, 10, 64)
+		return "tasks." + t.field + "_id = ?", []interface{}{uint(id)}
+	case "due":
+		return t.dueSQL(env.now)
+	}
+
+	pattern := "%" + strings.ToLower(t.value) + "%"
+	return "(LOWER(tasks.title) LIKE ? OR LOWER(tasks.description) LIKE ?)", []interface{}{pattern, pattern}
+}
+
+// dueSQL compares the due date: a relative date like 7d is an instant from now, a day is the
+// span of the day in the zone of now
+func (t filterTerm) dueSQL(now time.Time) (string, []interface{}) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	switch t.value {
+	case "none":
+		return "tasks.due_at IS NULL", nil
+	case "overdue":
+		return "tasks.due_at < ? AND tasks.status <> ?", []interface{}{now.Truncate(time.Minute), StatusDone}
+	}
+
+	if match := filterRelativeRe.FindStringSubmatch(t.value); match != nil {
+		n, _ := strconv.Atoi(match[1])
+		if match[2] == "w" {
+			n *= 7
+		}
+		at := now.Truncate(time.Minute).AddDate(0, 0, n)
+		return "tasks.due_at " + sqlOp(t.op) + " ?", []interface{}{at}
+	}
+
+	day := today
+	switch t.value {
+	case "today":
+	case "tomorrow":
+		day = today.AddDate(0, 0, 1)
+	default:
+		day, _ = time.ParseInLocation("2006-01-02", t.value, now.Location())
+	}
+	next := day.AddDate(0, 0, 1)
+
+	switch t.op {
+	case "<":
+		return "tasks.due_at < ?", []interface{}{day}
+	case "<=":
+		return "tasks.due_at < ?", []interface{}{next}
+	case ">":
+		return "tasks.due_at >= ?", []interface{}{next}
+	case ">=":
+		return "tasks.due_at >= ?", []interface{}{day}
+	}
+	return "tasks.due_at >= ? AND tasks.due_at < ?", []interface{}{day, next}
+}
+
+// sqlOp is the SQL comparison of an operator of the query, : is the equality
+func sqlOp(op string) string {
+	if op == ":" {
+		return "="
+	}
+	return op
+}
+
+type filterParser struct {
+	tokens []string
+	pos    int
+	terms  int
+}
+
+func (p *filterParser) peek() string {
+	if p.pos < len(p.tokens) {
+		return p.tokens[p.pos]
+	}
+	return ""
+}
+
+func (p *filterParser) or() (filterNode, error) {
+	node, err := p.and()
+	if err != nil {
+		return nil, err
+	}
+	for p.peek() == "OR" {
+		p.pos++
+		right, err := p.and()
+		if err != nil {
+			return nil, err
+		}
+		node = filterOr{node, right}
+	}
+
+	return node, nil
+}
+
+func (p *filterParser) and() (filterNode, error) {
+	node, err := p.unary()
+	if err != nil {
+		return nil, err
+	}
+	for {
+		next := p.peek()
+		if next == "" || next == "OR" || next == ")" {
+			return node, nil
+		}
+		if next == "AND" {
+			p.pos++
+		}
+		right, err := p.unary()
+		if err != nil {
+			return nil, err
+		}
+		node = filterAnd{node, right}
+	}
+}
+
+func (p *filterParser) unary() (filterNode, error) {
+	token := p.peek()
+	switch {
+	case token == "":
+		return nil, errors.New("the query ends with an operator")
+	case token == "NOT":
+		p.pos++
+		node, err := p.unary()
+		return filterNot{node}, err
+	case token == "(":
+		p.pos++
+		node, err := p.or()
+		if err != nil {
+			return nil, err
+		}
+		if p.peek() != ")" {
+			return nil, errors.New("a parenthesis is not closed")
+		}
+		p.pos++
+		return node, nil
+	case token == ")" || token == "AND" || token == "OR":
+		return nil, fmt.Errorf("unexpected %s", token)
+	case strings.HasPrefix(token, "-") && len(token) > 1 && !filterRelativeRe.MatchString(token):
+		p.tokens[p.pos] = token[1:]
+		node, err := p.unary()
+		return filterNot{node}, err
+	}
+
+	p.pos++
+	p.terms++
+	return parseFilterTerm(token)
+}
+
+// parseFilterTerm reads a term, a word without a known field is a text. The quotes of a text
+// are kept by filterTokens so a quoted field:value is a text too.
+func parseFilterTerm(token string) (filterNode, error) {
+	if strings.HasPrefix(token, `"`) {
+		return filterTerm{value: strings.Trim(token, `"`)}, nil
+	}
+
+	match := filterTermRe.FindStringSubmatch(token)
+	if match == nil {
+		return filterTerm{value: token}, nil
+	}
+	t := filterTerm{field: match[1], op: match[2], value: strings.Trim(match[3], `"`)}
+
+	switch t.field {
+	case "label", "assignee":
+		return t, t.only(":")
+	case "status":
+		if len(t.value) > 32 {
+			return nil, errors.New("the status is at most 32 characters long")
+		}
+		return t, t.only(":")
+	case "project", "workspace":
+		if id, err := strconv.ParseUint(t.value, 10, 32); err != nil || id == 0 {
+			return nil, fmt.Errorf("the %s must be an id", t.field)
+		}
+		return t, t.only(":")
+	case "priority":
+		if p, err := strconv.Atoi(t.value); err != nil || p < PriorityP1 || p > PriorityP4 {
+			return nil, errors.New("the priority must be 1 to 4")
+		}
+		return t, nil
+	case "due":
+		switch {
+		case t.value == "none" || t.value == "overdue":
+			return t, t.only(":")
+		case filterRelativeRe.MatchString(t.value):
+			if t.op == ":" {
+				return nil, fmt.Errorf("a relative due date is compared with < or >, like due<%s", t.value)
+			}
+			return t, nil
+		case t.value == "today" || t.value == "tomorrow":
+			return t, nil
+		}
+		if _, err := time.Parse("2006-01-02", t.value); err != nil {
+			return nil, errors.New("the due date must be like 7d, 2w, 2026-10-20, today, tomorrow, overdue or none")
+		}
+		return t, nil
+	}
+
+	return nil, fmt.Errorf("unknown field %s, it must be label, status, priority, due, assignee, project or workspace", t.field)
+}
+
+// only checks the operator of a term which is not compared
+func (t filterTerm) only(op string) error {
+	if t.op != op {
+		return fmt.Errorf("the %s is matched with %s", t.field, op)
+	}
+	return nil
+}
+
+// filterTokens splits a query into its words, parentheses and quoted texts
+func filterTokens(query string) ([]string, error) {
+	var tokens []string
+	var word strings.Builder
+	quoted := false
+	flush := func() {
+		if word.Len() > 0 {
+			tokens = append(tokens, word.String())
+			word.Reset()
+		}
+	}
+
+	for _, r := range query {
+		switch {
+		case r == '"':
+			quoted = !quoted
+			word.WriteRune(r)
+		case quoted:
+			word.WriteRune(r)
+		case r == '(' || r == ')':
+			flush()
+			tokens = append(tokens, string(r))
+		case r == ' ' || r == '\t' || r == '\n':
+			flush()
+		default:
+			word.WriteRune(r)
+		}
+	}
+	if quoted {
+		return nil, errors.New("a quote is not closed")
+	}
+	flush()
+
+	return tokens, nil
+}
@@ -0,0 +1,87 @@
+package models
+
+import "time"
+
+// The states of a GitHub issue
+const (
+	IssueOpen   = "open"
+	IssueClosed = "closed"
+)
+
+// GitHubIntegration links a project to a GitHub repository. Its issues are imported as tasks
+// of the project, and its webhook keeps them in sync.
+type GitHubIntegration struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	ProjectID uint `gorm:"uniqueIndex"`
+	// CreatedBy is the user who linked the repository, the tasks of the issues are theirs
+	CreatedBy uint
+	// Repository is owner/name, a repository can be linked to several projects
+	Repository string `gorm:"index"`
+	// Token is a token of GitHub reading the issues, and writing them to comment
+	Token string
+	// WebhookSecret signs the deliveries of the webhook of the repository
+	WebhookSecret string
+	// SyncStatus completes the task of an issue closed on GitHub, and reopens it with the issue
+	SyncStatus bool
+	// CommentOnCompletion comments on the issue of a task completed in the app
+	CommentOnCompletion bool
+	// ImportNew adds the issues opened after the link as tasks
+	ImportNew bool
+}
+
+// TableName keeps GitHub one word, GORM names the table git_hub_integrations
+func (GitHubIntegration) TableName() string {
+	return "github_integrations"
+}
+
+// GitHubIssue is the issue a task was imported from
+type GitHubIssue struct {
+	TaskID        uint `gorm:"primaryKey;autoIncrement:false"`
+	IntegrationID uint `gorm:"uniqueIndex:idx_github_issues_number"`
+	Number        int  `gorm:"uniqueIndex:idx_github_issues_number"`
+	URL           string
+	// State is the state of the issue on GitHub, open or closed
+	State string
+}
+
+func (GitHubIssue) TableName() string {
+	return "github_issues"
+}
+
+// GitHubIntegrationInput links a project to a repository, the token is kept when it is empty
+type GitHubIntegrationInput struct {
+	Repository          string `json:"repository" validate:"required,max=140"`
+	Token               string `json:"token" validate:"max=255"`
+	SyncStatus          bool   `json:"syncStatus"`
+	CommentOnCompletion bool   `json:"commentOnCompletion"`
+	ImportNew           bool   `json:"importNew"`
+}
+
+type GitHubIntegrationApi struct {
+	ProjectID           uint   `json:"projectId"`
+	Repository          string `json:"repository"`
+	SyncStatus          bool   `json:"syncStatus"`
+	CommentOnCompletion bool   `json:"commentOnCompletion"`
+	ImportNew           bool   `json:"importNew"`
+	// WebhookURL is where the webhook of the repository delivers the issues events
+	WebhookURL string `json:"webhookUrl"`
+	// WebhookSecret is the secret of the webhook, sent once when the repository is linked
+	WebhookSecret string `json:"webhookSecret,omitempty"`
+	CreatedBy     uint   `json:"createdBy"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+func (g GitHubIntegration) Api(webhookURL string) GitHubIntegrationApi {
+	return GitHubIntegrationApi{
+		ProjectID:           g.ProjectID,
+		Repository:          g.Repository,
+		SyncStatus:          g.SyncStatus,
+		CommentOnCompletion: g.CommentOnCompletion,
+		ImportNew:           g.ImportNew,
+		WebhookURL:          webhookURL,
+		CreatedBy:           g.CreatedBy,
+		CreatedAt:           Timestamp(g.CreatedAt),
+	}
+}
@@ -0,0 +1,27 @@
+package models
+
+import "time"
+
+// IdempotencyRetention is how long the responses are replayed to the retries of their request
+const IdempotencyRetention = 24 * time.Hour
+
+// IdempotencyKey is the response of a request sent with an Idempotency-Key header,
+// replayed to the retries of the request instead of running it again
+type IdempotencyKey struct {
+	ID uint `gorm:"primaryKey"`
+	// Scope is the user of the request, empty for the requests before the signup
+	Scope string `gorm:"size:64;uniqueIndex:idx_idempotency_keys_scope_key"`
+	Key   string `gorm:"size:255;uniqueIndex:idx_idempotency_keys_scope_key"`
+	// RequestHash is the HMAC of the method, path and body, a retry must send the same request
+	RequestHash string `gorm:"size:64"`
+	// Status is 0 while the first request is in progress
+	Status int
+	// Header are the headers to replay, as JSON
+	Header string
+	// Body is a string so it is encrypted like the other columns, the column stays binary
+	Body string `gorm:"type:bytes"`
+	// SessionUserID is the user signed in by the response, which is not stored: a retry is
+	// refused and the client logs in
+	SessionUserID uint
+	CreatedAt     time.Time `gorm:"index"`
+}
@@ -0,0 +1,59 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// Impersonation is an admin acting as a user with a short-lived access token, for support.
+// The token is identified by its Fingerprint, so the impersonation can be ended before it expires.
+type Impersonation struct {
+	gorm.Model
+	AdminID uint `gorm:"index"`
+	UserID  uint `gorm:"index"`
+	// Reason is why the admin acts as the user, e.g. the ticket of the support request
+	Reason    string `gorm:"size:255"`
+	TokenHash string `gorm:"size:64;uniqueIndex"`
+	ExpiresAt time.Time
+	EndedAt   *time.Time
+}
+
+// Active tells whether the token of the impersonation is still accepted at the time
+func (i Impersonation) Active(now time.Time) bool {
+	return i.EndedAt == nil && now.Before(i.ExpiresAt)
+}
+
+// ImpersonationInput is the body of the start of an impersonation
+type ImpersonationInput struct {
+	Reason string `json:"reason" validate:"notblank,max=255"`
+}
+
+type ImpersonationApi struct {
+	ID        uint   `json:"id"`
+	AdminID   uint   `json:"adminId"`
+	UserID    uint   `json:"userId"`
+	Reason    string `json:"reason"`
+	Active    bool   `json:"active"`
+	ExpiresAt string `json:"expiresAt"`
+	EndedAt   string `json:"endedAt,omitempty"`
+	CreatedAt string `json:"createdAt"`
+	// AccessToken acts as the user, only known when the impersonation starts
+	AccessToken string `json:"accessToken,omitempty"`
+}
+
+func (i Impersonation) Api() ImpersonationApi {
+	api := ImpersonationApi{
+		ID:        i.ID,
+		AdminID:   i.AdminID,
+		UserID:    i.UserID,
+		Reason:    i.Reason,
+		Active:    i.Active(time.Now()),
+		ExpiresAt: Timestamp(i.ExpiresAt),
+		CreatedAt: Timestamp(i.CreatedAt),
+	}
+	if i.EndedAt != nil {
+		api.EndedAt = Timestamp(*i.EndedAt)
+	}
+
+	return api
+}
@@ -0,0 +1,64 @@
+package models
+
+import "time"
+
+// FailedJob is a background job which failed its last attempt, kept for the admins to
+// inspect and retry. The job runs again from its first attempt when it is retried.
+type FailedJob struct {
+	ID uint `gorm:"primaryKey"`
+	// JobID is the id the job was queued with
+	JobID    string `gorm:"size:64;index"`
+	Kind     string `gorm:"size:64;index"`
+	Payload  string `gorm:"type:text"`
+	Attempts int
+	Error    string `gorm:"type:text"`
+	// QueuedAt is when the job was queued, CreatedAt when it failed
+	QueuedAt  time.Time
+	CreatedAt time.Time `gorm:"index"`
+}
+
+type FailedJobApi struct {
+	ID       uint   `json:"id"`
+	JobID    string `json:"jobId"`
+	Kind     string `json:"kind"`
+	Payload  string `json:"payload"`
+	Attempts int    `json:"attempts"`
+	Error    string `json:"error"`
+	QueuedAt string `json:"queuedAt"`
+	FailedAt string `json:"failedAt"`
+}
+
+func (j FailedJob) Api() FailedJobApi {
+	return FailedJobApi{
+		ID:       j.ID,
+		JobID:    j.JobID,
+		Kind:     j.Kind,
+		Payload:  j.Payload,
+		Attempts: j.Attempts,
+		Error:    j.Error,
+		QueuedAt: Timestamp(j.QueuedAt),
+		FailedAt: Timestamp(j.CreatedAt),
+	}
+}
+
+// ScheduledJobApi is a periodic job of an instance, with its last run there
+type ScheduledJobApi struct {
+	Name     string     `json:"name"`
+	Enabled  bool       `json:"enabled"`
+	Every    string     `json:"every"`
+	Running  bool       `json:"running"`
+	Runs     int        `json:"runs"`
+	Failures int        `json:"failures"`
+	LastRun  *JobRunApi `json:"lastRun"`
+	// NextRunAt is empty for a disabled job
+	NextRunAt string `json:"nextRunAt,omitempty"`
+}
+
+// JobRunApi is a run of a periodic job, items counts what it handled
+type JobRunApi struct {
+	StartedAt  string `json:"startedAt"`
+	DurationMs int64  `json:"durationMs"`
+	Items      int    `json:"items"`
+	Success    bool   `json:"success"`
+	Error      string `json:"error,omitempty"`
+}
@@ -0,0 +1,25 @@
+package models
+
+import "gorm.io/gorm"
+
+type Label struct {
+	gorm.Model
+	UserID uint
+	Name   string `json:"name"`
+	Color  string `json:"color"`
+	Tasks  []Task `gorm:"many2many:task_labels;"`
+}
+
+type LabelApi struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Color string `json:"color"`
+}
+
+func (l Label) Api() LabelApi {
+	return LabelApi{
+		ID:    l.ID,
+		Name:  l.Name,
+		Color: l.Color,
+	}
+}
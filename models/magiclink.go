@@ -0,0 +1,17 @@
+package models
+
+import "time"
+
+// MagicLink is a login link emailed to a user, it is deleted when it is used so it logs in once.
+// The token of the link is identified by its Fingerprint.
+type MagicLink struct {
+	TokenHash string    `gorm:"primaryKey;size:64"`
+	UserID    uint      `gorm:"index"`
+	ExpiresAt time.Time `gorm:"index"`
+	CreatedAt time.Time
+}
+
+// MagicLinkInput is the body of the request of a login link
+type MagicLinkInput struct {
+	Email string `json:"email" validate:"required,email,max=255"`
+}
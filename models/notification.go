@@ -0,0 +1,104 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// The kinds of the notifications, a user chooses the channels of every kind
+const (
+	NotifyAssigned  = "assigned"
+	NotifyMentioned = "mentioned"
+	NotifyCommented = "commented"
+	NotifyDue       = "due"
+	// NotifyUpdated tells the watchers of a task about its changes
+	NotifyUpdated = "updated"
+	// NotifyDigest is the daily email of the due and overdue tasks, it is never in the app
+	NotifyDigest = "digest"
+	// NotifyExport tells a user the archive of the data export is ready
+	NotifyExport = "export"
+)
+
+// NotificationKinds are the kinds in the order they are listed
+var NotificationKinds = []string{NotifyAssigned, NotifyMentioned, NotifyCommented, NotifyDue, NotifyUpdated, NotifyDigest, NotifyExport}
+
+// Notification is an in-app notification of a user, unread until ReadAt is set
+type Notification struct {
+	gorm.Model
+	UserID  uint `gorm:"index"`
+	Kind    string
+	TaskID  *uint
+	ActorID uint
+	Title   string
+	Body    string `gorm:"type:text"`
+	ReadAt  *time.Time
+}
+
+// NotificationPreference is the channels of a kind of notification for a user.
+// A kind without a row has the channels of DefaultPreference.
+type NotificationPreference struct {
+	ID     uint   `gorm:"primaryKey"`
+	UserID uint   `gorm:"uniqueIndex:idx_notification_preference_user_kind"`
+	Kind   string `gorm:"uniqueIndex:idx_notification_preference_user_kind"`
+	InApp  bool
+	Email  bool
+	// Push sends the notifications to the devices of the mobile apps of the user
+	Push bool
+}
+
+type NotificationApi struct {
+	ID        uint       `json:"id"`
+	Kind      string     `json:"kind"`
+	TaskID    *uint      `json:"taskId"`
+	ActorID   uint       `json:"actorId"`
+	Title     string     `json:"title"`
+	Body      string     `json:"body"`
+	Read      bool       `json:"read"`
+	ReadAt    *time.Time `json:"readAt"`
+	CreatedAt time.Time  `json:"createdAt"`
+}
+
+type NotificationPreferenceApi struct {
+	Kind  string `json:"kind" validate:"oneof=assigned mentioned commented due updated digest export"`
+	InApp bool   `json:"inApp"`
+	Email bool   `json:"email"`
+	// Push is kept by an update without it
+	Push *bool `json:"push,omitempty"`
+}
+
+// PreferencesInput is the body of the preferences update, the kinds not given are unchanged
+type PreferencesInput struct {
+	Preferences []NotificationPreferenceApi `json:"preferences" validate:"required,max=10,dive"`
+}
+
+// DefaultPreference returns the channels of a kind the user did not choose:
+// everything is in the app, what is addressed to the user is emailed too with the digest and the exports,
+// and the mentions and the due reminders are pushed to the devices
+func DefaultPreference(userID uint, kind string) NotificationPreference {
+	return NotificationPreference{
+		UserID: userID,
+		Kind:   kind,
+		InApp:  kind != NotifyDigest,
+		Email:  kind == NotifyAssigned || kind == NotifyMentioned || kind == NotifyDigest || kind == NotifyExport,
+		Push:   kind == NotifyMentioned || kind == NotifyDue,
+	}
+}
+
+func (n Notification) Api() NotificationApi {
+	return NotificationApi{
+		ID:        n.ID,
+		Kind:      n.Kind,
+		TaskID:    n.TaskID,
+		ActorID:   n.ActorID,
+		Title:     n.Title,
+		Body:      n.Body,
+		Read:      n.ReadAt != nil,
+		ReadAt:    UTC(n.ReadAt),
+		CreatedAt: n.CreatedAt.UTC(),
+	}
+}
+
+func (p NotificationPreference) Api() NotificationPreferenceApi {
+	push := p.Push
+	return NotificationPreferenceApi{Kind: p.Kind, InApp: p.InApp, Email: p.Email, Push: &push}
+}
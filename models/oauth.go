@@ -0,0 +1,11 @@
+package models
+
+import "gorm.io/gorm"
+
+// OAuthAccount links a user to an identity of an OAuth provider
+type OAuthAccount struct {
+	gorm.Model
+	UserID     uint
+	Provider   string `gorm:"uniqueIndex:idx_oauth_provider_id"`
+	ProviderID string `gorm:"uniqueIndex:idx_oauth_provider_id"`
+}
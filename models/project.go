@@ -0,0 +1,78 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"task-app/markdown"
+	"time"
+)
+
+type Project struct {
+	gorm.Model
+	UserID      uint
+	WorkspaceID *uint
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// ArchivedAt is when the project was archived, its tasks are left out of the lists with it
+	ArchivedAt *time.Time `gorm:"index"`
+	Tasks      []Task     `gorm:"foreignKey:ProjectID"`
+}
+
+type ProjectApi struct {
+	ID          uint   `json:"id"`
+	WorkspaceID *uint  `json:"workspaceId"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// DescriptionHTML is the description rendered from Markdown and sanitized
+	DescriptionHTML string `json:"descriptionHtml"`
+	ArchivedAt      string `json:"archivedAt,omitempty"`
+	CreatedAt       string `json:"createdAt"`
+	UpdatedAt       string `json:"updatedAt"`
+}
+
+func (p Project) Api() ProjectApi {
+	api := ProjectApi{
+		ID:              p.ID,
+		WorkspaceID:     p.WorkspaceID,
+		Title:           p.Title,
+		Description:     p.Description,
+		DescriptionHTML: markdown.Render(p.Description),
+		CreatedAt:       Timestamp(p.CreatedAt),
+		UpdatedAt:       Timestamp(p.UpdatedAt),
+	}
+	if p.ArchivedAt != nil {
+		api.ArchivedAt = Timestamp(*p.ArchivedAt)
+	}
+
+	return api
+}
+
+// StatusTodo is the status of the first column of a board, the tasks without a status are in it
+const StatusTodo = "todo"
+
+// StatusInProgress is the status of the second column of a board
+const StatusInProgress = "in_progress"
+
+// BoardColumns are the columns every board has, the other statuses of its tasks follow them
+var BoardColumns = []string{StatusTodo, StatusInProgress, StatusDone}
+
+// BoardApi is the kanban board of a project, its tasks grouped by status
+type BoardApi struct {
+	Project ProjectApi       `json:"project"`
+	Columns []BoardColumnApi `json:"columns"`
+}
+
+// BoardColumnApi is a page of the tasks of a status, in the order of their positions
+type BoardColumnApi struct {
+	Status  string    `json:"status"`
+	Count   int64     `json:"count"`
+	Tasks   []TaskApi `json:"tasks"`
+	HasMore bool      `json:"hasMore"`
+}
+
+// BoardMoveInput moves a card to the index of a column, counted from 0. An index past the
+// last card puts it at the end of the column.
+type BoardMoveInput struct {
+	TaskID uint   `json:"taskId" validate:"required"`
+	Status string `json:"status" validate:"notblank,max=32"`
+	Index  int    `json:"index" validate:"min=0"`
+}
@@ -0,0 +1,53 @@
+package models
+
+import "time"
+
+// The push services of the devices
+const (
+	ProviderFCM  = "fcm"
+	ProviderAPNs = "apns"
+)
+
+// PushDevice is a device of a mobile app the push notifications of its user are sent to
+type PushDevice struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint `gorm:"index"`
+	// Provider is fcm for the Android devices, apns for the iOS ones
+	Provider string
+	// Token is the token the push service gave the app, a token registered again moves to the user registering it
+	Token string `gorm:"uniqueIndex;size:512"`
+	Name  string
+	// Sandbox sends to the sandbox of APNs, for the development builds of the iOS app
+	Sandbox bool
+	// LastSeenAt is the last registration of the device, the apps register at every launch
+	LastSeenAt time.Time `gorm:"index"`
+}
+
+type PushDeviceInput struct {
+	Provider string `json:"provider" validate:"oneof=fcm apns"`
+	Token    string `json:"token" validate:"notblank,max=512"`
+	Name     string `json:"name" validate:"max=100"`
+	Sandbox  bool   `json:"sandbox"`
+}
+
+type PushDeviceApi struct {
+	ID         uint   `json:"id"`
+	Provider   string `json:"provider"`
+	Name       string `json:"name"`
+	Sandbox    bool   `json:"sandbox"`
+	LastSeenAt string `json:"lastSeenAt"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+func (d PushDevice) Api() PushDeviceApi {
+	return PushDeviceApi{
+		ID:         d.ID,
+		Provider:   d.Provider,
+		Name:       d.Name,
+		Sandbox:    d.Sandbox,
+		LastSeenAt: Timestamp(d.LastSeenAt),
+		CreatedAt:  Timestamp(d.CreatedAt),
+	}
+}
@@ -0,0 +1,204 @@
+package models
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"gorm.io/gorm"
+	"time"
+)
+
+type authorKey struct{}
+
+// TaskRevision is a version of a task, written on every update changing one of the fields of
+// TaskState. It keeps the fields as they were before the update, so a revert restores them.
+type TaskRevision struct {
+	ID     uint `gorm:"primaryKey"`
+	TaskID uint `gorm:"index"`
+	// Version is the version of the task made by the update
+	Version uint
+	// AuthorID is the user who made the update, nil for the jobs
+	AuthorID *uint
+	Author   User `gorm:"foreignKey:AuthorID"`
+	// Changes are the changed fields by their name in the API, as a JSON object of FieldChange
+	Changes string `gorm:"type:text"`
+	// Previous is the TaskState before the update as JSON
+	Previous  string `gorm:"type:text"`
+	CreatedAt time.Time
+}
+
+type TaskRevisionApi struct {
+	ID       uint  `json:"id"`
+	TaskID   uint  `json:"taskId"`
+	Version  uint  `json:"version"`
+	AuthorID *uint `json:"authorId"`
+	// Author is the username of the author, empty for the jobs
+	Author    string                 `json:"author"`
+	Changes   map[string]FieldChange `json:"changes"`
+	CreatedAt string                 `json:"createdAt"`
+}
+
+// FieldChange is the value of a field before and after an update
+type FieldChange struct {
+	From json.RawMessage `json:"from"`
+	To   json.RawMessage `json:"to"`
+}
+
+// TaskState are the fields of a task kept by its revisions
+type TaskState struct {
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	DueAt       *time.Time `json:"dueAt"`
+	Recurrence  string     `json:"recurrence"`
+	Priority    int        `json:"priority"`
+	AssigneeID  *uint      `json:"assigneeId"`
+	ProjectID   *uint      `json:"projectId"`
+	WorkspaceID *uint      `json:"workspaceId"`
+	ArchivedAt  *time.Time `json:"archivedAt"`
+}
+
+func (r TaskRevision) Api() TaskRevisionApi {
+	changes := map[string]FieldChange{}
+	_ = json.Unmarshal([]byte(r.Changes), &changes)
+
+	return TaskRevisionApi{
+		ID:        r.ID,
+		TaskID:    r.TaskID,
+		Version:   r.Version,
+		AuthorID:  r.AuthorID,
+		Author:    r.Author.Username,
+		Changes:   changes,
+		CreatedAt: Timestamp(r.CreatedAt),
+	}
+}
+
+// PreviousState returns the fields of the task before the revision
+func (r TaskRevision) PreviousState() (TaskState, error) {
+	var state TaskState
+	err := json.Unmarshal([]byte(r.Previous), &state)
+
+	return state, err
+}
+
+// State returns the fields of the task kept by the revisions
+func (t Task) State() TaskState {
+	return TaskState{
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status,
+		DueAt:       UTC(t.DueAt),
+		Recurrence:  t.Recurrence,
+		Priority:    t.Priority,
+		AssigneeID:  t.AssigneeID,
+		ProjectID:   t.ProjectID,
+		WorkspaceID: t.WorkspaceID,
+		ArchivedAt:  UTC(t.ArchivedAt),
+	}
+}
+
+// Input returns the update restoring the content of the task to the state. The assignee, the
+// project and the archive are left as they are, their own routes check who may change them.
+func (s TaskState) Input() TaskInput {
+	return TaskInput{
+		Title:       s.Title,
+		Description: s.Description,
+		Status:      s.Status,
+		DueAt:       s.DueAt,
+		Recurrence:  s.Recurrence,
+		Priority:    s.Priority,
+	}
+}
+
+// Diff returns the fields changed from s to next by their name in the API
+func (s TaskState) Diff(next TaskState) map[string]FieldChange {
+	from, to := s.fields(), next.fields()
+	changes := map[string]FieldChange{}
+	for name, value := range from {
+		if !bytes.Equal(value, to[name]) {
+			changes[name] = FieldChange{From: value, To: to[name]}
+		}
+	}
+
+	return changes
+}
+
+func (s TaskState) fields() map[string]json.RawMessage {
+	fields := map[string]json.RawMessage{}
+	data, _ := json.Marshal(s)
+	_ = json.Unmarshal(data, &fields)
+
+	return fields
+}
+
+// WithAuthor returns the context of the queries of a user, the revisions of the updates made
+// with it are written with the user as their author
+func WithAuthor(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, authorKey{}, id)
+}
+
+// AuthorOf returns the user of WithAuthor, nil when there is none
+func AuthorOf(ctx context.Context) *uint {
+	if ctx == nil {
+		return nil
+	}
+	if id, ok := ctx.Value(authorKey{}).(uint); ok {
+		return &id
+	}
+
+	return nil
+}
+
+// BeforeUpdate reads the task as it is before the update for the revision of AfterUpdate. The
+// updates of many tasks at once, without the id of the task, are not versioned.
+func (t *Task) BeforeUpdate(tx *gorm.DB) error {
+	if t.ID == 0 {
+		return nil
+	}
+
+	var before Task
+	if err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().First(&before, t.ID).Error; err != nil {
+		return err
+	}
+	state := before.State()
+	t.before = &state
+
+	return nil
+}
+
+// AfterUpdate writes the revision of the update when it changed one of the fields of TaskState,
+// in the transaction of the update
+func (t *Task) AfterUpdate(tx *gorm.DB) error {
+	before := t.before
+	t.before = nil
+	if before == nil {
+		return nil
+	}
+
+	session := tx.Session(&gorm.Session{NewDB: true})
+	var after Task
+	if err := session.Unscoped().First(&after, t.ID).Error; err != nil {
+		return err
+	}
+	changes := before.Diff(after.State())
+	if len(changes) == 0 {
+		return nil
+	}
+
+	changed, err := json.Marshal(changes)
+	if err != nil {
+		return err
+	}
+	previous, err := json.Marshal(before)
+	if err != nil {
+		return err
+	}
+
+	return session.Create(&TaskRevision{
+		TaskID:   t.ID,
+		Version:  after.Version,
+		AuthorID: AuthorOf(tx.Statement.Context),
+		Changes:  string(changed),
+		Previous: string(previous),
+	}).Error
+}
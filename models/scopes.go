@@ -0,0 +1,52 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+)
+
+// OwnedBy scopes a query to the rows of the user, it is the one place
+// where ownership of tasks, labels and other user data is checked
+func OwnedBy(u *User) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		return tx.Where(clause.Eq{
+			Column: clause.Column{Table: clause.CurrentTable, Name: "user_id"},
+			Value:  u.ID,
+		})
+	}
+}
+
+// Unarchived scopes a query of tasks to the ones which are not archived, nor in an archived project
+func Unarchived(tx *gorm.DB) *gorm.DB {
+	archived := tx.Session(&gorm.Session{NewDB: true}).
+		Model(&Project{}).
+		Select("id").
+		Where("archived_at IS NOT NULL")
+
+	return tx.Where("tasks.archived_at IS NULL").
+		Where("tasks.project_id IS NULL OR tasks.project_id NOT IN (?)", archived)
+}
+
+// AccessibleBy scopes a query of workspace data (tasks, projects) to the personal
+// rows of the user and to the rows of the workspaces where the user has one of
+// the roles. Without roles any membership is enough.
+func AccessibleBy(u *User, roles ...string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		workspaces := tx.Session(&gorm.Session{NewDB: true}).
+			Model(&Membership{}).
+			Select("workspace_id").
+			Where("user_id = ?", u.ID)
+		if len(roles) > 0 {
+			workspaces = workspaces.Where("role IN ?", roles)
+		}
+
+		workspaceID := clause.Column{Table: clause.CurrentTable, Name: "workspace_id"}
+		return tx.Where(clause.Or(
+			clause.And(
+				clause.Eq{Column: workspaceID, Value: nil},
+				clause.Eq{Column: clause.Column{Table: clause.CurrentTable, Name: "user_id"}, Value: u.ID},
+			),
+			clause.Expr{SQL: "? IN (?)", Vars: []interface{}{workspaceID, workspaces}},
+		))
+	}
+}
@@ -0,0 +1,12 @@
+package models
+
+// SearchResult is a task matching a search, the highlights mark the matched words
+type SearchResult struct {
+	TaskID               uint    `json:"taskId"`
+	Title                string  `json:"title"`
+	Status               string  `json:"status"`
+	Rank                 float64 `json:"rank"`
+	TitleHighlight       string  `json:"titleHighlight"`
+	DescriptionHighlight string  `json:"descriptionHighlight"`
+	CommentHighlight     string  `json:"commentHighlight,omitempty"`
+}
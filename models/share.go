@@ -0,0 +1,122 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"task-app/markdown"
+	"time"
+)
+
+// Share is a public read-only link to the tasks of a project or of a filtered list of the user.
+// Only the hash of its slug is kept, the slug is the secret of the link.
+type Share struct {
+	gorm.Model
+	UserID   uint   `gorm:"index"`
+	Title    string `gorm:"size:255"`
+	SlugHash string `gorm:"size:64;uniqueIndex"`
+	// the filter of the tasks, the ones the user sees when it is empty
+	ProjectID   *uint
+	WorkspaceID *uint
+	// Labels are the comma separated label names, the tasks carrying any of them
+	Labels string
+	// Due is overdue, today or week for the open tasks due by then in the zone of the user
+	Due  string `gorm:"size:16"`
+	Sort string `gorm:"size:16"`
+	// PasswordHash is the bcrypt hash of the password of the link, empty without one
+	PasswordHash string `json:"-"`
+	ViewedAt     *time.Time
+}
+
+// ShareInput is the body of the creation of a share link
+type ShareInput struct {
+	Title       string   `json:"title" validate:"notblank,max=255"`
+	ProjectID   *uint    `json:"projectId"`
+	WorkspaceID *uint    `json:"workspaceId"`
+	Labels      []string `json:"labels" validate:"max=20,dive,notblank,max=255"`
+	Due         string   `json:"due" validate:"omitempty,oneof=overdue today week"`
+	Sort        string   `json:"sort" validate:"omitempty,oneof=position priority due"`
+	// Password protects the link, it is asked with basic authentication and any username
+	Password string `json:"password" validate:"omitempty,min=6,max=72"`
+}
+
+type ShareApi struct {
+	ID          uint     `json:"id"`
+	Title       string   `json:"title"`
+	ProjectID   *uint    `json:"projectId"`
+	WorkspaceID *uint    `json:"workspaceId"`
+	Labels      []string `json:"labels"`
+	Due         string   `json:"due"`
+	Sort        string   `json:"sort"`
+	Protected   bool     `json:"protected"`
+	// URL is the link, only known when it is created
+	URL       string `json:"url,omitempty"`
+	ViewedAt  string `json:"viewedAt,omitempty"`
+	CreatedAt string `json:"createdAt"`
+}
+
+func (s Share) Api() ShareApi {
+	api := ShareApi{
+		ID:          s.ID,
+		Title:       s.Title,
+		ProjectID:   s.ProjectID,
+		WorkspaceID: s.WorkspaceID,
+		Labels:      s.LabelList(),
+		Due:         s.Due,
+		Sort:        s.Sort,
+		Protected:   s.PasswordHash != "",
+		CreatedAt:   Timestamp(s.CreatedAt),
+	}
+	if s.ViewedAt != nil {
+		api.ViewedAt = Timestamp(*s.ViewedAt)
+	}
+
+	return api
+}
+
+// LabelList returns the label names of the filter
+func (s Share) LabelList() []string {
+	if s.Labels == "" {
+		return []string{}
+	}
+
+	return strings.Split(s.Labels, ",")
+}
+
+// SharedListApi is the read-only view of the tasks of a share link
+type SharedListApi struct {
+	Title string          `json:"title"`
+	Tasks []SharedTaskApi `json:"tasks"`
+}
+
+// SharedTaskApi is a task of a share link, without who works on it
+type SharedTaskApi struct {
+	Title           string            `json:"title"`
+	Description     string            `json:"description"`
+	DescriptionHTML string            `json:"descriptionHtml"`
+	Status          string            `json:"status"`
+	Priority        int               `json:"priority"`
+	DueAt           *time.Time        `json:"dueAt"`
+	CompletedAt     *time.Time        `json:"completedAt"`
+	Labels          []string          `json:"labels"`
+	Checklist       ChecklistProgress `json:"checklist"`
+}
+
+// Shared returns the view of the task for a share link
+func (t Task) Shared() SharedTaskApi {
+	labels := make([]string, 0, len(t.Labels))
+	for _, l := range t.Labels {
+		labels = append(labels, l.Name)
+	}
+
+	return SharedTaskApi{
+		Title:           t.Title,
+		Description:     t.Description,
+		DescriptionHTML: markdown.Render(t.Description),
+		Status:          t.Status,
+		Priority:        t.Priority,
+		DueAt:           UTC(t.DueAt),
+		CompletedAt:     UTC(t.CompletedAt),
+		Labels:          labels,
+		Checklist:       Progress(t.Checklist),
+	}
+}
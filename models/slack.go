@@ -0,0 +1,41 @@
+package models
+
+import "time"
+
+// SlackInstallation links a workspace to a Slack team.
+// The tasks completed in the workspace are posted to the channel chosen on install.
+type SlackInstallation struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	WorkspaceID uint `gorm:"uniqueIndex"`
+	// InstalledBy is the user who installed the app
+	InstalledBy uint
+	// TeamID is the Slack team, it is linked to one workspace only
+	TeamID      string `gorm:"uniqueIndex"`
+	TeamName    string
+	BotToken    string
+	ChannelID   string
+	ChannelName string
+	WebhookURL  string
+}
+
+type SlackInstallationApi struct {
+	WorkspaceID uint      `json:"workspaceId"`
+	TeamID      string    `json:"teamId"`
+	TeamName    string    `json:"teamName"`
+	Channel     string    `json:"channel"`
+	InstalledBy uint      `json:"installedBy"`
+	CreatedAt   time.Time `json:"createdAt"`
+}
+
+func (s SlackInstallation) Api() SlackInstallationApi {
+	return SlackInstallationApi{
+		WorkspaceID: s.WorkspaceID,
+		TeamID:      s.TeamID,
+		TeamName:    s.TeamName,
+		Channel:     s.ChannelName,
+		InstalledBy: s.InstalledBy,
+		CreatedAt:   s.CreatedAt.UTC(),
+	}
+}
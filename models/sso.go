@@ -0,0 +1,191 @@
+package models
+
+import (
+	"strings"
+	"time"
+)
+
+// The protocols of the single sign-on of a workspace
+const (
+	SSOProtocolOIDC = "oidc"
+	SSOProtocolSAML = "saml"
+)
+
+// RevokedSSOEnforced is the reason of the sessions of the members signed out when their
+// workspace starts to enforce its single sign-on
+const RevokedSSOEnforced = "sso_enforced"
+
+// ssoAttributes are the default attributes of the email, the name and the username by protocol:
+// the standard claims of OIDC, the common attributes of the SAML IdPs
+var ssoAttributes = map[string][3]string{
+	SSOProtocolOIDC: {"email", "name", "preferred_username"},
+	SSOProtocolSAML: {"email", "displayName", "uid"},
+}
+
+// WorkspaceSSO is the identity provider of a workspace: an OIDC issuer or a SAML IdP. Its
+// users are signed in as members of the workspace, and created on their first login.
+type WorkspaceSSO struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	UpdatedAt   time.Time
+	WorkspaceID uint `gorm:"uniqueIndex"`
+	Protocol    string
+	// Enforced refuses the other logins of the members, the owners keep them so a broken
+	// provider does not lock the workspace out
+	Enforced bool
+	// Domains are the email domains the provider may sign in, comma separated, any when empty
+	Domains string
+	// Provision creates the accounts of the users signing in for the first time, with the
+	// DefaultRole in the workspace. Otherwise they have to be invited first.
+	Provision   bool
+	DefaultRole string
+
+	// Issuer, ClientID and ClientSecret are the client of the OIDC issuer
+	Issuer       string
+	ClientID     string
+	ClientSecret string
+
+	// IdPEntityID, IdPSSOURL and IdPCertificate (PEM) are the metadata of the SAML IdP
+	IdPEntityID    string
+	IdPSSOURL      string `gorm:"column:idp_sso_url"`
+	IdPCertificate string
+
+	// the attributes (claims) of the email, the name and the username, the defaults when empty
+	EmailAttribute    string
+	NameAttribute     string
+	UsernameAttribute string
+}
+
+// TableName keeps SSO one word, GORM names the table workspace_ss_os
+func (WorkspaceSSO) TableName() string {
+	return "workspace_sso"
+}
+
+// Attributes returns the attributes of the email, the name and the username
+func (s WorkspaceSSO) Attributes() (email, name, username string) {
+	defaults := ssoAttributes[s.Protocol]
+	email, name, username = s.EmailAttribute, s.NameAttribute, s.UsernameAttribute
+	if email == "" {
+		email = defaults[0]
+	}
+	if name == "" {
+		name = defaults[1]
+	}
+	if username == "" {
+		username = defaults[2]
+	}
+
+	return email, name, username
+}
+
+// AllowsEmail tells whether the provider may sign in the email, by its domain
+func (s WorkspaceSSO) AllowsEmail(email string) bool {
+	if s.Domains == "" {
+		return true
+	}
+	at := strings.LastIndexByte(email, '@')
+	if at < 0 {
+		return false
+	}
+	for _, d := range strings.Split(s.Domains, ",") {
+		if strings.EqualFold(strings.TrimSpace(d), email[at+1:]) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// SSOIdentity links a user to their subject at the provider of a workspace
+type SSOIdentity struct {
+	ID          uint `gorm:"primaryKey"`
+	CreatedAt   time.Time
+	WorkspaceID uint   `gorm:"uniqueIndex:idx_sso_identities_subject"`
+	Subject     string `gorm:"size:255;uniqueIndex:idx_sso_identities_subject"`
+	UserID      uint   `gorm:"index"`
+}
+
+// WorkspaceSSOInput configures the provider of a workspace, the secret is kept when it is empty
+type WorkspaceSSOInput struct {
+	Protocol    string   `json:"protocol" validate:"oneof=oidc saml"`
+	Enforced    bool     `json:"enforced"`
+	Domains     []string `json:"domains" validate:"max=20,dive,fqdn"`
+	Provision   bool     `json:"provision"`
+	DefaultRole string   `json:"defaultRole" validate:"omitempty,oneof=member viewer"`
+
+	Issuer       string `json:"issuer" validate:"required_if=Protocol oidc,omitempty,url,max=255"`
+	ClientID     string `json:"clientId" validate:"required_if=Protocol oidc,max=255"`
+	ClientSecret string `json:"clientSecret" validate:"max=1000"`
+
+	IdPEntityID    string `json:"idpEntityId" validate:"required_if=Protocol saml,max=255"`
+	IdPSSOURL      string `json:"idpSsoUrl" validate:"required_if=Protocol saml,omitempty,url,max=1000"`
+	IdPCertificate string `json:"idpCertificate" validate:"required_if=Protocol saml,max=20000"`
+
+	EmailAttribute    string `json:"emailAttribute" validate:"max=255"`
+	NameAttribute     string `json:"nameAttribute" validate:"max=255"`
+	UsernameAttribute string `json:"usernameAttribute" validate:"max=255"`
+}
+
+type WorkspaceSSOApi struct {
+	WorkspaceID uint     `json:"workspaceId"`
+	Protocol    string   `json:"protocol"`
+	Enforced    bool     `json:"enforced"`
+	Domains     []string `json:"domains"`
+	Provision   bool     `json:"provision"`
+	DefaultRole string   `json:"defaultRole"`
+
+	Issuer          string `json:"issuer,omitempty"`
+	ClientID        string `json:"clientId,omitempty"`
+	HasClientSecret bool   `json:"hasClientSecret"`
+
+	IdPEntityID    string `json:"idpEntityId,omitempty"`
+	IdPSSOURL      string `json:"idpSsoUrl,omitempty"`
+	IdPCertificate string `json:"idpCertificate,omitempty"`
+
+	EmailAttribute    string `json:"emailAttribute"`
+	NameAttribute     string `json:"nameAttribute"`
+	UsernameAttribute string `json:"usernameAttribute"`
+
+	// LoginURL starts a login by the provider, RedirectURL (OIDC) and the SAML EntityID,
+	// ACSURL and MetadataURL are what the provider is configured with
+	LoginURL    string `json:"loginUrl"`
+	RedirectURL string `json:"redirectUrl,omitempty"`
+	EntityID    string `json:"entityId,omitempty"`
+	ACSURL      string `json:"acsUrl,omitempty"`
+	MetadataURL string `json:"metadataUrl,omitempty"`
+	UpdatedAt   string `json:"updatedAt"`
+}
+
+// Api returns the provider with the URLs of the server under the base, e.g.
+// https://tasker.example.com/api/v1/auth/sso/3
+func (s WorkspaceSSO) Api(base string) WorkspaceSSOApi {
+	domains := []string{}
+	if s.Domains != "" {
+		domains = strings.Split(s.Domains, ",")
+	}
+	email, name, username := s.Attributes()
+
+	api := WorkspaceSSOApi{
+		WorkspaceID:       s.WorkspaceID,
+		Protocol:          s.Protocol,
+		Enforced:          s.Enforced,
+		Domains:           domains,
+		Provision:         s.Provision,
+		DefaultRole:       s.DefaultRole,
+		EmailAttribute:    email,
+		NameAttribute:     name,
+		UsernameAttribute: username,
+		LoginURL:          base,
+		UpdatedAt:         Timestamp(s.UpdatedAt),
+	}
+	switch s.Protocol {
+	case SSOProtocolOIDC:
+		api.Issuer, api.ClientID, api.HasClientSecret = s.Issuer, s.ClientID, s.ClientSecret != ""
+		api.RedirectURL = base + "/callback"
+	case SSOProtocolSAML:
+		api.IdPEntityID, api.IdPSSOURL, api.IdPCertificate = s.IdPEntityID, s.IdPSSOURL, s.IdPCertificate
+		api.EntityID, api.ACSURL, api.MetadataURL = base+"/metadata", base+"/acs", base+"/metadata"
+	}
+
+	return api
+}
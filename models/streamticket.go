@@ -0,0 +1,20 @@
+package models
+
+import "time"
+
+// StreamTicket lets a browser open the WebSocket or the event stream, which cannot carry the
+// Authorization header: it is asked for with the access token and passed in the query instead.
+// It is deleted when it is used so it opens one connection, the token is identified by its hash.
+type StreamTicket struct {
+	TokenHash      string `gorm:"primaryKey;size:64"`
+	UserID         uint   `gorm:"index"`
+	ImpersonatedBy string
+	ExpiresAt      time.Time `gorm:"index"`
+	CreatedAt      time.Time
+}
+
+// StreamTicketApi is the ticket to pass as ?ticket= to the WebSocket or the event stream
+type StreamTicketApi struct {
+	Ticket    string    `json:"ticket"`
+	ExpiresAt time.Time `json:"expiresAt"`
+}
@@ -0,0 +1,73 @@
+package models
+
+import "time"
+
+// The entities of the sync
+const (
+	SyncTask    = "task"
+	SyncProject = "project"
+	SyncLabel   = "label"
+)
+
+// The operations of a change sent to the sync
+const (
+	SyncUpsert = "upsert"
+	SyncDelete = "delete"
+)
+
+// SyncChange is an entity of the sync feed, a deleted one is a tombstone without data
+type SyncChange struct {
+	Type    string `json:"type"`
+	ID      uint   `json:"id"`
+	Deleted bool   `json:"deleted"`
+	// UpdatedAt is when the entity was last changed or deleted, the base of the next change
+	// of a project or a label
+	UpdatedAt time.Time `json:"updatedAt"`
+	// Data is the TaskApi, ProjectApi or LabelApi of the entity
+	Data interface{} `json:"data,omitempty"`
+}
+
+// SyncFeed are the changes since a sync token, and the token to read the next ones from
+type SyncFeed struct {
+	Changes []SyncChange `json:"changes"`
+	Token   string       `json:"token"`
+}
+
+// SyncInput are the changes a client made offline, applied in their order
+type SyncInput struct {
+	Changes []SyncClientChange `json:"changes" validate:"required,min=1,max=100,dive"`
+}
+
+// SyncClientChange creates, updates or deletes an entity. The change of an existing entity
+// is made from the version read, a task by its version and a project or a label by its
+// updatedAt: the server keeps its own state when it was changed since.
+type SyncClientChange struct {
+	Type string `json:"type" validate:"oneof=task project label"`
+	Op   string `json:"op" validate:"oneof=upsert delete"`
+	// ID is the entity changed, none for an upsert creating one
+	ID uint `json:"id" validate:"required_if=Op delete"`
+	// ClientID is the id the client gave to the entity, sent back with the result
+	ClientID string `json:"clientId" validate:"max=64"`
+	// Version is the version of the task the change was made from
+	Version uint `json:"version"`
+	// BaseUpdatedAt is the updatedAt of the project or the label the change was made from
+	BaseUpdatedAt *time.Time `json:"baseUpdatedAt"`
+
+	Task    *TaskInput  `json:"task" validate:"required_if=Type task Op upsert"`
+	Project *ProjectApi `json:"project" validate:"required_if=Type project Op upsert"`
+	Label   *LabelApi   `json:"label" validate:"required_if=Type label Op upsert"`
+}
+
+// SyncResult is the outcome of a client change, by its index in the request
+type SyncResult struct {
+	Index    int    `json:"index"`
+	ClientID string `json:"clientId,omitempty"`
+	// Status is the HTTP status the change would have been answered with on its own
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+	// Conflict tells the entity was changed or deleted since the version of the change, which
+	// was not applied: the client replaces its copy by the entity and makes its change again
+	Conflict bool `json:"conflict,omitempty"`
+	// Entity is the entity as stored after the change, or as the server has it on a conflict
+	Entity *SyncChange `json:"entity,omitempty"`
+}
@@ -2,27 +2,290 @@ package models
 
 import (
 	"gorm.io/gorm"
+	"task-app/markdown"
 	"time"
 )
 
+// StatusDone is the status of a completed task
+const StatusDone = "done"
+
+// The priorities of the tasks, P1 is the most urgent
+const (
+	PriorityP1 = 1
+	PriorityP2 = 2
+	PriorityP3 = 3
+	PriorityP4 = 4
+	// PriorityDefault is the priority of the tasks created without one
+	PriorityDefault = PriorityP4
+)
+
 type Task struct {
 	gorm.Model
-	UserID     uint
-	CategoryID uint
+	UserID      uint
+	CategoryID  *uint
+	WorkspaceID *uint
+	ProjectID   *uint
+	AssigneeID  *uint
+	Assignee    *User `json:"-" gorm:"foreignKey:AssigneeID"`
+
+	Title       string     `json:"title"`
+	Description string     `json:"description"`
+	Status      string     `json:"status"`
+	DueAt       *time.Time `json:"dueAt"`
+	// Recurrence is a RRULE of RFC 5545 without the RRULE: prefix, e.g. FREQ=WEEKLY;BYDAY=MO
+	Recurrence string `json:"recurrence"`
+	Priority   int    `json:"priority" gorm:"not null;default:4"`
+	// CompletedAt is when the task was done, nil when it is not
+	CompletedAt *time.Time `json:"completedAt" gorm:"index"`
+	// RemindedFor is the due date the assignee was last reminded of
+	RemindedFor *time.Time `json:"-"`
+	// OverdueFor is the due date the task was last marked overdue for
+	OverdueFor *time.Time `json:"-"`
+	// ArchivedAt is when the task was archived, the archived tasks are left out of the lists
+	ArchivedAt *time.Time `json:"archivedAt" gorm:"index"`
+	// Position orders the tasks of a list (a project, a workspace or the personal tasks), the first is 1
+	Position int `json:"position" gorm:"not null;default:0;index"`
+	// Version counts the updates of the task, an update must be given the version it was
+	// made from so it does not overwrite a concurrent one
+	Version   uint            `json:"version" gorm:"not null;default:1"`
+	CreatedAt time.Time       `json:"createdAt"`
+	Category  Category        `json:"category"`
+	Labels    []Label         `json:"labels" gorm:"many2many:task_labels;"`
+	Watchers  []User          `json:"-" gorm:"many2many:task_watchers;"`
+	Checklist []ChecklistItem `json:"-" gorm:"foreignKey:TaskID"`
+	// BlockedBy are the edges to the tasks blocking this one, Blocks the edges to the tasks it blocks
+	BlockedBy []TaskDependency `json:"-" gorm:"foreignKey:BlockedID"`
+	Blocks    []TaskDependency `json:"-" gorm:"foreignKey:BlockerID"`
+	// CommentCount is the count of the comments of the task, set by CountComments
+	CommentCount int64 `json:"-" gorm:"-"`
+	// before is the state of the task read before its update, for its revision
+	before *TaskState
+}
 
-	Title       string    `json:"title"`
-	Description string    `json:"description"`
-	Status      string    `json:"status"`
-	CreatedAt   time.Time `json:"createdAt"`
-	Category    Category  `json:"category"`
+// TaskInput is the body of the task create and update, the id is only read by the update
+type TaskInput struct {
+	ID uint `json:"id"`
+	// Version is the version of the task the update was made from, required by the update
+	Version     uint       `json:"version"`
+	Title       string     `json:"title" validate:"notblank,max=255"`
+	Description string     `json:"description"`
+	Status      string     `json:"status" validate:"max=32"`
+	DueAt       *time.Time `json:"dueAt"`
+	// DueDate is a day as 2006-01-02 in the zone of the user, the task is due at its end. It replaces DueAt.
+	DueDate    string `json:"dueDate" validate:"omitempty,datetime=2006-01-02"`
+	Recurrence string `json:"recurrence" validate:"omitempty,rrule"`
+	// Priority is 1 to 4, a missing priority is P4 for a new task and unchanged by an update
+	Priority    int   `json:"priority" validate:"omitempty,min=1,max=4"`
+	WorkspaceID *uint `json:"workspaceId"`
+	ProjectID   *uint `json:"projectId"`
+}
+
+// QuickAddInput is the body of the quick add, the task is read from the text,
+// e.g. Pay rent tomorrow 5pm #finance !p1 every month
+type QuickAddInput struct {
+	Text        string `json:"text" validate:"notblank,max=1000"`
+	WorkspaceID *uint  `json:"workspaceId"`
+	ProjectID   *uint  `json:"projectId"`
 }
 
 type TaskApi struct {
-	ID          uint     `json:"id"`
-	Title       string   `json:"title"`
-	Description string   `json:"description"`
-	Category    Category `json:"category"`
-	Status      string   `json:"status"`
-	CreatedAt   string   `json:"createdAt"`
-	UpdatedAt   string   `json:"updatedAt"`
+	ID          uint   `json:"id"`
+	Title       string `json:"title"`
+	Description string `json:"description"`
+	// DescriptionHTML is the description rendered from Markdown and sanitized
+	DescriptionHTML   string             `json:"descriptionHtml"`
+	Category          Category           `json:"category"`
+	WorkspaceID       *uint              `json:"workspaceId"`
+	ProjectID         *uint              `json:"projectId"`
+	AssigneeID        *uint              `json:"assigneeId"`
+	Assignee          *AssigneeApi       `json:"assignee,omitempty"`
+	Watchers          []uint             `json:"watchers"`
+	Labels            []LabelApi         `json:"labels"`
+	Checklist         []ChecklistItemApi `json:"checklist"`
+	BlockedBy         []uint             `json:"blockedBy"`
+	Blocks            []uint             `json:"blocks"`
+	ChecklistProgress ChecklistProgress  `json:"checklistProgress"`
+	CommentCount      int64              `json:"commentCount"`
+	Status            string             `json:"status"`
+	DueAt             *time.Time         `json:"dueAt"`
+	CompletedAt       *time.Time         `json:"completedAt"`
+	ArchivedAt        *time.Time         `json:"archivedAt"`
+	Recurrence        string             `json:"recurrence"`
+	Priority          int                `json:"priority"`
+	Position          int                `json:"position"`
+	Version           uint               `json:"version"`
+	CreatedAt         string             `json:"createdAt"`
+	UpdatedAt         string             `json:"updatedAt"`
+}
+
+// AssigneeApi is the user a task is assigned to, missing from TaskApi when it is not assigned
+type AssigneeApi struct {
+	ID          uint   `json:"id"`
+	Username    string `json:"username"`
+	DisplayName string `json:"displayName"`
+	// AvatarURLs are the URLs of the avatar by its size in pixels
+	AvatarURLs map[string]string `json:"avatarUrls"`
+}
+
+// Api returns the task for the client, with the associations of TaskDetails and the count of
+// CountComments
+func (t Task) Api() TaskApi {
+	watchers := make([]uint, 0, len(t.Watchers))
+	for _, w := range t.Watchers {
+		watchers = append(watchers, w.ID)
+	}
+
+	labels := make([]LabelApi, 0, len(t.Labels))
+	for _, l := range t.Labels {
+		labels = append(labels, l.Api())
+	}
+
+	checklist := make([]ChecklistItemApi, 0, len(t.Checklist))
+	for _, i := range t.Checklist {
+		checklist = append(checklist, i.Api())
+	}
+
+	blockedBy := make([]uint, 0, len(t.BlockedBy))
+	for _, d := range t.BlockedBy {
+		blockedBy = append(blockedBy, d.BlockerID)
+	}
+	blocks := make([]uint, 0, len(t.Blocks))
+	for _, d := range t.Blocks {
+		blocks = append(blocks, d.BlockedID)
+	}
+
+	// the assignee read before a change of AssigneeID is not the one of the task anymore
+	var assignee *AssigneeApi
+	if a := t.Assignee; a != nil && t.AssigneeID != nil && *t.AssigneeID == a.ID {
+		assignee = &AssigneeApi{ID: a.ID, Username: a.Username, DisplayName: a.DisplayName, AvatarURLs: a.AvatarURLs()}
+	}
+
+	return TaskApi{
+		ID:                t.ID,
+		Title:             t.Title,
+		Description:       t.Description,
+		DescriptionHTML:   markdown.Render(t.Description),
+		Category:          t.Category,
+		WorkspaceID:       t.WorkspaceID,
+		ProjectID:         t.ProjectID,
+		AssigneeID:        t.AssigneeID,
+		Assignee:          assignee,
+		Watchers:          watchers,
+		Labels:            labels,
+		Checklist:         checklist,
+		BlockedBy:         blockedBy,
+		Blocks:            blocks,
+		ChecklistProgress: Progress(t.Checklist),
+		CommentCount:      t.CommentCount,
+		Status:            t.Status,
+		DueAt:             UTC(t.DueAt),
+		CompletedAt:       UTC(t.CompletedAt),
+		ArchivedAt:        UTC(t.ArchivedAt),
+		Recurrence:        t.Recurrence,
+		Priority:          t.Priority,
+		Position:          t.Position,
+		Version:           t.Version,
+		CreatedAt:         Timestamp(t.CreatedAt),
+		UpdatedAt:         Timestamp(t.UpdatedAt),
+	}
+}
+
+// ArchiveDoneInput is the body of the archive of the tasks completed more than OlderThanDays ago
+type ArchiveDoneInput struct {
+	OlderThanDays int `json:"olderThanDays" validate:"required,min=1,max=3650"`
+}
+
+// ReorderInput is the body of the reorder, the ids of the tasks of a list in their new order
+type ReorderInput struct {
+	IDs []uint `json:"ids" validate:"required,min=1,max=500,unique,dive,min=1"`
+}
+
+// SetStatus changes the status, recording when the task is done
+func (t *Task) SetStatus(status string) {
+	switch {
+	case status == StatusDone && t.CompletedAt == nil:
+		now := time.Now()
+		t.CompletedAt = &now
+	case status != StatusDone:
+		t.CompletedAt = nil
+	}
+	t.Status = status
+}
+
+// Apply sets the fields of an update, a missing priority keeps the priority of the task
+// ResolveDue sets the due date of a DueDate to the last second of the day in the zone
+func (input *TaskInput) ResolveDue(loc *time.Location) {
+	if input.DueDate == "" {
+		return
+	}
+
+	day, err := time.ParseInLocation("2006-01-02", input.DueDate, loc)
+	if err != nil {
+		return
+	}
+	due := day.AddDate(0, 0, 1).Add(-time.Second)
+	input.DueAt = &due
+}
+
+func (t *Task) Apply(input *TaskInput) {
+	t.Title = input.Title
+	t.Description = input.Description
+	t.SetStatus(input.Status)
+	t.DueAt = input.DueAt
+	t.Recurrence = input.Recurrence
+	if input.Priority != 0 {
+		t.Priority = input.Priority
+	}
+}
+
+// BeforeCreate gives the task the default priority and the first version and puts it
+// at the end of its list
+func (t *Task) BeforeCreate(tx *gorm.DB) error {
+	if t.Priority == 0 {
+		t.Priority = PriorityDefault
+	}
+	if t.Version == 0 {
+		t.Version = 1
+	}
+	t.SetStatus(t.Status)
+	if t.Position != 0 {
+		return nil
+	}
+
+	var last int
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Model(&Task{}).
+		Scopes(SameList(t)).
+		Select("COALESCE(MAX(position), 0)").
+		Scan(&last).Error
+	t.Position = last + 1
+
+	return err
+}
+
+// SameList scopes a query to the tasks of the list of t: its project, else its workspace,
+// else the personal tasks of its creator
+func SameList(t *Task) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		switch {
+		case t.ProjectID != nil:
+			return tx.Where("project_id = ?", *t.ProjectID)
+		case t.WorkspaceID != nil:
+			return tx.Where("project_id IS NULL AND workspace_id = ?", *t.WorkspaceID)
+		default:
+			return tx.Where("project_id IS NULL AND workspace_id IS NULL AND user_id = ?", t.UserID)
+		}
+	}
+}
+
+// TouchTasks moves the updated_at of the tasks whose labels, watchers, checklist or
+// dependencies changed, which are not columns of the task, so the sync feed sends them again
+func TouchTasks(tx *gorm.DB, ids ...uint) error {
+	return tx.Model(&Task{}).Where("id IN ?", ids).UpdateColumn("updated_at", time.Now()).Error
+}
+
+// TouchLabelTasks moves the updated_at of the tasks of the label, which they are sent with
+func TouchLabelTasks(tx *gorm.DB, labelID uint) error {
+	tasks := tx.Session(&gorm.Session{NewDB: true}).Table("task_labels").Select("task_id").Where("label_id = ?", labelID)
+	return tx.Model(&Task{}).Where("id IN (?)", tasks).UpdateColumn("updated_at", time.Now()).Error
 }
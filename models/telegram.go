@@ -0,0 +1,29 @@
+package models
+
+import "time"
+
+// TelegramAccount links a user to the Telegram chat of the bot.
+// The account is pending with a one-time code until the code is sent to the bot.
+type TelegramAccount struct {
+	ID        uint `gorm:"primaryKey"`
+	CreatedAt time.Time
+	UpdatedAt time.Time
+	UserID    uint `gorm:"uniqueIndex"`
+	// ChatID is the private chat of the user with the bot, nil until linked
+	ChatID   *int64 `gorm:"uniqueIndex"`
+	Username string
+	// Code is the hash of the one-time code linking the chat
+	Code          string `gorm:"index"`
+	CodeExpiresAt *time.Time
+	LinkedAt      *time.Time
+}
+
+type TelegramAccountApi struct {
+	Linked   bool       `json:"linked"`
+	Username string     `json:"username,omitempty"`
+	LinkedAt *time.Time `json:"linkedAt,omitempty"`
+}
+
+func (a TelegramAccount) Api() TelegramAccountApi {
+	return TelegramAccountApi{Linked: a.ChatID != nil, Username: a.Username, LinkedAt: UTC(a.LinkedAt)}
+}
@@ -0,0 +1,97 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+// Template is a task saved to be created again, personal or shared with a workspace.
+// The labels are matched by name when the template is instantiated, as they belong to each user.
+type Template struct {
+	gorm.Model
+	UserID      uint
+	WorkspaceID *uint
+	Name        string
+	Title       string
+	Description string `gorm:"type:text"`
+	// Labels are the names of the labels, comma separated
+	Labels string
+	// Checklist are the texts of the checklist items, one per line
+	Checklist  string `gorm:"type:text"`
+	Recurrence string
+	Priority   int
+}
+
+type TemplateApi struct {
+	ID          uint     `json:"id"`
+	WorkspaceID *uint    `json:"workspaceId"`
+	Name        string   `json:"name"`
+	Title       string   `json:"title"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels"`
+	Checklist   []string `json:"checklist"`
+	Recurrence  string   `json:"recurrence"`
+	Priority    int      `json:"priority"`
+	CreatedAt   string   `json:"createdAt"`
+	UpdatedAt   string   `json:"updatedAt"`
+}
+
+// TemplateInput is the body of the template create and update
+type TemplateInput struct {
+	Name        string   `json:"name" validate:"notblank,max=100"`
+	Title       string   `json:"title" validate:"notblank,max=255"`
+	Description string   `json:"description"`
+	Labels      []string `json:"labels" validate:"max=20,dive,notblank,max=64,excludes=0x2C"`
+	Checklist   []string `json:"checklist" validate:"max=100,dive,notblank,max=255,excludes=0x0A"`
+	Recurrence  string   `json:"recurrence" validate:"omitempty,rrule"`
+	Priority    int      `json:"priority" validate:"omitempty,min=1,max=4"`
+	WorkspaceID *uint    `json:"workspaceId"`
+}
+
+// TaskTemplateInput saves a task as a template, the template takes the fields of the task
+type TaskTemplateInput struct {
+	Name        string `json:"name" validate:"notblank,max=100"`
+	WorkspaceID *uint  `json:"workspaceId"`
+}
+
+// InstantiateInput places the task created from a template, personal when neither is given.
+// The title of the template is used without a title.
+type InstantiateInput struct {
+	Title       string     `json:"title" validate:"max=255"`
+	DueAt       *time.Time `json:"dueAt"`
+	WorkspaceID *uint      `json:"workspaceId"`
+	ProjectID   *uint      `json:"projectId"`
+}
+
+func (t Template) LabelList() []string {
+	return splitList(t.Labels, ",")
+}
+
+func (t Template) ChecklistList() []string {
+	return splitList(t.Checklist, "\n")
+}
+
+func (t Template) Api() TemplateApi {
+	return TemplateApi{
+		ID:          t.ID,
+		WorkspaceID: t.WorkspaceID,
+		Name:        t.Name,
+		Title:       t.Title,
+		Description: t.Description,
+		Labels:      t.LabelList(),
+		Checklist:   t.ChecklistList(),
+		Recurrence:  t.Recurrence,
+		Priority:    t.Priority,
+		CreatedAt:   Timestamp(t.CreatedAt),
+		UpdatedAt:   Timestamp(t.UpdatedAt),
+	}
+}
+
+func splitList(s, sep string) []string {
+	if s == "" {
+		return []string{}
+	}
+
+	return strings.Split(s, sep)
+}
@@ -0,0 +1,35 @@
+package models
+
+import (
+	"errors"
+	"strings"
+	"time"
+)
+
+// Timestamp formats a time of the API: RFC3339 in UTC, whatever the zone of the database or the user
+func Timestamp(t time.Time) string {
+	return t.UTC().Format(time.RFC3339)
+}
+
+// UTC returns the time in UTC for the API, nil for nil
+func UTC(t *time.Time) *time.Time {
+	if t == nil {
+		return nil
+	}
+
+	utc := t.UTC()
+	return &utc
+}
+
+// Location returns the zone of an IANA name like Europe/Berlin, UTC for an empty name.
+// Local is not a zone, it is the one of the server.
+func Location(name string) (*time.Location, error) {
+	if name == "" {
+		return time.UTC, nil
+	}
+	if strings.EqualFold(name, "local") {
+		return nil, errors.New("unknown time zone " + name)
+	}
+
+	return time.LoadLocation(name)
+}
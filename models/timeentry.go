@@ -0,0 +1,66 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+// TimeEntry is time a user spent on a task, a running timer has no end yet.
+// The duration is stored when the entry ends so it can be summed by the database.
+type TimeEntry struct {
+	gorm.Model
+	TaskID          uint `gorm:"index"`
+	UserID          uint `gorm:"index"`
+	StartedAt       time.Time
+	EndedAt         *time.Time
+	DurationSeconds int64
+	Note            string
+}
+
+type TimeEntryApi struct {
+	ID        uint       `json:"id"`
+	TaskID    uint       `json:"taskId"`
+	UserID    uint       `json:"userId"`
+	StartedAt time.Time  `json:"startedAt"`
+	EndedAt   *time.Time `json:"endedAt"`
+	// Seconds of a running timer are the ones elapsed so far
+	Seconds int64  `json:"seconds"`
+	Running bool   `json:"running"`
+	Note    string `json:"note"`
+}
+
+// TimeEntryInput is the body of a manual entry
+type TimeEntryInput struct {
+	StartedAt time.Time `json:"startedAt" validate:"required"`
+	EndedAt   time.Time `json:"endedAt" validate:"required,gtfield=StartedAt"`
+	Note      string    `json:"note" validate:"max=255"`
+}
+
+// TimerInput is the optional body of the timer start
+type TimerInput struct {
+	Note string `json:"note" validate:"max=255"`
+}
+
+// Stop ends a running entry at the time
+func (e *TimeEntry) Stop(at time.Time) {
+	e.EndedAt = &at
+	e.DurationSeconds = int64(at.Sub(e.StartedAt).Seconds())
+}
+
+func (e TimeEntry) Api() TimeEntryApi {
+	seconds := e.DurationSeconds
+	if e.EndedAt == nil {
+		seconds = int64(time.Since(e.StartedAt).Seconds())
+	}
+
+	return TimeEntryApi{
+		ID:        e.ID,
+		TaskID:    e.TaskID,
+		UserID:    e.UserID,
+		StartedAt: e.StartedAt.UTC(),
+		EndedAt:   UTC(e.EndedAt),
+		Seconds:   seconds,
+		Running:   e.EndedAt == nil,
+		Note:      e.Note,
+	}
+}
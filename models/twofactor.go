@@ -0,0 +1,10 @@
+package models
+
+import "gorm.io/gorm"
+
+// BackupCode is a single-use 2FA recovery code, only its hash is stored
+type BackupCode struct {
+	gorm.Model
+	UserID   uint
+	CodeHash string `gorm:"index"`
+}
@@ -1,16 +1,141 @@
 package models
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
 	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	RoleUser  = "user"
+	RoleAdmin = "admin"
 )
 
 type User struct {
 	gorm.Model
-	Email    string `json:"email" gorm:"unique"`
-	Username string `json:"username" gorm:"unique"`
-	Password string `json:"password"`
-	Tasks    []Task `gorm:"foreignKey:UserID"`
+	Role   string `json:"role" gorm:"default:user"`
+	Locked bool   `json:"locked"`
+	// LockedUntil is the end of the lockout after too many failed logins in a row
+	LockedUntil  *time.Time `json:"-"`
+	FailedLogins int        `json:"-"`
+	Email        string     `json:"email" gorm:"unique"`
+	Username     string     `json:"username" gorm:"unique"`
+	Password     string     `json:"-"`
+	Tasks        []Task     `json:"-" gorm:"foreignKey:UserID"`
+
+	DisplayName  string `json:"displayName"`
+	PendingEmail string `json:"pendingEmail"`
+	EmailToken   string `json:"-"`
+	// EmailVerifiedAt is when the user proved the email is theirs, by a verification link, a
+	// login link or a provider verifying it; nil until then
+	EmailVerifiedAt *time.Time `json:"-"`
+
+	// CalendarToken is the hash of the secret of the calendar feed URL
+	CalendarToken string `json:"-"`
+	// InboxToken is the hash of the local part of the inbound email address
+	InboxToken string `json:"-" gorm:"index"`
+	// DigestSentAt is when the last daily digest was sent
+	DigestSentAt *time.Time `json:"-"`
+
+	TOTPSecret  string `json:"-"`
+	TOTPEnabled bool   `json:"totpEnabled"`
+	// TOTPLastStep is the time step of the last TOTP code accepted, the codes of the steps up to it
+	// are refused
+	TOTPLastStep int64 `json:"-"`
+
+	// TimeZone is the IANA zone the days of the user are in, UTC when empty
+	TimeZone string `json:"timeZone" gorm:"size:64"`
+	// Locale is the BCP 47 language tag of the user, like en-US
+	Locale string `json:"locale" gorm:"size:35"`
+	// AvatarKey is the storage key of the uploaded avatar without its size, empty without one
+	AvatarKey string `json:"-" gorm:"size:255"`
+	// DemoExpiresAt is when a demo account is removed with all its data, nil for the other accounts
+	DemoExpiresAt *time.Time `json:"-" gorm:"index"`
+
+	// ImpersonatorID is the admin acting as the user in the request, 0 when it is the user
+	ImpersonatorID uint `json:"-" gorm:"-"`
+}
+
+// Location returns the zone of the user, UTC without a valid one
+func (u User) Location() *time.Location {
+	loc, err := Location(u.TimeZone)
+	if err != nil {
+		return time.UTC
+	}
+
+	return loc
+}
+
+// Demo tells whether the account is a temporary demo account
+func (u User) Demo() bool {
+	return u.DemoExpiresAt != nil
+}
+
+// UserApi is the view of the user signed in, it never has the password or the secrets
+type UserApi struct {
+	ID            uint   `json:"id"`
+	Email         string `json:"email"`
+	PendingEmail  string `json:"pendingEmail,omitempty"`
+	EmailVerified bool   `json:"emailVerified"`
+	Username      string `json:"username"`
+	DisplayName   string `json:"displayName"`
+	Role          string `json:"role"`
+	TOTPEnabled   bool   `json:"totpEnabled"`
+	TimeZone      string `json:"timeZone"`
+	Locale        string `json:"locale"`
+	// AvatarURLs are the URLs of the avatar by its size in pixels
+	AvatarURLs map[string]string `json:"avatarUrls"`
+	// DemoExpiresAt is when a demo account is removed, empty for the other accounts
+	DemoExpiresAt string `json:"demoExpiresAt,omitempty"`
+	CreatedAt     string `json:"createdAt"`
+}
+
+func (u User) Api() UserApi {
+	api := UserApi{
+		ID:            u.ID,
+		Email:         u.Email,
+		PendingEmail:  u.PendingEmail,
+		EmailVerified: u.EmailVerifiedAt != nil,
+		Username:      u.Username,
+		DisplayName:   u.DisplayName,
+		Role:          u.Role,
+		TOTPEnabled:   u.TOTPEnabled,
+		TimeZone:      u.TimeZone,
+		Locale:        u.Locale,
+		AvatarURLs:    u.AvatarURLs(),
+		CreatedAt:     Timestamp(u.CreatedAt),
+	}
+	if u.DemoExpiresAt != nil {
+		api.DemoExpiresAt = Timestamp(*u.DemoExpiresAt)
+	}
+
+	return api
+}
+
+// SignupInput is the body of the signup
+type SignupInput struct {
+	Email    string `json:"email" validate:"required,email"`
+	Username string `json:"username" validate:"notblank,max=64"`
+	Password string `json:"password" validate:"strongpassword"`
+}
+
+// LoginInput is the body of the login, the identity is an email or a username
+type LoginInput struct {
+	Identity string `json:"identity" validate:"required"`
+	Password string `json:"password" validate:"required"`
+}
+
+// ProfileInput is the body of the profile update, empty fields are left unchanged
+type ProfileInput struct {
+	Username    string  `json:"username" validate:"omitempty,notblank,max=64"`
+	Email       string  `json:"email" validate:"omitempty,email"`
+	DisplayName *string `json:"displayName" validate:"omitempty,max=128"`
+	// TimeZone is an IANA zone like Europe/Berlin
+	TimeZone string `json:"timeZone" validate:"omitempty,timezone"`
+	Locale   string `json:"locale" validate:"omitempty,bcp47_language_tag"`
 }
 
 // UserErrors represent the error format for user routes
@@ -21,8 +146,119 @@ type UserErrors struct {
 	Password string `json:"password"`
 }
 
-// Claims represent the structure of the JWT token
+// Fields returns the errors of the fields which have one
+func (e *UserErrors) Fields() map[string]string {
+	fields := map[string]string{}
+	for name, msg := range map[string]string{"email": e.Email, "username": e.Username, "password": e.Password} {
+		if msg != "" {
+			fields[name] = msg
+		}
+	}
+
+	return fields
+}
+
+// The reasons a session was revoked for
+const (
+	RevokedSignedOut       = "signed_out"
+	RevokedOtherSession    = "signed_out_by_other_session"
+	RevokedPasswordChanged = "password_changed"
+	RevokedLocked          = "locked"
+	RevokedAccountDeleted  = "account_deleted"
+	// RevokedSessionLimit is the least recently used session of a user with too many
+	RevokedSessionLimit = "session_limit"
+)
+
+// Claims represent the structure of the JWT token, the registered claims are kept as unix times.
+// The refresh tokens are stored as the sessions of the user, with the device they were issued to.
 type Claims struct {
-	jwt.StandardClaims
-	ID uint `gorm:"primaryKey"`
+	// ID is the session of a refresh token
+	ID        uint   `json:"ID" gorm:"primaryKey"`
+	Issuer    string `json:"iss,omitempty" gorm:"index"`
+	Subject   string `json:"sub,omitempty"`
+	ExpiresAt int64  `json:"exp,omitempty" gorm:"index"`
+	IssuedAt  int64  `json:"iat,omitempty"`
+	// TokenID is the random id of a refresh token, only its Fingerprint is stored
+	TokenID string `json:"jti,omitempty" gorm:"-"`
+	// ImpersonatedBy is the id of the admin an impersonation access token was issued to
+	ImpersonatedBy string `json:"impersonated_by,omitempty" gorm:"-"`
+
+	// TokenHash is the Fingerprint of the refresh token of a session
+	TokenHash string `json:"-" gorm:"size:64;uniqueIndex"`
+	// the device of a session is not part of the token
+	UserAgent  string    `json:"-"`
+	IP         string    `json:"-"`
+	CreatedAt  time.Time `json:"-"`
+	LastUsedAt time.Time `json:"-"`
+	// a revoked session is kept until it expires, so a reuse of its token is logged with the reason
+	RevokedAt     *time.Time `json:"-"`
+	RevokedReason string     `json:"-" gorm:"size:32"`
+}
+
+// Fingerprint returns the sha256 hex digest identifying a refresh token. The tokens issued before
+// they had an id are identified by their registered claims.
+func (cl *Claims) Fingerprint() string {
+	id := cl.TokenID
+	if id == "" {
+		id = fmt.Sprintf("legacy:%d:%s:%d:%d", cl.ID, cl.Issuer, cl.IssuedAt, cl.ExpiresAt)
+	}
+
+	sum := sha256.Sum256([]byte(id))
+	return hex.EncodeToString(sum[:])
+}
+
+func (cl *Claims) GetExpirationTime() (*jwt.NumericDate, error) {
+	return unixDate(cl.ExpiresAt), nil
+}
+
+func (cl *Claims) GetIssuedAt() (*jwt.NumericDate, error) {
+	return unixDate(cl.IssuedAt), nil
+}
+
+func (cl *Claims) GetNotBefore() (*jwt.NumericDate, error) {
+	return nil, nil
+}
+
+func (cl *Claims) GetIssuer() (string, error) {
+	return cl.Issuer, nil
+}
+
+func (cl *Claims) GetSubject() (string, error) {
+	return cl.Subject, nil
+}
+
+func (cl *Claims) GetAudience() (jwt.ClaimStrings, error) {
+	return nil, nil
+}
+
+func unixDate(t int64) *jwt.NumericDate {
+	if t == 0 {
+		return nil
+	}
+	return jwt.NewNumericDate(time.Unix(t, 0))
+}
+
+// Device is the client a session is issued to
+type Device struct {
+	UserAgent string
+	IP        string
+}
+
+type SessionApi struct {
+	ID         uint   `json:"id"`
+	UserAgent  string `json:"userAgent"`
+	IP         string `json:"ip"`
+	Current    bool   `json:"current"`
+	CreatedAt  string `json:"createdAt"`
+	LastUsedAt string `json:"lastUsedAt"`
+}
+
+func (cl Claims) Api() SessionApi {
+	return SessionApi{
+		ID:         cl.ID,
+		UserAgent:  cl.UserAgent,
+		IP:         cl.IP,
+		CreatedAt:  Timestamp(cl.CreatedAt),
+		LastUsedAt: Timestamp(cl.LastUsedAt),
+	}
 }
@@ -0,0 +1,96 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"strings"
+	"time"
+)
+
+type Webhook struct {
+	gorm.Model
+	UserID uint
+	URL    string
+	Secret string
+	Events string
+	Active bool `gorm:"default:true"`
+}
+
+// WebhookDelivery is a log entry of an attempt to deliver an event to a webhook
+type WebhookDelivery struct {
+	ID         uint      `gorm:"primaryKey"`
+	CreatedAt  time.Time `gorm:"index"`
+	WebhookID  uint      `gorm:"index"`
+	DeliveryID string
+	Event      string
+	Payload    string `gorm:"type:text"`
+	Attempt    int
+	StatusCode int
+	Error      string
+	Success    bool
+	DurationMs int64
+}
+
+type WebhookApi struct {
+	ID        uint     `json:"id"`
+	URL       string   `json:"url"`
+	Events    []string `json:"events"`
+	Active    *bool    `json:"active"`
+	Secret    string   `json:"secret,omitempty"`
+	CreatedAt string   `json:"createdAt"`
+}
+
+type WebhookDeliveryApi struct {
+	ID         uint   `json:"id"`
+	DeliveryID string `json:"deliveryId"`
+	Event      string `json:"event"`
+	Attempt    int    `json:"attempt"`
+	StatusCode int    `json:"statusCode"`
+	Error      string `json:"error,omitempty"`
+	Success    bool   `json:"success"`
+	DurationMs int64  `json:"durationMs"`
+	CreatedAt  string `json:"createdAt"`
+}
+
+func (w Webhook) EventList() []string {
+	if w.Events == "" {
+		return []string{}
+	}
+
+	return strings.Split(w.Events, ",")
+}
+
+// Accepts checks if the webhook is subscribed to the event type
+func (w Webhook) Accepts(event string) bool {
+	for _, e := range w.EventList() {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (w Webhook) Api() WebhookApi {
+	active := w.Active
+	return WebhookApi{
+		ID:        w.ID,
+		URL:       w.URL,
+		Events:    w.EventList(),
+		Active:    &active,
+		CreatedAt: Timestamp(w.CreatedAt),
+	}
+}
+
+func (d WebhookDelivery) Api() WebhookDeliveryApi {
+	return WebhookDeliveryApi{
+		ID:         d.ID,
+		DeliveryID: d.DeliveryID,
+		Event:      d.Event,
+		Attempt:    d.Attempt,
+		StatusCode: d.StatusCode,
+		Error:      d.Error,
+		Success:    d.Success,
+		DurationMs: d.DurationMs,
+		CreatedAt:  Timestamp(d.CreatedAt),
+	}
+}
@@ -0,0 +1,101 @@
+package models
+
+import (
+	"gorm.io/gorm"
+	"time"
+)
+
+const (
+	WorkspaceOwner  = "owner"
+	WorkspaceMember = "member"
+	WorkspaceViewer = "viewer"
+)
+
+// WorkspaceWriters are the roles allowed to change the data of a workspace
+var WorkspaceWriters = []string{WorkspaceOwner, WorkspaceMember}
+
+type Workspace struct {
+	gorm.Model
+	Name    string `json:"name"`
+	OwnerID uint
+	// Plan is the plan limiting the workspace, the default plan when empty
+	Plan    string       `json:"plan"`
+	Members []Membership `gorm:"foreignKey:WorkspaceID"`
+}
+
+// Membership joins a user to a workspace with a role
+type Membership struct {
+	gorm.Model
+	WorkspaceID uint   `gorm:"uniqueIndex:idx_membership_workspace_user"`
+	UserID      uint   `gorm:"uniqueIndex:idx_membership_workspace_user"`
+	Role        string `json:"role"`
+	User        User
+}
+
+// Invite is a pending invitation to a workspace, only the hash of its token is stored
+type Invite struct {
+	gorm.Model
+	WorkspaceID uint
+	Email       string
+	Role        string
+	TokenHash   string `gorm:"uniqueIndex"`
+	InvitedByID uint
+	ExpiresAt   time.Time
+}
+
+// WorkspacePlanInput is the body of the plan change of a workspace by an admin
+type WorkspacePlanInput struct {
+	// Plan is one of the plans of the config, empty for the default one
+	Plan string `json:"plan" validate:"max=64"`
+}
+
+type WorkspaceApi struct {
+	ID        uint   `json:"id"`
+	Name      string `json:"name"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"createdAt"`
+}
+
+type MemberApi struct {
+	UserID   uint   `json:"userId"`
+	Username string `json:"username"`
+	Role     string `json:"role"`
+}
+
+type InviteApi struct {
+	ID        uint   `json:"id"`
+	Email     string `json:"email"`
+	Role      string `json:"role"`
+	ExpiresAt string `json:"expiresAt"`
+}
+
+func (w Workspace) Api(role string) WorkspaceApi {
+	return WorkspaceApi{
+		ID:        w.ID,
+		Name:      w.Name,
+		Role:      role,
+		CreatedAt: Timestamp(w.CreatedAt),
+	}
+}
+
+func (m Membership) Api() MemberApi {
+	return MemberApi{
+		UserID:   m.UserID,
+		Username: m.User.Username,
+		Role:     m.Role,
+	}
+}
+
+func (i Invite) Api() InviteApi {
+	return InviteApi{
+		ID:        i.ID,
+		Email:     i.Email,
+		Role:      i.Role,
+		ExpiresAt: Timestamp(i.ExpiresAt),
+	}
+}
+
+// IsWorkspaceRole checks if a role can be given to a workspace member
+func IsWorkspaceRole(role string) bool {
+	return role == WorkspaceOwner || role == WorkspaceMember || role == WorkspaceViewer
+}
@@ -0,0 +1,113 @@
+package notifications
+
+import (
+	"task-app/models"
+	"time"
+)
+
+// digestLead is how far ahead the digest lists the tasks due soon
+const digestLead = 24 * time.Hour
+
+// Digest is the daily email of the open tasks of a user which are overdue or due soon
+type Digest struct {
+	Date    time.Time
+	Overdue []models.Task
+	Due     []models.Task
+}
+
+// SendDigests emails the digest of the day to the users who did not receive it yet,
+// once the hour of the digest has passed in their zone. A user without a due task gets no email.
+// It returns how many digests were sent.
+func (n *Notifier) SendDigests(now time.Time, hour int) (int, error) {
+	if n.email == nil {
+		return 0, nil
+	}
+
+	var zones []string
+	if err := n.store.DB().Model(&models.User{}).Distinct("time_zone").Pluck("time_zone", &zones).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for _, zone := range zones {
+		loc, err := models.Location(zone)
+		if err != nil {
+			continue
+		}
+
+		at := digestTime(now.In(loc), hour)
+		if now.Before(at) {
+			continue
+		}
+
+		count, err := n.sendDigests(now.In(loc), at, zone)
+		sent += count
+		if err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+// sendDigests emails the digests of the users of the zone who did not receive one since the time
+func (n *Notifier) sendDigests(now, at time.Time, zone string) (int, error) {
+	var users []models.User
+	if err := n.store.DB().
+		Where("locked = ? AND time_zone = ? AND (digest_sent_at IS NULL OR digest_sent_at < ?)", false, zone, at).
+		Order("id").
+		Limit(500).
+		Find(&users).Error; err != nil {
+		return 0, err
+	}
+
+	sent := 0
+	for i := range users {
+		u := &users[i]
+		if n.Preference(u.ID, models.NotifyDigest).Email {
+			d, err := n.digest(u, now)
+			if err != nil {
+				return sent, err
+			}
+			if len(d.Overdue)+len(d.Due) > 0 {
+				n.email.SendDigest(u, d)
+				sent++
+			}
+		}
+
+		if err := n.store.DB().Model(u).UpdateColumn("digest_sent_at", now).Error; err != nil {
+			return sent, err
+		}
+	}
+
+	return sent, nil
+}
+
+// digest returns the open tasks assigned to the user, or created by them and not assigned,
+// which are overdue or due within the lead
+func (n *Notifier) digest(u *models.User, now time.Time) (Digest, error) {
+	var tasks []models.Task
+	err := n.store.DB().
+		Where("status <> ? AND due_at IS NOT NULL AND due_at < ?", models.StatusDone, now.Add(digestLead)).
+		Where("assignee_id = ? OR (assignee_id IS NULL AND user_id = ?)", u.ID, u.ID).
+		Order("due_at").
+		Limit(100).
+		Find(&tasks).Error
+
+	d := Digest{Date: now}
+	for _, t := range tasks {
+		if t.DueAt.Before(now) {
+			d.Overdue = append(d.Overdue, t)
+		} else {
+			d.Due = append(d.Due, t)
+		}
+	}
+
+	return d, err
+}
+
+// digestTime is when the digest of the day of now is sent, in the zone of now
+func digestTime(now time.Time, hour int) time.Time {
+	y, m, d := now.Date()
+	return time.Date(y, m, d, hour, 0, 0, 0, now.Location())
+}
@@ -0,0 +1,174 @@
+package notifications
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"strconv"
+	"strings"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/mailer"
+	"task-app/models"
+)
+
+// EmailSender sends the notifications and the digests with the mailer.
+// Every email has a link unsubscribing the user from its kind.
+type EmailSender struct {
+	secret  string
+	baseURL string
+}
+
+// NewEmailSender returns a sender signing the unsubscribe links with the secret,
+// the links of the emails start with the base URL of the app
+func NewEmailSender(secret, baseURL string) *EmailSender {
+	return &EmailSender{secret: secret, baseURL: strings.TrimSuffix(baseURL, "/")}
+}
+
+// emailData is the data of the templates of mailer
+type emailData struct {
+	// T translates the texts of the templates to the language of the user
+	T              *i18n.Printer
+	Subject        string
+	Title          string
+	Body           string
+	TaskURL        string
+	Date           string
+	Overdue        []digestTask
+	Due            []digestTask
+	UnsubscribeURL string
+}
+
+type digestTask struct {
+	Title string
+	URL   string
+	Due   string
+}
+
+func (s *EmailSender) Send(u *models.User, n *models.Notification) {
+	data := emailData{
+		T:              i18n.For(u.Locale),
+		Subject:        n.Title,
+		Title:          n.Title,
+		Body:           n.Body,
+		UnsubscribeURL: s.unsubscribeURL(u.ID, n.Kind),
+	}
+	if n.TaskID != nil {
+		data.TaskURL = s.taskURL(*n.TaskID)
+	}
+
+	text := n.Title + "\n"
+	if n.Body != "" {
+		text += "\n" + n.Body + "\n"
+	}
+	if data.TaskURL != "" {
+		text += "\n" + data.TaskURL + "\n"
+	}
+
+	s.send(u, "notification.html", data, text)
+}
+
+func (s *EmailSender) SendDigest(u *models.User, d Digest) {
+	p := i18n.For(u.Locale)
+	data := emailData{
+		T:              p,
+		Subject:        p.Sprintf("Your tasks for %s", d.Date.Format(p.Text("Mon Jan 2"))),
+		Date:           d.Date.Format(p.Text("Monday, January 2")),
+		UnsubscribeURL: s.unsubscribeURL(u.ID, models.NotifyDigest),
+	}
+
+	text := data.Subject + "\n"
+	for _, group := range []struct {
+		title string
+		tasks []models.Task
+		into  *[]digestTask
+	}{
+		{p.Text("Overdue"), d.Overdue, &data.Overdue},
+		{p.Text("Due soon"), d.Due, &data.Due},
+	} {
+		if len(group.tasks) == 0 {
+			continue
+		}
+		text += "\n" + group.title + ":\n"
+		for _, t := range group.tasks {
+			task := digestTask{Title: t.Title, URL: s.taskURL(t.ID), Due: t.DueAt.In(u.Location()).Format(p.Text("Mon Jan 2 15:04 MST"))}
+			*group.into = append(*group.into, task)
+			text += "- " + p.Sprintf("%s, due %s", task.Title, task.Due) + "\n  " + task.URL + "\n"
+		}
+	}
+
+	s.send(u, "digest.html", data, text)
+}
+
+func (s *EmailSender) send(u *models.User, template string, data emailData, text string) {
+	html, err := mailer.Render(template, data)
+	if err != nil {
+		logging.Log.Error().Err(err).Str("template", template).Msg("Cannot render email")
+		return
+	}
+
+	mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: data.Subject,
+		HTML:    html,
+		Text:    text + "\n" + data.T.Text("Unsubscribe from these emails") + ": " + data.UnsubscribeURL + "\n",
+		Headers: map[string]string{
+			// RFC 8058, the mail clients unsubscribe with a POST to the link
+			"List-Unsubscribe":      "<" + data.UnsubscribeURL + ">",
+			"List-Unsubscribe-Post": "List-Unsubscribe=One-Click",
+		},
+	})
+}
+
+// taskURL is the page of the task in the app
+func (s *EmailSender) taskURL(id uint) string {
+	return s.baseURL + "/tasks/" + strconv.Itoa(int(id))
+}
+
+func (s *EmailSender) unsubscribeURL(userID uint, kind string) string {
+	return s.baseURL + "/api/v1/notifications/unsubscribe/" + UnsubscribeToken(s.secret, userID, kind)
+}
+
+// UnsubscribeToken returns the token of the unsubscribe link of a kind of emails for the user.
+// It is signed with the secret and never expires, so the links of the old emails keep working.
+func UnsubscribeToken(secret string, userID uint, kind string) string {
+	payload := base64.RawURLEncoding.EncodeToString([]byte(strconv.Itoa(int(userID)) + ":" + kind))
+	return payload + "." + signUnsubscribe(secret, payload)
+}
+
+// ParseUnsubscribeToken verifies an unsubscribe token and returns its user and kind
+func ParseUnsubscribeToken(secret, token string) (uint, string, error) {
+	invalid := errors.New("invalid unsubscribe token")
+
+	dot := strings.IndexByte(token, '.')
+	if dot < 0 {
+		return 0, "", invalid
+	}
+	payload, signature := token[:dot], token[dot+1:]
+	if !hmac.Equal([]byte(signature), []byte(signUnsubscribe(secret, payload))) {
+		return 0, "", invalid
+	}
+
+	b, err := base64.RawURLEncoding.DecodeString(payload)
+	if err != nil {
+		return 0, "", invalid
+	}
+	parts := strings.SplitN(string(b), ":", 2)
+	if len(parts) != 2 {
+		return 0, "", invalid
+	}
+	id, err := strconv.Atoi(parts[0])
+	if err != nil || id <= 0 {
+		return 0, "", invalid
+	}
+
+	return uint(id), parts[1], nil
+}
+
+func signUnsubscribe(secret, payload string) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write([]byte("unsubscribe\n" + payload))
+	return hex.EncodeToString(mac.Sum(nil))
+}
@@ -0,0 +1,353 @@
+// Package notifications turns the events of the app into notifications of the users concerned,
+// delivered in the app and by the other channels the users choose.
+package notifications
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"task-app/db"
+	"task-app/events"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"time"
+)
+
+// Sender delivers notifications by a channel other than the app, e.g. by email
+type Sender interface {
+	Send(u *models.User, n *models.Notification)
+	SendDigest(u *models.User, d Digest)
+}
+
+// Chat sends the due reminders to the chat a user linked, e.g. Telegram
+type Chat interface {
+	RemindDue(userID uint, task *models.Task)
+}
+
+// Pusher sends the notifications to the devices of the mobile apps of a user
+type Pusher interface {
+	Push(userID uint, n *models.Notification)
+}
+
+// Notifier creates the notifications of the events, it is subscribed to the events with Handle
+type Notifier struct {
+	store db.Store
+	tasks repository.TaskRepo
+	users repository.UserRepo
+	email Sender
+	chat  Chat
+	push  Pusher
+}
+
+func New(store db.Store) *Notifier {
+	return &Notifier{
+		store: store,
+		tasks: repository.NewTaskRepo(store),
+		users: repository.NewUserRepo(store),
+	}
+}
+
+// UseEmail sets the sender of the notifications the users want by email, there is none by default
+func (n *Notifier) UseEmail(s Sender) {
+	n.email = s
+}
+
+// UseChat sets the chat of the due reminders, there is none by default
+func (n *Notifier) UseChat(c Chat) {
+	n.chat = c
+}
+
+// UsePush sets the pusher of the notifications the users want on their devices, there is none by default
+func (n *Notifier) UsePush(p Pusher) {
+	n.push = p
+}
+
+// Preferences returns the channels of every kind for the user, the defaults for the kinds not chosen
+func (n *Notifier) Preferences(userID uint) ([]models.NotificationPreference, error) {
+	var saved []models.NotificationPreference
+	if err := n.store.DB().Where("user_id = ?", userID).Find(&saved).Error; err != nil {
+		return nil, err
+	}
+
+	byKind := make(map[string]models.NotificationPreference, len(saved))
+	for _, p := range saved {
+		byKind[p.Kind] = p
+	}
+
+	prefs := make([]models.NotificationPreference, 0, len(models.NotificationKinds))
+	for _, kind := range models.NotificationKinds {
+		p, ok := byKind[kind]
+		if !ok {
+			p = models.DefaultPreference(userID, kind)
+		}
+		prefs = append(prefs, p)
+	}
+
+	return prefs, nil
+}
+
+// Preference returns the channels of a kind for the user
+func (n *Notifier) Preference(userID uint, kind string) models.NotificationPreference {
+	p := new(models.NotificationPreference)
+	if res := n.store.DB().Where("user_id = ? AND kind = ?", userID, kind).Limit(1).Find(p); res.Error != nil || res.RowsAffected == 0 {
+		return models.DefaultPreference(userID, kind)
+	}
+
+	return *p
+}
+
+// SavePreferences saves the channels of the kinds given, the other kinds are unchanged.
+// A preference without push keeps the push of its kind.
+func (n *Notifier) SavePreferences(ctx context.Context, userID uint, prefs []models.NotificationPreferenceApi) error {
+	return n.store.WithTx(ctx, func(tx *gorm.DB) error {
+		for _, p := range prefs {
+			pref := models.NotificationPreference{UserID: userID, Kind: p.Kind, InApp: p.InApp, Email: p.Email}
+			if p.Push != nil {
+				pref.Push = *p.Push
+			} else {
+				pref.Push = n.Preference(userID, p.Kind).Push
+			}
+			if err := tx.Clauses(clause.OnConflict{
+				Columns:   []clause.Column{{Name: "user_id"}, {Name: "kind"}},
+				DoUpdates: clause.AssignmentColumns([]string{"in_app", "email", "push"}),
+			}).Create(&pref).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// Unsubscribe stops the emails of the kind for the user, the notifications in the app are unchanged
+func (n *Notifier) Unsubscribe(userID uint, kind string) error {
+	pref := n.Preference(userID, kind).Api()
+	pref.Email = false
+	return n.SavePreferences(context.Background(), userID, []models.NotificationPreferenceApi{pref})
+}
+
+// Notify delivers the notification to its user by the channels of its kind.
+// A user is never notified of an action of their own.
+func (n *Notifier) Notify(note models.Notification) error {
+	if note.UserID == 0 || note.UserID == note.ActorID {
+		return nil
+	}
+
+	pref := n.Preference(note.UserID, note.Kind)
+	if pref.InApp {
+		if err := n.store.DB().Create(&note).Error; err != nil {
+			return err
+		}
+	}
+
+	if pref.Email && n.email != nil {
+		u, err := n.users.ByID(note.UserID)
+		if err != nil {
+			return err
+		}
+		n.email.Send(u, &note)
+	}
+
+	if pref.Push && n.push != nil {
+		n.push.Push(note.UserID, &note)
+	}
+
+	return nil
+}
+
+// Handle notifies the users concerned by an event: the assignee of a task, the users mentioned
+// in a comment and the watchers of a task about its comments and changes
+func (n *Notifier) Handle(e events.Event) {
+	if e.TaskID == 0 {
+		return
+	}
+
+	var err error
+	switch e.Type {
+	case events.TaskAssigned:
+		err = n.taskAssigned(e)
+	case events.CommentAdded:
+		err = n.commentAdded(e)
+	case events.TaskUpdated, events.TaskCompleted, events.TaskUnblocked, events.TaskRestored:
+		err = n.taskChanged(e)
+	}
+
+	if err != nil {
+		logging.Log.Error().Err(err).Str("event", e.Type).Uint("task", e.TaskID).Msg("Cannot notify")
+	}
+}
+
+func (n *Notifier) taskAssigned(e events.Event) error {
+	task, actor, err := n.eventTask(e)
+	if err != nil || task.AssigneeID == nil {
+		return err
+	}
+
+	p := n.printer(*task.AssigneeID)
+	return n.Notify(models.Notification{
+		UserID:  *task.AssigneeID,
+		Kind:    models.NotifyAssigned,
+		TaskID:  &task.ID,
+		ActorID: e.ActorID,
+		Title:   p.Sprintf("%s assigned you to %s", actorName(p, actor), quote(task.Title)),
+	})
+}
+
+// commentAdded notifies the mentioned users, and the other watchers of the comment
+func (n *Notifier) commentAdded(e events.Event) error {
+	comment, ok := e.Payload.(models.CommentApi)
+	if !ok {
+		return nil
+	}
+
+	task, actor, err := n.eventTask(e)
+	if err != nil {
+		return err
+	}
+
+	notified := map[uint]bool{}
+	if len(comment.Mentions) > 0 {
+		mentioned, err := n.users.ByUsernames(comment.Mentions)
+		if err != nil {
+			return err
+		}
+		for _, u := range mentioned {
+			notified[u.ID] = true
+			p := i18n.For(u.Locale)
+			if err := n.Notify(models.Notification{
+				UserID:  u.ID,
+				Kind:    models.NotifyMentioned,
+				TaskID:  &task.ID,
+				ActorID: e.ActorID,
+				Title:   p.Sprintf("%s mentioned you on %s", actorName(p, actor), quote(task.Title)),
+				Body:    comment.Body,
+			}); err != nil {
+				return err
+			}
+		}
+	}
+
+	watchers, err := n.tasks.Watchers(task.ID, e.ActorID)
+	if err != nil {
+		return err
+	}
+	for _, w := range watchers {
+		if notified[w.ID] {
+			continue
+		}
+		p := i18n.For(w.Locale)
+		if err := n.Notify(models.Notification{
+			UserID:  w.ID,
+			Kind:    models.NotifyCommented,
+			TaskID:  &task.ID,
+			ActorID: e.ActorID,
+			Title:   p.Sprintf("%s commented on %s", actorName(p, actor), quote(task.Title)),
+			Body:    comment.Body,
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// taskChanged notifies the watchers of the task
+func (n *Notifier) taskChanged(e events.Event) error {
+	task, actor, err := n.eventTask(e)
+	if err != nil {
+		return err
+	}
+
+	format := "%s updated %s"
+	switch e.Type {
+	case events.TaskCompleted:
+		format = "%s completed %s"
+	case events.TaskUnblocked:
+		format = "%[2]s is not blocked anymore"
+	case events.TaskRestored:
+		format = "%s restored %s"
+	}
+
+	watchers, err := n.tasks.Watchers(task.ID, e.ActorID)
+	if err != nil {
+		return err
+	}
+	for _, w := range watchers {
+		p := i18n.For(w.Locale)
+		if err := n.Notify(models.Notification{
+			UserID:  w.ID,
+			Kind:    models.NotifyUpdated,
+			TaskID:  &task.ID,
+			ActorID: e.ActorID,
+			Title:   p.Sprintf(format, actorName(p, actor), quote(task.Title)),
+		}); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
+
+// RemindDue notifies the assignee of the task, or its creator when it is not assigned, that it is due soon.
+// The reminder is sent to their chat too.
+func (n *Notifier) RemindDue(task *models.Task) error {
+	userID := task.UserID
+	if task.AssigneeID != nil {
+		userID = *task.AssigneeID
+	}
+
+	if n.chat != nil {
+		n.chat.RemindDue(userID, task)
+	}
+
+	// the due date is told in the zone and the language of the user
+	loc, p := time.UTC, i18n.English
+	if u, err := n.users.ByID(userID); err == nil {
+		loc, p = u.Location(), i18n.For(u.Locale)
+	}
+
+	return n.Notify(models.Notification{
+		UserID: userID,
+		Kind:   models.NotifyDue,
+		TaskID: &task.ID,
+		Title:  p.Sprintf("%s is due %s", quote(task.Title), task.DueAt.In(loc).Format(p.Text("Mon Jan 2 15:04 MST"))),
+	})
+}
+
+// eventTask returns the task of the event and the username of its actor, empty when it cannot be found
+func (n *Notifier) eventTask(e events.Event) (*models.Task, string, error) {
+	task := new(models.Task)
+	if err := n.store.DB().First(task, e.TaskID).Error; err != nil {
+		return nil, "", err
+	}
+
+	actor := ""
+	if u, err := n.users.ByID(e.ActorID); err == nil {
+		actor = u.Username
+	}
+
+	return task, actor, nil
+}
+
+// printer returns the printer of the language of the user
+func (n *Notifier) printer(userID uint) *i18n.Printer {
+	if u, err := n.users.ByID(userID); err == nil {
+		return i18n.For(u.Locale)
+	}
+
+	return i18n.English
+}
+
+// actorName returns the username of the actor, someone when it is not known
+func actorName(p *i18n.Printer, actor string) string {
+	if actor == "" {
+		return p.Text("Someone")
+	}
+
+	return actor
+}
+
+func quote(title string) string {
+	return "\"" + title + "\""
+}
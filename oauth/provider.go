@@ -0,0 +1,140 @@
+package oauth
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"os"
+	"strings"
+	"time"
+)
+
+// Profile is the user identity returned by a provider
+type Profile struct {
+	ID            string
+	Email         string
+	EmailVerified bool
+	Username      string
+	Name          string
+}
+
+// Provider is an OAuth2 authorization code flow configuration
+type Provider struct {
+	Name         string
+	ClientID     string
+	ClientSecret string
+	AuthURL      string
+	TokenURL     string
+	Scopes       []string
+
+	fetchProfile func(p *Provider, accessToken string) (*Profile, error)
+}
+
+// Providers holds the providers configured in env, by name
+var Providers = map[string]*Provider{}
+
+// RedirectBase is the public base url of the server used in redirect_uri
+var RedirectBase string
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// SetupProviders enables every provider whose client id is set in env
+func SetupProviders() {
+	RedirectBase = strings.TrimRight(os.Getenv("OAUTH_REDIRECT_BASE"), "/")
+	if RedirectBase == "" {
+		RedirectBase = "http://localhost:3000"
+	}
+
+	for _, p := range []*Provider{google(), github()} {
+		env := "OAUTH_" + strings.ToUpper(p.Name)
+		p.ClientID = os.Getenv(env + "_CLIENT_ID")
+		p.ClientSecret = os.Getenv(env + "_CLIENT_SECRET")
+
+		if p.ClientID != "" {
+			Providers[p.Name] = p
+		}
+	}
+}
+
+// RedirectURI returns the callback url registered for the provider
+func (p *Provider) RedirectURI() string {
+	return RedirectBase + "/api/v1/auth/" + p.Name + "/callback"
+}
+
+// AuthCodeURL returns the consent page url the user is redirected to
+func (p *Provider) AuthCodeURL(state string) string {
+	q := url.Values{}
+	q.Set("client_id", p.ClientID)
+	q.Set("redirect_uri", p.RedirectURI())
+	q.Set("response_type", "code")
+	q.Set("scope", strings.Join(p.Scopes, " "))
+	q.Set("state", state)
+
+	return p.AuthURL + "?" + q.Encode()
+}
+
+// Exchange trades an authorization code for the provider access token
+func (p *Provider) Exchange(code string) (string, error) {
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", p.RedirectURI())
+	form.Set("client_id", p.ClientID)
+	form.Set("client_secret", p.ClientSecret)
+
+	req, err := http.NewRequest(http.MethodPost, p.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+
+	var token struct {
+		AccessToken string `json:"access_token"`
+		Error       string `json:"error"`
+	}
+	if err := doJSON(req, &token); err != nil {
+		return "", err
+	}
+
+	if token.AccessToken == "" {
+		return "", fmt.Errorf("oauth %s: token exchange failed: %s", p.Name, token.Error)
+	}
+
+	return token.AccessToken, nil
+}
+
+// Profile fetches the identity of the user owning the access token
+func (p *Provider) Profile(accessToken string) (*Profile, error) {
+	return p.fetchProfile(p, accessToken)
+}
+
+func getJSON(rawURL, accessToken string, out interface{}) error {
+	req, err := http.NewRequest(http.MethodGet, rawURL, nil)
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "Bearer "+accessToken)
+	req.Header.Set("Accept", "application/json")
+
+	return doJSON(req, out)
+}
+
+func doJSON(req *http.Request, out interface{}) error {
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return errors.New("oauth: " + req.URL.Host + " responded " + res.Status + ": " + string(body))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
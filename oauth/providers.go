@@ -0,0 +1,73 @@
+package oauth
+
+import "strconv"
+
+func google() *Provider {
+	return &Provider{
+		Name:     "google",
+		AuthURL:  "https://accounts.google.com/o/oauth2/v2/auth",
+		TokenURL: "https://oauth2.googleapis.com/token",
+		Scopes:   []string{"openid", "email", "profile"},
+		fetchProfile: func(p *Provider, accessToken string) (*Profile, error) {
+			var info struct {
+				Sub           string `json:"sub"`
+				Email         string `json:"email"`
+				EmailVerified bool   `json:"email_verified"`
+				Name          string `json:"name"`
+			}
+			if err := getJSON("https://openidconnect.googleapis.com/v1/userinfo", accessToken, &info); err != nil {
+				return nil, err
+			}
+
+			return &Profile{
+				ID:            info.Sub,
+				Email:         info.Email,
+				EmailVerified: info.EmailVerified,
+				Name:          info.Name,
+			}, nil
+		},
+	}
+}
+
+func github() *Provider {
+	return &Provider{
+		Name:     "github",
+		AuthURL:  "https://github.com/login/oauth/authorize",
+		TokenURL: "https://github.com/login/oauth/access_token",
+		Scopes:   []string{"read:user", "user:email"},
+		fetchProfile: func(p *Provider, accessToken string) (*Profile, error) {
+			var user struct {
+				ID    int64  `json:"id"`
+				Login string `json:"login"`
+				Name  string `json:"name"`
+			}
+			if err := getJSON("https://api.github.com/user", accessToken, &user); err != nil {
+				return nil, err
+			}
+
+			// the public email of the profile may be missing or unverified,
+			// so the primary one is taken from the emails list
+			var emails []struct {
+				Email    string `json:"email"`
+				Primary  bool   `json:"primary"`
+				Verified bool   `json:"verified"`
+			}
+			if err := getJSON("https://api.github.com/user/emails", accessToken, &emails); err != nil {
+				return nil, err
+			}
+
+			profile := &Profile{
+				ID:       strconv.FormatInt(user.ID, 10),
+				Username: user.Login,
+				Name:     user.Name,
+			}
+			for _, e := range emails {
+				if e.Primary {
+					profile.Email, profile.EmailVerified = e.Email, e.Verified
+				}
+			}
+
+			return profile, nil
+		},
+	}
+}
@@ -0,0 +1,132 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/ecdsa"
+	"encoding/json"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io/ioutil"
+	"net/http"
+	"sync"
+	"task-app/config"
+	"task-app/models"
+	"time"
+)
+
+// apnsTokenTTL is how long a provider token is used, APNs refuses the ones older than an hour
+// and the ones renewed more often than every 20 minutes
+const apnsTokenTTL = 50 * time.Minute
+
+var (
+	apnsURL        = "https://api.push.apple.com/3/device/"
+	apnsSandboxURL = "https://api.sandbox.push.apple.com/3/device/"
+)
+
+// apns sends with the auth key of the team, signing a provider token kept for apnsTokenTTL.
+// The requests are made over HTTP/2, which the client negotiates with APNs.
+type apns struct {
+	keyID  string
+	teamID string
+	topic  string
+	key    *ecdsa.PrivateKey
+
+	mu     sync.Mutex
+	token  string
+	signed time.Time
+}
+
+func newAPNs(cfg config.Push) (*apns, error) {
+	b, err := ioutil.ReadFile(cfg.APNsKeyFile)
+	if err != nil {
+		return nil, fmt.Errorf("push: cannot read the APNs key: %w", err)
+	}
+	key, err := jwt.ParseECPrivateKeyFromPEM(b)
+	if err != nil {
+		return nil, fmt.Errorf("push: invalid APNs key: %w", err)
+	}
+
+	return &apns{keyID: cfg.APNsKeyID, teamID: cfg.APNsTeamID, topic: cfg.APNsTopic, key: key}, nil
+}
+
+func (a *apns) send(ctx context.Context, d *models.PushDevice, m Message) error {
+	token, err := a.providerToken()
+	if err != nil {
+		return err
+	}
+
+	payload := map[string]interface{}{
+		"aps": map[string]interface{}{
+			"alert": map[string]string{"title": m.Title, "body": m.Body},
+			"sound": "default",
+		},
+	}
+	for k, v := range m.data() {
+		payload[k] = v
+	}
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return err
+	}
+
+	endpoint := apnsURL
+	if d.Sandbox {
+		endpoint = apnsSandboxURL
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, endpoint+d.Token, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Authorization", "bearer "+token)
+	req.Header.Set("apns-topic", a.topic)
+	req.Header.Set("apns-push-type", "alert")
+	req.Header.Set("apns-priority", "10")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 300 {
+		return nil
+	}
+
+	var failure struct {
+		Reason string `json:"reason"`
+	}
+	json.NewDecoder(res.Body).Decode(&failure)
+	switch {
+	case res.StatusCode == http.StatusGone || failure.Reason == "BadDeviceToken" || failure.Reason == "DeviceTokenNotForTopic" || failure.Reason == "Unregistered":
+		return ErrStaleToken
+	case failure.Reason == "ExpiredProviderToken" || failure.Reason == "InvalidProviderToken":
+		// the provider token is signed again by the next attempt
+		a.mu.Lock()
+		a.token = ""
+		a.mu.Unlock()
+	case res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusRequestEntityTooLarge:
+		return fmt.Errorf("%w: apns: %s", errRejected, failure.Reason)
+	}
+
+	return fmt.Errorf("push: apns: %s %s", res.Status, failure.Reason)
+}
+
+// providerToken returns the token signed with the auth key, signed again once it is apnsTokenTTL old
+func (a *apns) providerToken() (string, error) {
+	a.mu.Lock()
+	defer a.mu.Unlock()
+	if a.token != "" && time.Since(a.signed) < apnsTokenTTL {
+		return a.token, nil
+	}
+
+	now := time.Now()
+	t := jwt.NewWithClaims(jwt.SigningMethodES256, jwt.MapClaims{"iss": a.teamID, "iat": now.Unix()})
+	t.Header["kid"] = a.keyID
+	signed, err := t.SignedString(a.key)
+	if err != nil {
+		return "", err
+	}
+	a.token, a.signed = signed, now
+
+	return a.token, nil
+}
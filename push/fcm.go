@@ -0,0 +1,180 @@
+package push
+
+import (
+	"bytes"
+	"context"
+	"crypto/rsa"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io/ioutil"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"task-app/models"
+	"time"
+)
+
+const fcmScope = "https://www.googleapis.com/auth/firebase.messaging"
+
+// fcmURL is the send endpoint of the HTTP v1 API, the project is appended
+var fcmURL = "https://fcm.googleapis.com/v1/projects/"
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+// fcm sends with the service account of the Firebase project, trading its signed assertion
+// for an access token kept until it expires
+type fcm struct {
+	projectID  string
+	email      string
+	keyID      string
+	tokenURI   string
+	privateKey *rsa.PrivateKey
+
+	mu      sync.Mutex
+	token   string
+	expires time.Time
+}
+
+func newFCM(file string) (*fcm, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, fmt.Errorf("push: cannot read the FCM credentials: %w", err)
+	}
+
+	var account struct {
+		ProjectID    string `json:"project_id"`
+		PrivateKeyID string `json:"private_key_id"`
+		PrivateKey   string `json:"private_key"`
+		ClientEmail  string `json:"client_email"`
+		TokenURI     string `json:"token_uri"`
+	}
+	if err := json.Unmarshal(b, &account); err != nil {
+		return nil, fmt.Errorf("push: the FCM credentials are not a service account key: %w", err)
+	}
+	if account.ProjectID == "" || account.ClientEmail == "" || account.TokenURI == "" {
+		return nil, errors.New("push: the FCM credentials have no project_id, client_email or token_uri")
+	}
+	key, err := jwt.ParseRSAPrivateKeyFromPEM([]byte(account.PrivateKey))
+	if err != nil {
+		return nil, fmt.Errorf("push: invalid private key of the FCM credentials: %w", err)
+	}
+
+	return &fcm{
+		projectID:  account.ProjectID,
+		email:      account.ClientEmail,
+		keyID:      account.PrivateKeyID,
+		tokenURI:   account.TokenURI,
+		privateKey: key,
+	}, nil
+}
+
+func (f *fcm) send(ctx context.Context, d *models.PushDevice, m Message) error {
+	token, err := f.accessToken(ctx)
+	if err != nil {
+		return err
+	}
+
+	body, err := json.Marshal(map[string]interface{}{
+		"message": map[string]interface{}{
+			"token":        d.Token,
+			"notification": map[string]string{"title": m.Title, "body": m.Body},
+			"data":         m.data(),
+		},
+	})
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, fcmURL+f.projectID+"/messages:send", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("Authorization", "Bearer "+token)
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+	if res.StatusCode < 300 {
+		return nil
+	}
+
+	var failure struct {
+		Error struct {
+			Status  string `json:"status"`
+			Message string `json:"message"`
+		} `json:"error"`
+	}
+	json.NewDecoder(res.Body).Decode(&failure)
+	switch {
+	case res.StatusCode == http.StatusNotFound || failure.Error.Status == "UNREGISTERED":
+		return ErrStaleToken
+	case res.StatusCode == http.StatusUnauthorized:
+		// the access token is asked again by the next attempt
+		f.mu.Lock()
+		f.token = ""
+		f.mu.Unlock()
+	case res.StatusCode == http.StatusBadRequest || res.StatusCode == http.StatusForbidden:
+		return fmt.Errorf("%w: fcm: %s %s", errRejected, failure.Error.Status, failure.Error.Message)
+	}
+
+	return fmt.Errorf("push: fcm: %s %s", res.Status, failure.Error.Message)
+}
+
+// accessToken returns the access token of the service account, a new one a minute before it expires
+func (f *fcm) accessToken(ctx context.Context) (string, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	if f.token != "" && time.Now().Before(f.expires.Add(-time.Minute)) {
+		return f.token, nil
+	}
+
+	now := time.Now()
+	assertion := jwt.NewWithClaims(jwt.SigningMethodRS256, jwt.MapClaims{
+		"iss":   f.email,
+		"scope": fcmScope,
+		"aud":   f.tokenURI,
+		"iat":   now.Unix(),
+		"exp":   now.Add(time.Hour).Unix(),
+	})
+	assertion.Header["kid"] = f.keyID
+	signed, err := assertion.SignedString(f.privateKey)
+	if err != nil {
+		return "", err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "urn:ietf:params:oauth:grant-type:jwt-bearer")
+	form.Set("assertion", signed)
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, f.tokenURI, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return "", err
+	}
+	defer res.Body.Close()
+	if res.StatusCode >= 300 {
+		return "", errors.New("push: fcm: the access token was refused: " + res.Status)
+	}
+
+	var grant struct {
+		AccessToken string `json:"access_token"`
+		ExpiresIn   int    `json:"expires_in"`
+	}
+	if err := json.NewDecoder(res.Body).Decode(&grant); err != nil {
+		return "", err
+	}
+	f.token = grant.AccessToken
+	f.expires = now.Add(time.Duration(grant.ExpiresIn) * time.Second)
+
+	return f.token, nil
+}
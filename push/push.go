@@ -0,0 +1,155 @@
+// Package push sends the notifications to the devices of the mobile apps: by Firebase Cloud
+// Messaging to the Android ones and by the Apple Push Notification service to the iOS ones.
+// Every device is sent to by a job of the queue, retried when the service fails, and the
+// devices whose token the service no longer accepts are removed.
+package push
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"task-app/config"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/queue"
+	"time"
+)
+
+// deliveryJob is the kind of the jobs sending a notification to a device
+const deliveryJob = "push.deliver"
+
+var (
+	// ErrStaleToken is the error of a token the service no longer accepts, e.g. of an uninstalled app
+	ErrStaleToken = errors.New("push: the token of the device is no longer valid")
+	// errRejected is the error of a message the service refuses however often it is sent
+	errRejected = errors.New("push: the message was rejected")
+)
+
+// Message is what a device shows, with the data the app opens the task with
+type Message struct {
+	Title  string `json:"title"`
+	Body   string `json:"body"`
+	Kind   string `json:"kind"`
+	TaskID *uint  `json:"taskId,omitempty"`
+}
+
+// data is the data of the message for the app, the services take strings only
+func (m Message) data() map[string]string {
+	data := map[string]string{"kind": m.Kind}
+	if m.TaskID != nil {
+		data["taskId"] = strconv.Itoa(int(*m.TaskID))
+	}
+
+	return data
+}
+
+// sender sends to the devices of a service
+type sender interface {
+	send(ctx context.Context, d *models.PushDevice, m Message) error
+}
+
+// delivery is the payload of a delivery job
+type delivery struct {
+	DeviceID uint    `json:"deviceId"`
+	Message  Message `json:"message"`
+}
+
+// Service sends the notifications to the devices of the services configured
+type Service struct {
+	senders map[string]sender
+}
+
+// New returns the service of the credentials of the config, and registers its jobs. A service
+// without any credentials sends nothing.
+func New(cfg config.Push) (*Service, error) {
+	s := &Service{senders: map[string]sender{}}
+	if cfg.FCMCredentialsFile != "" {
+		fcm, err := newFCM(cfg.FCMCredentialsFile)
+		if err != nil {
+			return nil, err
+		}
+		s.senders[models.ProviderFCM] = fcm
+	}
+	if cfg.APNsKeyFile != "" {
+		apns, err := newAPNs(cfg)
+		if err != nil {
+			return nil, err
+		}
+		s.senders[models.ProviderAPNs] = apns
+	}
+
+	queue.Register(deliveryJob, s.deliver, queue.Policy{
+		MaxAttempts: 5,
+		Backoff:     5 * time.Second,
+		MaxBackoff:  5 * time.Minute,
+	})
+
+	return s, nil
+}
+
+// Enabled tells whether a service is configured
+func (s *Service) Enabled() bool {
+	return len(s.senders) > 0
+}
+
+// Push queues the notification to every device of the user with a service configured
+func (s *Service) Push(userID uint, n *models.Notification) {
+	providers := make([]string, 0, len(s.senders))
+	for p := range s.senders {
+		providers = append(providers, p)
+	}
+
+	var devices []models.PushDevice
+	if err := db.DB.Where("user_id = ? AND provider IN ?", userID, providers).Find(&devices).Error; err != nil {
+		logging.Log.Error().Err(err).Uint("user", userID).Msg("Cannot find the push devices")
+		return
+	}
+
+	m := Message{Title: n.Title, Body: truncate(n.Body, 200), Kind: n.Kind, TaskID: n.TaskID}
+	for _, d := range devices {
+		if _, err := queue.Enqueue(deliveryJob, delivery{DeviceID: d.ID, Message: m}); err != nil {
+			logging.Log.Error().Err(err).Uint("device", d.ID).Msg("Cannot queue the push notification")
+		}
+	}
+}
+
+// deliver sends the message of a delivery job, a failed attempt fails the job so it is retried.
+// A stale token removes its device.
+func (s *Service) deliver(ctx context.Context, job *queue.Job) error {
+	var d delivery
+	if err := json.Unmarshal(job.Payload, &d); err != nil {
+		return queue.Permanent(err)
+	}
+
+	// the device may have been removed since the notification
+	device := new(models.PushDevice)
+	if res := db.DB.Where("id = ?", d.DeviceID).Limit(1).Find(device); res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return nil
+	}
+	sender, ok := s.senders[device.Provider]
+	if !ok {
+		return nil
+	}
+
+	err := sender.send(ctx, device, d.Message)
+	switch {
+	case errors.Is(err, ErrStaleToken):
+		logging.Log.Info().Uint("device", device.ID).Str("provider", device.Provider).Msg("Removing the push device of a stale token")
+		return db.DB.Delete(device).Error
+	case errors.Is(err, errRejected):
+		return queue.Permanent(err)
+	}
+
+	return err
+}
+
+func truncate(s string, n int) string {
+	if r := []rune(s); len(r) > n {
+		return string(r[:n-1]) + "…"
+	}
+	return s
+}
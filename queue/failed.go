@@ -0,0 +1,41 @@
+package queue
+
+import (
+	"encoding/json"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"time"
+)
+
+// recordFailed keeps the job which failed its last attempt for the admins
+func recordFailed(job *Job) {
+	failed := models.FailedJob{
+		JobID:    job.ID,
+		Kind:     job.Kind,
+		Payload:  string(job.Payload),
+		Attempts: job.Attempt,
+		Error:    job.LastError,
+		QueuedAt: job.QueuedAt,
+	}
+	if err := db.DB.Create(&failed).Error; err != nil {
+		logging.Log.Error().Err(err).Str("job", job.Kind).Str("id", job.ID).Msg("Cannot record the failed job")
+	}
+}
+
+// Retry queues a failed job again from its first attempt and removes its record
+func Retry(failed *models.FailedJob) (*Job, error) {
+	job := &Job{
+		ID:       failed.JobID,
+		Kind:     failed.Kind,
+		Payload:  json.RawMessage(failed.Payload),
+		Attempt:  1,
+		RunAt:    time.Now(),
+		QueuedAt: failed.QueuedAt,
+	}
+	if err := current().Push(job); err != nil {
+		return nil, err
+	}
+
+	return job, db.DB.Delete(failed).Error
+}
@@ -0,0 +1,87 @@
+package queue
+
+import (
+	"context"
+	"sort"
+	"sync"
+	"time"
+)
+
+// MemoryBackend keeps the jobs in the process, they are lost when it stops
+type MemoryBackend struct {
+	mu sync.Mutex
+	// jobs are ordered by RunAt
+	jobs []*Job
+	wake chan struct{}
+}
+
+func NewMemoryBackend() *MemoryBackend {
+	return &MemoryBackend{wake: make(chan struct{}, 1)}
+}
+
+func (m *MemoryBackend) Push(job *Job) error {
+	m.mu.Lock()
+	i := sort.Search(len(m.jobs), func(i int) bool { return m.jobs[i].RunAt.After(job.RunAt) })
+	m.jobs = append(m.jobs, nil)
+	copy(m.jobs[i+1:], m.jobs[i:])
+	m.jobs[i] = job
+	m.mu.Unlock()
+
+	m.signal()
+	return nil
+}
+
+// signal wakes a waiting worker
+func (m *MemoryBackend) signal() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+func (m *MemoryBackend) Pop(ctx context.Context) (*Job, error) {
+	for {
+		// a minute at most, a worker woken for a job another one took waits again
+		wait := time.Minute
+		m.mu.Lock()
+		if len(m.jobs) > 0 {
+			if wait = time.Until(m.jobs[0].RunAt); wait <= 0 {
+				job := m.jobs[0]
+				m.jobs = m.jobs[1:]
+				more := len(m.jobs) > 0
+				m.mu.Unlock()
+
+				// the next job may be due too, for another worker
+				if more {
+					m.signal()
+				}
+				return job, nil
+			}
+		}
+		m.mu.Unlock()
+
+		timer := time.NewTimer(wait)
+		select {
+		case <-ctx.Done():
+			timer.Stop()
+			return nil, ctx.Err()
+		case <-m.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+	}
+}
+
+// take removes and returns every job, due or not
+func (m *MemoryBackend) take() []*Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	jobs := m.jobs
+	m.jobs = nil
+	return jobs
+}
+
+func (m *MemoryBackend) Close() error {
+	return nil
+}
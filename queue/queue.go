@@ -0,0 +1,264 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/google/uuid"
+	"sync"
+	"task-app/config"
+	"task-app/encryption"
+	"task-app/logging"
+	"task-app/metrics"
+	"time"
+)
+
+// Job is a unit of background work, its payload is the JSON its handler reads
+type Job struct {
+	ID      string          `json:"id"`
+	Kind    string          `json:"kind"`
+	Payload json.RawMessage `json:"payload"`
+	// Attempt is the number of the next run, from 1
+	Attempt int `json:"attempt"`
+	// RunAt is when the job is due
+	RunAt     time.Time `json:"runAt"`
+	QueuedAt  time.Time `json:"queuedAt"`
+	LastError string    `json:"lastError,omitempty"`
+}
+
+// Handler runs a job, an error retries it by the policy of its kind.
+// The context is done when the queue stops.
+type Handler func(ctx context.Context, job *Job) error
+
+// Policy is how a failed job is retried
+type Policy struct {
+	// MaxAttempts is how many times a job is run before it is recorded as failed
+	MaxAttempts int
+	// Backoff is the delay before the second attempt, doubled on every next one up to MaxBackoff
+	Backoff    time.Duration
+	MaxBackoff time.Duration
+}
+
+// DefaultPolicy is the policy of the kinds registered without one
+var DefaultPolicy = Policy{MaxAttempts: 5, Backoff: 2 * time.Second, MaxBackoff: 10 * time.Minute}
+
+// delay returns the delay before the attempt following the failed one
+func (p Policy) delay(failed int) time.Duration {
+	d := p.Backoff
+	for i := 1; i < failed && d < p.MaxBackoff; i++ {
+		d *= 2
+	}
+	if p.MaxBackoff > 0 && d > p.MaxBackoff {
+		d = p.MaxBackoff
+	}
+
+	return d
+}
+
+// Backend keeps the jobs until they are due
+type Backend interface {
+	// Push keeps the job until its RunAt
+	Push(job *Job) error
+	// Pop returns a due job, waiting for one until the context is done
+	Pop(ctx context.Context) (*Job, error)
+	Close() error
+}
+
+// permanent is an error which is not retried
+type permanent struct{ error }
+
+func (e permanent) Unwrap() error {
+	return e.error
+}
+
+// Permanent marks the error of a job which fails the same way however often it runs,
+// the job is then recorded as failed without its remaining attempts
+func Permanent(err error) error {
+	return permanent{err}
+}
+
+type kind struct {
+	handler Handler
+	policy  Policy
+}
+
+var (
+	mu    sync.RWMutex
+	kinds = map[string]kind{}
+	// backend keeps the jobs queued before the start in the process
+	backend Backend = NewMemoryBackend()
+
+	running sync.WaitGroup
+	// stop stops the workers of the start
+	stop context.CancelFunc = func() {}
+)
+
+// Register sets the handler and the retry policy of the jobs of a kind, a zero policy is DefaultPolicy
+func Register(name string, h Handler, p Policy) {
+	if p.MaxAttempts == 0 {
+		p = DefaultPolicy
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	kinds[name] = kind{handler: h, policy: p}
+}
+
+// Enqueue queues a job of the kind with the payload encoded as JSON, to run as soon as a worker is free
+func Enqueue(kind string, payload interface{}) (*Job, error) {
+	return EnqueueAt(kind, payload, time.Now())
+}
+
+// EnqueueAt queues a job of the kind to run at the time
+func EnqueueAt(kind string, payload interface{}, at time.Time) (*Job, error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return nil, err
+	}
+
+	job := &Job{
+		ID:       uuid.New().String(),
+		Kind:     kind,
+		Payload:  body,
+		Attempt:  1,
+		RunAt:    at,
+		QueuedAt: time.Now(),
+	}
+	if err := current().Push(job); err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// Setup starts the workers of the config, on Redis when it has a URL and in the process otherwise.
+// The jobs kept in Redis are encrypted by the keyring, when it is not nil.
+func Setup(cfg config.Queue, k *encryption.Keyring) error {
+	b := current()
+	if cfg.RedisURL != "" {
+		redis, err := NewRedisBackend(cfg.RedisURL, k)
+		if err != nil {
+			return err
+		}
+		b = redis
+	}
+
+	Start(b, cfg.Workers)
+	return nil
+}
+
+// Start runs the jobs of the backend with the workers, the jobs queued in the process
+// before are moved to it
+func Start(b Backend, workers int) {
+	ctx, cancel := context.WithCancel(context.Background())
+
+	mu.Lock()
+	previous := backend
+	backend, stop = b, cancel
+	mu.Unlock()
+
+	if m, ok := previous.(*MemoryBackend); ok && previous != b {
+		for _, job := range m.take() {
+			if err := b.Push(job); err != nil {
+				logging.Log.Error().Err(err).Str("job", job.Kind).Msg("Cannot move the job to the queue")
+			}
+		}
+	}
+
+	for i := 0; i < workers; i++ {
+		running.Add(1)
+		go work(ctx)
+	}
+}
+
+// Stop stops taking jobs and waits for the ones in progress, then closes the backend
+func Stop() {
+	mu.RLock()
+	cancel := stop
+	mu.RUnlock()
+
+	cancel()
+	running.Wait()
+	current().Close()
+}
+
+func current() Backend {
+	mu.RLock()
+	defer mu.RUnlock()
+
+	return backend
+}
+
+func work(ctx context.Context) {
+	defer running.Done()
+	for {
+		job, err := current().Pop(ctx)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.Log.Error().Err(err).Msg("Cannot read the queue")
+			select {
+			case <-time.After(time.Second):
+			case <-ctx.Done():
+				return
+			}
+			continue
+		}
+
+		run(ctx, job)
+	}
+}
+
+// run runs a job, then queues it again or records it as failed when it fails
+func run(ctx context.Context, job *Job) {
+	mu.RLock()
+	k, ok := kinds[job.Kind]
+	mu.RUnlock()
+
+	start := time.Now()
+	var err error
+	if !ok {
+		err = Permanent(errors.New("no handler for the job kind " + job.Kind))
+	} else {
+		err = safely(ctx, k.handler, job)
+	}
+
+	result := "success"
+	if err != nil {
+		result = "failure"
+	}
+	metrics.JobRuns.Inc(job.Kind, result)
+	metrics.JobDuration.Observe(time.Since(start).Seconds(), job.Kind)
+	if err == nil {
+		return
+	}
+
+	log := logging.Log.Warn().Err(err).Str("job", job.Kind).Str("id", job.ID).Int("attempt", job.Attempt)
+	job.LastError = err.Error()
+	if errors.As(err, new(permanent)) || job.Attempt >= k.policy.MaxAttempts {
+		log.Msg("Job failed")
+		recordFailed(job)
+		return
+	}
+
+	log.Msg("Job failed, retrying")
+	job.RunAt = time.Now().Add(k.policy.delay(job.Attempt))
+	job.Attempt++
+	if err := current().Push(job); err != nil {
+		logging.Log.Error().Err(err).Str("job", job.Kind).Str("id", job.ID).Msg("Cannot queue the retry of the job")
+		recordFailed(job)
+	}
+}
+
+// safely runs the handler, a panic fails the job instead of the worker
+func safely(ctx context.Context, h Handler, job *Job) (err error) {
+	defer func() {
+		if r := recover(); r != nil {
+			err = fmt.Errorf("panic: %v", r)
+		}
+	}()
+
+	return h(ctx, job)
+}
@@ -0,0 +1,143 @@
+package queue
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"strconv"
+	"task-app/encryption"
+	"task-app/ratelimit"
+	"time"
+)
+
+const (
+	// redisDue is the sorted set of the ids of the jobs by their RunAt in milliseconds
+	redisDue = "queue:due"
+	// redisJob prefixes the key of a job, its JSON
+	redisJob = "queue:job:"
+	// redisPoll is how often a waiting worker looks for a due job
+	redisPoll = time.Second
+	// sealedPayload is the column the payloads are encrypted as
+	sealedPayload = "queue.payload"
+)
+
+// RedisBackend keeps the jobs in Redis, shared by the instances. A job is taken by the worker
+// which removes it from the due set first; a job taken by an instance which dies before
+// running it is lost.
+type RedisBackend struct {
+	store *ratelimit.RedisStorage
+	// keyring encrypts the payloads, e.g. the events of the webhooks embed the descriptions
+	keyring *encryption.Keyring
+}
+
+// storedJob is a job as kept in Redis, its payload is sealed when the keyring is set
+type storedJob struct {
+	*Job
+	Payload json.RawMessage `json:"payload,omitempty"`
+	Sealed  string          `json:"sealed,omitempty"`
+}
+
+// NewRedisBackend connects to a redis://[:password@]host[:port][/db] URL. The payloads are
+// encrypted by the keyring, in plaintext when it is nil. The jobs are kept for minutes, their
+// data keys are not removed by the rotation so they are still read after it.
+func NewRedisBackend(url string, k *encryption.Keyring) (*RedisBackend, error) {
+	store, err := ratelimit.NewRedisStorage(url)
+	if err != nil {
+		return nil, err
+	}
+
+	return &RedisBackend{store: store, keyring: k}, nil
+}
+
+func (r *RedisBackend) Push(job *Job) error {
+	stored := storedJob{Job: job, Payload: job.Payload}
+	if r.keyring != nil {
+		sealed, err := r.keyring.Encrypt(sealedPayload, string(job.Payload))
+		if err != nil {
+			return err
+		}
+		stored.Payload, stored.Sealed = nil, sealed
+	}
+	body, err := json.Marshal(stored)
+	if err != nil {
+		return err
+	}
+
+	if _, err := r.store.Do("SET", ratelimit.Key(redisJob+job.ID), string(body)); err != nil {
+		return err
+	}
+	_, err = r.store.Do("ZADD", ratelimit.Key(redisDue), strconv.FormatInt(job.RunAt.UnixNano()/int64(time.Millisecond), 10), job.ID)
+
+	return err
+}
+
+func (r *RedisBackend) Pop(ctx context.Context) (*Job, error) {
+	for {
+		job, err := r.take()
+		if job != nil || err != nil {
+			return job, err
+		}
+
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-time.After(redisPoll):
+		}
+	}
+}
+
+// take returns the first due job, nil when there is none or another worker took it
+func (r *RedisBackend) take() (*Job, error) {
+	now := strconv.FormatInt(time.Now().UnixNano()/int64(time.Millisecond), 10)
+	reply, err := r.store.Do("ZRANGEBYSCORE", ratelimit.Key(redisDue), "-inf", now, "LIMIT", "0", "1")
+	if err != nil {
+		return nil, err
+	}
+	ids, _ := reply.([]interface{})
+	if len(ids) == 0 {
+		return nil, nil
+	}
+	id, _ := ids[0].([]byte)
+
+	// the worker removing the id takes the job
+	removed, err := r.store.Do("ZREM", ratelimit.Key(redisDue), string(id))
+	if err != nil || removed != int64(1) {
+		return nil, err
+	}
+
+	key := ratelimit.Key(redisJob + string(id))
+	body, err := r.store.Do("GET", key)
+	if err != nil {
+		return nil, err
+	}
+	if _, err := r.store.Do("DEL", key); err != nil {
+		return nil, err
+	}
+
+	b, _ := body.([]byte)
+	if b == nil {
+		return nil, nil
+	}
+	stored := storedJob{Job: new(Job)}
+	if err := json.Unmarshal(b, &stored); err != nil {
+		return nil, err
+	}
+	job := stored.Job
+	job.Payload = stored.Payload
+	if stored.Sealed != "" {
+		if r.keyring == nil {
+			return nil, errors.New("queue: the job " + job.ID + " is encrypted, the encryption is off")
+		}
+		payload, err := r.keyring.Decrypt(sealedPayload, stored.Sealed)
+		if err != nil {
+			return nil, err
+		}
+		job.Payload = json.RawMessage(payload)
+	}
+
+	return job, nil
+}
+
+func (r *RedisBackend) Close() error {
+	return r.store.Close()
+}
@@ -0,0 +1,343 @@
+// Package quota limits the workspaces by their plan: the tasks, the size of the attachments
+// and the members. The limits are checked when the rows are created through GORM, so every
+// way of creating a task counts, and before a change which would go over them.
+package quota
+
+import (
+	"fmt"
+	"gorm.io/gorm"
+	"reflect"
+	"task-app/config"
+	"task-app/models"
+	"task-app/repository"
+)
+
+// Resource is what a plan limits
+type Resource string
+
+const (
+	Tasks   Resource = "tasks"
+	Storage Resource = "storage"
+	Members Resource = "members"
+)
+
+// Resources are the resources of the usage, in its order
+var Resources = []Resource{Tasks, Storage, Members}
+
+// Service checks the usage of the workspaces against the limits of their plan
+type Service struct {
+	plans config.Plans
+}
+
+// ExceededError is the error of a change which would take a workspace over a limit of its plan
+type ExceededError struct {
+	WorkspaceID uint
+	Plan        string
+	Resource    Resource
+	Limit       int64
+	// Usage is the usage before the change, Requested what the change adds
+	Usage     int64
+	Requested int64
+	// Upgrade is the smallest plan allowing the change, nil when there is none
+	Upgrade *config.Plan
+	// UpgradeURL is the page to upgrade the plan at, empty without one
+	UpgradeURL string
+}
+
+// Hint is the limit of an ExceededError for the client, with the plan to upgrade to
+type Hint struct {
+	Resource  Resource `json:"resource"`
+	Plan      string   `json:"plan"`
+	Limit     int64    `json:"limit"`
+	Usage     int64    `json:"usage"`
+	Requested int64    `json:"requested"`
+	// Upgrade is the smallest plan allowing the change, missing when no plan does
+	Upgrade *UpgradeHint `json:"upgrade,omitempty"`
+}
+
+type UpgradeHint struct {
+	Plan  string `json:"plan"`
+	Limit int64  `json:"limit"`
+	// URL is the page to upgrade the plan at, when the instance has one
+	URL string `json:"url,omitempty"`
+}
+
+// Meter is the usage of a resource, a limit of 0 is no limit
+type Meter struct {
+	Used  int64 `json:"used"`
+	Limit int64 `json:"limit"`
+}
+
+// Usage is the usage of a workspace against the limits of its plan
+type Usage struct {
+	Plan    string `json:"plan"`
+	Tasks   Meter  `json:"tasks"`
+	Storage Meter  `json:"storage"`
+	Members Meter  `json:"members"`
+}
+
+func (e *ExceededError) Error() string {
+	if e.Resource == Storage {
+		return fmt.Sprintf("The attachments of the workspace would be larger than the %s of its %s plan", size(e.Limit), e.Plan)
+	}
+	return fmt.Sprintf("The workspace reached the %d %s of its %s plan", e.Limit, e.Resource, e.Plan)
+}
+
+// size is a size in bytes for a message
+func size(n int64) string {
+	switch {
+	case n >= 1<<30:
+		return fmt.Sprintf("%d GB", n>>30)
+	case n >= 1<<20:
+		return fmt.Sprintf("%d MB", n>>20)
+	case n >= 1<<10:
+		return fmt.Sprintf("%d KB", n>>10)
+	}
+	return fmt.Sprintf("%d bytes", n)
+}
+
+// Hint returns the limit and the upgrade for the client
+func (e *ExceededError) Hint() Hint {
+	hint := Hint{Resource: e.Resource, Plan: e.Plan, Limit: e.Limit, Usage: e.Usage, Requested: e.Requested}
+	if e.Upgrade != nil {
+		hint.Upgrade = &UpgradeHint{Plan: e.Upgrade.Name, Limit: limit(*e.Upgrade, e.Resource), URL: e.UpgradeURL}
+	}
+
+	return hint
+}
+
+// New returns the service of the plans
+func New(plans config.Plans) *Service {
+	return &Service{plans: plans}
+}
+
+// Plan returns the plan of the workspace, false when it has none so it is not limited
+func (s *Service) Plan(w *models.Workspace) (config.Plan, bool) {
+	name := w.Plan
+	if name == "" {
+		name = s.plans.Default
+	}
+
+	return s.find(name)
+}
+
+// Known tells whether a plan can be given to a workspace, the empty plan is the default
+func (s *Service) Known(name string) bool {
+	_, ok := s.find(name)
+	return ok || name == ""
+}
+
+func (s *Service) find(name string) (config.Plan, bool) {
+	for _, p := range s.plans.Plans {
+		if p.Name == name {
+			return p, true
+		}
+	}
+
+	return config.Plan{}, false
+}
+
+// Check returns an *ExceededError when adding the amount of the resource takes the workspace over
+// its plan. The personal data, without a workspace, is not limited.
+func (s *Service) Check(tx *gorm.DB, workspaceID *uint, resource Resource, amount int64) error {
+	if workspaceID == nil || amount <= 0 {
+		return nil
+	}
+
+	// the usage of the workspace counts the rows of every member, and the workspace of an invite is
+	// not one of the tenant until the membership is created
+	tx = repository.AllTenants(tx.Session(&gorm.Session{NewDB: true}))
+	w := new(models.Workspace)
+	if err := tx.Select("id", "plan").First(w, *workspaceID).Error; err != nil {
+		// the placement of the data reports the missing workspaces
+		return nil
+	}
+	plan, ok := s.Plan(w)
+	if !ok || limit(plan, resource) == 0 {
+		return nil
+	}
+
+	used, err := s.used(tx, w.ID, resource)
+	if err != nil {
+		return err
+	}
+	if used+amount <= limit(plan, resource) {
+		return nil
+	}
+
+	return &ExceededError{
+		WorkspaceID: w.ID,
+		Plan:        plan.Name,
+		Resource:    resource,
+		Limit:       limit(plan, resource),
+		Usage:       used,
+		Requested:   amount,
+		Upgrade:     s.upgrade(plan, resource, used+amount),
+		UpgradeURL:  s.plans.UpgradeURL,
+	}
+}
+
+// Move checks the move of a task from a workspace to another, which adds it to the tasks of the
+// other workspace
+func (s *Service) Move(tx *gorm.DB, from, to *uint) error {
+	if to == nil || from != nil && *from == *to {
+		return nil
+	}
+
+	return s.Check(tx, to, Tasks, 1)
+}
+
+// Usage returns the usage of the workspace with the limits of its plan
+func (s *Service) Usage(tx *gorm.DB, w *models.Workspace) (Usage, error) {
+	plan, _ := s.Plan(w)
+	usage := Usage{Plan: plan.Name}
+	meters := map[Resource]*Meter{Tasks: &usage.Tasks, Storage: &usage.Storage, Members: &usage.Members}
+
+	tx = repository.AllTenants(tx.Session(&gorm.Session{NewDB: true}))
+	for _, resource := range Resources {
+		used, err := s.used(tx, w.ID, resource)
+		if err != nil {
+			return usage, err
+		}
+		*meters[resource] = Meter{Used: used, Limit: limit(plan, resource)}
+	}
+
+	return usage, nil
+}
+
+// used counts the resource of the workspace: its tasks but the deleted ones, the size of the
+// attachments of its tasks, in the trash too as their files are kept, and its members
+func (s *Service) used(tx *gorm.DB, workspaceID uint, resource Resource) (int64, error) {
+	var used int64
+	var err error
+	switch resource {
+	case Tasks:
+		err = tx.Model(&models.Task{}).Where("workspace_id = ?", workspaceID).Count(&used).Error
+	case Storage:
+		tasks := tx.Unscoped().Model(&models.Task{}).Select("id").Where("workspace_id = ?", workspaceID)
+		err = tx.Model(&models.Attachment{}).Where("task_id IN (?)", tasks).Select("COALESCE(SUM(size), 0)").Scan(&used).Error
+	case Members:
+		err = tx.Model(&models.Membership{}).Where("workspace_id = ?", workspaceID).Count(&used).Error
+	}
+
+	return used, err
+}
+
+// upgrade returns the first plan after the plan allowing the amount of the resource
+func (s *Service) upgrade(current config.Plan, resource Resource, amount int64) *config.Plan {
+	after := false
+	for i, p := range s.plans.Plans {
+		if p.Name == current.Name {
+			after = true
+			continue
+		}
+		if after && (limit(p, resource) == 0 || limit(p, resource) >= amount) {
+			return &s.plans.Plans[i]
+		}
+	}
+
+	return nil
+}
+
+func limit(p config.Plan, resource Resource) int64 {
+	switch resource {
+	case Tasks:
+		return p.MaxTasks
+	case Storage:
+		return p.MaxStorage
+	case Members:
+		return p.MaxMembers
+	}
+
+	return 0
+}
+
+// Enforce checks the limits on every creation of tasks, attachments and memberships through GORM,
+// the creation fails with the *ExceededError of the first workspace going over its plan
+func (s *Service) Enforce(db *gorm.DB) error {
+	return db.Callback().Create().Before("gorm:create").Register("quota:check", s.checkCreate)
+}
+
+func (s *Service) checkCreate(tx *gorm.DB) {
+	if tx.Error != nil || tx.Statement.Schema == nil {
+		return
+	}
+
+	var resource Resource
+	switch tx.Statement.Schema.Table {
+	case "tasks":
+		resource = Tasks
+	case "attachments":
+		resource = Storage
+	case "memberships":
+		resource = Members
+	default:
+		return
+	}
+
+	amounts := map[uint]int64{}
+	var order []uint
+	for _, row := range rows(tx.Statement.ReflectValue) {
+		workspaceID, amount := added(tx, row)
+		if workspaceID == 0 {
+			continue
+		}
+		if _, ok := amounts[workspaceID]; !ok {
+			order = append(order, workspaceID)
+		}
+		amounts[workspaceID] += amount
+	}
+
+	for _, id := range order {
+		id := id
+		if err := s.Check(tx, &id, resource, amounts[id]); err != nil {
+			tx.AddError(err)
+			return
+		}
+	}
+}
+
+// added returns the workspace of a created row and what it adds to the resource of the workspace
+func added(tx *gorm.DB, row interface{}) (uint, int64) {
+	switch r := row.(type) {
+	case *models.Task:
+		if r.WorkspaceID != nil {
+			return *r.WorkspaceID, 1
+		}
+	case *models.Membership:
+		return r.WorkspaceID, 1
+	case *models.Attachment:
+		var task models.Task
+		err := repository.AllTenants(tx.Session(&gorm.Session{NewDB: true})).Unscoped().Select("id", "workspace_id").First(&task, r.TaskID).Error
+		if err == nil && task.WorkspaceID != nil {
+			return *task.WorkspaceID, r.Size
+		}
+	}
+
+	return 0, 0
+}
+
+// rows returns the pointers to the rows of a creation, one struct or a slice of them
+func rows(v reflect.Value) []interface{} {
+	for v.Kind() == reflect.Ptr {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		rows := make([]interface{}, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			item := reflect.Indirect(v.Index(i))
+			if item.CanAddr() {
+				rows = append(rows, item.Addr().Interface())
+			}
+		}
+		return rows
+	case reflect.Struct:
+		if v.CanAddr() {
+			return []interface{}{v.Addr().Interface()}
+		}
+	}
+
+	return nil
+}
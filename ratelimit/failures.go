@@ -0,0 +1,130 @@
+package ratelimit
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// Failures counts the failed attempts of a key, e.g. the logins of an IP.
+// A key with max failures is blocked until no failure happened for a window.
+// The counts are kept in Store when it is set, in the memory of the process otherwise.
+type Failures struct {
+	name   string
+	max    int
+	window time.Duration
+}
+
+// NewFailures returns a counter allowing max failures per key, 0 never blocks.
+// The policy is overridden by the env RATE_LIMIT_<NAME> as Limit does.
+func NewFailures(name string, max int, window time.Duration) *Failures {
+	max, window = policyFromEnv(name, max, window)
+	return &Failures{name: name, max: max, window: window}
+}
+
+// Blocked checks if the key reached the max failures
+func (f *Failures) Blocked(key string) bool {
+	return f.max > 0 && f.count(key) >= f.max
+}
+
+// Add records a failure of the key and returns its count of failures
+func (f *Failures) Add(key string) int {
+	n := f.count(key) + 1
+	f.storage().Set(f.key(key), []byte(strconv.Itoa(n)), f.window)
+	return n
+}
+
+// Reset forgets the failures of the key
+func (f *Failures) Reset(key string) {
+	f.storage().Delete(f.key(key))
+}
+
+func (f *Failures) count(key string) int {
+	b, err := f.storage().Get(f.key(key))
+	if err != nil || b == nil {
+		return 0
+	}
+
+	n, _ := strconv.Atoi(string(b))
+	return n
+}
+
+func (f *Failures) key(key string) string {
+	return "failures:" + f.name + ":" + key
+}
+
+func (f *Failures) storage() fiber.Storage {
+	if Store != nil {
+		return Store
+	}
+	return memory
+}
+
+// memory is the store of the failures without Store
+var memory = &memoryStorage{entries: map[string]memoryEntry{}}
+
+type memoryEntry struct {
+	value   []byte
+	expires time.Time
+}
+
+// memoryStorage is a fiber.Storage in a map, the expired entries are dropped when they are read
+// or when the map is written
+type memoryStorage struct {
+	mu      sync.Mutex
+	entries map[string]memoryEntry
+}
+
+func (s *memoryStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	e, ok := s.entries[key]
+	if !ok {
+		return nil, nil
+	}
+	if !e.expires.IsZero() && time.Now().After(e.expires) {
+		delete(s.entries, key)
+		return nil, nil
+	}
+
+	return e.value, nil
+}
+
+func (s *memoryStorage) Set(key string, val []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	for k, e := range s.entries {
+		if !e.expires.IsZero() && now.After(e.expires) {
+			delete(s.entries, k)
+		}
+	}
+
+	e := memoryEntry{value: val}
+	if ttl > 0 {
+		e.expires = now.Add(ttl)
+	}
+	s.entries[key] = e
+	return nil
+}
+
+func (s *memoryStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *memoryStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string]memoryEntry{}
+	return nil
+}
+
+func (s *memoryStorage) Close() error {
+	return nil
+}
@@ -0,0 +1,80 @@
+package ratelimit
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/limiter"
+	"os"
+	"strconv"
+	"strings"
+	"task-app/logging"
+	"task-app/models"
+	"time"
+)
+
+// Store keeps the hits of all the policies, shared between the instances of the app.
+// It is nil by default, so the hits are counted in the memory of the process.
+var Store fiber.Storage
+
+// SetupStore selects the Redis backend when RATE_LIMIT_REDIS_URL is set
+func SetupStore() {
+	url := os.Getenv("RATE_LIMIT_REDIS_URL")
+	if url == "" {
+		return
+	}
+
+	s, err := NewRedisStorage(url)
+	if err != nil {
+		logging.Log.Fatal().Err(err).Msg("Cannot connect to the rate limit store")
+	}
+	Store = s
+}
+
+// Limit returns a middleware allowing max requests per window and client IP.
+// The policy is overridden by the env RATE_LIMIT_<NAME> as max/window, e.g. 5/1m,
+// a max of 0 disables it.
+func Limit(name string, max int, window time.Duration) fiber.Handler {
+	max, window = policyFromEnv(name, max, window)
+	if max <= 0 {
+		return func(c *fiber.Ctx) error {
+			return c.Next()
+		}
+	}
+
+	return limiter.New(limiter.Config{
+		Max:        max,
+		Expiration: window,
+		Storage:    Store,
+		KeyGenerator: func(c *fiber.Ctx) string {
+			return "ratelimit:" + name + ":" + c.IP()
+		},
+		// Retry-After is set by the limiter before calling this
+		LimitReached: func(c *fiber.Ctx) error {
+			return models.NewError(fiber.StatusTooManyRequests, "Too many requests, try again later")
+		},
+	})
+}
+
+func policyFromEnv(name string, max int, window time.Duration) (int, time.Duration) {
+	env := "RATE_LIMIT_" + strings.ToUpper(name)
+	value := os.Getenv(env)
+	if value == "" {
+		return max, window
+	}
+
+	parts := strings.SplitN(value, "/", 2)
+	n, err := strconv.Atoi(parts[0])
+	if err != nil {
+		logging.Log.Warn().Err(err).Str("env", env).Msg("Invalid rate limit, using the default")
+		return max, window
+	}
+	if len(parts) == 2 {
+		d, err := time.ParseDuration(parts[1])
+		if err != nil || d <= 0 {
+			logging.Log.Warn().Str("env", env).Msg("Invalid rate limit window, using the default")
+			return n, window
+		}
+		window = d
+	}
+
+	return n, window
+}
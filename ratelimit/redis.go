@@ -0,0 +1,278 @@
+package ratelimit
+
+import (
+	"bufio"
+	"errors"
+	"fmt"
+	"io"
+	"net"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const (
+	redisPoolSize = 10
+	redisTimeout  = 2 * time.Second
+	redisPrefix   = "tasker:"
+)
+
+// RedisStorage implements fiber.Storage over the RESP protocol, with the few commands the limiter and the cache need.
+// The job queue runs its own commands with Do.
+// Keys are prefixed so Reset only deletes the keys of the app.
+type RedisStorage struct {
+	addr     string
+	password string
+	db       int
+	pool     chan *redisConn
+}
+
+type redisConn struct {
+	net.Conn
+	r *bufio.Reader
+}
+
+// redisError is an error reply of the server, the connection stays usable after it
+type redisError string
+
+func (e redisError) Error() string {
+	return "redis: " + string(e)
+}
+
+// NewRedisStorage connects to a redis://[:password@]host[:port][/db] URL
+func NewRedisStorage(rawurl string) (*RedisStorage, error) {
+	u, err := url.Parse(rawurl)
+	if err != nil {
+		return nil, err
+	}
+	if u.Scheme != "redis" {
+		return nil, errors.New("redis: the URL scheme must be redis")
+	}
+
+	s := &RedisStorage{
+		addr: u.Host,
+		pool: make(chan *redisConn, redisPoolSize),
+	}
+	if u.Port() == "" {
+		s.addr = net.JoinHostPort(u.Hostname(), "6379")
+	}
+	if password, ok := u.User.Password(); ok {
+		s.password = password
+	}
+	if path := strings.Trim(u.Path, "/"); path != "" {
+		if s.db, err = strconv.Atoi(path); err != nil {
+			return nil, errors.New("redis: invalid database " + path)
+		}
+	}
+
+	// fail at startup rather than on the first request
+	if err := s.Ping(); err != nil {
+		return nil, err
+	}
+
+	return s, nil
+}
+
+// Ping checks the server answers
+func (s *RedisStorage) Ping() error {
+	_, err := s.do("PING")
+	return err
+}
+
+func (s *RedisStorage) Get(key string) ([]byte, error) {
+	reply, err := s.do("GET", redisPrefix+key)
+	if err != nil || reply == nil {
+		return nil, err
+	}
+
+	return reply.([]byte), nil
+}
+
+func (s *RedisStorage) Set(key string, val []byte, ttl time.Duration) error {
+	if key == "" || len(val) == 0 {
+		return nil
+	}
+
+	args := []string{"SET", redisPrefix + key, string(val)}
+	if ttl > 0 {
+		args = append(args, "PX", strconv.FormatInt(ttl.Milliseconds(), 10))
+	}
+
+	_, err := s.do(args...)
+	return err
+}
+
+func (s *RedisStorage) Delete(key string) error {
+	_, err := s.do("DEL", redisPrefix+key)
+	return err
+}
+
+// Reset deletes the keys of the app, scanning them by prefix
+func (s *RedisStorage) Reset() error {
+	cursor := "0"
+	for {
+		reply, err := s.do("SCAN", cursor, "MATCH", redisPrefix+"*", "COUNT", "100")
+		if err != nil {
+			return err
+		}
+
+		page, ok := reply.([]interface{})
+		if !ok || len(page) != 2 {
+			return errors.New("redis: unexpected SCAN reply")
+		}
+		cursor = string(page[0].([]byte))
+
+		if keys, _ := page[1].([]interface{}); len(keys) > 0 {
+			args := []string{"DEL"}
+			for _, k := range keys {
+				args = append(args, string(k.([]byte)))
+			}
+			if _, err := s.do(args...); err != nil {
+				return err
+			}
+		}
+
+		if cursor == "0" {
+			return nil
+		}
+	}
+}
+
+func (s *RedisStorage) Close() error {
+	for {
+		select {
+		case conn := <-s.pool:
+			conn.Close()
+		default:
+			return nil
+		}
+	}
+}
+
+// Do runs a command the storage has no method for, its keys are prefixed with Key.
+// Bulk strings are returned as []byte, integers as int64 and arrays as []interface{}.
+func (s *RedisStorage) Do(args ...string) (interface{}, error) {
+	return s.do(args...)
+}
+
+// Key returns the key with the prefix of the app
+func Key(key string) string {
+	return redisPrefix + key
+}
+
+// do runs a command on a pooled connection. Connections with a network error are dropped.
+func (s *RedisStorage) do(args ...string) (interface{}, error) {
+	conn, err := s.get()
+	if err != nil {
+		return nil, err
+	}
+
+	reply, err := conn.do(args...)
+	if _, ok := err.(redisError); err != nil && !ok {
+		conn.Close()
+		return nil, err
+	}
+
+	s.put(conn)
+	return reply, err
+}
+
+func (s *RedisStorage) get() (*redisConn, error) {
+	select {
+	case conn := <-s.pool:
+		return conn, nil
+	default:
+	}
+
+	c, err := net.DialTimeout("tcp", s.addr, redisTimeout)
+	if err != nil {
+		return nil, err
+	}
+	conn := &redisConn{Conn: c, r: bufio.NewReader(c)}
+
+	if s.password != "" {
+		if _, err := conn.do("AUTH", s.password); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+	if s.db != 0 {
+		if _, err := conn.do("SELECT", strconv.Itoa(s.db)); err != nil {
+			conn.Close()
+			return nil, err
+		}
+	}
+
+	return conn, nil
+}
+
+func (s *RedisStorage) put(conn *redisConn) {
+	select {
+	case s.pool <- conn:
+	default:
+		conn.Close()
+	}
+}
+
+func (c *redisConn) do(args ...string) (interface{}, error) {
+	c.SetDeadline(time.Now().Add(redisTimeout))
+
+	var b strings.Builder
+	fmt.Fprintf(&b, "*%d\r\n", len(args))
+	for _, arg := range args {
+		fmt.Fprintf(&b, "$%d\r\n%s\r\n", len(arg), arg)
+	}
+	if _, err := c.Write([]byte(b.String())); err != nil {
+		return nil, err
+	}
+
+	return c.readReply()
+}
+
+// readReply reads a RESP2 reply: bulk strings are returned as []byte, nil bulk strings as nil
+func (c *redisConn) readReply() (interface{}, error) {
+	line, err := c.r.ReadString('\n')
+	if err != nil {
+		return nil, err
+	}
+	if len(line) < 3 {
+		return nil, errors.New("redis: invalid reply")
+	}
+	kind, line := line[0], line[1:len(line)-2]
+
+	switch kind {
+	case '+':
+		return line, nil
+	case '-':
+		return nil, redisError(line)
+	case ':':
+		return strconv.ParseInt(line, 10, 64)
+	case '$':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		buf := make([]byte, n+2)
+		if _, err := io.ReadFull(c.r, buf); err != nil {
+			return nil, err
+		}
+		return buf[:n], nil
+	case '*':
+		n, err := strconv.Atoi(line)
+		if err != nil || n < 0 {
+			return nil, err
+		}
+		items := make([]interface{}, n)
+		for i := range items {
+			if items[i], err = c.readReply(); err != nil {
+				if _, ok := err.(redisError); !ok {
+					return nil, err
+				}
+			}
+		}
+		return items, nil
+	}
+
+	return nil, errors.New("redis: unknown reply type " + string(kind))
+}
@@ -0,0 +1,174 @@
+package realtime
+
+import (
+	"sync"
+	"task-app/db"
+	"task-app/events"
+	"task-app/models"
+)
+
+const (
+	// clientBuffer is how many messages may wait for a slow client before new ones are dropped
+	clientBuffer = 64
+	// historySize is how many recent messages are kept for replay to reconnecting clients
+	historySize = 1000
+)
+
+// Message is the envelope pushed to connected clients
+type Message struct {
+	ID    uint64       `json:"id"`
+	Event string       `json:"event"`
+	Data  events.Event `json:"data"`
+}
+
+// Client is a connection of a user waiting for messages
+type Client struct {
+	UserID uint
+	Send   chan Message
+}
+
+// Hub fans out the events to the connected clients of the users who can see them
+type Hub struct {
+	mu      sync.RWMutex
+	clients map[uint]map[*Client]bool
+	seq     uint64
+	closed  bool
+
+	// history is a ring buffer of the recent messages with their audience
+	history []delivered
+	next    int
+}
+
+type delivered struct {
+	msg      Message
+	audience []uint
+}
+
+// DefaultHub is the hub every REST handler broadcasts to through the event bus
+var DefaultHub = NewHub()
+
+func NewHub() *Hub {
+	return &Hub{
+		clients: map[uint]map[*Client]bool{},
+		history: make([]delivered, 0, historySize),
+	}
+}
+
+// Register adds a connection of the user.
+// The channel of a client registered after Close is closed right away.
+func (h *Hub) Register(userID uint) *Client {
+	c := &Client{UserID: userID, Send: make(chan Message, clientBuffer)}
+
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closed {
+		close(c.Send)
+		return c
+	}
+	if h.clients[userID] == nil {
+		h.clients[userID] = map[*Client]bool{}
+	}
+	h.clients[userID][c] = true
+
+	return c
+}
+
+// Unregister removes the connection and closes its channel
+func (h *Hub) Unregister(c *Client) {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if _, ok := h.clients[c.UserID][c]; ok {
+		delete(h.clients[c.UserID], c)
+		if len(h.clients[c.UserID]) == 0 {
+			delete(h.clients, c.UserID)
+		}
+		close(c.Send)
+	}
+}
+
+// Close disconnects every client, so the long running connections end on shutdown
+func (h *Hub) Close() {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	h.closed = true
+	for _, clients := range h.clients {
+		for c := range clients {
+			close(c.Send)
+		}
+	}
+	h.clients = map[uint]map[*Client]bool{}
+}
+
+// Publish sends the event to every client of its audience
+func (h *Hub) Publish(e events.Event) {
+	audience := Audience(e)
+
+	h.mu.Lock()
+	h.seq++
+	msg := Message{
+		ID:    h.seq,
+		Event: e.Type,
+		Data:  e,
+	}
+
+	d := delivered{msg: msg, audience: audience}
+	if len(h.history) < historySize {
+		h.history = append(h.history, d)
+	} else {
+		h.history[h.next] = d
+	}
+	h.next = (h.next + 1) % historySize
+	h.mu.Unlock()
+
+	h.send(audience, msg)
+}
+
+// Replay returns the messages of the user published after lastID which are still in the history
+func (h *Hub) Replay(userID uint, lastID uint64) []Message {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+
+	var messages []Message
+	for i := 0; i < len(h.history); i++ {
+		// start from the oldest entry of the ring
+		d := h.history[(h.next+i)%len(h.history)]
+		if d.msg.ID <= lastID {
+			continue
+		}
+		for _, id := range d.audience {
+			if id == userID {
+				messages = append(messages, d.msg)
+				break
+			}
+		}
+	}
+
+	return messages
+}
+
+func (h *Hub) send(userIDs []uint, msg Message) {
+	h.mu.RLock()
+	defer h.mu.RUnlock()
+	for _, id := range userIDs {
+		for c := range h.clients[id] {
+			select {
+			case c.Send <- msg:
+			default:
+				// the client does not keep up, it misses the message instead of blocking everyone
+			}
+		}
+	}
+}
+
+// Audience returns the users who can see the event:
+// the members of the workspace, or the owner of personal data. The members are read on the
+// primary, the event may be the one of a member just added.
+func Audience(e events.Event) []uint {
+	if e.WorkspaceID == nil {
+		return []uint{e.OwnerID}
+	}
+
+	var ids []uint
+	db.Primary(db.DB).Model(&models.Membership{}).Where("workspace_id = ?", *e.WorkspaceID).Pluck("user_id", &ids)
+	return ids
+}
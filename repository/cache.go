@@ -0,0 +1,201 @@
+package repository
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"strconv"
+	"task-app/cache"
+	"task-app/models"
+	"time"
+)
+
+// cachedUserRepo caches the users by id, the changes made through it drop them. The users are
+// cached without their credentials, which are read by Credentials.
+type cachedUserRepo struct {
+	UserRepo
+	cache *cache.Cache
+}
+
+// NewCachedUserRepo returns the repo over another one caching ByID, the repo itself without a cache
+func NewCachedUserRepo(repo UserRepo, c *cache.Cache) UserRepo {
+	if c == nil {
+		return repo
+	}
+
+	return cachedUserRepo{UserRepo: repo, cache: c}
+}
+
+func (r cachedUserRepo) WithContext(ctx context.Context) UserRepo {
+	return cachedUserRepo{UserRepo: r.UserRepo.WithContext(ctx), cache: r.cache}
+}
+
+func (r cachedUserRepo) ByID(id uint) (*models.User, error) {
+	key := "user:" + strconv.FormatUint(uint64(id), 10)
+	u := new(models.User)
+	if r.cache.Get(cache.Users, key, u) {
+		return u, nil
+	}
+
+	u, err := r.UserRepo.ByID(id)
+	if err != nil {
+		return nil, err
+	}
+	u.Password, u.TOTPSecret = "", ""
+	r.cache.Set(cache.Users, key, u)
+
+	return u, nil
+}
+
+func (r cachedUserRepo) Create(u *models.User) error {
+	return r.forget(r.UserRepo.Create(u), cache.Users)
+}
+
+func (r cachedUserRepo) Register(u *models.User) error {
+	return r.forget(r.UserRepo.Register(u), cache.Users)
+}
+
+func (r cachedUserRepo) Save(u *models.User) error {
+	return r.forget(r.UserRepo.Save(u), cache.Users)
+}
+
+func (r cachedUserRepo) Update(u *models.User, fields map[string]interface{}) error {
+	return r.forget(r.UserRepo.Update(u, fields), cache.Users)
+}
+
+func (r cachedUserRepo) UseTOTPStep(u *models.User, step int64) (bool, error) {
+	used, err := r.UserRepo.UseTOTPStep(u, step)
+
+	return used, r.forget(err, cache.Users)
+}
+
+func (r cachedUserRepo) AddFailedLogin(u *models.User) (int, error) {
+	failed, err := r.UserRepo.AddFailedLogin(u)
+
+	return failed, r.forget(err, cache.Users)
+}
+
+func (r cachedUserRepo) EnableTOTP(u *models.User, codeHashes []string) error {
+	return r.forget(r.UserRepo.EnableTOTP(u, codeHashes), cache.Users)
+}
+
+func (r cachedUserRepo) DisableTOTP(u *models.User) error {
+	return r.forget(r.UserRepo.DisableTOTP(u), cache.Users)
+}
+
+func (r cachedUserRepo) Delete(u *models.User, cascadeTasks bool) error {
+	return r.forget(r.UserRepo.Delete(u, cascadeTasks), cache.Users, cache.Tasks)
+}
+
+// forget drops the scopes once the change is committed, the writes of a transaction
+// may have been read back into the cache before
+func (r cachedUserRepo) forget(err error, scopes ...string) error {
+	if err == nil {
+		r.cache.Forget(scopes...)
+	}
+
+	return err
+}
+
+// cachedTaskRepo caches the task lists, the changes made through it drop them
+type cachedTaskRepo struct {
+	TaskRepo
+	cache *cache.Cache
+	// ctx is the context of WithContext, with the tenant of the lists
+	ctx context.Context
+}
+
+// NewCachedTaskRepo returns the repo over another one caching List, the repo itself without a cache
+func NewCachedTaskRepo(repo TaskRepo, c *cache.Cache) TaskRepo {
+	if c == nil {
+		return repo
+	}
+
+	return cachedTaskRepo{TaskRepo: repo, cache: c}
+}
+
+func (r cachedTaskRepo) WithContext(ctx context.Context) TaskRepo {
+	return cachedTaskRepo{TaskRepo: r.TaskRepo.WithContext(ctx), cache: r.cache, ctx: ctx}
+}
+
+func (r cachedTaskRepo) List(u *models.User, f TaskFilter) ([]models.Task, error) {
+	// checked before the cache, which would answer for another user
+	if err := authorizeUser(r.ctx, u); err != nil {
+		return nil, err
+	}
+	filter, err := json.Marshal(f)
+	if err != nil {
+		return r.TaskRepo.List(u, f)
+	}
+	sum := sha256.Sum256(filter)
+	// the tasks a user can read depend only on the id, see models.AccessibleBy
+	key := "list:" + strconv.FormatUint(uint64(u.ID), 10) + ":" + hex.EncodeToString(sum[:16])
+
+	var tasks []models.Task
+	if r.cache.Get(cache.Tasks, key, &tasks) {
+		return tasks, nil
+	}
+
+	tasks, err = r.TaskRepo.List(u, f)
+	if err != nil {
+		return nil, err
+	}
+	r.cache.Set(cache.Tasks, key, tasks)
+
+	return tasks, nil
+}
+
+func (r cachedTaskRepo) Create(t *models.Task) error {
+	return r.forget(r.TaskRepo.Create(t))
+}
+
+func (r cachedTaskRepo) Save(t *models.Task) error {
+	return r.forget(r.TaskRepo.Save(t))
+}
+
+func (r cachedTaskRepo) Update(t *models.Task, fields map[string]interface{}) error {
+	return r.forget(r.TaskRepo.Update(t, fields))
+}
+
+func (r cachedTaskRepo) Delete(t *models.Task) error {
+	return r.forget(r.TaskRepo.Delete(t))
+}
+
+func (r cachedTaskRepo) ArchiveDone(u *models.User, before time.Time) (int64, error) {
+	n, err := r.TaskRepo.ArchiveDone(u, before)
+	return n, r.forget(err)
+}
+
+func (r cachedTaskRepo) Restore(t *models.Task) error {
+	return r.forget(r.TaskRepo.Restore(t))
+}
+
+func (r cachedTaskRepo) AddWatcher(t *models.Task, u *models.User) error {
+	return r.forget(r.TaskRepo.AddWatcher(t, u))
+}
+
+func (r cachedTaskRepo) RemoveWatcher(t *models.Task, userID uint) error {
+	return r.forget(r.TaskRepo.RemoveWatcher(t, userID))
+}
+
+func (r cachedTaskRepo) AddLabel(t *models.Task, label *models.Label) error {
+	return r.forget(r.TaskRepo.AddLabel(t, label))
+}
+
+func (r cachedTaskRepo) RemoveLabel(t *models.Task, label *models.Label) error {
+	return r.forget(r.TaskRepo.RemoveLabel(t, label))
+}
+
+func (r cachedTaskRepo) Reorder(u *models.User, ids []uint) ([]models.Task, error) {
+	tasks, err := r.TaskRepo.Reorder(u, ids)
+	return tasks, r.forget(err)
+}
+
+func (r cachedTaskRepo) forget(err error) error {
+	if err == nil {
+		r.cache.Forget(cache.Tasks)
+	}
+
+	return err
+}
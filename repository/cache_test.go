@@ -0,0 +1,139 @@
+package repository
+
+import (
+	"bytes"
+	"context"
+	"sync"
+	"task-app/cache"
+	"task-app/models"
+	"testing"
+	"time"
+)
+
+// mapStorage is a fiber.Storage of a map
+type mapStorage struct {
+	mu      sync.Mutex
+	entries map[string][]byte
+}
+
+func (s *mapStorage) Get(key string) ([]byte, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return s.entries[key], nil
+}
+
+func (s *mapStorage) Set(key string, val []byte, exp time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries[key] = append([]byte(nil), val...)
+	return nil
+}
+
+func (s *mapStorage) Delete(key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.entries, key)
+	return nil
+}
+
+func (s *mapStorage) Reset() error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.entries = map[string][]byte{}
+	return nil
+}
+
+func (s *mapStorage) Close() error {
+	return nil
+}
+
+func TestCachedUserWithoutCredentials(t *testing.T) {
+	store := &mapStorage{entries: map[string][]byte{}}
+	users := NewCachedUserRepo(NewMemoryUserRepo(), cache.NewWithStorage(store, time.Minute))
+
+	u := &models.User{Username: "al", Email: "al@example.com", Password: "$2a$10$passwordhash", TOTPSecret: "TOTPSECRETBASE32"}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+
+	// the miss which stores the entry, then the hit
+	for i := 0; i < 2; i++ {
+		cached, err := users.ByID(u.ID)
+		if err != nil {
+			t.Fatal(err)
+		}
+		if cached.Username != "al" || cached.Password != "" || cached.TOTPSecret != "" {
+			t.Fatalf("read %d: got %+v", i, cached)
+		}
+	}
+
+	if len(store.entries) == 0 {
+		t.Fatal("the user was not cached")
+	}
+	for key, entry := range store.entries {
+		if bytes.Contains(entry, []byte(u.Password)) || bytes.Contains(entry, []byte(u.TOTPSecret)) {
+			t.Fatalf("the entry %s holds the credentials", key)
+		}
+	}
+
+	creds, err := users.Credentials(u.ID)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if creds.Password != u.Password || creds.TOTPSecret != u.TOTPSecret {
+		t.Fatalf("credentials: got %+v", creds)
+	}
+
+	// a save of a cached user leaves the credentials as they are
+	cached, _ := users.ByID(u.ID)
+	cached.DisplayName = "Al"
+	if err := users.Save(cached); err != nil {
+		t.Fatal(err)
+	}
+	if creds, _ := users.Credentials(u.ID); creds.Password != u.Password || creds.TOTPSecret != u.TOTPSecret {
+		t.Fatalf("after save: got %+v", creds)
+	}
+}
+
+func TestCachedTasksForgetLabels(t *testing.T) {
+	users := NewMemoryUserRepo()
+	u := &models.User{Username: "al", Email: "al@example.com"}
+	if err := users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	tasks := NewCachedTaskRepo(NewMemoryTaskRepo(users), cache.NewWithStorage(&mapStorage{entries: map[string][]byte{}}, time.Minute)).
+		WithContext(WithTenant(context.Background(), u.ID))
+
+	task := &models.Task{Title: "Write the tests", UserID: u.ID}
+	if err := tasks.Create(task); err != nil {
+		t.Fatal(err)
+	}
+	label := &models.Label{Name: "work", UserID: u.ID}
+	label.ID = 1
+
+	labels := func() int {
+		t.Helper()
+		list, err := tasks.List(u, TaskFilter{})
+		if err != nil || len(list) != 1 {
+			t.Fatalf("list: got %+v, %v", list, err)
+		}
+		return len(list[0].Labels)
+	}
+
+	// cached without the label, then read again once it is attached or detached
+	if n := labels(); n != 0 {
+		t.Fatalf("before: %d labels", n)
+	}
+	if err := tasks.AddLabel(task, label); err != nil || len(task.Labels) != 1 {
+		t.Fatalf("add: got %+v, %v", task.Labels, err)
+	}
+	if n := labels(); n != 1 {
+		t.Fatalf("after add: %d labels", n)
+	}
+	if err := tasks.RemoveLabel(task, label); err != nil || len(task.Labels) != 0 {
+		t.Fatalf("remove: got %+v, %v", task.Labels, err)
+	}
+	if n := labels(); n != 0 {
+		t.Fatalf("after remove: %d labels", n)
+	}
+}
@@ -0,0 +1,641 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/gorm"
+	"gorm.io/gorm/schema"
+	"reflect"
+	"sort"
+	"strings"
+	"sync"
+	"task-app/models"
+	"time"
+)
+
+// errNotInMemory is returned by the queries the memory repos do not support
+var errNotInMemory = errors.New("Not supported by the memory repo")
+
+// memoryUserRepo is a UserRepo of a map, for the tests of the handlers
+type memoryUserRepo struct {
+	mu    *sync.Mutex
+	users map[uint]*models.User
+	// codes are the hashes of the backup codes by user
+	codes map[uint]map[string]bool
+}
+
+// NewMemoryUserRepo returns an empty UserRepo keeping the accounts in memory. The repos of the
+// package may be used with it but for the lists of the admin.
+func NewMemoryUserRepo() UserRepo {
+	return memoryUserRepo{mu: new(sync.Mutex), users: map[uint]*models.User{}, codes: map[uint]map[string]bool{}}
+}
+
+func (r memoryUserRepo) WithContext(ctx context.Context) UserRepo {
+	return r
+}
+
+func (r memoryUserRepo) ByID(id uint) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.ID == id })
+}
+
+func (r memoryUserRepo) Credentials(id uint) (*models.User, error) {
+	return r.ByID(id)
+}
+
+func (r memoryUserRepo) ByIdentity(identity string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Email == identity || u.Username == identity })
+}
+
+func (r memoryUserRepo) ByEmailToken(hash string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.EmailToken == hash })
+}
+
+func (r memoryUserRepo) ByCalendarToken(hash string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.CalendarToken == hash })
+}
+
+func (r memoryUserRepo) ByInboxToken(hash string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.InboxToken == hash })
+}
+
+func (r memoryUserRepo) ByEmail(email string) (*models.User, error) {
+	return r.find(func(u *models.User) bool { return u.Email == email })
+}
+
+func (r memoryUserRepo) ByUsernames(names []string) ([]models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var users []models.User
+	for _, name := range names {
+		for _, u := range r.users {
+			if u.Username == name {
+				users = append(users, *u)
+			}
+		}
+	}
+
+	return users, nil
+}
+
+func (r memoryUserRepo) EmailTaken(email string) bool {
+	_, err := r.ByEmail(email)
+	return err == nil
+}
+
+func (r memoryUserRepo) UsernameTaken(username string) bool {
+	_, err := r.find(func(u *models.User) bool { return u.Username == username })
+	return err == nil
+}
+
+func (r memoryUserRepo) Create(u *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for id := range r.users {
+		if id > u.ID {
+			u.ID = id
+		}
+	}
+	u.ID++
+	u.CreatedAt, u.UpdatedAt = time.Now(), time.Now()
+	stored := *u
+	r.users[u.ID] = &stored
+
+	return nil
+}
+
+func (r memoryUserRepo) Register(u *models.User) error {
+	if r.EmailTaken(u.Email) || r.UsernameTaken(u.Username) {
+		return ErrTaken
+	}
+
+	return r.Create(u)
+}
+
+func (r memoryUserRepo) Save(u *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	current, ok := r.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	u.UpdatedAt = time.Now()
+	stored := *u
+	stored.Password, stored.TOTPSecret = current.Password, current.TOTPSecret
+	r.users[u.ID] = &stored
+
+	return nil
+}
+
+func (r memoryUserRepo) Update(u *models.User, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	if err := setFields(stored, fields); err != nil {
+		return err
+	}
+
+	return setFields(u, fields)
+}
+
+func (r memoryUserRepo) UseTOTPStep(u *models.User, step int64) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return false, ErrNotFound
+	}
+	if stored.TOTPLastStep >= step {
+		return false, nil
+	}
+	stored.TOTPLastStep, u.TOTPLastStep = step, step
+
+	return true, nil
+}
+
+func (r memoryUserRepo) AddFailedLogin(u *models.User) (int, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return 0, ErrNotFound
+	}
+	stored.FailedLogins++
+	u.FailedLogins = stored.FailedLogins
+
+	return stored.FailedLogins, nil
+}
+
+func (r memoryUserRepo) EnableTOTP(u *models.User, codeHashes []string) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	r.codes[u.ID] = map[string]bool{}
+	for _, hash := range codeHashes {
+		r.codes[u.ID][hash] = true
+	}
+	stored.TOTPEnabled, u.TOTPEnabled = true, true
+
+	return nil
+}
+
+func (r memoryUserRepo) DisableTOTP(u *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.users[u.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	delete(r.codes, u.ID)
+	stored.TOTPEnabled, stored.TOTPSecret = false, ""
+	u.TOTPEnabled, u.TOTPSecret = false, ""
+
+	return nil
+}
+
+func (r memoryUserRepo) UseBackupCode(u *models.User, codeHash string) (bool, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	if !r.codes[u.ID][codeHash] {
+		return false, nil
+	}
+	delete(r.codes[u.ID], codeHash)
+
+	return true, nil
+}
+
+func (r memoryUserRepo) Delete(u *models.User, cascadeTasks bool) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	delete(r.users, u.ID)
+	delete(r.codes, u.ID)
+
+	return nil
+}
+
+func (r memoryUserRepo) List(limit, offset int) ([]UserWithTasks, error) {
+	return nil, errNotInMemory
+}
+
+func (r memoryUserRepo) Count() (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	return int64(len(r.users)), nil
+}
+
+// find returns a copy of the first user matching, as a query would
+func (r memoryUserRepo) find(match func(u *models.User) bool) (*models.User, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, u := range r.users {
+		if match(u) {
+			found := *u
+			return &found, nil
+		}
+	}
+
+	return nil, ErrNotFound
+}
+
+// memoryTaskRepo is a TaskRepo of a map, for the tests of the handlers. It keeps the personal
+// tasks only: the tasks of the workspaces and the projects cannot be placed.
+type memoryTaskRepo struct {
+	mu    *sync.Mutex
+	tasks map[uint]*models.Task
+	// watchers are the ids of the watchers by task
+	watchers map[uint][]uint
+	users    UserRepo
+}
+
+// NewMemoryTaskRepo returns an empty TaskRepo keeping the tasks in memory, the watchers are
+// read from the users
+func NewMemoryTaskRepo(users UserRepo) TaskRepo {
+	return memoryTaskRepo{mu: new(sync.Mutex), tasks: map[uint]*models.Task{}, watchers: map[uint][]uint{}, users: users}
+}
+
+func (r memoryTaskRepo) WithContext(ctx context.Context) TaskRepo {
+	return r
+}
+
+func (r memoryTaskRepo) List(u *models.User, f TaskFilter) ([]models.Task, error) {
+	if f.Query != "" || f.Page != nil || len(f.Labels) > 0 {
+		return nil, errNotInMemory
+	}
+
+	tasks := r.filter(func(t *models.Task) bool {
+		switch {
+		case !readable(t, u):
+			return false
+		case f.CreatorID != 0 && t.UserID != f.CreatorID:
+			return false
+		case f.AssigneeID != 0 && (t.AssigneeID == nil || *t.AssigneeID != f.AssigneeID):
+			return false
+		case f.WorkspaceID != nil || f.ProjectID != nil:
+			return false
+		case f.Status == models.StatusTodo && t.Status != models.StatusTodo && t.Status != "":
+			return false
+		case f.Status != "" && f.Status != models.StatusTodo && t.Status != f.Status:
+			return false
+		case f.DueBefore != nil && (t.DueAt == nil || !t.DueAt.Before(*f.DueBefore) || t.Status == models.StatusDone):
+			return false
+		case !f.IncludeArchived && t.ArchivedAt != nil:
+			return false
+		}
+		return true
+	})
+
+	sort.Slice(tasks, func(i, j int) bool {
+		if tasks[i].Position != tasks[j].Position {
+			return tasks[i].Position < tasks[j].Position
+		}
+		return tasks[i].ID < tasks[j].ID
+	})
+
+	return tasks, nil
+}
+
+func (r memoryTaskRepo) Get(u *models.User, id uint, roles ...string) (*models.Task, error) {
+	return r.first(func(t *models.Task) bool { return t.ID == id && readable(t, u) })
+}
+
+func (r memoryTaskRepo) Due(u *models.User) ([]models.Task, error) {
+	tasks := r.filter(func(t *models.Task) bool {
+		return readable(t, u) && t.ArchivedAt == nil && t.DueAt != nil &&
+			(t.Status != models.StatusDone || t.Recurrence != "")
+	})
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].DueAt.Before(*tasks[j].DueAt) })
+
+	return tasks, nil
+}
+
+func (r memoryTaskRepo) Create(t *models.Task) error {
+	if t.WorkspaceID != nil || t.ProjectID != nil {
+		return errNotInMemory
+	}
+
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t.ID = uint(len(r.tasks) + 1)
+	t.CreatedAt, t.UpdatedAt = time.Now(), time.Now()
+	if t.Version == 0 {
+		t.Version = 1
+	}
+	if t.Priority == 0 {
+		t.Priority = models.PriorityDefault
+	}
+	stored := *t
+	r.tasks[t.ID] = &stored
+
+	return nil
+}
+
+func (r memoryTaskRepo) Save(t *models.Task) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[t.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if stored.Version != t.Version {
+		return ErrConflict
+	}
+	t.Version++
+	t.UpdatedAt = time.Now()
+	saved := *t
+	r.tasks[t.ID] = &saved
+
+	return nil
+}
+
+func (r memoryTaskRepo) Update(t *models.Task, fields map[string]interface{}) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[t.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	if err := setFields(stored, fields); err != nil {
+		return err
+	}
+	stored.Version++
+	if err := setFields(t, fields); err != nil {
+		return err
+	}
+	t.Version = stored.Version
+
+	return nil
+}
+
+func (r memoryTaskRepo) Delete(t *models.Task) error {
+	return r.setDeleted(t, gorm.DeletedAt{Time: time.Now(), Valid: true})
+}
+
+func (r memoryTaskRepo) ArchiveDone(u *models.User, before time.Time) (int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var count int64
+	now := time.Now()
+	for _, t := range r.tasks {
+		if readable(t, u) && !t.DeletedAt.Valid && t.Status == models.StatusDone && t.ArchivedAt == nil &&
+			t.CompletedAt != nil && t.CompletedAt.Before(before) {
+			t.ArchivedAt = &now
+			t.Version++
+			count++
+		}
+	}
+
+	return count, nil
+}
+
+func (r memoryTaskRepo) Trash(u *models.User) ([]models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tasks []models.Task
+	for _, t := range r.tasks {
+		if readable(t, u) && t.DeletedAt.Valid {
+			tasks = append(tasks, *t)
+		}
+	}
+	sort.Slice(tasks, func(i, j int) bool { return tasks[i].DeletedAt.Time.After(tasks[j].DeletedAt.Time) })
+
+	return tasks, nil
+}
+
+func (r memoryTaskRepo) GetDeleted(u *models.User, id uint, roles ...string) (*models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	t, ok := r.tasks[id]
+	if !ok || !t.DeletedAt.Valid || !readable(t, u) {
+		return nil, ErrNotFound
+	}
+	found := *t
+
+	return &found, nil
+}
+
+func (r memoryTaskRepo) Restore(t *models.Task) error {
+	return r.setDeleted(t, gorm.DeletedAt{})
+}
+
+func (r memoryTaskRepo) AddWatcher(t *models.Task, u *models.User) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	for _, id := range r.watchers[t.ID] {
+		if id == u.ID {
+			return nil
+		}
+	}
+	r.watchers[t.ID] = append(r.watchers[t.ID], u.ID)
+
+	return nil
+}
+
+func (r memoryTaskRepo) RemoveWatcher(t *models.Task, userID uint) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	ids := r.watchers[t.ID][:0]
+	for _, id := range r.watchers[t.ID] {
+		if id != userID {
+			ids = append(ids, id)
+		}
+	}
+	r.watchers[t.ID] = ids
+
+	return nil
+}
+
+func (r memoryTaskRepo) AddLabel(t *models.Task, label *models.Label) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[t.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	for _, l := range stored.Labels {
+		if l.ID == label.ID {
+			t.Labels = append([]models.Label(nil), stored.Labels...)
+			return nil
+		}
+	}
+	stored.Labels = append(stored.Labels, *label)
+	t.Labels = append([]models.Label(nil), stored.Labels...)
+
+	return nil
+}
+
+func (r memoryTaskRepo) RemoveLabel(t *models.Task, label *models.Label) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[t.ID]
+	if !ok || stored.DeletedAt.Valid {
+		return ErrNotFound
+	}
+	labels := make([]models.Label, 0, len(stored.Labels))
+	for _, l := range stored.Labels {
+		if l.ID != label.ID {
+			labels = append(labels, l)
+		}
+	}
+	stored.Labels = labels
+	t.Labels = append([]models.Label(nil), labels...)
+
+	return nil
+}
+
+func (r memoryTaskRepo) Watchers(taskID, except uint) ([]models.User, error) {
+	r.mu.Lock()
+	ids := append([]uint(nil), r.watchers[taskID]...)
+	r.mu.Unlock()
+
+	var watchers []models.User
+	for _, id := range ids {
+		if id == except {
+			continue
+		}
+		if u, err := r.users.ByID(id); err == nil {
+			watchers = append(watchers, *u)
+		}
+	}
+
+	return watchers, nil
+}
+
+func (r memoryTaskRepo) CountByStatus() (map[string]int64, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	counts := map[string]int64{}
+	for _, t := range r.tasks {
+		if !t.DeletedAt.Valid {
+			counts[t.Status]++
+		}
+	}
+
+	return counts, nil
+}
+
+func (r memoryTaskRepo) Placement(u *models.User, projectID, workspaceID *uint) (*uint, *uint, error) {
+	if projectID != nil || workspaceID != nil {
+		return nil, nil, ErrNotFound
+	}
+
+	return nil, nil, nil
+}
+
+func (r memoryTaskRepo) Reorder(u *models.User, ids []uint) ([]models.Task, error) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	tasks := make([]*models.Task, 0, len(ids))
+	positions := make([]int, 0, len(ids))
+	for _, id := range ids {
+		t, ok := r.tasks[id]
+		if !ok || t.DeletedAt.Valid || t.UserID != u.ID {
+			return nil, ErrNotFound
+		}
+		tasks = append(tasks, t)
+		positions = append(positions, t.Position)
+	}
+	sort.Ints(positions)
+
+	reordered := make([]models.Task, 0, len(tasks))
+	for i, t := range tasks {
+		t.Position = positions[i]
+		t.Version++
+		reordered = append(reordered, *t)
+	}
+
+	return reordered, nil
+}
+
+// filter returns copies of the tasks of the trash left out matching, as a query would
+func (r memoryTaskRepo) filter(match func(t *models.Task) bool) []models.Task {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	var tasks []models.Task
+	for _, t := range r.tasks {
+		if !t.DeletedAt.Valid && match(t) {
+			tasks = append(tasks, *t)
+		}
+	}
+
+	return tasks
+}
+
+func (r memoryTaskRepo) first(match func(t *models.Task) bool) (*models.Task, error) {
+	tasks := r.filter(match)
+	if len(tasks) == 0 {
+		return nil, ErrNotFound
+	}
+
+	return &tasks[0], nil
+}
+
+func (r memoryTaskRepo) setDeleted(t *models.Task, deleted gorm.DeletedAt) error {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+
+	stored, ok := r.tasks[t.ID]
+	if !ok {
+		return ErrNotFound
+	}
+	stored.DeletedAt, t.DeletedAt = deleted, deleted
+
+	return nil
+}
+
+// readable is models.AccessibleBy for the personal tasks: the user created the task or is its assignee
+func readable(t *models.Task, u *models.User) bool {
+	return u != nil && (t.UserID == u.ID || t.AssigneeID != nil && *t.AssigneeID == u.ID)
+}
+
+var memorySchemas = &sync.Map{}
+
+// setFields sets the fields of the map, by column or field name, as Updates does
+func setFields(dest interface{}, fields map[string]interface{}) error {
+	s, err := schema.Parse(dest, memorySchemas, schema.NamingStrategy{})
+	if err != nil {
+		return err
+	}
+
+	value := reflect.ValueOf(dest)
+	for name, v := range fields {
+		field := s.LookUpField(strings.TrimSpace(name))
+		if field == nil {
+			return errNotInMemory
+		}
+		if err := field.Set(value, v); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
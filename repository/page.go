@@ -0,0 +1,77 @@
+package repository
+
+import (
+	"encoding/base64"
+	"errors"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ErrInvalidCursor is returned for a cursor which was not given by a listing
+var ErrInvalidCursor = errors.New("invalid cursor")
+
+// Cursor is the position of a row in the keyset order (created_at, id), newest first
+type Cursor struct {
+	CreatedAt time.Time
+	ID        uint
+}
+
+// String returns the opaque form of the cursor given to the clients
+func (c Cursor) String() string {
+	raw := strconv.FormatInt(c.CreatedAt.UnixNano(), 10) + ":" + strconv.FormatUint(uint64(c.ID), 10)
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+// ParseCursor reads a cursor of String
+func ParseCursor(s string) (Cursor, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	parts := strings.SplitN(string(raw), ":", 2)
+	if len(parts) != 2 {
+		return Cursor{}, ErrInvalidCursor
+	}
+	nanos, err := strconv.ParseInt(parts[0], 10, 64)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+	id, err := strconv.ParseUint(parts[1], 10, 0)
+	if err != nil {
+		return Cursor{}, ErrInvalidCursor
+	}
+
+	// local as the times written by gorm, sqlite compares them as text
+	return Cursor{CreatedAt: time.Unix(0, nanos).Local(), ID: uint(id)}, nil
+}
+
+// Page is a page of a listing in the keyset order. Unlike an offset, the cursor finds
+// the start of the page with the index, however deep the page is.
+type Page struct {
+	// After is the cursor of the last row of the previous page, nil for the first page
+	After *Cursor
+	Limit int
+}
+
+// Scope selects the rows of the page of a table, with a row more than the limit
+// when there is a next page
+func (p Page) Scope(table string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		if p.After != nil {
+			tx = tx.Where(
+				table+".created_at < ? OR ("+table+".created_at = ? AND "+table+".id < ?)",
+				p.After.CreatedAt, p.After.CreatedAt, p.After.ID,
+			)
+		}
+
+		return tx.Order(table + ".created_at DESC, " + table + ".id DESC").Limit(p.Limit + 1)
+	}
+}
+
+// More tells whether the rows of Scope have a next page, the extra row is then dropped
+func (p Page) More(rows int) bool {
+	return rows > p.Limit
+}
@@ -0,0 +1,23 @@
+// Package repository keeps the queries of the handlers behind interfaces,
+// so the handlers can be given another implementation, e.g. an in-memory fake or a cache.
+package repository
+
+import (
+	"errors"
+	"gorm.io/gorm"
+)
+
+// ErrNotFound is returned when no record matches
+var ErrNotFound = gorm.ErrRecordNotFound
+
+// ErrTaken is returned when the email or the username of a new account is registered already
+var ErrTaken = errors.New("Email or username is already registered")
+
+// ErrNoPermission is returned when the role of the user does not allow the change
+var ErrNoPermission = errors.New("Permission denied")
+
+// ErrConflict is returned when a record was changed since the version it was read at
+var ErrConflict = errors.New("The record was changed since it was read")
+
+// ErrMixedLists is returned when tasks of several lists are reordered together
+var ErrMixedLists = errors.New("The tasks must belong to the same list")
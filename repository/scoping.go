@@ -0,0 +1,501 @@
+package repository
+
+import (
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"reflect"
+	"strconv"
+	"strings"
+	"task-app/models"
+)
+
+// allTenantsKey is the setting of the statements which are not kept to the tenant
+const allTenantsKey = "tenant:all"
+
+// AllTenants returns a session of the connection whose statements read and change the rows of
+// every user, for the lookups authorized otherwise, e.g. by a token the client holds
+func AllTenants(tx *gorm.DB) *gorm.DB {
+	return tx.Set(allTenantsKey, true).Session(&gorm.Session{})
+}
+
+// EnforceTenants keeps the statements made for a tenant, see WithTenant, to the rows of the
+// tenant: the queries, updates and deletes of the tables of the users only match the rows of
+// the tenant, and the rows created or given other owners must be ones of the tenant. The
+// statements without a tenant, the raw SQL and the tables of no user are left as they are.
+func EnforceTenants(db *gorm.DB) error {
+	cb := db.Callback()
+	if err := cb.Query().Before("gorm:query").Register("tenant:scope_query", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Row().Before("gorm:row").Register("tenant:scope_row", scopeTenant); err != nil {
+		return err
+	}
+	if err := cb.Update().Before("gorm:update").Register("tenant:scope_update", scopeTenantChange); err != nil {
+		return err
+	}
+	if err := cb.Delete().Before("gorm:delete").Register("tenant:scope_delete", scopeTenantChange); err != nil {
+		return err
+	}
+
+	return cb.Create().Before("gorm:create").Register("tenant:check_create", checkTenantCreate)
+}
+
+// valueOf returns the value of a column given by a statement, present is false when the
+// statement leaves the column as it is
+type valueOf func(column string) (value uint, present bool)
+
+// tenantRule keeps the statements of a tenant to its rows of a table
+type tenantRule struct {
+	// rows is the condition of the rows of the tenant u, on the columns of the table
+	rows func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression
+	// owns checks the values of a row created or changed keep it to the tenant; nil when the
+	// rows are created for the other users too, e.g. their notifications
+	owns func(conn *gorm.DB, u uint, value valueOf) error
+}
+
+// globalTables are the tables left to every tenant on purpose, every other table has a rule
+var globalTables = map[string]string{
+	"users":            "the users are shown to the others, as assignees, members or mentions, and found to sign in",
+	"task_labels":      "joins a task to a label, both kept to the tenant, and is read through them",
+	"task_watchers":    "joins a task to its watchers, read and changed through the task",
+	"comment_mentions": "joins a comment to the users it mentions, read and changed through the comment",
+	"magic_links":      "found by the token of the link before the user is signed in",
+	"failed_jobs":      "the jobs run without a tenant, their failures are seen by the admins",
+	"encryption_keys":  "the keys of the keyring encrypt the rows of every tenant",
+	"migrations":       "the migrations of the schema",
+}
+
+// tenantRules are the rules of the tables of the users, by the name of the table
+var tenantRules = map[string]tenantRule{
+	"tasks":     sharedRule,
+	"projects":  sharedRule,
+	"templates": sharedRule,
+	"workspaces": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return in(column("id"), workspacesOf(conn, u))
+		},
+		owns: owner("owner_id"),
+	},
+	"memberships": {rows: ofSet("workspace_id", workspacesOf), owns: owner("user_id")},
+	"invites": {
+		// the invitee is not a member yet
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Or(
+				in(column("workspace_id"), workspacesOf(conn, u)),
+				clause.Expr{SQL: "LOWER(?) IN (?)", Vars: []interface{}{
+					column("email"),
+					allTenants(conn).Model(&models.User{}).Select("LOWER(email)").Where("id = ?", u),
+				}},
+			)
+		},
+		owns: inSet("workspace_id", workspacesOf),
+	},
+	// the labels of the other members are shown on the tasks of the workspaces
+	"labels": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Or(
+				clause.Eq{Column: column("user_id"), Value: u},
+				in(column("id"), allTenants(conn).Table("task_labels").Select("label_id").Where("task_id IN (?)", tasksOf(conn, u))),
+			)
+		},
+		owns: owner("user_id"),
+	},
+	"filters":                  ownedRule("user_id"),
+	"api_keys":                 ownedRule("user_id"),
+	"data_exports":             ownedRule("user_id"),
+	"notification_preferences": ownedRule("user_id"),
+	"o_auth_accounts":          ownedRule("user_id"),
+	"push_devices":             ownedRule("user_id"),
+	"stream_tickets":           ownedRule("user_id"),
+	"telegram_accounts":        ownedRule("user_id"),
+	"backup_codes":             ownedRule("user_id"),
+	"webhooks":                 ownedRule("user_id"),
+	"shares":                   ownedRule("user_id"),
+	"categories":               ownedRule("owner_id"),
+	// the notifications of the other users are created by the changes of the tenant
+	"notifications":       {rows: ofOwner("user_id")},
+	"comments":            taskRule,
+	"attachments":         taskRule,
+	"checklist_items":     taskRule,
+	"task_revisions":      taskRule,
+	"calendar_objects":    taskRule,
+	"github_issues":       taskRule,
+	"workspace_sso":       workspaceRule,
+	"slack_installations": workspaceRule,
+	"sso_identities":      workspaceRule,
+	// the time tracked by the other members on the tasks of the workspaces is shown too
+	"time_entries": {
+		rows: ofSet("task_id", tasksOf),
+		owns: func(conn *gorm.DB, u uint, value valueOf) error {
+			if err := owner("user_id")(conn, u, value); err != nil {
+				return err
+			}
+			return inSet("task_id", tasksOf)(conn, u, value)
+		},
+	},
+	"task_dependencies": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Or(in(column("blocked_id"), tasksOf(conn, u)), in(column("blocker_id"), tasksOf(conn, u)))
+		},
+		owns: func(conn *gorm.DB, u uint, value valueOf) error {
+			if err := inSet("blocked_id", tasksOf)(conn, u, value); err != nil {
+				return err
+			}
+			return inSet("blocker_id", tasksOf)(conn, u, value)
+		},
+	},
+	"github_integrations": {rows: ofSet("project_id", projectsOf), owns: inSet("project_id", projectsOf)},
+	"activities": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Or(
+				clause.Eq{Column: column("actor_id"), Value: u},
+				in(column("task_id"), tasksOf(conn, u)),
+				in(column("workspace_id"), workspacesOf(conn, u)),
+			)
+		},
+	},
+	"webhook_deliveries": {rows: ofSet("webhook_id", func(conn *gorm.DB, u uint) *gorm.DB {
+		return allTenants(conn).Model(&models.Webhook{}).Select("id").Where("user_id = ?", u)
+	})},
+	"impersonations": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Or(clause.Eq{Column: column("admin_id"), Value: u}, clause.Eq{Column: column("user_id"), Value: u})
+		},
+	},
+	// the sessions and the idempotency keys name their user by its id as a string
+	"claims": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Eq{Column: column("issuer"), Value: strconv.FormatUint(uint64(u), 10)}
+		},
+	},
+	"idempotency_keys": {
+		rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+			return clause.Eq{Column: column("scope"), Value: strconv.FormatUint(uint64(u), 10)}
+		},
+	},
+}
+
+// ownedRule is the rule of the rows of one user, by the column
+func ownedRule(column string) tenantRule {
+	return tenantRule{rows: ofOwner(column), owns: owner(column)}
+}
+
+// sharedRule is the rule of the rows of the workspaces, as by models.AccessibleBy: the personal
+// rows of the tenant and the rows of its workspaces
+var sharedRule = tenantRule{
+	rows: func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+		return clause.Or(
+			clause.And(clause.Eq{Column: column("workspace_id"), Value: nil}, clause.Eq{Column: column("user_id"), Value: u}),
+			in(column("workspace_id"), workspacesOf(conn, u)),
+		)
+	},
+	owns: func(conn *gorm.DB, u uint, value valueOf) error {
+		if workspace, ok := value("workspace_id"); ok && workspace != 0 {
+			return inSet("workspace_id", workspacesOf)(conn, u, value)
+		}
+		return owner("user_id")(conn, u, value)
+	},
+}
+
+// taskRule is the rule of the rows of the tasks, the ones of the tasks of the tenant
+var taskRule = tenantRule{rows: ofSet("task_id", tasksOf), owns: inSet("task_id", tasksOf)}
+
+// workspaceRule is the rule of the rows of the workspaces, the ones of the workspaces of the tenant
+var workspaceRule = tenantRule{rows: ofSet("workspace_id", workspacesOf), owns: inSet("workspace_id", workspacesOf)}
+
+// workspacesOf selects the workspaces of the user, the sets are of their id column
+func workspacesOf(conn *gorm.DB, u uint) *gorm.DB {
+	return allTenants(conn).Model(&models.Membership{}).Select("workspace_id AS id").Where("user_id = ?", u)
+}
+
+// tasksOf selects the tasks the user can see, in the trash too
+func tasksOf(conn *gorm.DB, u uint) *gorm.DB {
+	return accessible(allTenants(conn).Model(&models.Task{}), conn, u)
+}
+
+// projectsOf selects the projects the user can see, in the trash too
+func projectsOf(conn *gorm.DB, u uint) *gorm.DB {
+	return accessible(allTenants(conn).Model(&models.Project{}), conn, u)
+}
+
+func accessible(query, conn *gorm.DB, u uint) *gorm.DB {
+	return query.Unscoped().Select("id").
+		Where("(workspace_id IS NULL AND user_id = ?) OR workspace_id IN (?)", u, workspacesOf(conn, u))
+}
+
+// allTenants returns a new statement of the connection which is not kept to the tenant, the
+// conditions of the rules would otherwise be scoped again
+func allTenants(conn *gorm.DB) *gorm.DB {
+	return AllTenants(conn.Session(&gorm.Session{NewDB: true}))
+}
+
+func in(column clause.Column, set *gorm.DB) clause.Expression {
+	return clause.Expr{SQL: "? IN (?)", Vars: []interface{}{column, set}}
+}
+
+// ofOwner is the condition of the rows of the user of the column
+func ofOwner(name string) func(*gorm.DB, func(string) clause.Column, uint) clause.Expression {
+	return func(_ *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+		return clause.Eq{Column: column(name), Value: u}
+	}
+}
+
+// ofSet is the condition of the rows whose column is in the set of the user
+func ofSet(name string, set func(*gorm.DB, uint) *gorm.DB) func(*gorm.DB, func(string) clause.Column, uint) clause.Expression {
+	return func(conn *gorm.DB, column func(string) clause.Column, u uint) clause.Expression {
+		return in(column(name), set(conn, u))
+	}
+}
+
+// owner checks the column of a row is the tenant
+func owner(column string) func(*gorm.DB, uint, valueOf) error {
+	return func(_ *gorm.DB, u uint, value valueOf) error {
+		if v, ok := value(column); ok && v != u {
+			return ErrNoPermission
+		}
+		return nil
+	}
+}
+
+// inSet checks the column of a row is in the set of the tenant
+func inSet(column string, set func(*gorm.DB, uint) *gorm.DB) func(*gorm.DB, uint, valueOf) error {
+	return func(conn *gorm.DB, u uint, value valueOf) error {
+		v, ok := value(column)
+		if !ok {
+			return nil
+		}
+
+		var count int64
+		if err := allTenants(conn).Table("(?) AS allowed", set(conn, u)).Where("allowed.id = ?", v).Count(&count).Error; err != nil {
+			return err
+		}
+		if count == 0 {
+			return ErrNoPermission
+		}
+		return nil
+	}
+}
+
+// tenantRuleOf returns the tenant and the rule of the statement, ok is false when it is not
+// kept to a tenant
+func tenantRuleOf(tx *gorm.DB) (u uint, rule tenantRule, ok bool) {
+	if tx.Error != nil || tx.Statement.SQL.Len() > 0 {
+		return 0, rule, false
+	}
+	if all, _ := tx.Get(allTenantsKey); all == true {
+		return 0, rule, false
+	}
+	if u, ok = TenantOf(tx.Statement.Context); !ok {
+		return 0, rule, false
+	}
+	rule, ok = tenantRules[tableOf(tx.Statement)]
+
+	return u, rule, ok
+}
+
+// scopeTenant adds the condition of the rows of the tenant to the statement
+func scopeTenant(tx *gorm.DB) {
+	u, rule, ok := tenantRuleOf(tx)
+	if !ok {
+		return
+	}
+
+	table := tableName(tx.Statement)
+	tx.Statement.AddClause(clause.Where{Exprs: []clause.Expression{
+		rule.rows(tx, func(name string) clause.Column { return clause.Column{Table: table, Name: name} }, u),
+	}})
+}
+
+// scopeTenantChange keeps the updates and the deletes to the rows of the tenant, and checks
+// the values of the updates keep them to it. The statements without conditions are left to
+// GORM, which refuses them.
+func scopeTenantChange(tx *gorm.DB) {
+	u, rule, ok := tenantRuleOf(tx)
+	if !ok {
+		return
+	}
+	stmt := tx.Statement
+	if _, where := stmt.Clauses["WHERE"]; !where && !tx.AllowGlobalUpdate && !hasPrimaryKeys(stmt) {
+		return
+	}
+
+	scopeTenant(tx)
+	if rule.owns == nil || stmt.ReflectValue.Kind() == reflect.Invalid {
+		return
+	}
+	if values, ok := stmt.Dest.(map[string]interface{}); ok {
+		if err := rule.owns(tx, u, mapValues(stmt, values)); err != nil {
+			tx.AddError(err)
+		}
+		return
+	}
+	// a struct of Updates or Save, its zero fields are not changed by Updates
+	for _, row := range structRows(reflect.ValueOf(stmt.Dest)) {
+		if err := rule.owns(tx, u, fieldValues(stmt, row, false)); err != nil {
+			tx.AddError(err)
+			return
+		}
+	}
+}
+
+// checkTenantCreate checks the rows created for the tenant are ones of the tenant
+func checkTenantCreate(tx *gorm.DB) {
+	u, rule, ok := tenantRuleOf(tx)
+	if !ok || rule.owns == nil {
+		return
+	}
+
+	for _, row := range structRows(tx.Statement.ReflectValue) {
+		if stored(tx, row) {
+			continue
+		}
+		if err := rule.owns(tx, u, fieldValues(tx.Statement, row, true)); err != nil {
+			tx.AddError(err)
+			return
+		}
+	}
+}
+
+// stored tells whether the row is stored already and left as it is by the creation, as the
+// associations GORM saves with their parent, e.g. the labels of a task updated
+func stored(tx *gorm.DB, row reflect.Value) bool {
+	stmt := tx.Statement
+	conflict, ok := stmt.Clauses["ON CONFLICT"].Expression.(clause.OnConflict)
+	if !ok || !conflict.DoNothing || stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	field := stmt.Schema.PrioritizedPrimaryField
+	id, zero := field.ValueOf(row)
+	if zero {
+		return false
+	}
+
+	var count int64
+	err := allTenants(tx).Unscoped().Table(stmt.Table).Where(clause.Eq{Column: clause.Column{Name: field.DBName}, Value: id}).Count(&count).Error
+	return err == nil && count > 0
+}
+
+// tableOf returns the table of the statement. For a table with an alias, e.g. Table("labels AS l"),
+// GORM keeps the alias as the table.
+func tableOf(stmt *gorm.Statement) string {
+	if stmt.TableExpr != nil {
+		if fields := strings.Fields(stmt.TableExpr.SQL); len(fields) > 0 {
+			return strings.Trim(fields[0], "`\"")
+		}
+	}
+
+	return stmt.Table
+}
+
+// tableName returns the name the columns of the table are qualified with, the alias of the
+// table when it has one
+func tableName(stmt *gorm.Statement) string {
+	if stmt.TableExpr != nil {
+		if fields := strings.Fields(stmt.TableExpr.SQL); len(fields) > 1 {
+			return strings.Trim(fields[len(fields)-1], "`\"")
+		}
+	}
+
+	return stmt.Table
+}
+
+// hasPrimaryKeys tells whether the rows of the statement have their primary keys, GORM then
+// adds them to the conditions
+func hasPrimaryKeys(stmt *gorm.Statement) bool {
+	if stmt.Schema == nil || stmt.Schema.PrioritizedPrimaryField == nil {
+		return false
+	}
+	for _, row := range structRows(stmt.ReflectValue) {
+		if _, zero := stmt.Schema.PrioritizedPrimaryField.ValueOf(row); !zero {
+			return true
+		}
+	}
+
+	return false
+}
+
+// structRows returns the structs of a row or of a slice of rows
+func structRows(v reflect.Value) []reflect.Value {
+	for v.Kind() == reflect.Ptr || v.Kind() == reflect.Interface {
+		v = v.Elem()
+	}
+
+	switch v.Kind() {
+	case reflect.Slice, reflect.Array:
+		rows := make([]reflect.Value, 0, v.Len())
+		for i := 0; i < v.Len(); i++ {
+			if item := reflect.Indirect(v.Index(i)); item.Kind() == reflect.Struct {
+				rows = append(rows, item)
+			}
+		}
+		return rows
+	case reflect.Struct:
+		return []reflect.Value{v}
+	}
+
+	return nil
+}
+
+// fieldValues returns the values of the columns of a row, a created row gives every column
+// and an updated one its fields which are not zero
+func fieldValues(stmt *gorm.Statement, row reflect.Value, created bool) valueOf {
+	return func(column string) (uint, bool) {
+		if stmt.Schema == nil {
+			return 0, false
+		}
+		field := stmt.Schema.LookUpField(column)
+		if field == nil || row.Type() != stmt.Schema.ModelType {
+			return 0, false
+		}
+		v, zero := field.ValueOf(row)
+		if zero && !created {
+			return 0, false
+		}
+
+		return toUint(v), true
+	}
+}
+
+// mapValues returns the values of the columns of an update by a map, by column or field name
+func mapValues(stmt *gorm.Statement, values map[string]interface{}) valueOf {
+	return func(column string) (uint, bool) {
+		if v, ok := values[column]; ok {
+			return toUint(v), true
+		}
+		if stmt.Schema != nil {
+			if field := stmt.Schema.LookUpField(column); field != nil {
+				if v, ok := values[field.Name]; ok {
+					return toUint(v), true
+				}
+			}
+		}
+
+		return 0, false
+	}
+}
+
+// toUint returns the id of a value, 0 for nil and for the values which are not numbers
+func toUint(v interface{}) uint {
+	rv := reflect.ValueOf(v)
+	for rv.Kind() == reflect.Ptr {
+		if rv.IsNil() {
+			return 0
+		}
+		rv = rv.Elem()
+	}
+
+	switch rv.Kind() {
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64:
+		return uint(rv.Uint())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if rv.Int() > 0 {
+			return uint(rv.Int())
+		}
+	case reflect.String:
+		if n, err := strconv.ParseUint(rv.String(), 10, 0); err == nil {
+			return uint(n)
+		}
+	}
+
+	return 0
+}
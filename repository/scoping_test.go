@@ -0,0 +1,279 @@
+package repository
+
+import (
+	"context"
+	"errors"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"path/filepath"
+	"task-app/db"
+	"task-app/models"
+	"testing"
+)
+
+// tenantFixture is the data of two tenants: al has a personal task and a workspace shared with
+// cy, bo belongs to neither
+type tenantFixture struct {
+	conn             *gorm.DB
+	al, bo, cy       *models.User
+	workspace        *models.Workspace
+	personal, shared *models.Task
+	personalLabel    *models.Label
+	sharedLabel      *models.Label
+	personalComment  *models.Comment
+	sharedComment    *models.Comment
+}
+
+// newTenantFixture creates the data over a migrated SQLite database of the test, without a
+// tenant, and enforces the tenants after
+func newTenantFixture(t *testing.T) *tenantFixture {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on"), &gorm.Config{
+		Logger: gormlogger.Default.LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	// the migrations run on the connection of the package
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = previous })
+	if err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	f := &tenantFixture{conn: conn}
+	create := func(rows ...interface{}) {
+		t.Helper()
+		for _, row := range rows {
+			if err := conn.Create(row).Error; err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+
+	f.al = &models.User{Username: "al", Email: "al@example.com"}
+	f.bo = &models.User{Username: "bo", Email: "bo@example.com"}
+	f.cy = &models.User{Username: "cy", Email: "cy@example.com"}
+	create(f.al, f.bo, f.cy)
+
+	f.workspace = &models.Workspace{Name: "Acme", OwnerID: f.al.ID}
+	create(f.workspace)
+	create(
+		&models.Membership{WorkspaceID: f.workspace.ID, UserID: f.al.ID, Role: models.WorkspaceOwner},
+		&models.Membership{WorkspaceID: f.workspace.ID, UserID: f.cy.ID, Role: models.WorkspaceMember},
+	)
+
+	f.personalLabel = &models.Label{UserID: f.al.ID, Name: "home"}
+	f.sharedLabel = &models.Label{UserID: f.al.ID, Name: "work"}
+	create(f.personalLabel, f.sharedLabel)
+
+	f.personal = &models.Task{Title: "Personal", UserID: f.al.ID, Labels: []models.Label{*f.personalLabel}}
+	f.shared = &models.Task{Title: "Shared", UserID: f.al.ID, WorkspaceID: &f.workspace.ID, Labels: []models.Label{*f.sharedLabel}}
+	create(f.personal, f.shared)
+
+	f.personalComment = &models.Comment{TaskID: f.personal.ID, UserID: f.al.ID, Body: "Mine"}
+	f.sharedComment = &models.Comment{TaskID: f.shared.ID, UserID: f.al.ID, Body: "Ours"}
+	create(f.personalComment, f.sharedComment)
+
+	if err := EnforceTenants(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	return f
+}
+
+// as returns the connection of the queries made for the user
+func (f *tenantFixture) as(u *models.User) *gorm.DB {
+	return f.conn.WithContext(WithTenant(context.Background(), u.ID))
+}
+
+func TestTenantCannotReadOtherTenants(t *testing.T) {
+	f := newTenantFixture(t)
+	bo := f.as(f.bo)
+
+	if err := bo.First(new(models.Task), f.personal.ID).Error; !errors.Is(err, gorm.ErrRecordNotFound) {
+		t.Fatalf("task: got %v", err)
+	}
+	var comments []models.Comment
+	if err := bo.Where("task_id IN ?", []uint{f.personal.ID, f.shared.ID}).Find(&comments).Error; err != nil || len(comments) != 0 {
+		t.Fatalf("comments: got %+v, %v", comments, err)
+	}
+	var labels int64
+	if err := bo.Model(&models.Label{}).Count(&labels).Error; err != nil || labels != 0 {
+		t.Fatalf("labels: got %d, %v", labels, err)
+	}
+	var names []string
+	if err := bo.Model(&models.Label{}).Pluck("name", &names).Error; err != nil || len(names) != 0 {
+		t.Fatalf("label names: got %v, %v", names, err)
+	}
+	var bodies []string
+	if err := bo.Table("comments AS c").Select("c.body").Scan(&bodies).Error; err != nil || len(bodies) != 0 {
+		t.Fatalf("comment bodies: got %v, %v", bodies, err)
+	}
+	var workspaces []models.Workspace
+	if err := bo.Find(&workspaces).Error; err != nil || len(workspaces) != 0 {
+		t.Fatalf("workspaces: got %+v, %v", workspaces, err)
+	}
+	var memberships []models.Membership
+	if err := bo.Where("workspace_id = ?", f.workspace.ID).Find(&memberships).Error; err != nil || len(memberships) != 0 {
+		t.Fatalf("memberships: got %+v, %v", memberships, err)
+	}
+}
+
+func TestTenantReadsItsWorkspaces(t *testing.T) {
+	f := newTenantFixture(t)
+	cy := f.as(f.cy)
+
+	var tasks []models.Task
+	if err := cy.Preload("Labels").Find(&tasks).Error; err != nil {
+		t.Fatal(err)
+	}
+	if len(tasks) != 1 || tasks[0].ID != f.shared.ID || len(tasks[0].Labels) != 1 || tasks[0].Labels[0].ID != f.sharedLabel.ID {
+		t.Fatalf("tasks: got %+v", tasks)
+	}
+
+	var comments []models.Comment
+	if err := cy.Find(&comments).Error; err != nil || len(comments) != 1 || comments[0].ID != f.sharedComment.ID {
+		t.Fatalf("comments: got %+v, %v", comments, err)
+	}
+	// the label of the shared task is seen, not the other labels of al
+	var labels []models.Label
+	if err := cy.Find(&labels).Error; err != nil || len(labels) != 1 || labels[0].ID != f.sharedLabel.ID {
+		t.Fatalf("labels: got %+v, %v", labels, err)
+	}
+}
+
+func TestTenantCannotChangeOtherTenants(t *testing.T) {
+	f := newTenantFixture(t)
+	bo := f.as(f.bo)
+
+	if res := bo.Model(&models.Task{}).Where("id = ?", f.personal.ID).Update("title", "Taken"); res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("update task: %d rows, %v", res.RowsAffected, res.Error)
+	}
+	if res := bo.Model(f.personalLabel).Updates(map[string]interface{}{"name": "taken"}); res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("update label: %d rows, %v", res.RowsAffected, res.Error)
+	}
+	if res := bo.Delete(&models.Comment{}, f.personalComment.ID); res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("delete comment: %d rows, %v", res.RowsAffected, res.Error)
+	}
+	if res := bo.Where("workspace_id = ?", f.workspace.ID).Delete(&models.Membership{}); res.Error != nil || res.RowsAffected != 0 {
+		t.Fatalf("delete memberships: %d rows, %v", res.RowsAffected, res.Error)
+	}
+	// GORM still refuses the changes of every row
+	if err := bo.Model(&models.Task{}).Update("title", "Taken").Error; !errors.Is(err, gorm.ErrMissingWhereClause) {
+		t.Fatalf("global update: got %v", err)
+	}
+
+	task := new(models.Task)
+	if err := f.conn.First(task, f.personal.ID).Error; err != nil || task.Title != "Personal" {
+		t.Fatalf("task: got %+v, %v", task, err)
+	}
+	label := new(models.Label)
+	if err := f.conn.First(label, f.personalLabel.ID).Error; err != nil || label.Name != "home" {
+		t.Fatalf("label: got %+v, %v", label, err)
+	}
+	var count int64
+	f.conn.Model(&models.Comment{}).Where("id = ?", f.personalComment.ID).Count(&count)
+	if count != 1 {
+		t.Fatal("comment: deleted")
+	}
+	f.conn.Model(&models.Membership{}).Where("workspace_id = ?", f.workspace.ID).Count(&count)
+	if count != 2 {
+		t.Fatalf("memberships: %d left", count)
+	}
+}
+
+func TestTenantCannotCreateForOtherTenants(t *testing.T) {
+	f := newTenantFixture(t)
+	bo := f.as(f.bo)
+
+	if err := bo.Create(&models.Comment{TaskID: f.personal.ID, UserID: f.bo.ID, Body: "Hi"}).Error; !errors.Is(err, ErrNoPermission) {
+		t.Fatalf("comment: got %v", err)
+	}
+	if err := bo.Create(&models.Label{UserID: f.al.ID, Name: "planted"}).Error; !errors.Is(err, ErrNoPermission) {
+		t.Fatalf("label: got %v", err)
+	}
+	if err := bo.Create(&models.Task{Title: "Planted", UserID: f.bo.ID, WorkspaceID: &f.workspace.ID}).Error; !errors.Is(err, ErrNoPermission) {
+		t.Fatalf("task: got %v", err)
+	}
+	if err := bo.Create(&models.Membership{WorkspaceID: f.workspace.ID, UserID: f.al.ID, Role: models.WorkspaceMember}).Error; !errors.Is(err, ErrNoPermission) {
+		t.Fatalf("membership: got %v", err)
+	}
+
+	// a task of bo cannot be moved to the workspace either
+	own := &models.Task{Title: "Own", UserID: f.bo.ID}
+	if err := bo.Create(own).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := bo.Model(own).Update("workspace_id", f.workspace.ID).Error; !errors.Is(err, ErrNoPermission) {
+		t.Fatalf("move: got %v", err)
+	}
+
+	var count int64
+	f.conn.Model(&models.Comment{}).Where("user_id = ?", f.bo.ID).Count(&count)
+	if count != 0 {
+		t.Fatalf("comments: %d created", count)
+	}
+	f.conn.Model(&models.Task{}).Where("workspace_id = ?", f.workspace.ID).Count(&count)
+	if count != 1 {
+		t.Fatalf("workspace tasks: %d", count)
+	}
+}
+
+func TestTenantWritesItsWorkspaces(t *testing.T) {
+	f := newTenantFixture(t)
+	cy := f.as(f.cy)
+
+	if err := cy.Create(&models.Comment{TaskID: f.shared.ID, UserID: f.cy.ID, Body: "Done"}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if err := cy.Create(&models.Task{Title: "Next", UserID: f.cy.ID, WorkspaceID: &f.workspace.ID}).Error; err != nil {
+		t.Fatal(err)
+	}
+	if res := cy.Model(f.shared).Update("title", "Shared and done"); res.Error != nil || res.RowsAffected != 1 {
+		t.Fatalf("update: %d rows, %v", res.RowsAffected, res.Error)
+	}
+}
+
+func TestAllTenants(t *testing.T) {
+	f := newTenantFixture(t)
+
+	task := new(models.Task)
+	if err := AllTenants(f.as(f.bo)).First(task, f.personal.ID).Error; err != nil {
+		t.Fatal(err)
+	}
+}
+
+// TestTenantRulesCoverTables checks every migrated table has a rule or is global on purpose, so
+// a table added or renamed is not left to every tenant
+func TestTenantRulesCoverTables(t *testing.T) {
+	f := newTenantFixture(t)
+
+	var names []string
+	if err := f.conn.Raw("SELECT name FROM sqlite_master WHERE type = 'table' AND name NOT LIKE 'sqlite_%'").Scan(&names).Error; err != nil {
+		t.Fatal(err)
+	}
+	tables := map[string]bool{}
+	for _, name := range names {
+		tables[name] = true
+		_, ruled := tenantRules[name]
+		_, global := globalTables[name]
+		if ruled == global {
+			t.Errorf("table %s: ruled %v, global %v", name, ruled, global)
+		}
+	}
+
+	for name := range tenantRules {
+		if !tables[name] {
+			t.Errorf("rule without table: %s", name)
+		}
+	}
+	for name := range globalTables {
+		if !tables[name] {
+			t.Errorf("global without table: %s", name)
+		}
+	}
+}
@@ -0,0 +1,493 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"sort"
+	"task-app/db"
+	"task-app/models"
+	"time"
+)
+
+// TaskRepo stores the tasks, the queries by user return only the tasks the user can read. With the
+// tenant of WithTenant in the context, the repo keeps to the tasks of the tenant, see authorizeTask.
+type TaskRepo interface {
+	// List returns the tasks of the filter, with their labels and watchers
+	List(u *models.User, f TaskFilter) ([]models.Task, error)
+	// Get returns a task with its labels and watchers.
+	// With roles given, the user must have one of them in the workspace of the task.
+	Get(u *models.User, id uint, roles ...string) (*models.Task, error)
+	// Due returns the tasks with a due date, by date, skipping the done ones unless they recur
+	Due(u *models.User) ([]models.Task, error)
+	Create(t *models.Task) error
+	// Save updates the task to its next version, its associations are left as they are.
+	// It returns ErrConflict when the task is no longer at the version it was read at.
+	Save(t *models.Task) error
+	// Update changes the fields of the map, zero values included, and moves the task to its next version
+	Update(t *models.Task, fields map[string]interface{}) error
+	// Delete moves the task to the trash
+	Delete(t *models.Task) error
+	// ArchiveDone archives the tasks done before the time which the user can change, it returns how many
+	ArchiveDone(u *models.User, before time.Time) (int64, error)
+	// Trash returns the deleted tasks, the last deleted first
+	Trash(u *models.User) ([]models.Task, error)
+	// GetDeleted returns a task of the trash, the roles are checked as by Get
+	GetDeleted(u *models.User, id uint, roles ...string) (*models.Task, error)
+	Restore(t *models.Task) error
+	AddWatcher(t *models.Task, u *models.User) error
+	RemoveWatcher(t *models.Task, userID uint) error
+	// AddLabel attaches the label to the task, RemoveLabel detaches it. Both read the labels
+	// of the task back into it.
+	AddLabel(t *models.Task, label *models.Label) error
+	RemoveLabel(t *models.Task, label *models.Label) error
+	// Watchers returns the watchers of the task but the user except
+	Watchers(taskID, except uint) ([]models.User, error)
+	// CountByStatus counts every task by status
+	CountByStatus() (map[string]int64, error)
+	// Placement checks the user can add tasks to the project or workspace and returns
+	// the project and workspace of such a task: a task of a project always belongs to the
+	// workspace of the project. The ids are optional, none places the task in the personal tasks.
+	Placement(u *models.User, projectID, workspaceID *uint) (*uint, *uint, error)
+	// Reorder puts the tasks of one list in the order of the ids, in the positions they hold,
+	// so the tasks of the list which are not given stay in place. The user must be able to change them all.
+	Reorder(u *models.User, ids []uint) ([]models.Task, error)
+	// WithContext returns the repo running its queries with the context, they stop when it is done
+	WithContext(ctx context.Context) TaskRepo
+}
+
+// TaskFilter narrows List, the zero values match any task
+type TaskFilter struct {
+	CreatorID   uint
+	AssigneeID  uint
+	WorkspaceID *uint
+	ProjectID   *uint
+	// Labels matches the tasks carrying any of the label names
+	Labels []string
+	// Status matches the tasks of the status, the tasks without a status are to do
+	Status string
+	// DueBefore matches the open tasks due before the time, the overdue ones included
+	DueBefore *time.Time
+	// IncludeArchived matches the archived tasks and the tasks of the archived projects too
+	IncludeArchived bool
+	// Query matches the tasks of a query of a saved filter, see models.ParseFilterQuery. Its
+	// relative dates are from Now, by the minute so the lists are cached.
+	Query string
+	Now   time.Time
+	// Sort is the order of the tasks: position (the default), priority or due
+	Sort string
+	// Page lists a page of the tasks newest first instead of the whole list in the order of Sort
+	Page *Page
+}
+
+// taskOrders are the orders of TaskFilter.Sort, the position breaks the ties
+var taskOrders = map[string]string{
+	"position": "tasks.position, tasks.id",
+	"priority": "tasks.priority, tasks.position, tasks.id",
+	"due":      "tasks.due_at IS NULL, tasks.due_at, tasks.priority, tasks.position, tasks.id",
+}
+
+// gormTaskRepo is the TaskRepo of a store
+type gormTaskRepo struct {
+	store db.Store
+}
+
+func NewTaskRepo(store db.Store) TaskRepo {
+	return gormTaskRepo{store: store}
+}
+
+func (r gormTaskRepo) WithContext(ctx context.Context) TaskRepo {
+	return gormTaskRepo{store: db.WithContext(r.store, ctx)}
+}
+
+func (r gormTaskRepo) List(u *models.User, f TaskFilter) ([]models.Task, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, err
+	}
+	query := r.store.DB().Model(models.Task{}).Scopes(models.AccessibleBy(u)).Scopes(models.TaskDetails)
+
+	if f.CreatorID != 0 {
+		query = query.Where("tasks.user_id = ?", f.CreatorID)
+	}
+	if f.AssigneeID != 0 {
+		query = query.Where("tasks.assignee_id = ?", f.AssigneeID)
+	}
+	if f.WorkspaceID != nil {
+		query = query.Where("tasks.workspace_id = ?", *f.WorkspaceID)
+	}
+	if f.ProjectID != nil {
+		query = query.Where("tasks.project_id = ?", *f.ProjectID)
+	}
+	if len(f.Labels) > 0 {
+		query = query.Where(
+			"tasks.id IN (?)",
+			r.store.DB().Table("task_labels").
+				Select("task_labels.task_id").
+				Joins("JOIN labels ON labels.id = task_labels.label_id").
+				Where("labels.name IN ?", f.Labels),
+		)
+	}
+
+	switch f.Status {
+	case "":
+	case models.StatusTodo:
+		query = query.Where("tasks.status IN ?", []string{models.StatusTodo, ""})
+	default:
+		query = query.Where("tasks.status = ?", f.Status)
+	}
+	if f.DueBefore != nil {
+		query = query.Where("tasks.due_at < ? AND tasks.status <> ?", *f.DueBefore, models.StatusDone)
+	}
+	if f.Query != "" {
+		q, err := models.ParseFilterQuery(f.Query)
+		if err != nil {
+			return nil, err
+		}
+		query = query.Scopes(q.Scope(u.ID, f.Now))
+	}
+	if !f.IncludeArchived {
+		query = query.Scopes(models.Unarchived)
+	}
+
+	if f.Page != nil {
+		query = query.Scopes(f.Page.Scope("tasks"))
+	} else if order, ok := taskOrders[f.Sort]; ok {
+		query = query.Order(order)
+	} else {
+		query = query.Order(taskOrders["position"])
+	}
+
+	var tasks []models.Task
+	if err := query.Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+
+	return tasks, models.CountComments(r.store.DB(), tasks)
+}
+
+func (r gormTaskRepo) Get(u *models.User, id uint, roles ...string) (*models.Task, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, err
+	}
+	var tasks []models.Task
+	if err := r.store.DB().Scopes(models.AccessibleBy(u, roles...)).Where("id = ?", id).Scopes(models.TaskDetails).Limit(1).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	if len(tasks) == 0 {
+		return nil, gorm.ErrRecordNotFound
+	}
+	if err := models.CountComments(r.store.DB(), tasks); err != nil {
+		return nil, err
+	}
+
+	return &tasks[0], nil
+}
+
+func (r gormTaskRepo) Due(u *models.User) ([]models.Task, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, err
+	}
+	var tasks []models.Task
+	err := r.store.DB().Scopes(models.AccessibleBy(u), models.Unarchived).
+		Where("tasks.due_at IS NOT NULL").
+		Where("tasks.status <> ? OR tasks.recurrence <> ''", models.StatusDone).
+		Order("tasks.due_at").
+		Find(&tasks).Error
+
+	return tasks, err
+}
+
+func (r gormTaskRepo) Create(t *models.Task) error {
+	if err := authorizePlacement(r.store.DB(), t); err != nil {
+		return err
+	}
+
+	return r.store.DB().Create(t).Error
+}
+
+func (r gormTaskRepo) Save(t *models.Task) error {
+	if err := authorizeTask(r.store.DB(), t, models.WorkspaceWriters...); err != nil {
+		return err
+	}
+	if err := authorizePlacement(r.store.DB(), t); err != nil {
+		return err
+	}
+
+	// Updates rather than Save, which inserts the task when no row matches
+	read := t.Version
+	t.Version++
+	res := r.store.DB().Model(t).
+		Select("*").
+		Omit(clause.Associations).
+		Where("version = ?", read).
+		Updates(t)
+	if res.Error == nil && res.RowsAffected == 0 {
+		res.Error = ErrConflict
+	}
+	if res.Error != nil {
+		t.Version = read
+	}
+
+	return res.Error
+}
+
+func (r gormTaskRepo) Update(t *models.Task, fields map[string]interface{}) error {
+	if err := authorizeTask(r.store.DB(), t, models.WorkspaceWriters...); err != nil {
+		return err
+	}
+	fields["version"] = gorm.Expr("version + 1")
+	if err := r.store.DB().Model(t).Updates(fields).Error; err != nil {
+		return err
+	}
+	t.Version++
+
+	return nil
+}
+
+func (r gormTaskRepo) Delete(t *models.Task) error {
+	if err := authorizeTask(r.store.DB(), t, models.WorkspaceWriters...); err != nil {
+		return err
+	}
+
+	return r.store.DB().Delete(t).Error
+}
+
+func (r gormTaskRepo) ArchiveDone(u *models.User, before time.Time) (int64, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return 0, err
+	}
+	res := r.store.DB().Model(&models.Task{}).
+		Scopes(models.AccessibleBy(u, models.WorkspaceWriters...)).
+		Where("tasks.status = ? AND tasks.completed_at < ? AND tasks.archived_at IS NULL", models.StatusDone, before).
+		Updates(map[string]interface{}{"archived_at": time.Now(), "version": gorm.Expr("version + 1")})
+
+	return res.RowsAffected, res.Error
+}
+
+func (r gormTaskRepo) Trash(u *models.User) ([]models.Task, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, err
+	}
+	var tasks []models.Task
+	err := r.store.DB().Unscoped().
+		Scopes(models.AccessibleBy(u)).
+		Where("deleted_at IS NOT NULL").
+		Order("deleted_at DESC").
+		Preload("Labels").
+		Find(&tasks).Error
+
+	return tasks, err
+}
+
+func (r gormTaskRepo) GetDeleted(u *models.User, id uint, roles ...string) (*models.Task, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, err
+	}
+	task := new(models.Task)
+	if err := r.store.DB().Unscoped().
+		Scopes(models.AccessibleBy(u, roles...)).
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		First(task).Error; err != nil {
+		return nil, err
+	}
+
+	return task, nil
+}
+
+func (r gormTaskRepo) Restore(t *models.Task) error {
+	if err := authorizeTask(r.store.DB(), t, models.WorkspaceWriters...); err != nil {
+		return err
+	}
+	if err := r.store.DB().Unscoped().Model(t).Update("deleted_at", nil).Error; err != nil {
+		return err
+	}
+	t.DeletedAt = gorm.DeletedAt{}
+
+	return nil
+}
+
+func (r gormTaskRepo) AddWatcher(t *models.Task, u *models.User) error {
+	// the readers of a task can watch it
+	if err := authorizeTask(r.store.DB(), t); err != nil {
+		return err
+	}
+	if err := r.store.DB().Model(t).Association("Watchers").Append(u); err != nil {
+		return err
+	}
+
+	return models.TouchTasks(r.store.DB(), t.ID)
+}
+
+func (r gormTaskRepo) RemoveWatcher(t *models.Task, userID uint) error {
+	if err := authorizeTask(r.store.DB(), t); err != nil {
+		return err
+	}
+	watcher := models.User{}
+	watcher.ID = userID
+
+	if err := r.store.DB().Model(t).Association("Watchers").Delete(&watcher); err != nil {
+		return err
+	}
+
+	return models.TouchTasks(r.store.DB(), t.ID)
+}
+
+func (r gormTaskRepo) AddLabel(t *models.Task, label *models.Label) error {
+	if err := authorizeTask(r.store.DB(), t); err != nil {
+		return err
+	}
+	if err := r.store.DB().Model(t).Association("Labels").Append(label); err != nil {
+		return err
+	}
+	if err := models.TouchTasks(r.store.DB(), t.ID); err != nil {
+		return err
+	}
+
+	return r.store.DB().Model(t).Association("Labels").Find(&t.Labels)
+}
+
+func (r gormTaskRepo) RemoveLabel(t *models.Task, label *models.Label) error {
+	if err := authorizeTask(r.store.DB(), t); err != nil {
+		return err
+	}
+	if err := r.store.DB().Model(t).Association("Labels").Delete(label); err != nil {
+		return err
+	}
+	if err := models.TouchTasks(r.store.DB(), t.ID); err != nil {
+		return err
+	}
+
+	return r.store.DB().Model(t).Association("Labels").Find(&t.Labels)
+}
+
+func (r gormTaskRepo) Watchers(taskID, except uint) ([]models.User, error) {
+	task := &models.Task{}
+	task.ID = taskID
+	if err := authorizeTask(r.store.DB(), task); err != nil {
+		return nil, err
+	}
+
+	var watchers []models.User
+	err := r.store.DB().Joins("JOIN task_watchers ON task_watchers.user_id = users.id").
+		Where("task_watchers.task_id = ? AND users.id <> ?", taskID, except).
+		Find(&watchers).Error
+
+	return watchers, err
+}
+
+func (r gormTaskRepo) CountByStatus() (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := r.store.DB().Model(&models.Task{}).
+		Select("status, count(*) AS count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := make(map[string]int64, len(rows))
+	for _, row := range rows {
+		counts[row.Status] = row.Count
+	}
+
+	return counts, nil
+}
+
+func (r gormTaskRepo) Placement(u *models.User, projectID, workspaceID *uint) (*uint, *uint, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, nil, err
+	}
+	if projectID != nil {
+		project := new(models.Project)
+		if err := r.store.DB().Scopes(models.AccessibleBy(u, models.WorkspaceWriters...)).First(project, *projectID).Error; err != nil {
+			return nil, nil, err
+		}
+		return &project.ID, project.WorkspaceID, nil
+	}
+
+	if workspaceID != nil {
+		membership := new(models.Membership)
+		if err := r.store.DB().Where("workspace_id = ? AND user_id = ?", *workspaceID, u.ID).First(membership).Error; err != nil {
+			return nil, nil, ErrNotFound
+		}
+		if !hasRole(membership, models.WorkspaceWriters) {
+			return nil, nil, ErrNoPermission
+		}
+	}
+
+	return nil, workspaceID, nil
+}
+
+func hasRole(m *models.Membership, roles []string) bool {
+	for _, role := range roles {
+		if m.Role == role {
+			return true
+		}
+	}
+
+	return false
+}
+
+func (r gormTaskRepo) Reorder(u *models.User, ids []uint) ([]models.Task, error) {
+	if err := authorizeUser(r.store.DB().Statement.Context, u); err != nil {
+		return nil, err
+	}
+	var tasks []models.Task
+	err := r.store.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Scopes(models.AccessibleBy(u, models.WorkspaceWriters...)).
+			Where("id IN ?", ids).
+			Find(&tasks).Error; err != nil {
+			return err
+		}
+		if len(tasks) != len(ids) {
+			return ErrNotFound
+		}
+
+		byID := make(map[uint]*models.Task, len(tasks))
+		positions := make([]int, 0, len(tasks))
+		for i := range tasks {
+			t := &tasks[i]
+			if !sameList(t, &tasks[0]) {
+				return ErrMixedLists
+			}
+			byID[t.ID] = t
+			positions = append(positions, t.Position)
+		}
+		sort.Ints(positions)
+
+		ordered := make([]models.Task, 0, len(ids))
+		for i, id := range ids {
+			t := byID[id]
+			// equal positions, e.g. of tasks created before the ordering, are spread after the previous one
+			if i > 0 && positions[i] <= positions[i-1] {
+				positions[i] = positions[i-1] + 1
+			}
+			if t.Position != positions[i] {
+				if err := tx.Model(t).UpdateColumn("position", positions[i]).Error; err != nil {
+					return err
+				}
+				t.Position = positions[i]
+			}
+			ordered = append(ordered, *t)
+		}
+		tasks = ordered
+
+		return nil
+	})
+
+	return tasks, err
+}
+
+// sameList checks two tasks are ordered in the same list, as by models.SameList
+func sameList(a, b *models.Task) bool {
+	switch {
+	case a.ProjectID != nil || b.ProjectID != nil:
+		return a.ProjectID != nil && b.ProjectID != nil && *a.ProjectID == *b.ProjectID
+	case a.WorkspaceID != nil || b.WorkspaceID != nil:
+		return a.WorkspaceID != nil && b.WorkspaceID != nil && *a.WorkspaceID == *b.WorkspaceID
+	default:
+		return a.UserID == b.UserID
+	}
+}
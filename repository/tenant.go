@@ -0,0 +1,125 @@
+package repository
+
+import (
+	"context"
+	"gorm.io/gorm"
+	"task-app/models"
+)
+
+// tenantKey is the key of the context of the user the queries are made for
+type tenantKey struct{}
+
+// WithTenant returns the context of the queries made for a signed in user. The repos then keep
+// to the data of the user: the queries by user must be for the user, and the tasks changed
+// must be ones the user can change, in their place before and after the change. Without a
+// tenant, e.g. in the jobs, the repos trust their caller. The other queries of the tenant are
+// kept to its rows by EnforceTenants.
+func WithTenant(ctx context.Context, id uint) context.Context {
+	return context.WithValue(ctx, tenantKey{}, id)
+}
+
+// TenantOf returns the user of WithTenant
+func TenantOf(ctx context.Context) (uint, bool) {
+	if ctx == nil {
+		return 0, false
+	}
+	id, ok := ctx.Value(tenantKey{}).(uint)
+
+	return id, ok
+}
+
+// tenant returns the user the queries of the transaction are made for
+func tenant(tx *gorm.DB) (*models.User, bool) {
+	id, ok := TenantOf(tx.Statement.Context)
+	if !ok {
+		return nil, false
+	}
+	u := &models.User{}
+	u.ID = id
+
+	return u, true
+}
+
+// authorizeUser checks a query by user is made for the tenant, a user cannot list the tasks of another
+func authorizeUser(ctx context.Context, u *models.User) error {
+	if id, ok := TenantOf(ctx); ok && (u == nil || u.ID != id) {
+		return ErrNoPermission
+	}
+
+	return nil
+}
+
+// authorizeTask checks the tenant can change the task as it is stored, with one of the roles. A
+// task of another tenant is not found, as by Get, rather than forbidden.
+func authorizeTask(tx *gorm.DB, t *models.Task, roles ...string) error {
+	u, ok := tenant(tx)
+	if !ok {
+		return nil
+	}
+
+	var count int64
+	err := tx.Session(&gorm.Session{NewDB: true}).Unscoped().
+		Model(&models.Task{}).
+		Scopes(models.AccessibleBy(u, roles...)).
+		Where("id = ?", t.ID).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNotFound
+	}
+
+	return nil
+}
+
+// authorizePlacement checks the tenant can keep the task where it is placed: in the personal
+// tasks of the tenant, or in a workspace where the tenant can change the tasks
+func authorizePlacement(tx *gorm.DB, t *models.Task) error {
+	u, ok := tenant(tx)
+	if !ok {
+		return nil
+	}
+	if t.WorkspaceID == nil {
+		if t.UserID != u.ID {
+			return ErrNoPermission
+		}
+		return nil
+	}
+
+	var count int64
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Model(&models.Membership{}).
+		Where("workspace_id = ? AND user_id = ? AND role IN ?", *t.WorkspaceID, u.ID, models.WorkspaceWriters).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNoPermission
+	}
+
+	return nil
+}
+
+// authorizeAccount checks the tenant can change the account: its own, or any as an admin
+func authorizeAccount(tx *gorm.DB, account *models.User) error {
+	u, ok := tenant(tx)
+	if !ok || account.ID == u.ID {
+		return nil
+	}
+
+	var count int64
+	err := tx.Session(&gorm.Session{NewDB: true}).
+		Model(&models.User{}).
+		Where("id = ? AND role = ?", u.ID, models.RoleAdmin).
+		Count(&count).Error
+	if err != nil {
+		return err
+	}
+	if count == 0 {
+		return ErrNoPermission
+	}
+
+	return nil
+}
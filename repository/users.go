@@ -0,0 +1,350 @@
+package repository
+
+import (
+	"context"
+	"fmt"
+	"gorm.io/gorm"
+	"task-app/db"
+	"task-app/models"
+)
+
+// UserRepo stores the user accounts. With the tenant of WithTenant in the context, the accounts
+// but the tenant's are changed by an admin only.
+type UserRepo interface {
+	// ByID finds a user by id. The users may be cached without their credentials: the password
+	// hash and the TOTP secret are read by Credentials.
+	ByID(id uint) (*models.User, error)
+	// Credentials finds a user by id with the password hash and the TOTP secret, never cached
+	Credentials(id uint) (*models.User, error)
+	// ByIdentity finds a user by email or username
+	ByIdentity(identity string) (*models.User, error)
+	// ByEmailToken finds a user by the hash of the token verifying the pending email
+	ByEmailToken(hash string) (*models.User, error)
+	// ByCalendarToken finds a user by the hash of the token of the calendar feed
+	ByCalendarToken(hash string) (*models.User, error)
+	// ByInboxToken finds a user by the hash of the token of the inbound email address
+	ByInboxToken(hash string) (*models.User, error)
+	ByEmail(email string) (*models.User, error)
+	// ByUsernames returns the users of the usernames, unknown ones are skipped
+	ByUsernames(names []string) ([]models.User, error)
+	EmailTaken(email string) bool
+	UsernameTaken(username string) bool
+	Create(u *models.User) error
+	// Register creates the account unless its email or username is registered, then it returns
+	// ErrTaken. A concurrent signup with the same ones is caught by the unique indexes.
+	Register(u *models.User) error
+	// Save updates the account but its credentials, which are changed by Update only
+	Save(u *models.User) error
+	// Update changes the fields of the map, zero values included
+	Update(u *models.User, fields map[string]interface{}) error
+	// UseTOTPStep records the time step of a TOTP code accepted for the user. It reports false
+	// when the step or a later one was recorded already, by a concurrent login with the code.
+	UseTOTPStep(u *models.User, step int64) (bool, error)
+	// AddFailedLogin counts a failed login of the user in the database and returns the count,
+	// the concurrent failures are all counted
+	AddFailedLogin(u *models.User) (int, error)
+	// EnableTOTP turns 2FA on with the backup codes of the hashes, replacing the ones before
+	EnableTOTP(u *models.User, codeHashes []string) error
+	// DisableTOTP turns 2FA off, dropping the secret and the backup codes
+	DisableTOTP(u *models.User) error
+	// UseBackupCode spends the backup code of the hash, it reports false for an unknown code
+	UseBackupCode(u *models.User, codeHash string) (bool, error)
+	// Delete soft-deletes the account, freeing its unique fields and dropping its personal data.
+	// The memberships, the credentials and the links of the account are removed, and with
+	// cascadeTasks the personal tasks are deleted too.
+	Delete(u *models.User, cascadeTasks bool) error
+	// List returns a page of the users, by id, with the count of the tasks they created
+	List(limit, offset int) ([]UserWithTasks, error)
+	Count() (int64, error)
+	// WithContext returns the repo running its queries with the context, they stop when it is done
+	WithContext(ctx context.Context) UserRepo
+}
+
+type UserWithTasks struct {
+	models.User
+	TaskCount int64
+}
+
+// gormUserRepo is the UserRepo of a store
+type gormUserRepo struct {
+	store db.Store
+}
+
+func NewUserRepo(store db.Store) UserRepo {
+	return gormUserRepo{store: store}
+}
+
+func (r gormUserRepo) WithContext(ctx context.Context) UserRepo {
+	return gormUserRepo{store: db.WithContext(r.store, ctx)}
+}
+
+func (r gormUserRepo) ByID(id uint) (*models.User, error) {
+	u := new(models.User)
+	if err := r.store.DB().First(u, id).Error; err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+func (r gormUserRepo) Credentials(id uint) (*models.User, error) {
+	return r.ByID(id)
+}
+
+func (r gormUserRepo) ByIdentity(identity string) (*models.User, error) {
+	return r.first(r.store.DB().Where(&models.User{Email: identity}).Or(&models.User{Username: identity}))
+}
+
+func (r gormUserRepo) ByEmailToken(hash string) (*models.User, error) {
+	return r.first(r.store.DB().Where("email_token = ?", hash))
+}
+
+func (r gormUserRepo) ByCalendarToken(hash string) (*models.User, error) {
+	return r.first(r.store.DB().Where("calendar_token = ?", hash))
+}
+
+func (r gormUserRepo) ByInboxToken(hash string) (*models.User, error) {
+	return r.first(r.store.DB().Where("inbox_token = ?", hash))
+}
+
+func (r gormUserRepo) ByEmail(email string) (*models.User, error) {
+	return r.first(r.store.DB().Where(&models.User{Email: email}))
+}
+
+func (r gormUserRepo) ByUsernames(names []string) ([]models.User, error) {
+	var users []models.User
+	err := r.store.DB().Where("username IN ?", names).Find(&users).Error
+
+	return users, err
+}
+
+func (r gormUserRepo) EmailTaken(email string) bool {
+	return r.store.DB().Where(&models.User{Email: email}).First(new(models.User)).RowsAffected > 0
+}
+
+func (r gormUserRepo) UsernameTaken(username string) bool {
+	return r.store.DB().Where(&models.User{Username: username}).First(new(models.User)).RowsAffected > 0
+}
+
+func (r gormUserRepo) Create(u *models.User) error {
+	return r.store.DB().Create(u).Error
+}
+
+func (r gormUserRepo) Register(u *models.User) error {
+	err := r.store.DB().Transaction(func(tx *gorm.DB) error {
+		users := gormUserRepo{store: db.NewStore(tx)}
+		if users.EmailTaken(u.Email) || users.UsernameTaken(u.Username) {
+			return ErrTaken
+		}
+
+		return tx.Create(u).Error
+	})
+	if db.IsUniqueViolation(err) {
+		return ErrTaken
+	}
+
+	return err
+}
+
+func (r gormUserRepo) Save(u *models.User) error {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return err
+	}
+	// a user read without its credentials does not erase them
+	return r.store.DB().Omit("password", "totp_secret").Save(u).Error
+}
+
+func (r gormUserRepo) Update(u *models.User, fields map[string]interface{}) error {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return err
+	}
+	return r.store.DB().Model(u).Updates(fields).Error
+}
+
+func (r gormUserRepo) UseTOTPStep(u *models.User, step int64) (bool, error) {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return false, err
+	}
+	res := r.store.DB().Model(&models.User{}).
+		Where("id = ? AND totp_last_step < ?", u.ID, step).
+		UpdateColumn("totp_last_step", step)
+	if res.Error != nil {
+		return false, res.Error
+	}
+	u.TOTPLastStep = step
+
+	return res.RowsAffected > 0, nil
+}
+
+func (r gormUserRepo) AddFailedLogin(u *models.User) (int, error) {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return 0, err
+	}
+	var failed int
+	err := r.store.DB().Transaction(func(tx *gorm.DB) error {
+		// the row is locked by the update until the commit, the count read back is the one it stored
+		if err := tx.Model(&models.User{}).Where("id = ?", u.ID).
+			Update("failed_logins", gorm.Expr("failed_logins + ?", 1)).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(&models.User{}).Select("failed_logins").Where("id = ?", u.ID).Row().Scan(&failed)
+	})
+	if err != nil {
+		return 0, err
+	}
+	u.FailedLogins = failed
+
+	return failed, nil
+}
+
+func (r gormUserRepo) EnableTOTP(u *models.User, codeHashes []string) error {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return err
+	}
+	return r.store.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.BackupCode{}).Error; err != nil {
+			return err
+		}
+
+		for _, hash := range codeHashes {
+			if err := tx.Create(&models.BackupCode{UserID: u.ID, CodeHash: hash}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Model(u).Update("totp_enabled", true).Error
+	})
+}
+
+func (r gormUserRepo) DisableTOTP(u *models.User) error {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return err
+	}
+	return r.store.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.BackupCode{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Model(u).Updates(map[string]interface{}{
+			"totp_enabled": false,
+			"totp_secret":  "",
+		}).Error
+	})
+}
+
+func (r gormUserRepo) UseBackupCode(u *models.User, codeHash string) (bool, error) {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return false, err
+	}
+	res := r.store.DB().Where("user_id = ? AND code_hash = ?", u.ID, codeHash).Delete(&models.BackupCode{})
+
+	return res.RowsAffected > 0, res.Error
+}
+
+func (r gormUserRepo) Delete(u *models.User, cascadeTasks bool) error {
+	if err := authorizeAccount(r.store.DB(), u); err != nil {
+		return err
+	}
+	return r.store.DB().Transaction(func(tx *gorm.DB) error {
+		// tasks of shared workspaces stay with the workspace in any mode
+		if cascadeTasks {
+			if err := tx.Where("user_id = ? AND workspace_id IS NULL", u.ID).Delete(&models.Task{}).Error; err != nil {
+				return err
+			}
+		}
+
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.Membership{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Unscoped().Where("user_id = ?", u.ID).Delete(&models.Notification{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.NotificationPreference{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.TelegramAccount{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.PushDevice{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.MagicLink{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.StreamTicket{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.SSOIdentity{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.OAuthAccount{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.APIKey{}).Error; err != nil {
+			return err
+		}
+		// the deliveries log the payloads of the events of the user
+		hooks := tx.Unscoped().Model(&models.Webhook{}).Select("id").Where("user_id = ?", u.ID)
+		if err := tx.Where("webhook_id IN (?)", hooks).Delete(&models.WebhookDelivery{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.Webhook{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.Share{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("user_id = ?", u.ID).Delete(&models.Filter{}).Error; err != nil {
+			return err
+		}
+
+		// free the unique fields and drop the personal data of the user
+		anonymous := fmt.Sprintf("deleted-%d", u.ID)
+		if err := tx.Model(u).Updates(map[string]interface{}{
+			"email":             anonymous + "@deleted.invalid",
+			"username":          anonymous,
+			"display_name":      "",
+			"pending_email":     "",
+			"email_verified_at": nil,
+			"email_token":       "",
+			"inbox_token":       "",
+			"calendar_token":    "",
+			"password":          "",
+		}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(u).Error
+	})
+}
+
+func (r gormUserRepo) List(limit, offset int) ([]UserWithTasks, error) {
+	var rows []UserWithTasks
+	err := r.store.DB().Model(&models.User{}).
+		Select("users.*, (?) AS task_count",
+			r.store.DB().Model(&models.Task{}).Select("count(*)").Where("tasks.user_id = users.id"),
+		).
+		Order("users.id").
+		Limit(limit).
+		Offset(offset).
+		Find(&rows).Error
+
+	return rows, err
+}
+
+func (r gormUserRepo) Count() (int64, error) {
+	var count int64
+	err := r.store.DB().Model(&models.User{}).Count(&count).Error
+
+	return count, err
+}
+
+func (r gormUserRepo) first(query *gorm.DB) (*models.User, error) {
+	u := new(models.User)
+	if err := query.First(u).Error; err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
@@ -0,0 +1,103 @@
+package router
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+)
+
+func (h *Handler) handleGetTaskActivity(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	return sendActivities(c, h.db(c).Where("task_id = ?", task.ID))
+}
+
+// GetUserActivity returns the changes made by the user signed in
+func (h *Handler) GetUserActivity(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	return sendActivities(c, h.db(c).Where("actor_id = ?", u.ID))
+}
+
+// sendActivities sends a page of the activities of the query, newest first.
+// ?cursor= sends the page of the cursor as {activity, nextCursor} instead of the page of ?page=.
+func sendActivities(c *fiber.Ctx, query *gorm.DB) error {
+	page, err := cursorPage(c)
+	if err != nil {
+		return err
+	}
+
+	if page != nil {
+		query = query.Scopes(page.Scope("activities"))
+	} else {
+		limit, offset := paginate(c)
+		query = query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset)
+	}
+
+	var activities []models.Activity
+	if res := query.Find(&activities); res.Error != nil {
+		return sendError(c, "Cannot find the activity", fiber.StatusInternalServerError)
+	}
+
+	var next interface{}
+	if page != nil && page.More(len(activities)) {
+		activities = activities[:page.Limit]
+		last := activities[len(activities)-1]
+		next = nextCursor(last.CreatedAt, last.ID)
+	}
+
+	response := make([]models.ActivityApi, 0, len(activities))
+	for _, a := range activities {
+		response = append(response, a.Api())
+	}
+
+	if page != nil {
+		return c.JSON(fiber.Map{"activity": response, "nextCursor": next})
+	}
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// recordActivity writes every event to the audit log.
+// The data is the diff of the fields when there is one, the payload otherwise.
+func (h *Handler) recordActivity(e events.Event) {
+	activity := models.Activity{
+		CreatedAt:   e.CreatedAt,
+		ActorID:     e.ActorID,
+		Verb:        e.Type,
+		TargetType:  e.Target(),
+		TargetID:    e.TargetID,
+		WorkspaceID: e.WorkspaceID,
+	}
+
+	if e.TaskID != 0 {
+		taskID := e.TaskID
+		activity.TaskID = &taskID
+	}
+	if e.ImpersonatorID != 0 {
+		impersonatorID := e.ImpersonatorID
+		activity.ImpersonatorID = &impersonatorID
+	}
+
+	var data interface{} = e.Payload
+	if len(e.Changes) > 0 {
+		data = e.Changes
+	}
+	if data != nil {
+		if b, err := json.Marshal(data); err == nil {
+			activity.Data = string(b)
+		}
+	}
+
+	if err := h.store.DB().Create(&activity).Error; err != nil {
+		logging.Log.Error().Err(err).Str("event", e.Type).Msg("Cannot record activity")
+	}
+}
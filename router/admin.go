@@ -0,0 +1,286 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/events"
+	"task-app/jobs"
+	"task-app/models"
+	"task-app/queue"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+)
+
+func (h *Handler) setupAdminRoutes() {
+	ADMIN.Use(h.tokens.SecureAuth(), util.SessionOnly(), h.tokens.RequireRole(models.RoleAdmin), util.AllTenants())
+	ADMIN.Get("/users", h.handleAdminGetUsers)
+	ADMIN.Post("/users/:id/lock", h.handleAdminLockUser)
+	ADMIN.Post("/users/:id/unlock", h.handleAdminUnlockUser)
+	ADMIN.Patch("/users/:id/role", h.handleAdminSetRole)
+	ADMIN.Post("/impersonate/:id", h.handleAdminImpersonate)
+	ADMIN.Get("/impersonations", h.handleAdminGetImpersonations)
+	ADMIN.Delete("/impersonations/:id", h.handleAdminEndImpersonation)
+	ADMIN.Patch("/workspaces/:id/plan", h.handleAdminSetWorkspacePlan)
+	ADMIN.Get("/stats", h.handleAdminStats)
+	ADMIN.Get("/jobs", h.handleAdminGetJobs)
+	ADMIN.Post("/jobs/:name/run", h.handleAdminRunJob)
+	ADMIN.Get("/jobs/failed", h.handleAdminGetFailedJobs)
+	ADMIN.Get("/jobs/failed/:id", h.handleAdminGetFailedJob)
+	ADMIN.Post("/jobs/failed/:id/retry", h.handleAdminRetryJob)
+	ADMIN.Delete("/jobs/failed/:id", h.handleAdminDeleteFailedJob)
+}
+
+func (h *Handler) handleAdminGetUsers(c *fiber.Ctx) error {
+	limit, offset := paginate(c)
+
+	rows, err := h.userRepo(c).List(limit, offset)
+	if err != nil {
+		return sendError(c, "Cannot find users", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.UserAdminApi, 0, len(rows))
+	for _, r := range rows {
+		response = append(response, models.UserAdminApi{
+			ID:          r.ID,
+			Email:       r.Email,
+			Username:    r.Username,
+			Role:        r.Role,
+			Locked:      r.Locked,
+			LockedUntil: models.UTC(r.LockedUntil),
+			TaskCount:   r.TaskCount,
+			CreatedAt:   models.Timestamp(r.CreatedAt),
+		})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleAdminLockUser(c *fiber.Ctx) error {
+	u, err := h.findAdminTarget(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"locked": true}); err != nil {
+		return sendError(c, "Cannot lock user "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	// a locked user must not be able to refresh the access token
+	h.tokens.RevokeTokens(strconv.Itoa(int(u.ID)), models.RevokedLocked)
+
+	h.publishAdminEvent(c, events.UserLocked, u, fiber.Map{"reason": "admin"})
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleAdminUnlockUser(c *fiber.Ctx) error {
+	u, err := h.findAdminTarget(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+
+	// the lockout after failed logins is lifted too
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"locked": false, "locked_until": nil, "failed_logins": 0}); err != nil {
+		return sendError(c, "Cannot unlock user "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	h.publishAdminEvent(c, events.UserUnlocked, u, nil)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleAdminSetRole(c *fiber.Ctx) error {
+	type RoleInput struct {
+		Role string `json:"role"`
+	}
+
+	input := new(RoleInput)
+	if err := c.BodyParser(input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Role != models.RoleUser && input.Role != models.RoleAdmin {
+		return sendError(c, "Unknown role "+input.Role, fiber.StatusBadRequest)
+	}
+
+	u, err := h.findAdminTarget(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"role": input.Role}); err != nil {
+		return sendError(c, "Cannot update role "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleAdminStats(c *fiber.Ctx) error {
+	users, err := h.userRepo(c).Count()
+	if err != nil {
+		return sendError(c, "Cannot count users", fiber.StatusInternalServerError)
+	}
+
+	byStatus, err := h.taskRepo(c).CountByStatus()
+	if err != nil {
+		return sendError(c, "Cannot count tasks", fiber.StatusInternalServerError)
+	}
+
+	stats := models.TaskStats{Users: users, ByStatus: byStatus}
+	for _, count := range byStatus {
+		stats.Tasks += count
+	}
+
+	return c.Status(fiber.StatusOK).JSON(stats)
+}
+
+// handleAdminGetFailedJobs lists the background jobs which failed their last attempt, the last failed first
+func (h *Handler) handleAdminGetFailedJobs(c *fiber.Ctx) error {
+	limit, offset := paginate(c)
+
+	query := h.db(c).Order("created_at DESC, id DESC").Limit(limit).Offset(offset)
+	if kind := c.Query("kind"); kind != "" {
+		query = query.Where("kind = ?", kind)
+	}
+
+	var jobs []models.FailedJob
+	if err := query.Find(&jobs).Error; err != nil {
+		return sendError(c, "Cannot find the failed jobs", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.FailedJobApi, 0, len(jobs))
+	for _, j := range jobs {
+		response = append(response, j.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleAdminGetFailedJob(c *fiber.Ctx) error {
+	job, err := h.findFailedJob(c)
+	if err != nil {
+		return sendError(c, "Cannot find the job", fiber.StatusNotFound)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(job.Api())
+}
+
+// handleAdminGetJobs lists the periodic jobs of the instance with their last run
+func (h *Handler) handleAdminGetJobs(c *fiber.Ctx) error {
+	return c.Status(fiber.StatusOK).JSON(jobs.Statuses())
+}
+
+// handleAdminRunJob runs a periodic job now on the instance, a disabled one too
+func (h *Handler) handleAdminRunJob(c *fiber.Ctx) error {
+	err := jobs.RunNow(c.Params("name"))
+	switch {
+	case errors.Is(err, jobs.ErrUnknownJob):
+		return sendError(c, "Cannot find the job", fiber.StatusNotFound)
+	case errors.Is(err, jobs.ErrJobRunning):
+		return sendError(c, "The job is running already", fiber.StatusConflict)
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// handleAdminRetryJob queues a failed job again, it is recorded again when it fails again
+func (h *Handler) handleAdminRetryJob(c *fiber.Ctx) error {
+	job, err := h.findFailedJob(c)
+	if err != nil {
+		return sendError(c, "Cannot find the job", fiber.StatusNotFound)
+	}
+
+	if _, err := queue.Retry(job); err != nil {
+		return sendError(c, "Cannot retry the job "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+func (h *Handler) handleAdminDeleteFailedJob(c *fiber.Ctx) error {
+	job, err := h.findFailedJob(c)
+	if err != nil {
+		return sendError(c, "Cannot find the job", fiber.StatusNotFound)
+	}
+
+	if err := h.db(c).Delete(job).Error; err != nil {
+		return sendError(c, "Cannot delete the job "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) findFailedJob(c *fiber.Ctx) (*models.FailedJob, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, err
+	}
+
+	job := new(models.FailedJob)
+	if err := h.db(c).First(job, id).Error; err != nil {
+		return nil, err
+	}
+
+	return job, nil
+}
+
+// publishAdminEvent publishes an event about the account of u, made by the admin signed in
+func (h *Handler) publishAdminEvent(c *fiber.Ctx, kind string, u *models.User, payload interface{}) {
+	var actorID uint
+	if admin, err := h.tokens.CurrentUser(c); err == nil {
+		actorID = admin.ID
+	}
+
+	events.Publish(userEvent(kind, actorID, u, payload))
+}
+
+func (h *Handler) findAdminTarget(c *fiber.Ctx) (*models.User, error) {
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return nil, err
+	}
+
+	return h.userRepo(c).ByID(uint(id))
+}
+
+// paginate reads ?page= and ?limit= into a limit and an offset
+func paginate(c *fiber.Ctx) (int, int) {
+	limit, err := strconv.Atoi(c.Query("limit", "50"))
+	if err != nil || limit < 1 || limit > 100 {
+		limit = 50
+	}
+
+	page, err := strconv.Atoi(c.Query("page", "1"))
+	if err != nil || page < 1 {
+		page = 1
+	}
+
+	return limit, (page - 1) * limit
+}
+
+// cursorPage reads ?cursor= and ?limit= into a page of a keyset listing, the page is nil
+// without a cursor. An empty cursor asks for the first page.
+func cursorPage(c *fiber.Ctx) (*repository.Page, error) {
+	if !c.Context().QueryArgs().Has("cursor") {
+		return nil, nil
+	}
+
+	limit, _ := paginate(c)
+	page := &repository.Page{Limit: limit}
+	if s := c.Query("cursor"); s != "" {
+		after, err := repository.ParseCursor(s)
+		if err != nil {
+			return nil, models.NewError(fiber.StatusBadRequest, "Invalid cursor")
+		}
+		page.After = &after
+	}
+
+	return page, nil
+}
+
+// nextCursor returns the cursor after the last row of a page, it is sent as nextCursor
+func nextCursor(createdAt time.Time, id uint) string {
+	return repository.Cursor{CreatedAt: createdAt, ID: id}.String()
+}
@@ -0,0 +1,94 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"task-app/models"
+	"task-app/util"
+)
+
+// GetAPIKeys lists the API keys of the user signed in
+func (h *Handler) GetAPIKeys(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	var keys []models.APIKey
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Order("created_at").Find(&keys); res.Error != nil {
+		return sendError(c, "Cannot find user's API keys", fiber.StatusForbidden)
+	}
+
+	response := make([]models.APIKeyApi, 0, len(keys))
+	for _, k := range keys {
+		response = append(response, k.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// CreateAPIKey creates a scoped API key, the key itself is returned only once
+func (h *Handler) CreateAPIKey(c *fiber.Ctx) error {
+	type APIKeyInput struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}
+
+	input := new(APIKeyInput)
+	if err := c.BodyParser(input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Name = strings.TrimSpace(input.Name); input.Name == "" {
+		return sendError(c, "API key name is required field", fiber.StatusBadRequest)
+	}
+
+	if len(input.Scopes) == 0 {
+		input.Scopes = []string{util.ScopeRead}
+	}
+	for _, scope := range input.Scopes {
+		if !isAPIKeyScope(scope) {
+			return sendError(c, "Unknown scope "+scope, fiber.StatusBadRequest)
+		}
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	key, apiKey := util.GenerateAPIKey(u.ID, input.Name, input.Scopes)
+	if res := h.db(c).Create(apiKey); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+
+	response := apiKey.Api()
+	response.Key = key
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// RevokeAPIKey deletes an API key of the user signed in
+func (h *Handler) RevokeAPIKey(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	res := h.db(c).Scopes(models.OwnedBy(u)).Where("id = ?", c.Params("id")).Delete(&models.APIKey{})
+	if res.Error != nil || res.RowsAffected <= 0 {
+		return sendError(c, "Cannot find the API key", fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func isAPIKeyScope(scope string) bool {
+	for _, s := range util.APIKeyScopes {
+		if s == scope {
+			return true
+		}
+	}
+
+	return false
+}
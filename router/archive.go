@@ -0,0 +1,112 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/models"
+	"time"
+)
+
+// includeArchived tells whether a list asks for the archived tasks and projects with ?include_archived=true
+func includeArchived(c *fiber.Ctx) bool {
+	return c.Query("include_archived") == "true"
+}
+
+// handleArchiveTask archives the task: it is kept as it is, but left out of the lists and the search
+func (h *Handler) handleArchiveTask(c *fiber.Ctx) error {
+	return h.setTaskArchived(c, true)
+}
+
+func (h *Handler) handleUnarchiveTask(c *fiber.Ctx) error {
+	return h.setTaskArchived(c, false)
+}
+
+func (h *Handler) setTaskArchived(c *fiber.Ctx, archived bool) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+	if (task.ArchivedAt != nil) == archived {
+		return c.JSON(task.Api())
+	}
+
+	from := task.ArchivedAt
+	var archivedAt *time.Time
+	kind := events.TaskUnarchived
+	if archived {
+		now := time.Now()
+		archivedAt, kind = &now, events.TaskArchived
+	}
+	if err := h.taskRepo(c).Update(task, map[string]interface{}{"archived_at": archivedAt}); err != nil {
+		return sendError(c, "Cannot archive the task", fiber.StatusInternalServerError)
+	}
+	task.ArchivedAt = archivedAt
+
+	e := taskEvent(kind, u, task, task.Api())
+	e.Changes = map[string]events.Change{"archivedAt": {From: from, To: archivedAt}}
+	events.Publish(e)
+
+	return c.JSON(task.Api())
+}
+
+// handleArchiveDoneTasks archives the tasks the user can change which were completed
+// more than olderThanDays ago, and answers how many
+func (h *Handler) handleArchiveDoneTasks(c *fiber.Ctx) error {
+	input := new(models.ArchiveDoneInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	before := time.Now().AddDate(0, 0, -input.OlderThanDays)
+	archived, err := h.taskRepo(c).ArchiveDone(u, before)
+	if err != nil {
+		return sendError(c, "Cannot archive the tasks", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"archived": archived})
+}
+
+// handleArchiveProject archives the project, its tasks are left out of the lists with it
+func (h *Handler) handleArchiveProject(c *fiber.Ctx) error {
+	return h.setProjectArchived(c, true)
+}
+
+func (h *Handler) handleUnarchiveProject(c *fiber.Ctx) error {
+	return h.setProjectArchived(c, false)
+}
+
+func (h *Handler) setProjectArchived(c *fiber.Ctx, archived bool) error {
+	project, err := h.findWritableProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+	if (project.ArchivedAt != nil) == archived {
+		return c.JSON(project.Api())
+	}
+
+	var archivedAt *time.Time
+	if archived {
+		now := time.Now()
+		archivedAt = &now
+	}
+	if res := h.db(c).Model(project).Update("archived_at", archivedAt); res.Error != nil {
+		return sendError(c, "Cannot archive the project", fiber.StatusInternalServerError)
+	}
+	project.ArchivedAt = archivedAt
+	// the lists leave out the tasks of the archived projects
+	h.cache.Forget(cache.Tasks)
+
+	c.Set(fiber.HeaderETag, projectETag(project))
+	return c.JSON(project.Api())
+}
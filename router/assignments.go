@@ -0,0 +1,187 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/events"
+	"task-app/models"
+)
+
+type taskUserInput struct {
+	UserID uint `json:"userId"`
+}
+
+func (h *Handler) handleAssignTask(c *fiber.Ctx) error {
+	input := new(taskUserInput)
+	if err := c.BodyParser(input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	assignee, err := h.userRepo(c).ByID(input.UserID)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+
+	if !h.canAccessTask(c, assignee.ID, task, models.WorkspaceWriters...) {
+		return sendError(c, "The user cannot work on this task", fiber.StatusForbidden)
+	}
+
+	if err := h.taskRepo(c).Update(task, map[string]interface{}{"assignee_id": assignee.ID}); err != nil {
+		return sendError(c, "Cannot assign task "+err.Error(), fiber.StatusForbidden)
+	}
+	task.AssigneeID = &assignee.ID
+	task.Assignee = assignee
+
+	// the assignee follows the changes of the task from now on
+	h.taskRepo(c).AddWatcher(task, assignee)
+
+	publishTaskEvent(events.TaskAssigned, u, task, fiber.Map{"assigneeId": assignee.ID})
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func (h *Handler) handleUnassignTask(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	if err := h.taskRepo(c).Update(task, map[string]interface{}{"assignee_id": nil}); err != nil {
+		return sendError(c, "Cannot unassign task "+err.Error(), fiber.StatusForbidden)
+	}
+	task.AssigneeID = nil
+
+	publishTaskEvent(events.TaskUnassigned, u, task, nil)
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func (h *Handler) handleGetWatchers(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	response := make([]models.MemberApi, 0, len(task.Watchers))
+	for _, w := range task.Watchers {
+		response = append(response, models.MemberApi{UserID: w.ID, Username: w.Username})
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// handleAddWatcher adds the user of the body, or the user signed in without a body.
+// Any reader can watch a task, adding someone else needs write access.
+func (h *Handler) handleAddWatcher(c *fiber.Ctx) error {
+	input := new(taskUserInput)
+	if len(c.Body()) > 0 {
+		if err := c.BodyParser(input); err != nil {
+			return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+		}
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	if input.UserID == 0 {
+		input.UserID = u.ID
+	}
+
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	if input.UserID != u.ID && !h.canAccessTask(c, u.ID, task, models.WorkspaceWriters...) {
+		return sendError(c, errNoPermission.Error(), fiber.StatusForbidden)
+	}
+
+	watcher, err := h.userRepo(c).ByID(input.UserID)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+
+	if !h.canAccessTask(c, watcher.ID, task) {
+		return sendError(c, "The user cannot see this task", fiber.StatusForbidden)
+	}
+
+	if err := h.taskRepo(c).AddWatcher(task, watcher); err != nil {
+		return sendError(c, "Cannot add watcher "+err.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func (h *Handler) handleRemoveWatcher(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return sendError(c, "Invalid user id", fiber.StatusBadRequest)
+	}
+
+	if uint(userID) != u.ID && !h.canAccessTask(c, u.ID, task, models.WorkspaceWriters...) {
+		return sendError(c, errNoPermission.Error(), fiber.StatusForbidden)
+	}
+
+	if err := h.taskRepo(c).RemoveWatcher(task, uint(userID)); err != nil {
+		return sendError(c, "Cannot remove watcher "+err.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+// canAccessTask checks if a user can see the task, or with roles given,
+// if the user has one of the roles in the workspace of the task
+func (h *Handler) canAccessTask(c *fiber.Ctx, userID uint, task *models.Task, roles ...string) bool {
+	if task.WorkspaceID == nil {
+		return task.UserID == userID
+	}
+
+	u := &models.User{}
+	u.ID = userID
+	_, err := h.findMembership(c, u, *task.WorkspaceID, roles...)
+	return err == nil
+}
+
+func publishTaskEvent(kind string, actor *models.User, task *models.Task, payload interface{}) {
+	events.Publish(taskEvent(kind, actor, task, payload))
+}
+
+// taskEvent returns an event about the task, targeting the task itself
+func taskEvent(kind string, actor *models.User, task *models.Task, payload interface{}) events.Event {
+	return events.Event{
+		Type:           kind,
+		ActorID:        actor.ID,
+		ImpersonatorID: actor.ImpersonatorID,
+		TaskID:         task.ID,
+		TargetID:       task.ID,
+		OwnerID:        task.UserID,
+		WorkspaceID:    task.WorkspaceID,
+		Payload:        payload,
+	}
+}
@@ -0,0 +1,208 @@
+package router
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/google/uuid"
+	"io"
+	"mime/multipart"
+	"net/http"
+	"path/filepath"
+	"strings"
+	"task-app/models"
+	"task-app/quota"
+	"task-app/storage"
+	"time"
+)
+
+// signedURLTTL is how long a download link of an attachment stays valid
+const signedURLTTL = 15 * time.Minute
+
+func (h *Handler) setupAttachmentsRoutes() {
+	// signed links are the authorization here, so no SecureAuth
+	ATTACHMENTS.Get("/download", h.handleDownloadAttachment)
+}
+
+func (h *Handler) handleGetAttachments(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	var attachments []models.Attachment
+	if res := h.db(c).Where("task_id = ?", task.ID).Order("created_at").Find(&attachments); res.Error != nil {
+		return sendError(c, "Cannot find task's attachments", fiber.StatusForbidden)
+	}
+
+	response := make([]models.AttachmentApi, 0, len(attachments))
+	for _, a := range attachments {
+		url, err := storage.Store.SignedURL(a.StorageKey, signedURLTTL)
+		if err != nil {
+			return sendError(c, "Cannot sign attachment url", fiber.StatusInternalServerError)
+		}
+		response = append(response, a.Api(url))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleUploadAttachment(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return sendError(c, "File is required field", fiber.StatusBadRequest)
+	}
+
+	attachment, err := h.saveAttachment(c, task, u, fh)
+	var typeErr errFileType
+	var exceeded *quota.ExceededError
+	switch {
+	case errors.Is(err, errFileTooLarge):
+		return sendError(c, err.Error(), fiber.StatusRequestEntityTooLarge)
+	case errors.As(err, &typeErr):
+		return sendError(c, err.Error(), fiber.StatusUnsupportedMediaType)
+	case errors.Is(err, errFileUnreadable):
+		return sendError(c, err.Error(), fiber.StatusBadRequest)
+	case errors.Is(err, errFileNotStored):
+		return sendError(c, err.Error(), fiber.StatusInternalServerError)
+	case errors.As(err, &exceeded):
+		return exceededError(exceeded)
+	case err != nil:
+		return sendError(c, err.Error(), fiber.StatusBadRequest)
+	}
+
+	url, _ := storage.Store.SignedURL(attachment.StorageKey, signedURLTTL)
+	return c.Status(fiber.StatusOK).JSON(attachment.Api(url))
+}
+
+var (
+	errFileTooLarge   = fmt.Errorf("File is larger than %d bytes", storage.MaxUploadSize)
+	errFileUnreadable = errors.New("Cannot read the file")
+	errFileNotStored  = errors.New("Cannot store the file")
+)
+
+// errFileType is the error of a file type which is not allowed
+type errFileType string
+
+func (e errFileType) Error() string {
+	return "File type " + string(e) + " is not allowed"
+}
+
+// saveAttachment stores the file and attaches it to the task.
+// The type of the file is sniffed from its content, the type given by the client is not trusted.
+func (h *Handler) saveAttachment(c *fiber.Ctx, task *models.Task, u *models.User, fh *multipart.FileHeader) (*models.Attachment, error) {
+	if fh.Size > storage.MaxUploadSize {
+		return nil, errFileTooLarge
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return nil, errFileUnreadable
+	}
+	defer file.Close()
+
+	head := make([]byte, 512)
+	n, err := io.ReadFull(file, head)
+	if err != nil && err != io.ErrUnexpectedEOF {
+		return nil, errFileUnreadable
+	}
+	contentType := http.DetectContentType(head[:n])
+
+	if !storage.IsAllowedType(contentType) {
+		return nil, errFileType(contentType)
+	}
+
+	if _, err := file.Seek(0, io.SeekStart); err != nil {
+		return nil, errFileUnreadable
+	}
+	// checked before the file is stored, the creation of the attachment checks it again
+	if err := h.quotas.Check(h.db(c), task.WorkspaceID, quota.Storage, fh.Size); err != nil {
+		return nil, err
+	}
+
+	attachment := &models.Attachment{
+		TaskID:      task.ID,
+		UserID:      u.ID,
+		FileName:    filepath.Base(fh.Filename),
+		ContentType: contentType,
+		Size:        fh.Size,
+		StorageKey:  fmt.Sprintf("tasks/%d/%s%s", task.ID, uuid.New(), filepath.Ext(fh.Filename)),
+	}
+
+	if err := storage.Store.Put(attachment.StorageKey, file, fh.Size, contentType); err != nil {
+		return nil, errFileNotStored
+	}
+
+	if res := h.db(c).Create(attachment); res.Error != nil {
+		storage.Store.Delete(attachment.StorageKey)
+		return nil, res.Error
+	}
+
+	return attachment, nil
+}
+
+func (h *Handler) handleDeleteAttachment(c *fiber.Ctx) error {
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	attachment := new(models.Attachment)
+	result := h.db(c).Where("id = ? AND task_id = ?", c.Params("attachmentId"), task.ID).First(attachment)
+	if result.Error != nil {
+		return sendError(c, "Cannot find the Attachment", fiber.StatusNotFound)
+	}
+
+	if err := storage.Store.Delete(attachment.StorageKey); err != nil {
+		return sendError(c, "Cannot delete the file", fiber.StatusInternalServerError)
+	}
+
+	if res := h.db(c).Unscoped().Delete(attachment); res.Error != nil {
+		return sendError(c, "Cannot delete attachment "+res.Error.Error(), fiber.StatusForbidden)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleDownloadAttachment(c *fiber.Ctx) error {
+	local, ok := storage.Store.(*storage.LocalStorage)
+	if !ok {
+		return c.SendStatus(fiber.StatusNotFound)
+	}
+
+	path, err := local.Open(c.Query("key"), c.Query("expires"), c.Query("signature"))
+	if err != nil {
+		return sendError(c, err.Error(), fiber.StatusForbidden)
+	}
+
+	// the avatars are served by the same links, they are public anyway
+	if strings.HasPrefix(c.Query("key"), "avatars/") {
+		c.Set(fiber.HeaderContentType, "image/png")
+		return c.SendFile(path)
+	}
+
+	attachment := new(models.Attachment)
+	if res := h.db(c).Where("storage_key = ?", c.Query("key")).First(attachment); res.Error != nil {
+		// the archives of the data exports are served by the same links
+		export := new(models.DataExport)
+		if res := h.db(c).Where("storage_key = ?", c.Query("key")).First(export); res.Error != nil {
+			return sendError(c, "Cannot find the Attachment", fiber.StatusNotFound)
+		}
+		attachment.ContentType = "application/zip"
+		attachment.FileName = "export-" + export.CreatedAt.Format("2006-01-02") + ".zip"
+	}
+
+	c.Set(fiber.HeaderContentType, attachment.ContentType)
+	c.Attachment(attachment.FileName)
+	return c.SendFile(path)
+}
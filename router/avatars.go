@@ -0,0 +1,113 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/avatars"
+	"task-app/models"
+	"task-app/storage"
+	"time"
+)
+
+// avatarMaxAge is how long the clients cache the redirect to an avatar, it is shorter than its link
+const avatarMaxAge = 10 * time.Minute
+
+func (h *Handler) setupAvatarsRoutes() {
+	// the avatars are shown to the other users of the workspaces, so no SecureAuth
+	AVATARS.Get("/:id/:size", h.handleGetAvatar)
+}
+
+// UploadAvatar sets the image of the file as the avatar of the user signed in, resized to every size
+func (h *Handler) UploadAvatar(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return sendError(c, "File is required field", fiber.StatusBadRequest)
+	}
+	if fh.Size > storage.MaxUploadSize {
+		return sendError(c, errFileTooLarge.Error(), fiber.StatusRequestEntityTooLarge)
+	}
+	file, err := fh.Open()
+	if err != nil {
+		return sendError(c, errFileUnreadable.Error(), fiber.StatusBadRequest)
+	}
+	defer file.Close()
+
+	key, err := avatars.Store(u.ID, file)
+	switch {
+	case errors.Is(err, avatars.ErrFormat):
+		return sendError(c, err.Error(), fiber.StatusUnsupportedMediaType)
+	case errors.Is(err, avatars.ErrTooLarge):
+		return sendError(c, err.Error(), fiber.StatusRequestEntityTooLarge)
+	case err != nil:
+		return sendError(c, "Cannot save the avatar", fiber.StatusInternalServerError)
+	}
+
+	previous := u.AvatarKey
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"avatar_key": key}); err != nil {
+		avatars.Remove(key)
+		return sendError(c, "Cannot save the avatar", fiber.StatusInternalServerError)
+	}
+	u.AvatarKey = key
+	avatars.Remove(previous)
+
+	return c.Status(fiber.StatusOK).JSON(u.Api())
+}
+
+// DeleteAvatar deletes the avatar of the user signed in, the one of Gravatar is shown again
+func (h *Handler) DeleteAvatar(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	previous := u.AvatarKey
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"avatar_key": ""}); err != nil {
+		return sendError(c, "Cannot delete the avatar", fiber.StatusInternalServerError)
+	}
+	u.AvatarKey = ""
+	avatars.Remove(previous)
+
+	return c.Status(fiber.StatusOK).JSON(u.Api())
+}
+
+// handleGetAvatar redirects to the uploaded avatar of the user in the size, or to the one of Gravatar
+func (h *Handler) handleGetAvatar(c *fiber.Ctx) error {
+	id, err := strconv.ParseUint(c.Params("id"), 10, 64)
+	if err != nil {
+		return sendError(c, "Invalid user id", fiber.StatusBadRequest)
+	}
+	size, err := strconv.Atoi(c.Params("size"))
+	if err != nil || !validAvatarSize(size) {
+		return sendError(c, "Unknown avatar size", fiber.StatusNotFound)
+	}
+
+	u, err := h.userRepo(c).ByID(uint(id))
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+
+	url := u.AvatarURLs()[strconv.Itoa(size)]
+	if u.AvatarKey != "" {
+		if url, err = storage.Store.SignedURL(models.AvatarFile(u.AvatarKey, size), signedURLTTL); err != nil {
+			return sendError(c, "Cannot sign the avatar url", fiber.StatusInternalServerError)
+		}
+	}
+
+	c.Set(fiber.HeaderCacheControl, "public, max-age="+strconv.Itoa(int(avatarMaxAge.Seconds())))
+	return c.Redirect(url, fiber.StatusFound)
+}
+
+func validAvatarSize(size int) bool {
+	for _, s := range models.AvatarSizes {
+		if s == size {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,234 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"sort"
+	"strings"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/models"
+	"task-app/util"
+)
+
+var errMoveConflict = errors.New("The task was moved or deleted meanwhile")
+
+// handleGetBoard returns the tasks of the project grouped by status.
+// ?page= and ?limit= paginate every column, ?column= returns only the column of a status,
+// so a client can load the next page of one column.
+func (h *Handler) handleGetBoard(c *fiber.Ctx) error {
+	project, err := h.findProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+
+	counts, err := h.boardCounts(c, project)
+	if err != nil {
+		return sendError(c, "Cannot find the tasks of the project", fiber.StatusInternalServerError)
+	}
+
+	statuses := boardStatuses(counts)
+	if column := c.Query("column"); column != "" {
+		statuses = []string{column}
+	}
+
+	limit, offset := paginate(c)
+	board := models.BoardApi{Project: project.Api(), Columns: make([]models.BoardColumnApi, 0, len(statuses))}
+	for _, status := range statuses {
+		var tasks []models.Task
+		if err := h.columnQuery(c, project, status).
+			Scopes(models.TaskDetails).
+			Order("position, id").
+			Limit(limit).
+			Offset(offset).
+			Find(&tasks).Error; err != nil {
+			return sendError(c, "Cannot find the tasks of the project", fiber.StatusInternalServerError)
+		}
+		if err := models.CountComments(h.db(c), tasks); err != nil {
+			return sendError(c, "Cannot count the comments of the tasks", fiber.StatusInternalServerError)
+		}
+
+		column := models.BoardColumnApi{
+			Status:  status,
+			Count:   counts[status],
+			Tasks:   make([]models.TaskApi, 0, len(tasks)),
+			HasMore: int64(offset+len(tasks)) < counts[status],
+		}
+		for _, t := range tasks {
+			column.Tasks = append(column.Tasks, t.Api())
+		}
+		board.Columns = append(board.Columns, column)
+	}
+
+	return c.JSON(board)
+}
+
+// handleMoveCard moves a task of the project to an index of a column, changing its status
+// and its position in one transaction. The following tasks of the project are shifted down.
+func (h *Handler) handleMoveCard(c *fiber.Ctx) error {
+	var input models.BoardMoveInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+	input.Status = strings.TrimSpace(input.Status)
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	project, err := h.findWritableProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+
+	task, err := h.taskRepo(c).Get(u, input.TaskID, models.WorkspaceWriters...)
+	if err != nil || !sameID(task.ProjectID, &project.ID) {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	from := boardStatus(task.Status)
+	changes := map[string]events.Change{}
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		// the card at the index, the moved card takes its position
+		var positions []int
+		if err := tx.Model(&models.Task{}).
+			Scopes(projectTasks(project, input.Status)).
+			Where("id <> ?", task.ID).
+			Order("position, id").
+			Offset(input.Index).
+			Limit(1).
+			Pluck("position", &positions).Error; err != nil {
+			return err
+		}
+
+		position := 0
+		if len(positions) > 0 {
+			position = positions[0]
+		} else if err := tx.Model(&models.Task{}).
+			Where("project_id = ? AND id <> ?", project.ID, task.ID).
+			Select("COALESCE(MAX(position), 0) + 1").
+			Scan(&position).Error; err != nil {
+			return err
+		}
+
+		if err := tx.Model(&models.Task{}).
+			Where("project_id = ? AND position >= ? AND id <> ?", project.ID, position, task.ID).
+			UpdateColumn("position", gorm.Expr("position + 1")).Error; err != nil {
+			return err
+		}
+
+		if task.Position != position {
+			changes["position"] = events.Change{From: task.Position, To: position}
+		}
+		if task.Status != input.Status {
+			changes["status"] = events.Change{From: task.Status, To: input.Status}
+		}
+		task.SetStatus(input.Status)
+		task.Position = position
+
+		res := tx.Model(task).
+			Where("project_id = ?", project.ID).
+			UpdateColumns(map[string]interface{}{"status": task.Status, "position": position, "completed_at": task.CompletedAt, "version": gorm.Expr("version + 1")})
+		if res.Error != nil {
+			return res.Error
+		}
+		if res.RowsAffected == 0 {
+			return errMoveConflict
+		}
+		task.Version++
+
+		return nil
+	})
+	if errors.Is(err, errMoveConflict) {
+		return sendError(c, err.Error(), fiber.StatusConflict)
+	}
+	if err != nil {
+		return sendError(c, "Cannot move the task", fiber.StatusInternalServerError)
+	}
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+
+	if len(changes) > 0 {
+		updated := taskEvent(events.TaskUpdated, u, task, task.Api())
+		updated.Changes = changes
+		events.Publish(updated)
+	}
+	if from != models.StatusDone && input.Status == models.StatusDone {
+		publishTaskEvent(events.TaskCompleted, u, task, task.Api())
+	}
+
+	return c.JSON(task.Api())
+}
+
+// boardCounts counts the tasks of the project by column
+func (h *Handler) boardCounts(c *fiber.Ctx, project *models.Project) (map[string]int64, error) {
+	var rows []struct {
+		Status string
+		Count  int64
+	}
+	if err := h.db(c).Model(&models.Task{}).
+		Where("project_id = ? AND archived_at IS NULL", project.ID).
+		Select("status, count(*) AS count").
+		Group("status").
+		Scan(&rows).Error; err != nil {
+		return nil, err
+	}
+
+	counts := map[string]int64{}
+	for _, row := range rows {
+		counts[boardStatus(row.Status)] += row.Count
+	}
+
+	return counts, nil
+}
+
+// columnQuery returns the query of the tasks of a column of the project
+func (h *Handler) columnQuery(c *fiber.Ctx, project *models.Project, status string) *gorm.DB {
+	return h.db(c).Model(&models.Task{}).Scopes(projectTasks(project, status))
+}
+
+// projectTasks scopes a query to the tasks of a column of the project, the archived ones are not on the board
+func projectTasks(project *models.Project, status string) func(*gorm.DB) *gorm.DB {
+	return func(tx *gorm.DB) *gorm.DB {
+		tx = tx.Where("project_id = ? AND archived_at IS NULL", project.ID)
+		if status == models.StatusTodo {
+			return tx.Where("status IN ?", []string{models.StatusTodo, ""})
+		}
+		return tx.Where("status = ?", status)
+	}
+}
+
+// boardStatuses returns the columns of a board, the default ones first and then
+// the other statuses of the tasks by name
+func boardStatuses(counts map[string]int64) []string {
+	statuses := append([]string{}, models.BoardColumns...)
+
+	var others []string
+	for status := range counts {
+		if !containsString(models.BoardColumns, status) {
+			others = append(others, status)
+		}
+	}
+	sort.Strings(others)
+
+	return append(statuses, others...)
+}
+
+// boardStatus returns the column of a status, the tasks without a status are to do
+func boardStatus(status string) string {
+	if status == "" {
+		return models.StatusTodo
+	}
+	return status
+}
+
+func containsString(items []string, s string) bool {
+	for _, item := range items {
+		if item == s {
+			return true
+		}
+	}
+	return false
+}
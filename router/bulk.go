@@ -0,0 +1,156 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"task-app/cache"
+	"task-app/db"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/quota"
+	"task-app/repository"
+	"task-app/util"
+)
+
+// handleBulkTasks applies the operations of the body in one transaction, so a client syncing
+// its offline changes sends them in one request. Each operation runs in a savepoint: a failed
+// one is rolled back alone and the others are kept. The results are in the order of the operations.
+func (h *Handler) handleBulkTasks(c *fiber.Ctx) error {
+	input := new(models.BulkInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	results := make([]models.BulkResult, len(input.Operations))
+	var published []events.Event
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		for i, op := range input.Operations {
+			var evs []events.Event
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var err error
+				evs, err = h.applyBulkOperation(tx, u, op, &results[i])
+				return err
+			})
+
+			results[i].Index = i
+			if err != nil {
+				results[i].Status, results[i].Error = bulkError(c, err)
+				results[i].Task = nil
+				continue
+			}
+			published = append(published, evs...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return sendError(c, "Cannot apply the operations", fiber.StatusInternalServerError)
+	}
+
+	// the entries read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+	for _, e := range published {
+		events.Publish(e)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"results": results})
+}
+
+// applyBulkOperation applies an operation in the transaction and returns the events to
+// publish once it is committed
+func (h *Handler) applyBulkOperation(tx *gorm.DB, u *models.User, op models.BulkOperation, result *models.BulkResult) ([]events.Event, error) {
+	tasks := repository.NewTaskRepo(db.NewStore(tx))
+	task, err := tasks.Get(u, op.TaskID, models.WorkspaceWriters...)
+	if err != nil {
+		return nil, models.NewError(fiber.StatusNotFound, "Cannot find the Task")
+	}
+
+	var evs []events.Event
+	switch op.Op {
+	case models.BulkComplete:
+		if task.Status != models.StatusDone {
+			from := task.Status
+			task.SetStatus(models.StatusDone)
+			if err := tasks.Save(task); err != nil {
+				return nil, err
+			}
+
+			updated := taskEvent(events.TaskUpdated, u, task, task.Api())
+			updated.Changes = map[string]events.Change{"status": {From: from, To: task.Status}}
+			evs = append(evs, updated, taskEvent(events.TaskCompleted, u, task, task.Api()))
+		}
+
+	case models.BulkDelete:
+		if err := tasks.Delete(task); err != nil {
+			return nil, err
+		}
+		result.Status = fiber.StatusNoContent
+		return []events.Event{taskEvent(events.TaskDeleted, u, task, nil)}, nil
+
+	case models.BulkMove:
+		from, fromWorkspace := task.ProjectID, task.WorkspaceID
+		task.ProjectID, task.WorkspaceID, err = tasks.Placement(u, op.ProjectID, nil)
+		if errors.Is(err, errNoPermission) {
+			return nil, models.NewError(fiber.StatusForbidden, err.Error())
+		}
+		if err != nil {
+			return nil, models.NewError(fiber.StatusNotFound, "Cannot find the Project")
+		}
+		if err := h.quotas.Move(tx, fromWorkspace, task.WorkspaceID); err != nil {
+			return nil, err
+		}
+		if !sameID(from, task.ProjectID) {
+			if err := tasks.Save(task); err != nil {
+				return nil, err
+			}
+
+			updated := taskEvent(events.TaskUpdated, u, task, task.Api())
+			updated.Changes = map[string]events.Change{"projectId": {From: from, To: task.ProjectID}}
+			evs = append(evs, updated)
+		}
+
+	case models.BulkLabel:
+		label := new(models.Label)
+		if err := tx.Scopes(models.OwnedBy(u)).Where("id = ?", op.LabelID).First(label).Error; err != nil {
+			return nil, models.NewError(fiber.StatusNotFound, "Cannot find the Label")
+		}
+		if err := tx.Model(task).Association("Labels").Append(label); err != nil {
+			return nil, err
+		}
+		if err := models.TouchTasks(tx, task.ID); err != nil {
+			return nil, err
+		}
+		if err := tx.Model(task).Association("Labels").Find(&task.Labels); err != nil {
+			return nil, err
+		}
+	}
+
+	api := task.Api()
+	result.Status, result.Task = fiber.StatusOK, &api
+
+	return evs, nil
+}
+
+// bulkError returns the status and the message of a failed operation
+func bulkError(c *fiber.Ctx, err error) (int, string) {
+	var appErr *models.AppError
+	var exceeded *quota.ExceededError
+	switch {
+	case errors.As(err, &appErr):
+		return appErr.Status, appErr.Message
+	case errors.As(err, &exceeded):
+		return exceededError(exceeded).Status, exceeded.Error()
+	case errors.Is(err, repository.ErrConflict):
+		return fiber.StatusConflict, "The task was changed concurrently, try again"
+	}
+
+	logging.FromCtx(c).Error().Err(err).Msg("Bulk operation failed")
+	return fiber.StatusInternalServerError, "Something went wrong, please try again later"
+}
@@ -0,0 +1,668 @@
+package router
+
+import (
+	"encoding/xml"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"gorm.io/gorm"
+	"net/url"
+	"strconv"
+	"strings"
+	"task-app/cache"
+	"task-app/caldav"
+	"task-app/db"
+	"task-app/events"
+	"task-app/models"
+	"task-app/ratelimit"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+)
+
+// DAVPath is the path of the CalDAV server, a client is given the URL of the host and finds it
+// from /.well-known/caldav
+const DAVPath = "/dav"
+
+const davRoot = DAVPath + "/"
+
+// davPersonal is the calendar of the personal tasks, the one of a workspace is workspace-<id>
+const davPersonal = "personal"
+
+// davStatusCancelled is the status of the tasks a client cancelled
+const davStatusCancelled = "cancelled"
+
+// davMethods are the methods of WebDAV, which the router does not know
+var davMethods = map[string]bool{
+	"PROPFIND": true, "PROPPATCH": true, "REPORT": true, "MKCOL": true, "MKCALENDAR": true,
+	"COPY": true, "MOVE": true, "LOCK": true, "UNLOCK": true,
+}
+
+var (
+	davDAV      = func(local string) xml.Name { return caldav.Name(caldav.NamespaceDAV, local) }
+	davCalDAV   = func(local string) xml.Name { return caldav.Name(caldav.NamespaceCalDAV, local) }
+	davCTag     = caldav.Name(caldav.NamespaceCalendarServer, "getctag")
+	davTodoType = "text/calendar; charset=utf-8; component=vtodo"
+)
+
+// davCalendar is a calendar of the CalDAV server: the personal tasks of the user, or the tasks
+// of a workspace of the user
+type davCalendar struct {
+	name        string
+	title       string
+	workspaceID *uint
+	// writable tells whether the user can change the tasks of the calendar
+	writable bool
+}
+
+func (cal *davCalendar) href() string {
+	return davRoot + "calendars/" + cal.name + "/"
+}
+
+// setupCalDAVRoutes serves the tasks as the VTODO of CalDAV calendars, to the clients
+// authenticated with an API key as the password of the user
+func (h *Handler) setupCalDAVRoutes(app *fiber.App) {
+	app.Server().Handler = allowDAVMethods(app.Server().Handler)
+
+	app.All("/.well-known/caldav", func(c *fiber.Ctx) error {
+		return c.Redirect(davRoot, fiber.StatusMovedPermanently)
+	})
+
+	dav := app.Group(DAVPath)
+	dav.Options("/*", handleDAVOptions)
+	dav.Use(ratelimit.Limit("caldav", 600, time.Minute), h.tokens.BasicAuth("Tasks"))
+	// the methods of WebDAV are POST for the router, see allowDAVMethods
+	dav.Post("/*", h.handleDAV)
+	dav.Get("/calendars/:calendar/:object", h.handleGetDAVObject)
+	dav.Put("/calendars/:calendar/:object", h.handlePutDAVObject)
+	dav.Delete("/calendars/:calendar/:object", h.handleDeleteDAVObject)
+}
+
+// allowDAVMethods gives the router the requests of the CalDAV server with a method of WebDAV as
+// POST, with the method they were sent with as the local util.MethodKey
+func allowDAVMethods(next fasthttp.RequestHandler) fasthttp.RequestHandler {
+	return func(ctx *fasthttp.RequestCtx) {
+		method := string(ctx.Method())
+		path := string(ctx.Path())
+		if davMethods[method] && (path == DAVPath || strings.HasPrefix(path, davRoot) || path == "/.well-known/caldav") {
+			ctx.SetUserValue(util.MethodKey, method)
+			ctx.Request.Header.SetMethod(fiber.MethodPost)
+		}
+
+		next(ctx)
+	}
+}
+
+func handleDAVOptions(c *fiber.Ctx) error {
+	c.Set("DAV", "1, 3, calendar-access")
+	c.Set(fiber.HeaderAllow, "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+	return c.SendStatus(fiber.StatusOK)
+}
+
+// handleDAV answers the PROPFIND and the REPORT of the resources, the other methods of WebDAV
+// are not allowed: the calendars are the personal tasks and the workspaces
+func (h *Handler) handleDAV(c *fiber.Ctx) error {
+	method := util.Method(c)
+	if method != "PROPFIND" && method != "REPORT" {
+		c.Set(fiber.HeaderAllow, "OPTIONS, GET, HEAD, PUT, DELETE, PROPFIND, REPORT")
+		return sendError(c, "The method "+method+" is not allowed", fiber.StatusMethodNotAllowed)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	req, err := caldav.ParseRequest(c.Body())
+	if err != nil {
+		return sendError(c, err.Error(), fiber.StatusBadRequest)
+	}
+
+	segments := strings.Split(strings.Trim(strings.TrimPrefix(c.Path(), DAVPath), "/"), "/")
+	if segments[0] == "" {
+		segments = nil
+	}
+	// a depth of infinity is answered as 1, the calendars hold no collection
+	depth := c.Get("Depth", "1") != "0"
+
+	ms := new(caldav.Multistatus)
+	switch {
+	case method == "REPORT" && len(segments) == 2 && segments[0] == "calendars":
+		if err := h.davReport(c, u, segments[1], req, ms); err != nil {
+			return err
+		}
+	case method == "REPORT":
+		return sendError(c, "The reports are made on a calendar", fiber.StatusForbidden)
+	case len(segments) == 0:
+		ms.Add(caldav.Response{Href: davRoot, Props: davCollectionProps("Tasks", davDAV("collection"))})
+	case len(segments) == 1 && segments[0] == "principal":
+		ms.Add(caldav.Response{Href: davRoot + "principal/", Props: davPrincipalProps(u)})
+	case len(segments) == 1 && segments[0] == "calendars":
+		ms.Add(caldav.Response{Href: davRoot + "calendars/", Props: davCollectionProps("Calendars", davDAV("collection"))})
+		if depth {
+			calendars, err := h.davCalendars(c, u)
+			if err != nil {
+				return sendError(c, "Cannot find the calendars", fiber.StatusInternalServerError)
+			}
+			for i := range calendars {
+				if err := h.davAddCalendar(c, u, &calendars[i], ms); err != nil {
+					return err
+				}
+			}
+		}
+	case len(segments) == 2 && segments[0] == "calendars":
+		cal, err := h.davCalendar(c, u, segments[1])
+		if err != nil {
+			return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+		}
+		if err := h.davAddCalendar(c, u, cal, ms); err != nil {
+			return err
+		}
+		if depth {
+			tasks, names, err := h.davTasks(c, u, cal)
+			if err != nil {
+				return sendError(c, "Cannot find the tasks of the calendar", fiber.StatusInternalServerError)
+			}
+			for i := range tasks {
+				ms.Add(caldav.Response{Href: cal.href() + url.PathEscape(names[tasks[i].ID].Name), Props: h.davTaskProps(c, u, &tasks[i], names[tasks[i].ID], req)})
+			}
+		}
+	case len(segments) == 3 && segments[0] == "calendars":
+		cal, err := h.davCalendar(c, u, segments[1])
+		if err != nil {
+			return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+		}
+		task, object, err := h.findDAVTask(c, u, cal, segments[2])
+		if err != nil {
+			return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+		}
+		ms.Add(caldav.Response{Href: cal.href() + url.PathEscape(object.Name), Props: h.davTaskProps(c, u, task, *object, req)})
+	default:
+		return sendError(c, "Not Found", fiber.StatusNotFound)
+	}
+
+	return sendMultistatus(c, ms, req)
+}
+
+// davReport answers a calendar-query, every VTODO of the calendar as the time ranges are not
+// filtered, and a calendar-multiget
+func (h *Handler) davReport(c *fiber.Ctx, u *models.User, name string, req *caldav.Request, ms *caldav.Multistatus) error {
+	cal, err := h.davCalendar(c, u, name)
+	if err != nil {
+		return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+	}
+
+	switch req.Kind {
+	case davCalDAV(caldav.ReportCalendarQuery):
+		if !req.Todos() {
+			return nil
+		}
+		tasks, names, err := h.davTasks(c, u, cal)
+		if err != nil {
+			return sendError(c, "Cannot find the tasks of the calendar", fiber.StatusInternalServerError)
+		}
+		for i := range tasks {
+			ms.Add(caldav.Response{Href: cal.href() + url.PathEscape(names[tasks[i].ID].Name), Props: h.davTaskProps(c, u, &tasks[i], names[tasks[i].ID], req)})
+		}
+	case davCalDAV(caldav.ReportCalendarMultiget):
+		for _, href := range req.Hrefs {
+			path := href
+			if parsed, err := url.Parse(href); err == nil {
+				path = parsed.EscapedPath()
+			}
+			task, object, err := h.findDAVTask(c, u, cal, strings.TrimPrefix(path, cal.href()))
+			if err != nil || !strings.HasPrefix(path, cal.href()) {
+				ms.Add(caldav.Response{Href: href, Status: fiber.StatusNotFound})
+				continue
+			}
+			ms.Add(caldav.Response{Href: href, Props: h.davTaskProps(c, u, task, *object, req)})
+		}
+	default:
+		return sendError(c, "The report "+req.Kind.Local+" is not supported", fiber.StatusForbidden)
+	}
+
+	return nil
+}
+
+func sendMultistatus(c *fiber.Ctx, ms *caldav.Multistatus, req *caldav.Request) error {
+	c.Set(fiber.HeaderContentType, "application/xml; charset=utf-8")
+	return c.Status(fiber.StatusMultiStatus).SendString(ms.Encode(req))
+}
+
+func davCollectionProps(title string, types ...xml.Name) caldav.Props {
+	var resourceType strings.Builder
+	for _, t := range types {
+		resourceType.WriteString(davElement(t))
+	}
+
+	var props caldav.Props
+	props.Add(davDAV("resourcetype"), resourceType.String())
+	props.Text(davDAV("displayname"), title)
+	props.Add(davDAV("current-user-principal"), caldav.Href(davRoot+"principal/"))
+	return props
+}
+
+func davPrincipalProps(u *models.User) caldav.Props {
+	title := u.DisplayName
+	if title == "" {
+		title = u.Username
+	}
+
+	props := davCollectionProps(title, davDAV("collection"), davDAV("principal"))
+	props.Add(davDAV("principal-URL"), caldav.Href(davRoot+"principal/"))
+	props.Add(davCalDAV("calendar-home-set"), caldav.Href(davRoot+"calendars/"))
+	props.Add(davCalDAV("calendar-user-address-set"), caldav.Href("mailto:"+u.Email))
+	return props
+}
+
+// davAddCalendar adds the properties of the calendar, its ctag changes with any of its tasks
+func (h *Handler) davAddCalendar(c *fiber.Ctx, u *models.User, cal *davCalendar, ms *caldav.Multistatus) error {
+	tasks, _, err := h.davTasks(c, u, cal)
+	if err != nil {
+		return sendError(c, "Cannot find the tasks of the calendar", fiber.StatusInternalServerError)
+	}
+
+	privileges := davPrivilege("read")
+	if cal.writable {
+		privileges += davPrivilege("write") + davPrivilege("write-content") + davPrivilege("bind") + davPrivilege("unbind")
+	}
+
+	props := davCollectionProps(cal.title, davDAV("collection"), davCalDAV("calendar"))
+	props.Add(davCalDAV("supported-calendar-component-set"), `<c:comp name="VTODO"/>`)
+	props.Add(davDAV("supported-report-set"), davReportElement(caldav.ReportCalendarQuery)+davReportElement(caldav.ReportCalendarMultiget))
+	props.Add(davDAV("current-user-privilege-set"), privileges)
+	props.Text(davCTag, opaqueTag(tasksETag(tasks)))
+	ms.Add(caldav.Response{Href: cal.href(), Props: props})
+
+	return nil
+}
+
+func davElement(name xml.Name) string {
+	prefix := "d:"
+	if name.Space == caldav.NamespaceCalDAV {
+		prefix = "c:"
+	}
+	return "<" + prefix + name.Local + "/>"
+}
+
+func davPrivilege(name string) string {
+	return "<d:privilege><d:" + name + "/></d:privilege>"
+}
+
+func davReportElement(name string) string {
+	return "<d:supported-report><d:report><c:" + name + "/></d:report></d:supported-report>"
+}
+
+// davTaskProps returns the properties of the object of a task, its calendar-data only when it is asked
+func (h *Handler) davTaskProps(c *fiber.Ctx, u *models.User, t *models.Task, object models.CalendarObject, req *caldav.Request) caldav.Props {
+	var props caldav.Props
+	props.Add(davDAV("resourcetype"), "")
+	props.Text(davDAV("getetag"), davETag(t))
+	props.Text(davDAV("getcontenttype"), davTodoType)
+	if !req.AllProp && req.Wants(davCalDAV("calendar-data")) {
+		props.Text(davCalDAV("calendar-data"), taskTodo(t, object).Calendar(u.Location()))
+	}
+
+	return props
+}
+
+// davCalendars returns the personal calendar and the ones of the workspaces of the user, by name
+func (h *Handler) davCalendars(c *fiber.Ctx, u *models.User) ([]davCalendar, error) {
+	var memberships []models.Membership
+	if err := h.db(c).Where("user_id = ?", u.ID).Find(&memberships).Error; err != nil {
+		return nil, err
+	}
+	roles := make(map[uint]string, len(memberships))
+	ids := make([]uint, 0, len(memberships))
+	for _, m := range memberships {
+		roles[m.WorkspaceID] = m.Role
+		ids = append(ids, m.WorkspaceID)
+	}
+
+	calendars := []davCalendar{{name: davPersonal, title: "Personal", writable: true}}
+	var workspaces []models.Workspace
+	if len(ids) > 0 {
+		if err := h.db(c).Where("id IN ?", ids).Order("name").Find(&workspaces).Error; err != nil {
+			return nil, err
+		}
+	}
+	for _, w := range workspaces {
+		id := w.ID
+		calendars = append(calendars, davCalendar{
+			name:        fmt.Sprintf("workspace-%d", w.ID),
+			title:       w.Name,
+			workspaceID: &id,
+			writable:    roles[w.ID] == models.WorkspaceOwner || roles[w.ID] == models.WorkspaceMember,
+		})
+	}
+
+	return calendars, nil
+}
+
+func (h *Handler) davCalendar(c *fiber.Ctx, u *models.User, name string) (*davCalendar, error) {
+	calendars, err := h.davCalendars(c, u)
+	if err != nil {
+		return nil, err
+	}
+	for i := range calendars {
+		if calendars[i].name == name {
+			return &calendars[i], nil
+		}
+	}
+
+	return nil, repository.ErrNotFound
+}
+
+// davTasks returns the tasks of the calendar with their objects, by id
+func (h *Handler) davTasks(c *fiber.Ctx, u *models.User, cal *davCalendar) ([]models.Task, map[uint]models.CalendarObject, error) {
+	listed, err := h.taskRepo(c).List(u, repository.TaskFilter{WorkspaceID: cal.workspaceID})
+	if err != nil {
+		return nil, nil, err
+	}
+
+	tasks := make([]models.Task, 0, len(listed))
+	ids := make([]uint, 0, len(listed))
+	for _, t := range listed {
+		if sameID(t.WorkspaceID, cal.workspaceID) {
+			tasks = append(tasks, t)
+			ids = append(ids, t.ID)
+		}
+	}
+
+	names := make(map[uint]models.CalendarObject, len(tasks))
+	var objects []models.CalendarObject
+	if len(ids) > 0 {
+		if err := h.db(c).Where("task_id IN ?", ids).Find(&objects).Error; err != nil {
+			return nil, nil, err
+		}
+	}
+	for _, o := range objects {
+		names[o.TaskID] = o
+	}
+	for _, t := range tasks {
+		if _, ok := names[t.ID]; !ok {
+			names[t.ID] = models.CalendarObject{TaskID: t.ID, Name: fmt.Sprintf("task-%d.ics", t.ID), UID: fmt.Sprintf("task-%d@%s", t.ID, c.Hostname())}
+		}
+	}
+
+	return tasks, names, nil
+}
+
+// findDAVTask finds the task of an object of the calendar by the name a client gave it, or as
+// task-<id>.ics. The name is escaped as in the URL.
+func (h *Handler) findDAVTask(c *fiber.Ctx, u *models.User, cal *davCalendar, escaped string) (*models.Task, *models.CalendarObject, error) {
+	name, err := url.PathUnescape(escaped)
+	if err != nil || name == "" {
+		return nil, nil, repository.ErrNotFound
+	}
+
+	var objects []models.CalendarObject
+	if err := h.db(c).Where("name = ?", name).Find(&objects).Error; err != nil {
+		return nil, nil, err
+	}
+	for i := range objects {
+		task, err := h.taskRepo(c).Get(u, objects[i].TaskID)
+		if err == nil && sameID(task.WorkspaceID, cal.workspaceID) {
+			return task, &objects[i], nil
+		}
+	}
+
+	id, err := strconv.ParseUint(strings.TrimSuffix(strings.TrimPrefix(name, "task-"), ".ics"), 10, 0)
+	if err != nil || fmt.Sprintf("task-%d.ics", id) != name {
+		return nil, nil, repository.ErrNotFound
+	}
+	task, err := h.taskRepo(c).Get(u, uint(id))
+	if err != nil || !sameID(task.WorkspaceID, cal.workspaceID) {
+		return nil, nil, repository.ErrNotFound
+	}
+	// a task created by a client keeps the name the client gave it
+	if h.db(c).Where("task_id = ?", task.ID).First(new(models.CalendarObject)).Error == nil {
+		return nil, nil, repository.ErrNotFound
+	}
+
+	return task, &models.CalendarObject{TaskID: task.ID, Name: name, UID: fmt.Sprintf("task-%d@%s", task.ID, c.Hostname())}, nil
+}
+
+// handleGetDAVObject sends the VCALENDAR of a task
+func (h *Handler) handleGetDAVObject(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	cal, err := h.davCalendar(c, u, c.Params("calendar"))
+	if err != nil {
+		return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+	}
+	task, object, err := h.findDAVTask(c, u, cal, c.Params("object"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	if notModified(c, davETag(task)) {
+		return sendNotModified(c)
+	}
+	c.Set(fiber.HeaderContentType, davTodoType)
+	return c.SendString(taskTodo(task, *object).Calendar(u.Location()))
+}
+
+// handlePutDAVObject creates a task from the VTODO of a client, or replaces the fields of the task
+// of the object. If-Match and If-None-Match: * are the ETag of the task, as by the other updates.
+func (h *Handler) handlePutDAVObject(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	cal, err := h.davCalendar(c, u, c.Params("calendar"))
+	if err != nil {
+		return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+	}
+	if !cal.writable {
+		return sendError(c, "The calendar is read only", fiber.StatusForbidden)
+	}
+
+	todo, err := caldav.ParseTodo(string(c.Body()), u.Location())
+	if errors.Is(err, caldav.ErrNoTodo) {
+		return sendError(c, "The calendars have only VTODO", fiber.StatusForbidden)
+	}
+	if err != nil {
+		return sendError(c, err.Error(), fiber.StatusBadRequest)
+	}
+
+	task, _, err := h.findDAVTask(c, u, cal, c.Params("object"))
+	if err != nil {
+		return h.createDAVTask(c, u, cal, todo)
+	}
+	if c.Get(fiber.HeaderIfNoneMatch) == "*" {
+		return sendError(c, "The object already exists", fiber.StatusPreconditionFailed)
+	}
+	if err := checkIfMatch(c, davETag(task)); err != nil {
+		return err
+	}
+
+	input := todoInput(todo, task)
+	if fields := util.Validate(&input); fields != nil {
+		return models.ValidationError(fields)
+	}
+	completed := task.Status != models.StatusDone && input.Status == models.StatusDone
+	changes := taskChanges(task, &input)
+	if len(changes) == 0 {
+		c.Set(fiber.HeaderETag, davETag(task))
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+	task.Apply(&input)
+
+	if err := h.taskRepo(c).Save(task); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			return sendError(c, "The task was changed concurrently, read it again", fiber.StatusPreconditionFailed)
+		}
+		return sendError(c, "Cannot update the task", fiber.StatusInternalServerError)
+	}
+
+	updated := taskEvent(events.TaskUpdated, u, task, task.Api())
+	updated.Changes = changes
+	events.Publish(updated)
+	if completed {
+		publishTaskEvent(events.TaskCompleted, u, task, task.Api())
+	}
+
+	c.Set(fiber.HeaderETag, davETag(task))
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// createDAVTask creates the task of a new object with the name and the UID the client gave it
+func (h *Handler) createDAVTask(c *fiber.Ctx, u *models.User, cal *davCalendar, todo *caldav.Todo) error {
+	if c.Get(fiber.HeaderIfMatch) != "" {
+		return sendError(c, "Cannot find the Task", fiber.StatusPreconditionFailed)
+	}
+	name, err := url.PathUnescape(c.Params("object"))
+	if err != nil || len(name) > 255 {
+		return sendError(c, "Invalid object name", fiber.StatusBadRequest)
+	}
+
+	input := todoInput(todo, nil)
+	if fields := util.Validate(&input); fields != nil {
+		return models.ValidationError(fields)
+	}
+
+	task := models.Task{UserID: u.ID}
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		tasks := repository.NewTaskRepo(db.NewStore(tx))
+		_, workspaceID, err := tasks.Placement(u, nil, cal.workspaceID)
+		if err != nil {
+			return workspaceError(err)
+		}
+
+		task.WorkspaceID = workspaceID
+		task.Apply(&input)
+		if err := tasks.Create(&task); err != nil {
+			return err
+		}
+
+		return tx.Create(&models.CalendarObject{TaskID: task.ID, Name: name, UID: todo.UID}).Error
+	})
+	if qerr := quotaError(err); qerr != nil {
+		return qerr
+	}
+	var appErr *models.AppError
+	if errors.As(err, &appErr) {
+		return appErr
+	}
+	if err != nil {
+		return sendError(c, "Cannot create task "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+	publishTaskEvent(events.TaskCreated, u, &task, task.Api())
+
+	c.Set(fiber.HeaderETag, davETag(&task))
+	return c.SendStatus(fiber.StatusCreated)
+}
+
+// handleDeleteDAVObject moves the task of the object to the trash
+func (h *Handler) handleDeleteDAVObject(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	cal, err := h.davCalendar(c, u, c.Params("calendar"))
+	if err != nil {
+		return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+	}
+	if !cal.writable {
+		return sendError(c, "The calendar is read only", fiber.StatusForbidden)
+	}
+	task, _, err := h.findDAVTask(c, u, cal, c.Params("object"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+	if err := checkIfMatch(c, davETag(task)); err != nil {
+		return err
+	}
+
+	if err := h.taskRepo(c).Delete(task); err != nil {
+		return sendError(c, "Cannot delete the task", fiber.StatusInternalServerError)
+	}
+	publishTaskEvent(events.TaskDeleted, u, task, nil)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// davETag is the ETag of the VCALENDAR of a task. It is strong, as CalDAV asks, and changes
+// with the task as its weak ETag does, the VCALENDAR being made of the same fields.
+func davETag(t *models.Task) string {
+	return opaqueTag(taskETag(t))
+}
+
+// taskTodo returns the VTODO of a task: its status, its priority of 1, 5 or 9 for P1 to P3 and
+// none for P4, its due date and recurrence, and its labels as categories
+func taskTodo(t *models.Task, object models.CalendarObject) *caldav.Todo {
+	todo := &caldav.Todo{
+		UID:         object.UID,
+		Summary:     t.Title,
+		Description: t.Description,
+		Status:      caldav.StatusNeedsAction,
+		Due:         t.DueAt,
+		RRule:       t.Recurrence,
+		Created:     t.CreatedAt,
+		Modified:    t.UpdatedAt,
+	}
+	switch t.Status {
+	case models.StatusDone:
+		todo.Status, todo.Completed = caldav.StatusCompleted, t.CompletedAt
+	case models.StatusInProgress:
+		todo.Status = caldav.StatusInProcess
+	case davStatusCancelled:
+		todo.Status = caldav.StatusCancelled
+	}
+	switch t.Priority {
+	case models.PriorityP1:
+		todo.Priority = 1
+	case models.PriorityP2:
+		todo.Priority = 5
+	case models.PriorityP3:
+		todo.Priority = 9
+	}
+	for _, l := range t.Labels {
+		todo.Categories = append(todo.Categories, l.Name)
+	}
+
+	return todo
+}
+
+// todoInput returns the fields of the task of a VTODO, the statuses of the board which are not
+// ones of VTODO are kept while the task is to do. The categories are not read, the labels
+// are changed in the app.
+func todoInput(todo *caldav.Todo, task *models.Task) models.TaskInput {
+	input := models.TaskInput{
+		Title:       strings.TrimSpace(todo.Summary),
+		Description: todo.Description,
+		DueAt:       todo.Due,
+		Recurrence:  todo.RRule,
+		Priority:    models.PriorityP4,
+	}
+
+	switch {
+	case todo.Status == caldav.StatusCompleted || todo.Status == "" && todo.Completed != nil:
+		input.Status = models.StatusDone
+	case todo.Status == caldav.StatusInProcess:
+		input.Status = models.StatusInProgress
+	case todo.Status == caldav.StatusCancelled:
+		input.Status = davStatusCancelled
+	case task != nil && task.Status != models.StatusDone && task.Status != models.StatusInProgress && task.Status != davStatusCancelled:
+		input.Status = task.Status
+	case task != nil:
+		input.Status = models.StatusTodo
+	}
+
+	switch {
+	case todo.Priority >= 1 && todo.Priority <= 4:
+		input.Priority = models.PriorityP1
+	case todo.Priority == 5:
+		input.Priority = models.PriorityP2
+	case todo.Priority >= 6:
+		input.Priority = models.PriorityP3
+	}
+
+	return input
+}
@@ -0,0 +1,108 @@
+package router
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"task-app/caldav"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+const icalTimeFormat = "20060102T150405Z"
+
+// calendarEventLength is the duration of the event of a task, ending at the due date
+const calendarEventLength = 30 * time.Minute
+
+func (h *Handler) setupCalendarRoutes() {
+	// the feed is fetched by calendar apps, the secret in the URL is the only authentication
+	CALENDAR.Get("/:token.ics", h.handleCalendarFeed)
+}
+
+// CreateCalendarFeed creates a secret calendar feed URL for the user signed in.
+// A new URL replaces the previous one, so a leaked URL can be revoked.
+func (h *Handler) CreateCalendarFeed(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	token := util.RandomToken(32)
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"calendar_token": util.HashToken(token)}); err != nil {
+		return sendError(c, "Cannot create calendar feed "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"url": c.BaseURL() + "/api/v1/calendar/" + token + ".ics"})
+}
+
+// DeleteCalendarFeed disables the calendar feed URL of the user signed in
+func (h *Handler) DeleteCalendarFeed(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"calendar_token": ""}); err != nil {
+		return sendError(c, "Cannot delete calendar feed "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleCalendarFeed sends the tasks of the user with a due date as an iCalendar.
+// Open tasks and recurring tasks are included, recurring tasks repeat with their RRULE.
+func (h *Handler) handleCalendarFeed(c *fiber.Ctx) error {
+	token := c.Params("token")
+	if token == "" {
+		return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+	}
+
+	u, err := h.userRepo(c).ByCalendarToken(util.HashToken(token))
+	if err != nil || u.Locked {
+		return sendError(c, "Cannot find the calendar", fiber.StatusNotFound)
+	}
+
+	tasks, err := h.taskRepo(c).Due(u)
+	if err != nil {
+		return sendError(c, "Cannot find user's tasks", fiber.StatusInternalServerError)
+	}
+
+	c.Set(fiber.HeaderContentType, "text/calendar; charset=utf-8")
+	c.Set(fiber.HeaderContentDisposition, `inline; filename="tasks.ics"`)
+	return c.SendString(buildCalendar(c.Hostname(), tasks))
+}
+
+func buildCalendar(host string, tasks []models.Task) string {
+	var b strings.Builder
+	line := func(format string, a ...interface{}) {
+		b.WriteString(caldav.FoldLine(fmt.Sprintf(format, a...)))
+	}
+
+	line("BEGIN:VCALENDAR")
+	line("VERSION:2.0")
+	line("PRODID:-//Tasker//Tasks//EN")
+	line("CALSCALE:GREGORIAN")
+	line("METHOD:PUBLISH")
+	line("X-WR-CALNAME:Tasks")
+
+	for _, t := range tasks {
+		due := t.DueAt.UTC()
+		line("BEGIN:VEVENT")
+		line("UID:task-%d@%s", t.ID, host)
+		line("DTSTAMP:%s", t.UpdatedAt.UTC().Format(icalTimeFormat))
+		line("DTSTART:%s", due.Add(-calendarEventLength).Format(icalTimeFormat))
+		line("DTEND:%s", due.Format(icalTimeFormat))
+		line("SUMMARY:%s", caldav.EscapeText(t.Title))
+		if t.Description != "" {
+			line("DESCRIPTION:%s", caldav.EscapeText(t.Description))
+		}
+		if t.Recurrence != "" {
+			line("RRULE:%s", t.Recurrence)
+		}
+		line("END:VEVENT")
+	}
+
+	line("END:VCALENDAR")
+	return b.String()
+}
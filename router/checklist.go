@@ -0,0 +1,199 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/models"
+	"task-app/util"
+)
+
+func (h *Handler) handleGetChecklist(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	return c.JSON(checklistResponse(task))
+}
+
+// handleAddChecklistItem adds an item at the end of the checklist of the task
+func (h *Handler) handleAddChecklistItem(c *fiber.Ctx) error {
+	var input models.ChecklistItemInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	item := models.ChecklistItem{TaskID: task.ID, Text: input.Text, Position: 1}
+	if input.Done != nil {
+		item.Done = *input.Done
+	}
+	for _, i := range task.Checklist {
+		if i.Position >= item.Position {
+			item.Position = i.Position + 1
+		}
+	}
+
+	if res := h.db(c).Create(&item); res.Error != nil {
+		return sendError(c, "Cannot add the item "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+	task.Checklist = append(task.Checklist, item)
+
+	return h.checklistChanged(c, task)
+}
+
+// handleUpdateChecklistItem changes the text of an item, and its state when done is given
+func (h *Handler) handleUpdateChecklistItem(c *fiber.Ctx) error {
+	var input models.ChecklistItemInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	task, item, err := h.findChecklistItem(c)
+	if err != nil {
+		return err
+	}
+
+	item.Text = input.Text
+	if input.Done != nil {
+		item.Done = *input.Done
+	}
+	if res := h.db(c).Model(item).Select("text", "done").Updates(item); res.Error != nil {
+		return sendError(c, "Cannot update the item "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return h.checklistChanged(c, task)
+}
+
+// handleToggleChecklistItem checks an item, or unchecks it when it is done
+func (h *Handler) handleToggleChecklistItem(c *fiber.Ctx) error {
+	task, item, err := h.findChecklistItem(c)
+	if err != nil {
+		return err
+	}
+
+	item.Done = !item.Done
+	if res := h.db(c).Model(item).Update("done", item.Done); res.Error != nil {
+		return sendError(c, "Cannot update the item "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return h.checklistChanged(c, task)
+}
+
+func (h *Handler) handleDeleteChecklistItem(c *fiber.Ctx) error {
+	task, item, err := h.findChecklistItem(c)
+	if err != nil {
+		return err
+	}
+
+	if res := h.db(c).Delete(item); res.Error != nil {
+		return sendError(c, "Cannot delete the item "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	checklist := task.Checklist[:0]
+	for _, i := range task.Checklist {
+		if i.ID != item.ID {
+			checklist = append(checklist, i)
+		}
+	}
+	task.Checklist = checklist
+
+	return h.checklistChanged(c, task)
+}
+
+// handleReorderChecklist orders the checklist of the task as the ids, which must be all its items
+func (h *Handler) handleReorderChecklist(c *fiber.Ctx) error {
+	var input models.ReorderInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	items := make(map[uint]models.ChecklistItem, len(task.Checklist))
+	for _, i := range task.Checklist {
+		items[i.ID] = i
+	}
+	if len(input.IDs) != len(items) {
+		return sendError(c, "The ids must be the ones of every item of the checklist", fiber.StatusUnprocessableEntity)
+	}
+
+	checklist := make([]models.ChecklistItem, 0, len(input.IDs))
+	for i, id := range input.IDs {
+		item, ok := items[id]
+		if !ok {
+			return sendError(c, "Cannot find the item", fiber.StatusNotFound)
+		}
+		item.Position = i + 1
+		checklist = append(checklist, item)
+	}
+
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		for i := range checklist {
+			if err := tx.Model(&checklist[i]).UpdateColumn("position", checklist[i].Position).Error; err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	if err != nil {
+		return sendError(c, "Cannot reorder the checklist", fiber.StatusInternalServerError)
+	}
+	task.Checklist = checklist
+
+	return h.checklistChanged(c, task)
+}
+
+// findChecklistItem returns a task the user can change and an item of its checklist
+func (h *Handler) findChecklistItem(c *fiber.Ctx) (*models.Task, *models.ChecklistItem, error) {
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return nil, nil, sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	itemID, err := c.ParamsInt("itemId")
+	if err == nil {
+		for i := range task.Checklist {
+			if task.Checklist[i].ID == uint(itemID) {
+				return task, &task.Checklist[i], nil
+			}
+		}
+	}
+
+	return nil, nil, sendError(c, "Cannot find the item", fiber.StatusNotFound)
+}
+
+// checklistChanged tells the watchers about the new checklist of the task and sends it
+func (h *Handler) checklistChanged(c *fiber.Ctx, task *models.Task) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	if err := models.TouchTasks(h.db(c), task.ID); err != nil {
+		return sendError(c, "Cannot update the task", fiber.StatusInternalServerError)
+	}
+	// the lists carry the checklists of their tasks
+	h.cache.Forget(cache.Tasks)
+
+	publishTaskEvent(events.TaskUpdated, u, task, task.Api())
+
+	return c.JSON(checklistResponse(task))
+}
+
+func checklistResponse(task *models.Task) fiber.Map {
+	items := make([]models.ChecklistItemApi, 0, len(task.Checklist))
+	for _, i := range task.Checklist {
+		items = append(items, i.Api())
+	}
+
+	return fiber.Map{"items": items, "progress": models.Progress(task.Checklist)}
+}
@@ -0,0 +1,120 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/models"
+	"task-app/util"
+)
+
+func (h *Handler) handleGetComments(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	var comments []models.Comment
+	result := h.db(c).Where("task_id = ?", task.ID).
+		Preload("User").
+		Preload("Mentions").
+		Order("created_at").
+		Find(&comments)
+
+	if result.Error != nil {
+		return sendError(c, "Cannot find task's comments", fiber.StatusForbidden)
+	}
+
+	response := make([]models.CommentApi, 0, len(comments))
+	for _, cm := range comments {
+		response = append(response, cm.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleCreateComment(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	var input models.CommentApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Body = strings.TrimSpace(input.Body); input.Body == "" {
+		return sendError(c, "Comment body is required field", fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	// unknown usernames are kept in the text but not stored as references
+	var mentioned []models.User
+	if names := util.ParseMentions(input.Body); len(names) > 0 {
+		mentioned, _ = h.userRepo(c).ByUsernames(names)
+	}
+
+	comment := models.Comment{
+		TaskID:   task.ID,
+		UserID:   u.ID,
+		Body:     input.Body,
+		User:     *u,
+		Mentions: mentioned,
+	}
+
+	if res := h.db(c).Omit("User", "Mentions.*").Create(&comment); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+	// the lists carry the comment counts of their tasks
+	h.cache.Forget(cache.Tasks)
+
+	e := taskEvent(events.CommentAdded, u, task, comment.Api())
+	e.TargetID = comment.ID
+	events.Publish(e)
+
+	return c.Status(fiber.StatusOK).JSON(comment.Api())
+}
+
+func (h *Handler) handleDeleteComment(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	comment := new(models.Comment)
+	result := h.db(c).Where(
+		"id = ? AND task_id = ? AND user_id = ?", c.Params("commentId"), task.ID, u.ID,
+	).First(comment)
+
+	if result.Error != nil {
+		return sendError(c, "Cannot find the Comment", fiber.StatusNotFound)
+	}
+
+	if err := h.db(c).Model(comment).Association("Mentions").Clear(); err != nil {
+		return sendError(c, "Cannot delete comment "+err.Error(), fiber.StatusForbidden)
+	}
+
+	if res := h.db(c).Delete(comment); res.Error != nil {
+		return sendError(c, "Cannot delete comment "+res.Error.Error(), fiber.StatusForbidden)
+	}
+	h.cache.Forget(cache.Tasks)
+
+	e := taskEvent(events.CommentDeleted, u, task, nil)
+	e.TargetID = comment.ID
+	events.Publish(e)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
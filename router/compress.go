@@ -0,0 +1,44 @@
+package router
+
+import (
+	"bytes"
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"task-app/util"
+)
+
+// compressMinSize is the smallest body worth compressing, the smaller ones barely shrink
+const compressMinSize = 1 << 10
+
+// compressJSON compresses the JSON responses with brotli, or gzip, when the client accepts it.
+// The streams and the files are left alone, the files of the app have their compressed variants.
+func compressJSON(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return err
+	}
+
+	res := c.Response()
+	if !bytes.HasPrefix(res.Header.ContentType(), []byte(fiber.MIMEApplicationJSON)) {
+		return nil
+	}
+	c.Vary(fiber.HeaderAcceptEncoding)
+	if res.IsBodyStream() || len(res.Header.Peek(fiber.HeaderContentEncoding)) > 0 {
+		return nil
+	}
+	body := res.Body()
+	if len(body) < compressMinSize {
+		return nil
+	}
+
+	acceptEncoding := c.Get(fiber.HeaderAcceptEncoding)
+	switch {
+	case util.AcceptsEncoding(acceptEncoding, "br"):
+		res.SetBodyRaw(fasthttp.AppendBrotliBytesLevel(nil, body, fasthttp.CompressBrotliDefaultCompression))
+		c.Set(fiber.HeaderContentEncoding, "br")
+	case util.AcceptsEncoding(acceptEncoding, "gzip"):
+		res.SetBodyRaw(fasthttp.AppendGzipBytesLevel(nil, body, fasthttp.CompressDefaultCompression))
+		c.Set(fiber.HeaderContentEncoding, "gzip")
+	}
+
+	return nil
+}
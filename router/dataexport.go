@@ -0,0 +1,80 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"task-app/exports"
+	"task-app/models"
+	"task-app/storage"
+)
+
+// RequestExport queues the export of all the data of the user, a notification tells when the archive is ready
+func (h *Handler) RequestExport(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	export, err := exports.Request(u)
+	if errors.Is(err, exports.ErrPending) {
+		return models.NewError(fiber.StatusConflict, "An export is in progress already").WithCurrent(export.Api(""))
+	}
+	if err != nil {
+		return sendError(c, "Cannot export the data", fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusAccepted).JSON(export.Api(""))
+}
+
+// GetExports lists the exports of the user, the last first, with a download link for the ready ones
+func (h *Handler) GetExports(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	var list []models.DataExport
+	if err := h.db(c).Where("user_id = ?", u.ID).Order("id DESC").Find(&list).Error; err != nil {
+		return sendError(c, "Cannot find the exports", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.DataExportApi, 0, len(list))
+	for _, e := range list {
+		api, err := exportApi(e)
+		if err != nil {
+			return sendError(c, "Cannot sign the export url", fiber.StatusInternalServerError)
+		}
+		response = append(response, api)
+	}
+
+	return c.JSON(response)
+}
+
+func (h *Handler) GetExport(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	export := new(models.DataExport)
+	if err := h.db(c).Where("id = ? AND user_id = ?", c.Params("id"), u.ID).First(export).Error; err != nil {
+		return sendError(c, "Cannot find the export", fiber.StatusNotFound)
+	}
+
+	api, err := exportApi(*export)
+	if err != nil {
+		return sendError(c, "Cannot sign the export url", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(api)
+}
+
+// exportApi returns the export with a download link when its archive is ready
+func exportApi(e models.DataExport) (models.DataExportApi, error) {
+	if e.Status != models.ExportReady {
+		return e.Api(""), nil
+	}
+
+	url, err := storage.Store.SignedURL(e.StorageKey, signedURLTTL)
+	return e.Api(url), err
+}
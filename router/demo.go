@@ -0,0 +1,164 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"gorm.io/gorm"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+// CreateDemoUser creates a demo account with a workspace, projects and tasks to try the app
+// without a signup, and logs it in. The account cannot log in again with a password, and the
+// demo_cleanup job removes it with all its data once it expires.
+func (h *Handler) CreateDemoUser(c *fiber.Ctx) error {
+	if !h.conf.Accounts.Demo {
+		return sendError(c, "Demo accounts are disabled", fiber.StatusNotFound)
+	}
+
+	// the password is never told, so the demo only lives as long as its session
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(util.RandomToken(32)), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+
+	id := util.RandomToken(6)
+	expiresAt := time.Now().Add(h.conf.Accounts.DemoTTL)
+	u := &models.User{
+		Email:         "demo-" + id + "@demo.invalid",
+		Username:      "demo-" + id,
+		DisplayName:   "Demo user",
+		Password:      string(hashedPassword),
+		DemoExpiresAt: &expiresAt,
+	}
+
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		if err := tx.Create(u).Error; err != nil {
+			return err
+		}
+
+		return seedDemo(tx, u, time.Now().In(u.Location()))
+	})
+	if err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	return h.sendAuthTokens(c, u)
+}
+
+// demoTask is a task of the sample data, due in a number of days from today (no due date when nil)
+type demoTask struct {
+	title       string
+	description string
+	status      string
+	priority    int
+	due         *int
+	labels      []string
+	checklist   []string
+	// done are how many of the first items of the checklist are done
+	done int
+}
+
+func inDays(n int) *int {
+	return &n
+}
+
+// seedDemo creates the sample data of a demo account, the due dates are relative to now
+func seedDemo(tx *gorm.DB, u *models.User, now time.Time) error {
+	workspace := &models.Workspace{Name: "Acme Inc.", OwnerID: u.ID}
+	if err := tx.Create(workspace).Error; err != nil {
+		return err
+	}
+	if err := tx.Create(&models.Membership{WorkspaceID: workspace.ID, UserID: u.ID, Role: models.WorkspaceOwner}).Error; err != nil {
+		return err
+	}
+
+	labels := map[string]*models.Label{}
+	for _, l := range []models.Label{
+		{Name: "design", Color: "#8b5cf6"},
+		{Name: "bug", Color: "#ef4444"},
+		{Name: "marketing", Color: "#f59e0b"},
+		{Name: "home", Color: "#10b981"},
+	} {
+		label := &models.Label{UserID: u.ID, Name: l.Name, Color: l.Color}
+		if err := tx.Create(label).Error; err != nil {
+			return err
+		}
+		labels[label.Name] = label
+	}
+
+	website := &models.Project{
+		UserID:      u.ID,
+		WorkspaceID: &workspace.ID,
+		Title:       "Website relaunch",
+		Description: "The new website goes live **before the end of the month**.\n\n- new design\n- faster pages\n- a blog",
+	}
+	personal := &models.Project{UserID: u.ID, Title: "Personal", Description: "Errands and chores"}
+	for _, p := range []*models.Project{website, personal} {
+		if err := tx.Create(p).Error; err != nil {
+			return err
+		}
+	}
+
+	today := time.Date(now.Year(), now.Month(), now.Day(), 17, 0, 0, 0, now.Location())
+	lists := []struct {
+		project *models.Project
+		tasks   []demoTask
+	}{
+		{website, []demoTask{
+			{title: "Design the home page", description: "Start from the **mood board**, the hero must work on mobile.", status: "in_progress",
+				priority: 1, due: inDays(2), labels: []string{"design"},
+				checklist: []string{"Mood board", "Wireframes", "Mockups", "Review with the team"}, done: 2},
+			{title: "Fix the broken contact form", description: "The form answers `500` when the message has an emoji.", status: models.StatusTodo,
+				priority: 1, due: inDays(-1), labels: []string{"bug"}},
+			{title: "Write the launch announcement", status: models.StatusTodo, priority: 2, due: inDays(7), labels: []string{"marketing"}},
+			{title: "Pick the fonts", status: models.StatusDone, priority: 3, labels: []string{"design"}},
+			{title: "Set up the blog", description: "A [static site generator](https://en.wikipedia.org/wiki/Static_site_generator) is enough.",
+				status: models.StatusTodo, priority: 3, due: inDays(14)},
+		}},
+		{personal, []demoTask{
+			{title: "Buy groceries", status: models.StatusTodo, priority: 2, due: inDays(0), labels: []string{"home"},
+				checklist: []string{"Milk", "Bread", "Coffee"}, done: 1},
+			{title: "Book the dentist", status: models.StatusTodo, priority: 3, due: inDays(3)},
+			{title: "Renew the passport", status: models.StatusTodo, priority: 4},
+		}},
+	}
+
+	var first *models.Task
+	for _, list := range lists {
+		for _, d := range list.tasks {
+			task := &models.Task{
+				UserID:      u.ID,
+				WorkspaceID: list.project.WorkspaceID,
+				ProjectID:   &list.project.ID,
+				Title:       d.title,
+				Description: d.description,
+				Status:      d.status,
+				Priority:    d.priority,
+			}
+			if d.due != nil {
+				due := today.AddDate(0, 0, *d.due).UTC()
+				task.DueAt = &due
+			}
+			for _, name := range d.labels {
+				task.Labels = append(task.Labels, *labels[name])
+			}
+			for i, text := range d.checklist {
+				task.Checklist = append(task.Checklist, models.ChecklistItem{Text: text, Done: i < d.done, Position: i + 1})
+			}
+			if err := tx.Create(task).Error; err != nil {
+				return err
+			}
+			if first == nil {
+				first = task
+			}
+		}
+	}
+
+	return tx.Create(&models.Comment{
+		TaskID: first.ID,
+		UserID: u.ID,
+		Body:   "The mockups are in the shared folder, comments are welcome!",
+	}).Error
+}
@@ -0,0 +1,232 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"gorm.io/gorm/clause"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/util"
+)
+
+var errDependencyCycle = errors.New("The dependency would create a cycle")
+
+// maxDependencyDepth bounds the walk of the cycle detection, deeper chains are refused
+const maxDependencyDepth = 100
+
+// handleGetDependencies returns the tasks blocking the task and the ones it blocks,
+// limited to the tasks the user can read
+func (h *Handler) handleGetDependencies(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	blockedBy, err := h.dependencyTasks(c, u, "blocker_id", "blocked_id", task.ID)
+	if err != nil {
+		return sendError(c, "Cannot find the dependencies", fiber.StatusInternalServerError)
+	}
+	blocks, err := h.dependencyTasks(c, u, "blocked_id", "blocker_id", task.ID)
+	if err != nil {
+		return sendError(c, "Cannot find the dependencies", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"blockedBy": blockedBy, "blocks": blocks})
+}
+
+// handleAddDependency makes the task of the body block the task, a cycle is refused
+func (h *Handler) handleAddDependency(c *fiber.Ctx) error {
+	var input models.DependencyInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+	if input.BlockerID == task.ID {
+		return sendError(c, "A task cannot block itself", fiber.StatusUnprocessableEntity)
+	}
+	if _, err := h.taskRepo(c).Get(u, input.BlockerID); err != nil {
+		return sendError(c, "Cannot find the blocking Task", fiber.StatusNotFound)
+	}
+
+	before := blockerIDs(task.BlockedBy)
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		if err := checkDependencyCycle(tx, input.BlockerID, task.ID); err != nil {
+			return err
+		}
+
+		if err := tx.Clauses(clause.OnConflict{DoNothing: true}).
+			Create(&models.TaskDependency{BlockerID: input.BlockerID, BlockedID: task.ID}).Error; err != nil {
+			return err
+		}
+
+		return models.TouchTasks(tx, input.BlockerID, task.ID)
+	})
+	if errors.Is(err, errDependencyCycle) {
+		return sendError(c, err.Error(), fiber.StatusConflict)
+	}
+	if err != nil {
+		return sendError(c, "Cannot add the dependency", fiber.StatusInternalServerError)
+	}
+
+	return h.dependenciesChanged(c, u, task.ID, before)
+}
+
+func (h *Handler) handleRemoveDependency(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	blockerID, err := c.ParamsInt("blockerId")
+	if err != nil {
+		return sendError(c, "Invalid task id", fiber.StatusBadRequest)
+	}
+
+	res := h.db(c).Where("blocker_id = ? AND blocked_id = ?", blockerID, task.ID).Delete(&models.TaskDependency{})
+	if res.Error != nil {
+		return sendError(c, "Cannot remove the dependency", fiber.StatusInternalServerError)
+	}
+	if res.RowsAffected == 0 {
+		return sendError(c, "Cannot find the dependency", fiber.StatusNotFound)
+	}
+	if err := models.TouchTasks(h.db(c), uint(blockerID), task.ID); err != nil {
+		return sendError(c, "Cannot remove the dependency", fiber.StatusInternalServerError)
+	}
+
+	return h.dependenciesChanged(c, u, task.ID, blockerIDs(task.BlockedBy))
+}
+
+// dependenciesChanged publishes the change of the blockers of the task and sends the task
+func (h *Handler) dependenciesChanged(c *fiber.Ctx, u *models.User, taskID uint, before []uint) error {
+	// the lists carry the blockers of their tasks
+	h.cache.Forget(cache.Tasks)
+
+	task, err := h.taskRepo(c).Get(u, taskID)
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	updated := taskEvent(events.TaskUpdated, u, task, task.Api())
+	updated.Changes = map[string]events.Change{"blockedBy": {From: before, To: blockerIDs(task.BlockedBy)}}
+	events.Publish(updated)
+
+	return c.JSON(task.Api())
+}
+
+// checkDependencyCycle walks the tasks the blocked task blocks, an edge from the blocker
+// closes a cycle if the blocker is among them
+func checkDependencyCycle(tx *gorm.DB, blockerID, blockedID uint) error {
+	seen := map[uint]bool{blockedID: true}
+	frontier := []uint{blockedID}
+
+	for depth := 0; len(frontier) > 0; depth++ {
+		if depth == maxDependencyDepth {
+			return errDependencyCycle
+		}
+
+		var next []uint
+		if err := tx.Model(&models.TaskDependency{}).
+			Where("blocker_id IN ?", frontier).
+			Pluck("blocked_id", &next).Error; err != nil {
+			return err
+		}
+
+		frontier = frontier[:0]
+		for _, id := range next {
+			if id == blockerID {
+				return errDependencyCycle
+			}
+			if !seen[id] {
+				seen[id] = true
+				frontier = append(frontier, id)
+			}
+		}
+	}
+
+	return nil
+}
+
+// unblockDependents publishes TaskUnblocked for the tasks the completed task was the last open blocker of
+func (h *Handler) unblockDependents(e events.Event) {
+	if e.Type != events.TaskCompleted {
+		return
+	}
+
+	var dependents []models.Task
+	if err := h.store.DB().
+		Where("id IN (?)", h.store.DB().Model(&models.TaskDependency{}).Select("blocked_id").Where("blocker_id = ?", e.TaskID)).
+		Where("status <> ?", models.StatusDone).
+		Where("NOT EXISTS (?)", h.store.DB().Table("task_dependencies AS d").
+			Select("1").
+			Joins("JOIN tasks AS blocker ON blocker.id = d.blocker_id AND blocker.deleted_at IS NULL").
+			Where("d.blocked_id = tasks.id AND blocker.status <> ?", models.StatusDone)).
+		Find(&dependents).Error; err != nil {
+		logging.Log.Error().Err(err).Uint("task", e.TaskID).Msg("Cannot find the dependents of the task")
+		return
+	}
+
+	for _, t := range dependents {
+		events.Publish(events.Event{
+			Type:           events.TaskUnblocked,
+			ActorID:        e.ActorID,
+			ImpersonatorID: e.ImpersonatorID,
+			TaskID:         t.ID,
+			TargetID:       t.ID,
+			OwnerID:        t.UserID,
+			WorkspaceID:    t.WorkspaceID,
+			Payload:        fiber.Map{"blockerId": e.TaskID},
+		})
+	}
+}
+
+// dependencyTasks returns the readable tasks at the other end of the edges of the task,
+// e.g. the blockers with column blocker_id and by blocked_id
+func (h *Handler) dependencyTasks(c *fiber.Ctx, u *models.User, column, by string, taskID uint) ([]models.TaskApi, error) {
+	var tasks []models.Task
+	if err := h.db(c).Scopes(models.AccessibleBy(u), models.TaskDetails).
+		Where("id IN (?)", h.db(c).Model(&models.TaskDependency{}).Select(column).Where(by+" = ?", taskID)).
+		Order("id").
+		Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	if err := models.CountComments(h.db(c), tasks); err != nil {
+		return nil, err
+	}
+
+	response := make([]models.TaskApi, 0, len(tasks))
+	for _, t := range tasks {
+		response = append(response, t.Api())
+	}
+
+	return response, nil
+}
+
+func blockerIDs(edges []models.TaskDependency) []uint {
+	ids := make([]uint, 0, len(edges))
+	for _, d := range edges {
+		ids = append(ids, d.BlockerID)
+	}
+	return ids
+}
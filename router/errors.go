@@ -0,0 +1,88 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/quota"
+	"task-app/util"
+)
+
+// handleErrors sends the errors returned by the next handlers,
+// so the middlewares before it see the status of the error response
+func handleErrors(c *fiber.Ctx) error {
+	if err := c.Next(); err != nil {
+		return ErrorHandler(c, err)
+	}
+
+	return nil
+}
+
+// parseBody reads the request body into the input and validates it.
+// An unreadable body is a 400 error, an invalid one a 422 error with the errors of the fields.
+func parseBody(c *fiber.Ctx, input interface{}) error {
+	if err := c.BodyParser(input); err != nil {
+		return models.NewError(fiber.StatusBadRequest, "Please review your input")
+	}
+
+	if fields := util.ValidateIn(printer(c), input); fields != nil {
+		return models.ValidationError(fields)
+	}
+
+	return nil
+}
+
+// ErrorHandler answers an error with its status and the envelope {code, message, fields}.
+// Unexpected errors are logged and answered as 500 without their details.
+func ErrorHandler(c *fiber.Ctx, err error) error {
+	var appErr *models.AppError
+	var fiberErr *fiber.Error
+	var exceeded *quota.ExceededError
+	switch {
+	case errors.As(err, &appErr):
+	case errors.As(err, &exceeded):
+		appErr = exceededError(exceeded)
+	case errors.As(err, &fiberErr):
+		appErr = models.NewError(fiberErr.Code, fiberErr.Message)
+	case errors.Is(err, gorm.ErrRecordNotFound):
+		appErr = models.NewError(fiber.StatusNotFound, "Not Found")
+	case errors.Is(err, context.DeadlineExceeded):
+		appErr = errTimeout
+	default:
+		logging.FromCtx(c).Error().Err(err).Str("path", c.Path()).Msg("Unexpected error")
+		appErr = models.NewError(fiber.StatusInternalServerError, "Something went wrong, please try again later")
+	}
+
+	return c.Status(appErr.Status).JSON(localize(c, appErr))
+}
+
+// printer returns the printer of the language of the Accept-Language header, English by default
+func printer(c *fiber.Ctx) *i18n.Printer {
+	return i18n.FromHeader(c.Get(fiber.HeaderAcceptLanguage))
+}
+
+// localize returns a copy of the error with its message and the errors of its fields
+// in the language of the request, the error itself may be shared
+func localize(c *fiber.Ctx, appErr *models.AppError) *models.AppError {
+	p := printer(c)
+	c.Vary(fiber.HeaderAcceptLanguage)
+	if p == i18n.English {
+		return appErr
+	}
+	c.Set(fiber.HeaderContentLanguage, p.Lang())
+
+	localized := *appErr
+	localized.Message = p.Text(appErr.Message)
+	if appErr.Fields != nil {
+		localized.Fields = make(map[string]string, len(appErr.Fields))
+		for field, msg := range appErr.Fields {
+			localized.Fields[field] = p.Text(msg)
+		}
+	}
+
+	return &localized
+}
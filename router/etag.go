@@ -0,0 +1,126 @@
+package router
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"hash"
+	"strings"
+	"task-app/models"
+)
+
+// The ETags are weak: they are computed from the updated_at of the rows, not from the bytes
+// of the response. If-Match compares them weakly anyway, as they are the only validators of
+// the resources (RFC 9110 asks for a strong comparison).
+
+// taskETag returns the ETag of a task with the details it is sent with, which change
+// without touching the updated_at of the task
+func taskETag(t *models.Task) string {
+	h := sha256.New()
+	writeTaskVersion(h, t)
+
+	return weakETag(h)
+}
+
+func writeTaskVersion(h hash.Hash, t *models.Task) {
+	fmt.Fprintf(h, "task:%d:%d;comments:%d;", t.ID, t.UpdatedAt.UnixNano(), t.CommentCount)
+	if a := t.Assignee; a != nil {
+		fmt.Fprintf(h, "assignee:%d:%d;", a.ID, a.UpdatedAt.UnixNano())
+	}
+	for _, l := range t.Labels {
+		fmt.Fprintf(h, "label:%d:%d;", l.ID, l.UpdatedAt.UnixNano())
+	}
+	for _, i := range t.Checklist {
+		fmt.Fprintf(h, "item:%d:%d;", i.ID, i.UpdatedAt.UnixNano())
+	}
+	for _, w := range t.Watchers {
+		fmt.Fprintf(h, "watcher:%d;", w.ID)
+	}
+	for _, d := range t.BlockedBy {
+		fmt.Fprintf(h, "blocker:%d;", d.BlockerID)
+	}
+	for _, d := range t.Blocks {
+		fmt.Fprintf(h, "blocked:%d;", d.BlockedID)
+	}
+}
+
+// tasksETag returns the ETag of a list of tasks, the extra parts are e.g. the next cursor
+func tasksETag(tasks []models.Task, extra ...interface{}) string {
+	h := sha256.New()
+	for i := range tasks {
+		writeTaskVersion(h, &tasks[i])
+	}
+	fmt.Fprint(h, extra...)
+
+	return weakETag(h)
+}
+
+// projectETag returns the ETag of a project
+func projectETag(p *models.Project) string {
+	h := sha256.New()
+	fmt.Fprintf(h, "project:%d:%d;", p.ID, p.UpdatedAt.UnixNano())
+
+	return weakETag(h)
+}
+
+// projectsETag returns the ETag of a list of projects
+func projectsETag(projects []models.Project) string {
+	h := sha256.New()
+	for _, p := range projects {
+		fmt.Fprintf(h, "project:%d:%d;", p.ID, p.UpdatedAt.UnixNano())
+	}
+
+	return weakETag(h)
+}
+
+func weakETag(h hash.Hash) string {
+	return `W/"` + hex.EncodeToString(h.Sum(nil)[:16]) + `"`
+}
+
+// notModified sets the ETag of the response and tells whether it matches the If-None-Match
+// of the request, the handler then answers with sendNotModified
+func notModified(c *fiber.Ctx, etag string) bool {
+	c.Set(fiber.HeaderETag, etag)
+	return etagListMatches(c.Get(fiber.HeaderIfNoneMatch), etag)
+}
+
+// sendNotModified answers 304 without a body, the ETag is already set
+func sendNotModified(c *fiber.Ctx) error {
+	c.Context().ResetBody()
+	return c.SendStatus(fiber.StatusNotModified)
+}
+
+// checkIfMatch answers 412 when the request has an If-Match which does not match the
+// current ETag of the resource, so a client does not overwrite a change it has not seen
+func checkIfMatch(c *fiber.Ctx, etag string) error {
+	ifMatch := c.Get(fiber.HeaderIfMatch)
+	if ifMatch == "" || etagListMatches(ifMatch, etag) {
+		return nil
+	}
+
+	return models.NewError(fiber.StatusPreconditionFailed, "The resource was changed since it was read, read it again before changing it")
+}
+
+// etagListMatches tells whether the ETag is in a list of If-None-Match or If-Match, * matches any
+func etagListMatches(list, etag string) bool {
+	if list == "" {
+		return false
+	}
+	if strings.TrimSpace(list) == "*" {
+		return true
+	}
+
+	for _, tag := range strings.Split(list, ",") {
+		if opaqueTag(tag) == opaqueTag(etag) {
+			return true
+		}
+	}
+
+	return false
+}
+
+// opaqueTag returns the tag without the weak prefix, for the weak comparison
+func opaqueTag(tag string) string {
+	return strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+}
@@ -0,0 +1,215 @@
+package router
+
+import (
+	"bufio"
+	"context"
+	"database/sql"
+	"encoding/csv"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"time"
+)
+
+// exportRow is a task flattened for the export, labels are joined by commas
+type exportRow struct {
+	ID          uint      `json:"id"`
+	Title       string    `json:"title"`
+	Description string    `json:"description"`
+	Status      string    `json:"status"`
+	Priority    int       `json:"priority"`
+	WorkspaceID *uint     `json:"workspaceId"`
+	ProjectID   *uint     `json:"projectId"`
+	AssigneeID  *uint     `json:"assigneeId"`
+	Labels      string    `json:"labels"`
+	CreatedAt   time.Time `json:"createdAt"`
+	UpdatedAt   time.Time `json:"updatedAt"`
+}
+
+var exportColumns = []string{"id", "title", "description", "status", "priority", "workspaceId", "projectId", "assigneeId", "labels", "createdAt", "updatedAt"}
+
+// handleExportTasks streams the tasks of the user as ?format=csv or json (the default).
+// The tasks can be filtered by ?project, ?status and a creation date range ?from and ?to.
+// Rows are written as they are read from the database, so large exports are not held in memory.
+func (h *Handler) handleExportTasks(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	format := c.Query("format", "json")
+	if format != "json" && format != "csv" {
+		return sendError(c, "Format must be csv or json", fiber.StatusBadRequest)
+	}
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+
+	// the rows are read by the stream, after the handler returns: they outlive the context of the request
+	query := h.store.DB().WithContext(repository.WithTenant(context.Background(), u.ID)).Model(models.Task{}).
+		Scopes(models.AccessibleBy(u)).
+		Select("tasks.id, tasks.title, tasks.description, tasks.status, tasks.priority, tasks.workspace_id, tasks.project_id, tasks.assignee_id, tasks.created_at, tasks.updated_at, " +
+			"COALESCE((SELECT " + db.StringAgg("labels.name") + " FROM task_labels JOIN labels ON labels.id = task_labels.label_id WHERE task_labels.task_id = tasks.id), '') AS labels").
+		Order("tasks.id")
+
+	if project := c.Query("project"); project != "" {
+		query = query.Where("tasks.project_id = ?", project)
+	}
+	if status := c.Query("status"); status != "" {
+		query = query.Where("tasks.status = ?", status)
+	}
+	if from := c.Query("from"); from != "" {
+		t, err := parseExportDate(from, false, loc)
+		if err != nil {
+			return sendError(c, "Invalid from date", fiber.StatusBadRequest)
+		}
+		query = query.Where("tasks.created_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseExportDate(to, true, loc)
+		if err != nil {
+			return sendError(c, "Invalid to date", fiber.StatusBadRequest)
+		}
+		query = query.Where("tasks.created_at < ?", t)
+	}
+
+	rows, err := query.Rows()
+	if err != nil {
+		return sendError(c, "Cannot export tasks", fiber.StatusInternalServerError)
+	}
+
+	filename := "tasks-" + time.Now().Format("2006-01-02") + "." + format
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	if format == "csv" {
+		c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+	} else {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+	}
+
+	// the stream is written after the handler returns, keep the logger of the request
+	logger := logging.FromCtx(c)
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer rows.Close()
+
+		var err error
+		if format == "csv" {
+			err = h.writeExportCSV(w, rows)
+		} else {
+			err = h.writeExportJSON(w, rows)
+		}
+		if err != nil {
+			logger.Error().Err(err).Msg("Cannot export tasks")
+		}
+	})
+
+	return nil
+}
+
+// scanExportRow reads the next row, the rows are not read by the model so the description is
+// decrypted here
+func (h *Handler) scanExportRow(rows *sql.Rows, row *exportRow) error {
+	if err := h.store.DB().ScanRows(rows, row); err != nil {
+		return err
+	}
+
+	var err error
+	row.Description, err = h.keyring.Decrypt("tasks.description", row.Description)
+	return err
+}
+
+func (h *Handler) writeExportCSV(w *bufio.Writer, rows *sql.Rows) error {
+	out := csv.NewWriter(w)
+	if err := out.Write(exportColumns); err != nil {
+		return err
+	}
+
+	for rows.Next() {
+		var row exportRow
+		if err := h.scanExportRow(rows, &row); err != nil {
+			return err
+		}
+
+		out.Write([]string{
+			strconv.FormatUint(uint64(row.ID), 10),
+			row.Title,
+			row.Description,
+			row.Status,
+			strconv.Itoa(row.Priority),
+			formatOptionalID(row.WorkspaceID),
+			formatOptionalID(row.ProjectID),
+			formatOptionalID(row.AssigneeID),
+			row.Labels,
+			models.Timestamp(row.CreatedAt),
+			models.Timestamp(row.UpdatedAt),
+		})
+		if out.Error() != nil {
+			return out.Error()
+		}
+	}
+
+	out.Flush()
+	if err := out.Error(); err != nil {
+		return err
+	}
+
+	return rows.Err()
+}
+
+// writeExportJSON writes an array of the rows, encoding one row at a time
+func (h *Handler) writeExportJSON(w *bufio.Writer, rows *sql.Rows) error {
+	w.WriteString("[")
+
+	enc := json.NewEncoder(w)
+	for first := true; rows.Next(); first = false {
+		var row exportRow
+		if err := h.scanExportRow(rows, &row); err != nil {
+			return err
+		}
+
+		if !first {
+			w.WriteString(",")
+		}
+		if err := enc.Encode(row); err != nil {
+			return err
+		}
+	}
+
+	w.WriteString("]\n")
+	if err := w.Flush(); err != nil {
+		return err
+	}
+
+	return rows.Err()
+}
+
+// parseExportDate accepts RFC 3339 or a plain date, which starts at midnight in the zone.
+// A plain date used as the end of a range includes the whole day.
+func parseExportDate(s string, end bool, loc *time.Location) (time.Time, error) {
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+
+	t, err := time.ParseInLocation("2006-01-02", strings.TrimSpace(s), loc)
+	if err != nil {
+		return t, err
+	}
+	if end {
+		t = t.AddDate(0, 0, 1)
+	}
+
+	return t, nil
+}
+
+func formatOptionalID(id *uint) string {
+	if id == nil {
+		return ""
+	}
+
+	return strconv.FormatUint(uint64(*id), 10)
+}
@@ -0,0 +1,170 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/models"
+	"task-app/repository"
+	"time"
+)
+
+func (h *Handler) setupFiltersRoutes() {
+	FILTERS.Use(h.tokens.SecureAuth())
+	FILTERS.Get("/", h.handleGetFilters)
+	FILTERS.Post("/", h.handleCreateFilter)
+	FILTERS.Get("/:id", h.handleGetFilter)
+	FILTERS.Patch("/:id", h.handleUpdateFilter)
+	FILTERS.Delete("/:id", h.handleDeleteFilter)
+	FILTERS.Get("/:id/tasks", h.handleGetFilterTasks)
+}
+
+// handleGetFilters lists the saved filters of the user by name
+func (h *Handler) handleGetFilters(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	var filters []models.Filter
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Order("name, id").Find(&filters); res.Error != nil {
+		return sendError(c, "Cannot find user's filters", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.FilterApi, 0, len(filters))
+	for _, f := range filters {
+		response = append(response, f.Api())
+	}
+
+	return c.JSON(response)
+}
+
+func (h *Handler) handleGetFilter(c *fiber.Ctx) error {
+	filter, err := h.findFilter(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Filter", fiber.StatusNotFound)
+	}
+
+	return c.JSON(filter.Api())
+}
+
+func (h *Handler) handleCreateFilter(c *fiber.Ctx) error {
+	var input models.FilterInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	if h.filterNamed(c, u, input.Name, 0) {
+		return sendError(c, "Filter already exists", fiber.StatusConflict)
+	}
+
+	filter := models.Filter{UserID: u.ID, Name: input.Name, Query: input.Query, Sort: input.Sort}
+	if res := h.db(c).Create(&filter); res.Error != nil {
+		return sendError(c, "Cannot create filter "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(filter.Api())
+}
+
+// handleUpdateFilter replaces the name, the query and the sort of a filter
+func (h *Handler) handleUpdateFilter(c *fiber.Ctx) error {
+	var input models.FilterInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	filter, err := h.findFilter(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Filter", fiber.StatusNotFound)
+	}
+	if h.filterNamed(c, u, input.Name, filter.ID) {
+		return sendError(c, "Filter already exists", fiber.StatusConflict)
+	}
+
+	filter.Name, filter.Query, filter.Sort = input.Name, input.Query, input.Sort
+	if res := h.db(c).Save(filter); res.Error != nil {
+		return sendError(c, "Cannot update filter "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(filter.Api())
+}
+
+func (h *Handler) handleDeleteFilter(c *fiber.Ctx) error {
+	filter, err := h.findFilter(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Filter", fiber.StatusNotFound)
+	}
+
+	if res := h.db(c).Delete(filter); res.Error != nil {
+		return sendError(c, "Cannot delete filter "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleGetFilterTasks runs a filter: it lists the tasks the user can read matching its query,
+// in its order. The days of the query are in the zone of the user or ?tz=, and
+// ?include_archived=true lists the archived tasks too.
+func (h *Handler) handleGetFilterTasks(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+	filter, err := h.findFilter(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Filter", fiber.StatusNotFound)
+	}
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+
+	tasks, err := h.taskRepo(c).List(u, repository.TaskFilter{
+		Query:           filter.Query,
+		Now:             time.Now().In(loc).Truncate(time.Minute),
+		Sort:            filter.Sort,
+		IncludeArchived: includeArchived(c),
+	})
+	if err != nil {
+		return sendError(c, "Cannot find the tasks of the filter", fiber.StatusInternalServerError)
+	}
+
+	if notModified(c, tasksETag(tasks)) {
+		return sendNotModified(c)
+	}
+
+	response := make([]models.TaskApi, 0, len(tasks))
+	for _, t := range tasks {
+		response = append(response, t.Api())
+	}
+
+	return c.JSON(response)
+}
+
+func (h *Handler) findFilter(c *fiber.Ctx, id interface{}) (*models.Filter, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	filter := new(models.Filter)
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Where("id = ?", id).First(filter); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return filter, nil
+}
+
+// filterNamed tells whether the user has another filter with the name
+func (h *Handler) filterNamed(c *fiber.Ctx, u *models.User, name string, except uint) bool {
+	var count int64
+	h.db(c).Model(&models.Filter{}).Scopes(models.OwnedBy(u)).Where("name = ? AND id <> ?", name, except).Count(&count)
+
+	return count > 0
+}
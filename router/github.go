@@ -0,0 +1,363 @@
+package router
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"regexp"
+	"strings"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/github"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/oauth"
+	"task-app/util"
+)
+
+// githubRepository is the owner/name of a repository
+var githubRepository = regexp.MustCompile(`^[A-Za-z0-9-]+/[A-Za-z0-9_.-]+$`)
+
+type githubImportReport struct {
+	Imported int `json:"imported"`
+	// Skipped are the open issues imported before
+	Skipped int `json:"skipped"`
+}
+
+// githubWebhookURL returns the URL the webhooks of the repositories deliver to
+func githubWebhookURL() string {
+	return oauth.RedirectBase + "/api/v1/integrations/github/webhook"
+}
+
+// handleGetGitHubIntegration returns the repository linked to the project
+func (h *Handler) handleGetGitHubIntegration(c *fiber.Ctx) error {
+	_, integration, err := h.findGitHubIntegration(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(integration.Api(githubWebhookURL()))
+}
+
+// handleLinkGitHub links the project to a repository, or changes the settings of the link. The
+// token is checked against the repository, the secret of the webhook is only sent on the first link.
+func (h *Handler) handleLinkGitHub(c *fiber.Ctx) error {
+	var input models.GitHubIntegrationInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+	input.Repository = strings.TrimSuffix(strings.TrimSpace(input.Repository), ".git")
+	if !githubRepository.MatchString(input.Repository) {
+		return models.ValidationError(map[string]string{"repository": "The repository must be owner/name"})
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	project, err := h.findWritableProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+
+	integration := new(models.GitHubIntegration)
+	res := h.db(c).Where("project_id = ?", project.ID).Limit(1).Find(integration)
+	if res.Error != nil {
+		return sendError(c, "Cannot find the GitHub integration", fiber.StatusInternalServerError)
+	}
+	created := res.RowsAffected == 0
+	if created && input.Token == "" {
+		return models.ValidationError(map[string]string{"token": "The token is required to link a repository"})
+	}
+
+	if input.Token != "" || input.Repository != integration.Repository {
+		token := input.Token
+		if token == "" {
+			token = integration.Token
+		}
+		switch err := github.Repository(util.Context(c), token, input.Repository); {
+		case errors.Is(err, github.ErrUnauthorized):
+			return models.ValidationError(map[string]string{"token": "The token cannot read the repository"})
+		case errors.Is(err, github.ErrNotFound):
+			return models.ValidationError(map[string]string{"repository": "The repository does not exist, or the token cannot see it"})
+		case err != nil:
+			logging.FromCtx(c).Error().Err(err).Str("repository", input.Repository).Msg("Cannot read the GitHub repository")
+			return sendError(c, "Cannot reach GitHub", fiber.StatusBadGateway)
+		}
+		integration.Token = token
+	}
+
+	if created {
+		integration.ProjectID = project.ID
+		integration.CreatedBy = u.ID
+		integration.WebhookSecret = util.RandomToken(24)
+	}
+	integration.Repository = input.Repository
+	integration.SyncStatus = input.SyncStatus
+	integration.CommentOnCompletion = input.CommentOnCompletion
+	integration.ImportNew = input.ImportNew
+	if err := h.db(c).Save(integration).Error; err != nil {
+		return sendError(c, "Cannot save the GitHub integration", fiber.StatusInternalServerError)
+	}
+
+	api := integration.Api(githubWebhookURL())
+	if created {
+		api.WebhookSecret = integration.WebhookSecret
+		return c.Status(fiber.StatusCreated).JSON(api)
+	}
+
+	return c.JSON(api)
+}
+
+// handleUnlinkGitHub unlinks the repository, the tasks of its issues are kept
+func (h *Handler) handleUnlinkGitHub(c *fiber.Ctx) error {
+	_, integration, err := h.findGitHubIntegration(c)
+	if err != nil {
+		return err
+	}
+
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("integration_id = ?", integration.ID).Delete(&models.GitHubIssue{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(integration).Error
+	})
+	if err != nil {
+		return sendError(c, "Cannot unlink the GitHub repository", fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleImportGitHubIssues adds the open issues of the repository as tasks of the project,
+// the issues imported before are skipped. The tasks are the ones of the user importing them.
+func (h *Handler) handleImportGitHubIssues(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	project, integration, err := h.findGitHubIntegration(c)
+	if err != nil {
+		return err
+	}
+
+	issues, err := github.OpenIssues(util.Context(c), integration.Token, integration.Repository)
+	if errors.Is(err, github.ErrUnauthorized) || errors.Is(err, github.ErrNotFound) {
+		return sendError(c, "The token of the integration cannot read the repository any more", fiber.StatusBadGateway)
+	}
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("repository", integration.Repository).Msg("Cannot list the GitHub issues")
+		return sendError(c, "Cannot reach GitHub", fiber.StatusBadGateway)
+	}
+
+	report := githubImportReport{}
+	var created []models.Task
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		var numbers []int
+		if err := tx.Model(&models.GitHubIssue{}).Where("integration_id = ?", integration.ID).Pluck("number", &numbers).Error; err != nil {
+			return err
+		}
+		imported := make(map[int]bool, len(numbers))
+		for _, n := range numbers {
+			imported[n] = true
+		}
+
+		for _, issue := range issues {
+			if imported[issue.Number] {
+				report.Skipped++
+				continue
+			}
+			task, err := importIssue(tx, integration, project, u.ID, issue)
+			if err != nil {
+				return err
+			}
+			created = append(created, *task)
+		}
+
+		return nil
+	})
+	if qerr := quotaError(err); qerr != nil {
+		return qerr
+	}
+	if err != nil {
+		return sendError(c, "Cannot import the GitHub issues", fiber.StatusInternalServerError)
+	}
+
+	h.cache.Forget(cache.Tasks)
+	for i := range created {
+		publishTaskEvent(events.TaskCreated, u, &created[i], created[i].Api())
+	}
+	report.Imported = len(created)
+
+	return c.JSON(report)
+}
+
+// importIssue creates the task of an issue in the project, linked to the issue
+func importIssue(tx *gorm.DB, integration *models.GitHubIntegration, project *models.Project, userID uint, issue github.Issue) (*models.Task, error) {
+	description := strings.TrimSpace(issue.Body)
+	if description != "" {
+		description += "\n\n"
+	}
+	description += fmt.Sprintf("[%s#%d](%s)", integration.Repository, issue.Number, issue.HTMLURL)
+
+	projectID := project.ID
+	task := models.Task{
+		Title:       truncateRunes(strings.TrimSpace(issue.Title), 255),
+		Description: description,
+		UserID:      userID,
+		ProjectID:   &projectID,
+		WorkspaceID: project.WorkspaceID,
+	}
+	if issue.State == models.IssueClosed {
+		task.Status = models.StatusDone
+	}
+	if err := tx.Create(&task).Error; err != nil {
+		return nil, err
+	}
+
+	link := models.GitHubIssue{TaskID: task.ID, IntegrationID: integration.ID, Number: issue.Number, URL: issue.HTMLURL, State: issue.State}
+	if err := tx.Create(&link).Error; err != nil {
+		return nil, err
+	}
+
+	return &task, nil
+}
+
+func (h *Handler) findGitHubIntegration(c *fiber.Ctx) (*models.Project, *models.GitHubIntegration, error) {
+	project, err := h.findWritableProject(c, c.Params("id"))
+	if err != nil {
+		return nil, nil, sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+
+	integration := new(models.GitHubIntegration)
+	if res := h.db(c).Where("project_id = ?", project.ID).First(integration); res.Error != nil {
+		return nil, nil, sendError(c, "The project is not linked to a GitHub repository", fiber.StatusNotFound)
+	}
+
+	return project, integration, nil
+}
+
+// handleGitHubWebhook reads the issues events of the webhook of a linked repository, signed with
+// the secret of its integration. A repository linked to several projects syncs them all.
+func (h *Handler) handleGitHubWebhook(c *fiber.Ctx) error {
+	var e github.IssuesEvent
+	if err := json.Unmarshal(c.Body(), &e); err != nil || e.Repository.FullName == "" {
+		return sendError(c, "Invalid GitHub event", fiber.StatusBadRequest)
+	}
+
+	var integrations []models.GitHubIntegration
+	projects := h.db(c).Model(&models.Project{}).Select("id")
+	if err := h.db(c).Where("LOWER(repository) = ? AND project_id IN (?)", strings.ToLower(e.Repository.FullName), projects).Find(&integrations).Error; err != nil {
+		return sendError(c, "Cannot find the GitHub integrations", fiber.StatusInternalServerError)
+	}
+	verified := integrations[:0]
+	for _, integration := range integrations {
+		if github.Verify(integration.WebhookSecret, c.Get(github.SignatureHeader), c.Body()) == nil {
+			verified = append(verified, integration)
+		}
+	}
+	if len(verified) == 0 {
+		return sendError(c, "Invalid GitHub signature", fiber.StatusUnauthorized)
+	}
+
+	// a ping is sent once the webhook is added
+	if c.Get(github.EventHeader) != "issues" {
+		return c.SendStatus(fiber.StatusNoContent)
+	}
+
+	for i := range verified {
+		if err := h.syncGitHubIssue(c, &verified[i], &e); err != nil {
+			if qerr := quotaError(err); qerr != nil {
+				return qerr
+			}
+			logging.FromCtx(c).Error().Err(err).Uint("integration", verified[i].ID).Int("issue", e.Issue.Number).Msg("Cannot sync the GitHub issue")
+			return sendError(c, "Cannot sync the GitHub issue", fiber.StatusInternalServerError)
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// syncGitHubIssue applies an issues event to the project of the integration: an opened issue
+// adds its task with ImportNew, a closed one completes its task and a reopened one reopens it
+// with SyncStatus. The changes are made by the user who linked the repository.
+func (h *Handler) syncGitHubIssue(c *fiber.Ctx, integration *models.GitHubIntegration, e *github.IssuesEvent) error {
+	actor := new(models.User)
+	if err := h.db(c).First(actor, integration.CreatedBy).Error; err != nil {
+		actor.ID = integration.CreatedBy
+	}
+
+	link := new(models.GitHubIssue)
+	res := h.db(c).Where("integration_id = ? AND number = ?", integration.ID, e.Issue.Number).Limit(1).Find(link)
+	if res.Error != nil {
+		return res.Error
+	}
+	linked := res.RowsAffected > 0
+
+	switch e.Action {
+	case "opened":
+		if !integration.ImportNew || linked {
+			return nil
+		}
+		project := new(models.Project)
+		if err := h.db(c).First(project, integration.ProjectID).Error; err != nil {
+			return err
+		}
+
+		var task *models.Task
+		if err := h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+			var err error
+			task, err = importIssue(tx, integration, project, integration.CreatedBy, e.Issue)
+			return err
+		}); err != nil {
+			return err
+		}
+		h.cache.Forget(cache.Tasks)
+		publishTaskEvent(events.TaskCreated, actor, task, task.Api())
+	case "closed", "reopened":
+		if !linked {
+			return nil
+		}
+		state := models.IssueOpen
+		if e.Action == "closed" {
+			state = models.IssueClosed
+		}
+		// the state is kept before the task is completed, so its completion is not commented back
+		if err := h.db(c).Model(link).Update("state", state).Error; err != nil {
+			return err
+		}
+		if !integration.SyncStatus {
+			return nil
+		}
+
+		task := new(models.Task)
+		if res := h.db(c).Where("id = ?", link.TaskID).Limit(1).Find(task); res.Error != nil || res.RowsAffected == 0 {
+			return res.Error
+		}
+		status := models.StatusDone
+		if state == models.IssueOpen {
+			status = models.StatusTodo
+		}
+		if (task.Status == models.StatusDone) == (status == models.StatusDone) {
+			return nil
+		}
+
+		change := events.Change{From: task.Status, To: status}
+		task.SetStatus(status)
+		if err := h.taskRepo(c).Update(task, map[string]interface{}{"status": task.Status, "completed_at": task.CompletedAt}); err != nil {
+			return err
+		}
+
+		updated := taskEvent(events.TaskUpdated, actor, task, task.Api())
+		updated.Changes = map[string]events.Change{"status": change}
+		events.Publish(updated)
+		if status == models.StatusDone {
+			publishTaskEvent(events.TaskCompleted, actor, task, task.Api())
+		}
+	}
+
+	return nil
+}
@@ -0,0 +1,32 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/valyala/fasthttp"
+	"github.com/valyala/fasthttp/fasthttpadaptor"
+	"task-app/graph"
+	"task-app/util"
+)
+
+// setupGraphQLRoutes serves the GraphQL API, GET for the queries of the API keys with the read scope only
+func (h *Handler) setupGraphQLRoutes() {
+	serve := fasthttpadaptor.NewFastHTTPHandler(graph.NewHandler(h.store))
+
+	GRAPHQL.Use(h.tokens.SecureAuth())
+	GRAPHQL.Get("/", h.handleGraphQL(serve))
+	GRAPHQL.Post("/", h.handleGraphQL(serve))
+}
+
+func (h *Handler) handleGraphQL(serve fasthttp.RequestHandler) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		u, err := h.tokens.CurrentUser(c)
+		if err != nil {
+			return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+		}
+
+		c.Locals(graph.UserKey, u)
+		c.Locals(graph.ContextKey, util.Context(c))
+		serve(c.Context())
+		return nil
+	}
+}
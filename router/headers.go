@@ -0,0 +1,31 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/config"
+)
+
+// securityHeaders sets the security headers of the config on every response: HSTS, nosniff and the
+// Content-Security-Policy, which a route may replace, e.g. the page of the API docs
+func securityHeaders(conf config.Headers) fiber.Handler {
+	var hsts string
+	if conf.HSTSMaxAge > 0 {
+		hsts = "max-age=" + strconv.FormatInt(int64(conf.HSTSMaxAge.Seconds()), 10)
+		if conf.HSTSIncludeSubdomains {
+			hsts += "; includeSubDomains"
+		}
+	}
+
+	return func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderXContentTypeOptions, "nosniff")
+		if hsts != "" {
+			c.Set(fiber.HeaderStrictTransportSecurity, hsts)
+		}
+		if conf.ContentSecurityPolicy != "" {
+			c.Set(fiber.HeaderContentSecurityPolicy, conf.ContentSecurityPolicy)
+		}
+
+		return c.Next()
+	}
+}
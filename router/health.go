@@ -0,0 +1,76 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"task-app/db"
+	"task-app/ratelimit"
+	"time"
+)
+
+var startedAt = time.Now()
+
+type healthCheck struct {
+	Status string `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+func (h *Handler) setupHealthRoutes(app *fiber.App) {
+	app.Get("/healthz", handleHealthz)
+	app.Get("/readyz", h.handleReadyz)
+}
+
+// handleHealthz tells the process is alive, without checking any dependency
+func handleHealthz(c *fiber.Ctx) error {
+	return c.JSON(fiber.Map{
+		"status": "ok",
+		"uptime": time.Since(startedAt).Round(time.Second).String(),
+	})
+}
+
+// handleReadyz checks the app can serve requests: the database answers, the migrations
+// are applied and the Redis store of the rate limits answers when it is configured.
+// It answers 503 when a check fails, so the instance is taken out of the load balancer.
+func (h *Handler) handleReadyz(c *fiber.Ctx) error {
+	checks := map[string]healthCheck{
+		"database":   runHealthCheck(h.store.Ping),
+		"migrations": runHealthCheck(checkMigrations),
+	}
+
+	if redis, ok := ratelimit.Store.(*ratelimit.RedisStorage); ok {
+		checks["redis"] = runHealthCheck(redis.Ping)
+	}
+
+	status, code := "ok", fiber.StatusOK
+	for _, check := range checks {
+		if check.Status != "ok" {
+			status, code = "unavailable", fiber.StatusServiceUnavailable
+		}
+	}
+
+	return c.Status(code).JSON(fiber.Map{
+		"status": status,
+		"checks": checks,
+	})
+}
+
+func runHealthCheck(check func() error) healthCheck {
+	if err := check(); err != nil {
+		return healthCheck{Status: "failed", Error: err.Error()}
+	}
+
+	return healthCheck{Status: "ok"}
+}
+
+func checkMigrations() error {
+	pending, err := db.PendingMigrations()
+	if err != nil {
+		return err
+	}
+	if len(pending) > 0 {
+		return errors.New("pending migrations: " + strings.Join(pending, ", "))
+	}
+
+	return nil
+}
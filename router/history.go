@@ -0,0 +1,90 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"task-app/events"
+	"task-app/models"
+	"task-app/repository"
+)
+
+// handleGetTaskHistory lists the revisions of the task, the latest first, with the fields each one changed
+func (h *Handler) handleGetTaskHistory(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	limit, offset := paginate(c)
+	var revisions []models.TaskRevision
+	res := h.db(c).Preload("Author").
+		Where("task_id = ?", task.ID).
+		Order("id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&revisions)
+	if res.Error != nil {
+		return sendError(c, "Cannot find the history", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.TaskRevisionApi, 0, len(revisions))
+	for _, r := range revisions {
+		response = append(response, r.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// handleRevertTask restores the title, description, status, due date, recurrence and priority of
+// the task as they were before the revision, undoing it and the revisions after it. The revert is
+// an update of its own, it makes a new revision.
+func (h *Handler) handleRevertTask(c *fiber.Ctx) error {
+	user, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+	if err := checkIfMatch(c, taskETag(task)); err != nil {
+		return err
+	}
+
+	revision := new(models.TaskRevision)
+	if res := h.db(c).Where("id = ? AND task_id = ?", c.Params("revision"), task.ID).First(revision); res.Error != nil {
+		return sendError(c, "Cannot find the revision", fiber.StatusNotFound)
+	}
+	state, err := revision.PreviousState()
+	if err != nil {
+		return sendError(c, "Cannot read the revision", fiber.StatusInternalServerError)
+	}
+
+	input := state.Input()
+	completed := task.Status != models.StatusDone && input.Status == models.StatusDone
+	changes := taskChanges(task, &input)
+	if len(changes) == 0 {
+		return c.JSON(task.Api())
+	}
+	task.Apply(&input)
+
+	if err := h.taskRepo(c).Save(task); err != nil {
+		if errors.Is(err, repository.ErrConflict) {
+			if current, err := h.taskRepo(c).Get(user, task.ID); err == nil {
+				return taskConflict(current)
+			}
+		}
+		return sendError(c, "Cannot revert the task", fiber.StatusInternalServerError)
+	}
+
+	updated := taskEvent(events.TaskUpdated, user, task, task.Api())
+	updated.Changes = changes
+	events.Publish(updated)
+	if completed {
+		publishTaskEvent(events.TaskCompleted, user, task, task.Api())
+	}
+
+	c.Set(fiber.HeaderETag, taskETag(task))
+	return c.JSON(task.Api())
+}
@@ -0,0 +1,171 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+	"task-app/models"
+	"time"
+)
+
+// IdempotencyHeader carries the key of a request the client may retry, e.g. a UUID
+const IdempotencyHeader = "Idempotency-Key"
+
+// ReplayedHeader tells the response is the one of the first request with the key
+const ReplayedHeader = "Idempotent-Replayed"
+
+// maxIdempotencyKey is the longest key accepted
+const maxIdempotencyKey = 255
+
+// replayedHeaders are the headers stored with a response. The cookies are not, the responses
+// signing a user in are not replayed, see sessionUserLocal.
+var replayedHeaders = []string{fiber.HeaderContentType, fiber.HeaderLocation}
+
+// sessionUserLocal is set by sendAuthTokens to the user signed in, the response is then not
+// stored: its retries are refused and the client logs in instead
+const sessionUserLocal = "sessionUserID"
+
+// idempotent runs a request sent with an Idempotency-Key once: the response is stored with the
+// key and replayed to the retries for IdempotencyRetention, so a client on a flaky network does
+// not create a task twice. The keys are by user, a retry must send the same method, path and body.
+// The responses of the server errors are not stored, their retries run the request again.
+func (h *Handler) idempotent() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		key := c.Get(IdempotencyHeader)
+		if key == "" {
+			return c.Next()
+		}
+		if len(key) > maxIdempotencyKey {
+			return models.NewError(fiber.StatusBadRequest, "The Idempotency-Key must be at most 255 characters long")
+		}
+
+		scope, _ := c.Locals("id").(string)
+		record := &models.IdempotencyKey{Scope: scope, Key: key, RequestHash: h.requestHash(c)}
+
+		claimed, err := h.claimIdempotencyKey(c, record)
+		if err != nil {
+			return err
+		}
+		if !claimed {
+			return h.replay(c, record)
+		}
+
+		// the error is answered here so its response is stored too
+		if err := c.Next(); err != nil {
+			if err := ErrorHandler(c, err); err != nil {
+				h.db(c).Delete(record)
+				return err
+			}
+		}
+
+		status := c.Response().StatusCode()
+		if status >= fiber.StatusInternalServerError {
+			h.db(c).Delete(record)
+			return nil
+		}
+
+		if id, ok := c.Locals(sessionUserLocal).(uint); ok && status < fiber.StatusBadRequest {
+			return h.db(c).Model(record).Updates(map[string]interface{}{
+				"status":          status,
+				"header":          "{}",
+				"session_user_id": id,
+			}).Error
+		}
+
+		header, err := json.Marshal(responseHeaders(c))
+		if err != nil {
+			return err
+		}
+		return h.db(c).Model(record).Updates(map[string]interface{}{
+			"status": status,
+			"header": string(header),
+			"body":   string(c.Response().Body()),
+		}).Error
+	}
+}
+
+// requestHash returns the HMAC of the method, path and body of the request. The body of a signup
+// has the password, a plain hash of it stored with the key could be guessed.
+func (h *Handler) requestHash(c *fiber.Ctx) string {
+	mac := hmac.New(sha256.New, []byte(h.conf.Auth.Secret))
+	mac.Write([]byte(c.Method() + " " + c.Path() + "\n"))
+	mac.Write(c.Body())
+
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// claimIdempotencyKey stores the key for the request, claimed is false when the key was stored
+// by a previous request, the record is then the one of the previous request
+func (h *Handler) claimIdempotencyKey(c *fiber.Ctx, record *models.IdempotencyKey) (claimed bool, err error) {
+	conn := h.db(c)
+	// the unique index lets one request only claim the key
+	res := conn.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+	if res.Error != nil || res.RowsAffected > 0 {
+		return res.Error == nil, res.Error
+	}
+
+	previous := new(models.IdempotencyKey)
+	if err := conn.Where(map[string]interface{}{"scope": record.Scope, "key": record.Key}).First(previous).Error; err != nil {
+		return false, err
+	}
+
+	// an expired key not purged yet is given to the new request
+	if time.Since(previous.CreatedAt) > models.IdempotencyRetention {
+		if err := conn.Delete(previous).Error; err != nil {
+			return false, err
+		}
+		record.ID = 0
+		res = conn.Clauses(clause.OnConflict{DoNothing: true}).Create(record)
+		if res.Error != nil || res.RowsAffected > 0 {
+			return res.Error == nil, res.Error
+		}
+		return false, models.NewError(fiber.StatusConflict, "A request with this Idempotency-Key is in progress, retry it later")
+	}
+
+	if previous.RequestHash != record.RequestHash {
+		return false, models.NewError(fiber.StatusUnprocessableEntity, "The Idempotency-Key was sent with another request")
+	}
+	*record = *previous
+
+	return false, nil
+}
+
+// replay answers the stored response of the first request with the key. A request which signed a
+// user in is refused rather than given a session: the retry would sign in without the password
+// checks, the second factor or the single sign-on of a login.
+func (h *Handler) replay(c *fiber.Ctx, record *models.IdempotencyKey) error {
+	if record.Status == 0 {
+		return models.NewError(fiber.StatusConflict, "A request with this Idempotency-Key is in progress, retry it later")
+	}
+	c.Set(ReplayedHeader, "true")
+
+	if record.SessionUserID != 0 {
+		return models.NewError(fiber.StatusConflict, "The request with this Idempotency-Key was done, log in to continue")
+	}
+
+	var header map[string][]string
+	if err := json.Unmarshal([]byte(record.Header), &header); err != nil {
+		return err
+	}
+	for name, values := range header {
+		for _, v := range values {
+			c.Set(name, v)
+		}
+	}
+
+	return c.Status(record.Status).SendString(record.Body)
+}
+
+// responseHeaders returns the headers of the response to replay
+func responseHeaders(c *fiber.Ctx) map[string][]string {
+	header := map[string][]string{}
+	for _, name := range replayedHeaders {
+		if v := c.Response().Header.Peek(name); len(v) > 0 {
+			header[name] = []string{string(v)}
+		}
+	}
+	return header
+}
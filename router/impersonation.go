@@ -0,0 +1,128 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/events"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+// handleAdminImpersonate starts acting as a user: it returns a short-lived access token of the user
+// which is not refreshed. The changes made with it are recorded in the activity with the admin, and
+// the credential routes are not allowed with it.
+func (h *Handler) handleAdminImpersonate(c *fiber.Ctx) error {
+	input := new(models.ImpersonationInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	admin, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	u, err := h.findAdminTarget(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusNotFound)
+	}
+	// an admin is not impersonated, its token would act as an admin without the session of one
+	if u.ID == admin.ID || u.Role == models.RoleAdmin {
+		return sendError(c, "Cannot impersonate an admin", fiber.StatusForbidden)
+	}
+	if u.Locked {
+		return sendError(c, "Cannot impersonate a locked user", fiber.StatusConflict)
+	}
+
+	claims, token := h.tokens.GenerateImpersonationToken(strconv.Itoa(int(u.ID)), strconv.Itoa(int(admin.ID)))
+	impersonation := &models.Impersonation{
+		AdminID:   admin.ID,
+		UserID:    u.ID,
+		Reason:    input.Reason,
+		TokenHash: claims.Fingerprint(),
+		ExpiresAt: time.Unix(claims.ExpiresAt, 0),
+	}
+	if res := h.db(c).Create(impersonation); res.Error != nil {
+		return sendError(c, "Cannot start the impersonation", fiber.StatusInternalServerError)
+	}
+
+	h.publishAdminEvent(c, events.UserImpersonated, u, fiber.Map{"impersonationId": impersonation.ID, "reason": input.Reason})
+
+	response := impersonation.Api()
+	response.AccessToken = token
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// handleAdminGetImpersonations lists the impersonations, the latest first, of a user with ?user=
+func (h *Handler) handleAdminGetImpersonations(c *fiber.Ctx) error {
+	limit, offset := paginate(c)
+
+	query := h.db(c).Order("id DESC").Limit(limit).Offset(offset)
+	userID, err := queryID(c, "user")
+	if err != nil {
+		return sendError(c, "Invalid user id", fiber.StatusBadRequest)
+	}
+	if userID != nil {
+		query = query.Where("user_id = ?", *userID)
+	}
+
+	var impersonations []models.Impersonation
+	if res := query.Find(&impersonations); res.Error != nil {
+		return sendError(c, "Cannot find the impersonations", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.ImpersonationApi, 0, len(impersonations))
+	for _, i := range impersonations {
+		response = append(response, i.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// handleAdminEndImpersonation ends an impersonation before it expires, its token is refused from now on
+func (h *Handler) handleAdminEndImpersonation(c *fiber.Ctx) error {
+	impersonation := new(models.Impersonation)
+	if res := h.db(c).Where("id = ?", c.Params("id")).First(impersonation); res.Error != nil {
+		return sendError(c, "Cannot find the impersonation", fiber.StatusNotFound)
+	}
+
+	return h.endImpersonation(c, impersonation)
+}
+
+// EndImpersonation ends the impersonation the request is made with, so the admin can stop acting
+// as the user with its token alone
+func (h *Handler) EndImpersonation(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	if u.ImpersonatorID == 0 {
+		return sendError(c, "Not impersonating the user", fiber.StatusBadRequest)
+	}
+
+	claims := new(models.Claims)
+	if _, err := h.tokens.ParseClaims(util.GetAccessToken(c), claims); err != nil {
+		return sendError(c, "Invalid token", fiber.StatusUnauthorized)
+	}
+	impersonation := new(models.Impersonation)
+	if res := h.db(c).Where("token_hash = ?", claims.Fingerprint()).First(impersonation); res.Error != nil {
+		return sendError(c, "Cannot find the impersonation", fiber.StatusNotFound)
+	}
+
+	return h.endImpersonation(c, impersonation)
+}
+
+func (h *Handler) endImpersonation(c *fiber.Ctx, impersonation *models.Impersonation) error {
+	if impersonation.Active(time.Now()) {
+		now := time.Now()
+		if res := h.db(c).Model(impersonation).Update("ended_at", now); res.Error != nil {
+			return sendError(c, "Cannot end the impersonation", fiber.StatusInternalServerError)
+		}
+
+		if u, err := h.userRepo(c).ByID(impersonation.UserID); err == nil {
+			events.Publish(userEvent(events.ImpersonationEnded, impersonation.AdminID, u, fiber.Map{"impersonationId": impersonation.ID}))
+		}
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
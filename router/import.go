@@ -0,0 +1,412 @@
+package router
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"io"
+	"sort"
+	"strings"
+	"task-app/cache"
+	"task-app/models"
+	"task-app/util"
+)
+
+// importEntry is a task read from an import file, before it is mapped to the models
+type importEntry struct {
+	Row         int
+	Title       string
+	Description string
+	Status      string
+	Project     string
+	Labels      []models.LabelApi
+}
+
+// importRowError is a rejected entry of the import report
+type importRowError struct {
+	Row   int    `json:"row"`
+	Error string `json:"error"`
+}
+
+type importReport struct {
+	Imported int              `json:"imported"`
+	Projects int              `json:"projects"`
+	Labels   int              `json:"labels"`
+	Rejected []importRowError `json:"rejected"`
+}
+
+var importParsers = map[string]func(io.Reader) ([]importEntry, []importRowError, error){
+	"csv":     parseImportCSV,
+	"todoist": parseImportTodoist,
+	"trello":  parseImportTrello,
+}
+
+// handleImportTasks creates personal tasks from an uploaded file of the ?format (or form field) csv, todoist or trello.
+// Projects and labels are matched by name and created when missing.
+// Everything is written in one transaction, entries which cannot be imported are skipped and reported by row.
+func (h *Handler) handleImportTasks(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	format := c.FormValue("format", c.Query("format"))
+	parse, ok := importParsers[format]
+	if !ok {
+		return sendError(c, "Format must be csv, todoist or trello", fiber.StatusBadRequest)
+	}
+
+	fh, err := c.FormFile("file")
+	if err != nil {
+		return sendError(c, "File is required field", fiber.StatusBadRequest)
+	}
+
+	file, err := fh.Open()
+	if err != nil {
+		return sendError(c, "Cannot read the file", fiber.StatusBadRequest)
+	}
+	defer file.Close()
+
+	entries, rejected, err := parse(file)
+	if err != nil {
+		return sendError(c, "Cannot parse the file: "+err.Error(), fiber.StatusBadRequest)
+	}
+
+	report := &importReport{Rejected: rejected}
+	if err := h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		return importEntries(tx, u, entries, report)
+	}); err != nil {
+		if qerr := quotaError(err); qerr != nil {
+			return qerr
+		}
+		return sendError(c, "Cannot import tasks "+err.Error(), fiber.StatusInternalServerError)
+	}
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+
+	if report.Rejected == nil {
+		report.Rejected = []importRowError{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(report)
+}
+
+func importEntries(tx *gorm.DB, u *models.User, entries []importEntry, report *importReport) error {
+	projects := map[string]*models.Project{}
+	labels := map[string]*models.Label{}
+
+	for _, e := range entries {
+		if msg := validateImportEntry(&e); msg != "" {
+			report.Rejected = append(report.Rejected, importRowError{Row: e.Row, Error: msg})
+			continue
+		}
+
+		task := models.Task{
+			Title:       e.Title,
+			Description: e.Description,
+			Status:      e.Status,
+			UserID:      u.ID,
+		}
+
+		if e.Project != "" {
+			p, created, err := importProject(tx, u, projects, e.Project)
+			if err != nil {
+				return err
+			}
+			if created {
+				report.Projects++
+			}
+			task.ProjectID = &p.ID
+		}
+
+		for _, l := range e.Labels {
+			label, created, err := importLabel(tx, u, labels, l)
+			if err != nil {
+				return err
+			}
+			if created {
+				report.Labels++
+			}
+			task.Labels = append(task.Labels, *label)
+		}
+
+		if err := tx.Create(&task).Error; err != nil {
+			return err
+		}
+		report.Imported++
+	}
+
+	return nil
+}
+
+// validateImportEntry checks an entry like the body of a created task, and its labels
+func validateImportEntry(e *importEntry) string {
+	e.Title = strings.TrimSpace(e.Title)
+	if e.Title == "" {
+		return "Title is required field"
+	}
+
+	input := models.TaskInput{Title: e.Title, Description: e.Description, Status: e.Status}
+	if fields := util.Validate(&input); fields != nil {
+		names := make([]string, 0, len(fields))
+		for name := range fields {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+
+		errs := make([]string, 0, len(names))
+		for _, name := range names {
+			errs = append(errs, name+": "+fields[name])
+		}
+		return strings.Join(errs, ", ")
+	}
+
+	for i := range e.Labels {
+		if msg := validateLabel(&e.Labels[i]); msg != "" {
+			return msg
+		}
+	}
+
+	return ""
+}
+
+// importProject returns the personal project of the user with the title, creating it when missing
+func importProject(tx *gorm.DB, u *models.User, cache map[string]*models.Project, title string) (*models.Project, bool, error) {
+	key := strings.ToLower(title)
+	if p, ok := cache[key]; ok {
+		return p, false, nil
+	}
+
+	p := new(models.Project)
+	res := tx.Scopes(models.OwnedBy(u)).Where("workspace_id IS NULL AND LOWER(title) = ?", key).Limit(1).Find(p)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+
+	created := res.RowsAffected == 0
+	if created {
+		p = &models.Project{UserID: u.ID, Title: title}
+		if err := tx.Create(p).Error; err != nil {
+			return nil, false, err
+		}
+	}
+
+	cache[key] = p
+	return p, created, nil
+}
+
+// importLabel returns the label of the user with the name, creating it when missing
+func importLabel(tx *gorm.DB, u *models.User, cache map[string]*models.Label, l models.LabelApi) (*models.Label, bool, error) {
+	key := strings.ToLower(l.Name)
+	if label, ok := cache[key]; ok {
+		return label, false, nil
+	}
+
+	label := new(models.Label)
+	res := tx.Scopes(models.OwnedBy(u)).Where("LOWER(name) = ?", key).Limit(1).Find(label)
+	if res.Error != nil {
+		return nil, false, res.Error
+	}
+
+	created := res.RowsAffected == 0
+	if created {
+		label = &models.Label{UserID: u.ID, Name: l.Name, Color: l.Color}
+		if err := tx.Create(label).Error; err != nil {
+			return nil, false, err
+		}
+	}
+
+	cache[key] = label
+	return label, created, nil
+}
+
+// parseImportCSV reads a CSV file with a header row.
+// The columns title, description, status, project and labels (comma separated) are used, others are ignored,
+// so the CSV export can be imported back.
+func parseImportCSV(r io.Reader) ([]importEntry, []importRowError, error) {
+	in := csv.NewReader(r)
+	in.FieldsPerRecord = -1
+
+	header, err := in.Read()
+	if err != nil {
+		return nil, nil, err
+	}
+
+	columns := map[string]int{}
+	for i, name := range header {
+		columns[strings.ToLower(strings.TrimSpace(name))] = i
+	}
+	if _, ok := columns["title"]; !ok {
+		return nil, nil, errors.New("title column is missing")
+	}
+
+	field := func(record []string, name string) string {
+		if i, ok := columns[name]; ok && i < len(record) {
+			return strings.TrimSpace(record[i])
+		}
+		return ""
+	}
+
+	var entries []importEntry
+	var rejected []importRowError
+	for row := 2; ; row++ {
+		record, err := in.Read()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			rejected = append(rejected, importRowError{Row: row, Error: err.Error()})
+			continue
+		}
+
+		e := importEntry{
+			Row:         row,
+			Title:       field(record, "title"),
+			Description: field(record, "description"),
+			Status:      field(record, "status"),
+			Project:     field(record, "project"),
+		}
+		for _, name := range splitQueryList(field(record, "labels")) {
+			e.Labels = append(e.Labels, models.LabelApi{Name: name})
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rejected, nil
+}
+
+// importID is an identifier of an export which can be either a JSON string or a number
+type importID string
+
+func (id *importID) UnmarshalJSON(b []byte) error {
+	*id = importID(strings.Trim(string(b), `"`))
+	return nil
+}
+
+// parseImportTodoist reads a Todoist backup, the projects and items of the Sync API
+func parseImportTodoist(r io.Reader) ([]importEntry, []importRowError, error) {
+	var backup struct {
+		Projects []struct {
+			ID   importID `json:"id"`
+			Name string   `json:"name"`
+		} `json:"projects"`
+		Items []struct {
+			Content     string   `json:"content"`
+			Description string   `json:"description"`
+			ProjectID   importID `json:"project_id"`
+			Labels      []string `json:"labels"`
+			Checked     bool     `json:"checked"`
+		} `json:"items"`
+	}
+	if err := json.NewDecoder(r).Decode(&backup); err != nil {
+		return nil, nil, err
+	}
+
+	projects := map[importID]string{}
+	for _, p := range backup.Projects {
+		projects[p.ID] = p.Name
+	}
+
+	entries := make([]importEntry, 0, len(backup.Items))
+	var rejected []importRowError
+	for i, item := range backup.Items {
+		project, ok := projects[item.ProjectID]
+		if item.ProjectID != "" && !ok {
+			rejected = append(rejected, importRowError{Row: i + 1, Error: fmt.Sprintf("Unknown project %s", item.ProjectID)})
+			continue
+		}
+
+		e := importEntry{
+			Row:         i + 1,
+			Title:       item.Content,
+			Description: item.Description,
+			Project:     project,
+		}
+		if item.Checked {
+			e.Status = models.StatusDone
+		}
+		for _, name := range item.Labels {
+			e.Labels = append(e.Labels, models.LabelApi{Name: name})
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, rejected, nil
+}
+
+// trelloColors maps the label colors of Trello to #rrggbb
+var trelloColors = map[string]string{
+	"green":  "#61bd4f",
+	"yellow": "#f2d600",
+	"orange": "#ff9f1a",
+	"red":    "#eb5a46",
+	"purple": "#c377e0",
+	"blue":   "#0079bf",
+	"sky":    "#00c2e0",
+	"lime":   "#51e898",
+	"pink":   "#ff78cb",
+	"black":  "#344563",
+}
+
+// parseImportTrello reads the JSON export of a Trello board.
+// The board becomes a project, the cards its tasks with the name of their list as the status.
+func parseImportTrello(r io.Reader) ([]importEntry, []importRowError, error) {
+	var board struct {
+		Name  string `json:"name"`
+		Lists []struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"lists"`
+		Cards []struct {
+			Name        string `json:"name"`
+			Desc        string `json:"desc"`
+			IDList      string `json:"idList"`
+			Closed      bool   `json:"closed"`
+			DueComplete bool   `json:"dueComplete"`
+			Labels      []struct {
+				Name  string `json:"name"`
+				Color string `json:"color"`
+			} `json:"labels"`
+		} `json:"cards"`
+	}
+	if err := json.NewDecoder(r).Decode(&board); err != nil {
+		return nil, nil, err
+	}
+
+	lists := map[string]string{}
+	for _, l := range board.Lists {
+		lists[l.ID] = l.Name
+	}
+
+	entries := make([]importEntry, 0, len(board.Cards))
+	for i, card := range board.Cards {
+		e := importEntry{
+			Row:         i + 1,
+			Title:       card.Name,
+			Description: card.Desc,
+			Status:      strings.ToLower(lists[card.IDList]),
+			Project:     strings.TrimSpace(board.Name),
+		}
+		if card.Closed || card.DueComplete {
+			e.Status = models.StatusDone
+		}
+
+		for _, l := range card.Labels {
+			// Trello labels may have no name, their color is used instead
+			name := l.Name
+			if name == "" {
+				name = l.Color
+			}
+			e.Labels = append(e.Labels, models.LabelApi{Name: name, Color: trelloColors[l.Color]})
+		}
+
+		entries = append(entries, e)
+	}
+
+	return entries, nil, nil
+}
@@ -0,0 +1,188 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"github.com/gofiber/fiber/v2"
+	"mime/multipart"
+	"net/mail"
+	"sort"
+	"strconv"
+	"strings"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/util"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// maxInboxDescription is how many characters of the body of an email are kept
+	maxInboxDescription = 10000
+	// maxInboxSignatureAge is how old a request of Mailgun can be, against replays
+	maxInboxSignatureAge = 5 * time.Minute
+)
+
+func (h *Handler) setupInboxRoutes() {
+	// the emails are posted by Mailgun, its signature is the only authentication
+	INBOX.Post("/mailgun", h.handleInboundEmail)
+}
+
+// CreateInboxAddress creates the inbound email address of the user signed in, the emails sent to it become tasks.
+// A new address replaces the previous one, so a leaked address can be revoked.
+func (h *Handler) CreateInboxAddress(c *fiber.Ctx) error {
+	if h.conf.Inbox.Domain == "" {
+		return sendError(c, "The inbox is not configured", fiber.StatusNotFound)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	token := util.RandomToken(12)
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"inbox_token": util.HashToken(token)}); err != nil {
+		return sendError(c, "Cannot create the inbox address", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"address": token + "@" + h.conf.Inbox.Domain})
+}
+
+// DeleteInboxAddress disables the inbound email address of the user signed in
+func (h *Handler) DeleteInboxAddress(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"inbox_token": ""}); err != nil {
+		return sendError(c, "Cannot delete the inbox address", fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleInboundEmail creates a personal task of an email forwarded by Mailgun: the subject is the title,
+// the text is the description and the allowed attachments are attached. An unknown recipient is
+// answered with 406 so that Mailgun does not retry.
+func (h *Handler) handleInboundEmail(c *fiber.Ctx) error {
+	if h.conf.Inbox.Domain == "" {
+		return sendError(c, "The inbox is not configured", fiber.StatusNotFound)
+	}
+
+	if !h.validMailgunSignature(c.FormValue("timestamp"), c.FormValue("token"), c.FormValue("signature")) {
+		return sendError(c, "Invalid Mailgun signature", fiber.StatusUnauthorized)
+	}
+
+	u := h.inboxUser(c, c.FormValue("recipient"))
+	if u == nil {
+		return sendError(c, "Unknown recipient", fiber.StatusNotAcceptable)
+	}
+
+	title := strings.TrimSpace(c.FormValue("subject"))
+	if title == "" {
+		title = "(no subject)"
+	}
+	description := c.FormValue("stripped-text")
+	if strings.TrimSpace(description) == "" {
+		description = c.FormValue("body-plain")
+	}
+
+	task := models.Task{
+		Title:       truncateRunes(title, 255),
+		Description: truncateRunes(strings.TrimSpace(description), maxInboxDescription),
+		UserID:      u.ID,
+	}
+	if err := h.taskRepo(c).Create(&task); err != nil {
+		return sendError(c, "Cannot create task "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	// an attachment which cannot be kept does not lose the email
+	attached := 0
+	for _, fh := range inboundAttachments(c) {
+		if _, err := h.saveAttachment(c, &task, u, fh); err != nil {
+			logging.FromCtx(c).Warn().Err(err).Uint("task", task.ID).Str("file", fh.Filename).Msg("Attachment of the email skipped")
+			continue
+		}
+		attached++
+	}
+
+	publishTaskEvent(events.TaskCreated, u, &task, task.Api())
+
+	return c.JSON(fiber.Map{"taskId": task.ID, "attachments": attached})
+}
+
+// validMailgunSignature checks the request was signed by Mailgun recently, the signature
+// is the HMAC of the timestamp and the token with the signing key
+func (h *Handler) validMailgunSignature(timestamp, token, signature string) bool {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return false
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > maxInboxSignatureAge || age < -maxInboxSignatureAge {
+		return false
+	}
+
+	mac := hmac.New(sha256.New, []byte(h.conf.Inbox.SigningKey))
+	mac.Write([]byte(timestamp + token))
+	return hmac.Equal([]byte(signature), []byte(hex.EncodeToString(mac.Sum(nil))))
+}
+
+// inboxUser returns the user of the first inbound address of the recipients, nil without one
+func (h *Handler) inboxUser(c *fiber.Ctx, recipients string) *models.User {
+	addresses, err := mail.ParseAddressList(recipients)
+	if err != nil {
+		return nil
+	}
+
+	for _, a := range addresses {
+		at := strings.LastIndexByte(a.Address, '@')
+		if at < 0 || !strings.EqualFold(a.Address[at+1:], h.conf.Inbox.Domain) {
+			continue
+		}
+		u, err := h.userRepo(c).ByInboxToken(util.HashToken(strings.ToLower(a.Address[:at])))
+		if err == nil && !u.Locked {
+			return u
+		}
+	}
+
+	return nil
+}
+
+// inboundAttachments returns the files of the email in their order, attachment-1 first
+func inboundAttachments(c *fiber.Ctx) []*multipart.FileHeader {
+	form, err := c.MultipartForm()
+	if err != nil {
+		return nil
+	}
+
+	names := make([]string, 0, len(form.File))
+	for name := range form.File {
+		if strings.HasPrefix(name, "attachment-") {
+			names = append(names, name)
+		}
+	}
+	sort.Slice(names, func(i, j int) bool {
+		a, _ := strconv.Atoi(strings.TrimPrefix(names[i], "attachment-"))
+		b, _ := strconv.Atoi(strings.TrimPrefix(names[j], "attachment-"))
+		return a < b
+	})
+
+	var files []*multipart.FileHeader
+	for _, name := range names {
+		files = append(files, form.File[name]...)
+	}
+
+	return files
+}
+
+// truncateRunes cuts the text to n characters
+func truncateRunes(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n])
+}
@@ -0,0 +1,14 @@
+package router
+
+import "github.com/gofiber/fiber/v2"
+
+// setupJWKSRoutes publishes the public keys of the RS256 tokens,
+// so other services can verify the access tokens without the secret
+func (h *Handler) setupJWKSRoutes(app *fiber.App) {
+	app.Get("/.well-known/jwks.json", h.handleJWKS)
+}
+
+func (h *Handler) handleJWKS(c *fiber.Ctx) error {
+	c.Set(fiber.HeaderCacheControl, "public, max-age=300")
+	return c.JSON(fiber.Map{"keys": h.tokens.JWKS()})
+}
@@ -0,0 +1,194 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"task-app/cache"
+	"task-app/models"
+	"task-app/util"
+)
+
+func (h *Handler) setupLabelsRoutes() {
+	LABELS.Use(h.tokens.SecureAuth())
+	LABELS.Get("/", h.handleGetLabels)
+	LABELS.Post("/", h.handleCreateLabel)
+	LABELS.Patch("/:id", h.handleUpdateLabel)
+	LABELS.Delete("/:id", h.handleDeleteLabel)
+}
+
+func (h *Handler) handleGetLabels(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	var labels []models.Label
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Order("name").Find(&labels); res.Error != nil {
+		return sendError(c, "Cannot find user's labels", fiber.StatusForbidden)
+	}
+
+	response := make([]models.LabelApi, 0, len(labels))
+	for _, l := range labels {
+		response = append(response, l.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleCreateLabel(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	var l models.LabelApi
+	if err := c.BodyParser(&l); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if msg := validateLabel(&l); msg != "" {
+		return sendError(c, msg, fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	if count := h.db(c).Scopes(models.OwnedBy(u)).Where("name = ?", l.Name).First(new(models.Label)).RowsAffected; count > 0 {
+		return sendError(c, "Label already exists", fiber.StatusBadRequest)
+	}
+
+	label := models.Label{
+		UserID: u.ID,
+		Name:   l.Name,
+		Color:  l.Color,
+	}
+
+	if res := h.db(c).Create(&label); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(label.Api())
+}
+
+func (h *Handler) handleUpdateLabel(c *fiber.Ctx) error {
+	c.Accepts("application/json")
+
+	var l models.LabelApi
+	if err := c.BodyParser(&l); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if msg := validateLabel(&l); msg != "" {
+		return sendError(c, msg, fiber.StatusBadRequest)
+	}
+
+	label, err := h.findUserLabel(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Label", fiber.StatusNotFound)
+	}
+
+	label.Name = l.Name
+	label.Color = l.Color
+
+	if res := h.db(c).Save(label); res.Error != nil {
+		return sendError(c, "Cannot update label "+res.Error.Error(), fiber.StatusForbidden)
+	}
+	if err := models.TouchLabelTasks(h.db(c), label.ID); err != nil {
+		return sendError(c, "Cannot update label "+err.Error(), fiber.StatusInternalServerError)
+	}
+	// the lists carry the labels of their tasks
+	h.cache.Forget(cache.Tasks)
+
+	return c.Status(fiber.StatusOK).JSON(label.Api())
+}
+
+func (h *Handler) handleDeleteLabel(c *fiber.Ctx) error {
+	label, err := h.findUserLabel(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Label", fiber.StatusNotFound)
+	}
+
+	// detach the label from every task before removing it
+	if err := models.TouchLabelTasks(h.db(c), label.ID); err != nil {
+		return sendError(c, "Cannot delete label "+err.Error(), fiber.StatusInternalServerError)
+	}
+	if err := h.db(c).Model(label).Association("Tasks").Clear(); err != nil {
+		return sendError(c, "Cannot delete label "+err.Error(), fiber.StatusForbidden)
+	}
+
+	if res := h.db(c).Delete(label); res.Error != nil {
+		return sendError(c, "Cannot delete label "+res.Error.Error(), fiber.StatusForbidden)
+	}
+	h.cache.Forget(cache.Tasks)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleAttachLabel(c *fiber.Ctx) error {
+	task, label, err := h.findTaskAndLabel(c)
+	if err != nil {
+		return sendError(c, err.Error(), fiber.StatusNotFound)
+	}
+
+	if err := h.taskRepo(c).AddLabel(task, label); err != nil {
+		return sendError(c, "Cannot attach label "+err.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func (h *Handler) handleDetachLabel(c *fiber.Ctx) error {
+	task, label, err := h.findTaskAndLabel(c)
+	if err != nil {
+		return sendError(c, err.Error(), fiber.StatusNotFound)
+	}
+
+	if err := h.taskRepo(c).RemoveLabel(task, label); err != nil {
+		return sendError(c, "Cannot detach label "+err.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func validateLabel(l *models.LabelApi) string {
+	l.Name = strings.TrimSpace(l.Name)
+	if l.Name == "" {
+		return "Label name is required field"
+	}
+	if strings.Contains(l.Name, ",") {
+		return "Label name must not contain commas"
+	}
+	if l.Color != "" && !util.IsHexColor(l.Color) {
+		return "Label color must be in #rrggbb format"
+	}
+
+	return ""
+}
+
+func (h *Handler) findUserLabel(c *fiber.Ctx, id string) (*models.Label, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	label := new(models.Label)
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Where("id = ?", id).First(label); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return label, nil
+}
+
+func (h *Handler) findTaskAndLabel(c *fiber.Ctx) (*models.Task, *models.Label, error) {
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return nil, nil, errors.New("Cannot find the Task")
+	}
+
+	label, err := h.findUserLabel(c, c.Params("labelId"))
+	if err != nil {
+		return nil, nil, errors.New("Cannot find the Label")
+	}
+
+	return task, label, nil
+}
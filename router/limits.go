@@ -0,0 +1,35 @@
+package router
+
+import (
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"strings"
+	"task-app/models"
+	"task-app/storage"
+)
+
+// uploadOverhead leaves room for the multipart encoding and the other fields around an uploaded file
+const uploadOverhead = 1 << 20
+
+// UploadLimit is the largest body of the server, the one of the upload routes. The server closes
+// the connection when a body is larger, the smaller limits are answered by limitBody.
+func UploadLimit() int {
+	return int(storage.MaxUploadSize) + uploadOverhead
+}
+
+// limitBody answers 413 to the bodies larger than the limit, but the multipart ones: they are the
+// uploads, whose files are checked by their routes against STORAGE_MAX_SIZE
+func limitBody(limit int) fiber.Handler {
+	tooLarge := models.NewError(fiber.StatusRequestEntityTooLarge, fmt.Sprintf("The request body is larger than %d bytes", limit))
+
+	return func(c *fiber.Ctx) error {
+		if strings.HasPrefix(c.Get(fiber.HeaderContentType), fiber.MIMEMultipartForm) {
+			return c.Next()
+		}
+		if len(c.Body()) > limit {
+			return tooLarge
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,78 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"time"
+)
+
+// checkLoginAllowed returns the error of a login attempt of the IP, or of the user
+// locked out after failed logins, nil when the attempt is allowed
+func (h *Handler) checkLoginAllowed(c *fiber.Ctx, u *models.User) error {
+	if h.failedLogins.Blocked(c.IP()) {
+		return sendError(c, "Too many failed logins, try again later", fiber.StatusTooManyRequests)
+	}
+
+	if u != nil && u.LockedUntil != nil && u.LockedUntil.After(time.Now()) {
+		c.Set(fiber.HeaderRetryAfter, strconv.Itoa(int(time.Until(*u.LockedUntil).Seconds())+1))
+		return sendError(c, "Account is temporarily locked after too many failed logins", fiber.StatusTooManyRequests)
+	}
+
+	return nil
+}
+
+// loginFailed counts a failed login of the IP, and of the user when the identity is known.
+// After the max failures in a row the user is locked out for the lockout duration. The failures
+// are counted by the database, the concurrent attempts of a user all count.
+func (h *Handler) loginFailed(c *fiber.Ctx, u *models.User) {
+	h.failedLogins.Add(c.IP())
+
+	max := h.conf.Accounts.MaxFailedLogins
+	if u == nil || max <= 0 {
+		return
+	}
+
+	failed, err := h.userRepo(c).AddFailedLogin(u)
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Uint("user", u.ID).Msg("Cannot count the failed login")
+		return
+	}
+	if failed < max {
+		return
+	}
+
+	until := time.Now().Add(h.conf.Accounts.LockoutDuration)
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"failed_logins": 0, "locked_until": until}); err != nil {
+		logging.FromCtx(c).Error().Err(err).Uint("user", u.ID).Msg("Cannot lock out user")
+		return
+	}
+
+	logging.FromCtx(c).Warn().Uint("user", u.ID).Str("ip", c.IP()).Time("until", until).Msg("User locked out after failed logins")
+	events.Publish(userEvent(events.UserLocked, u.ID, u, fiber.Map{
+		"reason":       "failed_logins",
+		"failedLogins": failed,
+		"ip":           c.IP(),
+		"until":        until,
+	}))
+}
+
+// loginSucceeded forgets the failed logins of the user
+func (h *Handler) loginSucceeded(c *fiber.Ctx, u *models.User) {
+	if u.FailedLogins > 0 || u.LockedUntil != nil {
+		h.userRepo(c).Update(u, map[string]interface{}{"failed_logins": 0, "locked_until": nil})
+	}
+}
+
+// userEvent returns an event about the account of u
+func userEvent(kind string, actorID uint, u *models.User, payload interface{}) events.Event {
+	return events.Event{
+		Type:     kind,
+		ActorID:  actorID,
+		TargetID: u.ID,
+		OwnerID:  u.ID,
+		Payload:  payload,
+	}
+}
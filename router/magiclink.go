@@ -0,0 +1,115 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/mailer"
+	"task-app/models"
+	"time"
+)
+
+// magicLinkEmail is the data of the template of the login link email
+type magicLinkEmail struct {
+	T       *i18n.Printer
+	Subject string
+	URL     string
+	Minutes int
+}
+
+// RequestMagicLink emails a login link to the account of the email. The answer is the same
+// whether there is an account or not, so the route does not tell which emails are registered.
+func (h *Handler) RequestMagicLink(c *fiber.Ctx) error {
+	input := new(models.MagicLinkInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	// a demo account sends no emails, and a locked account or one of the single sign-on of
+	// its workspace cannot log in
+	u, err := h.userRepo(c).ByEmail(input.Email)
+	if err != nil || u.Demo() || u.Locked || h.checkSSORequired(c, u) != nil {
+		return c.SendStatus(fiber.StatusAccepted)
+	}
+
+	claims, token := h.tokens.GenerateMagicLinkToken(strconv.Itoa(int(u.ID)))
+	link := models.MagicLink{TokenHash: claims.Fingerprint(), UserID: u.ID, ExpiresAt: time.Unix(claims.ExpiresAt, 0)}
+	if err := h.db(c).Create(&link).Error; err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	sendMagicLink(c, u, h.mailLink("/api/v1/user/login/magic/"+token), h.conf.Auth.MagicLinkTTL)
+
+	return c.SendStatus(fiber.StatusAccepted)
+}
+
+// LoginMagicLink logs the user of a login link in, like a login with the password: a user
+// with 2FA still has to give a code. The link is spent even when the login goes no further.
+func (h *Handler) LoginMagicLink(c *fiber.Ctx) error {
+	if err := h.checkLoginAllowed(c, nil); err != nil {
+		return err
+	}
+
+	claims, err := h.tokens.ParseMagicLinkToken(c.Params("token"))
+	if err != nil {
+		h.loginFailed(c, nil)
+		return sendError(c, "Invalid login link", fiber.StatusUnauthorized)
+	}
+
+	res := h.db(c).Where("token_hash = ? AND expires_at > ?", claims.Fingerprint(), time.Now()).Delete(&models.MagicLink{})
+	if res.Error != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+	if res.RowsAffected == 0 {
+		return sendError(c, "The login link was used already", fiber.StatusUnauthorized)
+	}
+
+	userID, _ := strconv.Atoi(claims.Issuer)
+	u, err := h.userRepo(c).ByID(uint(userID))
+	if err != nil {
+		return sendError(c, "Invalid login link", fiber.StatusUnauthorized)
+	}
+	if err := h.checkLoginAllowed(c, u); err != nil {
+		return err
+	}
+	if err := h.checkSSORequired(c, u); err != nil {
+		return err
+	}
+	if u.Locked {
+		return sendError(c, "Account is locked", fiber.StatusForbidden)
+	}
+
+	// the link was sent to the email of the account
+	if u.EmailVerifiedAt == nil {
+		now := time.Now()
+		if err := h.userRepo(c).Update(u, map[string]interface{}{"email_verified_at": &now}); err != nil {
+			return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+		}
+		u.EmailVerifiedAt = &now
+	}
+	if !u.TOTPEnabled {
+		h.loginSucceeded(c, u)
+	}
+
+	return h.sendLoginResponse(c, u)
+}
+
+func sendMagicLink(c *fiber.Ctx, u *models.User, link string, ttl time.Duration) {
+	p := i18n.For(u.Locale)
+	data := magicLinkEmail{T: p, Subject: p.Text("Your login link"), URL: link, Minutes: int(ttl.Minutes())}
+
+	html, err := mailer.Render("magic_link.html", data)
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("template", "magic_link.html").Msg("Cannot render email")
+		return
+	}
+
+	mailer.Send(mailer.Message{
+		To:      u.Email,
+		Subject: data.Subject,
+		HTML:    html,
+		Text: p.Sprintf("Open the link to log in, it works once within %d minutes:", data.Minutes) + "\n\n" + link + "\n\n" +
+			p.Text("If you did not ask to log in, you can ignore this email.") + "\n",
+	})
+}
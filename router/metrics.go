@@ -0,0 +1,23 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/fiber/v2/middleware/basicauth"
+	"os"
+	"task-app/metrics"
+)
+
+// setupMetricsRoutes exposes the metrics for Prometheus.
+// The endpoint is guarded by basic auth when METRICS_USER and METRICS_PASSWORD are set.
+func setupMetricsRoutes(app *fiber.App) {
+	user, password := os.Getenv("METRICS_USER"), os.Getenv("METRICS_PASSWORD")
+	if user != "" && password != "" {
+		app.Get("/metrics", basicauth.New(basicauth.Config{
+			Users: map[string]string{user: password},
+			Realm: "Metrics",
+		}), metrics.Handler)
+		return
+	}
+
+	app.Get("/metrics", metrics.Handler)
+}
@@ -0,0 +1,280 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/models"
+	"task-app/notifications"
+	"task-app/repository"
+	"task-app/tracing"
+	"time"
+)
+
+func (h *Handler) setupNotificationsRoutes() {
+	// the links of the emails, the signed token is the only authentication
+	NOTIFICATIONS.Get("/unsubscribe/:token", h.handleUnsubscribe)
+	NOTIFICATIONS.Post("/unsubscribe/:token", h.handleUnsubscribe)
+
+	NOTIFICATIONS.Use(h.tokens.SecureAuth())
+	NOTIFICATIONS.Get("/", h.handleGetNotifications)
+	NOTIFICATIONS.Get("/unread-count", h.handleGetUnreadCount)
+	NOTIFICATIONS.Post("/read-all", h.handleReadAllNotifications)
+	NOTIFICATIONS.Get("/preferences", h.handleGetNotificationPreferences)
+	NOTIFICATIONS.Put("/preferences", h.handleUpdateNotificationPreferences)
+	NOTIFICATIONS.Get("/devices", h.handleGetPushDevices)
+	NOTIFICATIONS.Post("/devices", h.handleRegisterPushDevice)
+	NOTIFICATIONS.Delete("/devices/:id", h.handleDeletePushDevice)
+	NOTIFICATIONS.Post("/:id/read", h.handleReadNotification)
+}
+
+// handleGetNotifications returns a page of the notifications of the user, newest first.
+// ?unread=true returns only the unread ones. ?cursor= returns the page of the cursor
+// instead of the page of ?page=, with the nextCursor.
+func (h *Handler) handleGetNotifications(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	page, err := cursorPage(c)
+	if err != nil {
+		return err
+	}
+
+	query := h.db(c).Where("user_id = ?", u.ID)
+	if c.Query("unread") == "true" {
+		query = query.Where("read_at IS NULL")
+	}
+
+	if page != nil {
+		query = query.Scopes(page.Scope("notifications"))
+	} else {
+		limit, offset := paginate(c)
+		query = query.Order("created_at DESC, id DESC").Limit(limit).Offset(offset)
+	}
+
+	var notifications []models.Notification
+	if res := query.Find(&notifications); res.Error != nil {
+		return sendError(c, "Cannot find the notifications", fiber.StatusInternalServerError)
+	}
+
+	var next interface{}
+	if page != nil && page.More(len(notifications)) {
+		notifications = notifications[:page.Limit]
+		last := notifications[len(notifications)-1]
+		next = nextCursor(last.CreatedAt, last.ID)
+	}
+
+	unread, err := h.unreadCount(c, u)
+	if err != nil {
+		return sendError(c, "Cannot count the notifications", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.NotificationApi, 0, len(notifications))
+	for _, n := range notifications {
+		response = append(response, n.Api())
+	}
+
+	if page != nil {
+		return c.JSON(fiber.Map{"unread": unread, "notifications": response, "nextCursor": next})
+	}
+	return c.JSON(fiber.Map{"unread": unread, "notifications": response})
+}
+
+func (h *Handler) handleGetUnreadCount(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	unread, err := h.unreadCount(c, u)
+	if err != nil {
+		return sendError(c, "Cannot count the notifications", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"unread": unread})
+}
+
+// handleReadNotification marks a notification of the user as read, reading it again keeps its first read time
+func (h *Handler) handleReadNotification(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	n := new(models.Notification)
+	if res := h.db(c).Where("id = ? AND user_id = ?", c.Params("id"), u.ID).First(n); res.Error != nil {
+		return sendError(c, "Cannot find the notification", fiber.StatusNotFound)
+	}
+
+	if n.ReadAt == nil {
+		now := time.Now()
+		if res := h.db(c).Model(n).Update("read_at", now); res.Error != nil {
+			return sendError(c, "Cannot update the notification", fiber.StatusInternalServerError)
+		}
+		n.ReadAt = &now
+	}
+
+	return c.JSON(n.Api())
+}
+
+func (h *Handler) handleReadAllNotifications(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	res := h.db(c).Model(&models.Notification{}).
+		Where("user_id = ? AND read_at IS NULL", u.ID).
+		Update("read_at", time.Now())
+	if res.Error != nil {
+		return sendError(c, "Cannot update the notifications", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"read": res.RowsAffected})
+}
+
+// handleGetNotificationPreferences returns the channels of every kind of notification for the user
+func (h *Handler) handleGetNotificationPreferences(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	return h.sendPreferences(c, u)
+}
+
+// handleUpdateNotificationPreferences saves the channels of the kinds given, the others are unchanged
+func (h *Handler) handleUpdateNotificationPreferences(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	input := new(models.PreferencesInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	err = h.notifier.SavePreferences(tracing.Context(c), u.ID, input.Preferences)
+	if err != nil {
+		return sendError(c, "Cannot save the preferences", fiber.StatusInternalServerError)
+	}
+
+	return h.sendPreferences(c, u)
+}
+
+// handleGetPushDevices returns the devices the user receives the push notifications on
+func (h *Handler) handleGetPushDevices(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	var devices []models.PushDevice
+	if res := h.db(c).Where("user_id = ?", u.ID).Order("last_seen_at DESC").Find(&devices); res.Error != nil {
+		return sendError(c, "Cannot find the devices", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.PushDeviceApi, 0, len(devices))
+	for _, d := range devices {
+		response = append(response, d.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// handleRegisterPushDevice saves the push token of a device of the user. The apps register on
+// every start, a token registered again is moved to the user and seen now. A token belongs to
+// the app installed on a device, whoever signs in on it last receives its notifications.
+func (h *Handler) handleRegisterPushDevice(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	input := new(models.PushDeviceInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	// the token may be registered by the user signed in on the device before
+	conn := repository.AllTenants(h.db(c))
+	device := new(models.PushDevice)
+	res := conn.Where("token = ?", input.Token).Limit(1).Find(device)
+	if res.Error != nil {
+		return sendError(c, "Cannot find the device", fiber.StatusInternalServerError)
+	}
+	created := res.RowsAffected == 0
+
+	device.UserID = u.ID
+	device.Provider = input.Provider
+	device.Token = input.Token
+	device.Name = input.Name
+	device.Sandbox = input.Sandbox
+	device.LastSeenAt = time.Now()
+	if err := conn.Save(device).Error; err != nil {
+		return sendError(c, "Cannot save the device", fiber.StatusInternalServerError)
+	}
+
+	if created {
+		return c.Status(fiber.StatusCreated).JSON(device.Api())
+	}
+	return c.JSON(device.Api())
+}
+
+// handleDeletePushDevice stops the push notifications to a device of the user, e.g. when they sign out of the app
+func (h *Handler) handleDeletePushDevice(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	res := h.db(c).Where("id = ? AND user_id = ?", c.Params("id"), u.ID).Delete(&models.PushDevice{})
+	if res.Error != nil {
+		return sendError(c, "Cannot delete the device", fiber.StatusInternalServerError)
+	}
+	if res.RowsAffected == 0 {
+		return sendError(c, "Cannot find the device", fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleUnsubscribe stops the emails of the kind of the unsubscribe link.
+// The link is opened from the email, or posted by the mail client for the one-click unsubscribe.
+func (h *Handler) handleUnsubscribe(c *fiber.Ctx) error {
+	userID, kind, err := notifications.ParseUnsubscribeToken(h.conf.Auth.Secret, c.Params("token"))
+	if err != nil || !containsString(models.NotificationKinds, kind) {
+		return sendError(c, "Invalid unsubscribe link", fiber.StatusNotFound)
+	}
+
+	if _, err := h.userRepo(c).ByID(userID); err != nil {
+		return sendError(c, "Invalid unsubscribe link", fiber.StatusNotFound)
+	}
+
+	if err := h.notifier.Unsubscribe(userID, kind); err != nil {
+		return sendError(c, "Cannot save the preferences", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"kind": kind, "email": false})
+}
+
+func (h *Handler) sendPreferences(c *fiber.Ctx, u *models.User) error {
+	prefs, err := h.notifier.Preferences(u.ID)
+	if err != nil {
+		return sendError(c, "Cannot find the preferences", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.NotificationPreferenceApi, 0, len(prefs))
+	for _, p := range prefs {
+		response = append(response, p.Api())
+	}
+
+	return c.JSON(response)
+}
+
+func (h *Handler) unreadCount(c *fiber.Ctx, u *models.User) (int64, error) {
+	var unread int64
+	err := h.db(c).Model(&models.Notification{}).Where("user_id = ? AND read_at IS NULL", u.ID).Count(&unread).Error
+	return unread, err
+}
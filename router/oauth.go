@@ -0,0 +1,160 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"regexp"
+	"strconv"
+	"strings"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/oauth"
+	"task-app/util"
+	"time"
+)
+
+const oauthStateCookie = "oauth_state"
+
+// stateTTL is how long a login by a provider can take, from the redirect to the callback
+const stateTTL = 10 * time.Minute
+
+func (h *Handler) setupOAuthRoutes() {
+	AUTH.Get("/:provider", h.handleOAuthRedirect)
+	AUTH.Get("/:provider/callback", h.handleOAuthCallback)
+}
+
+// handleOAuthRedirect sends the user to the consent page of the provider
+func (h *Handler) handleOAuthRedirect(c *fiber.Ctx) error {
+	p, ok := oauth.Providers[c.Params("provider")]
+	if !ok {
+		return sendError(c, "Unknown OAuth provider", fiber.StatusNotFound)
+	}
+
+	// the state is bound to the browser by a cookie to prevent login CSRF
+	state := util.RandomToken(16)
+	c.Cookie(h.stateCookie(oauthStateCookie, state))
+
+	return c.Redirect(p.AuthCodeURL(state), fiber.StatusFound)
+}
+
+// stateCookie binds the state of a login by a provider to the browser. It is Lax whatever the
+// SameSite of the config, the provider redirects back from its own site.
+func (h *Handler) stateCookie(name, value string) *fiber.Cookie {
+	cookie := h.tokens.Cookie(name, value, stateTTL)
+	cookie.SameSite = "Lax"
+
+	return cookie
+}
+
+// handleOAuthCallback finishes the flow and logs the user in.
+// A user is found by the linked provider account first, then by a verified email,
+// otherwise a new account is created.
+func (h *Handler) handleOAuthCallback(c *fiber.Ctx) error {
+	p, ok := oauth.Providers[c.Params("provider")]
+	if !ok {
+		return sendError(c, "Unknown OAuth provider", fiber.StatusNotFound)
+	}
+
+	state := c.Cookies(oauthStateCookie)
+	h.tokens.ClearCookies(c, oauthStateCookie)
+	if state == "" || state != c.Query("state") {
+		return sendError(c, "Invalid OAuth state", fiber.StatusForbidden)
+	}
+
+	if c.Query("code") == "" {
+		return sendError(c, "Authorization was denied", fiber.StatusUnauthorized)
+	}
+
+	token, err := p.Exchange(c.Query("code"))
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("provider", p.Name).Msg("OAuth code exchange failed")
+		return sendError(c, "Cannot authorize with "+p.Name, fiber.StatusBadGateway)
+	}
+
+	profile, err := p.Profile(token)
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("provider", p.Name).Msg("OAuth profile request failed")
+		return sendError(c, "Cannot fetch profile from "+p.Name, fiber.StatusBadGateway)
+	}
+
+	u, err := h.findOrCreateOAuthUser(c, p.Name, profile)
+	if err != nil {
+		return sendError(c, err.Error(), fiber.StatusConflict)
+	}
+
+	if err := h.checkSSORequired(c, u); err != nil {
+		return err
+	}
+	if u.Locked {
+		return sendError(c, "Account is locked", fiber.StatusForbidden)
+	}
+
+	return h.sendLoginResponse(c, u)
+}
+
+func (h *Handler) findOrCreateOAuthUser(c *fiber.Ctx, provider string, profile *oauth.Profile) (*models.User, error) {
+	account := new(models.OAuthAccount)
+	if res := h.db(c).Where(&models.OAuthAccount{
+		Provider:   provider,
+		ProviderID: profile.ID,
+	}).First(account); res.RowsAffected > 0 {
+		u, err := h.userRepo(c).ByID(account.UserID)
+		if err != nil {
+			return nil, errors.New("Linked account is deleted")
+		}
+		return u, nil
+	}
+
+	if profile.Email == "" || !profile.EmailVerified {
+		return nil, errors.New("Email is not verified by " + provider)
+	}
+
+	u, err := h.userRepo(c).ByEmail(profile.Email)
+	if err != nil {
+		now := time.Now()
+		u = &models.User{
+			Email:           profile.Email,
+			Username:        h.uniqueUsername(c, profile),
+			DisplayName:     profile.Name,
+			EmailVerifiedAt: &now,
+		}
+		if err := h.userRepo(c).Create(u); err != nil {
+			return nil, err
+		}
+	} else if u.EmailVerifiedAt == nil {
+		// anyone can sign up with an email which is not theirs, the owner of the email would then
+		// log in to an account prepared by someone else
+		return nil, errors.New("An account has this email but it is not verified, log in to it and verify its email first")
+	}
+
+	account = &models.OAuthAccount{
+		UserID:     u.ID,
+		Provider:   provider,
+		ProviderID: profile.ID,
+	}
+	if err := h.db(c).Create(account).Error; err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+var usernameCleanRe = regexp.MustCompile(`[^\w.-]+`)
+
+// uniqueUsername derives a free username from the provider profile
+func (h *Handler) uniqueUsername(c *fiber.Ctx, profile *oauth.Profile) string {
+	base := profile.Username
+	if base == "" {
+		base = strings.Split(profile.Email, "@")[0]
+	}
+	if base = usernameCleanRe.ReplaceAllString(base, ""); base == "" {
+		base = "user"
+	}
+
+	name := base
+	for i := 1; h.userRepo(c).UsernameTaken(name); i++ {
+		name = base + strconv.Itoa(i)
+	}
+
+	return name
+}
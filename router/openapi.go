@@ -0,0 +1,652 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"sort"
+	"strings"
+	"task-app/docs"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/quota"
+	"time"
+)
+
+// the responses sent as a fiber.Map, described for the document
+type (
+	authTokens struct {
+		AccessToken  string `json:"access_token"`
+		RefreshToken string `json:"refresh_token"`
+	}
+	// loginResponse has the tokens, or the challenge of the second factor when it is enabled
+	loginResponse struct {
+		AccessToken       string `json:"access_token,omitempty"`
+		RefreshToken      string `json:"refresh_token,omitempty"`
+		TwoFactorRequired bool   `json:"two_factor_required,omitempty"`
+		ChallengeToken    string `json:"challenge_token,omitempty"`
+	}
+	userSeconds struct {
+		UserID   uint   `json:"userId"`
+		Username string `json:"username"`
+		Seconds  int64  `json:"seconds"`
+	}
+	taskSeconds struct {
+		TaskID  uint   `json:"taskId"`
+		Title   string `json:"title"`
+		Seconds int64  `json:"seconds"`
+	}
+	statsResponse struct {
+		From                     string        `json:"from"`
+		To                       string        `json:"to"`
+		CompletedPerDay          []dayCount    `json:"completedPerDay"`
+		CurrentStreak            int           `json:"currentStreak"`
+		AverageCompletionSeconds int64         `json:"averageCompletionSeconds"`
+		ByLabel                  []groupCount  `json:"byLabel"`
+		ByProject                []groupCount  `json:"byProject"`
+		Burndown                 []burndownDay `json:"burndown,omitempty"`
+	}
+)
+
+// operations documents the routes of /api/v1 by "METHOD path", the path as it is
+// registered. Setup warns about the routes missing here, so a new route is documented
+// with it.
+var operations = map[string]docs.Operation{
+	// user
+	"POST /user/signup": {Summary: "Create an account and log in", Header: idempotencyKey, Body: models.SignupInput{}, Response: authTokens{}, Public: true},
+	"POST /user/demo": {
+		Summary:     "Create a demo account with sample data and log in",
+		Description: "Answers 404 unless demo accounts are enabled. The account and its data are removed once it expires, at its demoExpiresAt.",
+		Response:    authTokens{}, Public: true,
+	},
+	"POST /user/login": {Summary: "Log in with the username and password", Body: models.LoginInput{}, Response: loginResponse{}, Public: true},
+	"POST /user/login/2fa": {Summary: "Finish a login with the code of the second factor", Body: struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}{}, Response: authTokens{}, Public: true},
+	"POST /user/login/magic": {Summary: "Email a login link", Body: models.MagicLinkInput{}, Public: true,
+		Description: "Answers 202 whether the email is registered or not. The link logs in once, within the magicLinkTTL (15 minutes by default)."},
+	"GET /user/login/magic/:token": {Summary: "Log in with the link of the email", Response: loginResponse{}, Public: true,
+		Description: "Sets the cookies of the session like a login with the password, a user with 2FA gets a challenge token instead. The link is spent by the first request."},
+	"GET /user/token": {Summary: "Issue an access token from the refresh token", Response: struct {
+		AccessToken string `json:"access_token"`
+	}{}, Public: true},
+	"GET /user/verify-email/:token": {Summary: "Verify the email of an account", Response: struct {
+		Email string `json:"email"`
+	}{}, Public: true},
+	"GET /user/private/user":    {Summary: "Get the profile", Response: models.UserApi{}},
+	"PATCH /user/private/user":  {Summary: "Update the profile", Body: models.ProfileInput{}, Response: models.UserApi{}},
+	"DELETE /user/private/user": {Summary: "Delete the account"},
+	"POST /user/private/avatar": {Summary: "Upload the avatar", Description: "The image is cropped to a square and resized to 64, 128 and 256 pixels.",
+		Form: []docs.Param{docs.File("file", "A PNG, JPEG or GIF image of at most 4096x4096 pixels")}, Response: models.UserApi{}},
+	"DELETE /user/private/avatar":        {Summary: "Delete the avatar, the one of Gravatar is shown again", Response: models.UserApi{}},
+	"DELETE /user/private/impersonation": {Summary: "End the impersonation of the token, when an admin acts as the user"},
+	"POST /user/private/stream-ticket": {Summary: "Create a ticket opening one WebSocket or event stream",
+		Description: "Browsers cannot set the Authorization header on them, the ticket is passed as ticket instead. It works once within 30 seconds.",
+		Response:    models.StreamTicketApi{}},
+	"GET /user/private/activity": {Summary: "List the activity of the user", Description: cursorDescription("activity"), Query: activityPage, Response: []models.ActivityApi{}},
+	"POST /user/private/password": {Summary: "Change the password", Body: struct {
+		CurrentPassword string `json:"currentPassword" validate:"required"`
+		NewPassword     string `json:"newPassword" validate:"required"`
+	}{}, Response: authTokens{}},
+	"POST /user/private/2fa/setup": {Summary: "Generate the TOTP secret of the second factor", Response: struct {
+		Secret     string `json:"secret"`
+		OTPAuthURL string `json:"otpauth_url"`
+	}{}},
+	"POST /user/private/2fa/verify": {Summary: "Enable the second factor with a first code", Body: struct {
+		Code string `json:"code"`
+	}{}, Response: struct {
+		BackupCodes []string `json:"backup_codes"`
+	}{}},
+	"POST /user/private/2fa/disable": {Summary: "Disable the second factor", Body: struct {
+		Password string `json:"password"`
+	}{}},
+	"GET /user/private/sessions":           {Summary: "List the sessions", Response: []models.SessionApi{}},
+	"DELETE /user/private/sessions/others": {Summary: "Revoke the sessions but the current one"},
+	"DELETE /user/private/sessions/:id":    {Summary: "Revoke a session"},
+	"POST /user/private/export": {Summary: "Export all the data of the user as a ZIP of JSON files, built in the background",
+		Response: models.DataExportApi{}},
+	"GET /user/private/export":     {Summary: "List the data exports, a ready one has a download link", Response: []models.DataExportApi{}},
+	"GET /user/private/export/:id": {Summary: "Get a data export", Response: models.DataExportApi{}},
+	"GET /user/private/api-keys":   {Summary: "List the API keys", Response: []models.APIKeyApi{}},
+	"POST /user/private/api-keys": {Summary: "Create an API key, the key is only shown in this response", Body: struct {
+		Name   string   `json:"name"`
+		Scopes []string `json:"scopes"`
+	}{}, Response: models.APIKeyApi{}},
+	"DELETE /user/private/api-keys/:id": {Summary: "Revoke an API key"},
+	"POST /user/private/calendar": {Summary: "Create the private calendar feed of the due tasks", Response: struct {
+		URL string `json:"url"`
+	}{}},
+	"DELETE /user/private/calendar": {Summary: "Delete the calendar feed"},
+	"GET /user/private/shares":      {Summary: "List the share links", Response: []models.ShareApi{}},
+	"POST /user/private/shares": {
+		Summary:     "Create a read-only link to a project or a filtered list, the link is only shown in this response",
+		Description: "A link with a password asks for it with HTTP basic authentication, the username is ignored.",
+		Body:        models.ShareInput{}, Response: models.ShareApi{},
+	},
+	"DELETE /user/private/shares/:id": {Summary: "Revoke a share link"},
+	"POST /user/private/inbox": {Summary: "Create the address turning the emails into tasks", Response: struct {
+		Address string `json:"address"`
+	}{}},
+	"DELETE /user/private/inbox": {Summary: "Delete the inbound address"},
+	"GET /user/private/telegram": {Summary: "Get the linked Telegram account", Response: models.TelegramAccountApi{}},
+	"POST /user/private/telegram": {Summary: "Create a code to link a Telegram account", Response: struct {
+		Code      string    `json:"code"`
+		Command   string    `json:"command"`
+		ExpiresAt time.Time `json:"expiresAt"`
+	}{}},
+	"DELETE /user/private/telegram": {Summary: "Unlink the Telegram account"},
+
+	// tasks
+	"GET /tasks": {Summary: "List the tasks", Query: []docs.Param{
+		docs.Query("filter", "assigned for the tasks assigned to the user, created for the ones it created"),
+		docs.Query("labels", "Comma separated label names, the tasks carrying any of them"),
+		docs.Query("status", "The status of the tasks, todo matches the tasks without a status too"),
+		docs.Query("sort", "position (the default), priority or due"),
+		docs.Query("workspace", "The id of a workspace"),
+		docs.Query("project", "The id of a project"),
+		docs.Query("due", "overdue, today or week for the open tasks due before the end of the day or the week"),
+		includeArchivedParam,
+		tzParam,
+		docs.Query("cursor", "The nextCursor of the previous page, empty for the first page; it cannot be sorted"),
+		docs.Query("limit", "The page size of a cursor, 50 by default"),
+	}, Header: ifNoneMatch, Description: cursorDescription("tasks"), Response: []models.TaskApi{}},
+	"POST /tasks": {Summary: "Create a task", Header: idempotencyKey, Body: models.TaskInput{}, Response: models.TaskApi{}},
+	"PATCH /tasks": {Summary: "Update the task of the id of the body", Description: "The version of the body is the version of the task the update was made from. " +
+		"When the task was changed since, the update answers 409 with the current task in the current field of the error.",
+		Header: ifMatch, Body: models.TaskInput{}, Response: models.TaskApi{}},
+	"POST /tasks/quickadd": {Summary: "Create a task from a line of text", Description: "The text is like Pay rent tomorrow 5pm #finance !p1 every month: " +
+		"#label adds a label, created when missing, !p1 to !p4 is the priority, a day like today, tomorrow, friday, next week, in 3 days, Oct 20 or 2026-10-20 " +
+		"and a time like 5pm or 17:30 are the due date in the zone of the user, every day, every weekday, every 2 weeks, every monday or every month is the recurrence. " +
+		"The other words are the title.",
+		Header: idempotencyKey, Body: models.QuickAddInput{}, Query: []docs.Param{tzParam}, Response: models.TaskApi{}},
+	"POST /tasks/archive": {Summary: "Archive the tasks completed more than olderThanDays ago", Body: models.ArchiveDoneInput{}, Response: struct {
+		Archived int64 `json:"archived"`
+	}{}},
+	"PUT /tasks/reorder": {Summary: "Reorder the tasks", Body: models.ReorderInput{}, Response: []models.TaskApi{}},
+	"POST /tasks/bulk": {Summary: "Change tasks in bulk", Description: "The operations are applied in one transaction, in their order. " +
+		"A failed operation is rolled back alone, its result has the status and the error it would have been answered with.",
+		Body: models.BulkInput{}, Response: struct {
+			Results []models.BulkResult `json:"results"`
+		}{}},
+	"GET /tasks/export": {Summary: "Export the tasks", Query: []docs.Param{
+		docs.Query("format", "json (the default) or csv"),
+		docs.Query("project", "The id of a project"),
+		docs.Query("status", "A status"),
+		docs.Query("from", "The first creation date, as 2006-01-02"),
+		docs.Query("to", "The last creation date, as 2006-01-02"),
+		tzParam,
+	}, ContentType: "text/csv"},
+	"POST /tasks/import": {Summary: "Import tasks from a CSV or JSON export", Form: []docs.Param{
+		docs.File("file", "The export"),
+		docs.Query("format", "csv or json, from the file extension when it is missing"),
+	}, Header: idempotencyKey, Response: importReport{}},
+	"GET /tasks/:id":                        {Summary: "Get a task", Header: ifNoneMatch, Response: models.TaskApi{}},
+	"GET /tasks/trash":                      {Summary: "List the deleted tasks", Response: []models.TaskApi{}},
+	"DELETE /tasks/:id":                     {Summary: "Move a task to the trash"},
+	"POST /tasks/:id/restore":               {Summary: "Restore a task from the trash", Response: models.TaskApi{}},
+	"POST /tasks/:id/archive":               {Summary: "Archive a task, it is left out of the lists and the search", Response: models.TaskApi{}},
+	"POST /tasks/:id/unarchive":             {Summary: "Unarchive a task", Response: models.TaskApi{}},
+	"POST /tasks/:id/template":              {Summary: "Save a task as a template", Body: models.TaskTemplateInput{}, Response: models.TemplateApi{}},
+	"POST /tasks/:id/labels/:labelId":       {Summary: "Attach a label", Response: models.TaskApi{}},
+	"DELETE /tasks/:id/labels/:labelId":     {Summary: "Detach a label", Response: models.TaskApi{}},
+	"POST /tasks/:id/assignee":              {Summary: "Assign a task", Body: taskUserInput{}, Response: models.TaskApi{}},
+	"DELETE /tasks/:id/assignee":            {Summary: "Unassign a task", Response: models.TaskApi{}},
+	"GET /tasks/:id/watchers":               {Summary: "List the watchers", Response: []models.MemberApi{}},
+	"POST /tasks/:id/watchers":              {Summary: "Add a watcher, the user itself without a body", Body: taskUserInput{}, Response: models.TaskApi{}},
+	"DELETE /tasks/:id/watchers/:userId":    {Summary: "Remove a watcher", Response: models.TaskApi{}},
+	"GET /tasks/:id/activity":               {Summary: "List the activity of a task", Description: cursorDescription("activity"), Query: activityPage, Response: []models.ActivityApi{}},
+	"GET /tasks/:id/history":                {Summary: "List the revisions of a task, the latest first, with the fields they changed", Query: pageParams, Response: []models.TaskRevisionApi{}},
+	"POST /tasks/:id/revert/:revision":      {Summary: "Restore the content of a task as it was before a revision", Description: revertDescription, Header: ifMatch, Response: models.TaskApi{}},
+	"GET /tasks/:id/comments":               {Summary: "List the comments", Response: []models.CommentApi{}},
+	"POST /tasks/:id/comments":              {Summary: "Comment a task, the @usernames are mentioned", Body: models.CommentApi{}, Response: models.CommentApi{}},
+	"DELETE /tasks/:id/comments/:commentId": {Summary: "Delete a comment"},
+	"GET /tasks/:id/dependencies": {Summary: "List the blocking and blocked tasks", Response: struct {
+		BlockedBy []models.TaskApi `json:"blockedBy"`
+		Blocks    []models.TaskApi `json:"blocks"`
+	}{}},
+	"POST /tasks/:id/dependencies":              {Summary: "Block a task by another task", Body: models.DependencyInput{}, Response: models.TaskApi{}},
+	"DELETE /tasks/:id/dependencies/:blockerId": {Summary: "Remove a blocking task", Response: models.TaskApi{}},
+	"POST /tasks/:id/timer/start":               {Summary: "Start the timer of a task", Body: models.TimerInput{}, Response: models.TimeEntryApi{}},
+	"POST /tasks/:id/timer/stop":                {Summary: "Stop the timer of a task", Response: models.TimeEntryApi{}},
+	"GET /tasks/:id/time": {Summary: "Get the time spent on a task", Response: struct {
+		TotalSeconds int64                 `json:"totalSeconds"`
+		ByUser       []userSeconds         `json:"byUser"`
+		Entries      []models.TimeEntryApi `json:"entries"`
+	}{}},
+	"POST /tasks/:id/time":                        {Summary: "Log time on a task", Body: models.TimeEntryInput{}, Response: models.TimeEntryApi{}},
+	"DELETE /tasks/:id/time/:entryId":             {Summary: "Delete a time entry"},
+	"GET /tasks/:id/checklist":                    {Summary: "Get the checklist", Response: checklist{}},
+	"POST /tasks/:id/checklist":                   {Summary: "Add a checklist item", Body: models.ChecklistItemInput{}, Response: checklist{}},
+	"PUT /tasks/:id/checklist/reorder":            {Summary: "Reorder the checklist", Body: models.ReorderInput{}, Response: checklist{}},
+	"PATCH /tasks/:id/checklist/:itemId":          {Summary: "Update a checklist item", Body: models.ChecklistItemInput{}, Response: checklist{}},
+	"POST /tasks/:id/checklist/:itemId/toggle":    {Summary: "Check or uncheck a checklist item", Response: checklist{}},
+	"DELETE /tasks/:id/checklist/:itemId":         {Summary: "Delete a checklist item", Response: checklist{}},
+	"GET /tasks/:id/attachments":                  {Summary: "List the attachments", Response: []models.AttachmentApi{}},
+	"POST /tasks/:id/attachments":                 {Summary: "Upload an attachment", Form: []docs.Param{docs.File("file", "The attached file")}, Response: models.AttachmentApi{}},
+	"DELETE /tasks/:id/attachments/:attachmentId": {Summary: "Delete an attachment"},
+
+	// labels
+	"GET /labels":        {Summary: "List the labels", Response: []models.LabelApi{}},
+	"POST /labels":       {Summary: "Create a label", Body: models.LabelApi{}, Response: models.LabelApi{}},
+	"PATCH /labels/:id":  {Summary: "Update a label", Body: models.LabelApi{}, Response: models.LabelApi{}},
+	"DELETE /labels/:id": {Summary: "Delete a label"},
+
+	// attachments
+	"GET /avatars/:id/:size": {Summary: "Redirect to the avatar of a user", Description: "The size is 64, 128 or 256, the user without an uploaded avatar is redirected to Gravatar."},
+	"GET /attachments/download": {Summary: "Download an attachment from its signed URL", Query: []docs.Param{
+		docs.Query("key", "The storage key"),
+		docs.Query("expires", "The expiry of the URL"),
+		docs.Query("signature", "The signature of the URL"),
+	}, ContentType: "application/octet-stream", Public: true},
+
+	// auth
+	"GET /auth/:provider":          {Summary: "Log in with an OAuth provider", Redirect: true, Public: true},
+	"GET /auth/:provider/callback": {Summary: "Finish an OAuth login", Response: loginResponse{}, Public: true},
+	"GET /auth/sso/:workspace": {Summary: "Log in with the single sign-on of a workspace", Redirect: true, Public: true,
+		Description: "Redirects to the OIDC issuer or the SAML IdP of the workspace, the loginUrl of its single sign-on."},
+	"GET /auth/sso/:workspace/callback": {Summary: "Finish an OIDC login, the redirect URI of the issuer", Response: loginResponse{}, Public: true},
+	"POST /auth/sso/:workspace/acs": {Summary: "Finish a SAML login, the assertion consumer service the IdP posts its response to", Response: loginResponse{}, Public: true,
+		Description: "The form carries the SAMLResponse and the RelayState of the HTTP-POST binding. The response or its assertion must be signed by the certificate of the IdP."},
+	"GET /auth/sso/:workspace/metadata": {Summary: "Get the SAML metadata of the server to configure the IdP with", ContentType: "application/samlmetadata+xml", Public: true},
+
+	// workspaces
+	"GET /workspaces":                          {Summary: "List the workspaces of the user", Response: []models.WorkspaceApi{}},
+	"POST /workspaces":                         {Summary: "Create a workspace", Body: models.WorkspaceApi{}, Response: models.WorkspaceApi{}},
+	"POST /workspaces/invites/:token/accept":   {Summary: "Join a workspace with an invite", Response: models.WorkspaceApi{}},
+	"PATCH /workspaces/:id":                    {Summary: "Update a workspace", Body: models.WorkspaceApi{}, Response: models.WorkspaceApi{}},
+	"DELETE /workspaces/:id":                   {Summary: "Delete a workspace"},
+	"GET /workspaces/:id/members":              {Summary: "List the members", Response: []models.MemberApi{}},
+	"PATCH /workspaces/:id/members/:userId":    {Summary: "Change the role of a member", Body: models.MemberApi{}, Response: models.MemberApi{}},
+	"DELETE /workspaces/:id/members/:userId":   {Summary: "Remove a member"},
+	"GET /workspaces/:id/invites":              {Summary: "List the pending invites", Response: []models.InviteApi{}},
+	"POST /workspaces/:id/invites":             {Summary: "Invite someone by email", Body: models.InviteApi{}, Response: models.InviteApi{}},
+	"DELETE /workspaces/:id/invites/:inviteId": {Summary: "Delete an invite"},
+	"GET /workspaces/:id/usage":                {Summary: "Get the usage of the workspace against the limits of its plan", Response: quota.Usage{}},
+	"GET /workspaces/:id/sso":                  {Summary: "Get the single sign-on of the workspace", Response: models.WorkspaceSSOApi{}},
+	"PUT /workspaces/:id/sso": {Summary: "Configure the single sign-on of the workspace with an OIDC issuer or a SAML IdP", Body: models.WorkspaceSSOInput{},
+		Response: models.WorkspaceSSOApi{}, Description: "Only the owners can configure it. The client secret is kept when it is empty. Users signing in " +
+			"for the first time are created with the defaultRole when provision is set. Enforcing it signs the members out, and refuses " +
+			"their other logins with a 403 carrying the loginUrl; the owners keep them."},
+	"DELETE /workspaces/:id/sso": {Summary: "Remove the single sign-on of the workspace, the accounts it created are kept"},
+	"POST /workspaces/:id/sso/link": {Summary: "Link the account to the single sign-on of the workspace", Response: struct {
+		URL string `json:"url"`
+	}{}, Description: "Returns the URL of the provider to open. Its login links the identity to the account, an account already " +
+		"registered with the email is never linked otherwise. An identity linked to another account is refused with a 409."},
+
+	// projects
+	"GET /projects": {Summary: "List the projects", Query: []docs.Param{
+		docs.Query("workspace", "The id of a workspace"),
+		includeArchivedParam,
+	}, Header: ifNoneMatch, Response: []models.ProjectApi{}},
+	"POST /projects":               {Summary: "Create a project", Body: models.ProjectApi{}, Response: models.ProjectApi{}},
+	"GET /projects/:id":            {Summary: "Get a project", Header: ifNoneMatch, Response: models.ProjectApi{}},
+	"PATCH /projects/:id":          {Summary: "Update a project", Header: ifMatch, Body: models.ProjectApi{}, Response: models.ProjectApi{}},
+	"DELETE /projects/:id":         {Summary: "Delete a project"},
+	"POST /projects/:id/archive":   {Summary: "Archive a project, its tasks are left out of the lists with it", Response: models.ProjectApi{}},
+	"POST /projects/:id/unarchive": {Summary: "Unarchive a project", Response: models.ProjectApi{}},
+	"GET /projects/:id/board": {Summary: "Get the kanban board", Query: []docs.Param{
+		docs.Query("column", "Only the column of a status"),
+	}, Response: models.BoardApi{}},
+	"POST /projects/:id/board/move":         {Summary: "Move a card of the board", Body: models.BoardMoveInput{}, Response: models.TaskApi{}},
+	"GET /projects/:id/integrations/github": {Summary: "Get the GitHub repository linked to a project", Response: models.GitHubIntegrationApi{}},
+	"PUT /projects/:id/integrations/github": {Summary: "Link a project to a GitHub repository", Description: "The secret of the webhook " +
+		"of the repository is sent when the repository is first linked, the webhook sends the issues events as JSON to webhookUrl.",
+		Body: models.GitHubIntegrationInput{}, Response: models.GitHubIntegrationApi{}},
+	"DELETE /projects/:id/integrations/github":      {Summary: "Unlink the GitHub repository of a project, the tasks of its issues are kept"},
+	"POST /projects/:id/integrations/github/import": {Summary: "Import the open issues of the GitHub repository as tasks", Response: githubImportReport{}},
+
+	// search
+	"GET /search": {
+		Summary:     "Search the tasks and comments",
+		Description: "With the encryption at rest on, only the titles are searched: the descriptions and the comments are encrypted in the database.",
+		Query: []docs.Param{
+			{Name: "q", Description: "The words searched", Required: true},
+			includeArchivedParam,
+		}, Response: []models.SearchResult{}},
+
+	// webhooks
+	"GET /webhooks":                {Summary: "List the webhooks", Response: []models.WebhookApi{}},
+	"POST /webhooks":               {Summary: "Create a webhook, the secret is only shown in this response", Body: models.WebhookApi{}, Response: models.WebhookApi{}},
+	"PATCH /webhooks/:id":          {Summary: "Update a webhook", Body: models.WebhookApi{}, Response: models.WebhookApi{}},
+	"DELETE /webhooks/:id":         {Summary: "Delete a webhook"},
+	"GET /webhooks/:id/deliveries": {Summary: "List the last deliveries", Response: []models.WebhookDeliveryApi{}},
+
+	// events
+	"GET /events": {
+		Summary:     "Stream the events of the user",
+		Description: "Server-Sent Events, resumed from the Last-Event-ID header or lastEventId. Browsers pass a ticket of POST /user/private/stream-ticket in ticket.",
+		Query:       []docs.Param{docs.Query("ticket", "A stream ticket"), docs.Query("lastEventId", "The last event received")},
+		ContentType: "text/event-stream",
+	},
+
+	// calendar
+	"GET /calendar/:token.ics": {Summary: "The calendar feed of the due tasks", ContentType: "text/calendar", Public: true},
+
+	// share links
+	"GET /shared/:slug": {
+		Summary:     "The tasks of a share link",
+		Description: "A page to embed with format=html or an Accept of text/html. A protected link asks for its password with HTTP basic authentication.",
+		Query:       []docs.Param{docs.Query("format", "html for a page, json by default")},
+		Response:    models.SharedListApi{}, Public: true,
+	},
+
+	// templates
+	"GET /templates": {Summary: "List the templates", Query: []docs.Param{
+		docs.Query("workspace", "The id of a workspace"),
+	}, Response: []models.TemplateApi{}},
+	"POST /templates":                 {Summary: "Create a template", Body: models.TemplateInput{}, Response: models.TemplateApi{}},
+	"GET /templates/:id":              {Summary: "Get a template", Response: models.TemplateApi{}},
+	"PATCH /templates/:id":            {Summary: "Update a template", Body: models.TemplateInput{}, Response: models.TemplateApi{}},
+	"DELETE /templates/:id":           {Summary: "Delete a template"},
+	"POST /templates/:id/instantiate": {Summary: "Create a task from a template", Body: models.InstantiateInput{}, Response: models.TaskApi{}},
+
+	// filters
+	"GET /filters":        {Summary: "List the saved filters", Response: []models.FilterApi{}},
+	"POST /filters":       {Summary: "Save a filter", Description: filterQueryDescription, Body: models.FilterInput{}, Response: models.FilterApi{}},
+	"GET /filters/:id":    {Summary: "Get a saved filter", Response: models.FilterApi{}},
+	"PATCH /filters/:id":  {Summary: "Update a saved filter", Description: filterQueryDescription, Body: models.FilterInput{}, Response: models.FilterApi{}},
+	"DELETE /filters/:id": {Summary: "Delete a saved filter"},
+	"GET /filters/:id/tasks": {Summary: "List the tasks matching a saved filter", Header: ifNoneMatch, Query: []docs.Param{
+		tzParam,
+		includeArchivedParam,
+	}, Response: []models.TaskApi{}},
+
+	// time
+	"GET /time": {Summary: "List the time entries of the user", Query: []docs.Param{
+		docs.Query("from", "The first day, as 2006-01-02"),
+		docs.Query("to", "The last day, as 2006-01-02"),
+		tzParam,
+	}, Response: []models.TimeEntryApi{}},
+	"GET /time/summary": {Summary: "Sum the time of the user by task", Query: []docs.Param{
+		docs.Query("from", "The first day, as 2006-01-02"),
+		docs.Query("to", "The last day, as 2006-01-02"),
+		tzParam,
+	}, Response: struct {
+		TotalSeconds int64                `json:"totalSeconds"`
+		ByTask       []taskSeconds        `json:"byTask"`
+		Running      *models.TimeEntryApi `json:"running"`
+	}{}},
+	"GET /time/timesheet": {Summary: "Export the timesheet of a week", Query: []docs.Param{
+		docs.Query("week", "The week, as 2006-W01, the current one by default"),
+		tzParam,
+	}, ContentType: "text/csv"},
+
+	// stats
+	"GET /stats": {Summary: "Get the statistics of the completed tasks", Query: []docs.Param{
+		docs.Query("from", "The first day, as 2006-01-02"),
+		docs.Query("to", "The last day, as 2006-01-02"),
+		docs.Query("project", "The id of a project, adds its burndown"),
+		tzParam,
+	}, Response: statsResponse{}},
+
+	// notifications
+	"GET /notifications": {Summary: "List the notifications", Query: []docs.Param{
+		docs.Query("unread", "true for the unread ones only"),
+		docs.Query("cursor", "The nextCursor of the previous page, empty for the first page"),
+		docs.Query("limit", "The page size, 50 by default"),
+		docs.Query("page", "The page, from 1, without a cursor"),
+	}, Response: struct {
+		Unread        int64                    `json:"unread"`
+		Notifications []models.NotificationApi `json:"notifications"`
+		// NextCursor is sent with a cursor, null on the last page
+		NextCursor *string `json:"nextCursor,omitempty"`
+	}{}},
+	"GET /notifications/unread-count": {Summary: "Count the unread notifications", Response: struct {
+		Unread int64 `json:"unread"`
+	}{}},
+	"POST /notifications/read-all": {Summary: "Mark every notification read", Response: struct {
+		Read int64 `json:"read"`
+	}{}},
+	"GET /notifications/preferences": {Summary: "Get the notification preferences", Response: []models.NotificationPreferenceApi{}},
+	"PUT /notifications/preferences": {Summary: "Update the notification preferences", Body: models.PreferencesInput{}, Response: []models.NotificationPreferenceApi{}},
+	"POST /notifications/:id/read":   {Summary: "Mark a notification read", Response: models.NotificationApi{}},
+	"GET /notifications/devices":     {Summary: "List the devices of the push notifications", Response: []models.PushDeviceApi{}},
+	"POST /notifications/devices": {Summary: "Register a device for the push notifications", Body: models.PushDeviceInput{}, Response: models.PushDeviceApi{},
+		Description: "The apps register the token of FCM or APNs on every start. Answers 201 for a new token, 200 for a token registered again, which moves it to the user. The devices not registered for 270 days are removed."},
+	"DELETE /notifications/devices/:id": {Summary: "Stop the push notifications to a device"},
+	"GET /notifications/unsubscribe/:token": {Summary: "Unsubscribe from the emails of a kind of notification", Response: struct {
+		Kind  string `json:"kind"`
+		Email bool   `json:"email"`
+	}{}, Public: true},
+	"POST /notifications/unsubscribe/:token": {Summary: "Unsubscribe with one click (RFC 8058)", Response: struct {
+		Kind  string `json:"kind"`
+		Email bool   `json:"email"`
+	}{}, Public: true},
+
+	// integrations
+	"GET /integrations/slack": {Summary: "Get the Slack installation of a workspace", Query: []docs.Param{
+		docs.Query("workspace", "The id of the workspace"),
+	}, Response: models.SlackInstallationApi{}},
+	"DELETE /integrations/slack": {Summary: "Uninstall Slack from a workspace", Query: []docs.Param{
+		docs.Query("workspace", "The id of the workspace"),
+	}},
+	"GET /integrations/slack/install": {Summary: "Install Slack in a workspace", Query: []docs.Param{
+		docs.Query("workspace", "The id of the workspace"),
+	}, Redirect: true},
+	"GET /integrations/slack/callback": {Summary: "Finish the installation of Slack", Response: models.SlackInstallationApi{}},
+	"POST /integrations/slack/commands": {Summary: "The /tasker command of Slack, signed by Slack", Response: struct {
+		ResponseType string `json:"response_type"`
+		Text         string `json:"text"`
+	}{}, Public: true},
+	"POST /integrations/github/webhook": {Summary: "The issues events of the webhook of a GitHub repository, signed by GitHub", Public: true},
+
+	// inbox
+	"POST /inbox/mailgun": {Summary: "Create a task from an email forwarded by Mailgun", Form: []docs.Param{
+		docs.Query("recipient", "The inbound address"),
+		docs.Query("subject", "The title of the task"),
+		docs.Query("stripped-text", "The description of the task"),
+		docs.Query("timestamp", "The timestamp of the signature"),
+		docs.Query("token", "The token of the signature"),
+		docs.Query("signature", "The signature of Mailgun"),
+	}, Response: struct {
+		TaskID      uint `json:"taskId"`
+		Attachments int  `json:"attachments"`
+	}{}, Public: true},
+
+	// graphql
+	"GET /graphql": {Summary: "Run a GraphQL query", Query: []docs.Param{
+		{Name: "query", Description: "The query", Required: true},
+		docs.Query("variables", "The variables, as JSON"),
+	}, Response: graphQLResponse{}},
+	"POST /graphql": {Summary: "Run a GraphQL query", Body: struct {
+		Query         string                 `json:"query" validate:"required"`
+		OperationName string                 `json:"operationName"`
+		Variables     map[string]interface{} `json:"variables"`
+	}{}, Response: graphQLResponse{}},
+
+	// sync
+	"GET /sync": {Summary: "Read the changes since the previous sync", Description: "The feed has the tasks, projects and labels " +
+		"changed since the token, and the tombstones of the deleted ones. A sync without a token sends every entity. " +
+		"The token of the feed is the since of the next sync, an expired token answers 410.",
+		Query: []docs.Param{
+			docs.Query("since", "The token of the previous sync"),
+		}, Response: models.SyncFeed{}},
+	"POST /sync": {Summary: "Apply the changes made offline", Description: "The changes are applied in one transaction, in their order. " +
+		"A change of a task is made from its version, a change of a project or a label from its updatedAt. " +
+		"When the entity was changed or deleted since, the change is not applied and its result is a conflict with the entity as the server has it.",
+		Header: idempotencyKey, Body: models.SyncInput{}, Response: struct {
+			Results []models.SyncResult `json:"results"`
+		}{}},
+
+	// admin
+	"GET /admin/users": {Summary: "List the users", Query: []docs.Param{
+		docs.Query("limit", "The page size, 50 by default"),
+		docs.Query("page", "The page, from 1"),
+	}, Response: []models.UserAdminApi{}},
+	"POST /admin/users/:id/lock":   {Summary: "Lock a user"},
+	"POST /admin/users/:id/unlock": {Summary: "Unlock a user"},
+	"PATCH /admin/users/:id/role": {Summary: "Change the role of a user", Body: struct {
+		Role string `json:"role" validate:"required"`
+	}{}},
+	"POST /admin/impersonate/:id": {
+		Summary:     "Act as a user with a short-lived access token, sent as a bearer token",
+		Description: "The token is not refreshed and cannot manage the credentials of the user. The changes made with it are in the activity with the impersonatorId of the admin.",
+		Body:        models.ImpersonationInput{}, Response: models.ImpersonationApi{},
+	},
+	"GET /admin/impersonations": {Summary: "List the impersonations, the latest first", Query: []docs.Param{
+		docs.Query("user", "The id of the impersonated user"),
+		docs.Query("limit", "The page size, 50 by default"),
+		docs.Query("page", "The page, from 1"),
+	}, Response: []models.ImpersonationApi{}},
+	"DELETE /admin/impersonations/:id": {Summary: "End an impersonation, its token is refused from now on"},
+	"GET /admin/stats":                 {Summary: "Count the users and the tasks", Response: models.TaskStats{}},
+	"GET /admin/jobs":                  {Summary: "List the periodic jobs of the instance with their last run", Response: []models.ScheduledJobApi{}},
+	"POST /admin/jobs/:name/run":       {Summary: "Run a periodic job now, the status shows when it is done"},
+	"GET /admin/jobs/failed": {Summary: "List the background jobs which failed, the last failed first", Query: []docs.Param{
+		docs.Query("kind", "The kind of the jobs"),
+		docs.Query("limit", "The page size, 50 by default"),
+		docs.Query("page", "The page, from 1"),
+	}, Response: []models.FailedJobApi{}},
+	"GET /admin/jobs/failed/:id":        {Summary: "Get a failed job", Response: models.FailedJobApi{}},
+	"POST /admin/jobs/failed/:id/retry": {Summary: "Queue a failed job again from its first attempt"},
+	"DELETE /admin/jobs/failed/:id":     {Summary: "Forget a failed job"},
+	"PATCH /admin/workspaces/:id/plan":  {Summary: "Change the plan of a workspace, empty for the default plan", Body: models.WorkspacePlanInput{}, Response: quota.Usage{}},
+}
+
+// activityPage are the parameters of the pages of the activity
+var activityPage = []docs.Param{
+	docs.Query("cursor", "The nextCursor of the previous page, empty for the first page"),
+	docs.Query("limit", "The page size, 50 by default"),
+	docs.Query("page", "The page, from 1, without a cursor"),
+}
+
+// pageParams are the parameters of the pages of a listing
+var pageParams = []docs.Param{
+	docs.Query("limit", "The page size, 50 by default"),
+	docs.Query("page", "The page, from 1"),
+}
+
+// filterQueryDescription tells the syntax of the query of a saved filter, see models.ParseFilterQuery
+const filterQueryDescription = "The terms of the query are joined by AND, implied between two terms, and OR; NOT or - negates a term and parentheses group them. " +
+	"The terms are label:name, status:done, todo or open, priority:1 or priority<=2, due<7d, due>=2w, due<2026-10-20, due:today, tomorrow, overdue or none, " +
+	"assignee:me, none or a username, project:id, workspace:id, and words or \"quoted texts\" searched in the title and the description. " +
+	"e.g. label:urgent AND due<7d"
+
+// revertDescription tells what a revert of a task restores
+const revertDescription = "The title, description, status, due date, recurrence and priority are restored, not the assignee, " +
+	"the project or the archive which have their own routes. The revert is an update of its own, with its revision."
+
+// tzParam overrides the time zone of the user the days are read in
+var tzParam = docs.Query("tz", "A time zone like Europe/Berlin, the one of the profile by default")
+
+var includeArchivedParam = docs.Query("include_archived", "true to list the archived tasks and projects too")
+
+// ifNoneMatch is the header of the conditional reads, the responses carry a weak ETag
+var ifNoneMatch = []docs.Param{
+	docs.Header("If-None-Match", "The ETag of the version the client has, answered by a 304 while it did not change"),
+}
+
+// ifMatch is the header of the conditional changes
+var ifMatch = []docs.Param{
+	docs.Header("If-Match", "The ETag of the version read, the change answers 412 when it was changed since"),
+}
+
+// idempotencyKey is the header of the creations a client retries safely
+var idempotencyKey = []docs.Param{
+	docs.Header(IdempotencyHeader, "A unique key of the request, a retry with the same key within 24h is answered with the first response"),
+}
+
+// cursorDescription tells how a listing answers a cursor
+func cursorDescription(field string) string {
+	return "With a cursor, the page is sent as {" + field + ", nextCursor}, newest first. nextCursor is null on the last page."
+}
+
+type checklist struct {
+	Items    []models.ChecklistItemApi `json:"items"`
+	Progress models.ChecklistProgress  `json:"progress"`
+}
+
+type graphQLResponse struct {
+	Data   map[string]interface{} `json:"data"`
+	Errors []struct {
+		Message string   `json:"message"`
+		Path    []string `json:"path,omitempty"`
+	} `json:"errors,omitempty"`
+}
+
+// setupDocsRoutes serves the OpenAPI document of the API and Swagger UI browsing it
+func setupDocsRoutes(app *fiber.App) {
+	spec := docs.New("Tasker API", "1", "/api/v1")
+	for key, op := range operations {
+		method, path := splitOperation(key)
+		spec.Add(method, path, op)
+	}
+
+	document, err := spec.MarshalJSON()
+	if err != nil {
+		panic(err)
+	}
+	page, policy, err := spec.SwaggerUI("/api/docs/openapi.json")
+	if err != nil {
+		panic(err)
+	}
+
+	app.Get("/api/docs/openapi.json", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSONCharsetUTF8)
+		return c.Send(document)
+	})
+	app.Get("/api/docs", func(c *fiber.Ctx) error {
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		c.Set(fiber.HeaderContentSecurityPolicy, policy)
+		return c.Send(page)
+	})
+}
+
+// checkDocumented warns about the routes of the API missing from the operations,
+// and the operations of no route
+func checkDocumented(app *fiber.App) {
+	missing, unrouted := undocumented(app)
+	for _, key := range missing {
+		logging.Log.Warn().Str("route", key).Msg("The route is missing from the OpenAPI document")
+	}
+	for _, key := range unrouted {
+		logging.Log.Warn().Str("route", key).Msg("The OpenAPI document has an operation of no route")
+	}
+}
+
+// undocumented returns the routes of the API missing from the operations, and the operations of
+// no route, as "METHOD /path" sorted
+func undocumented(app *fiber.App) (missing, unrouted []string) {
+	// the middlewares are added to the stacks of every method, no route is a TRACE one
+	mounts := map[string]int{}
+	routes := map[string]int{}
+	for _, stack := range app.Stack() {
+		for _, r := range stack {
+			if !strings.HasPrefix(r.Path, "/api/v1/") {
+				continue
+			}
+
+			path := strings.TrimPrefix(r.Path, "/api/v1")
+			if r.Method == fiber.MethodTrace {
+				mounts[path]++
+			}
+			routes[r.Method+" "+path]++
+		}
+	}
+
+	for key, n := range routes {
+		method, path := splitOperation(key)
+		if method == fiber.MethodHead || n <= mounts[path] {
+			continue
+		}
+		if _, ok := operations[key]; !ok {
+			missing = append(missing, key)
+		}
+	}
+
+	for key := range operations {
+		_, path := splitOperation(key)
+		if routes[key] <= mounts[path] {
+			unrouted = append(unrouted, key)
+		}
+	}
+
+	sort.Strings(missing)
+	sort.Strings(unrouted)
+	return missing, unrouted
+}
+
+// splitOperation returns the method and the path of a key of the operations
+func splitOperation(key string) (method, path string) {
+	parts := strings.SplitN(key, " ", 2)
+	return parts[0], parts[1]
+}
@@ -0,0 +1,31 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/config"
+	"task-app/db"
+	"task-app/notifications"
+	"task-app/util"
+	"testing"
+)
+
+// TestOperationsDocumented fails on a route of the API missing from the OpenAPI document, and
+// on an operation of the document which no route serves
+func TestOperationsDocumented(t *testing.T) {
+	cfg := config.Default()
+	tokens, err := util.NewTokenService(db.Default, cfg.Auth)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	app := fiber.New()
+	New(db.Default, tokens, notifications.New(db.Default), cfg).setupRoutes(app)
+
+	missing, unrouted := undocumented(app)
+	for _, key := range missing {
+		t.Errorf("%s is missing from the operations of openapi.go", key)
+	}
+	for _, key := range unrouted {
+		t.Errorf("%s of the operations of openapi.go has no route", key)
+	}
+}
@@ -0,0 +1,180 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strings"
+	"task-app/cache"
+	"task-app/models"
+	"task-app/util"
+)
+
+func (h *Handler) setupProjectsRoutes() {
+	PROJECTS.Use(h.tokens.SecureAuth())
+	PROJECTS.Get("/", h.handleGetProjects)
+	PROJECTS.Post("/", h.handleCreateProject)
+	PROJECTS.Get("/:id", h.handleGetProject)
+	PROJECTS.Patch("/:id", h.handleUpdateProject)
+	PROJECTS.Delete("/:id", h.handleDeleteProject)
+	PROJECTS.Post("/:id/archive", h.handleArchiveProject)
+	PROJECTS.Post("/:id/unarchive", h.handleUnarchiveProject)
+	PROJECTS.Get("/:id/board", h.handleGetBoard)
+	PROJECTS.Post("/:id/board/move", h.handleMoveCard)
+	PROJECTS.Get("/:id/integrations/github", h.handleGetGitHubIntegration)
+	PROJECTS.Put("/:id/integrations/github", h.handleLinkGitHub)
+	PROJECTS.Delete("/:id/integrations/github", h.handleUnlinkGitHub)
+	PROJECTS.Post("/:id/integrations/github/import", h.handleImportGitHubIssues)
+}
+
+func (h *Handler) handleGetProjects(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	query := h.db(c).Scopes(models.AccessibleBy(u)).Order("title")
+	if workspace := c.Query("workspace"); workspace != "" {
+		query = query.Where("workspace_id = ?", workspace)
+	}
+	if !includeArchived(c) {
+		query = query.Where("archived_at IS NULL")
+	}
+
+	var projects []models.Project
+	if res := query.Find(&projects); res.Error != nil {
+		return sendError(c, "Cannot find user's projects", fiber.StatusForbidden)
+	}
+
+	if notModified(c, projectsETag(projects)) {
+		return sendNotModified(c)
+	}
+
+	response := make([]models.ProjectApi, 0, len(projects))
+	for _, p := range projects {
+		response = append(response, p.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleGetProject(c *fiber.Ctx) error {
+	project, err := h.findProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+
+	if notModified(c, projectETag(project)) {
+		return sendNotModified(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(project.Api())
+}
+
+func (h *Handler) handleCreateProject(c *fiber.Ctx) error {
+	var input models.ProjectApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Title = strings.TrimSpace(input.Title); input.Title == "" {
+		return sendError(c, "Project title is required field", fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	if input.WorkspaceID != nil {
+		if _, err := h.findMembership(c, u, *input.WorkspaceID, models.WorkspaceWriters...); err != nil {
+			return sendWorkspaceError(c, err)
+		}
+	}
+
+	project := models.Project{
+		UserID:      u.ID,
+		WorkspaceID: input.WorkspaceID,
+		Title:       input.Title,
+		Description: input.Description,
+	}
+
+	if res := h.db(c).Create(&project); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(project.Api())
+}
+
+func (h *Handler) handleUpdateProject(c *fiber.Ctx) error {
+	var input models.ProjectApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Title = strings.TrimSpace(input.Title); input.Title == "" {
+		return sendError(c, "Project title is required field", fiber.StatusBadRequest)
+	}
+
+	project, err := h.findWritableProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+	if err := checkIfMatch(c, projectETag(project)); err != nil {
+		return err
+	}
+
+	project.Title = input.Title
+	project.Description = input.Description
+
+	if res := h.db(c).Save(project); res.Error != nil {
+		return sendError(c, "Cannot update project "+res.Error.Error(), fiber.StatusForbidden)
+	}
+
+	c.Set(fiber.HeaderETag, projectETag(project))
+	return c.Status(fiber.StatusOK).JSON(project.Api())
+}
+
+// handleDeleteProject removes the project together with its tasks
+func (h *Handler) handleDeleteProject(c *fiber.Ctx) error {
+	project, err := h.findWritableProject(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+	}
+
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		if err := tx.Where("project_id = ?", project.ID).Delete(&models.Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Where("project_id = ?", project.ID).Delete(&models.GitHubIntegration{}).Error; err != nil {
+			return err
+		}
+
+		return tx.Delete(project).Error
+	})
+
+	if err != nil {
+		return sendError(c, "Cannot delete project "+err.Error(), fiber.StatusForbidden)
+	}
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) findProject(c *fiber.Ctx, id interface{}, roles ...string) (*models.Project, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	project := new(models.Project)
+	if res := h.db(c).Scopes(models.AccessibleBy(u, roles...)).Where("id = ?", id).First(project); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return project, nil
+}
+
+func (h *Handler) findWritableProject(c *fiber.Ctx, id interface{}) (*models.Project, error) {
+	return h.findProject(c, id, models.WorkspaceWriters...)
+}
@@ -0,0 +1,123 @@
+package router
+
+import (
+	"context"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/driver/sqlite"
+	"gorm.io/gorm"
+	gormlogger "gorm.io/gorm/logger"
+	"net/http"
+	"path/filepath"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"testing"
+	"time"
+)
+
+// newSQLiteHandler returns a handler over a migrated SQLite database of the test, its queries
+// are counted as by the access log and kept to their tenant as by the app
+func newSQLiteHandler(t testing.TB) *Handler {
+	t.Helper()
+
+	conn, err := gorm.Open(sqlite.Open(filepath.Join(t.TempDir(), "test.db")+"?_foreign_keys=on"), &gorm.Config{
+		Logger: logging.NewGormLogger(0).LogMode(gormlogger.Silent),
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the migrations run on the connection of the package
+	previous := db.DB
+	db.DB = conn
+	t.Cleanup(func() { db.DB = previous })
+	if err := db.MigrateUp(); err != nil {
+		t.Fatal(err)
+	}
+
+	if err := repository.EnforceTenants(conn); err != nil {
+		t.Fatal(err)
+	}
+
+	store := db.NewStore(conn)
+	return &Handler{store: store, users: repository.NewUserRepo(store), tasks: repository.NewTaskRepo(store)}
+}
+
+// countQueries sends the request as send and returns its status and the count of its queries
+func countQueries(t *testing.T, u *models.User, routes func(app *fiber.App), method, path string, into interface{}) (int, int64) {
+	t.Helper()
+
+	queries := new(int64)
+	app := signedIn(u, func(app *fiber.App) {
+		app.Use(func(c *fiber.Ctx) error {
+			c.Locals(logging.QueriesKey, queries)
+			return c.Next()
+		}, timeout(time.Minute))
+		routes(app)
+	})
+
+	return send(t, app, method, path, "", into), *queries
+}
+
+// createTasks creates a user with n tasks, each with a label, a watcher and a checklist item
+func createTasks(t testing.TB, h *Handler, n int) *models.User {
+	t.Helper()
+
+	u := &models.User{Username: "al", Email: "al@example.com"}
+	if err := h.users.Create(u); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		task := &models.Task{
+			Title:      fmt.Sprintf("Task %d", i),
+			UserID:     u.ID,
+			AssigneeID: &u.ID,
+			Labels:     []models.Label{{UserID: u.ID, Name: fmt.Sprintf("label-%d", i)}},
+			Watchers:   []models.User{*u},
+			Checklist:  []models.ChecklistItem{{Text: "Step"}},
+		}
+		if err := h.tasks.WithContext(repository.WithTenant(context.Background(), u.ID)).Create(task); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	return u
+}
+
+// TestListTasksQueries checks the list of the tasks preloads their details rather than reading
+// them task by task
+func TestListTasksQueries(t *testing.T) {
+	counts := map[int]int64{}
+	for _, n := range []int{3, 20} {
+		h := newSQLiteHandler(t)
+		u := createTasks(t, h, n)
+
+		var list []models.TaskApi
+		status, queries := countQueries(t, u, taskRoutes(h), http.MethodGet, "/tasks", &list)
+		if status != http.StatusOK || len(list) != n || len(list[0].Labels) != 1 {
+			t.Fatalf("%d tasks: status %d, got %+v", n, status, list)
+		}
+		counts[n] = queries
+	}
+
+	if counts[3] == 0 || counts[3] != counts[20] {
+		t.Fatalf("queries: %d for 3 tasks, %d for 20", counts[3], counts[20])
+	}
+}
+
+// BenchmarkListTasks measures the list of 20 tasks with their details
+func BenchmarkListTasks(b *testing.B) {
+	h := newSQLiteHandler(b)
+	app := signedIn(createTasks(b, h, 20), taskRoutes(h))
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		var list []models.TaskApi
+		if status := send(b, app, http.MethodGet, "/tasks", "", &list); status != http.StatusOK || len(list) != 20 {
+			b.Fatalf("status %d, %d tasks", status, len(list))
+		}
+	}
+}
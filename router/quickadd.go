@@ -0,0 +1,82 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strings"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+// handleQuickAdd creates a task from a line of text like "Pay rent tomorrow 5pm #finance !p1 every month".
+// The due date is read in the zone of the user, the labels are matched by name and created when missing.
+func (h *Handler) handleQuickAdd(c *fiber.Ctx) error {
+	input := new(models.QuickAddInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+
+	parsed := util.ParseQuickAdd(input.Text, time.Now().In(loc))
+	if parsed.Title == "" {
+		return models.ValidationError(map[string]string{"text": "Must have a title besides the date, the labels and the priority"})
+	}
+	if len([]rune(parsed.Title)) > 255 {
+		return models.ValidationError(map[string]string{"text": "Must have a title of at most 255 characters"})
+	}
+	for _, name := range parsed.Labels {
+		if strings.Contains(name, ",") {
+			return models.ValidationError(map[string]string{"text": "Must have labels without commas"})
+		}
+	}
+
+	projectID, workspaceID, err := h.taskRepo(c).Placement(u, input.ProjectID, input.WorkspaceID)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	task := models.Task{
+		Title:       parsed.Title,
+		DueAt:       models.UTC(parsed.DueAt),
+		Recurrence:  parsed.Recurrence,
+		Priority:    parsed.Priority,
+		UserID:      u.ID,
+		ProjectID:   projectID,
+		WorkspaceID: workspaceID,
+	}
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		labels := map[string]*models.Label{}
+		for _, name := range parsed.Labels {
+			label, _, err := importLabel(tx, u, labels, models.LabelApi{Name: name})
+			if err != nil {
+				return err
+			}
+			task.Labels = append(task.Labels, *label)
+		}
+
+		return tx.Create(&task).Error
+	})
+	if err != nil {
+		if qerr := quotaError(err); qerr != nil {
+			return qerr
+		}
+		return sendError(c, "Cannot create task "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+	publishTaskEvent(events.TaskCreated, u, &task, task.Api())
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
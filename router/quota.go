@@ -0,0 +1,70 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"task-app/models"
+	"task-app/quota"
+)
+
+// quotaError returns the answer of an error of a quota, nil for the other errors, so the
+// handlers answer it rather than the error of the change which failed with it
+func quotaError(err error) error {
+	var exceeded *quota.ExceededError
+	if !errors.As(err, &exceeded) {
+		return nil
+	}
+
+	return exceededError(exceeded)
+}
+
+// exceededError is a 402 with the plan to upgrade to, a 403 when no plan allows the change
+func exceededError(exceeded *quota.ExceededError) *models.AppError {
+	status := fiber.StatusPaymentRequired
+	if exceeded.Upgrade == nil {
+		status = fiber.StatusForbidden
+	}
+
+	return models.NewError(status, exceeded.Error()).WithQuota(exceeded.Hint())
+}
+
+// handleGetWorkspaceUsage reports the usage of the workspace against the limits of its plan
+func (h *Handler) handleGetWorkspaceUsage(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	usage, err := h.quotas.Usage(h.db(c), workspace)
+	if err != nil {
+		return sendError(c, "Cannot count the usage of the workspace", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(usage)
+}
+
+// handleAdminSetWorkspacePlan changes the plan of a workspace, the empty plan is the default one
+func (h *Handler) handleAdminSetWorkspacePlan(c *fiber.Ctx) error {
+	input := new(models.WorkspacePlanInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+	if !h.quotas.Known(input.Plan) {
+		return sendError(c, "Unknown plan "+input.Plan, fiber.StatusBadRequest)
+	}
+
+	workspace := new(models.Workspace)
+	if res := h.db(c).First(workspace, c.Params("id")); res.Error != nil {
+		return sendError(c, "Cannot find the Workspace", fiber.StatusNotFound)
+	}
+	if res := h.db(c).Model(workspace).Update("plan", input.Plan); res.Error != nil {
+		return sendError(c, "Cannot update the plan", fiber.StatusInternalServerError)
+	}
+
+	usage, err := h.quotas.Usage(h.db(c), workspace)
+	if err != nil {
+		return sendError(c, "Cannot count the usage of the workspace", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(usage)
+}
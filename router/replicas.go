@@ -0,0 +1,30 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/util"
+	"time"
+)
+
+// primaryCookie marks a client which just wrote, its reads stay on the primary until it expires
+const primaryCookie = "read_primary"
+
+// readYourWrites reads the requests writing on the primary, and the ones of the client for the
+// lag after, as the replicas may not have its writes yet. The clients without cookies, e.g. of
+// the API keys, read the replicas after their writes.
+func (h *Handler) readYourWrites(lag time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			if c.Cookies(primaryCookie) != "" {
+				util.ReadPrimary(c)
+			}
+			return c.Next()
+		}
+
+		util.ReadPrimary(c)
+		c.Cookie(h.tokens.Cookie(primaryCookie, "1", lag))
+
+		return c.Next()
+	}
+}
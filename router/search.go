@@ -0,0 +1,133 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strings"
+	"task-app/db"
+	"task-app/models"
+)
+
+// headlineOptions wraps the matched words in <mark>, the text is HTML-escaped before
+const headlineOptions = "StartSel=<mark>, StopSel=</mark>, MaxFragments=2, MinWords=5, MaxWords=20"
+
+func (h *Handler) setupSearchRoutes() {
+	SEARCH.Use(h.tokens.SecureAuth())
+	SEARCH.Get("/", h.handleSearch)
+}
+
+// handleSearch finds the tasks whose title, description or comments match ?q=,
+// on PostgreSQL the query supports the web search syntax: "quoted phrases", or, -excluded.
+// The archived tasks are only found with ?include_archived=true. With the encryption on, only
+// the titles are searched.
+func (h *Handler) handleSearch(c *fiber.Ctx) error {
+	q := strings.TrimSpace(c.Query("q"))
+	if q == "" {
+		return sendError(c, "Query is required field", fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	limit, offset := paginate(c)
+
+	var results []models.SearchResult
+	search := h.searchFullText
+	switch {
+	case h.keyring != nil:
+		search = h.searchTitles
+	case db.Dialect() != db.Postgres:
+		search = h.searchLike
+	}
+	query := search(c, q).
+		Scopes(models.AccessibleBy(u)).
+		Where("tasks.deleted_at IS NULL")
+	if !includeArchived(c) {
+		query = query.Scopes(models.Unarchived)
+	}
+	result := query.
+		Limit(limit).
+		Offset(offset).
+		Scan(&results)
+
+	if result.Error != nil {
+		return sendError(c, "Cannot search tasks", fiber.StatusInternalServerError)
+	}
+
+	if results == nil {
+		results = []models.SearchResult{}
+	}
+
+	return c.Status(fiber.StatusOK).JSON(results)
+}
+
+// searchFullText ranks the tasks by the tsvector columns of PostgreSQL, see db.setupSearch
+func (h *Handler) searchFullText(c *fiber.Ctx, q string) *gorm.DB {
+	return h.db(c).Table("tasks").
+		Select(
+			"tasks.id AS task_id, tasks.title, tasks.status, "+
+				"ts_rank(tasks.search_vector, query) + coalesce(max(ts_rank(comments.search_vector, query)), 0) AS rank, "+
+				"ts_headline(?, "+escapeHTMLSQL("tasks.title")+", query, ?) AS title_highlight, "+
+				"ts_headline(?, "+escapeHTMLSQL("tasks.description")+", query, ?) AS description_highlight, "+
+				"(array_agg(ts_headline(?, "+escapeHTMLSQL("comments.body")+", query, ?) "+
+				"ORDER BY ts_rank(comments.search_vector, query) DESC) FILTER (WHERE comments.id IS NOT NULL))[1] AS comment_highlight",
+			db.SearchConfig, headlineOptions,
+			db.SearchConfig, headlineOptions,
+			db.SearchConfig, headlineOptions,
+		).
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", db.SearchConfig, q).
+		Joins("LEFT JOIN comments ON comments.task_id = tasks.id AND comments.deleted_at IS NULL AND comments.search_vector @@ query").
+		Where("tasks.search_vector @@ query OR comments.id IS NOT NULL").
+		Group("tasks.id, query").
+		Order("rank DESC, tasks.id DESC")
+}
+
+// searchLike is the search of the drivers without full text search.
+// The whole query is matched as a substring, case-insensitively, and nothing is ranked or marked.
+func (h *Handler) searchLike(c *fiber.Ctx, q string) *gorm.DB {
+	pattern := "%" + likeEscaper.Replace(strings.ToLower(q)) + "%"
+
+	return h.db(c).Table("tasks").
+		Select("tasks.id AS task_id, tasks.title, tasks.status, 0 AS rank, "+
+			escapeHTMLSQL("tasks.title")+" AS title_highlight, "+
+			escapeHTMLSQL("tasks.description")+" AS description_highlight").
+		Where("LOWER(tasks.title) LIKE ? ESCAPE '!' OR LOWER(tasks.description) LIKE ? ESCAPE '!' OR EXISTS ("+
+			"SELECT 1 FROM comments WHERE comments.task_id = tasks.id AND comments.deleted_at IS NULL AND LOWER(comments.body) LIKE ? ESCAPE '!')",
+			pattern, pattern, pattern).
+		Order("tasks.id DESC")
+}
+
+// searchTitles is the search of the encrypted databases, the descriptions and the comments are
+// ciphertext there: their search vectors would match its fragments, e.g. enc. The titles are
+// matched as by searchFullText on PostgreSQL, as by searchLike otherwise.
+func (h *Handler) searchTitles(c *fiber.Ctx, q string) *gorm.DB {
+	if db.Dialect() != db.Postgres {
+		pattern := "%" + likeEscaper.Replace(strings.ToLower(q)) + "%"
+		return h.db(c).Table("tasks").
+			Select("tasks.id AS task_id, tasks.title, tasks.status, 0 AS rank, "+escapeHTMLSQL("tasks.title")+" AS title_highlight").
+			Where("LOWER(tasks.title) LIKE ? ESCAPE '!'", pattern).
+			Order("tasks.id DESC")
+	}
+
+	vector := "to_tsvector(?, coalesce(tasks.title, ''))"
+	return h.db(c).Table("tasks").
+		Select(
+			"tasks.id AS task_id, tasks.title, tasks.status, ts_rank("+vector+", query) AS rank, "+
+				"ts_headline(?, "+escapeHTMLSQL("tasks.title")+", query, ?) AS title_highlight",
+			db.SearchConfig, db.SearchConfig, headlineOptions,
+		).
+		Joins("CROSS JOIN websearch_to_tsquery(?, ?) AS query", db.SearchConfig, q).
+		Where(vector+" @@ query", db.SearchConfig).
+		Order("rank DESC, tasks.id DESC")
+}
+
+// likeEscaper escapes the wildcards of LIKE, with ! as the escape character
+var likeEscaper = strings.NewReplacer("!", "!!", "%", "!%", "_", "!_")
+
+// escapeHTMLSQL returns an SQL expression escaping HTML in a text column,
+// so only the <mark> tags of the highlights are markup
+func escapeHTMLSQL(column string) string {
+	return "replace(replace(replace(coalesce(" + column + ", ''), '&', '&amp;'), '<', '&lt;'), '>', '&gt;')"
+}
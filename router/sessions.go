@@ -0,0 +1,76 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/models"
+)
+
+// GetSessions lists the devices signed in as the user, the current one is marked
+func (h *Handler) GetSessions(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	sessions, err := h.tokens.Sessions(strconv.Itoa(int(u.ID)))
+	if err != nil {
+		return sendError(c, "Cannot find the sessions", fiber.StatusInternalServerError)
+	}
+
+	current := h.tokens.CurrentSession(c)
+	response := make([]models.SessionApi, 0, len(sessions))
+	for _, s := range sessions {
+		session := s.Api()
+		session.Current = s.ID == current
+		response = append(response, session)
+	}
+
+	return c.JSON(response)
+}
+
+// RevokeSession signs a device out, it cannot refresh its access token anymore
+func (h *Handler) RevokeSession(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return sendError(c, "Invalid session id", fiber.StatusBadRequest)
+	}
+
+	found, err := h.tokens.RevokeSession(strconv.Itoa(int(u.ID)), uint(id))
+	if err != nil {
+		return sendError(c, "Cannot revoke the session", fiber.StatusInternalServerError)
+	}
+	if !found {
+		return sendError(c, "Cannot find the session", fiber.StatusNotFound)
+	}
+
+	if uint(id) == h.tokens.CurrentSession(c) {
+		h.tokens.ClearAuthCookies(c)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// RevokeOtherSessions signs out every device but the one of the request
+func (h *Handler) RevokeOtherSessions(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	current := h.tokens.CurrentSession(c)
+	if current == 0 {
+		return sendError(c, "The current session has no refresh token", fiber.StatusBadRequest)
+	}
+
+	if err := h.tokens.RevokeOtherSessions(strconv.Itoa(int(u.ID)), current); err != nil {
+		return sendError(c, "Cannot revoke the sessions", fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
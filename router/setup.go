@@ -2,6 +2,21 @@ package router
 
 import (
 	"github.com/gofiber/fiber/v2"
+	"task-app/cache"
+	"task-app/config"
+	"task-app/db"
+	"task-app/encryption"
+	"task-app/events"
+	"task-app/github"
+	"task-app/notifications"
+	"task-app/quota"
+	"task-app/ratelimit"
+	"task-app/realtime"
+	"task-app/repository"
+	"task-app/slack"
+	"task-app/util"
+	"task-app/webhooks"
+	"time"
 )
 
 // USER handles all the user routes
@@ -10,13 +25,240 @@ var USER fiber.Router
 // TASKS handles all the tasks routes
 var TASKS fiber.Router
 
-// SetupRoutes setups all the Routes
-func SetupRoutes(app *fiber.App) {
-	api := app.Group("/api/v1")
+// LABELS handles all the labels routes
+var LABELS fiber.Router
 
+// ATTACHMENTS handles the attachment download routes
+var ATTACHMENTS fiber.Router
+
+// AUTH handles the OAuth and single sign-on login routes
+var AUTH fiber.Router
+
+// ADMIN handles all the admin routes
+var ADMIN fiber.Router
+
+// WORKSPACES handles all the workspaces routes
+var WORKSPACES fiber.Router
+
+// PROJECTS handles all the projects routes
+var PROJECTS fiber.Router
+
+// SEARCH handles the search routes
+var SEARCH fiber.Router
+
+// WEBHOOKS handles all the webhooks routes
+var WEBHOOKS fiber.Router
+
+// EVENTS handles the Server-Sent Events stream
+var EVENTS fiber.Router
+
+// CALENDAR handles the calendar feed routes
+var CALENDAR fiber.Router
+
+// SHARED handles the public routes of the share links
+var SHARED fiber.Router
+
+// TEMPLATES handles all the task templates routes
+var TEMPLATES fiber.Router
+
+// FILTERS handles the saved filters routes of the user
+var FILTERS fiber.Router
+
+// TIME handles the time tracking routes of the user
+var TIME fiber.Router
+
+// STATS handles the statistics routes
+var STATS fiber.Router
+
+// NOTIFICATIONS handles the notifications routes of the user
+var NOTIFICATIONS fiber.Router
+
+// INTEGRATIONS handles the routes of the integrations with other apps
+var INTEGRATIONS fiber.Router
+
+// AVATARS serves the avatars of the users
+var AVATARS fiber.Router
+
+// INBOX handles the inbound emails
+var INBOX fiber.Router
+
+// GRAPHQL handles the GraphQL API
+var GRAPHQL fiber.Router
+
+// SYNC handles the sync of the offline clients
+var SYNC fiber.Router
+
+// Handler serves the routes from the store and the token service it is given
+type Handler struct {
+	store  db.Store
+	users  repository.UserRepo
+	tasks  repository.TaskRepo
+	tokens *util.TokenService
+	conf   *config.Config
+	// cache keeps the hot reads, nil when it is off
+	cache *cache.Cache
+	// notifier delivers the notifications of the events
+	notifier *notifications.Notifier
+	// failedLogins counts the failed logins by IP
+	failedLogins *ratelimit.Failures
+	// quotas are the limits of the plans of the workspaces
+	quotas *quota.Service
+	// keyring decrypts the content read without GORM models, nil when it is not encrypted
+	keyring *encryption.Keyring
+}
+
+func New(store db.Store, tokens *util.TokenService, notifier *notifications.Notifier, cfg *config.Config) *Handler {
+	return &Handler{
+		store:  store,
+		users:  repository.NewUserRepo(store),
+		tasks:  repository.NewTaskRepo(store),
+		tokens: tokens,
+		conf:   cfg,
+
+		notifier:     notifier,
+		failedLogins: ratelimit.NewFailures("login_failures", 20, 15*time.Minute),
+		quotas:       quota.New(cfg.Plans),
+	}
+}
+
+// UseCache caches the profile, the task lists and the statistics, a nil cache leaves them uncached
+func (h *Handler) UseCache(c *cache.Cache) *Handler {
+	h.cache = c
+	h.users = repository.NewCachedUserRepo(h.users, c)
+	h.tasks = repository.NewCachedTaskRepo(h.tasks, c)
+
+	return h
+}
+
+// UseEncryption decrypts the content of the exports by the keyring, the models are decrypted by
+// its callbacks
+func (h *Handler) UseEncryption(k *encryption.Keyring) *Handler {
+	h.keyring = k
+
+	return h
+}
+
+// SetupRoutes setups all the Routes on the global DB.
+// It is kept for the callers which do not build a Handler.
+func SetupRoutes(app *fiber.App, cfg *config.Config) error {
+	tokens, err := util.NewTokenService(db.Default, cfg.Auth)
+	if err != nil {
+		return err
+	}
+
+	New(db.Default, tokens, notifications.New(db.Default), cfg).Setup(app)
+	return nil
+}
+
+// Setup setups all the Routes and the subscribers of the events
+func (h *Handler) Setup(app *fiber.App) {
+	app.Use(securityHeaders(h.conf.Headers))
+	// the compression sees the error responses, sent by handleErrors
+	if h.conf.Server.Compress {
+		app.Use(compressJSON)
+	}
+	app.Use(handleErrors)
+	app.Use(limitBody(h.conf.Server.BodyLimit))
+	app.Use(timeout(h.conf.Server.RequestTimeout))
+	if len(h.conf.Database.Replicas) > 0 {
+		app.Use(h.readYourWrites(h.conf.Database.ReplicaLag))
+	}
+
+	events.Subscribe(h.notifier.Handle)
+	events.Subscribe(h.recordActivity)
+	events.Subscribe(h.unblockDependents)
+	events.Subscribe(webhooks.Dispatch)
+	events.Subscribe(slack.Dispatch)
+	events.Subscribe(github.Dispatch)
+	events.Subscribe(realtime.DefaultHub.Publish)
+
+	h.setupRoutes(app)
+	checkDocumented(app)
+}
+
+// setupRoutes setups the routes of the app, without the middlewares before them
+func (h *Handler) setupRoutes(app *fiber.App) {
+	h.setupHealthRoutes(app)
+	setupMetricsRoutes(app)
+	h.setupJWKSRoutes(app)
+	h.setupWebSocketRoutes(app)
+	h.setupCalDAVRoutes(app)
+
+	// the document is served before the legacy paths of /api would match it
+	setupDocsRoutes(app)
+	h.setupVersions(app)
+	h.setupWebRoutes(app)
+}
+
+// setupV1Routes setups the routes of the version 1 of the API
+func (h *Handler) setupV1Routes(api fiber.Router) {
 	USER = api.Group("/user")
-	setupUserRoutes()
+	h.setupUserRoutes()
 
 	TASKS = api.Group("/tasks")
-	setupTasksRoutes()
+	h.setupTasksRoutes()
+
+	LABELS = api.Group("/labels")
+	h.setupLabelsRoutes()
+
+	ATTACHMENTS = api.Group("/attachments")
+	h.setupAttachmentsRoutes()
+
+	AVATARS = api.Group("/avatars")
+	h.setupAvatarsRoutes()
+
+	AUTH = api.Group("/auth")
+	h.setupSSORoutes()
+	h.setupOAuthRoutes()
+
+	WORKSPACES = api.Group("/workspaces")
+	h.setupWorkspacesRoutes()
+
+	PROJECTS = api.Group("/projects")
+	h.setupProjectsRoutes()
+
+	SEARCH = api.Group("/search")
+	h.setupSearchRoutes()
+
+	WEBHOOKS = api.Group("/webhooks")
+	h.setupWebhooksRoutes()
+
+	EVENTS = api.Group("/events")
+	h.setupEventsRoutes()
+
+	CALENDAR = api.Group("/calendar")
+	h.setupCalendarRoutes()
+
+	SHARED = api.Group("/shared")
+	h.setupSharedRoutes()
+
+	TEMPLATES = api.Group("/templates")
+	h.setupTemplatesRoutes()
+
+	FILTERS = api.Group("/filters")
+	h.setupFiltersRoutes()
+
+	TIME = api.Group("/time")
+	h.setupTimeRoutes()
+
+	STATS = api.Group("/stats")
+	h.setupStatsRoutes()
+
+	NOTIFICATIONS = api.Group("/notifications")
+	h.setupNotificationsRoutes()
+
+	INTEGRATIONS = api.Group("/integrations")
+	h.setupIntegrationsRoutes()
+
+	INBOX = api.Group("/inbox")
+	h.setupInboxRoutes()
+
+	GRAPHQL = api.Group("/graphql")
+	h.setupGraphQLRoutes()
+
+	SYNC = api.Group("/sync")
+	h.setupSyncRoutes()
+
+	ADMIN = api.Group("/admin")
+	h.setupAdminRoutes()
 }
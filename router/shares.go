@@ -0,0 +1,221 @@
+package router
+
+import (
+	"bytes"
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"html/template"
+	"strings"
+	"task-app/models"
+	"task-app/ratelimit"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+)
+
+func (h *Handler) setupSharedRoutes() {
+	// the slug in the URL is the only authentication, with the password of a protected link
+	SHARED.Get("/:slug", ratelimit.Limit("shared", 60, time.Minute), h.handleGetShared)
+}
+
+// GetShares lists the share links of the user signed in
+func (h *Handler) GetShares(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	var shares []models.Share
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Order("created_at").Find(&shares); res.Error != nil {
+		return sendError(c, "Cannot find user's share links", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.ShareApi, 0, len(shares))
+	for _, s := range shares {
+		response = append(response, s.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// CreateShare creates a read-only link to the tasks of a project, of a workspace or of a filtered list.
+// The link is returned only once, only the hash of its slug is kept.
+func (h *Handler) CreateShare(c *fiber.Ctx) error {
+	input := new(models.ShareInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if input.ProjectID != nil {
+		if _, err := h.findProject(c, *input.ProjectID); err != nil {
+			return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+		}
+	}
+	if input.WorkspaceID != nil {
+		if _, err := h.findMembership(c, u, *input.WorkspaceID); err != nil {
+			return sendError(c, "Cannot find the Workspace", fiber.StatusNotFound)
+		}
+	}
+
+	slug := util.RandomToken(16)
+	share := &models.Share{
+		UserID:      u.ID,
+		Title:       strings.TrimSpace(input.Title),
+		SlugHash:    util.HashToken(slug),
+		ProjectID:   input.ProjectID,
+		WorkspaceID: input.WorkspaceID,
+		Due:         input.Due,
+		Sort:        input.Sort,
+	}
+	labels := make([]string, 0, len(input.Labels))
+	for _, l := range input.Labels {
+		// the names are kept comma separated
+		if l = strings.TrimSpace(strings.ReplaceAll(l, ",", "")); l != "" {
+			labels = append(labels, l)
+		}
+	}
+	share.Labels = strings.Join(labels, ",")
+
+	if input.Password != "" {
+		hash, err := bcrypt.GenerateFromPassword([]byte(input.Password), bcrypt.DefaultCost)
+		if err != nil {
+			return sendError(c, "Cannot hash the password", fiber.StatusInternalServerError)
+		}
+		share.PasswordHash = string(hash)
+	}
+
+	if res := h.db(c).Create(share); res.Error != nil {
+		return sendError(c, "Cannot create the share link", fiber.StatusInternalServerError)
+	}
+
+	response := share.Api()
+	response.URL = c.BaseURL() + "/api/v1/shared/" + slug
+
+	return c.Status(fiber.StatusCreated).JSON(response)
+}
+
+// RevokeShare deletes a share link of the user signed in, its URL is not found anymore
+func (h *Handler) RevokeShare(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	res := h.db(c).Scopes(models.OwnedBy(u)).Where("id = ?", c.Params("id")).Delete(&models.Share{})
+	if res.Error != nil || res.RowsAffected <= 0 {
+		return sendError(c, "Cannot find the share link", fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleGetShared sends the tasks of a share link as JSON, or as a page with ?format=html or
+// for the browsers asking for HTML. The tasks are the ones the owner of the link sees now, so
+// a task moved out of a shared project or a workspace left by the owner is not shared anymore.
+func (h *Handler) handleGetShared(c *fiber.Ctx) error {
+	c.Set("X-Robots-Tag", "noindex, nofollow")
+	c.Set(fiber.HeaderCacheControl, "no-cache, private")
+
+	share := new(models.Share)
+	if res := h.db(c).Where("slug_hash = ?", util.HashToken(c.Params("slug"))).First(share); res.Error != nil {
+		return sendError(c, "Cannot find the shared list", fiber.StatusNotFound)
+	}
+	owner, err := h.userRepo(c).ByID(share.UserID)
+	if err != nil || owner.Locked {
+		return sendError(c, "Cannot find the shared list", fiber.StatusNotFound)
+	}
+
+	if share.PasswordHash != "" {
+		// any username, the password is the one of the link
+		_, password, ok := util.GetBasicAuth(c)
+		if !ok || bcrypt.CompareHashAndPassword([]byte(share.PasswordHash), []byte(password)) != nil {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="Shared list", charset="UTF-8"`)
+			return sendError(c, "The shared list is protected by a password", fiber.StatusUnauthorized)
+		}
+	}
+
+	filter := repository.TaskFilter{
+		ProjectID:   share.ProjectID,
+		WorkspaceID: share.WorkspaceID,
+		Labels:      share.LabelList(),
+		Sort:        share.Sort,
+	}
+	if share.Due != "" {
+		if filter.DueBefore, err = dueBefore(share.Due, time.Now().In(owner.Location())); err != nil {
+			return sendError(c, err.Error(), fiber.StatusInternalServerError)
+		}
+	}
+
+	tasks, err := h.taskRepo(c).List(owner, filter)
+	if err != nil {
+		return sendError(c, "Cannot find the shared tasks", fiber.StatusInternalServerError)
+	}
+
+	// a failed update only loses when the link was seen last
+	h.db(c).Model(share).UpdateColumn("viewed_at", time.Now())
+
+	response := models.SharedListApi{Title: share.Title, Tasks: make([]models.SharedTaskApi, 0, len(tasks))}
+	for _, t := range tasks {
+		response.Tasks = append(response.Tasks, t.Shared())
+	}
+
+	if c.Query("format") == "html" || (c.Query("format") == "" && c.Accepts(fiber.MIMEApplicationJSON, fiber.MIMETextHTML) == fiber.MIMETextHTML) {
+		var buf bytes.Buffer
+		if err := sharedPage.Execute(&buf, response); err != nil {
+			return sendError(c, "Cannot render the shared list", fiber.StatusInternalServerError)
+		}
+		// the descriptions are sanitized already, no script runs on the page anyway
+		c.Set(fiber.HeaderContentSecurityPolicy, "default-src 'none'; img-src https: http:; style-src 'unsafe-inline'; frame-ancestors *")
+		c.Set(fiber.HeaderContentType, fiber.MIMETextHTMLCharsetUTF8)
+		return c.Send(buf.Bytes())
+	}
+
+	return c.JSON(response)
+}
+
+// sharedPage is the page of a shared list, it may be embedded in another site with an iframe
+var sharedPage = template.Must(template.New("shared").Funcs(template.FuncMap{
+	"safe": func(s string) template.HTML { return template.HTML(s) },
+	"date": func(t *time.Time) string { return t.UTC().Format("Jan 2, 2006 15:04 UTC") },
+}).Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<meta name="robots" content="noindex, nofollow">
+<title>{{.Title}}</title>
+<style>
+body { font-family: -apple-system, "Segoe UI", Helvetica, Arial, sans-serif; max-width: 48rem; margin: 2rem auto; padding: 0 1rem; color: #222; }
+li.task { list-style: none; border-bottom: 1px solid #eee; padding: .75rem 0; }
+li.done .title { text-decoration: line-through; color: #888; }
+.meta { color: #666; font-size: .85rem; }
+.label { background: #eef; border-radius: .25rem; padding: 0 .35rem; margin-right: .25rem; }
+</style>
+</head>
+<body>
+<h1>{{.Title}}</h1>
+<ul>
+{{- range .Tasks}}
+<li class="task{{if eq .Status "done"}} done{{end}}">
+<div class="title">{{.Title}}</div>
+<div class="meta">
+{{- if .DueAt}}Due {{date .DueAt}} {{end}}
+{{- if .Checklist.Total}}{{.Checklist.Done}}/{{.Checklist.Total}} {{end}}
+{{- range .Labels}}<span class="label">{{.}}</span>{{end -}}
+</div>
+{{- if .DescriptionHTML}}
+<div class="description">{{safe .DescriptionHTML}}</div>
+{{- end}}
+</li>
+{{- else}}
+<li class="task">No tasks</li>
+{{- end}}
+</ul>
+</body>
+</html>
+`))
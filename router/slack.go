@@ -0,0 +1,221 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+	"strconv"
+	"strings"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"task-app/slack"
+	"task-app/util"
+)
+
+const slackStateCookie = "slack_state"
+
+const slackHelp = "Use `/tasker add` and a title to add a task to the workspace linked to this Slack team."
+
+func (h *Handler) setupIntegrationsRoutes() {
+	// the commands and the webhook deliveries are signed by Slack and GitHub, they carry no session
+	INTEGRATIONS.Post("/slack/commands", h.handleSlackCommand)
+	INTEGRATIONS.Post("/github/webhook", h.handleGitHubWebhook)
+
+	INTEGRATIONS.Use(h.tokens.SecureAuth())
+	INTEGRATIONS.Get("/slack", h.handleGetSlackInstallation)
+	INTEGRATIONS.Delete("/slack", h.handleUninstallSlack)
+	INTEGRATIONS.Get("/slack/install", h.handleInstallSlack)
+	INTEGRATIONS.Get("/slack/callback", h.handleSlackCallback)
+}
+
+// handleInstallSlack sends the owner of the ?workspace= to the page of Slack installing the app
+func (h *Handler) handleInstallSlack(c *fiber.Ctx) error {
+	if h.conf.Slack.ClientID == "" {
+		return sendError(c, "Slack is not configured", fiber.StatusNotFound)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	membership, err := h.findMembership(c, u, c.Query("workspace"), models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	// the state is bound to the browser by a cookie, with the workspace of the install
+	state := util.RandomToken(16)
+	c.Cookie(h.stateCookie(slackStateCookie, state+"."+strconv.Itoa(int(membership.WorkspaceID))))
+
+	return c.Redirect(slack.AuthorizeURL(h.conf.Slack, state), fiber.StatusFound)
+}
+
+// handleSlackCallback finishes the install, a new install replaces the previous one of the workspace
+func (h *Handler) handleSlackCallback(c *fiber.Ctx) error {
+	if h.conf.Slack.ClientID == "" {
+		return sendError(c, "Slack is not configured", fiber.StatusNotFound)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	cookie := c.Cookies(slackStateCookie)
+	h.tokens.ClearCookies(c, slackStateCookie)
+	dot := strings.IndexByte(cookie, '.')
+	if dot < 0 || cookie[:dot] != c.Query("state") {
+		return sendError(c, "Invalid OAuth state", fiber.StatusForbidden)
+	}
+
+	membership, err := h.findMembership(c, u, cookie[dot+1:], models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	if c.Query("code") == "" {
+		return sendError(c, "Authorization was denied", fiber.StatusUnauthorized)
+	}
+
+	install, err := slack.Exchange(h.conf.Slack, c.Query("code"))
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Msg("Slack install failed")
+		return sendError(c, "Cannot install the Slack app", fiber.StatusBadGateway)
+	}
+
+	var linked int64
+	repository.AllTenants(h.db(c)).Model(&models.SlackInstallation{}).
+		Where("team_id = ? AND workspace_id <> ?", install.TeamID, membership.WorkspaceID).
+		Count(&linked)
+	if linked > 0 {
+		return sendError(c, "The Slack team is already linked to another workspace", fiber.StatusConflict)
+	}
+
+	installation := models.SlackInstallation{
+		WorkspaceID: membership.WorkspaceID,
+		InstalledBy: u.ID,
+		TeamID:      install.TeamID,
+		TeamName:    install.TeamName,
+		BotToken:    install.BotToken,
+		ChannelID:   install.ChannelID,
+		ChannelName: install.ChannelName,
+		WebhookURL:  install.WebhookURL,
+	}
+	if err := h.db(c).Clauses(clause.OnConflict{
+		Columns: []clause.Column{{Name: "workspace_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{
+			"installed_by", "team_id", "team_name", "bot_token", "channel_id", "channel_name", "webhook_url", "updated_at",
+		}),
+	}).Create(&installation).Error; err != nil {
+		return sendError(c, "Cannot save the Slack installation", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(installation.Api())
+}
+
+func (h *Handler) handleGetSlackInstallation(c *fiber.Ctx) error {
+	installation, err := h.findSlackInstallation(c)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(installation.Api())
+}
+
+// handleUninstallSlack unlinks the Slack team of the ?workspace= and revokes the token of the app
+func (h *Handler) handleUninstallSlack(c *fiber.Ctx) error {
+	installation, err := h.findSlackInstallation(c, models.WorkspaceOwner)
+	if err != nil {
+		return err
+	}
+
+	if err := h.db(c).Delete(installation).Error; err != nil {
+		return sendError(c, "Cannot uninstall the Slack app", fiber.StatusInternalServerError)
+	}
+
+	if err := slack.Revoke(installation.BotToken); err != nil {
+		logging.FromCtx(c).Warn().Err(err).Uint("workspace", installation.WorkspaceID).Msg("Cannot revoke the Slack token")
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) findSlackInstallation(c *fiber.Ctx, roles ...string) (*models.SlackInstallation, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	membership, err := h.findMembership(c, u, c.Query("workspace"), roles...)
+	if err != nil {
+		return nil, sendWorkspaceError(c, err)
+	}
+
+	installation := new(models.SlackInstallation)
+	if res := h.db(c).Where("workspace_id = ?", membership.WorkspaceID).First(installation); res.Error != nil {
+		return nil, sendError(c, "Slack is not installed in the workspace", fiber.StatusNotFound)
+	}
+
+	return installation, nil
+}
+
+// handleSlackCommand runs /tasker in the linked workspace of the team. The Slack user is the member
+// of the workspace with their email. The answers are only shown to the user running the command.
+func (h *Handler) handleSlackCommand(c *fiber.Ctx) error {
+	if h.conf.Slack.SigningSecret == "" {
+		return sendError(c, "Slack is not configured", fiber.StatusNotFound)
+	}
+
+	if err := slack.Verify(h.conf.Slack.SigningSecret, c.Get(slack.TimestampHeader), c.Get(slack.SignatureHeader), c.Body()); err != nil {
+		return sendError(c, "Invalid Slack signature", fiber.StatusUnauthorized)
+	}
+
+	installation := new(models.SlackInstallation)
+	if res := h.db(c).Where("team_id = ?", c.FormValue("team_id")).First(installation); res.Error != nil {
+		return slackReply(c, "This Slack team is not linked to a workspace.")
+	}
+
+	subcommand, title := c.FormValue("text"), ""
+	if i := strings.IndexFunc(subcommand, func(r rune) bool { return r == ' ' || r == '\n' }); i >= 0 {
+		subcommand, title = subcommand[:i], strings.TrimSpace(subcommand[i+1:])
+	}
+	if strings.ToLower(subcommand) != "add" {
+		return slackReply(c, slackHelp)
+	}
+	if title == "" || len(title) > 255 {
+		return slackReply(c, "The title of the task is required, up to 255 characters.")
+	}
+
+	email, err := slack.UserEmail(installation.BotToken, c.FormValue("user_id"))
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("team", installation.TeamID).Msg("Cannot find the Slack user")
+		return slackReply(c, "Cannot find your Slack profile, try again later.")
+	}
+
+	var u *models.User
+	if email != "" {
+		if u, err = h.userRepo(c).ByEmail(email); err == nil {
+			_, err = h.findMembership(c, u, installation.WorkspaceID, models.WorkspaceWriters...)
+		}
+	}
+	if u == nil || err != nil || u.Locked {
+		return slackReply(c, "Your Slack email is not a member of the workspace who can add tasks.")
+	}
+
+	workspaceID := installation.WorkspaceID
+	task := models.Task{Title: title, UserID: u.ID, WorkspaceID: &workspaceID}
+	if err := h.taskRepo(c).Create(&task); err != nil {
+		return slackReply(c, "Cannot add the task, try again later.")
+	}
+
+	publishTaskEvent(events.TaskCreated, u, &task, task.Api())
+
+	return slackReply(c, "Added *"+slack.Escape(task.Title)+"*")
+}
+
+// slackReply answers a slash command privately to the user who ran it
+func slackReply(c *fiber.Ctx, text string) error {
+	return c.JSON(fiber.Map{"response_type": "ephemeral", "text": text})
+}
@@ -0,0 +1,84 @@
+package router
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"task-app/realtime"
+	"time"
+)
+
+// sseHeartbeat is how often a comment is written to keep the stream open and detect gone clients
+const sseHeartbeat = 15 * time.Second
+
+func (h *Handler) setupEventsRoutes() {
+	EVENTS.Use(h.ticketAuth)
+	EVENTS.Get("/", handleEventStream)
+}
+
+// handleEventStream streams the same messages as the WebSocket hub as Server-Sent Events.
+// A client reconnecting with Last-Event-ID gets the messages it missed first,
+// as long as they are still in the hub history.
+func handleEventStream(c *fiber.Ctx) error {
+	id, _ := strconv.Atoi(c.Locals("id").(string))
+
+	lastID, _ := strconv.ParseUint(c.Get("Last-Event-ID", c.Query("lastEventId")), 10, 64)
+
+	c.Set(fiber.HeaderContentType, "text/event-stream")
+	c.Set(fiber.HeaderCacheControl, "no-cache")
+	c.Set(fiber.HeaderConnection, "keep-alive")
+	c.Set("X-Accel-Buffering", "no")
+
+	client := realtime.DefaultHub.Register(uint(id))
+	missed := realtime.DefaultHub.Replay(uint(id), lastID)
+
+	c.Context().SetBodyStreamWriter(func(w *bufio.Writer) {
+		defer realtime.DefaultHub.Unregister(client)
+
+		for _, msg := range missed {
+			if writeSSE(w, msg) != nil {
+				return
+			}
+			lastID = msg.ID
+		}
+
+		heartbeat := time.NewTicker(sseHeartbeat)
+		defer heartbeat.Stop()
+
+		for {
+			select {
+			case msg, ok := <-client.Send:
+				if !ok {
+					return
+				}
+				// a message may be both replayed and received after registering
+				if msg.ID <= lastID {
+					continue
+				}
+				if writeSSE(w, msg) != nil {
+					return
+				}
+				lastID = msg.ID
+			case <-heartbeat.C:
+				fmt.Fprint(w, ": ping\n\n")
+				if w.Flush() != nil {
+					return
+				}
+			}
+		}
+	})
+
+	return nil
+}
+
+func writeSSE(w *bufio.Writer, msg realtime.Message) error {
+	data, err := json.Marshal(msg)
+	if err != nil {
+		return err
+	}
+
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event, data)
+	return w.Flush()
+}
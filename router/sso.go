@@ -0,0 +1,483 @@
+package router
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/oauth"
+	"task-app/repository"
+	"task-app/sso"
+	"task-app/util"
+)
+
+const ssoStateCookie = "sso_state"
+
+// errSSOLogin is the reason of a login by the provider which is refused, sent to the user as is
+type errSSOLogin struct {
+	status  int
+	message string
+}
+
+func (e *errSSOLogin) Error() string {
+	return e.message
+}
+
+func (h *Handler) setupSSORoutes() {
+	// the login routes are registered before the OAuth ones, their :provider would match sso
+	AUTH.Get("/sso/:workspace", h.handleSSORedirect)
+	AUTH.Get("/sso/:workspace/callback", h.handleOIDCCallback)
+	AUTH.Post("/sso/:workspace/acs", h.handleSAMLACS)
+	AUTH.Get("/sso/:workspace/metadata", h.handleSAMLMetadata)
+}
+
+// ssoBase is the URL of the login of the workspace, the URLs the provider is configured with are under it
+func ssoBase(workspaceID uint) string {
+	return oauth.RedirectBase + "/api/v1/auth/sso/" + strconv.Itoa(int(workspaceID))
+}
+
+// handleGetWorkspaceSSO returns the single sign-on of the workspace to its owners
+func (h *Handler) handleGetWorkspaceSSO(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	cfg := new(models.WorkspaceSSO)
+	if res := h.db(c).Where("workspace_id = ?", workspace.ID).First(cfg); res.Error != nil {
+		return sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	return c.JSON(cfg.Api(ssoBase(workspace.ID)))
+}
+
+// handleSaveWorkspaceSSO configures the provider of the workspace. The issuer or the certificate
+// is checked before it is saved. Enforcing the single sign-on signs the members out, but the owners.
+func (h *Handler) handleSaveWorkspaceSSO(c *fiber.Ctx) error {
+	input := new(models.WorkspaceSSOInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	cfg := new(models.WorkspaceSSO)
+	res := h.db(c).Where("workspace_id = ?", workspace.ID).Limit(1).Find(cfg)
+	if res.Error != nil {
+		return sendError(c, "Cannot find the single sign-on", fiber.StatusInternalServerError)
+	}
+	created := res.RowsAffected == 0
+	wasEnforced := cfg.Enforced
+
+	switch input.Protocol {
+	case models.SSOProtocolOIDC:
+		secret := input.ClientSecret
+		if secret == "" && cfg.Protocol == models.SSOProtocolOIDC {
+			secret = cfg.ClientSecret
+		}
+		if secret == "" {
+			return models.ValidationError(map[string]string{"clientSecret": "The secret is required to configure an issuer"})
+		}
+		if err := sso.CheckIssuer(util.Context(c), input.Issuer); err != nil {
+			logging.FromCtx(c).Warn().Err(err).Str("issuer", input.Issuer).Msg("Cannot discover the OIDC issuer")
+			return models.ValidationError(map[string]string{"issuer": "Cannot read the discovery document of the issuer"})
+		}
+		cfg.Issuer, cfg.ClientID, cfg.ClientSecret = strings.TrimRight(input.Issuer, "/"), input.ClientID, secret
+		cfg.IdPEntityID, cfg.IdPSSOURL, cfg.IdPCertificate = "", "", ""
+	case models.SSOProtocolSAML:
+		if err := sso.CheckCertificate(input.IdPCertificate); err != nil {
+			return models.ValidationError(map[string]string{"idpCertificate": "Must be the PEM certificate of the IdP"})
+		}
+		cfg.IdPEntityID, cfg.IdPSSOURL, cfg.IdPCertificate = input.IdPEntityID, input.IdPSSOURL, strings.TrimSpace(input.IdPCertificate)
+		cfg.Issuer, cfg.ClientID, cfg.ClientSecret = "", "", ""
+	}
+
+	domains := make([]string, 0, len(input.Domains))
+	for _, d := range input.Domains {
+		domains = append(domains, strings.ToLower(d))
+	}
+	if input.DefaultRole == "" {
+		input.DefaultRole = models.WorkspaceMember
+	}
+
+	cfg.WorkspaceID = workspace.ID
+	cfg.Protocol = input.Protocol
+	cfg.Enforced = input.Enforced
+	cfg.Domains = strings.Join(domains, ",")
+	cfg.Provision = input.Provision
+	cfg.DefaultRole = input.DefaultRole
+	cfg.EmailAttribute, cfg.NameAttribute, cfg.UsernameAttribute = input.EmailAttribute, input.NameAttribute, input.UsernameAttribute
+	if err := h.db(c).Save(cfg).Error; err != nil {
+		return sendError(c, "Cannot save the single sign-on", fiber.StatusInternalServerError)
+	}
+
+	if cfg.Enforced && !wasEnforced {
+		var members []models.Membership
+		h.db(c).Where("workspace_id = ? AND role <> ?", workspace.ID, models.WorkspaceOwner).Find(&members)
+		for _, m := range members {
+			if err := h.tokens.RevokeTokens(strconv.Itoa(int(m.UserID)), models.RevokedSSOEnforced); err != nil {
+				logging.FromCtx(c).Error().Err(err).Uint("user", m.UserID).Msg("Cannot revoke the sessions of a member")
+			}
+		}
+	}
+
+	if created {
+		return c.Status(fiber.StatusCreated).JSON(cfg.Api(ssoBase(workspace.ID)))
+	}
+
+	return c.JSON(cfg.Api(ssoBase(workspace.ID)))
+}
+
+// handleDeleteWorkspaceSSO removes the single sign-on of the workspace, its members log in as
+// before it. The accounts it created are kept.
+func (h *Handler) handleDeleteWorkspaceSSO(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	var deleted int64
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.SSOIdentity{}).Error; err != nil {
+			return err
+		}
+		res := tx.Where("workspace_id = ?", workspace.ID).Delete(&models.WorkspaceSSO{})
+		deleted = res.RowsAffected
+		return res.Error
+	})
+	if err != nil {
+		return sendError(c, "Cannot delete the single sign-on", fiber.StatusInternalServerError)
+	}
+	if deleted == 0 {
+		return sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleSSORedirect sends the user to the provider of the workspace
+func (h *Handler) handleSSORedirect(c *fiber.Ctx) error {
+	cfg, err := h.findSSO(c)
+	if err != nil {
+		return err
+	}
+
+	redirect, err := h.startSSO(c, cfg, 0)
+	if err != nil {
+		return err
+	}
+
+	return c.Redirect(redirect, fiber.StatusFound)
+}
+
+// handleSSOLink starts the login by the provider of the workspace which links the identity to
+// the account signed in. The existing accounts are only linked this way, the provider does not
+// vouch for their emails. The URL is returned, not redirected to, the request is a POST of the
+// scripts of the app to be protected from CSRF.
+func (h *Handler) handleSSOLink(c *fiber.Ctx) error {
+	workspace, membership, err := h.findWorkspace(c)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	cfg := new(models.WorkspaceSSO)
+	if res := h.db(c).Where("workspace_id = ?", workspace.ID).First(cfg); res.Error != nil {
+		return sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	redirect, err := h.startSSO(c, cfg, membership.UserID)
+	if err != nil {
+		return err
+	}
+
+	return c.JSON(fiber.Map{"url": redirect})
+}
+
+// startSSO sets the state cookie and returns the URL of the provider. The state of a link carries
+// the user to link, signed with the secret of the server.
+func (h *Handler) startSSO(c *fiber.Ctx, cfg *models.WorkspaceSSO, link uint) (string, error) {
+	base := ssoBase(cfg.WorkspaceID)
+
+	// the state is bound to the browser by a cookie to prevent login CSRF, with the nonce of
+	// the ID token or the id of the SAML request
+	state := util.RandomToken(16)
+	var bound, redirect string
+	var err error
+	sameSite := "Lax"
+	switch cfg.Protocol {
+	case models.SSOProtocolOIDC:
+		bound = util.RandomToken(16)
+		redirect, err = sso.AuthURL(util.Context(c), cfg, base+"/callback", state, bound)
+	case models.SSOProtocolSAML:
+		bound, redirect, err = sso.AuthnRequest(cfg, base+"/metadata", base+"/acs", state)
+		// the IdP posts the response from its own site, a Lax cookie would not be sent with it
+		sameSite = "None"
+	}
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Uint("workspace", cfg.WorkspaceID).Msg("Cannot start the single sign-on")
+		return "", sendError(c, "Cannot reach the identity provider", fiber.StatusBadGateway)
+	}
+
+	value := state + "." + bound
+	if link != 0 {
+		value += "." + strconv.Itoa(int(link))
+		value += "." + h.ssoLinkMAC(value)
+	}
+	cookie := h.stateCookie(ssoStateCookie, value)
+	if sameSite == "None" {
+		// the browsers drop a None cookie without Secure
+		cookie.Secure = true
+	}
+	cookie.SameSite = sameSite
+	c.Cookie(cookie)
+
+	return redirect, nil
+}
+
+// ssoLinkMAC signs the state of a link, a cookie of the browser cannot name another user
+func (h *Handler) ssoLinkMAC(value string) string {
+	mac := hmac.New(sha256.New, []byte(h.conf.Auth.Secret))
+	mac.Write([]byte("sso-link." + value))
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// handleOIDCCallback finishes the login by the OIDC issuer of the workspace
+func (h *Handler) handleOIDCCallback(c *fiber.Ctx) error {
+	cfg, err := h.findSSO(c)
+	if err != nil {
+		return err
+	}
+	if cfg.Protocol != models.SSOProtocolOIDC {
+		return sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	nonce, link, err := h.ssoState(c, c.Query("state"))
+	if err != nil {
+		return err
+	}
+	if c.Query("code") == "" {
+		return sendError(c, "Authorization was denied", fiber.StatusUnauthorized)
+	}
+
+	identity, err := sso.OIDCIdentity(util.Context(c), cfg, ssoBase(cfg.WorkspaceID)+"/callback", c.Query("code"), nonce)
+	if err != nil {
+		return h.ssoFailed(c, cfg, err)
+	}
+
+	return h.ssoLogin(c, cfg, identity, link)
+}
+
+// handleSAMLACS finishes the login by the SAML IdP of the workspace, with the response it posted
+func (h *Handler) handleSAMLACS(c *fiber.Ctx) error {
+	cfg, err := h.findSSO(c)
+	if err != nil {
+		return err
+	}
+	if cfg.Protocol != models.SSOProtocolSAML {
+		return sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	requestID, link, err := h.ssoState(c, c.FormValue("RelayState"))
+	if err != nil {
+		return err
+	}
+
+	base := ssoBase(cfg.WorkspaceID)
+	identity, err := sso.SAMLIdentity(cfg, c.FormValue("SAMLResponse"), base+"/metadata", base+"/acs", requestID)
+	if err != nil {
+		return h.ssoFailed(c, cfg, err)
+	}
+
+	return h.ssoLogin(c, cfg, identity, link)
+}
+
+// handleSAMLMetadata returns the metadata the IdP of the workspace is configured with
+func (h *Handler) handleSAMLMetadata(c *fiber.Ctx) error {
+	cfg, err := h.findSSO(c)
+	if err != nil {
+		return err
+	}
+	if cfg.Protocol != models.SSOProtocolSAML {
+		return sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	base := ssoBase(cfg.WorkspaceID)
+	metadata, err := sso.Metadata(base+"/metadata", base+"/acs")
+	if err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	c.Set(fiber.HeaderContentType, "application/samlmetadata+xml")
+	return c.Send(metadata)
+}
+
+// findSSO returns the single sign-on of the :workspace param
+func (h *Handler) findSSO(c *fiber.Ctx) (*models.WorkspaceSSO, error) {
+	cfg := new(models.WorkspaceSSO)
+	if res := h.db(c).Where("workspace_id = ?", c.Params("workspace")).First(cfg); res.Error != nil {
+		return nil, sendError(c, "Single sign-on is not configured", fiber.StatusNotFound)
+	}
+
+	return cfg, nil
+}
+
+// ssoState checks the state the provider sent back is the one of the cookie, and returns the
+// value bound to it and the user to link, 0 for a login
+func (h *Handler) ssoState(c *fiber.Ctx, state string) (string, uint, error) {
+	cookie := c.Cookies(ssoStateCookie)
+	h.tokens.ClearCookies(c, ssoStateCookie)
+
+	invalid := sendError(c, "Invalid single sign-on state", fiber.StatusForbidden)
+	parts := strings.Split(cookie, ".")
+	if (len(parts) != 2 && len(parts) != 4) || state == "" || parts[0] != state {
+		return "", 0, invalid
+	}
+	if len(parts) == 2 {
+		return parts[1], 0, nil
+	}
+
+	signed := strings.Join(parts[:3], ".")
+	if !hmac.Equal([]byte(parts[3]), []byte(h.ssoLinkMAC(signed))) {
+		return "", 0, invalid
+	}
+	link, err := strconv.ParseUint(parts[2], 10, 0)
+	if err != nil || link == 0 {
+		return "", 0, invalid
+	}
+
+	return parts[1], uint(link), nil
+}
+
+func (h *Handler) ssoFailed(c *fiber.Ctx, cfg *models.WorkspaceSSO, err error) error {
+	logging.FromCtx(c).Warn().Err(err).Uint("workspace", cfg.WorkspaceID).Str("protocol", cfg.Protocol).Msg("Single sign-on failed")
+	if errors.Is(err, sso.ErrNoEmail) {
+		return sendError(c, "The identity provider sent no email", fiber.StatusUnauthorized)
+	}
+
+	return sendError(c, "The identity provider did not sign you in", fiber.StatusUnauthorized)
+}
+
+// ssoLogin logs the user of the identity in, like a login with the password: a user with 2FA
+// still has to give a code. The identity is linked to the user link first, when it is not 0.
+func (h *Handler) ssoLogin(c *fiber.Ctx, cfg *models.WorkspaceSSO, identity *sso.Identity, link uint) error {
+	if !cfg.AllowsEmail(identity.Email) {
+		return sendError(c, "The email is not of a domain of the workspace", fiber.StatusForbidden)
+	}
+
+	u, err := h.findOrCreateSSOUser(c, cfg, identity, link)
+	var refused *errSSOLogin
+	if errors.As(err, &refused) {
+		return sendError(c, refused.message, refused.status)
+	}
+	if err != nil {
+		if qerr := quotaError(err); qerr != nil {
+			return qerr
+		}
+		logging.FromCtx(c).Error().Err(err).Uint("workspace", cfg.WorkspaceID).Msg("Cannot sign the user in by the provider")
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	if err := h.checkLoginAllowed(c, u); err != nil {
+		return err
+	}
+	if u.Locked {
+		return sendError(c, "Account is locked", fiber.StatusForbidden)
+	}
+
+	if !u.TOTPEnabled {
+		h.loginSucceeded(c, u)
+	}
+
+	return h.sendLoginResponse(c, u)
+}
+
+// findOrCreateSSOUser returns the user of the identity. A user is found by the subject linked
+// before, or is the member linking it, otherwise a new account is created when the workspace
+// provisions them. An existing account is never linked by its email: the owner of the workspace
+// chooses the provider and its domains, the provider does not vouch for the accounts.
+func (h *Handler) findOrCreateSSOUser(c *fiber.Ctx, cfg *models.WorkspaceSSO, identity *sso.Identity, link uint) (*models.User, error) {
+	linked := new(models.SSOIdentity)
+	if res := h.db(c).Where("workspace_id = ? AND subject = ?", cfg.WorkspaceID, identity.Subject).Limit(1).Find(linked); res.Error != nil {
+		return nil, res.Error
+	} else if res.RowsAffected > 0 {
+		if link != 0 && link != linked.UserID {
+			return nil, &errSSOLogin{fiber.StatusConflict, "The identity is linked to another account"}
+		}
+		u, err := h.userRepo(c).ByID(linked.UserID)
+		if err != nil {
+			return nil, &errSSOLogin{fiber.StatusUnauthorized, "Linked account is deleted"}
+		}
+		if _, err := h.findMembership(c, u, cfg.WorkspaceID); err != nil {
+			return nil, &errSSOLogin{fiber.StatusForbidden, "You are not a member of the workspace any more"}
+		}
+		return u, nil
+	}
+
+	if link != 0 {
+		u, err := h.userRepo(c).ByID(link)
+		if err != nil {
+			return nil, &errSSOLogin{fiber.StatusUnauthorized, "Account is deleted"}
+		}
+		if _, err := h.findMembership(c, u, cfg.WorkspaceID); err != nil {
+			return nil, &errSSOLogin{fiber.StatusForbidden, "You are not a member of the workspace any more"}
+		}
+		return u, h.db(c).Create(&models.SSOIdentity{WorkspaceID: cfg.WorkspaceID, Subject: identity.Subject, UserID: u.ID}).Error
+	}
+
+	if _, err := h.userRepo(c).ByEmail(identity.Email); err == nil {
+		return nil, &errSSOLogin{fiber.StatusConflict, "Email is already registered, log in and link your account to the single sign-on of the workspace"}
+	}
+	if !cfg.Provision {
+		return nil, &errSSOLogin{fiber.StatusForbidden, "Ask an owner of the workspace for an invitation"}
+	}
+
+	u := &models.User{
+		Email:       identity.Email,
+		Username:    h.uniqueUsername(c, &oauth.Profile{Email: identity.Email, Username: identity.Username}),
+		DisplayName: identity.Name,
+	}
+	err := h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		if err := repository.NewUserRepo(db.NewStore(tx)).Create(u); err != nil {
+			return err
+		}
+		if err := tx.Create(&models.Membership{WorkspaceID: cfg.WorkspaceID, UserID: u.ID, Role: cfg.DefaultRole}).Error; err != nil {
+			return err
+		}
+
+		return tx.Create(&models.SSOIdentity{WorkspaceID: cfg.WorkspaceID, Subject: identity.Subject, UserID: u.ID}).Error
+	})
+	if db.IsUniqueViolation(err) {
+		return nil, &errSSOLogin{fiber.StatusConflict, "Email is already registered"}
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	return u, nil
+}
+
+// checkSSORequired refuses the other logins of a user who is a member, not an owner, of a
+// workspace enforcing its single sign-on. The field loginUrl is where the user logs in instead.
+func (h *Handler) checkSSORequired(c *fiber.Ctx, u *models.User) error {
+	cfg := new(models.WorkspaceSSO)
+	res := h.db(c).Model(cfg).
+		Joins("JOIN memberships ON memberships.workspace_id = workspace_sso.workspace_id").
+		Where("memberships.user_id = ? AND memberships.role <> ? AND workspace_sso.enforced = ?", u.ID, models.WorkspaceOwner, true).
+		Order("workspace_sso.workspace_id").Limit(1).Find(cfg)
+	if res.Error != nil || res.RowsAffected == 0 {
+		return nil
+	}
+
+	return models.NewError(fiber.StatusForbidden, "Your workspace requires single sign-on").
+		WithFields(map[string]string{"loginUrl": ssoBase(cfg.WorkspaceID)})
+}
@@ -0,0 +1,278 @@
+package router
+
+import (
+	"database/sql"
+	"encoding/json"
+	"fmt"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"task-app/cache"
+	"task-app/db"
+	"task-app/models"
+	"time"
+)
+
+// maxStatsDays bounds the range of the statistics
+const maxStatsDays = 366
+
+type dayCount struct {
+	Day   string `json:"date"`
+	Count int64  `json:"count"`
+}
+
+type groupCount struct {
+	ID    uint   `json:"id"`
+	Name  string `json:"name"`
+	Open  int64  `json:"open"`
+	Done  int64  `json:"done"`
+	Total int64  `json:"total"`
+}
+
+type burndownDay struct {
+	Day       string `json:"date"`
+	Remaining int64  `json:"remaining"`
+	Completed int64  `json:"completed"`
+}
+
+func (h *Handler) setupStatsRoutes() {
+	STATS.Use(h.tokens.SecureAuth())
+	STATS.Get("/", h.handleGetStats)
+}
+
+// handleGetStats returns the productivity of the tasks the user can read over the ?from and ?to dates,
+// the last 30 days by default: the tasks completed per day, the current streak of days with a
+// completed task, the average time from the creation to the completion and the tasks by label and
+// by project. ?project= narrows the statistics to a project and adds its burndown.
+// Everything is aggregated by the database. The days are in the zone of the user or ?tz=, at its
+// offset of today.
+func (h *Handler) handleGetStats(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+
+	now := time.Now().In(loc)
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, loc)
+	from, to := today.AddDate(0, 0, -29), today.AddDate(0, 0, 1)
+	if q := c.Query("from"); q != "" {
+		if from, err = parseExportDate(q, false, loc); err != nil {
+			return sendError(c, "Invalid from date", fiber.StatusBadRequest)
+		}
+	}
+	if q := c.Query("to"); q != "" {
+		if to, err = parseExportDate(q, true, loc); err != nil {
+			return sendError(c, "Invalid to date", fiber.StatusBadRequest)
+		}
+	}
+	if !from.Before(to) || to.Sub(from) > maxStatsDays*24*time.Hour {
+		return sendError(c, "The range must be from 1 to 366 days", fiber.StatusBadRequest)
+	}
+
+	var project *models.Project
+	if id := c.Query("project"); id != "" {
+		if project, err = h.findProject(c, id); err != nil {
+			return sendError(c, "Cannot find the Project", fiber.StatusNotFound)
+		}
+	}
+
+	// the statistics of today are cached until a task changes
+	key := fmt.Sprintf("stats:%d:%s:%s:%s:%s:%d", u.ID, loc, today.Format("2006-01-02"), from.Format("2006-01-02"), to.Format("2006-01-02"), projectID(project))
+	var body []byte
+	if !h.cache.Get(cache.Tasks, key, &body) {
+		stats, err := h.stats(c, u, project, today, from, to)
+		if err != nil {
+			return sendError(c, "Cannot compute the statistics", fiber.StatusInternalServerError)
+		}
+		if body, err = json.Marshal(stats); err != nil {
+			return sendError(c, "Cannot compute the statistics", fiber.StatusInternalServerError)
+		}
+		h.cache.Set(cache.Tasks, key, body)
+	}
+
+	c.Type("json")
+	return c.Send(body)
+}
+
+// stats aggregates the statistics of the tasks the user can read, of the project when it is given
+func (h *Handler) stats(c *fiber.Ctx, u *models.User, project *models.Project, today, from, to time.Time) (fiber.Map, error) {
+	// tasks returns a new query of the tasks of the statistics
+	// the days are grouped by the database at the offset of the zone today
+	_, offset := today.Zone()
+	tasks := func() *gorm.DB {
+		query := h.db(c).Model(&models.Task{}).Scopes(models.AccessibleBy(u))
+		if project != nil {
+			query = query.Where("tasks.project_id = ?", project.ID)
+		}
+		return query
+	}
+
+	var completed []dayCount
+	if err := tasks().
+		Select(db.DateOf("tasks.completed_at", offset)+" AS day, count(*) AS count").
+		Where("tasks.completed_at >= ? AND tasks.completed_at < ?", from, to).
+		Group("day").
+		Scan(&completed).Error; err != nil {
+		return nil, err
+	}
+
+	var streakDays []string
+	if err := tasks().
+		Select(db.DateOf("tasks.completed_at", offset)+" AS day").
+		Where("tasks.completed_at >= ?", today.AddDate(0, 0, -maxStatsDays)).
+		Group("day").
+		Order("day DESC").
+		Scan(&streakDays).Error; err != nil {
+		return nil, err
+	}
+
+	var average sql.NullFloat64
+	if err := tasks().
+		Select("AVG("+db.SecondsBetween("tasks.created_at", "tasks.completed_at")+")").
+		Where("tasks.completed_at >= ? AND tasks.completed_at < ?", from, to).
+		Scan(&average).Error; err != nil {
+		return nil, err
+	}
+
+	var byLabel []groupCount
+	if err := tasks().
+		Select(countsSelect("labels.id AS id, labels.name AS name"), models.StatusDone, models.StatusDone).
+		Joins("JOIN task_labels ON task_labels.task_id = tasks.id").
+		Joins("JOIN labels ON labels.id = task_labels.label_id AND labels.deleted_at IS NULL").
+		Group("labels.id, labels.name").
+		Order("labels.name").
+		Scan(&byLabel).Error; err != nil {
+		return nil, err
+	}
+
+	var byProject []groupCount
+	if err := tasks().
+		Select(countsSelect("projects.id AS id, projects.title AS name"), models.StatusDone, models.StatusDone).
+		Joins("JOIN projects ON projects.id = tasks.project_id AND projects.deleted_at IS NULL").
+		Group("projects.id, projects.title").
+		Order("projects.title").
+		Scan(&byProject).Error; err != nil {
+		return nil, err
+	}
+
+	stats := fiber.Map{
+		"from":                     from.Format("2006-01-02"),
+		"to":                       to.AddDate(0, 0, -1).Format("2006-01-02"),
+		"completedPerDay":          everyDay(from, to, completed),
+		"currentStreak":            currentStreak(today, streakDays),
+		"averageCompletionSeconds": int64(average.Float64),
+		"byLabel":                  nonNilCounts(byLabel),
+		"byProject":                nonNilCounts(byProject),
+	}
+
+	if project != nil {
+		burndown, err := burndown(tasks, from, to, offset)
+		if err != nil {
+			return nil, err
+		}
+		stats["burndown"] = burndown
+	}
+
+	return stats, nil
+}
+
+func projectID(p *models.Project) uint {
+	if p == nil {
+		return 0
+	}
+	return p.ID
+}
+
+// burndown returns the open tasks at the end of every day of the range, from the tasks
+// created and completed by day at the offset
+func burndown(tasks func() *gorm.DB, from, to time.Time, offset int) ([]burndownDay, error) {
+	var before struct {
+		Created   int64
+		Completed int64
+	}
+	if err := tasks().
+		Select("SUM(CASE WHEN tasks.created_at < ? THEN 1 ELSE 0 END) AS created, "+
+			"SUM(CASE WHEN tasks.completed_at < ? THEN 1 ELSE 0 END) AS completed", from, from).
+		Scan(&before).Error; err != nil {
+		return nil, err
+	}
+
+	var created, completed []dayCount
+	if err := tasks().
+		Select(db.DateOf("tasks.created_at", offset)+" AS day, count(*) AS count").
+		Where("tasks.created_at >= ? AND tasks.created_at < ?", from, to).
+		Group("day").
+		Scan(&created).Error; err != nil {
+		return nil, err
+	}
+	if err := tasks().
+		Select(db.DateOf("tasks.completed_at", offset)+" AS day, count(*) AS count").
+		Where("tasks.completed_at >= ? AND tasks.completed_at < ?", from, to).
+		Group("day").
+		Scan(&completed).Error; err != nil {
+		return nil, err
+	}
+
+	createdDays, completedDays := everyDay(from, to, created), everyDay(from, to, completed)
+	remaining := before.Created - before.Completed
+	days := make([]burndownDay, 0, len(createdDays))
+	for i := range createdDays {
+		remaining += createdDays[i].Count - completedDays[i].Count
+		days = append(days, burndownDay{Day: createdDays[i].Day, Remaining: remaining, Completed: completedDays[i].Count})
+	}
+
+	return days, nil
+}
+
+// countsSelect returns the select of the open, done and total tasks of a group, given the done status twice
+func countsSelect(group string) string {
+	return group + ", SUM(CASE WHEN tasks.status <> ? THEN 1 ELSE 0 END) AS open, " +
+		"SUM(CASE WHEN tasks.status = ? THEN 1 ELSE 0 END) AS done, count(*) AS total"
+}
+
+// everyDay returns the counts of every day of the range, 0 for the days without a row
+func everyDay(from, to time.Time, rows []dayCount) []dayCount {
+	counts := make(map[string]int64, len(rows))
+	for _, r := range rows {
+		counts[r.Day] = r.Count
+	}
+
+	var days []dayCount
+	for d := from; d.Before(to); d = d.AddDate(0, 0, 1) {
+		day := d.Format("2006-01-02")
+		days = append(days, dayCount{Day: day, Count: counts[day]})
+	}
+
+	return days
+}
+
+// currentStreak counts the days in a row with a completed task, up to today or, while today
+// has none yet, up to yesterday. The days are the completion dates, the last one first.
+func currentStreak(today time.Time, days []string) int {
+	expected := today
+	if len(days) > 0 && days[0] != today.Format("2006-01-02") {
+		expected = today.AddDate(0, 0, -1)
+	}
+
+	streak := 0
+	for _, day := range days {
+		if day != expected.Format("2006-01-02") {
+			break
+		}
+		streak++
+		expected = expected.AddDate(0, 0, -1)
+	}
+
+	return streak
+}
+
+func nonNilCounts(counts []groupCount) []groupCount {
+	if counts == nil {
+		return []groupCount{}
+	}
+	return counts
+}
@@ -0,0 +1,503 @@
+package router
+
+import (
+	"encoding/base64"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"task-app/cache"
+	"task-app/db"
+	"task-app/events"
+	"task-app/jobs"
+	"task-app/models"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+)
+
+// syncOverlap is how far before its token a sync reads the changes again: a change committed
+// after the previous sync, by a transaction started before it, is then still sent
+const syncOverlap = time.Minute
+
+func (h *Handler) setupSyncRoutes() {
+	SYNC.Use(h.tokens.SecureAuth())
+	SYNC.Get("/", h.handleGetSync)
+	SYNC.Post("/", h.idempotent(), h.handleSync)
+}
+
+// handleGetSync sends the tasks, projects and labels changed since the token of the previous
+// sync, with the tombstones of the deleted ones. Without a token every entity is sent.
+func (h *Handler) handleGetSync(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	var since *time.Time
+	if token := c.Query("since"); token != "" {
+		t, err := parseSyncToken(token)
+		if err != nil {
+			return sendError(c, "Invalid sync token", fiber.StatusBadRequest)
+		}
+		// the tombstones of the tasks are purged with the trash
+		if time.Since(t) > jobs.TrashRetention {
+			return sendError(c, "The sync token expired, sync again without it", fiber.StatusGone)
+		}
+		t = t.Add(-syncOverlap)
+		since = &t
+	}
+
+	now := time.Now()
+	changes, err := h.syncChanges(c, u, since)
+	if err != nil {
+		return sendError(c, "Cannot read the changes", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(models.SyncFeed{Changes: changes, Token: syncToken(now)})
+}
+
+// syncChanges returns the entities of the user changed since the time, every entity without one
+func (h *Handler) syncChanges(c *fiber.Ctx, u *models.User, since *time.Time) ([]models.SyncChange, error) {
+	changed := func(query *gorm.DB) *gorm.DB {
+		if since != nil {
+			query = query.Where("updated_at > ?", *since)
+		}
+		return query.Order("updated_at, id")
+	}
+	changes := []models.SyncChange{}
+
+	var tasks []models.Task
+	if err := changed(h.db(c).Scopes(models.AccessibleBy(u), models.TaskDetails)).Find(&tasks).Error; err != nil {
+		return nil, err
+	}
+	if err := models.CountComments(h.db(c), tasks); err != nil {
+		return nil, err
+	}
+	for i := range tasks {
+		changes = append(changes, taskEntity(&tasks[i]))
+	}
+
+	var projects []models.Project
+	if err := changed(h.db(c).Scopes(models.AccessibleBy(u))).Find(&projects).Error; err != nil {
+		return nil, err
+	}
+	for i := range projects {
+		changes = append(changes, projectEntity(&projects[i]))
+	}
+
+	var labels []models.Label
+	if err := changed(h.db(c).Scopes(models.OwnedBy(u))).Find(&labels).Error; err != nil {
+		return nil, err
+	}
+	for i := range labels {
+		changes = append(changes, labelEntity(&labels[i]))
+	}
+
+	if since == nil {
+		return changes, nil
+	}
+
+	deleted := []struct {
+		kind  string
+		model interface{}
+		scope func(*gorm.DB) *gorm.DB
+	}{
+		{models.SyncTask, &models.Task{}, models.AccessibleBy(u)},
+		{models.SyncProject, &models.Project{}, models.AccessibleBy(u)},
+		{models.SyncLabel, &models.Label{}, models.OwnedBy(u)},
+	}
+	for _, d := range deleted {
+		var rows []struct {
+			ID        uint
+			DeletedAt gorm.DeletedAt
+		}
+		err := h.db(c).Unscoped().Model(d.model).Scopes(d.scope).
+			Select("id", "deleted_at").
+			Where("deleted_at > ?", *since).
+			Order("deleted_at, id").
+			Scan(&rows).Error
+		if err != nil {
+			return nil, err
+		}
+		for _, r := range rows {
+			changes = append(changes, tombstone(d.kind, r.ID, r.DeletedAt))
+		}
+	}
+
+	return changes, nil
+}
+
+// handleSync applies the changes a client made offline in one transaction, each one in a
+// savepoint like the bulk operations. A change made from a version which is not the current
+// one is not applied: its result is a conflict with the entity as the server has it.
+func (h *Handler) handleSync(c *fiber.Ctx) error {
+	input := new(models.SyncInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+	for _, change := range input.Changes {
+		if change.Task != nil {
+			change.Task.ResolveDue(loc)
+		}
+	}
+
+	results := make([]models.SyncResult, len(input.Changes))
+	var published []events.Event
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		for i, change := range input.Changes {
+			var evs []events.Event
+			err := tx.Transaction(func(tx *gorm.DB) error {
+				var err error
+				evs, err = h.applySyncChange(tx, u, change, &results[i])
+				return err
+			})
+
+			results[i].Index, results[i].ClientID = i, change.ClientID
+			if err != nil {
+				syncError(c, err, &results[i])
+				continue
+			}
+			published = append(published, evs...)
+		}
+
+		return nil
+	})
+	if err != nil {
+		return sendError(c, "Cannot apply the changes", fiber.StatusInternalServerError)
+	}
+
+	// the entries read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+	for _, e := range published {
+		events.Publish(e)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{"results": results})
+}
+
+// applySyncChange applies a change in the transaction and returns the events to publish
+// once it is committed
+func (h *Handler) applySyncChange(tx *gorm.DB, u *models.User, ch models.SyncClientChange, result *models.SyncResult) ([]events.Event, error) {
+	switch ch.Type {
+	case models.SyncTask:
+		return h.syncTask(tx, u, ch, result)
+	case models.SyncProject:
+		return nil, syncProject(tx, u, ch, result)
+	default:
+		return nil, syncLabel(tx, u, ch, result)
+	}
+}
+
+func (h *Handler) syncTask(tx *gorm.DB, u *models.User, ch models.SyncClientChange, result *models.SyncResult) ([]events.Event, error) {
+	tasks := repository.NewTaskRepo(db.NewStore(tx))
+	if ch.ID == 0 {
+		projectID, workspaceID, err := tasks.Placement(u, ch.Task.ProjectID, ch.Task.WorkspaceID)
+		if err != nil {
+			return nil, workspaceError(err)
+		}
+
+		task := models.Task{UserID: u.ID, ProjectID: projectID, WorkspaceID: workspaceID}
+		task.Apply(ch.Task)
+		if err := tasks.Create(&task); err != nil {
+			return nil, err
+		}
+
+		syncApplied(result, fiber.StatusOK, taskEntity(&task))
+		return []events.Event{taskEvent(events.TaskCreated, u, &task, task.Api())}, nil
+	}
+
+	task, err := tasks.Get(u, ch.ID, models.WorkspaceWriters...)
+	if err != nil {
+		if deletedAt, ok := findDeleted(tx, &models.Task{}, models.AccessibleBy(u), ch.ID); ok {
+			return nil, deletedChange(ch, deletedAt, result)
+		}
+		return nil, models.NewError(fiber.StatusNotFound, "Cannot find the Task")
+	}
+	if ch.Version == 0 {
+		return nil, models.ValidationError(map[string]string{"version": "The version of the task read is required"})
+	}
+	if ch.Version != task.Version {
+		return nil, syncConflict(taskEntity(task))
+	}
+
+	if ch.Op == models.SyncDelete {
+		if err := tasks.Delete(task); err != nil {
+			return nil, err
+		}
+		result.Status = fiber.StatusNoContent
+		return []events.Event{taskEvent(events.TaskDeleted, u, task, nil)}, nil
+	}
+
+	completed := task.Status != models.StatusDone && ch.Task.Status == models.StatusDone
+	changes := taskChanges(task, ch.Task)
+	if ch.Task.ProjectID != nil || ch.Task.WorkspaceID != nil {
+		from, fromWorkspace := task.ProjectID, task.WorkspaceID
+		task.ProjectID, task.WorkspaceID, err = tasks.Placement(u, ch.Task.ProjectID, ch.Task.WorkspaceID)
+		if err != nil {
+			return nil, workspaceError(err)
+		}
+		if err := h.quotas.Move(tx, fromWorkspace, task.WorkspaceID); err != nil {
+			return nil, err
+		}
+		if !sameID(from, task.ProjectID) {
+			changes["projectId"] = events.Change{From: from, To: task.ProjectID}
+		}
+	}
+	task.Apply(ch.Task)
+
+	if err := tasks.Save(task); err != nil {
+		// changed between the read and the save
+		if errors.Is(err, repository.ErrConflict) {
+			if current, err := tasks.Get(u, ch.ID); err == nil {
+				return nil, syncConflict(taskEntity(current))
+			}
+		}
+		return nil, err
+	}
+	syncApplied(result, fiber.StatusOK, taskEntity(task))
+
+	updated := taskEvent(events.TaskUpdated, u, task, task.Api())
+	updated.Changes = changes
+	evs := []events.Event{updated}
+	if completed {
+		evs = append(evs, taskEvent(events.TaskCompleted, u, task, task.Api()))
+	}
+
+	return evs, nil
+}
+
+func syncProject(tx *gorm.DB, u *models.User, ch models.SyncClientChange, result *models.SyncResult) error {
+	if ch.Op == models.SyncUpsert {
+		if ch.Project.Title = strings.TrimSpace(ch.Project.Title); ch.Project.Title == "" {
+			return models.NewError(fiber.StatusBadRequest, "Project title is required field")
+		}
+	}
+
+	if ch.ID == 0 {
+		project := models.Project{UserID: u.ID, Title: ch.Project.Title, Description: ch.Project.Description}
+		if ch.Project.WorkspaceID != nil {
+			tasks := repository.NewTaskRepo(db.NewStore(tx))
+			if _, _, err := tasks.Placement(u, nil, ch.Project.WorkspaceID); err != nil {
+				return workspaceError(err)
+			}
+			project.WorkspaceID = ch.Project.WorkspaceID
+		}
+		if err := tx.Create(&project).Error; err != nil {
+			return err
+		}
+
+		syncApplied(result, fiber.StatusOK, projectEntity(&project))
+		return nil
+	}
+
+	project := new(models.Project)
+	if err := tx.Scopes(models.AccessibleBy(u, models.WorkspaceWriters...)).First(project, ch.ID).Error; err != nil {
+		if deletedAt, ok := findDeleted(tx, &models.Project{}, models.AccessibleBy(u), ch.ID); ok {
+			return deletedChange(ch, deletedAt, result)
+		}
+		return models.NewError(fiber.StatusNotFound, "Cannot find the Project")
+	}
+	if err := checkSyncBase(ch, projectEntity(project)); err != nil {
+		return err
+	}
+
+	if ch.Op == models.SyncDelete {
+		if err := tx.Where("project_id = ?", project.ID).Delete(&models.Task{}).Error; err != nil {
+			return err
+		}
+		if err := tx.Delete(project).Error; err != nil {
+			return err
+		}
+		result.Status = fiber.StatusNoContent
+		return nil
+	}
+
+	project.Title = ch.Project.Title
+	project.Description = ch.Project.Description
+	if err := tx.Save(project).Error; err != nil {
+		return err
+	}
+
+	syncApplied(result, fiber.StatusOK, projectEntity(project))
+	return nil
+}
+
+func syncLabel(tx *gorm.DB, u *models.User, ch models.SyncClientChange, result *models.SyncResult) error {
+	if ch.Op == models.SyncUpsert {
+		if msg := validateLabel(ch.Label); msg != "" {
+			return models.NewError(fiber.StatusBadRequest, msg)
+		}
+	}
+
+	if ch.ID == 0 {
+		// the label may have been created offline on another device too
+		existing := new(models.Label)
+		if tx.Scopes(models.OwnedBy(u)).Where("name = ?", ch.Label.Name).Limit(1).Find(existing).RowsAffected > 0 {
+			entity := labelEntity(existing)
+			return models.NewError(fiber.StatusConflict, "Label already exists").WithCurrent(&entity)
+		}
+
+		label := models.Label{UserID: u.ID, Name: ch.Label.Name, Color: ch.Label.Color}
+		if err := tx.Create(&label).Error; err != nil {
+			return err
+		}
+
+		syncApplied(result, fiber.StatusOK, labelEntity(&label))
+		return nil
+	}
+
+	label := new(models.Label)
+	if err := tx.Scopes(models.OwnedBy(u)).First(label, ch.ID).Error; err != nil {
+		if deletedAt, ok := findDeleted(tx, &models.Label{}, models.OwnedBy(u), ch.ID); ok {
+			return deletedChange(ch, deletedAt, result)
+		}
+		return models.NewError(fiber.StatusNotFound, "Cannot find the Label")
+	}
+	if err := checkSyncBase(ch, labelEntity(label)); err != nil {
+		return err
+	}
+	if err := models.TouchLabelTasks(tx, label.ID); err != nil {
+		return err
+	}
+
+	if ch.Op == models.SyncDelete {
+		if err := tx.Model(label).Association("Tasks").Clear(); err != nil {
+			return err
+		}
+		if err := tx.Delete(label).Error; err != nil {
+			return err
+		}
+		result.Status = fiber.StatusNoContent
+		return nil
+	}
+
+	label.Name = ch.Label.Name
+	label.Color = ch.Label.Color
+	if err := tx.Save(label).Error; err != nil {
+		return err
+	}
+
+	syncApplied(result, fiber.StatusOK, labelEntity(label))
+	return nil
+}
+
+// checkSyncBase returns a conflict when the project or the label was changed since the
+// updatedAt the change was made from. The times are compared at the millisecond, the
+// precision every database keeps.
+func checkSyncBase(ch models.SyncClientChange, current models.SyncChange) error {
+	if ch.BaseUpdatedAt == nil {
+		return models.ValidationError(map[string]string{"baseUpdatedAt": "The updatedAt of the " + ch.Type + " read is required"})
+	}
+	if !ch.BaseUpdatedAt.Truncate(time.Millisecond).Equal(current.UpdatedAt.Truncate(time.Millisecond)) {
+		return syncConflict(current)
+	}
+
+	return nil
+}
+
+// findDeleted returns when the row of the model with the id was deleted, false when it is not
+func findDeleted(tx *gorm.DB, model interface{}, scope func(*gorm.DB) *gorm.DB, id uint) (gorm.DeletedAt, bool) {
+	var row struct {
+		DeletedAt gorm.DeletedAt
+	}
+	res := tx.Unscoped().Model(model).Scopes(scope).
+		Select("deleted_at").
+		Where("id = ? AND deleted_at IS NOT NULL", id).
+		Limit(1).
+		Scan(&row)
+
+	return row.DeletedAt, res.Error == nil && res.RowsAffected > 0
+}
+
+// deletedChange answers a change of a deleted entity: a delete is already done, an update
+// conflicts with the tombstone
+func deletedChange(ch models.SyncClientChange, deletedAt gorm.DeletedAt, result *models.SyncResult) error {
+	if ch.Op == models.SyncDelete {
+		result.Status = fiber.StatusNoContent
+		return nil
+	}
+
+	return syncConflict(tombstone(ch.Type, ch.ID, deletedAt))
+}
+
+// syncConflict returns the conflict of a change with the entity as the server has it
+func syncConflict(current models.SyncChange) error {
+	msg := "The " + current.Type + " was changed since the version of the change"
+	if current.Deleted {
+		msg = "The " + current.Type + " was deleted"
+	}
+
+	return models.NewError(fiber.StatusConflict, msg).WithCurrent(&current)
+}
+
+// syncError sets the status and the message of a failed change, and the entity of a conflict
+func syncError(c *fiber.Ctx, err error, result *models.SyncResult) {
+	result.Status, result.Error = bulkError(c, err)
+	result.Entity = nil
+
+	var appErr *models.AppError
+	if errors.As(err, &appErr) && appErr.Status == fiber.StatusConflict {
+		result.Conflict = true
+		result.Entity, _ = appErr.Current.(*models.SyncChange)
+	}
+}
+
+func syncApplied(result *models.SyncResult, status int, entity models.SyncChange) {
+	result.Status, result.Entity = status, &entity
+}
+
+// workspaceError returns the error of a placement in a workspace, as sendWorkspaceError answers it
+func workspaceError(err error) error {
+	if errors.Is(err, errNoPermission) {
+		return models.NewError(fiber.StatusForbidden, err.Error())
+	}
+
+	return models.NewError(fiber.StatusNotFound, "Cannot find the Workspace")
+}
+
+func taskEntity(t *models.Task) models.SyncChange {
+	return models.SyncChange{Type: models.SyncTask, ID: t.ID, UpdatedAt: t.UpdatedAt.UTC(), Data: t.Api()}
+}
+
+func projectEntity(p *models.Project) models.SyncChange {
+	return models.SyncChange{Type: models.SyncProject, ID: p.ID, UpdatedAt: p.UpdatedAt.UTC(), Data: p.Api()}
+}
+
+func labelEntity(l *models.Label) models.SyncChange {
+	return models.SyncChange{Type: models.SyncLabel, ID: l.ID, UpdatedAt: l.UpdatedAt.UTC(), Data: l.Api()}
+}
+
+func tombstone(kind string, id uint, deletedAt gorm.DeletedAt) models.SyncChange {
+	return models.SyncChange{Type: kind, ID: id, Deleted: true, UpdatedAt: deletedAt.Time.UTC()}
+}
+
+// syncToken returns the opaque token of a sync made at the time
+func syncToken(t time.Time) string {
+	return base64.RawURLEncoding.EncodeToString([]byte(strconv.FormatInt(t.UnixNano(), 10)))
+}
+
+// parseSyncToken reads a token of syncToken
+func parseSyncToken(s string) (time.Time, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil {
+		return time.Time{}, err
+	}
+	nanos, err := strconv.ParseInt(string(raw), 10, 64)
+	if err != nil {
+		return time.Time{}, err
+	}
+
+	// local as the times written by gorm, sqlite compares them as text
+	return time.Unix(0, nanos).Local(), nil
+}
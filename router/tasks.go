@@ -1,28 +1,76 @@
 package router
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
-	"task-app/db"
+	"strconv"
+	"strings"
+	"task-app/events"
 	"task-app/models"
-	"task-app/util"
+	"task-app/repository"
+	"time"
 )
 
+// sendError returns the error of the status, it is answered by the error handler
 var sendError = func(c *fiber.Ctx, m string, s int) error {
-	return models.DefaultError(m).SendStatus(c, s)
+	return models.NewError(s, m)
 }
 
-func setupTasksRoutes() {
-	TASKS.Use(util.SecureAuth())
-	TASKS.Get("/", handleGetTasks)
-	TASKS.Post("/", handleCreateTask)
-	TASKS.Patch("/", handleUpdateTask)
+func (h *Handler) setupTasksRoutes() {
+	TASKS.Use(h.tokens.SecureAuth())
+	TASKS.Get("/", h.handleGetTasks)
+	TASKS.Post("/", h.idempotent(), h.handleCreateTask)
+	TASKS.Patch("/", h.handleUpdateTask)
+	TASKS.Put("/reorder", h.handleReorderTasks)
+	TASKS.Post("/bulk", timeout(slowTimeout), h.handleBulkTasks)
+	TASKS.Post("/quickadd", h.idempotent(), h.handleQuickAdd)
+	TASKS.Post("/archive", h.handleArchiveDoneTasks)
+	TASKS.Get("/export", timeout(slowTimeout), h.handleExportTasks)
+	TASKS.Post("/import", timeout(slowTimeout), h.idempotent(), h.handleImportTasks)
+	TASKS.Get("/trash", h.handleGetTrash)
+	TASKS.Get("/:id", h.handleGetTask)
+	TASKS.Delete("/:id", h.handleDeleteTask)
+	TASKS.Post("/:id/restore", h.handleRestoreTask)
+	TASKS.Post("/:id/archive", h.handleArchiveTask)
+	TASKS.Post("/:id/unarchive", h.handleUnarchiveTask)
+	TASKS.Post("/:id/template", h.handleSaveTaskAsTemplate)
+	TASKS.Post("/:id/labels/:labelId", h.handleAttachLabel)
+	TASKS.Delete("/:id/labels/:labelId", h.handleDetachLabel)
+	TASKS.Post("/:id/assignee", h.handleAssignTask)
+	TASKS.Delete("/:id/assignee", h.handleUnassignTask)
+	TASKS.Get("/:id/watchers", h.handleGetWatchers)
+	TASKS.Post("/:id/watchers", h.handleAddWatcher)
+	TASKS.Delete("/:id/watchers/:userId", h.handleRemoveWatcher)
+	TASKS.Get("/:id/activity", h.handleGetTaskActivity)
+	TASKS.Get("/:id/history", h.handleGetTaskHistory)
+	TASKS.Post("/:id/revert/:revision", h.handleRevertTask)
+	TASKS.Get("/:id/comments", h.handleGetComments)
+	TASKS.Post("/:id/comments", h.handleCreateComment)
+	TASKS.Delete("/:id/comments/:commentId", h.handleDeleteComment)
+	TASKS.Get("/:id/dependencies", h.handleGetDependencies)
+	TASKS.Post("/:id/dependencies", h.handleAddDependency)
+	TASKS.Delete("/:id/dependencies/:blockerId", h.handleRemoveDependency)
+	TASKS.Post("/:id/timer/start", h.handleStartTimer)
+	TASKS.Post("/:id/timer/stop", h.handleStopTimer)
+	TASKS.Get("/:id/time", h.handleGetTaskTime)
+	TASKS.Post("/:id/time", h.handleAddTimeEntry)
+	TASKS.Delete("/:id/time/:entryId", h.handleDeleteTimeEntry)
+	TASKS.Get("/:id/checklist", h.handleGetChecklist)
+	TASKS.Post("/:id/checklist", h.handleAddChecklistItem)
+	TASKS.Put("/:id/checklist/reorder", h.handleReorderChecklist)
+	TASKS.Patch("/:id/checklist/:itemId", h.handleUpdateChecklistItem)
+	TASKS.Post("/:id/checklist/:itemId/toggle", h.handleToggleChecklistItem)
+	TASKS.Delete("/:id/checklist/:itemId", h.handleDeleteChecklistItem)
+	TASKS.Get("/:id/attachments", h.handleGetAttachments)
+	TASKS.Post("/:id/attachments", h.handleUploadAttachment)
+	TASKS.Delete("/:id/attachments/:attachmentId", h.handleDeleteAttachment)
 }
 
-func handleGetTasks(c *fiber.Ctx) error {
+func (h *Handler) handleGetTasks(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	c.Accepts("json", "text")
 
-	u, err := util.GetUserByLocal(c)
+	u, err := h.currentUser(c)
 
 	if err != nil {
 		return sendError(
@@ -32,10 +80,52 @@ func handleGetTasks(c *fiber.Ctx) error {
 		)
 	}
 
-	var tasks []models.Task
-	result := db.DB.Where("user_id = ?", u.ID).Model(models.Task{}).Find(&tasks)
+	// ?filter=assigned lists the tasks assigned to the user, ?filter=created the ones created by the user
+	// ?labels=work,urgent returns tasks carrying any of the given labels
+	// ?status=todo returns the tasks of a status, the ones without a status are to do
+	// ?sort=priority or ?sort=due changes the order of the positions
+	// ?cursor= lists a page of the tasks newest first, as {tasks, nextCursor}
+	// ?due=overdue, today or week lists the open tasks due by then, the days are in the zone of the user or ?tz=
+	// ?include_archived=true lists the archived tasks and the tasks of the archived projects too
+	filter := repository.TaskFilter{
+		Labels:          splitQueryList(c.Query("labels")),
+		Status:          c.Query("status"),
+		Sort:            c.Query("sort"),
+		IncludeArchived: includeArchived(c),
+	}
+	if filter.Page, err = cursorPage(c); err != nil {
+		return err
+	}
+	if filter.Page != nil && filter.Sort != "" {
+		return sendError(c, "The tasks of a cursor cannot be sorted", fiber.StatusBadRequest)
+	}
+	switch c.Query("filter") {
+	case "assigned":
+		filter.AssigneeID = u.ID
+	case "created":
+		filter.CreatorID = u.ID
+	}
+
+	if due := c.Query("due"); due != "" {
+		loc, err := location(c, u)
+		if err != nil {
+			return err
+		}
+		if filter.DueBefore, err = dueBefore(due, time.Now().In(loc)); err != nil {
+			return sendError(c, err.Error(), fiber.StatusBadRequest)
+		}
+	}
+
+	if filter.WorkspaceID, err = queryID(c, "workspace"); err != nil {
+		return sendError(c, "Invalid workspace id", fiber.StatusBadRequest)
+	}
+	if filter.ProjectID, err = queryID(c, "project"); err != nil {
+		return sendError(c, "Invalid project id", fiber.StatusBadRequest)
+	}
 
-	if result.Error != nil {
+	tasks, err := h.taskRepo(c).List(u, filter)
+
+	if err != nil {
 		return sendError(
 			c,
 			"Cannot find user's tasks",
@@ -43,75 +133,131 @@ func handleGetTasks(c *fiber.Ctx) error {
 		)
 	}
 
+	if filter.Page != nil {
+		var next interface{}
+		if filter.Page.More(len(tasks)) {
+			tasks = tasks[:filter.Page.Limit]
+			last := tasks[len(tasks)-1]
+			next = nextCursor(last.CreatedAt, last.ID)
+		}
+
+		if notModified(c, tasksETag(tasks, next)) {
+			return sendNotModified(c)
+		}
+
+		response := make([]models.TaskApi, 0, len(tasks))
+		for _, t := range tasks {
+			response = append(response, t.Api())
+		}
+		return c.JSON(fiber.Map{"tasks": response, "nextCursor": next})
+	}
+
+	if notModified(c, tasksETag(tasks)) {
+		return sendNotModified(c)
+	}
+
 	var response []models.TaskApi
 
 	for _, t := range tasks {
-		task := models.TaskApi{
-			ID:          t.ID,
-			Title:       t.Title,
-			Description: t.Description,
-			Status:      t.Status,
-			CreatedAt:   t.CreatedAt.String(),
-			UpdatedAt:   t.UpdatedAt.String(),
-		}
-		response = append(response, task)
+		response = append(response, t.Api())
 	}
 
 	return c.Status(fiber.StatusOK).JSON(response)
 
 }
 
-func handleCreateTask(c *fiber.Ctx) error {
+// dueBefore returns the end of a ?due= view: overdue is now, today and week the end of the day
+// and of the 7th day in the zone of now. The instants are by the minute, so the lists are cached.
+func dueBefore(due string, now time.Time) (*time.Time, error) {
+	y, m, d := now.Date()
+	today := time.Date(y, m, d, 0, 0, 0, 0, now.Location())
+
+	var before time.Time
+	switch due {
+	case "overdue":
+		before = now.Truncate(time.Minute)
+	case "today":
+		before = today.AddDate(0, 0, 1)
+	case "week":
+		before = today.AddDate(0, 0, 7)
+	default:
+		return nil, errors.New("due must be overdue, today or week")
+	}
+
+	return &before, nil
+}
+
+// handleGetTask returns a task with its details, or 304 when it is the version of the If-None-Match
+func (h *Handler) handleGetTask(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	if notModified(c, taskETag(task)) {
+		return sendNotModified(c)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func (h *Handler) handleCreateTask(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	c.Accepts("json", "text")
 
-	var t models.TaskApi
+	var t models.TaskInput
 
-	if err := c.BodyParser(&t); err != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(models.ApiError{
-			Message: "Invalid request data",
-		})
+	if err := parseBody(c, &t); err != nil {
+		return err
 	}
 
-	u, err := util.GetUserByLocal(c)
+	u, err := h.currentUser(c)
 	if err != nil {
-		return c.JSON(models.DefaultError("Cannot find the User"))
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+	t.ResolveDue(loc)
+
+	projectID, workspaceID, err := h.taskRepo(c).Placement(u, t.ProjectID, t.WorkspaceID)
+	if err != nil {
+		return sendWorkspaceError(c, err)
 	}
 
 	task := models.Task{
 		Title:       t.Title,
 		Status:      t.Status,
 		Description: t.Description,
+		DueAt:       t.DueAt,
+		Recurrence:  t.Recurrence,
+		Priority:    t.Priority,
 		UserID:      u.ID,
+		ProjectID:   projectID,
+		WorkspaceID: workspaceID,
 	}
 
-	result := db.DB.Create(&task).Model(models.Task{})
-
-	if result.Error != nil {
-		return c.Status(fiber.StatusBadRequest).JSON(models.ApiError{
-			Message: result.Error.Error(),
-		})
+	if err := h.taskRepo(c).Create(&task); err != nil {
+		if qerr := quotaError(err); qerr != nil {
+			return qerr
+		}
+		return sendError(c, "Cannot create task "+err.Error(), fiber.StatusBadRequest)
 	}
 
-	t.ID = task.ID
-	t.CreatedAt = task.CreatedAt.String()
-	t.UpdatedAt = task.UpdatedAt.String()
+	publishTaskEvent(events.TaskCreated, u, &task, task.Api())
 
-	return c.Status(fiber.StatusOK).JSON(t)
+	return c.Status(fiber.StatusOK).JSON(task.Api())
 }
 
-func handleUpdateTask(c *fiber.Ctx) error {
+func (h *Handler) handleUpdateTask(c *fiber.Ctx) error {
 	c.Accepts("application/json")
 	c.Accepts("json", "text")
 
-	var t models.TaskApi
+	var t models.TaskInput
 
-	if err := c.BodyParser(&t); err != nil {
-		return sendError(
-			c,
-			"Invalid request data",
-			fiber.StatusBadRequest,
-		)
+	if err := parseBody(c, &t); err != nil {
+		return err
 	}
 
 	if t.ID < 1 {
@@ -121,8 +267,11 @@ func handleUpdateTask(c *fiber.Ctx) error {
 			fiber.StatusBadRequest,
 		)
 	}
+	if t.Version == 0 {
+		return models.ValidationError(map[string]string{"version": "The version of the task read is required"})
+	}
 
-	user, err := util.GetUserByLocal(c)
+	user, err := h.currentUser(c)
 
 	if err != nil {
 		return sendError(
@@ -131,33 +280,187 @@ func handleUpdateTask(c *fiber.Ctx) error {
 			fiber.StatusBadRequest,
 		)
 	}
+	loc, err := location(c, user)
+	if err != nil {
+		return err
+	}
+	t.ResolveDue(loc)
 
-	var task models.Task
-	result := db.DB.Where(
-		"id = ? AND owner_id = ?", t.ID, user.ID,
-	).Model(models.Task{}).First(&task)
+	task, err := h.taskRepo(c).Get(user, t.ID, models.WorkspaceWriters...)
 
-	if result.Error != nil {
+	if err != nil {
 		return sendError(
 			c,
 			"Cannot find the Task",
 			fiber.StatusForbidden,
 		)
 	}
+	if err := checkIfMatch(c, taskETag(task)); err != nil {
+		return err
+	}
+	if t.Version != task.Version {
+		return taskConflict(task)
+	}
 
-	task.Title = t.Title
-	task.Description = t.Description
-	task.Status = t.Status
+	completed := task.Status != models.StatusDone && t.Status == models.StatusDone
+	changes := taskChanges(task, &t)
+
+	// moving the task is optional, a missing project and workspace keep it in place
+	if t.ProjectID != nil || t.WorkspaceID != nil {
+		from, fromWorkspace := task.ProjectID, task.WorkspaceID
+		task.ProjectID, task.WorkspaceID, err = h.taskRepo(c).Placement(user, t.ProjectID, t.WorkspaceID)
+		if err != nil {
+			return sendWorkspaceError(c, err)
+		}
+		if err := h.quotas.Move(h.db(c), fromWorkspace, task.WorkspaceID); err != nil {
+			return err
+		}
+		if !sameID(from, task.ProjectID) {
+			changes["projectId"] = events.Change{From: from, To: task.ProjectID}
+		}
+	}
 
-	result = db.DB.Save(&task)
+	task.Apply(&t)
 
-	if result.Error != nil {
+	if err := h.taskRepo(c).Save(task); err != nil {
+		// changed between the read and the save
+		if errors.Is(err, repository.ErrConflict) {
+			if current, err := h.taskRepo(c).Get(user, t.ID); err == nil {
+				return taskConflict(current)
+			}
+		}
 		return sendError(
 			c,
-			"Cannot update task "+result.Error.Error(),
+			"Cannot update task "+err.Error(),
 			fiber.StatusForbidden,
 		)
 	}
 
-	return c.Status(fiber.StatusOK).JSON(task)
+	updated := taskEvent(events.TaskUpdated, user, task, task.Api())
+	updated.Changes = changes
+	events.Publish(updated)
+	if completed {
+		publishTaskEvent(events.TaskCompleted, user, task, task.Api())
+	}
+
+	c.Set(fiber.HeaderETag, taskETag(task))
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+// taskConflict answers 409 with the current state of the task, the client merges its
+// update into it and sends it again with the current version
+func taskConflict(task *models.Task) error {
+	return models.NewError(fiber.StatusConflict, "The task was changed since the version of the update").WithCurrent(task.Api())
+}
+
+// handleReorderTasks persists the order of a list after a drag and drop.
+// The ids are tasks of one list in their new order, they take the positions they hold.
+func (h *Handler) handleReorderTasks(c *fiber.Ctx) error {
+	var input models.ReorderInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.currentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	tasks, err := h.taskRepo(c).Reorder(u, input.IDs)
+	switch {
+	case errors.Is(err, repository.ErrMixedLists):
+		return sendError(c, err.Error(), fiber.StatusUnprocessableEntity)
+	case errors.Is(err, repository.ErrNotFound):
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	case err != nil:
+		return sendError(c, "Cannot reorder the tasks", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.TaskApi, 0, len(tasks))
+	for _, t := range tasks {
+		response = append(response, t.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// findUserTask returns a task the user signed in can read
+func (h *Handler) findUserTask(c *fiber.Ctx, id string, roles ...string) (*models.Task, error) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	taskID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	return h.taskRepo(c).Get(u, uint(taskID), roles...)
+}
+
+// findWritableTask returns a task the user signed in can change
+func (h *Handler) findWritableTask(c *fiber.Ctx, id string) (*models.Task, error) {
+	return h.findUserTask(c, id, models.WorkspaceWriters...)
+}
+
+// taskChanges returns the fields an update changes, before the update is applied
+func taskChanges(task *models.Task, t *models.TaskInput) map[string]events.Change {
+	changes := map[string]events.Change{}
+	if task.Title != t.Title {
+		changes["title"] = events.Change{From: task.Title, To: t.Title}
+	}
+	if task.Description != t.Description {
+		changes["description"] = events.Change{From: task.Description, To: t.Description}
+	}
+	if task.Status != t.Status {
+		changes["status"] = events.Change{From: task.Status, To: t.Status}
+	}
+	if !sameTime(task.DueAt, t.DueAt) {
+		changes["dueAt"] = events.Change{From: task.DueAt, To: t.DueAt}
+	}
+	if task.Recurrence != t.Recurrence {
+		changes["recurrence"] = events.Change{From: task.Recurrence, To: t.Recurrence}
+	}
+	if t.Priority != 0 && task.Priority != t.Priority {
+		changes["priority"] = events.Change{From: task.Priority, To: t.Priority}
+	}
+
+	return changes
+}
+
+func sameID(a, b *uint) bool {
+	return a == nil && b == nil || a != nil && b != nil && *a == *b
+}
+
+func sameTime(a, b *time.Time) bool {
+	return a == nil && b == nil || a != nil && b != nil && a.Equal(*b)
+}
+
+// queryID reads an optional id of the query, nil when it is missing
+func queryID(c *fiber.Ctx, key string) (*uint, error) {
+	value := c.Query(key)
+	if value == "" {
+		return nil, nil
+	}
+
+	id, err := strconv.ParseUint(value, 10, 0)
+	if err != nil {
+		return nil, err
+	}
+
+	result := uint(id)
+	return &result, nil
+}
+
+// splitQueryList splits a comma separated query value, skipping empty items
+func splitQueryList(q string) []string {
+	var items []string
+	for _, item := range strings.Split(q, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+
+	return items
 }
@@ -0,0 +1,176 @@
+package router
+
+import (
+	"encoding/json"
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"strings"
+	"task-app/models"
+	"task-app/repository"
+	"testing"
+)
+
+// newMemoryHandler returns a handler over the memory repos, with a user of each username
+func newMemoryHandler(t *testing.T, usernames ...string) (*Handler, []*models.User) {
+	t.Helper()
+
+	users := repository.NewMemoryUserRepo()
+	h := &Handler{users: users, tasks: repository.NewMemoryTaskRepo(users)}
+
+	created := make([]*models.User, 0, len(usernames))
+	for _, name := range usernames {
+		u := &models.User{Username: name, Email: name + "@example.com"}
+		if err := users.Create(u); err != nil {
+			t.Fatal(err)
+		}
+		created = append(created, u)
+	}
+
+	return h, created
+}
+
+// signedIn returns an app serving the routes as the user, as SecureAuth would
+func signedIn(u *models.User, routes func(app *fiber.App)) *fiber.App {
+	app := fiber.New(fiber.Config{ErrorHandler: ErrorHandler})
+	app.Use(func(c *fiber.Ctx) error {
+		c.Locals("id", strconv.Itoa(int(u.ID)))
+		return c.Next()
+	})
+	routes(app)
+
+	return app
+}
+
+func taskRoutes(h *Handler) func(app *fiber.App) {
+	return func(app *fiber.App) {
+		app.Get("/tasks", h.handleGetTasks)
+		app.Post("/tasks", h.handleCreateTask)
+		app.Get("/tasks/:id", h.handleGetTask)
+		app.Patch("/tasks", h.handleUpdateTask)
+	}
+}
+
+func send(t testing.TB, app *fiber.App, method, path, body string, into interface{}) int {
+	t.Helper()
+
+	req := httptest.NewRequest(method, path, strings.NewReader(body))
+	req.Header.Set(fiber.HeaderContentType, fiber.MIMEApplicationJSON)
+	res, err := app.Test(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+
+	if into != nil && res.StatusCode < http.StatusBadRequest {
+		if err := json.NewDecoder(res.Body).Decode(into); err != nil {
+			t.Fatalf("%s %s: %v", method, path, err)
+		}
+	}
+
+	return res.StatusCode
+}
+
+func TestCreateAndGetTask(t *testing.T) {
+	h, users := newMemoryHandler(t, "al")
+	app := signedIn(users[0], taskRoutes(h))
+
+	var created models.TaskApi
+	if status := send(t, app, http.MethodPost, "/tasks", `{"title":"Write the tests","priority":2}`, &created); status != http.StatusOK {
+		t.Fatalf("create: status %d", status)
+	}
+	if created.ID == 0 || created.Title != "Write the tests" || created.Priority != 2 || created.Version != 1 {
+		t.Fatalf("create: got %+v", created)
+	}
+
+	var got models.TaskApi
+	if status := send(t, app, http.MethodGet, "/tasks/"+strconv.Itoa(int(created.ID)), "", &got); status != http.StatusOK {
+		t.Fatalf("get: status %d", status)
+	}
+	if got.ID != created.ID || got.Title != created.Title {
+		t.Fatalf("get: got %+v, want %+v", got, created)
+	}
+
+	var list []models.TaskApi
+	if status := send(t, app, http.MethodGet, "/tasks", "", &list); status != http.StatusOK {
+		t.Fatalf("list: status %d", status)
+	}
+	if len(list) != 1 || list[0].ID != created.ID {
+		t.Fatalf("list: got %+v", list)
+	}
+}
+
+func TestCreateTaskInvalid(t *testing.T) {
+	h, users := newMemoryHandler(t, "al")
+	app := signedIn(users[0], taskRoutes(h))
+
+	if status := send(t, app, http.MethodPost, "/tasks", `{"title":"  "}`, nil); status != http.StatusUnprocessableEntity {
+		t.Fatalf("blank title: status %d, want %d", status, http.StatusUnprocessableEntity)
+	}
+	if status := send(t, app, http.MethodPost, "/tasks", `{"title":"Placed","workspaceId":1}`, nil); status < http.StatusBadRequest {
+		t.Fatalf("unknown workspace: status %d", status)
+	}
+}
+
+func TestUpdateTaskConflict(t *testing.T) {
+	h, users := newMemoryHandler(t, "al")
+	app := signedIn(users[0], taskRoutes(h))
+
+	var task models.TaskApi
+	send(t, app, http.MethodPost, "/tasks", `{"title":"First"}`, &task)
+	id := strconv.Itoa(int(task.ID))
+
+	var updated models.TaskApi
+	if status := send(t, app, http.MethodPatch, "/tasks", `{"id":`+id+`,"title":"Second","version":1}`, &updated); status != http.StatusOK {
+		t.Fatalf("update: status %d", status)
+	}
+	if updated.Title != "Second" || updated.Version != 2 {
+		t.Fatalf("update: got %+v", updated)
+	}
+
+	// made from the version before the update
+	if status := send(t, app, http.MethodPatch, "/tasks", `{"id":`+id+`,"title":"Third","version":1}`, nil); status != http.StatusConflict {
+		t.Fatalf("stale update: status %d, want %d", status, http.StatusConflict)
+	}
+}
+
+func TestGetTaskOfAnotherUser(t *testing.T) {
+	h, users := newMemoryHandler(t, "al", "bo")
+
+	var task models.TaskApi
+	send(t, signedIn(users[0], taskRoutes(h)), http.MethodPost, "/tasks", `{"title":"Private"}`, &task)
+
+	app := signedIn(users[1], taskRoutes(h))
+	if status := send(t, app, http.MethodGet, "/tasks/"+strconv.Itoa(int(task.ID)), "", nil); status != http.StatusNotFound {
+		t.Fatalf("get: status %d, want %d", status, http.StatusNotFound)
+	}
+
+	var list []models.TaskApi
+	send(t, app, http.MethodGet, "/tasks", "", &list)
+	if len(list) != 0 {
+		t.Fatalf("list: got %+v", list)
+	}
+}
+
+func TestGetUserData(t *testing.T) {
+	h, users := newMemoryHandler(t, "al")
+	app := signedIn(users[0], func(app *fiber.App) {
+		app.Get("/user", h.GetUserData)
+	})
+
+	var got models.UserApi
+	if status := send(t, app, http.MethodGet, "/user", "", &got); status != http.StatusOK {
+		t.Fatalf("status %d", status)
+	}
+	if got.Username != "al" || got.Email != "al@example.com" {
+		t.Fatalf("got %+v", got)
+	}
+
+	if err := h.users.Update(users[0], map[string]interface{}{"locked": true}); err != nil {
+		t.Fatal(err)
+	}
+	if status := send(t, app, http.MethodGet, "/user", "", nil); status != http.StatusUnauthorized {
+		t.Fatalf("locked: status %d, want %d", status, http.StatusUnauthorized)
+	}
+}
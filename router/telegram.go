@@ -0,0 +1,60 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm/clause"
+	"task-app/models"
+	"task-app/telegram"
+	"task-app/util"
+	"time"
+)
+
+// GetTelegramAccount tells if the user signed in linked a Telegram chat
+func (h *Handler) GetTelegramAccount(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	account := new(models.TelegramAccount)
+	if res := h.db(c).Where("user_id = ?", u.ID).Limit(1).Find(account); res.Error != nil {
+		return sendError(c, "Cannot find the Telegram account", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(account.Api())
+}
+
+// CreateTelegramCode creates the one-time code the user sends to the bot to link their chat.
+// A new code replaces the previous one, the chat already linked stays linked until the code is used.
+func (h *Handler) CreateTelegramCode(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	code := util.RandomToken(5)
+	expires := time.Now().Add(telegram.CodeTTL)
+	account := models.TelegramAccount{UserID: u.ID, Code: util.HashToken(code), CodeExpiresAt: &expires}
+	if err := h.db(c).Clauses(clause.OnConflict{
+		Columns:   []clause.Column{{Name: "user_id"}},
+		DoUpdates: clause.AssignmentColumns([]string{"code", "code_expires_at", "updated_at"}),
+	}).Create(&account).Error; err != nil {
+		return sendError(c, "Cannot create the link code", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"code": code, "command": "/link " + code, "expiresAt": expires})
+}
+
+// UnlinkTelegram signs the Telegram chat out of the account of the user signed in
+func (h *Handler) UnlinkTelegram(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if err := h.db(c).Where("user_id = ?", u.ID).Delete(&models.TelegramAccount{}).Error; err != nil {
+		return sendError(c, "Cannot unlink the Telegram account", fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
@@ -0,0 +1,268 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strings"
+	"task-app/cache"
+	"task-app/events"
+	"task-app/models"
+	"task-app/util"
+)
+
+func (h *Handler) setupTemplatesRoutes() {
+	TEMPLATES.Use(h.tokens.SecureAuth())
+	TEMPLATES.Get("/", h.handleGetTemplates)
+	TEMPLATES.Post("/", h.handleCreateTemplate)
+	TEMPLATES.Get("/:id", h.handleGetTemplate)
+	TEMPLATES.Patch("/:id", h.handleUpdateTemplate)
+	TEMPLATES.Delete("/:id", h.handleDeleteTemplate)
+	TEMPLATES.Post("/:id/instantiate", h.handleInstantiateTemplate)
+}
+
+// handleGetTemplates lists the personal templates of the user and the ones shared with
+// the workspaces of the user, ?workspace= narrows them to a workspace
+func (h *Handler) handleGetTemplates(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	query := h.db(c).Scopes(models.AccessibleBy(u)).Order("name, id")
+	if workspace := c.Query("workspace"); workspace != "" {
+		query = query.Where("workspace_id = ?", workspace)
+	}
+
+	var templates []models.Template
+	if res := query.Find(&templates); res.Error != nil {
+		return sendError(c, "Cannot find user's templates", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.TemplateApi, 0, len(templates))
+	for _, t := range templates {
+		response = append(response, t.Api())
+	}
+
+	return c.JSON(response)
+}
+
+func (h *Handler) handleGetTemplate(c *fiber.Ctx) error {
+	template, err := h.findTemplate(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Template", fiber.StatusNotFound)
+	}
+
+	return c.JSON(template.Api())
+}
+
+func (h *Handler) handleCreateTemplate(c *fiber.Ctx) error {
+	var input models.TemplateInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if input.WorkspaceID != nil {
+		if _, err := h.findMembership(c, u, *input.WorkspaceID, models.WorkspaceWriters...); err != nil {
+			return sendWorkspaceError(c, err)
+		}
+	}
+
+	template := models.Template{UserID: u.ID, WorkspaceID: input.WorkspaceID}
+	setTemplateFields(&template, &input)
+
+	if res := h.db(c).Create(&template); res.Error != nil {
+		return sendError(c, "Cannot create template "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(template.Api())
+}
+
+// handleUpdateTemplate replaces the fields of a template, its workspace is kept
+func (h *Handler) handleUpdateTemplate(c *fiber.Ctx) error {
+	var input models.TemplateInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	template, err := h.findTemplate(c, c.Params("id"), models.WorkspaceWriters...)
+	if err != nil {
+		return sendError(c, "Cannot find the Template", fiber.StatusNotFound)
+	}
+
+	setTemplateFields(template, &input)
+
+	if res := h.db(c).Save(template); res.Error != nil {
+		return sendError(c, "Cannot update template "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(template.Api())
+}
+
+func (h *Handler) handleDeleteTemplate(c *fiber.Ctx) error {
+	template, err := h.findTemplate(c, c.Params("id"), models.WorkspaceWriters...)
+	if err != nil {
+		return sendError(c, "Cannot find the Template", fiber.StatusNotFound)
+	}
+
+	if res := h.db(c).Delete(template); res.Error != nil {
+		return sendError(c, "Cannot delete template "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleSaveTaskAsTemplate saves the title, description, labels, checklist, recurrence
+// and priority of a task the user can read as a template
+func (h *Handler) handleSaveTaskAsTemplate(c *fiber.Ctx) error {
+	var input models.TaskTemplateInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	if input.WorkspaceID != nil {
+		if _, err := h.findMembership(c, u, *input.WorkspaceID, models.WorkspaceWriters...); err != nil {
+			return sendWorkspaceError(c, err)
+		}
+	}
+
+	labels := make([]string, 0, len(task.Labels))
+	for _, l := range task.Labels {
+		labels = append(labels, l.Name)
+	}
+	checklist := make([]string, 0, len(task.Checklist))
+	for _, i := range task.Checklist {
+		checklist = append(checklist, i.Text)
+	}
+
+	template := models.Template{UserID: u.ID, WorkspaceID: input.WorkspaceID}
+	setTemplateFields(&template, &models.TemplateInput{
+		Name:        input.Name,
+		Title:       task.Title,
+		Description: task.Description,
+		Labels:      labels,
+		Checklist:   checklist,
+		Recurrence:  task.Recurrence,
+		Priority:    task.Priority,
+	})
+
+	if res := h.db(c).Create(&template); res.Error != nil {
+		return sendError(c, "Cannot create template "+res.Error.Error(), fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(template.Api())
+}
+
+// handleInstantiateTemplate creates a task from a template the user can read.
+// The labels are the labels of the user with the names of the template, the missing ones are created.
+func (h *Handler) handleInstantiateTemplate(c *fiber.Ctx) error {
+	var input models.InstantiateInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	template, err := h.findTemplate(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Template", fiber.StatusNotFound)
+	}
+
+	projectID, workspaceID, err := h.taskRepo(c).Placement(u, input.ProjectID, input.WorkspaceID)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	task := models.Task{
+		Title:       template.Title,
+		Description: template.Description,
+		Recurrence:  template.Recurrence,
+		Priority:    template.Priority,
+		DueAt:       input.DueAt,
+		UserID:      u.ID,
+		ProjectID:   projectID,
+		WorkspaceID: workspaceID,
+	}
+	if title := strings.TrimSpace(input.Title); title != "" {
+		task.Title = title
+	}
+
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		labels := map[string]*models.Label{}
+		for _, name := range template.LabelList() {
+			label, _, err := importLabel(tx, u, labels, models.LabelApi{Name: name})
+			if err != nil {
+				return err
+			}
+			task.Labels = append(task.Labels, *label)
+		}
+		for i, text := range template.ChecklistList() {
+			task.Checklist = append(task.Checklist, models.ChecklistItem{Text: text, Position: i + 1})
+		}
+
+		return tx.Create(&task).Error
+	})
+	if err != nil {
+		if qerr := quotaError(err); qerr != nil {
+			return qerr
+		}
+		return sendError(c, "Cannot create task "+err.Error(), fiber.StatusInternalServerError)
+	}
+
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+	publishTaskEvent(events.TaskCreated, u, &task, task.Api())
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
+
+func (h *Handler) findTemplate(c *fiber.Ctx, id interface{}, roles ...string) (*models.Template, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	template := new(models.Template)
+	if res := h.db(c).Scopes(models.AccessibleBy(u, roles...)).Where("id = ?", id).First(template); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return template, nil
+}
+
+// setTemplateFields copies the input to the template, the lists are stored joined
+func setTemplateFields(t *models.Template, input *models.TemplateInput) {
+	labels := make([]string, 0, len(input.Labels))
+	for _, l := range input.Labels {
+		labels = append(labels, strings.TrimSpace(l))
+	}
+	checklist := make([]string, 0, len(input.Checklist))
+	for _, i := range input.Checklist {
+		checklist = append(checklist, strings.TrimSpace(i))
+	}
+
+	t.Name = strings.TrimSpace(input.Name)
+	t.Title = strings.TrimSpace(input.Title)
+	t.Description = input.Description
+	t.Labels = strings.Join(labels, ",")
+	t.Checklist = strings.Join(checklist, "\n")
+	t.Recurrence = input.Recurrence
+	t.Priority = input.Priority
+}
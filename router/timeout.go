@@ -0,0 +1,95 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"task-app/models"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+)
+
+// slowTimeout is the timeout of the routes reading or writing many rows at once, e.g. the imports
+const slowTimeout = 2 * time.Minute
+
+var errTimeout = models.NewError(fiber.StatusGatewayTimeout, "The request took too long, please try again later")
+
+// timeout bounds the context of the requests, their queries stop once it is over and the request
+// is answered 504. A route is given a timeout of its own by using it again, after the default one.
+func timeout(d time.Duration) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		ctx, cancel := util.WithTimeout(c, d)
+		defer cancel()
+
+		err := c.Next()
+		if !errors.Is(ctx.Err(), context.DeadlineExceeded) {
+			return err
+		}
+		// the handlers answer the failed queries themselves, mostly with a 500
+		if err != nil || c.Response().StatusCode() >= fiber.StatusInternalServerError {
+			return errTimeout
+		}
+
+		return nil
+	}
+}
+
+// db returns the database running its queries with the context of the request
+func (h *Handler) db(c *fiber.Ctx) *gorm.DB {
+	return h.store.DB().WithContext(util.Context(c))
+}
+
+// userRepo returns the users with the context of the request
+func (h *Handler) userRepo(c *fiber.Ctx) repository.UserRepo {
+	return h.users.WithContext(util.Context(c))
+}
+
+// currentUser returns the user signed in, read through the repo so the profile may be cached.
+// Locked accounts are treated as missing, as by TokenService.CurrentUser.
+func (h *Handler) currentUser(c *fiber.Ctx) (*models.User, error) {
+	id, _ := c.Locals("id").(string)
+	userID, err := strconv.ParseUint(id, 10, 0)
+	if err != nil {
+		return nil, repository.ErrNotFound
+	}
+
+	u, err := h.userRepo(c).ByID(uint(userID))
+	if err != nil {
+		return nil, err
+	}
+	if u.Locked {
+		return nil, util.ErrAccountLocked
+	}
+	if impersonator, ok := c.Locals("impersonator").(string); ok {
+		if id, err := strconv.Atoi(impersonator); err == nil {
+			u.ImpersonatorID = uint(id)
+		}
+	}
+
+	return u, nil
+}
+
+// currentCredentials returns the user signed in as currentUser, with its password hash and TOTP
+// secret, for the routes checking them
+func (h *Handler) currentCredentials(c *fiber.Ctx) (*models.User, error) {
+	u, err := h.currentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	creds, err := h.userRepo(c).Credentials(u.ID)
+	if err != nil {
+		return nil, err
+	}
+	creds.ImpersonatorID = u.ImpersonatorID
+
+	return creds, nil
+}
+
+// taskRepo returns the tasks with the context of the request
+func (h *Handler) taskRepo(c *fiber.Ctx) repository.TaskRepo {
+	return h.tasks.WithContext(util.Context(c))
+}
@@ -0,0 +1,382 @@
+package router
+
+import (
+	"bytes"
+	"encoding/csv"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"sort"
+	"strconv"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+var errTimerRunning = errors.New("The timer is already running")
+
+func (h *Handler) setupTimeRoutes() {
+	TIME.Use(h.tokens.SecureAuth())
+	TIME.Get("/", h.handleGetTimeEntries)
+	TIME.Get("/summary", h.handleGetTimeSummary)
+	TIME.Get("/timesheet", h.handleExportTimesheet)
+}
+
+// handleStartTimer starts a timer of the user on the task, the running timer of the user is stopped
+func (h *Handler) handleStartTimer(c *fiber.Ctx) error {
+	var input models.TimerInput
+	if len(c.Body()) > 0 {
+		if err := parseBody(c, &input); err != nil {
+			return err
+		}
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	now := time.Now()
+	entry := models.TimeEntry{TaskID: task.ID, UserID: u.ID, StartedAt: now, Note: input.Note}
+	err = h.store.WithTx(util.Context(c), func(tx *gorm.DB) error {
+		var running []models.TimeEntry
+		if err := tx.Where("user_id = ? AND ended_at IS NULL", u.ID).Find(&running).Error; err != nil {
+			return err
+		}
+		for _, r := range running {
+			if r.TaskID == task.ID {
+				return errTimerRunning
+			}
+			r.Stop(now)
+			if err := tx.Model(&r).Select("ended_at", "duration_seconds").Updates(&r).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Create(&entry).Error
+	})
+	if errors.Is(err, errTimerRunning) {
+		return sendError(c, err.Error(), fiber.StatusConflict)
+	}
+	if err != nil {
+		return sendError(c, "Cannot start the timer", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(entry.Api())
+}
+
+// handleStopTimer stops the running timer of the user on the task
+func (h *Handler) handleStopTimer(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	entry := new(models.TimeEntry)
+	if res := h.db(c).Where("task_id = ? AND user_id = ? AND ended_at IS NULL", task.ID, u.ID).First(entry); res.Error != nil {
+		return sendError(c, "No timer is running on the task", fiber.StatusNotFound)
+	}
+
+	entry.Stop(time.Now())
+	if res := h.db(c).Model(entry).Select("ended_at", "duration_seconds").Updates(entry); res.Error != nil {
+		return sendError(c, "Cannot stop the timer", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(entry.Api())
+}
+
+// handleAddTimeEntry records time spent on the task without a timer
+func (h *Handler) handleAddTimeEntry(c *fiber.Ctx) error {
+	var input models.TimeEntryInput
+	if err := parseBody(c, &input); err != nil {
+		return err
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	entry := models.TimeEntry{TaskID: task.ID, UserID: u.ID, StartedAt: input.StartedAt.UTC(), Note: input.Note}
+	entry.Stop(input.EndedAt.UTC())
+
+	if res := h.db(c).Create(&entry); res.Error != nil {
+		return sendError(c, "Cannot add the time entry", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(entry.Api())
+}
+
+// handleDeleteTimeEntry removes an entry of the user on the task
+func (h *Handler) handleDeleteTimeEntry(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	res := h.db(c).Where("id = ? AND task_id = ? AND user_id = ?", c.Params("entryId"), task.ID, u.ID).Delete(&models.TimeEntry{})
+	if res.Error != nil {
+		return sendError(c, "Cannot delete the time entry", fiber.StatusInternalServerError)
+	}
+	if res.RowsAffected == 0 {
+		return sendError(c, "Cannot find the time entry", fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleGetTaskTime returns the entries of the task with the time spent by every user.
+// The totals count the ended entries only.
+func (h *Handler) handleGetTaskTime(c *fiber.Ctx) error {
+	task, err := h.findUserTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	var entries []models.TimeEntry
+	if res := h.db(c).Where("task_id = ?", task.ID).Order("started_at DESC, id DESC").Find(&entries); res.Error != nil {
+		return sendError(c, "Cannot find the time entries", fiber.StatusInternalServerError)
+	}
+
+	byUser := []struct {
+		UserID   uint   `json:"userId"`
+		Username string `json:"username"`
+		Seconds  int64  `json:"seconds"`
+	}{}
+	if res := h.db(c).Model(&models.TimeEntry{}).
+		Select("time_entries.user_id, users.username, SUM(time_entries.duration_seconds) AS seconds").
+		Joins("JOIN users ON users.id = time_entries.user_id").
+		Where("time_entries.task_id = ? AND time_entries.ended_at IS NOT NULL", task.ID).
+		Group("time_entries.user_id, users.username").
+		Order("seconds DESC").
+		Scan(&byUser); res.Error != nil {
+		return sendError(c, "Cannot sum the time entries", fiber.StatusInternalServerError)
+	}
+
+	var total int64
+	for _, u := range byUser {
+		total += u.Seconds
+	}
+
+	response := make([]models.TimeEntryApi, 0, len(entries))
+	for _, e := range entries {
+		response = append(response, e.Api())
+	}
+
+	return c.JSON(fiber.Map{"totalSeconds": total, "byUser": byUser, "entries": response})
+}
+
+// handleGetTimeEntries returns a page of the entries of the user, started in the ?from and ?to range
+func (h *Handler) handleGetTimeEntries(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	query, err := timeRange(c, u, h.db(c).Where("user_id = ?", u.ID))
+	if err != nil {
+		return err
+	}
+
+	limit, offset := paginate(c)
+	var entries []models.TimeEntry
+	if res := query.Order("started_at DESC, id DESC").Limit(limit).Offset(offset).Find(&entries); res.Error != nil {
+		return sendError(c, "Cannot find the time entries", fiber.StatusInternalServerError)
+	}
+
+	response := make([]models.TimeEntryApi, 0, len(entries))
+	for _, e := range entries {
+		response = append(response, e.Api())
+	}
+
+	return c.JSON(response)
+}
+
+// handleGetTimeSummary sums the ended entries of the user by task, in the ?from and ?to range
+func (h *Handler) handleGetTimeSummary(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	query, err := timeRange(c, u, h.db(c).Model(&models.TimeEntry{}).
+		Where("time_entries.user_id = ? AND time_entries.ended_at IS NOT NULL", u.ID))
+	if err != nil {
+		return err
+	}
+
+	byTask := []struct {
+		TaskID  uint   `json:"taskId"`
+		Title   string `json:"title"`
+		Seconds int64  `json:"seconds"`
+	}{}
+	if res := query.
+		Select("time_entries.task_id, tasks.title, SUM(time_entries.duration_seconds) AS seconds").
+		Joins("JOIN tasks ON tasks.id = time_entries.task_id").
+		Group("time_entries.task_id, tasks.title").
+		Order("seconds DESC").
+		Scan(&byTask); res.Error != nil {
+		return sendError(c, "Cannot sum the time entries", fiber.StatusInternalServerError)
+	}
+
+	var total int64
+	for _, t := range byTask {
+		total += t.Seconds
+	}
+
+	running := new(models.TimeEntry)
+	response := fiber.Map{"totalSeconds": total, "byTask": byTask, "running": nil}
+	if res := h.db(c).Where("user_id = ? AND ended_at IS NULL", u.ID).Limit(1).Find(running); res.Error == nil && res.RowsAffected > 0 {
+		response["running"] = running.Api()
+	}
+
+	return c.JSON(response)
+}
+
+// handleExportTimesheet sends the hours of the user by task and day for the week (Monday to Sunday,
+// in the zone of the user or ?tz=) of ?week=YYYY-MM-DD, the current week by default, as CSV
+func (h *Handler) handleExportTimesheet(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	loc, err := location(c, u)
+	if err != nil {
+		return err
+	}
+
+	day := time.Now().In(loc)
+	if week := c.Query("week"); week != "" {
+		if day, err = time.ParseInLocation("2006-01-02", week, loc); err != nil {
+			return sendError(c, "Invalid week date", fiber.StatusBadRequest)
+		}
+	}
+	start := time.Date(day.Year(), day.Month(), day.Day(), 0, 0, 0, 0, loc)
+	start = start.AddDate(0, 0, -(int(start.Weekday())+6)%7)
+	end := start.AddDate(0, 0, 7)
+
+	var rows []struct {
+		TaskID          uint
+		Title           string
+		StartedAt       time.Time
+		DurationSeconds int64
+	}
+	if res := h.db(c).Model(&models.TimeEntry{}).
+		Select("time_entries.task_id, tasks.title, time_entries.started_at, time_entries.duration_seconds").
+		Joins("JOIN tasks ON tasks.id = time_entries.task_id").
+		Where("time_entries.user_id = ? AND time_entries.ended_at IS NOT NULL", u.ID).
+		Where("time_entries.started_at >= ? AND time_entries.started_at < ?", start, end).
+		Scan(&rows); res.Error != nil {
+		return sendError(c, "Cannot find the time entries", fiber.StatusInternalServerError)
+	}
+
+	// the seconds of every task by day of the week, an entry counts for the day it started
+	titles := map[uint]string{}
+	seconds := map[uint]*[7]int64{}
+	var totals [7]int64
+	for _, r := range rows {
+		if seconds[r.TaskID] == nil {
+			seconds[r.TaskID], titles[r.TaskID] = new([7]int64), r.Title
+		}
+		d := daysBetween(start, r.StartedAt.In(loc))
+		seconds[r.TaskID][d] += r.DurationSeconds
+		totals[d] += r.DurationSeconds
+	}
+
+	ids := make([]uint, 0, len(seconds))
+	for id := range seconds {
+		ids = append(ids, id)
+	}
+	sort.Slice(ids, func(i, j int) bool {
+		return titles[ids[i]] < titles[ids[j]] || titles[ids[i]] == titles[ids[j]] && ids[i] < ids[j]
+	})
+
+	var b bytes.Buffer
+	out := csv.NewWriter(&b)
+	header := []string{"taskId", "task"}
+	for i := 0; i < 7; i++ {
+		header = append(header, start.AddDate(0, 0, i).Format("Mon 2006-01-02"))
+	}
+	out.Write(append(header, "total"))
+	for _, id := range ids {
+		out.Write(timesheetRow(strconv.FormatUint(uint64(id), 10), titles[id], seconds[id]))
+	}
+	out.Write(timesheetRow("", "Total", &totals))
+	out.Flush()
+
+	filename := "timesheet-" + start.Format("2006-01-02") + ".csv"
+	c.Set(fiber.HeaderContentDisposition, `attachment; filename="`+filename+`"`)
+	c.Set(fiber.HeaderContentType, "text/csv; charset=utf-8")
+
+	return c.Send(b.Bytes())
+}
+
+// daysBetween counts the dates from a day to the day of a time of the same zone,
+// a day is not always 24 hours long
+func daysBetween(from, t time.Time) int {
+	y, m, d := t.Date()
+	return int(time.Date(y, m, d, 0, 0, 0, 0, time.UTC).Sub(time.Date(from.Year(), from.Month(), from.Day(), 0, 0, 0, 0, time.UTC)).Hours() / 24)
+}
+
+// timesheetRow formats the seconds of the days as hours with the total of the week
+func timesheetRow(id, title string, days *[7]int64) []string {
+	row := []string{id, title}
+	var total int64
+	for _, s := range days {
+		row = append(row, formatHours(s))
+		total += s
+	}
+
+	return append(row, formatHours(total))
+}
+
+func formatHours(seconds int64) string {
+	return strconv.FormatFloat(float64(seconds)/3600, 'f', 2, 64)
+}
+
+// timeRange narrows a query of the time entries to the ?from and ?to dates of their start,
+// the days are in the zone of the user
+func timeRange(c *fiber.Ctx, u *models.User, query *gorm.DB) (*gorm.DB, error) {
+	loc, err := location(c, u)
+	if err != nil {
+		return nil, err
+	}
+
+	if from := c.Query("from"); from != "" {
+		t, err := parseExportDate(from, false, loc)
+		if err != nil {
+			return nil, sendError(c, "Invalid from date", fiber.StatusBadRequest)
+		}
+		query = query.Where("time_entries.started_at >= ?", t)
+	}
+	if to := c.Query("to"); to != "" {
+		t, err := parseExportDate(to, true, loc)
+		if err != nil {
+			return nil, sendError(c, "Invalid to date", fiber.StatusBadRequest)
+		}
+		query = query.Where("time_entries.started_at < ?", t)
+	}
+
+	return query, nil
+}
@@ -0,0 +1,72 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"task-app/events"
+	"task-app/models"
+)
+
+// handleDeleteTask moves the task to the trash
+func (h *Handler) handleDeleteTask(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	task, err := h.findWritableTask(c, c.Params("id"))
+	if err != nil {
+		return sendError(c, "Cannot find the Task", fiber.StatusNotFound)
+	}
+
+	if err := h.taskRepo(c).Delete(task); err != nil {
+		return sendError(c, "Cannot delete task "+err.Error(), fiber.StatusForbidden)
+	}
+
+	publishTaskEvent(events.TaskDeleted, u, task, nil)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleGetTrash(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	tasks, err := h.taskRepo(c).Trash(u)
+	if err != nil {
+		return sendError(c, "Cannot find user's tasks", fiber.StatusForbidden)
+	}
+
+	response := make([]models.TaskApi, 0, len(tasks))
+	for _, t := range tasks {
+		response = append(response, t.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleRestoreTask(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	id, err := c.ParamsInt("id")
+	if err != nil {
+		return sendError(c, "Cannot find the Task in trash", fiber.StatusNotFound)
+	}
+
+	task, err := h.taskRepo(c).GetDeleted(u, uint(id), models.WorkspaceWriters...)
+	if err != nil {
+		return sendError(c, "Cannot find the Task in trash", fiber.StatusNotFound)
+	}
+
+	if err := h.taskRepo(c).Restore(task); err != nil {
+		return sendError(c, "Cannot restore task "+err.Error(), fiber.StatusForbidden)
+	}
+
+	publishTaskEvent(events.TaskRestored, u, task, task.Api())
+
+	return c.Status(fiber.StatusOK).JSON(task.Api())
+}
@@ -0,0 +1,172 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"golang.org/x/crypto/bcrypt"
+	"strconv"
+	"strings"
+	"task-app/models"
+	"task-app/util"
+)
+
+const backupCodesCount = 10
+
+// SetupTwoFactor generates a new TOTP secret for the user signed in.
+// 2FA stays disabled until a code of the secret is verified.
+func (h *Handler) SetupTwoFactor(c *fiber.Ctx) error {
+	u, err := h.currentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if u.TOTPEnabled {
+		return sendError(c, "2FA is already enabled", fiber.StatusConflict)
+	}
+
+	secret := util.GenerateTOTPSecret()
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"totp_secret": secret}); err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{
+		"secret":      secret,
+		"otpauth_url": util.TOTPURL(secret, u.Username),
+	})
+}
+
+// VerifyTwoFactor enables 2FA once the user proves the authenticator is set up,
+// and returns the backup codes. The codes are shown only this time.
+func (h *Handler) VerifyTwoFactor(c *fiber.Ctx) error {
+	type VerifyInput struct {
+		Code string `json:"code"`
+	}
+
+	input := new(VerifyInput)
+	if err := c.BodyParser(input); err != nil {
+		return sendError(c, "Please review your input", fiber.StatusBadRequest)
+	}
+
+	u, err := h.currentCredentials(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if u.TOTPSecret == "" || u.TOTPEnabled {
+		return sendError(c, "2FA setup is not started", fiber.StatusConflict)
+	}
+
+	if !h.useTOTPCode(c, u, input.Code) {
+		return models.NewError(fiber.StatusForbidden, "Invalid code").WithFields(map[string]string{"code": "Invalid code"})
+	}
+
+	codes := make([]string, backupCodesCount)
+	hashes := make([]string, backupCodesCount)
+	for i := range codes {
+		codes[i] = util.RandomToken(5)
+		hashes[i] = util.HashToken(codes[i])
+	}
+	err = h.userRepo(c).EnableTOTP(u, hashes)
+
+	if err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	return c.JSON(fiber.Map{"backup_codes": codes})
+}
+
+// DisableTwoFactor turns 2FA off, the current password is required
+func (h *Handler) DisableTwoFactor(c *fiber.Ctx) error {
+	type DisableInput struct {
+		Password string `json:"password"`
+	}
+
+	input := new(DisableInput)
+	if err := c.BodyParser(input); err != nil {
+		return sendError(c, "Please review your input", fiber.StatusBadRequest)
+	}
+
+	u, err := h.currentCredentials(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(input.Password)); err != nil {
+		return models.NewError(fiber.StatusForbidden, "Invalid password").WithFields(map[string]string{"password": "Invalid password"})
+	}
+
+	err = h.userRepo(c).DisableTOTP(u)
+
+	if err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// LoginTwoFactor exchanges a challenge token and a TOTP or backup code for the auth tokens
+func (h *Handler) LoginTwoFactor(c *fiber.Ctx) error {
+	type ChallengeInput struct {
+		ChallengeToken string `json:"challengeToken"`
+		Code           string `json:"code"`
+	}
+
+	input := new(ChallengeInput)
+	if err := c.BodyParser(input); err != nil {
+		return sendError(c, "Please review your input", fiber.StatusBadRequest)
+	}
+
+	id, err := h.tokens.ParseChallengeToken(input.ChallengeToken)
+	if err != nil {
+		return sendError(c, "Challenge is expired, please log in again", fiber.StatusUnauthorized)
+	}
+
+	userID, _ := strconv.ParseUint(id, 10, 0)
+	u, err := h.userRepo(c).Credentials(uint(userID))
+	if err != nil || !u.TOTPEnabled || u.Locked {
+		return sendError(c, "Invalid Credentials", fiber.StatusUnauthorized)
+	}
+
+	if err := h.checkLoginAllowed(c, u); err != nil {
+		return err
+	}
+
+	code := strings.ReplaceAll(strings.TrimSpace(input.Code), " ", "")
+	if !h.useTOTPCode(c, u, code) && !h.useBackupCode(c, u, code) {
+		h.loginFailed(c, u)
+		return models.NewError(fiber.StatusUnauthorized, "Invalid code").WithFields(map[string]string{"code": "Invalid code"})
+	}
+
+	h.loginSucceeded(c, u)
+
+	return h.sendAuthTokens(c, u)
+}
+
+// sendLoginResponse issues the auth tokens, or a 2FA challenge if the user enabled it
+func (h *Handler) sendLoginResponse(c *fiber.Ctx, u *models.User) error {
+	if !u.TOTPEnabled {
+		return h.sendAuthTokens(c, u)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(fiber.Map{
+		"two_factor_required": true,
+		"challenge_token":     h.tokens.GenerateChallengeToken(strconv.Itoa(int(u.ID))),
+	})
+}
+
+// useTOTPCode checks a TOTP code of the user and spends its time step, each code is accepted once
+func (h *Handler) useTOTPCode(c *fiber.Ctx, u *models.User, code string) bool {
+	step, ok := util.ValidateTOTP(u.TOTPSecret, code, u.TOTPLastStep)
+	if !ok {
+		return false
+	}
+	used, err := h.userRepo(c).UseTOTPStep(u, step)
+
+	return err == nil && used
+}
+
+// useBackupCode consumes a backup code of the user, it reports if the code was valid
+func (h *Handler) useBackupCode(c *fiber.Ctx, u *models.User, code string) bool {
+	used, err := h.userRepo(c).UseBackupCode(u, util.HashToken(strings.ToLower(code)))
+
+	return err == nil && used
+}
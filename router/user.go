@@ -1,116 +1,318 @@
 package router
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
 	"golang.org/x/crypto/bcrypt"
 	"strconv"
-	"task-app/db"
+	"strings"
+	"task-app/avatars"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/mailer"
 	"task-app/models"
+	"task-app/ratelimit"
+	"task-app/repository"
 	"task-app/util"
 	"time"
 )
 
-var jwtKey = []byte(db.PRIVKEY)
-
-func setupUserRoutes() {
-	USER.Post("/signup", CreateUser)
-	USER.Post("/login", LoginUser)
-	USER.Get("/token", GetAccessToken)
+func (h *Handler) setupUserRoutes() {
+	// the credential routes are limited per IP against brute force
+	login := ratelimit.Limit("login", 5, time.Minute)
+	USER.Post("/signup", ratelimit.Limit("signup", 10, time.Hour), h.idempotent(), h.CreateUser)
+	USER.Post("/demo", ratelimit.Limit("demo", 5, time.Hour), h.CreateDemoUser)
+	USER.Post("/login", login, h.LoginUser)
+	USER.Post("/login/2fa", login, h.LoginTwoFactor)
+	USER.Post("/login/magic", ratelimit.Limit("magic_link", 5, time.Hour), h.RequestMagicLink)
+	USER.Get("/login/magic/:token", login, h.LoginMagicLink)
+	USER.Get("/token", ratelimit.Limit("refresh", 30, time.Minute), h.GetAccessToken)
+	USER.Get("/verify-email/:token", h.VerifyEmail)
 
 	privUser := USER.Group("/private")
-	privUser.Use(util.SecureAuth()) // middleware to secure all routes for this group
-	privUser.Get("/user", GetUserData)
+	privUser.Use(h.tokens.SecureAuth()) // middleware to secure all routes for this group
+	privUser.Get("/user", h.GetUserData)
+	privUser.Patch("/user", h.UpdateUserData)
+	privUser.Post("/avatar", ratelimit.Limit("avatar", 10, time.Hour), h.UploadAvatar)
+	privUser.Delete("/avatar", h.DeleteAvatar)
+	privUser.Get("/activity", h.GetUserActivity)
+	privUser.Delete("/impersonation", h.EndImpersonation)
+	privUser.Post("/stream-ticket", ratelimit.Limit("stream_ticket", 60, time.Minute), h.CreateStreamTicket)
+
+	// credentials can be managed only from a session, never with an API key
+	session := util.SessionOnly()
+	privUser.Delete("/user", session, h.DeleteUser)
+	privUser.Post("/password", session, h.ChangePassword)
+	privUser.Post("/2fa/setup", session, h.SetupTwoFactor)
+	privUser.Post("/2fa/verify", session, h.VerifyTwoFactor)
+	privUser.Post("/2fa/disable", session, h.DisableTwoFactor)
+	privUser.Get("/sessions", session, h.GetSessions)
+	privUser.Delete("/sessions/others", session, h.RevokeOtherSessions)
+	privUser.Delete("/sessions/:id", session, h.RevokeSession)
+	privUser.Post("/export", session, ratelimit.Limit("export", 5, time.Hour), h.RequestExport)
+	privUser.Get("/export", session, h.GetExports)
+	privUser.Get("/export/:id", session, h.GetExport)
+	privUser.Get("/api-keys", session, h.GetAPIKeys)
+	privUser.Post("/api-keys", session, h.CreateAPIKey)
+	privUser.Delete("/api-keys/:id", session, h.RevokeAPIKey)
+	privUser.Post("/calendar", session, h.CreateCalendarFeed)
+	privUser.Delete("/calendar", session, h.DeleteCalendarFeed)
+	privUser.Get("/shares", session, h.GetShares)
+	privUser.Post("/shares", session, h.CreateShare)
+	privUser.Delete("/shares/:id", session, h.RevokeShare)
+	privUser.Post("/inbox", session, h.CreateInboxAddress)
+	privUser.Delete("/inbox", session, h.DeleteInboxAddress)
+	privUser.Get("/telegram", session, h.GetTelegramAccount)
+	privUser.Post("/telegram", session, h.CreateTelegramCode)
+	privUser.Delete("/telegram", session, h.UnlinkTelegram)
 }
 
-func CreateUser(c *fiber.Ctx) error {
-	u := new(models.User)
+func (h *Handler) CreateUser(c *fiber.Ctx) error {
+	input := new(models.SignupInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	// Hashing the password with a random salt
+	hashedPassword, err := bcrypt.GenerateFromPassword(
+		[]byte(input.Password),
+		bcrypt.DefaultCost,
+	)
+
+	if err != nil {
+		panic(err)
+	}
 
-	if err := c.BodyParser(u); err != nil {
-		return c.JSON(fiber.Map{
-			"error": true,
-			"input": "Please review your input",
-		})
+	u := &models.User{
+		Email:    input.Email,
+		Username: strings.TrimSpace(input.Username),
+		Password: string(hashedPassword),
 	}
+	errors := &models.UserErrors{}
 
-	// validate if the email, username and password are in correct format
-	errors := util.ValidateRegister(u)
-	if errors.Err {
-		return c.JSON(errors)
+	// the fields taken are looked up again, the account may have been registered concurrently
+	err = h.userRepo(c).Register(u)
+	if err == repository.ErrTaken {
+		checkUserTaken(h.userRepo(c), u, errors)
+		return models.NewError(fiber.StatusConflict, err.Error()).WithFields(errors.Fields())
+	}
+	if err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
 	}
 
-	if count := db.DB.Where(&models.User{Email: u.Email}).First(new(models.User)).RowsAffected; count > 0 {
+	return h.sendAuthTokens(c, u)
+}
+
+// checkUserTaken sets the errors of the email and username of u which are registered already
+func checkUserTaken(users repository.UserRepo, u *models.User, errors *models.UserErrors) bool {
+	if users.EmailTaken(u.Email) {
 		errors.Err, errors.Email = true, "Email is already registered"
 	}
-	if count := db.DB.Where(&models.User{Username: u.Username}).First(new(models.User)).RowsAffected; count > 0 {
+	if users.UsernameTaken(u.Username) {
 		errors.Err, errors.Username = true, "Username is already registered"
 	}
+
+	return errors.Err
+}
+
+func (h *Handler) LoginUser(c *fiber.Ctx) error {
+	input := new(models.LoginInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	if err := h.checkLoginAllowed(c, nil); err != nil {
+		return err
+	}
+
+	// check if a user exists
+	u, err := h.userRepo(c).ByIdentity(input.Identity)
+	if err != nil {
+		h.loginFailed(c, nil)
+		return sendError(c, "Invalid Credentials", fiber.StatusUnauthorized)
+	}
+
+	if err := h.checkLoginAllowed(c, u); err != nil {
+		return err
+	}
+
+	// Comparing the password with the hash
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(input.Password)); err != nil {
+		h.loginFailed(c, u)
+		return sendError(c, "Invalid Credentials", fiber.StatusUnauthorized)
+	}
+
+	if err := h.checkSSORequired(c, u); err != nil {
+		return err
+	}
+	if u.Locked {
+		return sendError(c, "Account is locked", fiber.StatusForbidden)
+	}
+
+	if !u.TOTPEnabled {
+		h.loginSucceeded(c, u)
+	}
+
+	return h.sendLoginResponse(c, u)
+}
+
+// GetUserData returns the details of the user signed in
+func (h *Handler) GetUserData(c *fiber.Ctx) error {
+	u, err := h.currentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	return c.JSON(u.Api())
+}
+
+// UpdateUserData changes the profile of the user signed in.
+// A new email is kept as pending until it is verified by the link sent to it.
+func (h *Handler) UpdateUserData(c *fiber.Ctx) error {
+	input := new(models.ProfileInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+	errors := &models.UserErrors{}
+
+	u, err := h.currentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if input.Username != "" && input.Username != u.Username {
+		if h.userRepo(c).UsernameTaken(input.Username) {
+			errors.Err, errors.Username = true, "Username is already registered"
+		}
+		u.Username = input.Username
+	}
+
+	var emailToken string
+	if input.Email != "" && input.Email != u.Email {
+		// a demo account sends no emails, it would spam the addresses given to it
+		if u.Demo() {
+			return sendError(c, "A demo account cannot change its email", fiber.StatusForbidden)
+		}
+		if h.userRepo(c).EmailTaken(input.Email) {
+			errors.Err, errors.Email = true, "Email is already registered"
+		}
+		emailToken = util.RandomToken(32)
+		u.PendingEmail, u.EmailToken = input.Email, util.HashToken(emailToken)
+	}
+
 	if errors.Err {
-		return c.JSON(errors)
+		return models.NewError(fiber.StatusConflict, repository.ErrTaken.Error()).WithFields(errors.Fields())
 	}
 
-	// Hashing the password with a random salt
-	password := []byte(u.Password)
-	hashedPassword, err := bcrypt.GenerateFromPassword(
-		password,
-		bcrypt.DefaultCost,
-	)
+	if input.DisplayName != nil {
+		u.DisplayName = strings.TrimSpace(*input.DisplayName)
+	}
+	if input.TimeZone != "" {
+		u.TimeZone = input.TimeZone
+	}
+	if input.Locale != "" {
+		u.Locale = input.Locale
+	}
+
+	if err := h.userRepo(c).Save(u); err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	if emailToken != "" {
+		h.sendEmailVerification(c, u, emailToken)
+	}
 
+	return c.JSON(u.Api())
+}
+
+// VerifyEmail confirms the pending email of a user
+func (h *Handler) VerifyEmail(c *fiber.Ctx) error {
+	u, err := h.userRepo(c).ByEmailToken(util.HashToken(c.Params("token")))
 	if err != nil {
-		panic(err)
+		return sendError(c, "Invalid verification link", fiber.StatusNotFound)
 	}
-	u.Password = string(hashedPassword)
 
-	if err := db.DB.Create(&u).Error; err != nil {
-		return c.JSON(fiber.Map{
-			"error":   true,
-			"general": "Something went wrong, please try again later. 😕",
-		})
+	if h.userRepo(c).EmailTaken(u.PendingEmail) {
+		return models.NewError(fiber.StatusConflict, "Email is already registered").WithFields(map[string]string{"email": "Email is already registered"})
 	}
 
-	// setting up the authorization cookies
-	accessToken, refreshToken := util.GenerateTokens(strconv.Itoa(int(u.ID)))
-	accessCookie, refreshCookie := util.GetAuthCookies(accessToken, refreshToken)
-	c.Cookie(accessCookie)
-	c.Cookie(refreshCookie)
+	now := time.Now()
+	u.Email, u.PendingEmail, u.EmailToken, u.EmailVerifiedAt = u.PendingEmail, "", "", &now
+	if err := h.userRepo(c).Save(u); err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
 
-	return c.Status(fiber.StatusOK).JSON(fiber.Map{
-		"access_token":  accessToken,
-		"refresh_token": refreshToken,
-	})
+	return c.JSON(fiber.Map{"email": u.Email})
 }
 
-func LoginUser(c *fiber.Ctx) error {
-	type LoginInput struct {
-		Identity string `json:"identity"`
-		Password string `json:"password"`
+// DeleteUser soft-deletes the account of the user signed in and revokes its tokens.
+// By ACCOUNT_DELETE_MODE the tasks are either deleted too ("cascade")
+// or kept with the owner anonymized ("anonymize", default).
+func (h *Handler) DeleteUser(c *fiber.Ctx) error {
+	u, err := h.currentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
 	}
 
-	input := new(LoginInput)
+	err = h.userRepo(c).Delete(u, h.conf.Accounts.DeleteMode == "cascade")
 
-	if err := c.BodyParser(input); err != nil {
-		return c.JSON(fiber.Map{"error": true, "input": "Please review your input"})
+	if err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
 	}
 
-	// check if a user exists
-	u := new(models.User)
-	if res := db.DB.Where(
-		&models.User{Email: input.Identity}).Or(
-		&models.User{Username: input.Identity},
-	).First(&u); res.RowsAffected <= 0 {
-		return c.JSON(fiber.Map{"error": true, "general": "Invalid Credentials."})
+	avatars.Remove(u.AvatarKey)
+	h.tokens.RevokeTokens(strconv.Itoa(int(u.ID)), models.RevokedAccountDeleted)
+	h.tokens.ClearAuthCookies(c)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// ChangePassword replaces the password of the user signed in and revokes all of its refresh tokens.
+// The current session gets a fresh token pair, every other session has to log in again.
+func (h *Handler) ChangePassword(c *fiber.Ctx) error {
+	type PasswordInput struct {
+		CurrentPassword string `json:"currentPassword" validate:"required"`
+		NewPassword     string `json:"newPassword" validate:"strongpassword"`
 	}
 
-	// Comparing the password with the hash
-	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(input.Password)); err != nil {
-		return c.JSON(fiber.Map{"error": true, "general": "Invalid Credentials."})
+	input := new(PasswordInput)
+	if err := parseBody(c, input); err != nil {
+		return err
+	}
+
+	u, err := h.currentCredentials(c)
+	if err != nil {
+		return sendError(c, "Cannot find the User", fiber.StatusUnauthorized)
+	}
+
+	if err := bcrypt.CompareHashAndPassword([]byte(u.Password), []byte(input.CurrentPassword)); err != nil {
+		return models.NewError(fiber.StatusForbidden, "Invalid password").WithFields(map[string]string{"currentPassword": "Invalid password"})
 	}
 
-	// setting up the authorization cookies
-	accessToken, refreshToken := util.GenerateTokens(strconv.Itoa(int(u.ID)))
-	accessCookie, refreshCookie := util.GetAuthCookies(accessToken, refreshToken)
+	hashedPassword, err := bcrypt.GenerateFromPassword([]byte(input.NewPassword), bcrypt.DefaultCost)
+	if err != nil {
+		panic(err)
+	}
+
+	if err := h.userRepo(c).Update(u, map[string]interface{}{"password": string(hashedPassword)}); err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	if err := h.tokens.RevokeTokens(strconv.Itoa(int(u.ID)), models.RevokedPasswordChanged); err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	return h.sendAuthTokens(c, u)
+}
+
+// sendAuthTokens sets up the authorization cookies and sends the tokens of the user
+func (h *Handler) sendAuthTokens(c *fiber.Ctx, u *models.User) error {
+	accessToken, refreshToken := h.tokens.GenerateTokens(strconv.Itoa(int(u.ID)), util.DeviceOf(c))
+	accessCookie, refreshCookie := h.tokens.GetAuthCookies(accessToken, refreshToken)
 	c.Cookie(accessCookie)
 	c.Cookie(refreshCookie)
+	c.Locals(sessionUserLocal, u.ID)
 
 	return c.Status(fiber.StatusOK).JSON(fiber.Map{
 		"access_token":  accessToken,
@@ -118,58 +320,93 @@ func LoginUser(c *fiber.Ctx) error {
 	})
 }
 
-// GetUserData returns the details of the user signed in
-func GetUserData(c *fiber.Ctx) error {
-	id := c.Locals("id")
+// verifyEmail is the data of the template of the email verifying a new email
+type verifyEmail struct {
+	T       *i18n.Printer
+	Subject string
+	URL     string
+}
 
-	u := new(models.User)
-	if res := db.DB.Where("uuid = ?", id).First(&u); res.RowsAffected <= 0 {
-		return c.JSON(fiber.Map{"error": true, "general": "Cannot find the User"})
+// sendEmailVerification emails the link verifying the pending email of the user to it
+func (h *Handler) sendEmailVerification(c *fiber.Ctx, u *models.User, token string) {
+	link := h.mailLink("/api/v1/user/verify-email/" + token)
+	p := i18n.For(u.Locale)
+	data := verifyEmail{T: p, Subject: p.Text("Verify your email"), URL: link}
+
+	html, err := mailer.Render("verify_email.html", data)
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("template", "verify_email.html").Msg("Cannot render email")
+		return
 	}
 
-	return c.JSON(u)
+	mailer.Send(mailer.Message{
+		To:      u.PendingEmail,
+		Subject: data.Subject,
+		HTML:    html,
+		Text: p.Text("Open the link to verify the email of your Tasker account:") + "\n\n" + link + "\n\n" +
+			p.Text("If you did not change your email, you can ignore this email.") + "\n",
+	})
+}
+
+// mailLink returns the URL of the path in the app the emails link to. The links are not built
+// from the Host of the request, which the client chooses.
+func (h *Handler) mailLink(path string) string {
+	return strings.TrimSuffix(h.conf.Mail.BaseURL, "/") + path
 }
 
 // GetAccessToken generates and sends a new access token iff there is a valid refresh token
-func GetAccessToken(c *fiber.Ctx) error {
-	refreshToken := c.Cookies("refresh_token")
+func (h *Handler) GetAccessToken(c *fiber.Ctx) error {
+	refreshToken := c.Cookies(util.RefreshTokenCookie)
 
 	refreshClaims := new(models.Claims)
-	token, _ := jwt.ParseWithClaims(refreshToken, refreshClaims,
-		func(token *jwt.Token) (interface{}, error) {
-			return jwtKey, nil
-		})
-
-	if res := db.DB.Where(
-		"expires_at = ? AND issued_at = ? AND issuer = ?",
-		refreshClaims.ExpiresAt, refreshClaims.IssuedAt, refreshClaims.Issuer,
-	).First(&models.Claims{}); res.RowsAffected <= 0 {
+	token, err := h.tokens.ParseClaims(refreshToken, refreshClaims)
+
+	session, findErr := h.tokens.FindSession(refreshClaims)
+	if findErr != nil {
 		// no such refresh token exist in the database
-		c.ClearCookie("access_token", "refresh_token")
-		return c.SendStatus(fiber.StatusForbidden)
+		h.tokens.ClearAuthCookies(c)
+		return sendError(c, "Invalid refresh token", fiber.StatusForbidden)
+	}
+	if session.RevokedAt != nil {
+		// a signed out session is kept until it expires, its token may have leaked
+		logging.FromCtx(c).Warn().Uint("session", session.ID).Str("user", session.Issuer).
+			Str("reason", session.RevokedReason).Msg("Revoked refresh token used")
+		h.tokens.ClearAuthCookies(c)
+		return sendError(c, "Refresh token revoked", fiber.StatusForbidden)
 	}
 
-	if token.Valid {
-		if refreshClaims.ExpiresAt < time.Now().Unix() {
-			// refresh token is expired
-			c.ClearCookie("access_token", "refresh_token")
-			return c.SendStatus(fiber.StatusForbidden)
-		}
-	} else {
+	if errors.Is(err, jwt.ErrTokenExpired) {
+		// refresh token is expired
+		h.tokens.ClearAuthCookies(c)
+		return sendError(c, "Refresh token expired", fiber.StatusForbidden)
+	}
+	if err != nil || !token.Valid || refreshClaims.Subject != "refresh_token" {
 		// malformed refresh token
-		c.ClearCookie("access_token", "refresh_token")
-		return c.SendStatus(fiber.StatusForbidden)
+		h.tokens.ClearAuthCookies(c)
+		return sendError(c, "Invalid refresh token", fiber.StatusForbidden)
 	}
 
-	_, accessToken := util.GenerateAccessClaims(refreshClaims.Issuer)
+	h.tokens.TouchSession(session, util.DeviceOf(c))
 
-	c.Cookie(&fiber.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HTTPOnly: true,
-		Secure:   true,
-	})
+	_, accessToken := h.tokens.GenerateAccessClaims(refreshClaims.Issuer)
+
+	c.Cookie(h.tokens.AccessCookie(accessToken))
 
 	return c.JSON(fiber.Map{"access_token": accessToken})
 }
+
+// location returns the zone the days of the request are in: the ?tz= of the request,
+// the zone of the user otherwise
+func location(c *fiber.Ctx, u *models.User) (*time.Location, error) {
+	tz := c.Query("tz")
+	if tz == "" {
+		return u.Location(), nil
+	}
+
+	loc, err := models.Location(tz)
+	if err != nil {
+		return nil, models.NewError(fiber.StatusBadRequest, "Invalid tz, it must be a time zone like Europe/Berlin")
+	}
+
+	return loc, nil
+}
@@ -0,0 +1,115 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"net/http"
+	"regexp"
+	"strconv"
+	"strings"
+	"task-app/config"
+	"task-app/models"
+	"time"
+)
+
+// apiVersion is a version of the API served at /api/<name>. A breaking change ships as
+// a new version with its own setup, the routes it keeps are set up by both.
+type apiVersion struct {
+	name  string
+	setup func(h *Handler, api fiber.Router)
+}
+
+// apiVersions are the versions served, the first one is served at the legacy paths too
+var apiVersions = []apiVersion{
+	{name: "v1", setup: (*Handler).setupV1Routes},
+}
+
+// versionKey is the local of the version of the request
+const versionKey = "api.version"
+
+// VersionHeader names the version of the API which answered
+const VersionHeader = "API-Version"
+
+// versionSegment matches the first segment of the versioned paths of /api, e.g. v2
+var versionSegment = regexp.MustCompile(`^v[0-9]+$`)
+
+// APIVersion returns the version of the API of the request, e.g. v1
+func APIVersion(c *fiber.Ctx) string {
+	v, _ := c.Locals(versionKey).(string)
+	return v
+}
+
+// setupVersions serves every version of the API, then the legacy unversioned paths.
+// The CSRF token is checked for the cookie sessions of the whole API.
+func (h *Handler) setupVersions(app *fiber.App) {
+	csrf := h.tokens.CSRF()
+	for _, v := range apiVersions {
+		v.setup(h, app.Group("/api/"+v.name, versioned(v.name), csrf))
+	}
+
+	legacy := apiVersions[0]
+	legacy.setup(h, app.Group("/api", h.legacyPaths(legacy.name, csrf)))
+}
+
+// versioned marks the requests of a version
+func versioned(name string) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(versionKey, name)
+		c.Set(VersionHeader, name)
+		return c.Next()
+	}
+}
+
+// legacyPaths serves the paths of /api without a version as the version they were moved
+// to. They answer with the Deprecation (RFC 9745) and Sunset (RFC 8594) headers and link
+// to their versioned path, then 410 from the sunset. It also answers the versions not served.
+func (h *Handler) legacyPaths(name string, csrf fiber.Handler) fiber.Handler {
+	// the days are checked by the config validation
+	deprecatedAt, _ := time.Parse(config.DateFormat, h.conf.API.LegacyDeprecatedAt)
+	sunset, _ := time.Parse(config.DateFormat, h.conf.API.LegacySunset)
+	deprecation := "@" + strconv.FormatInt(deprecatedAt.Unix(), 10)
+
+	return func(c *fiber.Ctx) error {
+		rest := strings.TrimPrefix(c.Path(), "/api")
+		segment := strings.SplitN(strings.TrimPrefix(rest, "/"), "/", 2)[0]
+		if versionSegment.MatchString(segment) {
+			if servedVersion(segment) {
+				return c.Next()
+			}
+			return models.NewError(fiber.StatusNotFound, "API version "+segment+" is not supported, the versions are "+strings.Join(versionNames(), ", "))
+		}
+
+		successor := "/api/" + name + rest
+		if !sunset.IsZero() && !time.Now().Before(sunset) {
+			return models.NewError(fiber.StatusGone, "The paths without a version are retired, use "+successor)
+		}
+
+		c.Locals(versionKey, name)
+		c.Set(VersionHeader, name)
+		c.Set("Deprecation", deprecation)
+		if !sunset.IsZero() {
+			c.Set("Sunset", sunset.Format(http.TimeFormat))
+		}
+		c.Set(fiber.HeaderLink, "<"+successor+`>; rel="successor-version"`)
+
+		return csrf(c)
+	}
+}
+
+func servedVersion(name string) bool {
+	for _, v := range apiVersions {
+		if v.name == name {
+			return true
+		}
+	}
+
+	return false
+}
+
+func versionNames() []string {
+	names := make([]string, 0, len(apiVersions))
+	for _, v := range apiVersions {
+		names = append(names, v.name)
+	}
+
+	return names
+}
@@ -0,0 +1,21 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"os"
+	"task-app/web"
+)
+
+// setupWebRoutes serves the frontend from / when it is enabled, after all the other routes so
+// the app only gets the paths the server does not handle
+func (h *Handler) setupWebRoutes(app *fiber.App) {
+	if !h.conf.Web.Enabled {
+		return
+	}
+
+	files := web.Dist()
+	if h.conf.Web.Dir != "" {
+		files = os.DirFS(h.conf.Web.Dir)
+	}
+	app.Use(web.Handler(files))
+}
@@ -0,0 +1,179 @@
+package router
+
+import (
+	"context"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"net/url"
+	"strings"
+	"task-app/models"
+	"task-app/util"
+	"task-app/webhooks"
+)
+
+func (h *Handler) setupWebhooksRoutes() {
+	WEBHOOKS.Use(h.tokens.SecureAuth())
+	WEBHOOKS.Get("/", h.handleGetWebhooks)
+	WEBHOOKS.Post("/", h.handleCreateWebhook)
+	WEBHOOKS.Patch("/:id", h.handleUpdateWebhook)
+	WEBHOOKS.Delete("/:id", h.handleDeleteWebhook)
+	WEBHOOKS.Get("/:id/deliveries", h.handleGetWebhookDeliveries)
+}
+
+func (h *Handler) handleGetWebhooks(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	var hooks []models.Webhook
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Order("id").Find(&hooks); res.Error != nil {
+		return sendError(c, "Cannot find user's webhooks", fiber.StatusForbidden)
+	}
+
+	response := make([]models.WebhookApi, 0, len(hooks))
+	for _, w := range hooks {
+		response = append(response, w.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+// handleCreateWebhook registers a webhook, its signing secret is returned only once
+func (h *Handler) handleCreateWebhook(c *fiber.Ctx) error {
+	var input models.WebhookApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if msg := validateWebhook(util.Context(c), &input); msg != "" {
+		return sendError(c, msg, fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	hook := models.Webhook{
+		UserID: u.ID,
+		URL:    input.URL,
+		Secret: util.RandomToken(32),
+		Events: strings.Join(input.Events, ","),
+		Active: input.Active == nil || *input.Active,
+	}
+
+	if res := h.db(c).Create(&hook); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+
+	response := hook.Api()
+	response.Secret = hook.Secret
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleUpdateWebhook(c *fiber.Ctx) error {
+	var input models.WebhookApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if msg := validateWebhook(util.Context(c), &input); msg != "" {
+		return sendError(c, msg, fiber.StatusBadRequest)
+	}
+
+	hook, err := h.findUserWebhook(c)
+	if err != nil {
+		return sendError(c, "Cannot find the Webhook", fiber.StatusNotFound)
+	}
+
+	hook.URL = input.URL
+	hook.Events = strings.Join(input.Events, ",")
+	if input.Active != nil {
+		hook.Active = *input.Active
+	}
+
+	if res := h.db(c).Save(hook); res.Error != nil {
+		return sendError(c, "Cannot update webhook "+res.Error.Error(), fiber.StatusForbidden)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(hook.Api())
+}
+
+func (h *Handler) handleDeleteWebhook(c *fiber.Ctx) error {
+	hook, err := h.findUserWebhook(c)
+	if err != nil {
+		return sendError(c, "Cannot find the Webhook", fiber.StatusNotFound)
+	}
+
+	if res := h.db(c).Delete(hook); res.Error != nil {
+		return sendError(c, "Cannot delete webhook "+res.Error.Error(), fiber.StatusForbidden)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleGetWebhookDeliveries(c *fiber.Ctx) error {
+	hook, err := h.findUserWebhook(c)
+	if err != nil {
+		return sendError(c, "Cannot find the Webhook", fiber.StatusNotFound)
+	}
+
+	limit, offset := paginate(c)
+
+	var deliveries []models.WebhookDelivery
+	if res := h.db(c).Where("webhook_id = ?", hook.ID).
+		Order("created_at DESC, id DESC").
+		Limit(limit).
+		Offset(offset).
+		Find(&deliveries); res.Error != nil {
+		return sendError(c, "Cannot find webhook's deliveries", fiber.StatusForbidden)
+	}
+
+	response := make([]models.WebhookDeliveryApi, 0, len(deliveries))
+	for _, d := range deliveries {
+		response = append(response, d.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func validateWebhook(ctx context.Context, w *models.WebhookApi) string {
+	u, err := url.Parse(w.URL)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return "Webhook url must be a valid http(s) url"
+	}
+	// checked again by the deliveries, the host may resolve to other addresses by then
+	switch err := webhooks.CheckURL(ctx, w.URL); {
+	case errors.Is(err, webhooks.ErrPrivateAddress):
+		return "Webhook url must reach a public address"
+	case err != nil:
+		return "Webhook url host cannot be resolved"
+	}
+
+	if len(w.Events) == 0 {
+		return "At least one event is required"
+	}
+	for _, e := range w.Events {
+		if !webhooks.IsEvent(e) {
+			return "Unknown event " + e
+		}
+	}
+
+	return ""
+}
+
+func (h *Handler) findUserWebhook(c *fiber.Ctx) (*models.Webhook, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, err
+	}
+
+	hook := new(models.Webhook)
+	if res := h.db(c).Scopes(models.OwnedBy(u)).Where("id = ?", c.Params("id")).First(hook); res.Error != nil {
+		return nil, res.Error
+	}
+
+	return hook, nil
+}
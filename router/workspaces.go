@@ -0,0 +1,465 @@
+package router
+
+import (
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strings"
+	"task-app/cache"
+	"task-app/i18n"
+	"task-app/logging"
+	"task-app/mailer"
+	"task-app/models"
+	"task-app/quota"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+)
+
+// inviteTTL is how long an invitation link stays valid
+const inviteTTL = 7 * 24 * time.Hour
+
+var errNoPermission = repository.ErrNoPermission
+
+func (h *Handler) setupWorkspacesRoutes() {
+	WORKSPACES.Use(h.tokens.SecureAuth())
+	WORKSPACES.Get("/", h.handleGetWorkspaces)
+	WORKSPACES.Post("/", h.handleCreateWorkspace)
+	WORKSPACES.Post("/invites/:token/accept", h.handleAcceptInvite)
+	WORKSPACES.Patch("/:id", h.handleUpdateWorkspace)
+	WORKSPACES.Delete("/:id", h.handleDeleteWorkspace)
+	WORKSPACES.Get("/:id/usage", h.handleGetWorkspaceUsage)
+	WORKSPACES.Get("/:id/sso", h.handleGetWorkspaceSSO)
+	WORKSPACES.Put("/:id/sso", h.handleSaveWorkspaceSSO)
+	WORKSPACES.Delete("/:id/sso", h.handleDeleteWorkspaceSSO)
+	WORKSPACES.Post("/:id/sso/link", h.handleSSOLink)
+	WORKSPACES.Get("/:id/members", h.handleGetMembers)
+	WORKSPACES.Patch("/:id/members/:userId", h.handleUpdateMember)
+	WORKSPACES.Delete("/:id/members/:userId", h.handleRemoveMember)
+	WORKSPACES.Get("/:id/invites", h.handleGetInvites)
+	WORKSPACES.Post("/:id/invites", h.handleCreateInvite)
+	WORKSPACES.Delete("/:id/invites/:inviteId", h.handleDeleteInvite)
+}
+
+func (h *Handler) handleGetWorkspaces(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user by token", fiber.StatusForbidden)
+	}
+
+	var memberships []models.Membership
+	if res := h.db(c).Where("user_id = ?", u.ID).Find(&memberships); res.Error != nil {
+		return sendError(c, "Cannot find user's workspaces", fiber.StatusForbidden)
+	}
+
+	roles := make(map[uint]string, len(memberships))
+	ids := make([]uint, 0, len(memberships))
+	for _, m := range memberships {
+		roles[m.WorkspaceID] = m.Role
+		ids = append(ids, m.WorkspaceID)
+	}
+
+	var workspaces []models.Workspace
+	if len(ids) > 0 {
+		h.db(c).Where("id IN ?", ids).Order("name").Find(&workspaces)
+	}
+
+	response := make([]models.WorkspaceApi, 0, len(workspaces))
+	for _, w := range workspaces {
+		response = append(response, w.Api(roles[w.ID]))
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleCreateWorkspace(c *fiber.Ctx) error {
+	var input models.WorkspaceApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Name = strings.TrimSpace(input.Name); input.Name == "" {
+		return sendError(c, "Workspace name is required field", fiber.StatusBadRequest)
+	}
+
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	workspace := models.Workspace{
+		Name:    input.Name,
+		OwnerID: u.ID,
+		Members: []models.Membership{{UserID: u.ID, Role: models.WorkspaceOwner}},
+	}
+
+	if res := h.db(c).Omit("Members.User").Create(&workspace); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(workspace.Api(models.WorkspaceOwner))
+}
+
+func (h *Handler) handleUpdateWorkspace(c *fiber.Ctx) error {
+	var input models.WorkspaceApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Name = strings.TrimSpace(input.Name); input.Name == "" {
+		return sendError(c, "Workspace name is required field", fiber.StatusBadRequest)
+	}
+
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	if res := h.db(c).Model(workspace).Update("name", input.Name); res.Error != nil {
+		return sendError(c, "Cannot update workspace "+res.Error.Error(), fiber.StatusForbidden)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(workspace.Api(models.WorkspaceOwner))
+}
+
+// handleDeleteWorkspace removes the workspace with its memberships, invites, projects and tasks
+func (h *Handler) handleDeleteWorkspace(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		projects := tx.Session(&gorm.Session{NewDB: true}).Model(&models.Project{}).Select("id").Where("workspace_id = ?", workspace.ID)
+		if err := tx.Where("project_id IN (?)", projects).Delete(&models.GitHubIntegration{}).Error; err != nil {
+			return err
+		}
+		for _, model := range []interface{}{&models.Task{}, &models.Project{}, &models.Invite{}, &models.Membership{}, &models.SlackInstallation{},
+			&models.SSOIdentity{}, &models.WorkspaceSSO{}} {
+			if err := tx.Where("workspace_id = ?", workspace.ID).Delete(model).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(workspace).Error
+	})
+
+	if err != nil {
+		return sendError(c, "Cannot delete workspace "+err.Error(), fiber.StatusForbidden)
+	}
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleGetMembers(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	var members []models.Membership
+	if res := h.db(c).Where("workspace_id = ?", workspace.ID).Preload("User").Find(&members); res.Error != nil {
+		return sendError(c, "Cannot find workspace's members", fiber.StatusForbidden)
+	}
+
+	response := make([]models.MemberApi, 0, len(members))
+	for _, m := range members {
+		response = append(response, m.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleUpdateMember(c *fiber.Ctx) error {
+	var input models.MemberApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if !models.IsWorkspaceRole(input.Role) {
+		return sendError(c, "Unknown role "+input.Role, fiber.StatusBadRequest)
+	}
+
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	member := new(models.Membership)
+	if res := h.db(c).Where(
+		"workspace_id = ? AND user_id = ?", workspace.ID, c.Params("userId"),
+	).Preload("User").First(member); res.Error != nil {
+		return sendError(c, "Cannot find the Member", fiber.StatusNotFound)
+	}
+
+	if member.UserID == workspace.OwnerID {
+		return sendError(c, "Role of the workspace owner cannot be changed", fiber.StatusForbidden)
+	}
+
+	if res := h.db(c).Model(member).Update("role", input.Role); res.Error != nil {
+		return sendError(c, "Cannot update member "+res.Error.Error(), fiber.StatusForbidden)
+	}
+
+	return c.Status(fiber.StatusOK).JSON(member.Api())
+}
+
+// handleRemoveMember lets the owner remove anyone, and any member leave the workspace
+func (h *Handler) handleRemoveMember(c *fiber.Ctx) error {
+	workspace, membership, err := h.findWorkspace(c)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	userID, err := c.ParamsInt("userId")
+	if err != nil {
+		return sendError(c, "Invalid user id", fiber.StatusBadRequest)
+	}
+
+	if uint(userID) != membership.UserID && membership.Role != models.WorkspaceOwner {
+		return sendError(c, errNoPermission.Error(), fiber.StatusForbidden)
+	}
+
+	if uint(userID) == workspace.OwnerID {
+		return sendError(c, "The workspace owner cannot leave the workspace", fiber.StatusForbidden)
+	}
+
+	res := h.db(c).Where("workspace_id = ? AND user_id = ?", workspace.ID, userID).Delete(&models.Membership{})
+	if res.Error != nil || res.RowsAffected <= 0 {
+		return sendError(c, "Cannot find the Member", fiber.StatusNotFound)
+	}
+	// the lists of a user are the tasks of their workspaces
+	h.cache.Forget(cache.Tasks)
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+func (h *Handler) handleGetInvites(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	var invites []models.Invite
+	if res := h.db(c).Where("workspace_id = ? AND expires_at > ?", workspace.ID, time.Now()).Find(&invites); res.Error != nil {
+		return sendError(c, "Cannot find workspace's invites", fiber.StatusForbidden)
+	}
+
+	response := make([]models.InviteApi, 0, len(invites))
+	for _, i := range invites {
+		response = append(response, i.Api())
+	}
+
+	return c.Status(fiber.StatusOK).JSON(response)
+}
+
+func (h *Handler) handleCreateInvite(c *fiber.Ctx) error {
+	var input models.InviteApi
+	if err := c.BodyParser(&input); err != nil {
+		return sendError(c, "Invalid request data", fiber.StatusBadRequest)
+	}
+
+	if input.Role == "" {
+		input.Role = models.WorkspaceMember
+	}
+	if input.Role == models.WorkspaceOwner || !models.IsWorkspaceRole(input.Role) {
+		return sendError(c, "Unknown role "+input.Role, fiber.StatusBadRequest)
+	}
+
+	if input.Email = strings.TrimSpace(input.Email); !util.IsEmail(input.Email) {
+		return sendError(c, "Must be a valid email", fiber.StatusBadRequest)
+	}
+
+	workspace, membership, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+	// the invites are emailed, a demo account sends no emails
+	inviter, err := h.tokens.CurrentUser(c)
+	if err != nil || inviter.Demo() {
+		return sendError(c, "A demo account cannot invite members", fiber.StatusForbidden)
+	}
+	// the invite is refused when the workspace is full rather than once it is accepted
+	if err := h.quotas.Check(h.db(c), &workspace.ID, quota.Members, 1); err != nil {
+		return err
+	}
+
+	token := util.RandomToken(32)
+	invite := models.Invite{
+		WorkspaceID: workspace.ID,
+		Email:       input.Email,
+		Role:        input.Role,
+		TokenHash:   util.HashToken(token),
+		InvitedByID: membership.UserID,
+		ExpiresAt:   time.Now().Add(inviteTTL),
+	}
+
+	if res := h.db(c).Create(&invite); res.Error != nil {
+		return sendError(c, res.Error.Error(), fiber.StatusBadRequest)
+	}
+
+	sendInvite(c, inviter, workspace, &invite, h.mailLink("/invites/"+token))
+
+	return c.Status(fiber.StatusOK).JSON(invite.Api())
+}
+
+func (h *Handler) handleDeleteInvite(c *fiber.Ctx) error {
+	workspace, _, err := h.findWorkspace(c, models.WorkspaceOwner)
+	if err != nil {
+		return sendWorkspaceError(c, err)
+	}
+
+	res := h.db(c).Where("id = ? AND workspace_id = ?", c.Params("inviteId"), workspace.ID).Delete(&models.Invite{})
+	if res.Error != nil || res.RowsAffected <= 0 {
+		return sendError(c, "Cannot find the Invite", fiber.StatusNotFound)
+	}
+
+	return c.SendStatus(fiber.StatusNoContent)
+}
+
+// handleAcceptInvite joins the user signed in to the workspace,
+// the invite must have been sent to the email of the user
+func (h *Handler) handleAcceptInvite(c *fiber.Ctx) error {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return sendError(c, "Cannot find user", fiber.StatusBadRequest)
+	}
+
+	invite := new(models.Invite)
+	if res := h.db(c).Where(
+		"token_hash = ? AND expires_at > ?", util.HashToken(c.Params("token")), time.Now(),
+	).First(invite); res.Error != nil {
+		return sendError(c, "Invalid invitation link", fiber.StatusNotFound)
+	}
+
+	if !strings.EqualFold(invite.Email, u.Email) {
+		return sendError(c, "The invitation was sent to another email", fiber.StatusForbidden)
+	}
+
+	// the workspace is one of the user once the membership is created
+	workspace := new(models.Workspace)
+	if res := repository.AllTenants(h.db(c)).First(workspace, invite.WorkspaceID); res.Error != nil {
+		return sendError(c, "Cannot find the Workspace", fiber.StatusNotFound)
+	}
+
+	err = h.db(c).Transaction(func(tx *gorm.DB) error {
+		if count := tx.Where(
+			"workspace_id = ? AND user_id = ?", invite.WorkspaceID, u.ID,
+		).First(new(models.Membership)).RowsAffected; count <= 0 {
+			if err := tx.Create(&models.Membership{
+				WorkspaceID: invite.WorkspaceID,
+				UserID:      u.ID,
+				Role:        invite.Role,
+			}).Error; err != nil {
+				return err
+			}
+		}
+
+		return tx.Delete(invite).Error
+	})
+
+	if err != nil {
+		if qerr := quotaError(err); qerr != nil {
+			return qerr
+		}
+		return sendError(c, "Cannot accept invite "+err.Error(), fiber.StatusBadRequest)
+	}
+	// the lists read while the transaction was open are dropped again once it is committed
+	h.cache.Forget(cache.Tasks)
+
+	return c.Status(fiber.StatusOK).JSON(workspace.Api(invite.Role))
+}
+
+// findWorkspace returns the workspace of the :id param and the membership of the
+// user signed in. With roles given the membership must have one of them.
+func (h *Handler) findWorkspace(c *fiber.Ctx, roles ...string) (*models.Workspace, *models.Membership, error) {
+	u, err := h.tokens.CurrentUser(c)
+	if err != nil {
+		return nil, nil, errNoPermission
+	}
+
+	membership, err := h.findMembership(c, u, c.Params("id"), roles...)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	workspace := new(models.Workspace)
+	if res := h.db(c).First(workspace, membership.WorkspaceID); res.Error != nil {
+		return nil, nil, gorm.ErrRecordNotFound
+	}
+
+	return workspace, membership, nil
+}
+
+// findMembership returns the membership of the user in a workspace,
+// with roles given the membership must have one of them.
+func (h *Handler) findMembership(c *fiber.Ctx, u *models.User, workspaceID interface{}, roles ...string) (*models.Membership, error) {
+	membership := new(models.Membership)
+	if res := h.db(c).Where(
+		"workspace_id = ? AND user_id = ?", workspaceID, u.ID,
+	).First(membership); res.Error != nil {
+		return nil, gorm.ErrRecordNotFound
+	}
+
+	if len(roles) == 0 {
+		return membership, nil
+	}
+	for _, role := range roles {
+		if membership.Role == role {
+			return membership, nil
+		}
+	}
+
+	return nil, errNoPermission
+}
+
+func sendWorkspaceError(c *fiber.Ctx, err error) error {
+	if errors.Is(err, errNoPermission) {
+		return sendError(c, err.Error(), fiber.StatusForbidden)
+	}
+
+	return sendError(c, "Cannot find the Workspace", fiber.StatusNotFound)
+}
+
+// inviteEmail is the data of the template of the email of an invite
+type inviteEmail struct {
+	T         *i18n.Printer
+	Subject   string
+	URL       string
+	Inviter   string
+	Workspace string
+	Days      int
+}
+
+// sendInvite emails the invite to its email, in the language of the inviter: the account of the
+// email may not exist yet. The link opens the invite in the app, which accepts it.
+func sendInvite(c *fiber.Ctx, inviter *models.User, workspace *models.Workspace, invite *models.Invite, link string) {
+	p := i18n.For(inviter.Locale)
+	name := inviter.DisplayName
+	if name == "" {
+		name = inviter.Username
+	}
+	data := inviteEmail{
+		T:         p,
+		Subject:   p.Sprintf("You are invited to %s", workspace.Name),
+		URL:       link,
+		Inviter:   name,
+		Workspace: workspace.Name,
+		Days:      int(inviteTTL.Hours() / 24),
+	}
+
+	html, err := mailer.Render("invite.html", data)
+	if err != nil {
+		logging.FromCtx(c).Error().Err(err).Str("template", "invite.html").Msg("Cannot render email")
+		return
+	}
+
+	mailer.Send(mailer.Message{
+		To:      invite.Email,
+		Subject: data.Subject,
+		HTML:    html,
+		Text: p.Sprintf("%s invites you to the workspace %s on Tasker, the invite works within %d days:", data.Inviter, data.Workspace, data.Days) +
+			"\n\n" + link + "\n\n" + p.Text("If you do not know the sender, you can ignore this email.") + "\n",
+	})
+}
@@ -0,0 +1,118 @@
+package router
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/gofiber/websocket/v2"
+	"strconv"
+	"task-app/models"
+	"task-app/realtime"
+	"task-app/util"
+	"time"
+)
+
+// wsPingInterval keeps idle connections open through proxies
+const wsPingInterval = 30 * time.Second
+
+// streamTicketTTL is how long a ticket can open a connection, it is asked for right before
+const streamTicketTTL = 30 * time.Second
+
+func (h *Handler) setupWebSocketRoutes(app *fiber.App) {
+	app.Use("/ws", wsAuth, h.ticketAuth)
+	app.Get("/ws", websocket.New(handleWebSocket))
+}
+
+func wsAuth(c *fiber.Ctx) error {
+	if !websocket.IsWebSocketUpgrade(c) {
+		return fiber.ErrUpgradeRequired
+	}
+
+	return c.Next()
+}
+
+// CreateStreamTicket returns a ticket opening one WebSocket or event stream of the user. Browsers
+// cannot set headers on them, the ticket is passed as ?ticket= so the access token never is.
+func (h *Handler) CreateStreamTicket(c *fiber.Ctx) error {
+	id, _ := strconv.Atoi(c.Locals("id").(string))
+	impersonator, _ := c.Locals("impersonator").(string)
+
+	token := util.RandomToken(32)
+	ticket := models.StreamTicket{
+		TokenHash:      util.HashToken(token),
+		UserID:         uint(id),
+		ImpersonatedBy: impersonator,
+		ExpiresAt:      time.Now().Add(streamTicketTTL),
+	}
+	if err := h.db(c).Create(&ticket).Error; err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+
+	return c.Status(fiber.StatusCreated).JSON(models.StreamTicketApi{Ticket: token, ExpiresAt: ticket.ExpiresAt})
+}
+
+// ticketAuth authenticates the request with the ?ticket= of CreateStreamTicket, spending it, or
+// like the private routes without one, e.g. with the cookie of the session
+func (h *Handler) ticketAuth(c *fiber.Ctx) error {
+	token := c.Query("ticket")
+	if token == "" {
+		return h.tokens.SecureAuth()(c)
+	}
+
+	var ticket models.StreamTicket
+	if err := h.db(c).Where("token_hash = ? AND expires_at > ?", util.HashToken(token), time.Now()).
+		Limit(1).Find(&ticket).Error; err != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+	// deleting it is what spends it, of two concurrent requests only one deletes the row
+	res := h.db(c).Where("token_hash = ?", ticket.TokenHash).Delete(&models.StreamTicket{})
+	if res.Error != nil {
+		return sendError(c, "Something went wrong, please try again later", fiber.StatusInternalServerError)
+	}
+	if ticket.TokenHash == "" || res.RowsAffected == 0 {
+		return sendError(c, "Invalid or used ticket", fiber.StatusUnauthorized)
+	}
+
+	c.Locals("id", strconv.Itoa(int(ticket.UserID)))
+	if ticket.ImpersonatedBy != "" {
+		c.Locals("impersonator", ticket.ImpersonatedBy)
+	}
+	return c.Next()
+}
+
+// handleWebSocket pushes the task and comment events of the user until the connection is closed.
+// Messages sent by the client are ignored.
+func handleWebSocket(conn *websocket.Conn) {
+	id, _ := strconv.Atoi(conn.Locals("id").(string))
+	client := realtime.DefaultHub.Register(uint(id))
+	defer realtime.DefaultHub.Unregister(client)
+
+	closed := make(chan struct{})
+	go func() {
+		defer close(closed)
+		for {
+			if _, _, err := conn.ReadMessage(); err != nil {
+				return
+			}
+		}
+	}()
+
+	ping := time.NewTicker(wsPingInterval)
+	defer ping.Stop()
+
+	for {
+		select {
+		case msg, ok := <-client.Send:
+			if !ok {
+				return
+			}
+			if err := conn.WriteJSON(msg); err != nil {
+				return
+			}
+		case <-ping.C:
+			if err := conn.WriteMessage(websocket.PingMessage, nil); err != nil {
+				return
+			}
+		case <-closed:
+			return
+		}
+	}
+}
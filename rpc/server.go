@@ -0,0 +1,129 @@
+// Package rpc serves the gRPC services of the tasks and users for the internal consumers.
+// They work on the same repositories and publish the same events as the REST routes.
+package rpc
+
+//go:generate protoc --go_out=. --go_opt=module=task-app/rpc --go-grpc_out=. --go-grpc_opt=module=task-app/rpc tasker.proto
+
+import (
+	"context"
+	"errors"
+	"github.com/golang-jwt/jwt/v5"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"net"
+	"strconv"
+	"strings"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"task-app/rpc/pb"
+	"task-app/util"
+	"time"
+)
+
+// Server is the gRPC server of the services
+type Server struct {
+	store  db.Store
+	users  repository.UserRepo
+	tasks  repository.TaskRepo
+	tokens *util.TokenService
+	grpc   *grpc.Server
+}
+
+type userKey struct{}
+
+func New(store db.Store, tokens *util.TokenService) *Server {
+	s := &Server{
+		store:  store,
+		users:  repository.NewUserRepo(store),
+		tasks:  repository.NewTaskRepo(store),
+		tokens: tokens,
+	}
+	s.grpc = grpc.NewServer(grpc.ChainUnaryInterceptor(logCalls, s.authenticate))
+	pb.RegisterTaskServiceServer(s.grpc, taskService{Server: s})
+	pb.RegisterUserServiceServer(s.grpc, userService{Server: s})
+
+	return s
+}
+
+// Serve accepts the connections of the address until Stop
+func (s *Server) Serve(addr string) error {
+	lis, err := net.Listen("tcp", addr)
+	if err != nil {
+		return err
+	}
+
+	return s.grpc.Serve(lis)
+}
+
+// Stop stops accepting connections and waits for the calls in flight
+func (s *Server) Stop() {
+	s.grpc.GracefulStop()
+}
+
+// authenticate finds the user of the access token of the metadata, as SecureAuth does for
+// the HTTP requests. The API keys are not accepted.
+func (s *Server) authenticate(ctx context.Context, req interface{}, _ *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	md, _ := metadata.FromIncomingContext(ctx)
+	values := md.Get("authorization")
+	if len(values) == 0 || !strings.HasPrefix(values[0], "Bearer ") {
+		return nil, status.Error(codes.Unauthenticated, "Missing access token")
+	}
+
+	claims, err := s.tokens.ParseAccessToken(strings.TrimPrefix(values[0], "Bearer "))
+	switch {
+	case errors.Is(err, jwt.ErrTokenExpired):
+		return nil, status.Error(codes.Unauthenticated, "Token Expired")
+	case err != nil:
+		return nil, status.Error(codes.Unauthenticated, "Invalid token")
+	}
+
+	id, _ := strconv.ParseUint(claims.Issuer, 10, 0)
+	u, err := s.users.ByID(uint(id))
+	if err != nil || u.Locked {
+		return nil, status.Error(codes.PermissionDenied, "Cannot find user by token")
+	}
+	if impersonator, err := strconv.Atoi(claims.ImpersonatedBy); err == nil {
+		u.ImpersonatorID = uint(impersonator)
+	}
+
+	ctx = repository.WithTenant(context.WithValue(ctx, userKey{}, u), u.ID)
+	return handler(ctx, req)
+}
+
+func currentUser(ctx context.Context) *models.User {
+	return ctx.Value(userKey{}).(*models.User)
+}
+
+// taskRepo returns the tasks with the context of the call, for its user
+func (s *Server) taskRepo(ctx context.Context) repository.TaskRepo {
+	return s.tasks.WithContext(ctx)
+}
+
+// logCalls logs the calls as the HTTP requests are logged
+func logCalls(ctx context.Context, req interface{}, info *grpc.UnaryServerInfo, handler grpc.UnaryHandler) (interface{}, error) {
+	start := time.Now()
+	resp, err := handler(ctx, req)
+
+	code := status.Code(err)
+	event := logging.Log.Info()
+	if code == codes.Internal || code == codes.Unknown {
+		event = logging.Log.Error().Err(err)
+	}
+	event.
+		Str("method", info.FullMethod).
+		Str("code", code.String()).
+		Dur("latency", time.Since(start)).
+		Msg("call")
+
+	return resp, err
+}
+
+// internalError logs an unexpected error and hides its details from the caller
+func internalError(err error) error {
+	logging.Log.Error().Err(err).Msg("Unexpected error")
+	return status.Error(codes.Internal, "Something went wrong, please try again later")
+}
@@ -0,0 +1,254 @@
+package rpc
+
+import (
+	"context"
+	"errors"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"google.golang.org/protobuf/types/known/timestamppb"
+	"sort"
+	"strings"
+	"task-app/events"
+	"task-app/models"
+	"task-app/quota"
+	"task-app/repository"
+	"task-app/rpc/pb"
+	"task-app/util"
+	"time"
+)
+
+type taskService struct {
+	pb.UnimplementedTaskServiceServer
+	*Server
+}
+
+var errTaskNotFound = status.Error(codes.NotFound, "Cannot find the Task")
+
+func (s taskService) ListTasks(ctx context.Context, req *pb.ListTasksRequest) (*pb.ListTasksResponse, error) {
+	u := currentUser(ctx)
+
+	filter := repository.TaskFilter{
+		WorkspaceID: optionalID(req.WorkspaceId),
+		ProjectID:   optionalID(req.ProjectId),
+		Labels:      req.Labels,
+		Sort:        req.Sort,
+	}
+	switch req.Filter {
+	case "assigned":
+		filter.AssigneeID = u.ID
+	case "created":
+		filter.CreatorID = u.ID
+	}
+
+	tasks, err := s.taskRepo(ctx).List(u, filter)
+	if err != nil {
+		return nil, internalError(err)
+	}
+
+	response := &pb.ListTasksResponse{Tasks: make([]*pb.Task, 0, len(tasks))}
+	for i := range tasks {
+		response.Tasks = append(response.Tasks, taskMessage(&tasks[i]))
+	}
+
+	return response, nil
+}
+
+func (s taskService) GetTask(ctx context.Context, req *pb.GetTaskRequest) (*pb.Task, error) {
+	task, err := s.taskRepo(ctx).Get(currentUser(ctx), uint(req.Id))
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	return taskMessage(task), nil
+}
+
+func (s taskService) CreateTask(ctx context.Context, req *pb.CreateTaskRequest) (*pb.Task, error) {
+	u := currentUser(ctx)
+
+	input := models.TaskInput{
+		Title:       req.Title,
+		Description: req.Description,
+		Status:      req.Status,
+		DueAt:       optionalTime(req.DueAt),
+		Recurrence:  req.Recurrence,
+		Priority:    int(req.Priority),
+		WorkspaceID: optionalID(req.WorkspaceId),
+		ProjectID:   optionalID(req.ProjectId),
+	}
+	if fields := util.Validate(&input); fields != nil {
+		return nil, validationError(fields)
+	}
+
+	projectID, workspaceID, err := s.taskRepo(ctx).Placement(u, input.ProjectID, input.WorkspaceID)
+	switch {
+	case errors.Is(err, repository.ErrNoPermission):
+		return nil, status.Error(codes.PermissionDenied, err.Error())
+	case err != nil:
+		return nil, status.Error(codes.NotFound, "Cannot find the Workspace")
+	}
+
+	task := models.Task{
+		Title:       input.Title,
+		Status:      input.Status,
+		Description: input.Description,
+		DueAt:       input.DueAt,
+		Recurrence:  input.Recurrence,
+		Priority:    input.Priority,
+		UserID:      u.ID,
+		ProjectID:   projectID,
+		WorkspaceID: workspaceID,
+	}
+	if err := s.taskRepo(ctx).Create(&task); err != nil {
+		var exceeded *quota.ExceededError
+		if errors.As(err, &exceeded) {
+			return nil, status.Error(codes.ResourceExhausted, exceeded.Error())
+		}
+		return nil, internalError(err)
+	}
+
+	events.Publish(taskEvent(events.TaskCreated, u, &task))
+
+	return taskMessage(&task), nil
+}
+
+func (s taskService) CompleteTask(ctx context.Context, req *pb.CompleteTaskRequest) (*pb.Task, error) {
+	u := currentUser(ctx)
+
+	task, err := s.taskRepo(ctx).Get(u, uint(req.Id), models.WorkspaceWriters...)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	if task.Status != models.StatusDone {
+		from := task.Status
+		task.SetStatus(models.StatusDone)
+		if err := s.taskRepo(ctx).Save(task); err != nil {
+			return nil, taskError(err)
+		}
+
+		updated := taskEvent(events.TaskUpdated, u, task)
+		updated.Changes = map[string]events.Change{"status": {From: from, To: task.Status}}
+		events.Publish(updated)
+		events.Publish(taskEvent(events.TaskCompleted, u, task))
+	}
+
+	return taskMessage(task), nil
+}
+
+func (s taskService) DeleteTask(ctx context.Context, req *pb.DeleteTaskRequest) (*emptypb.Empty, error) {
+	u := currentUser(ctx)
+
+	task, err := s.taskRepo(ctx).Get(u, uint(req.Id), models.WorkspaceWriters...)
+	if err != nil {
+		return nil, taskError(err)
+	}
+
+	if err := s.taskRepo(ctx).Delete(task); err != nil {
+		return nil, internalError(err)
+	}
+
+	e := taskEvent(events.TaskDeleted, u, task)
+	e.Payload = nil
+	events.Publish(e)
+
+	return &emptypb.Empty{}, nil
+}
+
+func taskError(err error) error {
+	if errors.Is(err, repository.ErrNotFound) {
+		return errTaskNotFound
+	}
+	if errors.Is(err, repository.ErrConflict) {
+		// the conventional code of a concurrency conflict, the client retries from a new read
+		return status.Error(codes.Aborted, "The task was changed concurrently, try again")
+	}
+
+	return internalError(err)
+}
+
+// validationError lists the errors of the fields in the message, by field
+func validationError(fields map[string]string) error {
+	errs := make([]string, 0, len(fields))
+	for field, msg := range fields {
+		errs = append(errs, field+": "+msg)
+	}
+	sort.Strings(errs)
+
+	return status.Error(codes.InvalidArgument, "Please review your input: "+strings.Join(errs, "; "))
+}
+
+// taskEvent returns an event about the task, targeting the task itself
+func taskEvent(kind string, actor *models.User, task *models.Task) events.Event {
+	return events.Event{
+		Type:           kind,
+		ActorID:        actor.ID,
+		ImpersonatorID: actor.ImpersonatorID,
+		TaskID:         task.ID,
+		TargetID:       task.ID,
+		OwnerID:        task.UserID,
+		WorkspaceID:    task.WorkspaceID,
+		Payload:        task.Api(),
+	}
+}
+
+func taskMessage(t *models.Task) *pb.Task {
+	labels := make([]*pb.Label, 0, len(t.Labels))
+	for _, l := range t.Labels {
+		labels = append(labels, &pb.Label{Id: uint64(l.ID), Name: l.Name, Color: l.Color})
+	}
+
+	return &pb.Task{
+		Id:          uint64(t.ID),
+		Title:       t.Title,
+		Description: t.Description,
+		Status:      t.Status,
+		Priority:    int32(t.Priority),
+		DueAt:       timestamp(t.DueAt),
+		CompletedAt: timestamp(t.CompletedAt),
+		Recurrence:  t.Recurrence,
+		Position:    int32(t.Position),
+		CreatorId:   uint64(t.UserID),
+		WorkspaceId: messageID(t.WorkspaceID),
+		ProjectId:   messageID(t.ProjectID),
+		AssigneeId:  messageID(t.AssigneeID),
+		Labels:      labels,
+		CreatedAt:   timestamppb.New(t.CreatedAt),
+		UpdatedAt:   timestamppb.New(t.UpdatedAt),
+	}
+}
+
+func timestamp(t *time.Time) *timestamppb.Timestamp {
+	if t == nil {
+		return nil
+	}
+
+	return timestamppb.New(*t)
+}
+
+func optionalTime(ts *timestamppb.Timestamp) *time.Time {
+	if ts == nil {
+		return nil
+	}
+
+	t := ts.AsTime()
+	return &t
+}
+
+func messageID(id *uint) *uint64 {
+	if id == nil {
+		return nil
+	}
+
+	n := uint64(*id)
+	return &n
+}
+
+func optionalID(id *uint64) *uint {
+	if id == nil {
+		return nil
+	}
+
+	n := uint(*id)
+	return &n
+}
@@ -0,0 +1,54 @@
+package rpc
+
+import (
+	"context"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+	"google.golang.org/protobuf/types/known/emptypb"
+	"task-app/models"
+	"task-app/rpc/pb"
+)
+
+type userService struct {
+	pb.UnimplementedUserServiceServer
+	*Server
+}
+
+func (s userService) GetCurrentUser(ctx context.Context, _ *emptypb.Empty) (*pb.User, error) {
+	u := currentUser(ctx)
+
+	return &pb.User{
+		Id:          uint64(u.ID),
+		Username:    u.Username,
+		DisplayName: u.DisplayName,
+		Email:       u.Email,
+	}, nil
+}
+
+// GetUser returns a user sharing a workspace with the user of the token, or that user itself
+func (s userService) GetUser(ctx context.Context, req *pb.GetUserRequest) (*pb.User, error) {
+	u := currentUser(ctx)
+	if uint(req.Id) == u.ID {
+		return s.GetCurrentUser(ctx, nil)
+	}
+
+	var shared int64
+	if err := s.store.DB().Model(&models.Membership{}).
+		Where("user_id = ? AND workspace_id IN (?)", req.Id,
+			s.store.DB().Model(&models.Membership{}).Select("workspace_id").Where("user_id = ?", u.ID),
+		).
+		Count(&shared).Error; err != nil {
+		return nil, internalError(err)
+	}
+
+	other, err := s.users.ByID(uint(req.Id))
+	if shared == 0 || err != nil {
+		return nil, status.Error(codes.NotFound, "Cannot find the User")
+	}
+
+	return &pb.User{
+		Id:          uint64(other.ID),
+		Username:    other.Username,
+		DisplayName: other.DisplayName,
+	}, nil
+}
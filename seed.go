@@ -0,0 +1,60 @@
+package main
+
+import (
+	"fmt"
+	"github.com/spf13/cobra"
+	"task-app/config"
+	"task-app/db"
+	"task-app/encryption"
+	"task-app/fixtures"
+	"time"
+)
+
+// seedCommand is the seed command: it migrates the database and fills it with fake users, workspaces,
+// projects and tasks. The same --seed makes the same data, the users log in with the --password.
+func seedCommand() *cobra.Command {
+	var file string
+	opts := fixtures.Options{}
+	cmd := &cobra.Command{
+		Use:   "seed",
+		Short: "Fill the database with fake data",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if opts.Users < 1 || opts.Tasks < 0 {
+				return fmt.Errorf("--users must be positive and --tasks cannot be negative")
+			}
+
+			return withDB(file, func(cfg *config.Config) error {
+				if err := db.MigrateUp(); err != nil {
+					return err
+				}
+				// the fake content is encrypted as the one of the server
+				keyring, err := encryption.New(db.DB, cfg.Encryption)
+				if err != nil {
+					return err
+				}
+				if err := keyring.Register(db.DB); err != nil {
+					return err
+				}
+
+				start := time.Now()
+				summary, err := fixtures.Seed(db.DB, opts)
+				if err != nil {
+					return err
+				}
+
+				fmt.Printf("Created %d users, %d workspaces, %d projects, %d tasks and %d comments in %s\n",
+					len(summary.Users), summary.Workspaces, summary.Projects, summary.Tasks, summary.Comments, time.Since(start).Round(time.Millisecond))
+				fmt.Printf("Log in as %s with the password %s\n", summary.Users[0], opts.Password)
+				return nil
+			})
+		},
+	}
+	cmd.Flags().IntVar(&opts.Users, "users", 20, "how many users to create")
+	cmd.Flags().IntVar(&opts.Tasks, "tasks", 5000, "how many tasks to create, spread over the projects of the users")
+	cmd.Flags().Int64Var(&opts.Seed, "seed", 1, "the seed of the fake data")
+	cmd.Flags().StringVar(&opts.Password, "password", fixtures.DefaultPassword, "the password of the users")
+	configFlag(cmd, &file)
+
+	return cmd
+}
@@ -0,0 +1,246 @@
+// Package slack is the Slack integration: the OAuth install of the app in a workspace,
+// the /tasker slash command and the messages posted to the channel of the workspace.
+package slack
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"sync"
+	"task-app/config"
+	"task-app/db"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/oauth"
+	"time"
+)
+
+// Scopes are the permissions the app asks on install
+var Scopes = []string{"commands", "incoming-webhook", "users:read", "users:read.email"}
+
+const (
+	authorizeURL = "https://slack.com/oauth/v2/authorize"
+	// maxClockSkew is how old a signed request of Slack can be, against replays
+	maxClockSkew = 5 * time.Minute
+
+	SignatureHeader = "X-Slack-Signature"
+	TimestampHeader = "X-Slack-Request-Timestamp"
+)
+
+// apiURL is the Web API, the method is appended
+var apiURL = "https://slack.com/api/"
+
+var client = &http.Client{Timeout: 10 * time.Second}
+
+var inflight sync.WaitGroup
+
+// Installation is the result of the OAuth install
+type Installation struct {
+	TeamID      string
+	TeamName    string
+	BotToken    string
+	ChannelID   string
+	ChannelName string
+	WebhookURL  string
+}
+
+// RedirectURI returns the callback url registered for the app
+func RedirectURI() string {
+	return oauth.RedirectBase + "/api/v1/integrations/slack/callback"
+}
+
+// AuthorizeURL returns the page of Slack installing the app, and choosing its channel
+func AuthorizeURL(cfg config.Slack, state string) string {
+	q := url.Values{}
+	q.Set("client_id", cfg.ClientID)
+	q.Set("scope", strings.Join(Scopes, ","))
+	q.Set("redirect_uri", RedirectURI())
+	q.Set("state", state)
+
+	return authorizeURL + "?" + q.Encode()
+}
+
+// Exchange trades the code of the install for the tokens of the team
+func Exchange(cfg config.Slack, code string) (*Installation, error) {
+	form := url.Values{}
+	form.Set("code", code)
+	form.Set("redirect_uri", RedirectURI())
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", cfg.ClientSecret)
+
+	var res struct {
+		AccessToken string `json:"access_token"`
+		Team        struct {
+			ID   string `json:"id"`
+			Name string `json:"name"`
+		} `json:"team"`
+		IncomingWebhook struct {
+			Channel   string `json:"channel"`
+			ChannelID string `json:"channel_id"`
+			URL       string `json:"url"`
+		} `json:"incoming_webhook"`
+	}
+	if err := call("oauth.v2.access", "", form, &res); err != nil {
+		return nil, err
+	}
+
+	return &Installation{
+		TeamID:      res.Team.ID,
+		TeamName:    res.Team.Name,
+		BotToken:    res.AccessToken,
+		ChannelID:   res.IncomingWebhook.ChannelID,
+		ChannelName: res.IncomingWebhook.Channel,
+		WebhookURL:  res.IncomingWebhook.URL,
+	}, nil
+}
+
+// Revoke revokes the bot token of an uninstalled team
+func Revoke(botToken string) error {
+	return call("auth.revoke", botToken, url.Values{}, nil)
+}
+
+// UserEmail returns the email of a Slack user, it finds the member of the workspace running a command
+func UserEmail(botToken, userID string) (string, error) {
+	var res struct {
+		User struct {
+			Profile struct {
+				Email string `json:"email"`
+			} `json:"profile"`
+		} `json:"user"`
+	}
+	if err := call("users.info", botToken, url.Values{"user": {userID}}, &res); err != nil {
+		return "", err
+	}
+
+	return res.User.Profile.Email, nil
+}
+
+// call posts the form to a method of the Web API, authenticated with the token when not empty
+func call(method, token string, form url.Values, out interface{}) error {
+	req, err := http.NewRequest(http.MethodPost, apiURL+method, strings.NewReader(form.Encode()))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	if token != "" {
+		req.Header.Set("Authorization", "Bearer "+token)
+	}
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// every response of the Web API has ok, and error when it failed
+	var body json.RawMessage
+	if err := json.NewDecoder(res.Body).Decode(&body); err != nil {
+		return err
+	}
+	var status struct {
+		OK    bool   `json:"ok"`
+		Error string `json:"error"`
+	}
+	if err := json.Unmarshal(body, &status); err != nil {
+		return err
+	}
+	if !status.OK {
+		return errors.New("slack: " + method + ": " + status.Error)
+	}
+	if out == nil {
+		return nil
+	}
+
+	return json.Unmarshal(body, out)
+}
+
+// Verify checks a request was signed by Slack with the signing secret, recently
+func Verify(signingSecret, timestamp, signature string, body []byte) error {
+	ts, err := strconv.ParseInt(timestamp, 10, 64)
+	if err != nil {
+		return errors.New("slack: invalid timestamp")
+	}
+	if age := time.Since(time.Unix(ts, 0)); age > maxClockSkew || age < -maxClockSkew {
+		return errors.New("slack: the request is too old")
+	}
+
+	mac := hmac.New(sha256.New, []byte(signingSecret))
+	mac.Write([]byte("v0:" + timestamp + ":"))
+	mac.Write(body)
+	if !hmac.Equal([]byte(signature), []byte("v0="+hex.EncodeToString(mac.Sum(nil)))) {
+		return errors.New("slack: invalid signature")
+	}
+
+	return nil
+}
+
+// Dispatch posts the tasks completed in a workspace to the Slack channel of the workspace.
+// The message is posted in the background, so it never slows down the request.
+func Dispatch(e events.Event) {
+	if e.Type != events.TaskCompleted || e.WorkspaceID == nil {
+		return
+	}
+
+	task, ok := e.Payload.(models.TaskApi)
+	if !ok {
+		return
+	}
+
+	inflight.Add(1)
+	go func() {
+		defer inflight.Done()
+
+		installation := new(models.SlackInstallation)
+		if res := db.DB.Where("workspace_id = ?", *e.WorkspaceID).Limit(1).Find(installation); res.Error != nil || res.RowsAffected == 0 {
+			return
+		}
+
+		actor := "Someone"
+		u := new(models.User)
+		if err := db.DB.First(u, e.ActorID).Error; err == nil {
+			actor = u.Username
+		}
+
+		if err := post(installation.WebhookURL, ":white_check_mark: "+actor+" completed *"+Escape(task.Title)+"*"); err != nil {
+			logging.Log.Error().Err(err).Uint("workspace", *e.WorkspaceID).Uint("task", e.TaskID).Msg("Cannot post to Slack")
+		}
+	}()
+}
+
+// Stop waits for the messages being posted
+func Stop() {
+	inflight.Wait()
+}
+
+// post sends a message to an incoming webhook
+func post(webhookURL, text string) error {
+	body, err := json.Marshal(map[string]string{"text": text})
+	if err != nil {
+		return err
+	}
+
+	res, err := client.Post(webhookURL, "application/json", bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	res.Body.Close()
+
+	if res.StatusCode >= 300 {
+		return errors.New("slack: the webhook responded " + res.Status)
+	}
+
+	return nil
+}
+
+// Escape escapes the control characters of the Slack messages
+func Escape(text string) string {
+	return strings.NewReplacer("&", "&amp;", "<", "&lt;", ">", "&gt;").Replace(text)
+}
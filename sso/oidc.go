@@ -0,0 +1,265 @@
+package sso
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io"
+	"io/ioutil"
+	"math/big"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"task-app/models"
+	"time"
+)
+
+// discoveryTTL is how long the discovery document and the keys of an issuer are kept, the keys
+// are fetched again sooner when a token is signed by a key not known yet
+const discoveryTTL = time.Hour
+
+// idTokenMethods are the algorithms an ID token may be signed with, never none nor a HMAC
+var idTokenMethods = []string{"RS256", "RS384", "RS512", "PS256", "PS384", "PS512", "ES256", "ES384", "ES512"}
+
+// issuer is the discovery document of an OIDC issuer with its signing keys
+type issuer struct {
+	Issuer   string `json:"issuer"`
+	AuthURL  string `json:"authorization_endpoint"`
+	TokenURL string `json:"token_endpoint"`
+	JWKSURL  string `json:"jwks_uri"`
+
+	keys    map[string]interface{}
+	fetched time.Time
+}
+
+var (
+	issuersMu sync.Mutex
+	issuers   = map[string]*issuer{}
+)
+
+// CheckIssuer fetches the discovery document of the issuer, to check an issuer before it is saved
+func CheckIssuer(ctx context.Context, url string) error {
+	_, err := discover(ctx, url, false)
+	return err
+}
+
+// AuthURL returns the authorization page of the issuer of the config the user is redirected to
+func AuthURL(ctx context.Context, cfg *models.WorkspaceSSO, redirectURI, state, nonce string) (string, error) {
+	iss, err := discover(ctx, cfg.Issuer, false)
+	if err != nil {
+		return "", err
+	}
+
+	q := url.Values{}
+	q.Set("client_id", cfg.ClientID)
+	q.Set("redirect_uri", redirectURI)
+	q.Set("response_type", "code")
+	q.Set("scope", "openid email profile")
+	q.Set("state", state)
+	q.Set("nonce", nonce)
+
+	sep := "?"
+	if strings.Contains(iss.AuthURL, "?") {
+		sep = "&"
+	}
+	return iss.AuthURL + sep + q.Encode(), nil
+}
+
+// OIDCIdentity trades the code for the ID token of the user, and returns the identity of its
+// claims. The token must be signed by the issuer for the client, with the nonce of the login.
+func OIDCIdentity(ctx context.Context, cfg *models.WorkspaceSSO, redirectURI, code, nonce string) (*Identity, error) {
+	iss, err := discover(ctx, cfg.Issuer, false)
+	if err != nil {
+		return nil, err
+	}
+
+	form := url.Values{}
+	form.Set("grant_type", "authorization_code")
+	form.Set("code", code)
+	form.Set("redirect_uri", redirectURI)
+	form.Set("client_id", cfg.ClientID)
+	form.Set("client_secret", cfg.ClientSecret)
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, iss.TokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+
+	var token struct {
+		IDToken string `json:"id_token"`
+		Error   string `json:"error"`
+	}
+	if err := getJSON(req, &token); err != nil {
+		return nil, err
+	}
+	if token.IDToken == "" {
+		return nil, fmt.Errorf("sso: the code was refused: %s", token.Error)
+	}
+
+	claims := jwt.MapClaims{}
+	_, err = jwt.ParseWithClaims(token.IDToken, claims, func(t *jwt.Token) (interface{}, error) {
+		kid, _ := t.Header["kid"].(string)
+		return iss.key(ctx, kid)
+	}, jwt.WithValidMethods(idTokenMethods), jwt.WithIssuer(iss.Issuer), jwt.WithAudience(cfg.ClientID),
+		jwt.WithExpirationRequired(), jwt.WithLeeway(skew))
+	if err != nil {
+		return nil, fmt.Errorf("sso: invalid ID token: %w", err)
+	}
+	if got, _ := claims["nonce"].(string); got == "" || got != nonce {
+		return nil, errors.New("sso: the ID token is not the one of the login")
+	}
+
+	subject, _ := claims["sub"].(string)
+	return identity(cfg, subject, func(name string) string {
+		if name == "email" {
+			// an email the issuer did not verify would let anyone claim an address
+			if verified, ok := claims["email_verified"].(bool); ok && !verified {
+				return ""
+			}
+		}
+		s, _ := claims[name].(string)
+		return s
+	})
+}
+
+// discover returns the issuer of the URL, fetched again when it is older than the discoveryTTL
+// or when refresh is set
+func discover(ctx context.Context, rawURL string, refresh bool) (*issuer, error) {
+	rawURL = strings.TrimRight(rawURL, "/")
+	issuersMu.Lock()
+	cached := issuers[rawURL]
+	issuersMu.Unlock()
+	if cached != nil && !refresh && time.Since(cached.fetched) < discoveryTTL {
+		return cached, nil
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, rawURL+"/.well-known/openid-configuration", nil)
+	if err != nil {
+		return nil, err
+	}
+	iss := new(issuer)
+	if err := getJSON(req, iss); err != nil {
+		return nil, err
+	}
+	if strings.TrimRight(iss.Issuer, "/") != rawURL {
+		return nil, fmt.Errorf("sso: the discovery document is of the issuer %s", iss.Issuer)
+	}
+	if iss.AuthURL == "" || iss.TokenURL == "" || iss.JWKSURL == "" {
+		return nil, errors.New("sso: the discovery document has no authorization_endpoint, token_endpoint or jwks_uri")
+	}
+
+	if iss.keys, err = fetchKeys(ctx, iss.JWKSURL); err != nil {
+		return nil, err
+	}
+	iss.fetched = time.Now()
+
+	issuersMu.Lock()
+	issuers[rawURL] = iss
+	issuersMu.Unlock()
+
+	return iss, nil
+}
+
+// key returns the signing key of the id, the keys are fetched again once for an id not known
+// as the issuer may have rotated them
+func (iss *issuer) key(ctx context.Context, kid string) (interface{}, error) {
+	if k, ok := iss.keys[kid]; ok {
+		return k, nil
+	}
+
+	fresh, err := discover(ctx, iss.Issuer, true)
+	if err != nil {
+		return nil, err
+	}
+	if k, ok := fresh.keys[kid]; ok {
+		return k, nil
+	}
+
+	return nil, fmt.Errorf("sso: unknown signing key %q", kid)
+}
+
+// fetchKeys returns the public keys of the JWKS by their id, the RSA and EC keys signing tokens
+func fetchKeys(ctx context.Context, jwksURL string) (map[string]interface{}, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, jwksURL, nil)
+	if err != nil {
+		return nil, err
+	}
+
+	var set struct {
+		Keys []struct {
+			Kid string `json:"kid"`
+			Kty string `json:"kty"`
+			Use string `json:"use"`
+			N   string `json:"n"`
+			E   string `json:"e"`
+			Crv string `json:"crv"`
+			X   string `json:"x"`
+			Y   string `json:"y"`
+		} `json:"keys"`
+	}
+	if err := getJSON(req, &set); err != nil {
+		return nil, err
+	}
+
+	keys := make(map[string]interface{}, len(set.Keys))
+	for _, k := range set.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		switch k.Kty {
+		case "RSA":
+			n, e := decodeInt(k.N), decodeInt(k.E)
+			if n == nil || e == nil || !e.IsInt64() {
+				continue
+			}
+			keys[k.Kid] = &rsa.PublicKey{N: n, E: int(e.Int64())}
+		case "EC":
+			curves := map[string]elliptic.Curve{"P-256": elliptic.P256(), "P-384": elliptic.P384(), "P-521": elliptic.P521()}
+			curve, ok := curves[k.Crv]
+			x, y := decodeInt(k.X), decodeInt(k.Y)
+			if !ok || x == nil || y == nil || !curve.IsOnCurve(x, y) {
+				continue
+			}
+			keys[k.Kid] = &ecdsa.PublicKey{Curve: curve, X: x, Y: y}
+		}
+	}
+	if len(keys) == 0 {
+		return nil, errors.New("sso: the JWKS of the issuer has no signing key")
+	}
+
+	return keys, nil
+}
+
+func decodeInt(s string) *big.Int {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil
+	}
+
+	return new(big.Int).SetBytes(b)
+}
+
+func getJSON(req *http.Request, out interface{}) error {
+	req.Header.Set("Accept", "application/json")
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	// the token endpoint answers its errors as 400 with an error field
+	if res.StatusCode >= 300 && res.StatusCode != http.StatusBadRequest {
+		body, _ := ioutil.ReadAll(io.LimitReader(res.Body, 1024))
+		return errors.New("sso: " + req.URL.Host + " responded " + res.Status + ": " + string(body))
+	}
+
+	return json.NewDecoder(res.Body).Decode(out)
+}
@@ -0,0 +1,293 @@
+package sso
+
+import (
+	"bytes"
+	"compress/flate"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"github.com/beevik/etree"
+	dsig "github.com/russellhaering/goxmldsig"
+	"github.com/russellhaering/goxmldsig/etreeutils"
+	"net/url"
+	"strings"
+	"task-app/models"
+	"task-app/util"
+	"time"
+)
+
+// The namespaces of the SAML protocol and assertions
+const (
+	samlProtocol  = "urn:oasis:names:tc:SAML:2.0:protocol"
+	samlAssertion = "urn:oasis:names:tc:SAML:2.0:assertion"
+	samlMetadata  = "urn:oasis:names:tc:SAML:2.0:metadata"
+	samlSuccess   = "urn:oasis:names:tc:SAML:2.0:status:Success"
+	samlPOST      = "urn:oasis:names:tc:SAML:2.0:bindings:HTTP-POST"
+	samlNameID    = "urn:oasis:names:tc:SAML:1.1:nameid-format:unspecified"
+)
+
+// CheckCertificate tells whether the PEM is the certificate of an IdP, to check it before it
+// is saved
+func CheckCertificate(certPEM string) error {
+	_, err := parseCertificate(certPEM)
+	return err
+}
+
+// AuthnRequest returns the id of a new authentication request of the server, the entity id,
+// and the page of the IdP the user is redirected to with it (the HTTP-Redirect binding). The
+// state comes back with the response of the IdP as its RelayState.
+func AuthnRequest(cfg *models.WorkspaceSSO, entityID, acsURL, state string) (id, redirectURL string, err error) {
+	id = "_" + util.RandomToken(20)
+
+	doc := etree.NewDocument()
+	req := doc.CreateElement("samlp:AuthnRequest")
+	req.CreateAttr("xmlns:samlp", samlProtocol)
+	req.CreateAttr("xmlns:saml", samlAssertion)
+	req.CreateAttr("ID", id)
+	req.CreateAttr("Version", "2.0")
+	req.CreateAttr("IssueInstant", time.Now().UTC().Format(time.RFC3339))
+	req.CreateAttr("Destination", cfg.IdPSSOURL)
+	req.CreateAttr("AssertionConsumerServiceURL", acsURL)
+	req.CreateAttr("ProtocolBinding", samlPOST)
+	req.CreateElement("saml:Issuer").SetText(entityID)
+	policy := req.CreateElement("samlp:NameIDPolicy")
+	policy.CreateAttr("Format", samlNameID)
+	policy.CreateAttr("AllowCreate", "true")
+
+	raw, err := doc.WriteToBytes()
+	if err != nil {
+		return "", "", err
+	}
+	var deflated bytes.Buffer
+	w, _ := flate.NewWriter(&deflated, flate.BestCompression)
+	if _, err := w.Write(raw); err != nil {
+		return "", "", err
+	}
+	if err := w.Close(); err != nil {
+		return "", "", err
+	}
+
+	q := url.Values{}
+	q.Set("SAMLRequest", base64.StdEncoding.EncodeToString(deflated.Bytes()))
+	q.Set("RelayState", state)
+
+	sep := "?"
+	if strings.Contains(cfg.IdPSSOURL, "?") {
+		sep = "&"
+	}
+	return id, cfg.IdPSSOURL + sep + q.Encode(), nil
+}
+
+// SAMLIdentity verifies the response the IdP posted to the ACS, and returns the identity of its
+// assertion. The response or the assertion must be signed by the certificate of the IdP, only
+// what is signed is read. The assertion must be for the server, answer the request of the id,
+// and be valid now.
+func SAMLIdentity(cfg *models.WorkspaceSSO, samlResponse, entityID, acsURL, requestID string) (*Identity, error) {
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(samlResponse))
+	if err != nil {
+		return nil, errors.New("sso: the SAML response is not base64")
+	}
+	doc := etree.NewDocument()
+	if err := doc.ReadFromBytes(raw); err != nil {
+		return nil, fmt.Errorf("sso: invalid SAML response: %w", err)
+	}
+	res := doc.Root()
+	if res == nil || res.Tag != "Response" || res.NamespaceURI() != samlProtocol {
+		return nil, errors.New("sso: the SAML response has no Response")
+	}
+
+	cert, err := parseCertificate(cfg.IdPCertificate)
+	if err != nil {
+		return nil, err
+	}
+	validator := dsig.NewDefaultValidationContext(&dsig.MemoryX509CertificateStore{Roots: []*x509.Certificate{cert}})
+
+	signed := false
+	if validated, err := validator.Validate(res); err == nil {
+		res, signed = validated, true
+	} else if err != dsig.ErrMissingSignature {
+		return nil, fmt.Errorf("sso: invalid signature of the SAML response: %w", err)
+	}
+
+	if status := child(child(res, samlProtocol, "Status"), samlProtocol, "StatusCode"); status == nil ||
+		status.SelectAttrValue("Value", "") != samlSuccess {
+		return nil, errors.New("sso: the IdP did not sign the user in")
+	}
+	if to := res.SelectAttrValue("InResponseTo", ""); to != "" && to != requestID {
+		return nil, errors.New("sso: the SAML response is not the one of the login")
+	}
+	if len(children(res, samlAssertion, "EncryptedAssertion")) > 0 {
+		return nil, errors.New("sso: encrypted assertions are not supported")
+	}
+	assertions := children(res, samlAssertion, "Assertion")
+	if len(assertions) != 1 {
+		return nil, errors.New("sso: the SAML response must have one assertion")
+	}
+	assertion := assertions[0]
+
+	if !signed {
+		// the assertion is detached from the response with the namespaces it declares, for
+		// its signature to be checked on its own
+		ns, err := etreeutils.NSBuildParentContext(assertion)
+		if err != nil {
+			return nil, err
+		}
+		detached, err := etreeutils.NSDetatch(ns, assertion)
+		if err != nil {
+			return nil, err
+		}
+		if assertion, err = validator.Validate(detached); err != nil {
+			return nil, fmt.Errorf("sso: the SAML response and assertion are not signed: %w", err)
+		}
+	}
+
+	if issuer := child(assertion, samlAssertion, "Issuer"); issuer == nil || strings.TrimSpace(issuer.Text()) != cfg.IdPEntityID {
+		return nil, errors.New("sso: the assertion is not of the IdP")
+	}
+	if err := checkConditions(child(assertion, samlAssertion, "Conditions"), entityID, time.Now()); err != nil {
+		return nil, err
+	}
+
+	subject := child(assertion, samlAssertion, "Subject")
+	if err := checkConfirmation(subject, acsURL, requestID, time.Now()); err != nil {
+		return nil, err
+	}
+	nameID := ""
+	if el := child(subject, samlAssertion, "NameID"); el != nil {
+		nameID = strings.TrimSpace(el.Text())
+	}
+
+	attributes := map[string]string{}
+	for _, statement := range children(assertion, samlAssertion, "AttributeStatement") {
+		for _, attr := range children(statement, samlAssertion, "Attribute") {
+			value := child(attr, samlAssertion, "AttributeValue")
+			if value == nil {
+				continue
+			}
+			for _, name := range []string{attr.SelectAttrValue("Name", ""), attr.SelectAttrValue("FriendlyName", "")} {
+				if _, ok := attributes[name]; name != "" && !ok {
+					attributes[name] = value.Text()
+				}
+			}
+		}
+	}
+
+	return identity(cfg, nameID, func(name string) string {
+		return attributes[name]
+	})
+}
+
+// Metadata returns the metadata of the server as a service provider, which configures it in the IdP
+func Metadata(entityID, acsURL string) ([]byte, error) {
+	doc := etree.NewDocument()
+	doc.CreateProcInst("xml", `version="1.0" encoding="UTF-8"`)
+	desc := doc.CreateElement("md:EntityDescriptor")
+	desc.CreateAttr("xmlns:md", samlMetadata)
+	desc.CreateAttr("entityID", entityID)
+
+	sp := desc.CreateElement("md:SPSSODescriptor")
+	sp.CreateAttr("AuthnRequestsSigned", "false")
+	sp.CreateAttr("WantAssertionsSigned", "true")
+	sp.CreateAttr("protocolSupportEnumeration", samlProtocol)
+	sp.CreateElement("md:NameIDFormat").SetText(samlNameID)
+	acs := sp.CreateElement("md:AssertionConsumerService")
+	acs.CreateAttr("Binding", samlPOST)
+	acs.CreateAttr("Location", acsURL)
+	acs.CreateAttr("index", "0")
+	acs.CreateAttr("isDefault", "true")
+
+	doc.Indent(2)
+	return doc.WriteToBytes()
+}
+
+// checkConditions checks the assertion is valid now and meant for the server
+func checkConditions(conditions *etree.Element, entityID string, now time.Time) error {
+	if conditions == nil {
+		return errors.New("sso: the assertion has no conditions")
+	}
+	if err := checkWindow(conditions, now); err != nil {
+		return err
+	}
+
+	for _, restriction := range children(conditions, samlAssertion, "AudienceRestriction") {
+		for _, audience := range children(restriction, samlAssertion, "Audience") {
+			if strings.TrimSpace(audience.Text()) == entityID {
+				return nil
+			}
+		}
+	}
+
+	return errors.New("sso: the assertion is not meant for the server")
+}
+
+// checkConfirmation checks the bearer confirmation of the subject was sent to the ACS for the
+// request, and is not expired
+func checkConfirmation(subject *etree.Element, acsURL, requestID string, now time.Time) error {
+	for _, confirmation := range children(subject, samlAssertion, "SubjectConfirmation") {
+		data := child(confirmation, samlAssertion, "SubjectConfirmationData")
+		if data == nil || confirmation.SelectAttrValue("Method", "") != "urn:oasis:names:tc:SAML:2.0:cm:bearer" {
+			continue
+		}
+		if data.SelectAttrValue("Recipient", "") != acsURL || data.SelectAttrValue("InResponseTo", "") != requestID {
+			continue
+		}
+		if err := checkWindow(data, now); err != nil {
+			return err
+		}
+		return nil
+	}
+
+	return errors.New("sso: the assertion is not the one of the login")
+}
+
+// checkWindow checks now is between the NotBefore and the NotOnOrAfter of the element, with the skew
+func checkWindow(el *etree.Element, now time.Time) error {
+	if s := el.SelectAttrValue("NotBefore", ""); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil || now.Add(skew).Before(t) {
+			return errors.New("sso: the assertion is not valid yet")
+		}
+	}
+	if s := el.SelectAttrValue("NotOnOrAfter", ""); s != "" {
+		t, err := time.Parse(time.RFC3339, s)
+		if err != nil || !now.Add(-skew).Before(t) {
+			return errors.New("sso: the assertion has expired")
+		}
+	}
+
+	return nil
+}
+
+func parseCertificate(certPEM string) (*x509.Certificate, error) {
+	block, _ := pem.Decode([]byte(strings.TrimSpace(certPEM)))
+	if block == nil || block.Type != "CERTIFICATE" {
+		return nil, errors.New("sso: the certificate of the IdP is not a PEM certificate")
+	}
+
+	return x509.ParseCertificate(block.Bytes)
+}
+
+// children returns the child elements of the tag in the namespace, whichever prefix it has
+func children(el *etree.Element, ns, tag string) []*etree.Element {
+	if el == nil {
+		return nil
+	}
+	var found []*etree.Element
+	for _, c := range el.ChildElements() {
+		if c.Tag == tag && c.NamespaceURI() == ns {
+			found = append(found, c)
+		}
+	}
+
+	return found
+}
+
+func child(el *etree.Element, ns, tag string) *etree.Element {
+	if found := children(el, ns, tag); len(found) > 0 {
+		return found[0]
+	}
+
+	return nil
+}
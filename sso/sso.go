@@ -0,0 +1,53 @@
+// Package sso signs the members of a workspace in with the identity provider of the workspace,
+// an OpenID Connect issuer or a SAML 2.0 IdP. The login starts with a redirect to the provider,
+// which sends the user back with what it vouches for: a code traded for an ID token by OIDC, a
+// signed assertion by SAML. Either is verified here and read into an Identity.
+package sso
+
+import (
+	"errors"
+	"strings"
+	"task-app/models"
+	"task-app/webhooks"
+	"time"
+)
+
+// skew is the difference of the clocks of the server and the provider which is tolerated
+const skew = 2 * time.Minute
+
+// client fetches the documents and the tokens of the issuers. A workspace owner chooses the
+// issuer, so it only reaches public addresses like the webhooks.
+var client = webhooks.Client
+
+// ErrNoEmail is returned for an identity without the email attribute of the mapping
+var ErrNoEmail = errors.New("sso: the provider sent no email")
+
+// Identity is the user the provider vouched for
+type Identity struct {
+	// Subject is the id of the user at the provider, the same on every login
+	Subject  string
+	Email    string
+	Name     string
+	Username string
+}
+
+// identity reads the attributes of the mapping of the config. The subject is never taken for
+// the email, the provider vouches for the email attribute only.
+func identity(cfg *models.WorkspaceSSO, subject string, attribute func(name string) string) (*Identity, error) {
+	if subject == "" {
+		return nil, errors.New("sso: the provider sent no subject")
+	}
+
+	email, name, username := cfg.Attributes()
+	id := &Identity{
+		Subject:  subject,
+		Email:    strings.TrimSpace(attribute(email)),
+		Name:     strings.TrimSpace(attribute(name)),
+		Username: strings.TrimSpace(attribute(username)),
+	}
+	if id.Email == "" {
+		return nil, ErrNoEmail
+	}
+
+	return id, nil
+}
@@ -0,0 +1,101 @@
+package storage
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"io"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DownloadPath is the route serving files of the local storage
+const DownloadPath = "/api/v1/attachments/download"
+
+// LocalStorage keeps files on the local disk
+type LocalStorage struct {
+	Dir    string
+	secret []byte
+}
+
+func NewLocalStorage(dir string, secret []byte) *LocalStorage {
+	return &LocalStorage{Dir: dir, secret: secret}
+}
+
+func (s *LocalStorage) path(key string) (string, error) {
+	p := filepath.Join(s.Dir, filepath.FromSlash(key))
+	if !strings.HasPrefix(p, filepath.Clean(s.Dir)+string(os.PathSeparator)) {
+		return "", errors.New("invalid storage key")
+	}
+
+	return p, nil
+}
+
+func (s *LocalStorage) Put(key string, r io.Reader, size int64, contentType string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+		return err
+	}
+
+	f, err := os.Create(p)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, err = io.Copy(f, r)
+	return err
+}
+
+func (s *LocalStorage) Delete(key string) error {
+	p, err := s.path(key)
+	if err != nil {
+		return err
+	}
+
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+
+	return nil
+}
+
+func (s *LocalStorage) SignedURL(key string, expires time.Duration) (string, error) {
+	exp := strconv.FormatInt(time.Now().Add(expires).Unix(), 10)
+
+	q := url.Values{}
+	q.Set("key", key)
+	q.Set("expires", exp)
+	q.Set("signature", s.sign(key, exp))
+
+	return DownloadPath + "?" + q.Encode(), nil
+}
+
+// Open verifies a signed url and returns the file path of the key
+func (s *LocalStorage) Open(key, expires, signature string) (string, error) {
+	exp, err := strconv.ParseInt(expires, 10, 64)
+	if err != nil || exp < time.Now().Unix() {
+		return "", errors.New("link is expired")
+	}
+
+	if !hmac.Equal([]byte(signature), []byte(s.sign(key, expires))) {
+		return "", errors.New("invalid signature")
+	}
+
+	return s.path(key)
+}
+
+func (s *LocalStorage) sign(key, expires string) string {
+	mac := hmac.New(sha256.New, s.secret)
+	mac.Write([]byte(key + "\n" + expires))
+	return hex.EncodeToString(mac.Sum(nil))
+}
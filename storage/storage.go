@@ -0,0 +1,80 @@
+package storage
+
+import (
+	"io"
+	"os"
+	"strconv"
+	"strings"
+	"task-app/logging"
+	"time"
+)
+
+// Storage is the backend where uploaded files are kept
+type Storage interface {
+	// Put stores the content of r under the key
+	Put(key string, r io.Reader, size int64, contentType string) error
+	// Delete removes the file stored under the key
+	Delete(key string) error
+	// SignedURL returns a download url for the key which is valid for the given duration
+	SignedURL(key string, expires time.Duration) (string, error)
+}
+
+// Store is the storage backend selected by STORAGE_DRIVER
+var Store Storage
+
+// MaxUploadSize is the upper limit of an uploaded file in bytes
+var MaxUploadSize int64 = 10 << 20
+
+// AllowedTypes is the list of MIME types accepted for upload
+var AllowedTypes = []string{
+	"image/png",
+	"image/jpeg",
+	"image/gif",
+	"image/webp",
+	"application/pdf",
+	"application/zip",
+	"text/plain",
+	"text/csv",
+}
+
+// SetupStorage selects the storage backend from env, the secret signs the local download URLs
+func SetupStorage(secret string) {
+	if size, err := strconv.ParseInt(os.Getenv("STORAGE_MAX_SIZE"), 10, 64); err == nil && size > 0 {
+		MaxUploadSize = size
+	}
+
+	if types := os.Getenv("STORAGE_ALLOWED_TYPES"); types != "" {
+		AllowedTypes = strings.Split(types, ",")
+	}
+
+	switch driver := os.Getenv("STORAGE_DRIVER"); driver {
+	case "s3":
+		Store = NewS3Storage(
+			os.Getenv("S3_ENDPOINT"),
+			os.Getenv("S3_REGION"),
+			os.Getenv("S3_BUCKET"),
+			os.Getenv("S3_ACCESS_KEY"),
+			os.Getenv("S3_SECRET_KEY"),
+		)
+	case "", "local":
+		dir := os.Getenv("STORAGE_LOCAL_DIR")
+		if dir == "" {
+			dir = "uploads"
+		}
+		Store = NewLocalStorage(dir, []byte(secret))
+	default:
+		logging.Log.Fatal().Str("driver", driver).Msg("Unknown storage driver")
+	}
+}
+
+// IsAllowedType checks if a detected content type is in AllowedTypes
+func IsAllowedType(contentType string) bool {
+	mediaType := strings.TrimSpace(strings.Split(contentType, ";")[0])
+	for _, t := range AllowedTypes {
+		if strings.EqualFold(strings.TrimSpace(t), mediaType) {
+			return true
+		}
+	}
+
+	return false
+}
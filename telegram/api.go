@@ -0,0 +1,110 @@
+package telegram
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"time"
+)
+
+// apiURL is the Bot API, the token and the method are appended
+var apiURL = "https://api.telegram.org/bot"
+
+// pollTimeout is how long a getUpdates call waits for an update
+const pollTimeout = 30
+
+var client = &http.Client{Timeout: (pollTimeout + 10) * time.Second}
+
+// The types of the Bot API used by the bot, https://core.telegram.org/bots/api
+type (
+	Update struct {
+		UpdateID      int64          `json:"update_id"`
+		Message       *Message       `json:"message"`
+		CallbackQuery *CallbackQuery `json:"callback_query"`
+	}
+
+	Message struct {
+		MessageID   int64                 `json:"message_id"`
+		From        *User                 `json:"from"`
+		Chat        Chat                  `json:"chat"`
+		Text        string                `json:"text"`
+		ReplyMarkup *InlineKeyboardMarkup `json:"reply_markup,omitempty"`
+	}
+
+	Chat struct {
+		ID   int64  `json:"id"`
+		Type string `json:"type"`
+	}
+
+	User struct {
+		ID       int64  `json:"id"`
+		Username string `json:"username"`
+	}
+
+	CallbackQuery struct {
+		ID      string   `json:"id"`
+		From    User     `json:"from"`
+		Message *Message `json:"message"`
+		Data    string   `json:"data"`
+	}
+
+	InlineKeyboardMarkup struct {
+		InlineKeyboard [][]InlineKeyboardButton `json:"inline_keyboard"`
+	}
+
+	InlineKeyboardButton struct {
+		Text         string `json:"text"`
+		CallbackData string `json:"callback_data"`
+	}
+)
+
+type apiResponse struct {
+	OK          bool            `json:"ok"`
+	Result      json.RawMessage `json:"result"`
+	Description string          `json:"description"`
+}
+
+// call posts the params to a method of the Bot API and decodes its result into result, when not nil
+func (b *Bot) call(ctx context.Context, method string, params interface{}, result interface{}) error {
+	body, err := json.Marshal(params)
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, apiURL+b.token+"/"+method, bytes.NewReader(body))
+	if err != nil {
+		return err
+	}
+	req.Header.Set("Content-Type", "application/json")
+
+	res, err := client.Do(req)
+	if err != nil {
+		return err
+	}
+	defer res.Body.Close()
+
+	var r apiResponse
+	if err := json.NewDecoder(res.Body).Decode(&r); err != nil {
+		return err
+	}
+	if !r.OK {
+		return errors.New("telegram: " + method + ": " + r.Description)
+	}
+	if result == nil {
+		return nil
+	}
+
+	return json.Unmarshal(r.Result, result)
+}
+
+// sendMessage sends a text to the chat, with buttons when the keyboard is not nil
+func (b *Bot) sendMessage(chatID int64, text string, keyboard *InlineKeyboardMarkup) error {
+	params := map[string]interface{}{"chat_id": chatID, "text": text}
+	if keyboard != nil {
+		params["reply_markup"] = keyboard
+	}
+
+	return b.call(context.Background(), "sendMessage", params, nil)
+}
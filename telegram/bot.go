@@ -0,0 +1,457 @@
+// Package telegram is the bot of the app: the users link their chat with a one-time code,
+// then create tasks by messaging the bot, receive the due reminders and complete tasks from buttons.
+package telegram
+
+import (
+	"context"
+	"crypto/subtle"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"strconv"
+	"strings"
+	"sync"
+	"task-app/config"
+	"task-app/db"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"task-app/util"
+	"time"
+	"unicode/utf8"
+)
+
+const (
+	// WebhookPath is the route of the updates posted by Telegram in webhook mode
+	WebhookPath = "/telegram/webhook"
+	// SecretHeader carries the webhook secret in the updates posted by Telegram
+	SecretHeader = "X-Telegram-Bot-Api-Secret-Token"
+	// CodeTTL is how long a link code can be sent to the bot
+	CodeTTL = 10 * time.Minute
+
+	// maxTaskList is how many tasks /tasks lists
+	maxTaskList = 10
+	// the callback data of the done buttons is the prefix and the task id
+	donePrefix = "done:"
+)
+
+const helpText = `Send me a message and I create a task of it, the first line is its title.
+/tasks lists your open tasks, tap one to mark it done.
+/unlink signs this chat out of your account.`
+
+// Bot answers the updates of Telegram, from long polling or from the webhook
+type Bot struct {
+	token string
+	cfg   config.Telegram
+	store db.Store
+	users repository.UserRepo
+	tasks repository.TaskRepo
+
+	ctx     context.Context
+	cancel  context.CancelFunc
+	running sync.WaitGroup
+}
+
+func New(store db.Store, cfg config.Telegram) *Bot {
+	ctx, cancel := context.WithCancel(context.Background())
+	return &Bot{
+		token:  cfg.Token,
+		cfg:    cfg,
+		store:  store,
+		users:  repository.NewUserRepo(store),
+		tasks:  repository.NewTaskRepo(store),
+		ctx:    ctx,
+		cancel: cancel,
+	}
+}
+
+// Start registers the webhook in webhook mode, or starts polling the updates in the background
+func (b *Bot) Start() error {
+	allowed := []string{"message", "callback_query"}
+	if b.cfg.Mode == "webhook" {
+		return b.call(b.ctx, "setWebhook", map[string]interface{}{
+			"url":             b.cfg.WebhookURL,
+			"secret_token":    b.cfg.WebhookSecret,
+			"allowed_updates": allowed,
+		}, nil)
+	}
+
+	// the updates cannot be polled while a webhook is set
+	if err := b.call(b.ctx, "deleteWebhook", map[string]interface{}{}, nil); err != nil {
+		return err
+	}
+
+	b.running.Add(1)
+	go b.poll(allowed)
+	return nil
+}
+
+// Stop ends the polling and waits for the update in progress
+func (b *Bot) Stop() {
+	b.cancel()
+	b.running.Wait()
+}
+
+func (b *Bot) poll(allowed []string) {
+	defer b.running.Done()
+
+	var offset int64
+	for {
+		var updates []Update
+		err := b.call(b.ctx, "getUpdates", map[string]interface{}{
+			"offset":          offset,
+			"timeout":         pollTimeout,
+			"allowed_updates": allowed,
+		}, &updates)
+		if b.ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			logging.Log.Error().Err(err).Msg("Cannot get the Telegram updates")
+			select {
+			case <-time.After(5 * time.Second):
+			case <-b.ctx.Done():
+				return
+			}
+			continue
+		}
+
+		for _, u := range updates {
+			offset = u.UpdateID + 1
+			b.handle(u)
+		}
+	}
+}
+
+// HandleWebhook answers an update posted by Telegram, it must carry the webhook secret
+func (b *Bot) HandleWebhook(c *fiber.Ctx) error {
+	secret := c.Get(SecretHeader)
+	if b.cfg.WebhookSecret == "" || subtle.ConstantTimeCompare([]byte(secret), []byte(b.cfg.WebhookSecret)) != 1 {
+		return models.NewError(fiber.StatusUnauthorized, "Invalid webhook secret")
+	}
+
+	var u Update
+	if err := c.BodyParser(&u); err != nil {
+		return models.NewError(fiber.StatusBadRequest, "Invalid update")
+	}
+
+	b.handle(u)
+	return c.SendStatus(fiber.StatusOK)
+}
+
+func (b *Bot) handle(u Update) {
+	var err error
+	switch {
+	case u.Message != nil:
+		err = b.handleMessage(u.Message)
+	case u.CallbackQuery != nil:
+		err = b.handleCallback(u.CallbackQuery)
+	}
+
+	if err != nil {
+		logging.Log.Error().Err(err).Int64("update", u.UpdateID).Msg("Cannot handle the Telegram update")
+	}
+}
+
+// handleMessage runs the command of the message, a message which is not a command becomes a task.
+// Only the private chats are answered, the tasks are never created from a group.
+func (b *Bot) handleMessage(m *Message) error {
+	if m.Chat.Type != "private" {
+		return nil
+	}
+
+	text := strings.TrimSpace(m.Text)
+	if text == "" {
+		return nil
+	}
+
+	command, arg := splitCommand(text)
+	if command == "/start" || command == "/link" {
+		if arg == "" {
+			return b.sendMessage(m.Chat.ID, "Hi! Create a link code in the settings of your account and send it to me as /link <code>.", nil)
+		}
+		return b.link(m, arg)
+	}
+
+	u, err := b.chatUser(m.Chat.ID)
+	if err != nil {
+		return b.sendMessage(m.Chat.ID, "This chat is not linked to an account yet. Create a link code in the settings of your account and send it to me as /link <code>.", nil)
+	}
+
+	switch command {
+	case "":
+		return b.createTask(m.Chat.ID, u, text)
+	case "/tasks":
+		return b.listTasks(m.Chat.ID, u)
+	case "/unlink":
+		return b.unlink(m.Chat.ID)
+	case "/help":
+		return b.sendMessage(m.Chat.ID, helpText, nil)
+	}
+
+	return b.sendMessage(m.Chat.ID, "I do not know "+command+".\n\n"+helpText, nil)
+}
+
+// splitCommand returns the command of the text, without the bot name, and its argument.
+// The command is empty when the text is not a command.
+func splitCommand(text string) (string, string) {
+	if !strings.HasPrefix(text, "/") {
+		return "", ""
+	}
+
+	fields := strings.Fields(text)
+	command := strings.ToLower(fields[0])
+	if at := strings.IndexByte(command, '@'); at >= 0 {
+		command = command[:at]
+	}
+
+	return command, strings.TrimSpace(strings.TrimPrefix(text, fields[0]))
+}
+
+// link links the chat to the account of the one-time code, a chat is linked to one account only
+func (b *Bot) link(m *Message, code string) error {
+	account := new(models.TelegramAccount)
+	res := b.store.DB().
+		Where("code = ? AND code_expires_at > ?", util.HashToken(strings.ToLower(code)), time.Now()).
+		Limit(1).
+		Find(account)
+	if res.Error != nil {
+		return res.Error
+	}
+	if res.RowsAffected == 0 {
+		return b.sendMessage(m.Chat.ID, "This code is invalid or expired, create a new one in the settings of your account.", nil)
+	}
+
+	username := ""
+	if m.From != nil {
+		username = m.From.Username
+	}
+
+	chatID, now := m.Chat.ID, time.Now()
+	if err := b.store.DB().Transaction(func(tx *gorm.DB) error {
+		if err := tx.Where("chat_id = ? AND id <> ?", chatID, account.ID).Delete(&models.TelegramAccount{}).Error; err != nil {
+			return err
+		}
+		return tx.Model(account).Updates(map[string]interface{}{
+			"chat_id":         chatID,
+			"username":        username,
+			"code":            "",
+			"code_expires_at": nil,
+			"linked_at":       now,
+		}).Error
+	}); err != nil {
+		return err
+	}
+
+	u, err := b.users.ByID(account.UserID)
+	if err != nil {
+		return err
+	}
+
+	return b.sendMessage(chatID, "This chat is linked to "+u.Username+".\n\n"+helpText, nil)
+}
+
+func (b *Bot) unlink(chatID int64) error {
+	if err := b.store.DB().Where("chat_id = ?", chatID).Delete(&models.TelegramAccount{}).Error; err != nil {
+		return err
+	}
+
+	return b.sendMessage(chatID, "This chat is not linked to your account anymore.", nil)
+}
+
+// chatUser returns the user linked to the chat
+func (b *Bot) chatUser(chatID int64) (*models.User, error) {
+	account := new(models.TelegramAccount)
+	if err := b.store.DB().Where("chat_id = ?", chatID).First(account).Error; err != nil {
+		return nil, err
+	}
+
+	u, err := b.users.ByID(account.UserID)
+	if err != nil {
+		return nil, err
+	}
+	if u.Locked {
+		return nil, repository.ErrNotFound
+	}
+
+	return u, nil
+}
+
+// userChat returns the chat linked to the user, 0 without one
+func (b *Bot) userChat(userID uint) int64 {
+	account := new(models.TelegramAccount)
+	if res := b.store.DB().Where("user_id = ? AND chat_id IS NOT NULL", userID).Limit(1).Find(account); res.Error != nil || res.RowsAffected == 0 {
+		return 0
+	}
+
+	return *account.ChatID
+}
+
+// createTask creates a personal task of the text, the first line is the title and the rest the description
+func (b *Bot) createTask(chatID int64, u *models.User, text string) error {
+	title, description := text, ""
+	if nl := strings.IndexByte(text, '\n'); nl >= 0 {
+		title, description = strings.TrimSpace(text[:nl]), strings.TrimSpace(text[nl+1:])
+	}
+	title = truncate(title, 255)
+
+	task := models.Task{Title: title, Description: description, UserID: u.ID}
+	if err := b.tasks.Create(&task); err != nil {
+		return err
+	}
+	events.Publish(taskEvent(events.TaskCreated, u, &task))
+
+	return b.sendMessage(chatID, "Created \""+task.Title+"\"", doneKeyboard(task))
+}
+
+// listTasks sends the open tasks of the user with a done button each, the tasks due first
+func (b *Bot) listTasks(chatID int64, u *models.User) error {
+	var tasks []models.Task
+	if err := b.store.DB().
+		Where("status <> ?", models.StatusDone).
+		Where("assignee_id = ? OR (assignee_id IS NULL AND user_id = ? AND workspace_id IS NULL)", u.ID, u.ID).
+		Order("due_at IS NULL, due_at, priority, position").
+		Limit(maxTaskList).
+		Find(&tasks).Error; err != nil {
+		return err
+	}
+
+	if len(tasks) == 0 {
+		return b.sendMessage(chatID, "You have no open task.", nil)
+	}
+
+	keyboard := &InlineKeyboardMarkup{}
+	for _, t := range tasks {
+		label := t.Title
+		if t.DueAt != nil {
+			label += " · " + t.DueAt.UTC().Format("Jan 2")
+		}
+		keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, []InlineKeyboardButton{
+			{Text: "✓ " + truncate(label, 60), CallbackData: donePrefix + strconv.Itoa(int(t.ID))},
+		})
+	}
+
+	return b.sendMessage(chatID, "Your open tasks, tap one to mark it done:", keyboard)
+}
+
+// handleCallback marks the task of a done button as done, the button is removed from the message
+func (b *Bot) handleCallback(q *CallbackQuery) error {
+	if !strings.HasPrefix(q.Data, donePrefix) || q.Message == nil {
+		return b.answer(q, "")
+	}
+
+	u, err := b.chatUser(q.Message.Chat.ID)
+	if err != nil {
+		return b.answer(q, "This chat is not linked to an account.")
+	}
+
+	id, err := strconv.Atoi(strings.TrimPrefix(q.Data, donePrefix))
+	if err != nil {
+		return b.answer(q, "")
+	}
+
+	task, err := b.tasks.Get(u, uint(id), models.WorkspaceWriters...)
+	if err != nil {
+		return b.answer(q, "Cannot find the task.")
+	}
+
+	if task.Status != models.StatusDone {
+		from := task.Status
+		task.SetStatus(models.StatusDone)
+		if err := b.tasks.Save(task); err != nil {
+			if errors.Is(err, repository.ErrConflict) {
+				return b.answer(q, "The task was changed meanwhile, try again.")
+			}
+			return err
+		}
+
+		updated := taskEvent(events.TaskUpdated, u, task)
+		updated.Changes = map[string]events.Change{"status": {From: from, To: task.Status}}
+		events.Publish(updated)
+		events.Publish(taskEvent(events.TaskCompleted, u, task))
+	}
+
+	if err := b.removeButton(q.Message, q.Data); err != nil {
+		return err
+	}
+
+	return b.answer(q, "Done: "+task.Title)
+}
+
+// answer stops the loading of the button, with a text shown in the chat when not empty
+func (b *Bot) answer(q *CallbackQuery, text string) error {
+	return b.call(context.Background(), "answerCallbackQuery", map[string]interface{}{
+		"callback_query_id": q.ID,
+		"text":              text,
+	}, nil)
+}
+
+func (b *Bot) removeButton(m *Message, data string) error {
+	keyboard := &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{}}
+	if m.ReplyMarkup != nil {
+		for _, row := range m.ReplyMarkup.InlineKeyboard {
+			kept := []InlineKeyboardButton{}
+			for _, button := range row {
+				if button.CallbackData != data {
+					kept = append(kept, button)
+				}
+			}
+			if len(kept) > 0 {
+				keyboard.InlineKeyboard = append(keyboard.InlineKeyboard, kept)
+			}
+		}
+	}
+
+	return b.call(context.Background(), "editMessageReplyMarkup", map[string]interface{}{
+		"chat_id":      m.Chat.ID,
+		"message_id":   m.MessageID,
+		"reply_markup": keyboard,
+	}, nil)
+}
+
+// RemindDue sends the due reminder of the task to the chat of the user, if they linked one
+func (b *Bot) RemindDue(userID uint, task *models.Task) {
+	chatID := b.userChat(userID)
+	if chatID == 0 {
+		return
+	}
+
+	loc := time.UTC
+	if u, err := b.users.ByID(userID); err == nil {
+		loc = u.Location()
+	}
+
+	text := "⏰ \"" + task.Title + "\" is due " + task.DueAt.In(loc).Format("Mon Jan 2 15:04 MST")
+	if err := b.sendMessage(chatID, text, doneKeyboard(*task)); err != nil {
+		logging.Log.Error().Err(err).Uint("user", userID).Uint("task", task.ID).Msg("Cannot send the Telegram reminder")
+	}
+}
+
+func doneKeyboard(t models.Task) *InlineKeyboardMarkup {
+	return &InlineKeyboardMarkup{InlineKeyboard: [][]InlineKeyboardButton{
+		{{Text: "✓ Mark as done", CallbackData: donePrefix + strconv.Itoa(int(t.ID))}},
+	}}
+}
+
+// taskEvent returns an event about the task, targeting the task itself
+func taskEvent(kind string, actor *models.User, task *models.Task) events.Event {
+	return events.Event{
+		Type:        kind,
+		ActorID:     actor.ID,
+		TaskID:      task.ID,
+		TargetID:    task.ID,
+		OwnerID:     task.UserID,
+		WorkspaceID: task.WorkspaceID,
+		Payload:     task.Api(),
+	}
+}
+
+// truncate cuts the text to n runes
+func truncate(s string, n int) string {
+	if utf8.RuneCountInString(s) <= n {
+		return s
+	}
+
+	return string([]rune(s)[:n-1]) + "…"
+}
@@ -0,0 +1,92 @@
+package tracing
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"go.opentelemetry.io/otel"
+	"go.opentelemetry.io/otel/codes"
+	semconv "go.opentelemetry.io/otel/semconv/v1.4.0"
+	"go.opentelemetry.io/otel/trace"
+)
+
+const (
+	instrumentationName = "task-app/tracing"
+	contextKey          = "trace_context"
+)
+
+// Middleware starts a server span for every request, continuing the trace of the
+// traceparent header. The span is named after the route once it is matched.
+func Middleware() fiber.Handler {
+	tracer := otel.Tracer(instrumentationName)
+
+	return func(c *fiber.Ctx) error {
+		ctx := otel.GetTextMapPropagator().Extract(context.Background(), headerCarrier{c})
+		ctx, span := tracer.Start(ctx, c.Method()+" "+c.Path(),
+			trace.WithSpanKind(trace.SpanKindServer),
+			trace.WithAttributes(
+				semconv.HTTPMethodKey.String(c.Method()),
+				semconv.HTTPTargetKey.String(string(c.Request().RequestURI())),
+				semconv.HTTPSchemeKey.String(c.Protocol()),
+				semconv.HTTPClientIPKey.String(c.IP()),
+				semconv.HTTPUserAgentKey.String(c.Get(fiber.HeaderUserAgent)),
+			),
+		)
+		defer span.End()
+		c.Locals(contextKey, ctx)
+
+		err := c.Next()
+
+		status := c.Response().StatusCode()
+		if err != nil {
+			status = fiber.StatusInternalServerError
+			if e, ok := err.(*fiber.Error); ok {
+				status = e.Code
+			}
+			span.RecordError(err)
+		}
+
+		route := c.Route().Path
+		span.SetName(c.Method() + " " + route)
+		span.SetAttributes(semconv.HTTPRouteKey.String(route), semconv.HTTPStatusCodeKey.Int(status))
+		if status >= fiber.StatusInternalServerError {
+			span.SetStatus(codes.Error, "")
+		}
+		if id, ok := c.Locals("id").(string); ok {
+			span.SetAttributes(semconv.EnduserIDKey.String(id))
+		}
+
+		return err
+	}
+}
+
+// Context returns the context of the request span, to start child spans from.
+// Queries run with db.DB.WithContext(tracing.Context(c)) are traced under the request.
+func Context(c *fiber.Ctx) context.Context {
+	if ctx, ok := c.Locals(contextKey).(context.Context); ok {
+		return ctx
+	}
+
+	return context.Background()
+}
+
+// headerCarrier reads and writes the propagation headers of a request
+type headerCarrier struct {
+	c *fiber.Ctx
+}
+
+func (h headerCarrier) Get(key string) string {
+	return h.c.Get(key)
+}
+
+func (h headerCarrier) Set(key, value string) {
+	h.c.Request().Header.Set(key, value)
+}
+
+func (h headerCarrier) Keys() []string {
+	var keys []string
+	h.c.Request().Header.VisitAll(func(key, _ []byte) {
+		keys = append(keys, string(key))
+	})
+
+	return keys
+}
@@ -0,0 +1,135 @@
+package util
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"strconv"
+	"strings"
+	"task-app/metrics"
+	"task-app/models"
+	"time"
+)
+
+// APIKeyPrefix marks bearer tokens which are API keys and not JWTs
+const APIKeyPrefix = "tsk_"
+
+const (
+	// ScopeRead allows safe requests (GET, HEAD)
+	ScopeRead = "read"
+	// ScopeWrite allows every other request
+	ScopeWrite = "write"
+)
+
+// APIKeyScopes are the scopes an API key can be granted
+var APIKeyScopes = []string{ScopeRead, ScopeWrite}
+
+// MethodKey is the local of the method a request was sent with when the router was given
+// another one, the router knows only the methods of HTTP and not the ones of WebDAV
+const MethodKey = "method"
+
+// readMethods are the methods of the requests allowed by ScopeRead
+var readMethods = map[string]bool{
+	fiber.MethodGet:  true,
+	fiber.MethodHead: true,
+	"PROPFIND":       true,
+	"REPORT":         true,
+}
+
+// Method returns the method the request was sent with
+func Method(c *fiber.Ctx) string {
+	if method, ok := c.Locals(MethodKey).(string); ok {
+		return method
+	}
+
+	return c.Method()
+}
+
+// GenerateAPIKey returns a new key and the record to store for it
+func GenerateAPIKey(userID uint, name string, scopes []string) (string, *models.APIKey) {
+	key := APIKeyPrefix + RandomToken(24)
+	metrics.TokensIssued.Inc("api_key")
+
+	return key, &models.APIKey{
+		UserID:  userID,
+		Name:    name,
+		Prefix:  key[:len(APIKeyPrefix)+6],
+		KeyHash: HashToken(key),
+		Scopes:  strings.Join(scopes, ","),
+	}
+}
+
+// IsAPIKeyAuth checks if the request was authenticated with an API key
+func IsAPIKeyAuth(c *fiber.Ctx) bool {
+	_, ok := c.Locals("api_key").(*models.APIKey)
+	return ok
+}
+
+// IsImpersonation checks if the request was authenticated with the token of an admin impersonating the user
+func IsImpersonation(c *fiber.Ctx) bool {
+	_, ok := c.Locals("impersonator").(string)
+	return ok
+}
+
+// SessionOnly returns a middleware which rejects requests authenticated with an API key,
+// or by an admin impersonating the user
+func SessionOnly() func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		if IsAPIKeyAuth(c) {
+			return models.NewError(fiber.StatusForbidden, "Not allowed with an API key")
+		}
+		if IsImpersonation(c) {
+			return models.NewError(fiber.StatusForbidden, "Not allowed while impersonating a user")
+		}
+
+		return c.Next()
+	}
+}
+
+func (s *TokenService) authenticateAPIKey(c *fiber.Ctx, key string) error {
+	// the key of a deleted user is refused, even if it was not deleted with the account
+	apiKey := new(models.APIKey)
+	if res := s.store.DB().WithContext(Context(c)).
+		Joins("JOIN users ON users.id = api_keys.user_id AND users.deleted_at IS NULL").
+		Where("api_keys.key_hash = ?", HashToken(key)).
+		First(apiKey); res.RowsAffected <= 0 {
+		return models.NewError(fiber.StatusUnauthorized, "Invalid API key")
+	}
+
+	scope := ScopeWrite
+	if readMethods[Method(c)] {
+		scope = ScopeRead
+	}
+	if !apiKey.HasScope(scope) {
+		return models.NewError(fiber.StatusForbidden, "API key has no "+scope+" scope")
+	}
+
+	s.store.DB().WithContext(Context(c)).Model(apiKey).UpdateColumn("last_used_at", time.Now())
+
+	c.Locals("id", strconv.Itoa(int(apiKey.UserID)))
+	c.Locals("api_key", apiKey)
+	return c.Next()
+}
+
+// BasicAuth returns a middleware authenticating with an API key as the password of HTTP basic
+// authentication, for the clients which cannot send a bearer token like the CalDAV ones. The
+// username is the one of the user of the key or its email.
+func (s *TokenService) BasicAuth(realm string) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		username, key, ok := GetBasicAuth(c)
+		if !ok || !strings.HasPrefix(key, APIKeyPrefix) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="`+realm+`", charset="UTF-8"`)
+			return models.NewError(fiber.StatusUnauthorized, "An API key is required as the password")
+		}
+
+		var u models.User
+		res := s.store.DB().WithContext(Context(c)).
+			Joins("JOIN api_keys ON api_keys.user_id = users.id AND api_keys.deleted_at IS NULL").
+			Where("api_keys.key_hash = ?", HashToken(key)).
+			First(&u)
+		if res.Error != nil || !(strings.EqualFold(u.Username, username) || strings.EqualFold(u.Email, username)) {
+			c.Set(fiber.HeaderWWWAuthenticate, `Basic realm="`+realm+`", charset="UTF-8"`)
+			return models.NewError(fiber.StatusUnauthorized, "Invalid username or API key")
+		}
+
+		return s.authenticateAPIKey(c, key)
+	}
+}
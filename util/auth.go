@@ -1,144 +1,307 @@
 package util
 
 import (
-	"github.com/dgrijalva/jwt-go"
+	"errors"
 	"github.com/gofiber/fiber/v2"
-	"os"
+	"github.com/golang-jwt/jwt/v5"
+	"strings"
+	"task-app/config"
 	"task-app/db"
+	"task-app/metrics"
 	"task-app/models"
 	"time"
 )
 
-var jwtKey = []byte(os.Getenv("PRIV_KEY"))
+// TokenService issues and verifies the tokens of the users.
+// The refresh tokens and the API keys are kept in the store.
+type TokenService struct {
+	store  db.Store
+	keys   *keyRing
+	config config.Auth
+}
+
+// NewTokenService loads the signing keys of the config, it fails on an unreadable RSA key
+func NewTokenService(store db.Store, cfg config.Auth) (*TokenService, error) {
+	keys, err := newKeyRing(cfg)
+	if err != nil {
+		return nil, err
+	}
+
+	return &TokenService{
+		store:  store,
+		keys:   keys,
+		config: cfg,
+	}, nil
+}
+
+// defaultTokens is the service of the package-level functions
+var defaultTokens, _ = NewTokenService(db.Default, config.Default().Auth)
+
+// SetupAuth sets the keys and the lifetimes of the tokens and cookies of the package-level functions
+func SetupAuth(cfg config.Auth) error {
+	tokens, err := NewTokenService(db.Default, cfg)
+	if err != nil {
+		return err
+	}
+
+	defaultTokens = tokens
+	return nil
+}
+
+// ParseClaims parses a token signed by one of the keys of the app into the claims.
+// An expired token is an error wrapping jwt.ErrTokenExpired.
+func (s *TokenService) ParseClaims(tokenString string, claims *models.Claims) (*jwt.Token, error) {
+	return jwt.ParseWithClaims(tokenString, claims, s.keys.keyFunc)
+}
+
+// ErrNotAccessToken is returned for the refresh and challenge tokens, signed with the same keys
+var ErrNotAccessToken = errors.New("Not an access token")
+
+// ParseAccessToken returns the claims of a valid access token: the issuer is the id of its user,
+// and ImpersonatedBy the admin impersonating them. It is the check of SecureAuth for the
+// transports which are not served by fiber.
+func (s *TokenService) ParseAccessToken(accessToken string) (*models.Claims, error) {
+	claims := new(models.Claims)
+	token, err := s.ParseClaims(accessToken, claims)
+	switch {
+	case err != nil:
+		return nil, err
+	case !token.Valid:
+		return nil, jwt.ErrTokenUnverifiable
+	case claims.Subject != "access_token":
+		return nil, ErrNotAccessToken
+	}
+	if err := s.checkImpersonation(claims); err != nil {
+		return nil, err
+	}
+
+	return claims, nil
+}
 
-func GenerateTokens(uuid string) (string, string) {
-	claim, accessToken := GenerateAccessClaims(uuid)
-	refreshToken := GenerateRefreshClaims(claim)
+// JWKS returns the public keys verifying the RS256 tokens, empty with HS256
+func (s *TokenService) JWKS() []JWK {
+	return s.keys.jwks()
+}
+
+// GenerateTokens returns an access token and the refresh token of a new session of the device
+func (s *TokenService) GenerateTokens(uuid string, device models.Device) (string, string) {
+	claim, accessToken := s.GenerateAccessClaims(uuid)
+	refreshToken := s.GenerateRefreshClaims(claim, device)
 
 	return accessToken, refreshToken
 }
 
 // GenerateAccessClaims returns a claim and a acess_token string
-func GenerateAccessClaims(uuid string) (*models.Claims, string) {
+func (s *TokenService) GenerateAccessClaims(uuid string) (*models.Claims, string) {
+
+	t := time.Now()
+	claim := &models.Claims{
+		Issuer:    uuid,
+		ExpiresAt: t.Add(s.config.AccessTokenTTL).Unix(),
+		Subject:   "access_token",
+		IssuedAt:  t.Unix(),
+	}
+
+	tokenString, err := s.keys.sign(claim)
+	if err != nil {
+		panic(err)
+	}
+	metrics.TokensIssued.Inc("access")
 
+	return claim, tokenString
+}
+
+// GenerateImpersonationToken returns an access token of the user for the admin impersonating it.
+// It lives for the ImpersonationTTL, has no refresh token and is accepted while its
+// Impersonation, found by the Fingerprint of the claims, is active.
+func (s *TokenService) GenerateImpersonationToken(uuid, adminID string) (*models.Claims, string) {
 	t := time.Now()
 	claim := &models.Claims{
-		StandardClaims: jwt.StandardClaims{
-			Issuer:    uuid,
-			ExpiresAt: t.Add(15 * time.Hour).Unix(),
-			Subject:   "access_token",
-			IssuedAt:  t.Unix(),
-		},
+		Issuer:         uuid,
+		ExpiresAt:      t.Add(s.config.ImpersonationTTL).Unix(),
+		Subject:        "access_token",
+		IssuedAt:       t.Unix(),
+		TokenID:        RandomToken(16),
+		ImpersonatedBy: adminID,
 	}
 
-	token := jwt.NewWithClaims(jwt.SigningMethodHS256, claim)
-	tokenString, err := token.SignedString(jwtKey)
+	tokenString, err := s.keys.sign(claim)
 	if err != nil {
 		panic(err)
 	}
+	metrics.TokensIssued.Inc("impersonation")
 
 	return claim, tokenString
 }
 
-// GenerateRefreshClaims returns refresh_token
-func GenerateRefreshClaims(cl *models.Claims) string {
-	result := db.DB.Where(&models.Claims{
-		StandardClaims: jwt.StandardClaims{
-			Issuer: cl.Issuer,
-		},
-	}).Find(&models.Claims{})
+// ErrImpersonationEnded is returned for the token of an impersonation which was ended
+var ErrImpersonationEnded = errors.New("The impersonation ended")
+
+// checkImpersonation checks the impersonation of an access token is active, the other tokens pass
+func (s *TokenService) checkImpersonation(claims *models.Claims) error {
+	if claims.ImpersonatedBy == "" {
+		return nil
+	}
 
-	// checking the number of refresh tokens stored.
-	// If the number is higher than 3, remove all the refresh tokens and leave only new one.
-	if result.RowsAffected > 3 {
-		db.DB.Where(&models.Claims{
-			StandardClaims: jwt.StandardClaims{Issuer: cl.Issuer},
-		}).Delete(&models.Claims{})
+	impersonation := new(models.Impersonation)
+	if res := s.store.DB().Where("token_hash = ?", claims.Fingerprint()).First(impersonation); res.Error != nil {
+		return ErrImpersonationEnded
 	}
+	if !impersonation.Active(time.Now()) {
+		return ErrImpersonationEnded
+	}
+
+	return nil
+}
+
+// GenerateRefreshClaims returns refresh_token, stored as a new session of the device
+func (s *TokenService) GenerateRefreshClaims(cl *models.Claims, device models.Device) string {
+	s.pruneSessions(cl.Issuer)
 
 	t := time.Now()
 	refreshClaim := &models.Claims{
-		StandardClaims: jwt.StandardClaims{
-			Issuer:    cl.Issuer,
-			ExpiresAt: t.Add(30 * 24 * time.Hour).Unix(),
-			Subject:   "refresh_token",
-			IssuedAt:  t.Unix(),
-		},
+		Issuer:     cl.Issuer,
+		ExpiresAt:  t.Add(s.config.RefreshTokenTTL).Unix(),
+		Subject:    "refresh_token",
+		IssuedAt:   t.Unix(),
+		TokenID:    RandomToken(16),
+		UserAgent:  device.UserAgent,
+		IP:         device.IP,
+		LastUsedAt: t,
 	}
+	refreshClaim.TokenHash = refreshClaim.Fingerprint()
 
 	// create a claim on DB
-	db.DB.Create(&refreshClaim)
+	s.store.DB().Create(&refreshClaim)
 
-	refreshToken := jwt.NewWithClaims(jwt.SigningMethodHS256, refreshClaim)
-	refreshTokenString, err := refreshToken.SignedString(jwtKey)
+	refreshTokenString, err := s.keys.sign(refreshClaim)
 	if err != nil {
 		panic(err)
 	}
+	metrics.TokensIssued.Inc("refresh")
 
 	return refreshTokenString
 }
 
+// GenerateChallengeToken returns a short-lived token proving the password step of a 2FA login
+func (s *TokenService) GenerateChallengeToken(uuid string) string {
+	t := time.Now()
+	claim := &models.Claims{
+		Issuer:    uuid,
+		ExpiresAt: t.Add(s.config.ChallengeTTL).Unix(),
+		Subject:   "2fa_challenge",
+		IssuedAt:  t.Unix(),
+	}
+
+	token, err := s.keys.sign(claim)
+	if err != nil {
+		panic(err)
+	}
+	metrics.TokensIssued.Inc("2fa_challenge")
+
+	return token
+}
+
+// ParseChallengeToken returns the user id of a valid 2FA challenge token
+func (s *TokenService) ParseChallengeToken(challenge string) (string, error) {
+	claims := new(models.Claims)
+	token, err := s.ParseClaims(challenge, claims)
+
+	if err != nil || !token.Valid || claims.Subject != "2fa_challenge" {
+		return "", errors.New("invalid challenge token")
+	}
+
+	return claims.Issuer, nil
+}
+
+// GenerateMagicLinkToken returns the token of a login link emailed to the user, it lives for the
+// MagicLinkTTL. The link logs in once: its MagicLink, found by the Fingerprint of the claims, is
+// deleted when it is used.
+func (s *TokenService) GenerateMagicLinkToken(uuid string) (*models.Claims, string) {
+	t := time.Now()
+	claim := &models.Claims{
+		Issuer:    uuid,
+		ExpiresAt: t.Add(s.config.MagicLinkTTL).Unix(),
+		Subject:   "magic_link",
+		IssuedAt:  t.Unix(),
+		TokenID:   RandomToken(16),
+	}
+
+	token, err := s.keys.sign(claim)
+	if err != nil {
+		panic(err)
+	}
+	metrics.TokensIssued.Inc("magic_link")
+
+	return claim, token
+}
+
+// ParseMagicLinkToken returns the claims of a valid login link token
+func (s *TokenService) ParseMagicLinkToken(link string) (*models.Claims, error) {
+	claims := new(models.Claims)
+	token, err := s.ParseClaims(link, claims)
+
+	if err != nil || !token.Valid || claims.Subject != "magic_link" || claims.TokenID == "" {
+		return nil, errors.New("invalid login link")
+	}
+
+	return claims, nil
+}
+
+// RevokeTokens revokes every refresh token of the user for the reason, so no new access token can be issued
+func (s *TokenService) RevokeTokens(uuid string, reason string) error {
+	return s.revoke(s.store.DB().Where("issuer = ?", uuid), reason).Error
+}
+
 // SecureAuth returns a middleware which secures all the private routes
-func SecureAuth() func(*fiber.Ctx) error {
+func (s *TokenService) SecureAuth() func(*fiber.Ctx) error {
 	return func(c *fiber.Ctx) error {
 		accessToken := GetAccessToken(c)
+		if strings.HasPrefix(accessToken, APIKeyPrefix) {
+			return s.authenticateAPIKey(c, accessToken)
+		}
+
 		claims := new(models.Claims)
 
-		token, err := jwt.ParseWithClaims(accessToken, claims,
-			func(token *jwt.Token) (interface{}, error) {
-				return jwtKey, nil
-			})
+		token, err := s.ParseClaims(accessToken, claims)
 
-		if err != nil {
-			return c.Status(fiber.StatusUnauthorized).JSON(
-				models.DefaultError(err.Error()),
-			)
+		switch {
+		case accessToken == "":
+			return models.NewError(fiber.StatusUnauthorized, "Missing access token")
+		case errors.Is(err, jwt.ErrTokenExpired):
+			return models.NewError(fiber.StatusUnauthorized, "Token Expired")
+		case errors.Is(err, jwt.ErrTokenNotValidYet):
+			return models.NewError(fiber.StatusUnauthorized, "Token is not active")
+		case errors.Is(err, jwt.ErrTokenMalformed):
+			// this is not even a token, we should delete the cookies here
+			s.ClearAuthCookies(c)
+			return models.NewError(fiber.StatusForbidden, "Malformed token")
+		case err != nil || !token.Valid:
+			// cannot handle this token, e.g. signed by an unknown key
+			s.ClearAuthCookies(c)
+			return models.NewError(fiber.StatusForbidden, "Invalid token")
+		case claims.Subject != "access_token":
+			// refresh and challenge tokens are signed with the same key
+			return models.NewError(fiber.StatusUnauthorized, "Not an access token")
 		}
-
-		if token.Valid {
-			if claims.ExpiresAt < time.Now().Unix() {
-				return c.Status(fiber.StatusUnauthorized).JSON(fiber.Map{
-					"error":   true,
-					"general": "Token Expired",
-				})
-			}
-		} else if ve, ok := err.(*jwt.ValidationError); ok {
-			if ve.Errors&jwt.ValidationErrorMalformed != 0 {
-				// this is not even a token, we should delete the cookies here
-				c.ClearCookie("access_token", "refresh_token")
-				return c.SendStatus(fiber.StatusForbidden)
-			} else if ve.Errors&(jwt.ValidationErrorExpired|jwt.ValidationErrorNotValidYet) != 0 {
-				// Token is either expired or not active yet
-				return c.SendStatus(fiber.StatusUnauthorized)
-			} else {
-				// cannot handle this token
-				c.ClearCookie("access_token", "refresh_token")
-				return c.SendStatus(fiber.StatusForbidden)
-			}
+		if err := s.checkImpersonation(claims); err != nil {
+			return models.NewError(fiber.StatusUnauthorized, err.Error())
 		}
 
 		c.Locals("id", claims.Issuer)
+		if claims.ImpersonatedBy != "" {
+			c.Locals("impersonator", claims.ImpersonatedBy)
+		}
 		return c.Next()
 	}
 }
 
 // GetAuthCookies sends two cookies of type access_token and refresh_token
-func GetAuthCookies(accessToken, refreshToken string) (*fiber.Cookie, *fiber.Cookie) {
-	accessCookie := &fiber.Cookie{
-		Name:     "access_token",
-		Value:    accessToken,
-		Expires:  time.Now().Add(24 * time.Hour),
-		HTTPOnly: true,
-		Secure:   true,
-	}
-
-	refreshCookie := &fiber.Cookie{
-		Name:     "refresh_token",
-		Value:    refreshToken,
-		Expires:  time.Now().Add(10 * 24 * time.Hour),
-		HTTPOnly: true,
-		Secure:   true,
-	}
+func (s *TokenService) GetAuthCookies(accessToken, refreshToken string) (*fiber.Cookie, *fiber.Cookie) {
+	return s.AccessCookie(accessToken), s.Cookie(RefreshTokenCookie, refreshToken, s.config.RefreshCookieTTL)
+}
 
-	return accessCookie, refreshCookie
+// AccessCookie returns the cookie carrying the access token
+func (s *TokenService) AccessCookie(accessToken string) *fiber.Cookie {
+	return s.Cookie(AccessTokenCookie, accessToken, s.config.AccessCookieTTL)
 }
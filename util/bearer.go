@@ -1,16 +1,41 @@
 package util
 
 import (
+	"encoding/base64"
 	"github.com/gofiber/fiber/v2"
 	"strings"
 )
 
+// GetAccessToken returns the bearer token of the request, or the access_token cookie
 func GetAccessToken(c *fiber.Ctx) string {
 	header := c.Get("Authorization")
+	if header == "" {
+		return c.Cookies(AccessTokenCookie)
+	}
+
 	slice := strings.Split(header, "Bearer ")
 	return slice[len(slice)-1]
 }
 
+// GetBasicAuth reads the credentials of the Authorization header of HTTP basic authentication
+func GetBasicAuth(c *fiber.Ctx) (string, string, bool) {
+	header := c.Get(fiber.HeaderAuthorization)
+	if len(header) < 6 || !strings.EqualFold(header[:6], "basic ") {
+		return "", "", false
+	}
+	raw, err := base64.StdEncoding.DecodeString(strings.TrimSpace(header[6:]))
+	if err != nil {
+		return "", "", false
+	}
+	decoded := string(raw)
+	i := strings.IndexByte(decoded, ':')
+	if i < 0 {
+		return "", "", false
+	}
+
+	return decoded[:i], decoded[i+1:], true
+}
+
 func GetRefreshToken(c *fiber.Ctx) (string, error) {
 	type refreshReq struct {
 		RefreshToken string `json:"refreshToken"`
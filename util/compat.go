@@ -0,0 +1,58 @@
+package util
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"github.com/golang-jwt/jwt/v5"
+	"task-app/models"
+)
+
+// The package-level functions use the token service set up by SetupAuth,
+// for the code which is not given a TokenService.
+
+func ParseClaims(tokenString string, claims *models.Claims) (*jwt.Token, error) {
+	return defaultTokens.ParseClaims(tokenString, claims)
+}
+
+func GenerateTokens(uuid string, device models.Device) (string, string) {
+	return defaultTokens.GenerateTokens(uuid, device)
+}
+
+func GenerateAccessClaims(uuid string) (*models.Claims, string) {
+	return defaultTokens.GenerateAccessClaims(uuid)
+}
+
+func GenerateRefreshClaims(cl *models.Claims, device models.Device) string {
+	return defaultTokens.GenerateRefreshClaims(cl, device)
+}
+
+func GenerateChallengeToken(uuid string) string {
+	return defaultTokens.GenerateChallengeToken(uuid)
+}
+
+func ParseChallengeToken(challenge string) (string, error) {
+	return defaultTokens.ParseChallengeToken(challenge)
+}
+
+func RevokeTokens(uuid string, reason string) error {
+	return defaultTokens.RevokeTokens(uuid, reason)
+}
+
+func SecureAuth() func(*fiber.Ctx) error {
+	return defaultTokens.SecureAuth()
+}
+
+func GetAuthCookies(accessToken, refreshToken string) (*fiber.Cookie, *fiber.Cookie) {
+	return defaultTokens.GetAuthCookies(accessToken, refreshToken)
+}
+
+func AccessCookie(accessToken string) *fiber.Cookie {
+	return defaultTokens.AccessCookie(accessToken)
+}
+
+func GetUserByLocal(c *fiber.Ctx) (*models.User, error) {
+	return defaultTokens.CurrentUser(c)
+}
+
+func RequireRole(role string) func(*fiber.Ctx) error {
+	return defaultTokens.RequireRole(role)
+}
@@ -0,0 +1,77 @@
+package util
+
+import (
+	"context"
+	"github.com/gofiber/fiber/v2"
+	"github.com/rs/zerolog"
+	"strconv"
+	"task-app/db"
+	"task-app/logging"
+	"task-app/models"
+	"task-app/repository"
+	"task-app/tracing"
+	"time"
+)
+
+const (
+	deadlineKey   = "deadline_context"
+	primaryKey    = "read_primary"
+	allTenantsKey = "all_tenants"
+)
+
+// Context returns the context of the request: the one of its span, done once the timeout
+// of its route is over. The queries of the request run with it, so they stop with it. Once the
+// user is signed in, it is the tenant of the repos and the author of the revisions of the tasks
+// updated with it, after AllTenants only the author. After ReadPrimary, its queries read the
+// primary.
+func Context(c *fiber.Ctx) context.Context {
+	ctx, ok := c.Locals(deadlineKey).(context.Context)
+	if !ok {
+		ctx = tracing.Context(c)
+	}
+	if primary, _ := c.Locals(primaryKey).(bool); primary {
+		ctx = db.ReadPrimary(ctx)
+	}
+	if id, ok := c.Locals("id").(string); ok {
+		if n, err := strconv.Atoi(id); err == nil {
+			if all, _ := c.Locals(allTenantsKey).(bool); !all {
+				ctx = repository.WithTenant(ctx, uint(n))
+			}
+			ctx = models.WithAuthor(ctx, uint(n))
+		}
+	}
+
+	return ctx
+}
+
+// ReadPrimary reads the queries of the request on the primary rather than on a replica
+func ReadPrimary(c *fiber.Ctx) {
+	c.Locals(primaryKey, true)
+}
+
+// AllTenants lets the queries of the request read and change the rows of every user, for the
+// routes of the admins
+func AllTenants() fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		c.Locals(allTenantsKey, true)
+		return c.Next()
+	}
+}
+
+// WithTimeout bounds the context of the request to the duration from now, replacing the timeout
+// set before so a route can be given more time than the others. The cancel is called once the
+// request is handled.
+func WithTimeout(c *fiber.Ctx, d time.Duration) (context.Context, context.CancelFunc) {
+	ctx := tracing.Context(c)
+	// GORM logs the queries with the logger of the request and counts them, see logging.GormLogger
+	if l, ok := c.Locals(logging.LoggerKey).(*zerolog.Logger); ok {
+		ctx = context.WithValue(ctx, logging.LoggerKey, l)
+	}
+	if n, ok := c.Locals(logging.QueriesKey).(*int64); ok {
+		ctx = context.WithValue(ctx, logging.QueriesKey, n)
+	}
+	ctx, cancel := context.WithTimeout(ctx, d)
+	c.Locals(deadlineKey, ctx)
+
+	return ctx, cancel
+}
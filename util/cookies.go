@@ -0,0 +1,42 @@
+package util
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"time"
+)
+
+// The cookies of the sessions, set by GetAuthCookies and cleared by ClearAuthCookies
+const (
+	AccessTokenCookie  = "access_token"
+	RefreshTokenCookie = "refresh_token"
+)
+
+// Cookie returns an HttpOnly cookie of the whole site lasting the ttl, with the Secure, SameSite
+// and Domain of the config
+func (s *TokenService) Cookie(name, value string, ttl time.Duration) *fiber.Cookie {
+	return &fiber.Cookie{
+		Name:     name,
+		Value:    value,
+		Path:     "/",
+		Domain:   s.config.CookieDomain,
+		Expires:  time.Now().Add(ttl),
+		HTTPOnly: true,
+		Secure:   s.config.SecureCookies,
+		SameSite: s.config.CookieSameSite,
+	}
+}
+
+// ClearCookies expires the cookies on the client. They are sent with the Path and Domain of
+// Cookie, the browsers keep a cookie of a domain expired without it.
+func (s *TokenService) ClearCookies(c *fiber.Ctx, names ...string) {
+	for _, name := range names {
+		cookie := s.Cookie(name, "", 0)
+		cookie.Expires = time.Unix(0, 0)
+		c.Cookie(cookie)
+	}
+}
+
+// ClearAuthCookies signs the client out by clearing the cookies of GetAuthCookies
+func (s *TokenService) ClearAuthCookies(c *fiber.Ctx) {
+	s.ClearCookies(c, AccessTokenCookie, RefreshTokenCookie)
+}
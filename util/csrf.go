@@ -0,0 +1,52 @@
+package util
+
+import (
+	"crypto/subtle"
+	"github.com/gofiber/fiber/v2"
+	"task-app/models"
+)
+
+const (
+	// CSRFCookie is readable by the scripts of the app, they send its value back in CSRFHeader
+	CSRFCookie = "csrf_token"
+	CSRFHeader = "X-CSRF-Token"
+)
+
+// CSRF returns a middleware protecting the cookie sessions with a double submit token.
+// Every response without the cookie issues one, and the state-changing requests
+// authenticated by the auth cookies must send it back in the X-CSRF-Token header.
+// Requests with an Authorization header (a bearer token or an API key) are not checked,
+// a browser never adds the header on its own.
+func (s *TokenService) CSRF() func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		token := c.Cookies(CSRFCookie)
+		if token == "" {
+			token = RandomToken(32)
+			cookie := s.Cookie(CSRFCookie, token, s.config.RefreshCookieTTL)
+			// the scripts of the app read it
+			cookie.HTTPOnly = false
+			c.Cookie(cookie)
+		}
+
+		switch c.Method() {
+		case fiber.MethodGet, fiber.MethodHead, fiber.MethodOptions, fiber.MethodTrace:
+			return c.Next()
+		}
+
+		if c.Get("Authorization") != "" || !hasSessionCookie(c) {
+			return c.Next()
+		}
+
+		header := c.Get(CSRFHeader)
+		if header == "" || subtle.ConstantTimeCompare([]byte(header), []byte(c.Cookies(CSRFCookie))) != 1 {
+			return models.NewError(fiber.StatusForbidden, "Missing or invalid CSRF token")
+		}
+
+		return c.Next()
+	}
+}
+
+// hasSessionCookie checks if the request carries one of the auth cookies
+func hasSessionCookie(c *fiber.Ctx) bool {
+	return c.Cookies(AccessTokenCookie) != "" || c.Cookies(RefreshTokenCookie) != ""
+}
@@ -0,0 +1,28 @@
+package util
+
+import (
+	"strconv"
+	"strings"
+)
+
+// AcceptsEncoding tells whether the Accept-Encoding of a request allows the content coding,
+// by its name or *, with a q other than 0
+func AcceptsEncoding(acceptEncoding, encoding string) bool {
+	for _, part := range strings.Split(acceptEncoding, ",") {
+		params := strings.Split(part, ";")
+		if name := strings.TrimSpace(params[0]); name != encoding && name != "*" {
+			continue
+		}
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if q, err := strconv.ParseFloat(param[2:], 64); err == nil && q == 0 {
+					return false
+				}
+			}
+		}
+		return true
+	}
+
+	return false
+}
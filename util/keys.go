@@ -0,0 +1,169 @@
+package util
+
+import (
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"github.com/golang-jwt/jwt/v5"
+	"io/ioutil"
+	"math/big"
+	"task-app/config"
+)
+
+// signingKey is a key of the tokens, identified by the kid header of the tokens it signs
+type signingKey struct {
+	id     string
+	method jwt.SigningMethod
+	sign   interface{}
+	verify interface{}
+	// public is the RSA key published in the JWKS, nil for HMAC
+	public *rsa.PublicKey
+}
+
+// keyRing signs the tokens with the current key and verifies them with every known key,
+// so a rotated key keeps the tokens it signed valid until they expire
+type keyRing struct {
+	current *signingKey
+	keys    []*signingKey
+}
+
+// newKeyRing loads the keys of the config. The secrets always verify the HS256 tokens,
+// which keeps the sessions when the algorithm is changed to RS256.
+func newKeyRing(cfg config.Auth) (*keyRing, error) {
+	r := &keyRing{}
+	for _, secret := range append([]string{cfg.Secret}, cfg.PreviousSecrets...) {
+		r.keys = append(r.keys, hmacKey(secret))
+	}
+	r.current = r.keys[0]
+
+	if cfg.Algorithm != "RS256" {
+		return r, nil
+	}
+
+	for i, file := range append([]string{cfg.RSAKeyFile}, cfg.PreviousRSAKeyFiles...) {
+		key, err := loadRSAKey(file, i == 0)
+		if err != nil {
+			return nil, fmt.Errorf("auth: %s: %v", file, err)
+		}
+		r.keys = append(r.keys, key)
+		if i == 0 {
+			r.current = key
+		}
+	}
+
+	return r, nil
+}
+
+// hmacKey returns the HS256 key of a secret, its id is a digest which does not reveal the secret
+func hmacKey(secret string) *signingKey {
+	sum := sha256.Sum256([]byte("kid:" + secret))
+	return &signingKey{
+		id:     "hs-" + hex.EncodeToString(sum[:8]),
+		method: jwt.SigningMethodHS256,
+		sign:   []byte(secret),
+		verify: []byte(secret),
+	}
+}
+
+// loadRSAKey reads a PEM RSA key, a private key is required to sign
+func loadRSAKey(file string, signing bool) (*signingKey, error) {
+	b, err := ioutil.ReadFile(file)
+	if err != nil {
+		return nil, err
+	}
+
+	key := &signingKey{method: jwt.SigningMethodRS256}
+	if private, err := jwt.ParseRSAPrivateKeyFromPEM(b); err == nil {
+		key.sign, key.public = private, &private.PublicKey
+	} else if signing {
+		return nil, err
+	} else if key.public, err = jwt.ParseRSAPublicKeyFromPEM(b); err != nil {
+		return nil, err
+	}
+	key.verify = key.public
+	key.id = rsaThumbprint(key.public)
+
+	return key, nil
+}
+
+// sign returns the token of the claims signed with the current key
+func (r *keyRing) sign(claims jwt.Claims) (string, error) {
+	token := jwt.NewWithClaims(r.current.method, claims)
+	token.Header["kid"] = r.current.id
+
+	return token.SignedString(r.current.sign)
+}
+
+// keyFunc returns the key of the kid of a token, the method of the token must be the one of the key.
+// The tokens signed before the keys had ids are verified with the secrets.
+func (r *keyRing) keyFunc(token *jwt.Token) (interface{}, error) {
+	kid, _ := token.Header["kid"].(string)
+	if kid == "" {
+		if token.Method != jwt.SigningMethodHS256 {
+			return nil, errors.New("unexpected signing method " + token.Method.Alg())
+		}
+		set := jwt.VerificationKeySet{}
+		for _, k := range r.keys {
+			if k.method == jwt.SigningMethodHS256 {
+				set.Keys = append(set.Keys, k.verify)
+			}
+		}
+		return set, nil
+	}
+
+	for _, k := range r.keys {
+		if k.id == kid {
+			if token.Method != k.method {
+				return nil, errors.New("unexpected signing method " + token.Method.Alg())
+			}
+			return k.verify, nil
+		}
+	}
+
+	return nil, errors.New("unknown key " + kid)
+}
+
+// JWK is a public key of a JSON Web Key Set, RFC 7517
+type JWK struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	Alg string `json:"alg"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+}
+
+// jwks returns the RSA public keys, the current one first
+func (r *keyRing) jwks() []JWK {
+	keys := []JWK{}
+	if r.current.public != nil {
+		keys = append(keys, r.current.jwk())
+	}
+	for _, k := range r.keys {
+		if k.public != nil && k != r.current {
+			keys = append(keys, k.jwk())
+		}
+	}
+
+	return keys
+}
+
+func (k *signingKey) jwk() JWK {
+	n, e := rsaComponents(k.public)
+	return JWK{Kty: "RSA", Kid: k.id, Use: "sig", Alg: k.method.Alg(), N: n, E: e}
+}
+
+// rsaThumbprint returns the JWK thumbprint of RFC 7638 of a public key
+func rsaThumbprint(key *rsa.PublicKey) string {
+	n, e := rsaComponents(key)
+	sum := sha256.Sum256([]byte(`{"e":"` + e + `","kty":"RSA","n":"` + n + `"}`))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
+
+func rsaComponents(key *rsa.PublicKey) (string, string) {
+	e := big.NewInt(int64(key.E)).Bytes()
+	return base64.RawURLEncoding.EncodeToString(key.N.Bytes()), base64.RawURLEncoding.EncodeToString(e)
+}
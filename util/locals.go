@@ -1,17 +1,47 @@
 package util
 
 import (
+	"errors"
 	"github.com/gofiber/fiber/v2"
-	"task-app/db"
+	"strconv"
 	"task-app/models"
 )
 
-func GetUserByLocal(c *fiber.Ctx) (*models.User, error) {
+var ErrAccountLocked = errors.New("account is locked")
+
+// CurrentUser returns the user signed in, locked accounts are treated as missing
+func (s *TokenService) CurrentUser(c *fiber.Ctx) (*models.User, error) {
 	id := c.Locals("id")
 	u := new(models.User)
-	if res := db.DB.Where("id = ?", id).First(&u); res.RowsAffected <= 0 {
+	if res := s.store.DB().WithContext(Context(c)).Where("id = ?", id).First(&u); res.RowsAffected <= 0 {
 		return nil, res.Error
 	}
 
+	if u.Locked {
+		return nil, ErrAccountLocked
+	}
+	if impersonator, ok := c.Locals("impersonator").(string); ok {
+		if id, err := strconv.Atoi(impersonator); err == nil {
+			u.ImpersonatorID = uint(id)
+		}
+	}
+
 	return u, nil
 }
+
+// RequireRole returns a middleware which lets only users with the role through.
+// It must be used after SecureAuth.
+func (s *TokenService) RequireRole(role string) func(*fiber.Ctx) error {
+	return func(c *fiber.Ctx) error {
+		u, err := s.CurrentUser(c)
+		if err != nil {
+			return models.NewError(fiber.StatusForbidden, "Cannot find user by token")
+		}
+
+		if u.Role != role {
+			return models.NewError(fiber.StatusForbidden, "Permission denied")
+		}
+
+		return c.Next()
+	}
+}
@@ -0,0 +1,25 @@
+package util
+
+import (
+	"regexp"
+	"strings"
+)
+
+var mentionRe = regexp.MustCompile(`(?:^|[^\w@])@(\w[\w.-]*)`)
+
+// ParseMentions returns the unique usernames mentioned as @username in a text
+func ParseMentions(text string) []string {
+	seen := make(map[string]bool)
+	var names []string
+
+	for _, m := range mentionRe.FindAllStringSubmatch(text, -1) {
+		// a trailing dot usually ends the sentence, not the username
+		name := strings.TrimRight(m[1], ".-")
+		if !seen[name] {
+			seen[name] = true
+			names = append(names, name)
+		}
+	}
+
+	return names
+}
@@ -0,0 +1,314 @@
+package util
+
+import (
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// QuickAdd is a task written as a line of text, e.g. Pay rent tomorrow 5pm #finance !p1 every month
+type QuickAdd struct {
+	Title  string
+	Labels []string
+	// Priority is 1 to 4, 0 when the text has none
+	Priority int
+	DueAt    *time.Time
+	// Recurrence is a RRULE, e.g. FREQ=MONTHLY
+	Recurrence string
+}
+
+var (
+	quickTimeRe     = regexp.MustCompile(`^(\d{1,2})(?::(\d{2}))?(am|pm)$`)
+	quickClockRe    = regexp.MustCompile(`^([01]?\d|2[0-3]):([0-5]\d)$`)
+	quickPriorityRe = regexp.MustCompile(`^!p([1-4])$`)
+)
+
+var quickWeekdays = map[string]time.Weekday{
+	"sunday": time.Sunday, "monday": time.Monday, "tuesday": time.Tuesday, "wednesday": time.Wednesday,
+	"thursday": time.Thursday, "friday": time.Friday, "saturday": time.Saturday,
+}
+
+var quickMonths = map[string]time.Month{
+	"jan": time.January, "feb": time.February, "mar": time.March, "apr": time.April, "may": time.May, "jun": time.June,
+	"jul": time.July, "aug": time.August, "sep": time.September, "sept": time.September, "oct": time.October,
+	"nov": time.November, "dec": time.December,
+}
+
+// rruleDays are the days of the weekdays in a RRULE BYDAY
+var rruleDays = [...]string{"SU", "MO", "TU", "WE", "TH", "FR", "SA"}
+
+// ParseQuickAdd reads the due date, the labels, the priority and the recurrence of a task from a line
+// of text, the other words are its title. It understands:
+//   - #label for a label and !p1 to !p4 for the priority
+//   - today, tomorrow, a weekday, next week, next month, in 3 days, 2026-10-20, Oct 20 or 20 Oct for the day
+//   - 5pm, 5:30pm or 17:30 for the time, a day without a time is due at its end
+//   - every day, every weekday, every 2 weeks, every monday, every month or every year for the recurrence
+//
+// The days are the ones of the location of now.
+func ParseQuickAdd(text string, now time.Time) QuickAdd {
+	q := QuickAdd{}
+	words := strings.Fields(text)
+	var title []string
+
+	var day *time.Time
+	hour, minute, hasTime := 0, 0, false
+	seen := map[string]bool{}
+
+	for i := 0; i < len(words); i++ {
+		word := words[i]
+		lower := strings.ToLower(strings.TrimRight(word, ".,;"))
+		rest := words[i+1:]
+
+		switch {
+		case strings.HasPrefix(word, "#") && len(word) > 1:
+			name := strings.TrimRight(word[1:], ".,;")
+			if name != "" && !seen[strings.ToLower(name)] {
+				seen[strings.ToLower(name)] = true
+				q.Labels = append(q.Labels, name)
+			}
+			continue
+
+		case quickPriorityRe.MatchString(lower) && q.Priority == 0:
+			q.Priority, _ = strconv.Atoi(lower[2:])
+			continue
+
+		case lower == "every" && q.Recurrence == "":
+			if rule, weekday, n := parseRecurrence(rest); n > 0 {
+				q.Recurrence = rule
+				// the first occurrence on a weekday is its next one
+				if weekday >= 0 && day == nil {
+					d := nextWeekday(now, weekday)
+					day = &d
+				}
+				i += n
+				continue
+			}
+
+		case (lower == "at" || lower == "on" || lower == "by" || lower == "due") && len(rest) > 0:
+			if lower == "at" {
+				if h, m, ok := parseClock(rest[0]); ok && !hasTime {
+					hour, minute, hasTime = h, m, true
+					i++
+					continue
+				}
+			} else if d, n := parseDay(rest, now); n > 0 && day == nil {
+				day = &d
+				i += n
+				continue
+			}
+		}
+
+		if h, m, ok := parseClock(word); ok && !hasTime {
+			hour, minute, hasTime = h, m, true
+			continue
+		}
+		if d, n := parseDay(words[i:], now); n > 0 && day == nil {
+			day = &d
+			i += n - 1
+			continue
+		}
+
+		title = append(title, word)
+	}
+
+	q.Title = strings.Join(title, " ")
+
+	switch {
+	case day != nil && hasTime:
+		due := time.Date(day.Year(), day.Month(), day.Day(), hour, minute, 0, 0, now.Location())
+		q.DueAt = &due
+	case day != nil:
+		due := time.Date(day.Year(), day.Month(), day.Day(), 23, 59, 59, 0, now.Location())
+		q.DueAt = &due
+	case hasTime:
+		// a time alone is the next one, today or tomorrow
+		due := time.Date(now.Year(), now.Month(), now.Day(), hour, minute, 0, 0, now.Location())
+		if !due.After(now) {
+			due = due.AddDate(0, 0, 1)
+		}
+		q.DueAt = &due
+	}
+
+	return q
+}
+
+// parseClock reads a time like 5pm, 5:30pm or 17:30
+func parseClock(word string) (int, int, bool) {
+	word = strings.ToLower(strings.TrimRight(word, ".,;"))
+	if m := quickTimeRe.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		if hour < 1 || hour > 12 || minute > 59 {
+			return 0, 0, false
+		}
+		if m[3] == "pm" && hour != 12 {
+			hour += 12
+		} else if m[3] == "am" && hour == 12 {
+			hour = 0
+		}
+		return hour, minute, true
+	}
+	if m := quickClockRe.FindStringSubmatch(word); m != nil {
+		hour, _ := strconv.Atoi(m[1])
+		minute, _ := strconv.Atoi(m[2])
+		return hour, minute, true
+	}
+
+	return 0, 0, false
+}
+
+// parseDay reads a day at the start of the words and returns how many words it took, 0 without one
+func parseDay(words []string, now time.Time) (time.Time, int) {
+	if len(words) == 0 {
+		return time.Time{}, 0
+	}
+	today := time.Date(now.Year(), now.Month(), now.Day(), 0, 0, 0, 0, now.Location())
+	first := strings.ToLower(strings.TrimRight(words[0], ".,;"))
+	second := ""
+	if len(words) > 1 {
+		second = strings.ToLower(strings.TrimRight(words[1], ".,;"))
+	}
+
+	switch first {
+	case "today":
+		return today, 1
+	case "tomorrow":
+		return today.AddDate(0, 0, 1), 1
+	case "next":
+		if wd, ok := quickWeekdays[second]; ok {
+			return nextWeekday(today, wd), 2
+		}
+		switch second {
+		case "week":
+			// the monday of the next week
+			return nextWeekday(today, time.Monday), 2
+		case "month":
+			return time.Date(today.Year(), today.Month()+1, 1, 0, 0, 0, 0, now.Location()), 2
+		}
+		return time.Time{}, 0
+	case "in":
+		// in 3 days, in a week
+		if len(words) < 3 {
+			return time.Time{}, 0
+		}
+		n, err := strconv.Atoi(second)
+		if second == "a" || second == "an" {
+			n, err = 1, nil
+		}
+		if err != nil || n < 1 || n > 1000 {
+			return time.Time{}, 0
+		}
+		switch strings.TrimSuffix(strings.ToLower(strings.TrimRight(words[2], ".,;")), "s") {
+		case "day":
+			return today.AddDate(0, 0, n), 3
+		case "week":
+			return today.AddDate(0, 0, 7*n), 3
+		case "month":
+			return today.AddDate(0, n, 0), 3
+		case "year":
+			return today.AddDate(n, 0, 0), 3
+		}
+		return time.Time{}, 0
+	}
+
+	if wd, ok := quickWeekdays[first]; ok {
+		return nextWeekday(today, wd), 1
+	}
+	if d, err := time.ParseInLocation("2006-01-02", first, now.Location()); err == nil {
+		return d, 1
+	}
+
+	// Oct 20 or 20 Oct, the next one
+	month, day := time.Month(0), 0
+	if m, ok := monthOf(first); ok {
+		month = m
+		day, _ = strconv.Atoi(second)
+	} else if m, ok := monthOf(second); ok {
+		month = m
+		day, _ = strconv.Atoi(first)
+	}
+	if month == 0 || day < 1 || day > 31 {
+		return time.Time{}, 0
+	}
+	d := time.Date(today.Year(), month, day, 0, 0, 0, 0, now.Location())
+	if d.Month() != month {
+		return time.Time{}, 0
+	}
+	if d.Before(today) {
+		d = d.AddDate(1, 0, 0)
+	}
+
+	return d, 2
+}
+
+// monthOf returns the month of a name like oct or october
+func monthOf(word string) (time.Month, bool) {
+	if len(word) < 3 {
+		return 0, false
+	}
+	m, ok := quickMonths[word]
+	if !ok {
+		if m, ok = quickMonths[word[:3]]; ok && !strings.HasPrefix(strings.ToLower(m.String()), word) {
+			return 0, false
+		}
+	}
+
+	return m, ok
+}
+
+// parseRecurrence reads the words following every and returns the RRULE, the weekday of
+// a weekly rule on a day or -1, and how many words it took, 0 without a recurrence
+func parseRecurrence(words []string) (string, time.Weekday, int) {
+	if len(words) == 0 {
+		return "", -1, 0
+	}
+	first := strings.ToLower(strings.TrimRight(words[0], ".,;"))
+
+	if wd, ok := quickWeekdays[first]; ok {
+		return "FREQ=WEEKLY;BYDAY=" + rruleDays[wd], wd, 1
+	}
+	if first == "weekday" || first == "workday" {
+		return "FREQ=WEEKLY;BYDAY=MO,TU,WE,TH,FR", -1, 1
+	}
+
+	// every 2 weeks, every other month
+	interval, n := 1, 1
+	if len(words) > 1 {
+		if i, err := strconv.Atoi(first); err == nil && i > 1 && i <= 1000 {
+			interval, n, first = i, 2, strings.ToLower(strings.TrimRight(words[1], ".,;"))
+		} else if first == "other" {
+			interval, n, first = 2, 2, strings.ToLower(strings.TrimRight(words[1], ".,;"))
+		}
+	}
+
+	freq := ""
+	switch strings.TrimSuffix(first, "s") {
+	case "day":
+		freq = "DAILY"
+	case "week":
+		freq = "WEEKLY"
+	case "month":
+		freq = "MONTHLY"
+	case "year":
+		freq = "YEARLY"
+	default:
+		return "", -1, 0
+	}
+	if interval > 1 {
+		return "FREQ=" + freq + ";INTERVAL=" + strconv.Itoa(interval), -1, n
+	}
+
+	return "FREQ=" + freq, -1, n
+}
+
+// nextWeekday returns the next day of the weekday after the day of t
+func nextWeekday(t time.Time, wd time.Weekday) time.Time {
+	days := (int(wd) - int(t.Weekday()) + 7) % 7
+	if days == 0 {
+		days = 7
+	}
+	d := t.AddDate(0, 0, days)
+
+	return time.Date(d.Year(), d.Month(), d.Day(), 0, 0, 0, 0, t.Location())
+}
@@ -0,0 +1,96 @@
+package util
+
+import (
+	"github.com/gofiber/fiber/v2"
+	"gorm.io/gorm"
+	"task-app/models"
+	"time"
+)
+
+// maxSessions is how many sessions a user keeps, a new one replaces the least recently used
+const maxSessions = 10
+
+// DeviceOf returns the device of the client of the request
+func DeviceOf(c *fiber.Ctx) models.Device {
+	ua := c.Get(fiber.HeaderUserAgent)
+	if len(ua) > 255 {
+		ua = ua[:255]
+	}
+
+	return models.Device{UserAgent: ua, IP: c.IP()}
+}
+
+// Sessions returns the sessions of the user which are neither expired nor revoked, the most recently used first
+func (s *TokenService) Sessions(uuid string) ([]models.Claims, error) {
+	var sessions []models.Claims
+	err := s.store.DB().
+		Where("issuer = ? AND subject = ? AND expires_at > ?", uuid, "refresh_token", time.Now().Unix()).
+		Where("revoked_at IS NULL").
+		Order("last_used_at DESC, id DESC").
+		Find(&sessions).Error
+
+	return sessions, err
+}
+
+// FindSession returns the stored session of the claims of a refresh token, a revoked one too
+func (s *TokenService) FindSession(claims *models.Claims) (*models.Claims, error) {
+	session := new(models.Claims)
+	err := s.store.DB().Where("token_hash = ? AND issuer = ?", claims.Fingerprint(), claims.Issuer).First(session).Error
+
+	return session, err
+}
+
+// CurrentSession returns the id of the session of the refresh token cookie, 0 without one
+func (s *TokenService) CurrentSession(c *fiber.Ctx) uint {
+	claims := new(models.Claims)
+	token, err := s.ParseClaims(c.Cookies(RefreshTokenCookie), claims)
+	if err != nil || !token.Valid || claims.Subject != "refresh_token" {
+		return 0
+	}
+
+	return claims.ID
+}
+
+// TouchSession records the session of the refresh token is used now
+func (s *TokenService) TouchSession(session *models.Claims, device models.Device) error {
+	return s.store.DB().Model(session).Updates(map[string]interface{}{
+		"last_used_at": time.Now(),
+		"ip":           device.IP,
+	}).Error
+}
+
+// RevokeSession signs a session of the user out, its access tokens stay valid until they expire.
+// It returns false when the user has no such session.
+func (s *TokenService) RevokeSession(uuid string, id uint) (bool, error) {
+	res := s.revoke(s.store.DB().Where("issuer = ? AND id = ?", uuid, id), models.RevokedSignedOut)
+	return res.RowsAffected > 0, res.Error
+}
+
+// RevokeOtherSessions signs out every session of the user but the current one
+func (s *TokenService) RevokeOtherSessions(uuid string, current uint) error {
+	return s.revoke(s.store.DB().Where("issuer = ? AND id <> ?", uuid, current), models.RevokedOtherSession).Error
+}
+
+// revoke marks the sessions of the query which are not revoked yet as revoked for the reason
+func (s *TokenService) revoke(query *gorm.DB, reason string) *gorm.DB {
+	return query.Model(&models.Claims{}).Where("revoked_at IS NULL").Updates(map[string]interface{}{
+		"revoked_at":     time.Now(),
+		"revoked_reason": reason,
+	})
+}
+
+// pruneSessions removes the expired sessions of the user and revokes the least recently used ones,
+// leaving room for a new session
+func (s *TokenService) pruneSessions(uuid string) {
+	s.store.DB().Where("issuer = ? AND expires_at <= ?", uuid, time.Now().Unix()).Delete(&models.Claims{})
+
+	var stale []uint
+	s.store.DB().Model(&models.Claims{}).
+		Where("issuer = ? AND revoked_at IS NULL", uuid).
+		Order("last_used_at DESC, id DESC").
+		Offset(maxSessions-1).
+		Pluck("id", &stale)
+	if len(stale) > 0 {
+		s.revoke(s.store.DB().Where("id IN ?", stale), models.RevokedSessionLimit)
+	}
+}
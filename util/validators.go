@@ -2,32 +2,170 @@ package util
 
 import (
 	valid "github.com/asaskevich/govalidator"
+	"github.com/go-playground/validator/v10"
+	"reflect"
 	"regexp"
+	"strings"
+	"task-app/i18n"
 	"task-app/models"
 )
 
-// IsEmpty checks if a string is empty
-func IsEmpty(str string) (bool, string) {
-	if valid.HasWhitespaceOnly(str) && str != "" {
-		return true, "Must not be empty"
+var validate = newValidator()
+
+// newValidator returns a validator which names the fields by their json name
+// and knows the formats of the app: notblank, strongpassword, hexcolor, rrule and filterquery
+func newValidator() *validator.Validate {
+	v := validator.New()
+	v.RegisterTagNameFunc(func(f reflect.StructField) string {
+		name := strings.SplitN(f.Tag.Get("json"), ",", 2)[0]
+		if name == "-" {
+			return ""
+		}
+		return name
+	})
+
+	v.RegisterValidation("notblank", func(fl validator.FieldLevel) bool {
+		return strings.TrimSpace(fl.Field().String()) != ""
+	})
+	v.RegisterValidation("strongpassword", func(fl validator.FieldLevel) bool {
+		ok, _ := IsStrongPassword(fl.Field().String())
+		return ok
+	})
+	v.RegisterValidation("hexcolor", func(fl validator.FieldLevel) bool {
+		return IsHexColor(fl.Field().String())
+	})
+	v.RegisterValidation("rrule", func(fl validator.FieldLevel) bool {
+		return IsRecurrenceRule(fl.Field().String())
+	})
+	v.RegisterValidation("filterquery", func(fl validator.FieldLevel) bool {
+		_, err := models.ParseFilterQuery(fl.Field().String())
+		return err == nil
+	})
+
+	return v
+}
+
+// Validate checks a request body by the validate tags of its fields.
+// It returns the errors by the json name of the fields, nil when the body is valid.
+func Validate(s interface{}) map[string]string {
+	return ValidateIn(i18n.English, s)
+}
+
+// ValidateIn is Validate with the errors in the language of the printer
+func ValidateIn(p *i18n.Printer, s interface{}) map[string]string {
+	err := validate.Struct(s)
+	if err == nil {
+		return nil
+	}
+
+	errs, ok := err.(validator.ValidationErrors)
+	if !ok {
+		return map[string]string{"body": err.Error()}
 	}
 
-	return false, ""
+	fields := make(map[string]string, len(errs))
+	for _, e := range errs {
+		fields[e.Field()] = validationMessage(p, e)
+	}
+
+	return fields
 }
 
-// ValidateRegister func validates the body of user for registration
-func ValidateRegister(u *models.User) *models.UserErrors {
-	e := &models.UserErrors{}
-	e.Err, e.Username = IsEmpty(u.Username)
+// validationMessage returns the message of a failed tag for the client
+func validationMessage(p *i18n.Printer, e validator.FieldError) string {
+	switch e.Tag() {
+	case "required", "notblank":
+		return p.Text("Must not be empty")
+	case "required_if":
+		// the param are pairs of the Go name of a field and its value, e.g. Op move
+		params := strings.Fields(e.Param())
+		conditions := make([]string, 0, len(params)/2)
+		for i := 0; i+1 < len(params); i += 2 {
+			conditions = append(conditions, strings.ToLower(params[i][:1])+params[i][1:]+" "+params[i+1])
+		}
+		return p.Sprintf("Must not be empty with %s", strings.Join(conditions, " "+p.Text("and")+" "))
+	case "email":
+		return p.Text("Must be a valid email")
+	case "strongpassword":
+		_, msg := IsStrongPassword(e.Value().(string))
+		return p.Text(msg)
+	case "hexcolor":
+		return p.Text("Must be a color in the #rrggbb format")
+	case "rrule":
+		return p.Text("Must be a valid RRULE")
+	case "filterquery":
+		_, err := models.ParseFilterQuery(e.Value().(string))
+		return p.Sprintf("Must be a valid query: %s", err.Error())
+	case "max":
+		return p.Sprintf("Must be at most %s"+sizeUnit(e), e.Param())
+	case "min":
+		return p.Sprintf("Must be at least %s"+sizeUnit(e), e.Param())
+	case "oneof":
+		return p.Sprintf("Must be one of %s", e.Param())
+	case "gtfield":
+		// the param is the Go name of the field, the json name is the same in camel case
+		return p.Sprintf("Must be greater than %s", strings.ToLower(e.Param()[:1])+e.Param()[1:])
+	case "unique":
+		return p.Text("Must not contain duplicates")
+	case "timezone":
+		return p.Text("Must be a time zone like Europe/Berlin")
+	case "bcp47_language_tag":
+		return p.Text("Must be a language tag like en-US")
+	case "datetime":
+		return p.Sprintf("Must be a date in the %s format", e.Param())
+	case "url":
+		return p.Text("Must be a URL like https://example.com")
+	case "fqdn":
+		return p.Text("Must be a domain like example.com")
+	}
+
+	return p.Text("Is invalid")
+}
 
-	if !valid.IsEmail(u.Email) {
-		e.Err, e.Email = true, "Must be a valid email"
+// sizeUnit returns what min and max count for the kind of the field, nothing for numbers.
+// It is a part of the message format, so the message is translated with it.
+func sizeUnit(e validator.FieldError) string {
+	switch e.Kind() {
+	case reflect.String:
+		return " characters long"
+	case reflect.Slice, reflect.Array, reflect.Map:
+		return " items"
 	}
+	return ""
+}
 
+// IsStrongPassword checks if a password is long enough and mixes letters and numbers
+func IsStrongPassword(password string) (bool, string) {
 	re := regexp.MustCompile("\\d") // regex check for at least one integer in string
-	if !(len(u.Password) >= 8 && valid.HasLowerCase(u.Password) && valid.HasUpperCase(u.Password) && re.MatchString(u.Password)) {
-		e.Err, e.Password = true, "Length of password should be atleast 8 and it must be a combination of uppercase letters, lowercase letters and numbers"
+	if !(len(password) >= 8 && valid.HasLowerCase(password) && valid.HasUpperCase(password) && re.MatchString(password)) {
+		return false, "Length of password should be atleast 8 and it must be a combination of uppercase letters, lowercase letters and numbers"
+	}
+
+	return true, ""
+}
+
+// IsHexColor checks if a string is a color in the #rrggbb format
+func IsHexColor(str string) bool {
+	return regexp.MustCompile("^#[0-9a-fA-F]{6}$").MatchString(str)
+}
+
+// IsEmail checks if a string is a valid email
+func IsEmail(str string) bool {
+	return valid.IsEmail(str)
+}
+
+var recurrencePartRe = regexp.MustCompile(`^(FREQ=(DAILY|WEEKLY|MONTHLY|YEARLY)|INTERVAL=[1-9]\d*|COUNT=[1-9]\d*|UNTIL=\d{8}(T\d{6}Z?)?|BYDAY=[+-]?\d{0,2}(MO|TU|WE|TH|FR|SA|SU)(,[+-]?\d{0,2}(MO|TU|WE|TH|FR|SA|SU))*|BYMONTHDAY=-?\d{1,2}(,-?\d{1,2})*|BYMONTH=\d{1,2}(,\d{1,2})*|WKST=(MO|TU|WE|TH|FR|SA|SU))$`)
+
+// IsRecurrenceRule checks if a string is a RRULE value of RFC 5545 with a FREQ,
+// limited to the parts calendar clients commonly support
+func IsRecurrenceRule(str string) bool {
+	hasFreq := false
+	for _, part := range strings.Split(str, ";") {
+		if !recurrencePartRe.MatchString(part) {
+			return false
+		}
+		hasFreq = hasFreq || strings.HasPrefix(part, "FREQ=")
 	}
 
-	return e
+	return hasFreq
 }
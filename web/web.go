@@ -0,0 +1,143 @@
+// Package web serves the single page app of the frontend. Its build is embedded from dist, where
+// the build of the frontend is copied before the server is built, with the .br and .gz variants
+// of the files compressed ahead.
+package web
+
+import (
+	"crypto/sha256"
+	"embed"
+	"encoding/hex"
+	"errors"
+	"github.com/gofiber/fiber/v2"
+	"io/fs"
+	"mime"
+	"path"
+	"regexp"
+	"strings"
+	"task-app/util"
+)
+
+//go:embed dist
+var dist embed.FS
+
+// reserved are the paths of the server, they are never the routes of the app
+var reserved = []string{"/api", "/ws", "/healthz", "/readyz", "/metrics", "/.well-known"}
+
+// hashed matches the names with a content hash, like index.3f9a2c1b.js or app-3f9a2c1b7d.css
+var hashed = regexp.MustCompile(`[.-][0-9a-f]{8,}\.`)
+
+// encodings are the pre-compressed variants, the preferred first
+var encodings = []struct{ name, ext string }{{"br", ".br"}, {"gzip", ".gz"}}
+
+// Dist returns the embedded build of the frontend
+func Dist() fs.FS {
+	sub, err := fs.Sub(dist, "dist")
+	if err != nil {
+		panic(err)
+	}
+
+	return sub
+}
+
+// Handler serves the files of the app, and its index.html at the paths without a file so the app
+// handles its routes. The hashed assets are cached for a year, the others are revalidated with
+// their ETag. The other requests and the paths of the server go to the next handler.
+func Handler(files fs.FS) fiber.Handler {
+	return func(c *fiber.Ctx) error {
+		if c.Method() != fiber.MethodGet && c.Method() != fiber.MethodHead || isReserved(c.Path()) {
+			return c.Next()
+		}
+
+		name := strings.TrimPrefix(path.Clean("/"+c.Path()), "/")
+		if name == "" {
+			name = "index.html"
+		}
+		if !isFile(files, name) {
+			// a missing asset is a 404, the app would be served in place of a script
+			if path.Ext(name) != "" {
+				return c.Next()
+			}
+			name = "index.html"
+		}
+
+		body, encoding, err := readVariant(files, name, c.Get(fiber.HeaderAcceptEncoding))
+		if errors.Is(err, fs.ErrNotExist) {
+			return c.Next()
+		}
+		if err != nil {
+			return err
+		}
+
+		contentType := mime.TypeByExtension(path.Ext(name))
+		if contentType == "" {
+			contentType = fiber.MIMEOctetStream
+		}
+		c.Set(fiber.HeaderContentType, contentType)
+		c.Set(fiber.HeaderVary, fiber.HeaderAcceptEncoding)
+		if encoding != "" {
+			c.Set(fiber.HeaderContentEncoding, encoding)
+		}
+
+		if isHashed(name) {
+			c.Set(fiber.HeaderCacheControl, "public, max-age=31536000, immutable")
+			return c.Send(body)
+		}
+
+		sum := sha256.Sum256(body)
+		etag := `"` + hex.EncodeToString(sum[:16]) + `"`
+		c.Set(fiber.HeaderCacheControl, "no-cache")
+		c.Set(fiber.HeaderETag, etag)
+		if matches(c.Get(fiber.HeaderIfNoneMatch), etag) {
+			return c.SendStatus(fiber.StatusNotModified)
+		}
+
+		return c.Send(body)
+	}
+}
+
+func isReserved(p string) bool {
+	for _, prefix := range reserved {
+		if p == prefix || strings.HasPrefix(p, prefix+"/") {
+			return true
+		}
+	}
+
+	return false
+}
+
+func isFile(files fs.FS, name string) bool {
+	info, err := fs.Stat(files, name)
+	return err == nil && !info.IsDir()
+}
+
+// isHashed tells whether the name changes with the content, so the file is never revalidated
+func isHashed(name string) bool {
+	return strings.HasPrefix(name, "assets/") || hashed.MatchString(path.Base(name))
+}
+
+// readVariant reads the pre-compressed variant of the file accepted by the client, or the file
+func readVariant(files fs.FS, name, acceptEncoding string) ([]byte, string, error) {
+	for _, e := range encodings {
+		if !util.AcceptsEncoding(acceptEncoding, e.name) {
+			continue
+		}
+		if body, err := fs.ReadFile(files, name+e.ext); err == nil {
+			return body, e.name, nil
+		}
+	}
+
+	body, err := fs.ReadFile(files, name)
+	return body, "", err
+}
+
+// matches tells whether the ETag is in the If-None-Match
+func matches(ifNoneMatch, etag string) bool {
+	for _, tag := range strings.Split(ifNoneMatch, ",") {
+		tag = strings.TrimPrefix(strings.TrimSpace(tag), "W/")
+		if tag == etag || tag == "*" {
+			return true
+		}
+	}
+
+	return false
+}
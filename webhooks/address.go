@@ -0,0 +1,111 @@
+package webhooks
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/http"
+	"net/url"
+	"syscall"
+	"time"
+)
+
+// ErrPrivateAddress is the error of a webhook URL reaching the network of the server: its loopback,
+// private, link-local or unspecified addresses, e.g. the metadata service of the cloud at
+// 169.254.169.254 or the database on localhost
+var ErrPrivateAddress = errors.New("webhooks: the URL must reach a public address")
+
+// maxRedirects is how many redirects a delivery follows, each one is checked as the URL
+const maxRedirects = 3
+
+// privateNets are the ranges which are neither loopback nor link-local but not public either
+var privateNets = func() []*net.IPNet {
+	var nets []*net.IPNet
+	for _, cidr := range []string{
+		"0.0.0.0/8", "10.0.0.0/8", "100.64.0.0/10", "172.16.0.0/12", "192.0.0.0/24", "192.168.0.0/16",
+		"198.18.0.0/15", "240.0.0.0/4", "fc00::/7",
+	} {
+		_, n, err := net.ParseCIDR(cidr)
+		if err != nil {
+			panic(err)
+		}
+		nets = append(nets, n)
+	}
+
+	return nets
+}()
+
+// Client posts the deliveries, and makes the other requests to URLs given by the users, e.g. the
+// issuers of the single sign-on. The addresses are checked as they are dialed, after the DNS
+// resolution, so a host resolving to a public address when checked and a private one when
+// delivered is refused too. There is no proxy, its address would be the one checked.
+var Client = &http.Client{
+	Timeout: 10 * time.Second,
+	Transport: &http.Transport{
+		DialContext: (&net.Dialer{
+			Timeout: 5 * time.Second,
+			Control: func(network, address string, _ syscall.RawConn) error {
+				host, _, err := net.SplitHostPort(address)
+				if err != nil {
+					return err
+				}
+				if !publicIP(net.ParseIP(host)) {
+					return ErrPrivateAddress
+				}
+				return nil
+			},
+		}).DialContext,
+		TLSHandshakeTimeout:   5 * time.Second,
+		ResponseHeaderTimeout: 10 * time.Second,
+		MaxIdleConns:          10,
+		IdleConnTimeout:       90 * time.Second,
+	},
+	CheckRedirect: func(req *http.Request, via []*http.Request) error {
+		if len(via) >= maxRedirects {
+			return fmt.Errorf("webhooks: stopped after %d redirects", maxRedirects)
+		}
+		return CheckURL(req.Context(), req.URL.String())
+	},
+}
+
+// CheckURL checks a webhook URL is an http(s) URL whose host resolves to public addresses only
+func CheckURL(ctx context.Context, raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Hostname() == "" {
+		return errors.New("webhooks: the URL must be a valid http(s) URL")
+	}
+
+	if ip := net.ParseIP(u.Hostname()); ip != nil {
+		if !publicIP(ip) {
+			return ErrPrivateAddress
+		}
+		return nil
+	}
+	addrs, err := net.DefaultResolver.LookupIPAddr(ctx, u.Hostname())
+	if err != nil {
+		return fmt.Errorf("webhooks: cannot resolve %s", u.Hostname())
+	}
+	for _, addr := range addrs {
+		if !publicIP(addr.IP) {
+			return ErrPrivateAddress
+		}
+	}
+
+	return nil
+}
+
+// publicIP tells whether a webhook can reach the address
+func publicIP(ip net.IP) bool {
+	if ip == nil || ip.IsLoopback() || ip.IsUnspecified() || ip.IsLinkLocalUnicast() ||
+		ip.IsLinkLocalMulticast() || ip.IsInterfaceLocalMulticast() || ip.IsMulticast() {
+		return false
+	}
+	for _, n := range privateNets {
+		if n.Contains(ip) {
+			return false
+		}
+	}
+
+	return true
+}
@@ -0,0 +1,233 @@
+package webhooks
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"github.com/google/uuid"
+	"net/http"
+	"sync"
+	"task-app/db"
+	"task-app/events"
+	"task-app/logging"
+	"task-app/metrics"
+	"task-app/models"
+	"task-app/queue"
+	"time"
+)
+
+// Events are the event types a webhook can subscribe to
+var Events = []string{
+	events.TaskCreated,
+	events.TaskUpdated,
+	events.TaskCompleted,
+	events.TaskDeleted,
+	events.TaskAssigned,
+	events.TaskOverdue,
+	events.CommentAdded,
+}
+
+const (
+	// MaxAttempts is how many times a delivery is tried before giving up
+	MaxAttempts = 5
+	// first retry delay, doubled on every next attempt
+	initialBackoff = 2 * time.Second
+	// deliveryJob is the kind of the jobs delivering an event to a webhook
+	deliveryJob = "webhook.deliver"
+
+	SignatureHeader = "X-Tasker-Signature"
+	EventHeader     = "X-Tasker-Event"
+	DeliveryHeader  = "X-Tasker-Delivery"
+)
+
+var inflight sync.WaitGroup
+
+// envelope is the JSON body posted to the webhook url
+type envelope struct {
+	ID        string       `json:"id"`
+	Event     string       `json:"event"`
+	CreatedAt time.Time    `json:"createdAt"`
+	Data      events.Event `json:"data"`
+}
+
+// delivery is the payload of a delivery job
+type delivery struct {
+	WebhookID  uint            `json:"webhookId"`
+	DeliveryID string          `json:"deliveryId"`
+	Event      string          `json:"event"`
+	Body       json.RawMessage `json:"body"`
+}
+
+// Setup registers the job delivering the events, retried with exponential backoff
+func Setup() {
+	queue.Register(deliveryJob, deliverJob, queue.Policy{
+		MaxAttempts: MaxAttempts,
+		Backoff:     initialBackoff,
+		MaxBackoff:  time.Minute,
+	})
+}
+
+// Dispatch queues the delivery of the event to the webhooks of every user who can see it.
+// The subscribers are found in the background, so it never slows down the request.
+func Dispatch(e events.Event) {
+	inflight.Add(1)
+	go func() {
+		defer inflight.Done()
+		for _, w := range subscribers(e) {
+			enqueue(w, e)
+		}
+	}()
+}
+
+// Stop waits for the dispatches in progress, the queue runs the deliveries
+func Stop() {
+	inflight.Wait()
+}
+
+// subscribers returns the active webhooks of the users who can see the event
+func subscribers(e events.Event) []models.Webhook {
+	query := db.DB.Where("active = ?", true)
+	if e.WorkspaceID != nil {
+		query = query.Where(
+			"user_id IN (?)",
+			db.DB.Model(&models.Membership{}).Select("user_id").Where("workspace_id = ?", *e.WorkspaceID),
+		)
+	} else {
+		query = query.Where("user_id = ?", e.OwnerID)
+	}
+
+	var hooks []models.Webhook
+	if err := query.Find(&hooks).Error; err != nil {
+		logging.Log.Error().Err(err).Msg("Cannot find webhooks")
+		return nil
+	}
+
+	accepted := hooks[:0]
+	for _, w := range hooks {
+		if w.Accepts(e.Type) {
+			accepted = append(accepted, w)
+		}
+	}
+
+	return accepted
+}
+
+// enqueue queues the delivery of the event to the webhook, its attempts share the delivery id
+func enqueue(w models.Webhook, e events.Event) {
+	deliveryID := uuid.New().String()
+	body, err := json.Marshal(envelope{
+		ID:        deliveryID,
+		Event:     e.Type,
+		CreatedAt: e.CreatedAt,
+		Data:      e,
+	})
+	if err != nil {
+		logging.Log.Error().Err(err).Msg("Cannot encode webhook payload")
+		return
+	}
+
+	d := delivery{WebhookID: w.ID, DeliveryID: deliveryID, Event: e.Type, Body: body}
+	if _, err := queue.Enqueue(deliveryJob, d); err != nil {
+		logging.Log.Error().Err(err).Uint("webhook", w.ID).Msg("Cannot queue the webhook delivery")
+	}
+}
+
+// deliverJob posts the event of a delivery job to the webhook, a failed attempt fails the
+// job so it is retried. Every attempt is written to the delivery log.
+func deliverJob(ctx context.Context, job *queue.Job) error {
+	var d delivery
+	if err := json.Unmarshal(job.Payload, &d); err != nil {
+		return queue.Permanent(err)
+	}
+
+	// the webhook may have been removed or paused since the event
+	var w models.Webhook
+	if res := db.DB.Where("id = ? AND active = ?", d.WebhookID, true).Limit(1).Find(&w); res.Error != nil {
+		return res.Error
+	} else if res.RowsAffected == 0 {
+		return nil
+	}
+
+	attempt, err := attemptDelivery(ctx, w, d.Event, d.DeliveryID, d.Body)
+	attempt.Attempt = job.Attempt
+	db.DB.Create(&attempt)
+	metrics.WebhookDeliveries.Inc(deliveryResult(attempt))
+
+	// an address of the network of the server is refused on every attempt
+	if errors.Is(err, ErrPrivateAddress) {
+		return queue.Permanent(err)
+	}
+	if !attempt.Success {
+		return errors.New(attempt.Error)
+	}
+
+	return nil
+}
+
+func deliveryResult(d models.WebhookDelivery) string {
+	if d.Success {
+		return "success"
+	}
+	return "failure"
+}
+
+// attemptDelivery posts the body to the webhook, the error is the one of the request when it
+// could not be sent
+func attemptDelivery(ctx context.Context, w models.Webhook, event, deliveryID string, body []byte) (models.WebhookDelivery, error) {
+	d := models.WebhookDelivery{
+		WebhookID:  w.ID,
+		DeliveryID: deliveryID,
+		Event:      event,
+		Payload:    string(body),
+	}
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, w.URL, bytes.NewReader(body))
+	if err != nil {
+		d.Error = err.Error()
+		return d, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "Tasker-Webhooks/1.0")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, deliveryID)
+	req.Header.Set(SignatureHeader, "sha256="+Sign(w.Secret, body))
+
+	start := time.Now()
+	res, err := Client.Do(req)
+	d.DurationMs = time.Since(start).Milliseconds()
+	if err != nil {
+		d.Error = err.Error()
+		return d, err
+	}
+	res.Body.Close()
+
+	d.StatusCode = res.StatusCode
+	d.Success = res.StatusCode >= 200 && res.StatusCode < 300
+	if !d.Success {
+		d.Error = res.Status
+	}
+
+	return d, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of the body, receivers compare it with the signature header
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return hex.EncodeToString(mac.Sum(nil))
+}
+
+// IsEvent checks if a webhook can subscribe to the event type
+func IsEvent(event string) bool {
+	for _, e := range Events {
+		if e == event {
+			return true
+		}
+	}
+
+	return false
+}